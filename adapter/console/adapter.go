@@ -0,0 +1,335 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// UserID 本地控制台用户的 ID，消息来自 Console:local
+const UserID = "local"
+
+// ConsoleAdapter 从标准输入读取消息、把回复打印到标准输出，无需 Telegram/QQ 凭据即可在本地测试插件和 AI。
+// 以 "/" 开头的行作为指令；":file <路径> [说明]" 发送本地文件（图片按照片处理）；
+// 机器人发送按钮时以编号列出，输入编号即视为点击。
+type ConsoleAdapter struct {
+	in     io.Reader
+	out    io.Writer
+	logger *slog.Logger
+	outMu  sync.Mutex
+	msgSeq atomic.Int64
+	done   chan struct{}
+	once   sync.Once
+
+	commandHandlers  map[string]core.Handler
+	callbackHandlers map[string]core.Handler
+	textHandler      core.Handler
+	documentHandler  core.Handler
+	photoHandler     core.Handler
+
+	pendingMu      sync.Mutex
+	pendingButtons []core.Button
+}
+
+func New(in io.Reader, out io.Writer, logger *slog.Logger) *ConsoleAdapter {
+	return &ConsoleAdapter{
+		in:               in,
+		out:              out,
+		logger:           logger,
+		done:             make(chan struct{}),
+		commandHandlers:  make(map[string]core.Handler),
+		callbackHandlers: make(map[string]core.Handler),
+	}
+}
+
+func (a *ConsoleAdapter) Name() string {
+	return "Console"
+}
+
+func (a *ConsoleAdapter) Start() error {
+	a.logger.Info("Starting console, type messages and press Enter, Ctrl-D to quit")
+	go a.loop()
+	return nil
+}
+
+func (a *ConsoleAdapter) Stop() error {
+	a.once.Do(func() { close(a.done) })
+	return nil
+}
+
+// Done is closed when the input ends or the adapter is stopped
+func (a *ConsoleAdapter) Done() <-chan struct{} {
+	return a.done
+}
+
+func (a *ConsoleAdapter) loop() {
+	defer a.Stop()
+	scanner := bufio.NewScanner(a.in)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	a.prompt()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			if err := a.dispatch(line); err != nil {
+				a.logger.Error("Console handler error", "error", err, "request_id", core.ErrorRequestID(err))
+			}
+		}
+		a.prompt()
+	}
+	if err := scanner.Err(); err != nil {
+		a.logger.Error("Console input error", "error", err)
+	}
+}
+
+func (a *ConsoleAdapter) prompt() {
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	fmt.Fprint(a.out, "> ")
+}
+
+// print 输出机器人发出的内容，回复可能来自后台 goroutine，需要加锁
+func (a *ConsoleAdapter) print(format string, args ...any) {
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	fmt.Fprintf(a.out, "\r"+format+"\n", args...)
+}
+
+func (a *ConsoleAdapter) dispatch(line string) error {
+	ctx := &ConsoleContext{adapter: a, text: line}
+
+	if button, ok := a.takeChoice(line); ok {
+		if handler, ok := a.callbackHandlers[button.Name]; ok {
+			ctx.callbackData = button.Data
+			return handler(ctx)
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(line, ":file "); ok {
+		doc, caption, err := localDocument(rest)
+		if err != nil {
+			a.print("⚠️ %v", err)
+			return nil
+		}
+		ctx.text = caption
+		if strings.HasPrefix(doc.MIMEType, "image/") && a.photoHandler != nil {
+			ctx.photo = doc
+			return a.photoHandler(ctx)
+		}
+		if a.documentHandler != nil {
+			ctx.document = doc
+			return a.documentHandler(ctx)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(line, "/") {
+		cmd, _, _ := strings.Cut(strings.Fields(line)[0], "@")
+		if handler, ok := a.commandHandlers[cmd]; ok {
+			return handler(ctx)
+		}
+	}
+
+	if a.textHandler != nil {
+		return a.textHandler(ctx)
+	}
+	return nil
+}
+
+// localDocument 解析 ":file" 之后的 "<路径> [说明]"
+func localDocument(arg string) (*core.Document, string, error) {
+	path, caption, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		return nil, "", fmt.Errorf("%s is a directory", path)
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &core.Document{
+		ID:       path,
+		Name:     filepath.Base(path),
+		MIMEType: mimeType,
+		Size:     info.Size(),
+	}, strings.TrimSpace(caption), nil
+}
+
+// takeChoice resolves a numeric input to the last buttons sent
+func (a *ConsoleAdapter) takeChoice(line string) (core.Button, bool) {
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return core.Button{}, false
+	}
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+	if n < 1 || n > len(a.pendingButtons) {
+		return core.Button{}, false
+	}
+	button := a.pendingButtons[n-1]
+	a.pendingButtons = nil
+	return button, true
+}
+
+func (a *ConsoleAdapter) RegisterCommand(cmd string, handler core.Handler) {
+	a.commandHandlers[cmd] = handler
+}
+
+func (a *ConsoleAdapter) RegisterText(handler core.Handler) {
+	a.textHandler = handler
+}
+
+func (a *ConsoleAdapter) RegisterDocument(handler core.Handler) {
+	a.documentHandler = handler
+}
+
+func (a *ConsoleAdapter) RegisterPhoto(handler core.Handler) {
+	a.photoHandler = handler
+}
+
+func (a *ConsoleAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.callbackHandlers[name] = handler
+}
+
+// SendTo prints messages addressed to any recipient on the console
+func (a *ConsoleAdapter) SendTo(recipient string, text string) error {
+	a.print("📨 [%s] %s", recipient, renderMentions(text))
+	return nil
+}
+
+func renderMentions(text string) string {
+	return core.RenderMentions(text, core.MentionName)
+}
+
+// ConsoleContext 控制台中的一条输入
+type ConsoleContext struct {
+	adapter      *ConsoleAdapter
+	text         string
+	callbackData string
+	document     *core.Document
+	photo        *core.Document
+}
+
+func (c *ConsoleContext) Sender() *core.User {
+	return &core.User{ID: UserID, Username: UserID}
+}
+
+func (c *ConsoleContext) Chat() *core.Chat {
+	return &core.Chat{ID: UserID, Type: "private"}
+}
+
+func (c *ConsoleContext) Text() string {
+	return c.text
+}
+
+func (c *ConsoleContext) Data() string {
+	return c.callbackData
+}
+
+func (c *ConsoleContext) Document() *core.Document {
+	return c.document
+}
+
+func (c *ConsoleContext) Photo() *core.Document {
+	return c.photo
+}
+
+// Download opens the local file, the document ID is its path
+func (c *ConsoleContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	return os.Open(doc.ID)
+}
+
+func (c *ConsoleContext) Reply(text string) error {
+	_, err := c.Send(text)
+	return err
+}
+
+func (c *ConsoleContext) Send(text string) (core.Message, error) {
+	msg := c.adapter.newMessage()
+	c.adapter.print("🤖 %s", renderMentions(text))
+	return msg, nil
+}
+
+func (c *ConsoleContext) Edit(msg core.Message, text string) error {
+	c.adapter.print("🤖 (编辑 #%s) %s", msg.ID(), renderMentions(text))
+	return nil
+}
+
+func (c *ConsoleContext) Delete(msg core.Message) error {
+	c.adapter.print("🗑️ (已删除 #%s)", msg.ID())
+	return nil
+}
+
+// SendFile saves the file to a temporary directory and prints its path
+func (c *ConsoleContext) SendFile(file *core.File) error {
+	dir := filepath.Join(os.TempDir(), "ggbot-console")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, filepath.Base(file.Name))
+	if err := os.WriteFile(path, file.Data, 0o644); err != nil {
+		return err
+	}
+	c.adapter.print("📎 %s (%d bytes) %s", path, len(file.Data), file.Caption)
+	return nil
+}
+
+func (c *ConsoleContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	var buttons []core.Button
+	var b strings.Builder
+	b.WriteString(renderMentions(text))
+	for _, row := range rows {
+		for _, button := range row {
+			buttons = append(buttons, button)
+			fmt.Fprintf(&b, "\n  [%d] %s", len(buttons), button.Text)
+		}
+	}
+	c.adapter.pendingMu.Lock()
+	c.adapter.pendingButtons = buttons
+	c.adapter.pendingMu.Unlock()
+
+	msg := c.adapter.newMessage()
+	c.adapter.print("🤖 %s", b.String())
+	return msg, nil
+}
+
+func (c *ConsoleContext) React(emoji string) error {
+	c.adapter.print("%s", emoji)
+	return nil
+}
+
+func (c *ConsoleContext) Notify(action core.ChatAction) error {
+	return nil
+}
+
+func (c *ConsoleContext) Member(userID string) (*core.Member, error) {
+	return nil, core.ErrNotSupported
+}
+
+func (c *ConsoleContext) Platform() string {
+	return "Console"
+}
+
+func (a *ConsoleAdapter) newMessage() *ConsoleMessage {
+	return &ConsoleMessage{id: a.msgSeq.Add(1)}
+}
+
+type ConsoleMessage struct {
+	id int64
+}
+
+func (m *ConsoleMessage) ID() string {
+	return strconv.FormatInt(m.id, 10)
+}
@@ -0,0 +1,533 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+)
+
+const (
+	// netTimeout 连接 IMAP/SMTP 服务器的超时时间
+	netTimeout = 30 * time.Second
+	// maxPerPoll 每次轮询最多处理的邮件数，其余留到下一次
+	maxPerPoll = 20
+)
+
+// EmailAdapter 轮询 IMAP 收件箱，把每封未读邮件作为一条私聊消息（发件地址即用户），通过 SMTP 回复。
+// 处理过的邮件标记为已读；自动回复、退信和邮件列表的邮件直接忽略。
+type EmailAdapter struct {
+	cfg      config.EmailConfig
+	password string
+	from     string
+	logger   *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	commandHandlers  map[string]core.Handler
+	callbackHandlers map[string]core.Handler
+	textHandler      core.Handler
+	documentHandler  core.Handler
+	photoHandler     core.Handler
+
+	// 按钮以编号列表发送，用户回信编号即视为点击
+	choiceMu sync.Mutex
+	choices  map[string]*pendingChoice
+}
+
+// pendingChoice 等待用户回复编号的按钮组
+type pendingChoice struct {
+	buttons []core.Button
+	expires time.Time
+}
+
+func init() {
+	core.RegisterAdapterFactory("email", func(ac *core.AdapterConfig, logger *slog.Logger) (core.Platform, error) {
+		cfg := ac.Config.Email
+		if err := ac.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.IMAP == "" {
+			return nil, nil
+		}
+		if cfg.From == "" {
+			cfg.From = cfg.Username
+		}
+		return New(cfg, logger)
+	})
+}
+
+func New(cfg config.EmailConfig, logger *slog.Logger) (*EmailAdapter, error) {
+	if cfg.SMTP == "" {
+		return nil, fmt.Errorf("email smtp server is required")
+	}
+	if cfg.AuthServID == "" {
+		return nil, fmt.Errorf("email authserv_id is required, sender addresses can be forged without DKIM/DMARC checks")
+	}
+	for _, addr := range []string{cfg.IMAP, cfg.SMTP} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid email server %q, expected host:port", addr)
+		}
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email from address %q: %w", cfg.From, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	logger.Info("Email adapter initialized", "imap", cfg.IMAP, "smtp", cfg.SMTP, "from", from.Address)
+	return &EmailAdapter{
+		cfg:              cfg,
+		password:         cfg.Password,
+		from:             strings.ToLower(from.Address),
+		logger:           logger,
+		ctx:              ctx,
+		cancel:           cancel,
+		commandHandlers:  make(map[string]core.Handler),
+		callbackHandlers: make(map[string]core.Handler),
+		choices:          make(map[string]*pendingChoice),
+	}, nil
+}
+
+func (a *EmailAdapter) Name() string {
+	return "Email"
+}
+
+func (a *EmailAdapter) Start() error {
+	a.logger.Info("Starting Email", "interval", a.cfg.Interval)
+	go a.run()
+	return nil
+}
+
+func (a *EmailAdapter) Stop() error {
+	a.cancel()
+	return nil
+}
+
+// run 按间隔轮询收件箱
+func (a *EmailAdapter) run() {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := a.poll(); err != nil && a.ctx.Err() == nil {
+			a.logger.Error("Email poll failed", "error", err)
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 收取未读邮件并标记为已读，邮件在退出 IMAP 会话后再处理
+func (a *EmailAdapter) poll() error {
+	c, err := dialIMAP(a.cfg.IMAP, netTimeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Login(a.cfg.Username, a.password); err != nil {
+		return err
+	}
+	if err := c.Select(a.cfg.Mailbox); err != nil {
+		return err
+	}
+	uids, err := c.SearchUnseen()
+	if err != nil {
+		return err
+	}
+	if len(uids) > maxPerPoll {
+		uids = uids[:maxPerPoll]
+	}
+
+	var raws [][]byte
+	for _, uid := range uids {
+		raw, err := c.Fetch(uid)
+		if err != nil {
+			return err
+		}
+		// 先标记为已读，处理失败也不会反复回复同一封邮件
+		if err := c.MarkSeen(uid); err != nil {
+			return err
+		}
+		raws = append(raws, raw)
+	}
+	_ = c.Logout()
+
+	for _, raw := range raws {
+		msg, err := parseMessage(raw)
+		if err != nil {
+			a.logger.Warn("Invalid email", "error", err)
+			continue
+		}
+		if msg.auto || msg.from == a.from {
+			a.logger.Debug("Ignoring automatic email", "from", msg.from, "subject", msg.subject)
+			continue
+		}
+		if !authenticated(msg.authResults, a.cfg.AuthServID, msg.from) {
+			a.logger.Warn("Ignoring unauthenticated email", "from", msg.from, "subject", msg.subject)
+			continue
+		}
+		// 每封邮件在独立的 goroutine 中处理，AI 回复可能较慢
+		go func() {
+			if err := a.dispatch(msg); err != nil {
+				a.logger.Error("Email handler error", "error", err, "request_id", core.ErrorRequestID(err))
+			}
+		}()
+	}
+	return nil
+}
+
+func (a *EmailAdapter) dispatch(msg *incoming) error {
+	ctx := &EmailContext{adapter: a, msg: msg, text: messageText(msg)}
+
+	firstLine, _, _ := strings.Cut(ctx.text, "\n")
+	if button, ok := a.takeChoice(msg.from, strings.TrimSpace(firstLine)); ok {
+		if handler, ok := a.callbackHandlers[button.Name]; ok {
+			ctx.callbackData = button.Data
+			return handler(ctx)
+		}
+	}
+
+	for i := range msg.attachments {
+		att := &msg.attachments[i]
+		doc := &core.Document{ID: strconv.Itoa(i), Name: att.name, MIMEType: att.mimeType, Size: int64(len(att.data))}
+		if strings.HasPrefix(att.mimeType, "image/") && a.photoHandler != nil {
+			ctx.photo = doc
+			return a.photoHandler(ctx)
+		}
+		if a.documentHandler != nil {
+			ctx.document = doc
+			return a.documentHandler(ctx)
+		}
+	}
+
+	if strings.HasPrefix(ctx.text, "/") {
+		if handler, ok := a.commandHandlers[strings.Fields(ctx.text)[0]]; ok {
+			return handler(ctx)
+		}
+	}
+
+	if a.textHandler != nil && ctx.text != "" {
+		return a.textHandler(ctx)
+	}
+	return nil
+}
+
+// messageText 正文为空或主题是指令（如 "/news"）时使用主题
+func messageText(msg *incoming) string {
+	subject := trimReplyPrefix(msg.subject)
+	switch {
+	case strings.HasPrefix(msg.text, "/"):
+		return msg.text
+	case strings.HasPrefix(subject, "/"):
+		return strings.TrimSpace(subject + "\n" + msg.text)
+	case msg.text == "":
+		return subject
+	}
+	return msg.text
+}
+
+// trimReplyPrefix 去掉主题中的 "Re:"、"Fwd:"、"回复：" 等前缀
+func trimReplyPrefix(subject string) string {
+	subject = strings.TrimSpace(subject)
+	for {
+		trimmed := subject
+		for _, prefix := range []string{"re:", "fw:", "fwd:", "回复:", "回复：", "转发:", "转发："} {
+			if len(trimmed) >= len(prefix) && strings.EqualFold(trimmed[:len(prefix)], prefix) {
+				trimmed = strings.TrimSpace(trimmed[len(prefix):])
+			}
+		}
+		if trimmed == subject {
+			return subject
+		}
+		subject = trimmed
+	}
+}
+
+// takeChoice resolves a numeric reply to a pending button group
+func (a *EmailAdapter) takeChoice(from, content string) (core.Button, bool) {
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return core.Button{}, false
+	}
+
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	choice, ok := a.choices[from]
+	if !ok || time.Now().After(choice.expires) || n < 1 || n > len(choice.buttons) {
+		return core.Button{}, false
+	}
+	delete(a.choices, from)
+	return choice.buttons[n-1], true
+}
+
+func (a *EmailAdapter) setChoice(from string, buttons []core.Button) {
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	now := time.Now()
+	for key, choice := range a.choices {
+		if now.After(choice.expires) {
+			delete(a.choices, key)
+		}
+	}
+	// 邮件往返较慢，按钮的有效期比聊天平台长
+	a.choices[from] = &pendingChoice{buttons: buttons, expires: now.Add(24 * time.Hour)}
+}
+
+// send 通过 SMTP 发送邮件，返回 Message-ID
+func (a *EmailAdapter) send(out *outgoing) (string, error) {
+	data, messageID := compose(a.from, out)
+	host, port, _ := net.SplitHostPort(a.cfg.SMTP)
+
+	var c *smtp.Client
+	if port == "465" {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: netTimeout}, "tcp", a.cfg.SMTP, &tls.Config{ServerName: host})
+		if err != nil {
+			return "", err
+		}
+		c, err = smtp.NewClient(conn, host)
+		if err != nil {
+			conn.Close()
+			return "", err
+		}
+	} else {
+		conn, err := net.DialTimeout("tcp", a.cfg.SMTP, netTimeout)
+		if err != nil {
+			return "", err
+		}
+		c, err = smtp.NewClient(conn, host)
+		if err != nil {
+			conn.Close()
+			return "", err
+		}
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				c.Close()
+				return "", err
+			}
+		}
+	}
+	defer c.Close()
+
+	if a.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", a.cfg.Username, a.password, host)); err != nil {
+			return "", err
+		}
+	}
+	if err := c.Mail(a.from); err != nil {
+		return "", err
+	}
+	if err := c.Rcpt(out.to); err != nil {
+		return "", err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return messageID, c.Quit()
+}
+
+func (a *EmailAdapter) RegisterCommand(cmd string, handler core.Handler) {
+	a.commandHandlers[cmd] = handler
+}
+
+func (a *EmailAdapter) RegisterText(handler core.Handler) {
+	a.textHandler = handler
+}
+
+func (a *EmailAdapter) RegisterDocument(handler core.Handler) {
+	a.documentHandler = handler
+}
+
+func (a *EmailAdapter) RegisterPhoto(handler core.Handler) {
+	a.photoHandler = handler
+}
+
+func (a *EmailAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.callbackHandlers[name] = handler
+}
+
+// SendTo sends an email to the address, the first line of text becomes the subject
+func (a *EmailAdapter) SendTo(recipient string, text string) error {
+	addr, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return core.Permanent(fmt.Errorf("invalid email recipient: %s", recipient))
+	}
+	_, err = a.send(&outgoing{to: addr.Address, subject: subjectOf(text), text: text})
+	return err
+}
+
+// subjectOf 取正文第一行作为主题
+func subjectOf(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	line = strings.TrimSpace(strings.Trim(line, "*#_ "))
+	if runes := []rune(line); len(runes) > 60 {
+		line = string(runes[:60]) + "…"
+	}
+	if line == "" {
+		return "ggbot"
+	}
+	return line
+}
+
+// EmailContext 一封邮件
+type EmailContext struct {
+	adapter      *EmailAdapter
+	msg          *incoming
+	text         string
+	document     *core.Document
+	photo        *core.Document
+	callbackData string
+}
+
+func (c *EmailContext) Sender() *core.User {
+	name := c.msg.name
+	if name == "" {
+		name = c.msg.from
+	}
+	return &core.User{ID: c.msg.from, Username: name}
+}
+
+// Chat 每个发件地址是一个私聊，ID 与 SendTo 的格式一致
+func (c *EmailContext) Chat() *core.Chat {
+	return &core.Chat{ID: c.msg.from, Type: "private"}
+}
+
+func (c *EmailContext) Text() string {
+	return c.text
+}
+
+func (c *EmailContext) Data() string {
+	return c.callbackData
+}
+
+func (c *EmailContext) Document() *core.Document {
+	return c.document
+}
+
+func (c *EmailContext) Photo() *core.Document {
+	return c.photo
+}
+
+// Download 附件已随邮件收取，ID 为附件序号
+func (c *EmailContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	i, err := strconv.Atoi(doc.ID)
+	if err != nil || i < 0 || i >= len(c.msg.attachments) {
+		return nil, fmt.Errorf("attachment not found: %s", doc.Name)
+	}
+	return io.NopCloser(bytes.NewReader(c.msg.attachments[i].data)), nil
+}
+
+func (c *EmailContext) Reply(text string) error {
+	_, err := c.Send(text)
+	return err
+}
+
+// Send 回复到原邮件的会话中
+func (c *EmailContext) Send(text string) (core.Message, error) {
+	return c.send(text, nil)
+}
+
+func (c *EmailContext) send(text string, files []*core.File) (core.Message, error) {
+	id, err := c.adapter.send(&outgoing{
+		to:         c.msg.from,
+		subject:    replySubject(c.msg.subject),
+		inReplyTo:  c.msg.messageID,
+		references: c.msg.references,
+		text:       text,
+		files:      files,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EmailMessage{id: id}, nil
+}
+
+// Edit 邮件无法修改，发送一封新邮件
+// NoEdit 邮件不能修改，Edit 发送新邮件
+func (c *EmailContext) NoEdit() {}
+
+func (c *EmailContext) Edit(msg core.Message, text string) error {
+	return c.Reply(text)
+}
+
+func (c *EmailContext) Delete(msg core.Message) error {
+	return core.ErrNotSupported
+}
+
+// SendFile 以附件发送
+func (c *EmailContext) SendFile(file *core.File) error {
+	text := file.Caption
+	if text == "" {
+		text = file.Name
+	}
+	_, err := c.send(text, []*core.File{file})
+	return err
+}
+
+// SendButtons 以编号列表发送按钮，用户回信编号即触发对应回调
+func (c *EmailContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	var buttons []core.Button
+	var b strings.Builder
+	b.WriteString(text)
+	for _, row := range rows {
+		for _, button := range row {
+			buttons = append(buttons, button)
+			fmt.Fprintf(&b, "\n%d. %s", len(buttons), button.Text)
+		}
+	}
+	b.WriteString("\n\n回信编号选择")
+	msg, err := c.Send(b.String())
+	if err != nil {
+		return nil, err
+	}
+	c.adapter.setChoice(c.msg.from, buttons)
+	return msg, nil
+}
+
+func (c *EmailContext) React(emoji string) error {
+	return core.ErrNotSupported
+}
+
+// Notify 邮件没有输入状态，视为成功，避免先发一封“思考中”的占位邮件
+func (c *EmailContext) Notify(action core.ChatAction) error {
+	return nil
+}
+
+func (c *EmailContext) Member(userID string) (*core.Member, error) {
+	return nil, core.ErrNotSupported
+}
+
+func (c *EmailContext) Platform() string {
+	return "Email"
+}
+
+type EmailMessage struct {
+	id string
+}
+
+func (m *EmailMessage) ID() string {
+	return m.id
+}
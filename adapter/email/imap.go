@@ -0,0 +1,168 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapClient 只实现轮询收件箱所需的最小 IMAP4rev1 子集（隐式 TLS）：
+// LOGIN、SELECT、UID SEARCH、UID FETCH、UID STORE 和 LOGOUT
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapLine 一条服务器响应，literal（{n}）的内容单独保存
+type imapLine struct {
+	text     string
+	literals [][]byte
+}
+
+var literalRegex = regexp.MustCompile(`\{(\d+)\}$`)
+
+func dialIMAP(addr string, timeout time.Duration) (*imapClient, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, err
+	}
+	// 整个会话（登录、收取、标记）的期限
+	_ = conn.SetDeadline(time.Now().Add(5 * timeout))
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting: %s", greeting.text)
+	}
+	return c, nil
+}
+
+func (c *imapClient) Close() error {
+	return c.conn.Close()
+}
+
+// readLine 读取一条响应，遇到 literal 时读取其内容并继续读取该响应的剩余部分
+func (c *imapClient) readLine() (*imapLine, error) {
+	line := &imapLine{}
+	for {
+		s, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		s = strings.TrimRight(s, "\r\n")
+		line.text += s
+		m := literalRegex.FindStringSubmatch(s)
+		if m == nil {
+			return line, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return nil, err
+		}
+		line.literals = append(line.literals, literal)
+	}
+}
+
+// cmd 发送命令并读取响应直到带标签的结束行，返回未标记的响应
+func (c *imapClient) cmd(format string, args ...any) ([]*imapLine, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	if _, err := fmt.Fprintf(c.conn, tag+" "+format+"\r\n", args...); err != nil {
+		return nil, err
+	}
+	var untagged []*imapLine
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		status, ok := strings.CutPrefix(line.text, tag+" ")
+		if !ok {
+			untagged = append(untagged, line)
+			continue
+		}
+		if !strings.HasPrefix(status, "OK") {
+			return nil, fmt.Errorf("imap: %s", status)
+		}
+		return untagged, nil
+	}
+}
+
+// quote 将字符串编码为 IMAP quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *imapClient) Login(username, password string) error {
+	_, err := c.cmd("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+func (c *imapClient) Select(mailbox string) error {
+	_, err := c.cmd("SELECT %s", quote(mailbox))
+	return err
+}
+
+// SearchUnseen returns the UIDs of unread messages
+func (c *imapClient) SearchUnseen() ([]uint32, error) {
+	lines, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line.text, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			if uid, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Fetch returns the raw RFC 822 message without marking it as read
+func (c *imapClient) Fetch(uid uint32) ([]byte, error) {
+	lines, err := c.cmd("UID FETCH %d (BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if strings.Contains(line.text, "FETCH") && len(line.literals) > 0 {
+			return line.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("imap: message %d not found", uid)
+}
+
+func (c *imapClient) MarkSeen(uid uint32) error {
+	_, err := c.cmd(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) Logout() error {
+	_, err := c.cmd("LOGOUT")
+	return err
+}
@@ -0,0 +1,397 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// maxParts 单封邮件最多解析的 MIME 段数
+const maxParts = 50
+
+// incoming 一封解析后的邮件
+type incoming struct {
+	from        string // 小写的发件地址
+	name        string
+	subject     string
+	messageID   string
+	references  string
+	auto        bool     // 自动回复、退信、邮件列表等，不处理以免互相回复
+	authResults []string // Authentication-Results 头，从上到下
+	text        string
+	attachments []attachment
+}
+
+type attachment struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader 将 GBK、Big5 等编码转换为 UTF-8
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return r, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(r), nil
+}
+
+func parseMessage(raw []byte) (*incoming, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	header := textproto.MIMEHeader(m.Header)
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	from, err := parser.Parse(header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	subject, err := wordDecoder.DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		subject = header.Get("Subject")
+	}
+	msg := &incoming{
+		from:        strings.ToLower(from.Address),
+		name:        from.Name,
+		subject:     strings.TrimSpace(subject),
+		messageID:   strings.TrimSpace(header.Get("Message-ID")),
+		references:  strings.TrimSpace(header.Get("References")),
+		auto:        isAutomatic(header),
+		authResults: header.Values("Authentication-Results"),
+	}
+
+	var plain, html string
+	parts := 0
+	var walk func(h textproto.MIMEHeader, body io.Reader) error
+	walk = func(h textproto.MIMEHeader, body io.Reader) error {
+		if parts++; parts > maxParts {
+			return nil
+		}
+		mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+		if err != nil {
+			mediaType, params = "text/plain", nil
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				p, err := mr.NextRawPart()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := walk(p.Header, p); err != nil {
+					return err
+				}
+			}
+		}
+
+		data, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+		if err != nil {
+			// 跳过编码损坏的段
+			return nil
+		}
+		disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+		filename := dparams["filename"]
+		if filename == "" {
+			filename = params["name"]
+		}
+		if decoded, err := wordDecoder.DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+		if disposition != "attachment" && filename == "" && strings.HasPrefix(mediaType, "text/") {
+			text, err := decodeCharset(params["charset"], data)
+			if err != nil {
+				return err
+			}
+			if mediaType == "text/plain" && plain == "" {
+				plain = text
+			} else if mediaType == "text/html" && html == "" {
+				html = text
+			}
+			return nil
+		}
+		if filename == "" && !strings.HasPrefix(mediaType, "image/") {
+			return nil
+		}
+		name := filename
+		if name == "" {
+			name = "image" + extension(mediaType)
+		}
+		msg.attachments = append(msg.attachments, attachment{name: name, mimeType: mediaType, data: data})
+		return nil
+	}
+	if err := walk(header, m.Body); err != nil {
+		return nil, err
+	}
+
+	if plain == "" && html != "" {
+		plain = htmlToText(html)
+	}
+	msg.text = stripQuoted(plain)
+	return msg, nil
+}
+
+// authenticated 收件服务器 authservID 记录的 DMARC 校验通过，或 DKIM 签名域与发件域对齐时返回 true。
+// 只看该服务器的第一条记录：收件服务器添加的记录在最上面，发件人伪造的同名记录只能在它下面
+func authenticated(results []string, authservID, from string) bool {
+	_, domain, ok := strings.Cut(from, "@")
+	if !ok {
+		return false
+	}
+	for _, v := range results {
+		parts := strings.Split(stripComments(v), ";")
+		if id := strings.Fields(parts[0]); len(id) == 0 || !strings.EqualFold(id[0], authservID) {
+			continue
+		}
+		for _, res := range parts[1:] {
+			fields := strings.Fields(strings.ToLower(res))
+			if len(fields) == 0 {
+				continue
+			}
+			method, result, _ := strings.Cut(fields[0], "=")
+			if result != "pass" {
+				continue
+			}
+			props := make(map[string]string)
+			for _, f := range fields[1:] {
+				k, v, _ := strings.Cut(f, "=")
+				props[k] = strings.Trim(v, `"`)
+			}
+			switch {
+			case method == "dmarc" && aligned(props["header.from"], domain),
+				method == "dkim" && aligned(props["header.d"], domain):
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// aligned 签名域 d 与发件域相同，或是发件域的上级域（宽松对齐）
+func aligned(d, domain string) bool {
+	return d != "" && (domain == d || strings.HasSuffix(domain, "."+d))
+}
+
+// stripComments 去掉头部中括号内的注释，如 "dkim=pass (2048-bit key)"
+func stripComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isAutomatic 自动回复、退信和邮件列表的邮件
+func isAutomatic(h textproto.MIMEHeader) bool {
+	if v := strings.ToLower(h.Get("Auto-Submitted")); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "list", "junk", "auto_reply":
+		return true
+	}
+	return h.Get("List-Id") != "" || h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// newlineStripper 去掉 base64 内容中的换行
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
+
+func decodeCharset(charset string, data []byte) (string, error) {
+	r, err := charsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		// 未知编码按 UTF-8 处理
+		return string(data), nil
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+var (
+	htmlBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>`)
+	htmlTagRegex   = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+	htmlEntities   = strings.NewReplacer("&nbsp;", " ", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+)
+
+// htmlToText 没有纯文本正文时粗略地从 HTML 中提取文本
+func htmlToText(html string) string {
+	text := htmlBreakRegex.ReplaceAllString(html, "\n")
+	text = htmlTagRegex.ReplaceAllString(text, "")
+	return htmlEntities.Replace(text)
+}
+
+// quoteHeaderRegex 常见邮件客户端在引用原文前添加的行
+var quoteHeaderRegex = regexp.MustCompile(`^(On .+ wrote:|在 .+写道[:：]|-+ ?(Original Message|原始邮件) ?-+)\s*$`)
+
+// stripQuoted 去掉回复中引用的原文和签名
+func stripQuoted(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if line == "-- " || strings.HasPrefix(trimmed, ">") || quoteHeaderRegex.MatchString(trimmed) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func extension(mimeType string) string {
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// outgoing 一封待发送的邮件
+type outgoing struct {
+	to         string
+	subject    string
+	inReplyTo  string
+	references string
+	text       string
+	files      []*core.File
+}
+
+// compose 生成 RFC 5322 邮件，返回邮件内容和 Message-ID
+func compose(from string, out *outgoing) ([]byte, string) {
+	domain := "ggbot"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	messageID := "<" + hex.EncodeToString(id) + "@" + domain + ">"
+
+	var b bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	header("From", (&mail.Address{Name: "ggbot", Address: from}).String())
+	header("To", out.to)
+	header("Subject", mime.QEncoding.Encode("utf-8", out.subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	// Auto-Submitted 避免对方的自动回复再次触发机器人
+	if out.inReplyTo != "" {
+		header("In-Reply-To", out.inReplyTo)
+		header("References", strings.TrimSpace(out.references+" "+out.inReplyTo))
+		header("Auto-Submitted", "auto-replied")
+	} else {
+		header("Auto-Submitted", "auto-generated")
+	}
+	header("MIME-Version", "1.0")
+
+	if len(out.files) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		b.WriteString("\r\n")
+		writeBase64(&b, []byte(out.text))
+		return b.Bytes(), messageID
+	}
+
+	mw := multipart.NewWriter(&b)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	b.WriteString("\r\n")
+	w, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	writeBase64(w, []byte(out.text))
+	for _, file := range out.files {
+		mimeType := file.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		w, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(mimeType, map[string]string{"name": file.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": file.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64(w, file.Data)
+	}
+	mw.Close()
+	return b.Bytes(), messageID
+}
+
+// writeBase64 按 76 字符一行写入 base64 内容
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// replySubject 回复邮件的主题
+func replySubject(subject string) string {
+	if subject == "" {
+		return "Re: ggbot"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
@@ -0,0 +1,410 @@
+package onebot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// apiTimeout 等待协议端响应 API 调用的时间
+const apiTimeout = 15 * time.Second
+
+// errNotConnected 与协议端的连接断开时调用 API 返回的错误
+var errNotConnected = errors.New("onebot: not connected")
+
+// OneBotAdapter 通过 OneBot v11 正向 WebSocket 连接 NapCat、Lagrange 等协议端，让 ggbot 使用个人 QQ 号。
+// 事件和 API 调用共用一个连接，API 响应按 echo 匹配。
+type OneBotAdapter struct {
+	cfg    config.OneBotConfig
+	token  string
+	logger *slog.Logger
+	selfID atomic.Int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	echoSeq   atomic.Int64
+	pendingMu sync.Mutex
+	pending   map[string]chan *apiResponse
+
+	commandHandlers  map[string]core.Handler
+	callbackHandlers map[string]core.Handler
+	textHandler      core.Handler
+	photoHandler     core.Handler
+
+	// 按钮以编号列表发送，用户回复编号即视为点击
+	choiceMu sync.Mutex
+	choices  map[string]*pendingChoice
+}
+
+// pendingChoice 等待用户回复编号的按钮组
+type pendingChoice struct {
+	buttons []core.Button
+	expires time.Time
+}
+
+type apiRequest struct {
+	Action string `json:"action"`
+	Params any    `json:"params"`
+	Echo   string `json:"echo"`
+}
+
+type apiResponse struct {
+	Status  string          `json:"status"`
+	RetCode int             `json:"retcode"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+	Wording string          `json:"wording"`
+	Echo    json.RawMessage `json:"echo"`
+}
+
+func init() {
+	core.RegisterAdapterFactory("onebot", func(ac *core.AdapterConfig, logger *slog.Logger) (core.Platform, error) {
+		cfg := ac.Config.OneBot
+		if err := ac.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.URL == "" {
+			return nil, nil
+		}
+		return New(cfg, logger)
+	})
+}
+
+func New(cfg config.OneBotConfig, logger *slog.Logger) (*OneBotAdapter, error) {
+	if !strings.HasPrefix(cfg.URL, "ws://") && !strings.HasPrefix(cfg.URL, "wss://") {
+		return nil, fmt.Errorf("invalid onebot url %q, expected ws:// or wss://", cfg.URL)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	logger.Info("OneBot adapter initialized", "url", cfg.URL)
+	return &OneBotAdapter{
+		cfg:              cfg,
+		token:            cfg.AccessToken,
+		logger:           logger,
+		ctx:              ctx,
+		cancel:           cancel,
+		pending:          make(map[string]chan *apiResponse),
+		commandHandlers:  make(map[string]core.Handler),
+		callbackHandlers: make(map[string]core.Handler),
+		choices:          make(map[string]*pendingChoice),
+	}, nil
+}
+
+func (a *OneBotAdapter) Name() string {
+	return "OneBot"
+}
+
+func (a *OneBotAdapter) Start() error {
+	a.logger.Info("Starting OneBot")
+	go a.run()
+	return nil
+}
+
+func (a *OneBotAdapter) Stop() error {
+	a.cancel()
+	a.connMu.Lock()
+	defer a.connMu.Unlock()
+	if a.conn != nil {
+		return a.conn.Close()
+	}
+	return nil
+}
+
+// run 保持与协议端的连接，断开后按间隔重连
+func (a *OneBotAdapter) run() {
+	for {
+		if err := a.serve(); err != nil && a.ctx.Err() == nil {
+			a.logger.Error("OneBot connection lost", "error", err, "retry_in", a.cfg.ReconnectInterval)
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(a.cfg.ReconnectInterval):
+		}
+	}
+}
+
+func (a *OneBotAdapter) serve() error {
+	header := http.Header{}
+	if a.token != "" {
+		header.Set("Authorization", "Bearer "+a.token)
+	}
+	dialer := &websocket.Dialer{HandshakeTimeout: 15 * time.Second}
+	conn, resp, err := dialer.DialContext(a.ctx, a.cfg.URL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("websocket handshake failed (status %d): %w", resp.StatusCode, err)
+		}
+		return err
+	}
+	a.connMu.Lock()
+	a.conn = conn
+	a.connMu.Unlock()
+	a.logger.Info("OneBot connected", "url", a.cfg.URL)
+
+	defer func() {
+		a.connMu.Lock()
+		a.conn = nil
+		a.connMu.Unlock()
+		conn.Close()
+		a.failPending()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		a.handleFrame(data)
+	}
+}
+
+// handleFrame 区分 API 响应（带 echo）和事件
+func (a *OneBotAdapter) handleFrame(data []byte) {
+	var probe struct {
+		Echo     json.RawMessage `json:"echo"`
+		PostType string          `json:"post_type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		a.logger.Warn("Invalid OneBot frame", "error", err)
+		return
+	}
+	if probe.PostType == "" && len(probe.Echo) > 0 {
+		var resp apiResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			a.logger.Warn("Invalid OneBot response", "error", err)
+			return
+		}
+		var echo string
+		_ = json.Unmarshal(resp.Echo, &echo)
+		a.pendingMu.Lock()
+		ch, ok := a.pending[echo]
+		delete(a.pending, echo)
+		a.pendingMu.Unlock()
+		if ok {
+			ch <- &resp
+		}
+		return
+	}
+
+	switch probe.PostType {
+	case "message":
+		var ev messageEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			a.logger.Warn("Invalid OneBot message event", "error", err)
+			return
+		}
+		a.selfID.Store(ev.SelfID)
+		// 每条消息在独立的 goroutine 中处理，避免阻塞读取（处理器中可能调用 API 等待响应）
+		go func() {
+			if err := a.dispatch(&ev); err != nil {
+				a.logger.Error("OneBot handler error", "error", err, "request_id", core.ErrorRequestID(err))
+			}
+		}()
+	case "meta_event":
+		var ev struct {
+			SelfID        int64  `json:"self_id"`
+			MetaEventType string `json:"meta_event_type"`
+		}
+		if json.Unmarshal(data, &ev) == nil && ev.SelfID != 0 {
+			a.selfID.Store(ev.SelfID)
+		}
+	}
+}
+
+// failPending 连接断开时让等待中的 API 调用立即失败
+func (a *OneBotAdapter) failPending() {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+	for echo, ch := range a.pending {
+		close(ch)
+		delete(a.pending, echo)
+	}
+}
+
+// call 调用 OneBot API 并等待响应，out 为 nil 时忽略返回数据
+func (a *OneBotAdapter) call(action string, params any, out any) error {
+	a.connMu.Lock()
+	conn := a.conn
+	a.connMu.Unlock()
+	if conn == nil {
+		return errNotConnected
+	}
+
+	echo := strconv.FormatInt(a.echoSeq.Add(1), 10)
+	ch := make(chan *apiResponse, 1)
+	a.pendingMu.Lock()
+	a.pending[echo] = ch
+	a.pendingMu.Unlock()
+	defer func() {
+		a.pendingMu.Lock()
+		delete(a.pending, echo)
+		a.pendingMu.Unlock()
+	}()
+
+	a.writeMu.Lock()
+	err := conn.WriteJSON(apiRequest{Action: action, Params: params, Echo: echo})
+	a.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return errNotConnected
+		}
+		if resp.Status == "failed" || resp.RetCode != 0 {
+			msg := resp.Wording
+			if msg == "" {
+				msg = resp.Message
+			}
+			return fmt.Errorf("onebot %s failed (retcode %d): %s", action, resp.RetCode, msg)
+		}
+		if out != nil && len(resp.Data) > 0 {
+			return json.Unmarshal(resp.Data, out)
+		}
+		return nil
+	case <-time.After(apiTimeout):
+		return fmt.Errorf("onebot %s: timeout", action)
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	}
+}
+
+// sendMsg 发送消息段，groupID 不为 0 时发到群，否则私聊 userID
+func (a *OneBotAdapter) sendMsg(groupID, userID int64, message []segment) (int64, error) {
+	params := map[string]any{"message": message}
+	if groupID != 0 {
+		params["message_type"] = "group"
+		params["group_id"] = groupID
+	} else {
+		params["message_type"] = "private"
+		params["user_id"] = userID
+	}
+	var data struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := a.call("send_msg", params, &data); err != nil {
+		return 0, err
+	}
+	return data.MessageID, nil
+}
+
+func (a *OneBotAdapter) dispatch(ev *messageEvent) error {
+	ctx := a.newContext(ev)
+	if ctx == nil {
+		return nil
+	}
+
+	if button, ok := a.takeChoice(ctx, strings.TrimSpace(ctx.text)); ok {
+		if handler, ok := a.callbackHandlers[button.Name]; ok {
+			ctx.callbackData = button.Data
+			return handler(ctx)
+		}
+	}
+
+	if ctx.photo != nil && a.photoHandler != nil {
+		return a.photoHandler(ctx)
+	}
+
+	if strings.HasPrefix(ctx.text, "/") {
+		cmd, _, _ := strings.Cut(strings.Fields(ctx.text)[0], "@")
+		if handler, ok := a.commandHandlers[cmd]; ok {
+			return handler(ctx)
+		}
+	}
+
+	if a.textHandler != nil && ctx.text != "" {
+		return a.textHandler(ctx)
+	}
+	return nil
+}
+
+// choiceKey identifies the pending choice of a user in a chat
+func choiceKey(ctx *OneBotContext) string {
+	return ctx.Chat().ID + ":" + ctx.Sender().ID
+}
+
+// takeChoice resolves a numeric reply to a pending button group
+func (a *OneBotAdapter) takeChoice(ctx *OneBotContext, content string) (core.Button, bool) {
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return core.Button{}, false
+	}
+
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	key := choiceKey(ctx)
+	choice, ok := a.choices[key]
+	if !ok || time.Now().After(choice.expires) || n < 1 || n > len(choice.buttons) {
+		return core.Button{}, false
+	}
+	delete(a.choices, key)
+	return choice.buttons[n-1], true
+}
+
+func (a *OneBotAdapter) setChoice(ctx *OneBotContext, buttons []core.Button) {
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	now := time.Now()
+	for key, choice := range a.choices {
+		if now.After(choice.expires) {
+			delete(a.choices, key)
+		}
+	}
+	a.choices[choiceKey(ctx)] = &pendingChoice{buttons: buttons, expires: now.Add(10 * time.Minute)}
+}
+
+func (a *OneBotAdapter) RegisterCommand(cmd string, handler core.Handler) {
+	a.commandHandlers[cmd] = handler
+}
+
+func (a *OneBotAdapter) RegisterText(handler core.Handler) {
+	a.textHandler = handler
+}
+
+// RegisterDocument OneBot v11 的消息中没有文件，群文件上传是单独的通知事件，暂不支持
+func (a *OneBotAdapter) RegisterDocument(handler core.Handler) {}
+
+func (a *OneBotAdapter) RegisterPhoto(handler core.Handler) {
+	a.photoHandler = handler
+}
+
+func (a *OneBotAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.callbackHandlers[name] = handler
+}
+
+// SendTo sends a message to "group:群号" or a user ID ("private:QQ号" also works)
+func (a *OneBotAdapter) SendTo(recipient string, text string) error {
+	var groupID, userID int64
+	var err error
+	if id, ok := strings.CutPrefix(recipient, "group:"); ok {
+		groupID, err = strconv.ParseInt(id, 10, 64)
+	} else {
+		userID, err = strconv.ParseInt(strings.TrimPrefix(recipient, "private:"), 10, 64)
+	}
+	if err != nil {
+		return core.Permanent(fmt.Errorf("invalid onebot recipient: %s", recipient))
+	}
+	_, err = a.sendMsg(groupID, userID, textSegments(text, groupID != 0))
+	return err
+}
@@ -0,0 +1,378 @@
+package onebot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// downloadClient 下载图片使用的 HTTP 客户端，超时包括读取响应体
+var downloadClient = &http.Client{Timeout: 60 * time.Second}
+
+// maxDownloadSize 图片下载的上限，超出部分被截断，由调用方判断是否过大
+const maxDownloadSize = 50 << 20
+
+// segment OneBot v11 消息段
+type segment struct {
+	Type string      `json:"type"`
+	Data segmentData `json:"data"`
+}
+
+// segmentData 消息段参数，部分协议端把数字参数（如 qq、file_size）上报为数字
+type segmentData map[string]string
+
+func (d *segmentData) UnmarshalJSON(b []byte) error {
+	var raw map[string]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*d = make(segmentData, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			(*d)[k] = v
+		case float64:
+			(*d)[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			(*d)[k] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// messageEvent 私聊和群消息事件
+type messageEvent struct {
+	SelfID      int64           `json:"self_id"`
+	MessageType string          `json:"message_type"` // "private" 或 "group"
+	SubType     string          `json:"sub_type"`
+	MessageID   int64           `json:"message_id"`
+	UserID      int64           `json:"user_id"`
+	GroupID     int64           `json:"group_id"`
+	Message     json.RawMessage `json:"message"`
+	RawMessage  string          `json:"raw_message"`
+	Sender      struct {
+		UserID   int64  `json:"user_id"`
+		Nickname string `json:"nickname"`
+		Card     string `json:"card"`
+		Role     string `json:"role"`
+	} `json:"sender"`
+}
+
+// segments 解析消息，协议端可能按数组或 CQ 码字符串上报
+func (ev *messageEvent) segments() []segment {
+	var segs []segment
+	if err := json.Unmarshal(ev.Message, &segs); err == nil {
+		return segs
+	}
+	var s string
+	if err := json.Unmarshal(ev.Message, &s); err != nil {
+		s = ev.RawMessage
+	}
+	return parseCQ(s)
+}
+
+var cqRegex = regexp.MustCompile(`\[CQ:([a-zA-Z_]+)((?:,[^\]]*)?)\]`)
+
+// parseCQ 将 CQ 码字符串解析为消息段
+func parseCQ(s string) []segment {
+	unescape := strings.NewReplacer("&#91;", "[", "&#93;", "]", "&#44;", ",", "&amp;", "&")
+	var segs []segment
+	last := 0
+	for _, m := range cqRegex.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] > last {
+			segs = append(segs, segment{Type: "text", Data: segmentData{"text": unescape.Replace(s[last:m[0]])}})
+		}
+		seg := segment{Type: s[m[2]:m[3]], Data: make(segmentData)}
+		for _, kv := range strings.Split(strings.TrimPrefix(s[m[4]:m[5]], ","), ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				seg.Data[k] = unescape.Replace(v)
+			}
+		}
+		segs = append(segs, seg)
+		last = m[1]
+	}
+	if last < len(s) {
+		segs = append(segs, segment{Type: "text", Data: segmentData{"text": unescape.Replace(s[last:])}})
+	}
+	return segs
+}
+
+// textSegments 将发送的文本转换为消息段，群聊中 core.Mention 转为 at 段
+func textSegments(text string, group bool) []segment {
+	var segs []segment
+	rendered := core.RenderMentions(text, func(userID, name string) string {
+		if !group {
+			return core.MentionName(userID, name)
+		}
+		return "\x00" + userID + "\x00"
+	})
+	for i, part := range strings.Split(rendered, "\x00") {
+		if i%2 == 1 {
+			segs = append(segs, segment{Type: "at", Data: segmentData{"qq": part}})
+		} else if part != "" {
+			segs = append(segs, segment{Type: "text", Data: segmentData{"text": part}})
+		}
+	}
+	return segs
+}
+
+// newContext 解析消息事件，群聊中默认只处理 @机器人、回复机器人的消息和指令，其余返回 nil
+func (a *OneBotAdapter) newContext(ev *messageEvent) *OneBotContext {
+	selfID := strconv.FormatInt(ev.SelfID, 10)
+	ctx := &OneBotContext{adapter: a, event: ev}
+
+	var text strings.Builder
+	mentioned := false
+	for _, seg := range ev.segments() {
+		switch seg.Type {
+		case "text":
+			text.WriteString(seg.Data["text"])
+		case "at":
+			if seg.Data["qq"] == selfID {
+				mentioned = true
+			} else {
+				text.WriteString("@" + seg.Data["qq"])
+			}
+		case "reply":
+			ctx.replyTo = seg.Data["id"]
+		case "image":
+			if ctx.photo == nil && seg.Data["url"] != "" {
+				name := seg.Data["file"]
+				if name == "" {
+					name = "image.jpg"
+				}
+				size, _ := strconv.ParseInt(seg.Data["file_size"], 10, 64)
+				ctx.photo = &core.Document{ID: seg.Data["url"], Name: name, MIMEType: "image/jpeg", Size: size}
+			}
+		}
+	}
+	ctx.text = strings.TrimSpace(text.String())
+
+	ctx.addressed = ev.MessageType != "group" || mentioned || (ctx.replyTo != "" && a.repliesToSelf(ctx.replyTo))
+	if !a.cfg.GroupAll && !ctx.addressed && !strings.HasPrefix(ctx.text, "/") {
+		return nil
+	}
+	return ctx
+}
+
+// repliesToSelf 被回复的消息是否由机器人发送
+func (a *OneBotAdapter) repliesToSelf(messageID string) bool {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return false
+	}
+	var msg struct {
+		Sender struct {
+			UserID int64 `json:"user_id"`
+		} `json:"sender"`
+	}
+	if err := a.call("get_msg", map[string]any{"message_id": id}, &msg); err != nil {
+		return false
+	}
+	return msg.Sender.UserID == a.selfID.Load()
+}
+
+// OneBotContext 一条私聊或群消息
+type OneBotContext struct {
+	adapter      *OneBotAdapter
+	event        *messageEvent
+	text         string
+	replyTo      string
+	photo        *core.Document
+	callbackData string
+	addressed    bool // 私聊，或群消息 @ 了机器人、回复了机器人的消息
+}
+
+// Addressed reports whether the message @-mentions or replies to the bot, see core.IsAddressed
+func (c *OneBotContext) Addressed() bool {
+	return c.addressed
+}
+
+func (c *OneBotContext) Sender() *core.User {
+	name := c.event.Sender.Card
+	if name == "" {
+		name = c.event.Sender.Nickname
+	}
+	return &core.User{ID: strconv.FormatInt(c.event.UserID, 10), Username: name}
+}
+
+// Chat 群聊的 ID 为 "group:群号"，与 SendTo 的格式一致；私聊为对方 QQ 号
+func (c *OneBotContext) Chat() *core.Chat {
+	if c.event.MessageType == "group" {
+		return &core.Chat{ID: "group:" + strconv.FormatInt(c.event.GroupID, 10), Type: "group"}
+	}
+	return &core.Chat{ID: strconv.FormatInt(c.event.UserID, 10), Type: "private"}
+}
+
+func (c *OneBotContext) Text() string {
+	return c.text
+}
+
+func (c *OneBotContext) Data() string {
+	return c.callbackData
+}
+
+func (c *OneBotContext) Document() *core.Document {
+	return nil
+}
+
+func (c *OneBotContext) Photo() *core.Document {
+	return c.photo
+}
+
+func (c *OneBotContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	resp, err := downloadClient.Get(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxDownloadSize), resp.Body}, nil
+}
+
+func (c *OneBotContext) Reply(text string) error {
+	_, err := c.Send(text)
+	return err
+}
+
+func (c *OneBotContext) Send(text string) (core.Message, error) {
+	return c.send(textSegments(text, c.event.MessageType == "group"))
+}
+
+func (c *OneBotContext) send(segs []segment) (core.Message, error) {
+	var groupID int64
+	if c.event.MessageType == "group" {
+		groupID = c.event.GroupID
+	}
+	id, err := c.adapter.sendMsg(groupID, c.event.UserID, segs)
+	if err != nil {
+		return nil, err
+	}
+	return &OneBotMessage{id: id}, nil
+}
+
+// Edit QQ 不支持编辑消息，发送一条新消息
+// NoEdit OneBot 不能编辑消息，Edit 发送新消息
+func (c *OneBotContext) NoEdit() {}
+
+func (c *OneBotContext) Edit(msg core.Message, text string) error {
+	_, err := c.Send(text)
+	return err
+}
+
+// Delete 撤回消息，个人号只能撤回 2 分钟内自己发送的消息（群管理员可撤回群成员消息）
+func (c *OneBotContext) Delete(msg core.Message) error {
+	m, ok := msg.(*OneBotMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type for onebot")
+	}
+	return c.adapter.call("delete_msg", map[string]any{"message_id": m.id}, nil)
+}
+
+// SendFile 图片以 base64 图片段发送；其他文件使用 NapCat/Lagrange 扩展的 file 段，标准 OneBot v11 协议端不支持
+func (c *OneBotContext) SendFile(file *core.File) error {
+	seg := segment{Type: "file", Data: segmentData{"name": file.Name}}
+	if file.IsImage() {
+		seg = segment{Type: "image", Data: segmentData{}}
+	}
+	seg.Data["file"] = "base64://" + base64.StdEncoding.EncodeToString(file.Data)
+	segs := []segment{seg}
+	if file.Caption != "" && file.IsImage() {
+		segs = append(segs, segment{Type: "text", Data: segmentData{"text": "\n" + file.Caption}})
+	}
+	if _, err := c.send(segs); err != nil {
+		return err
+	}
+	if file.Caption != "" && !file.IsImage() {
+		return c.Reply(file.Caption)
+	}
+	return nil
+}
+
+// SendButtons 以编号列表发送按钮，用户回复编号即触发对应回调
+func (c *OneBotContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	var buttons []core.Button
+	var b strings.Builder
+	b.WriteString(text)
+	for _, row := range rows {
+		for _, button := range row {
+			buttons = append(buttons, button)
+			fmt.Fprintf(&b, "\n%d. %s", len(buttons), button.Text)
+		}
+	}
+	b.WriteString("\n\n回复编号选择")
+	msg, err := c.Send(b.String())
+	if err != nil {
+		return nil, err
+	}
+	c.adapter.setChoice(c, buttons)
+	return msg, nil
+}
+
+func (c *OneBotContext) React(emoji string) error {
+	return core.ErrNotSupported
+}
+
+func (c *OneBotContext) Notify(action core.ChatAction) error {
+	return core.ErrNotSupported
+}
+
+// Member 查询群成员，私聊返回 ErrNotSupported
+func (c *OneBotContext) Member(userID string) (*core.Member, error) {
+	if c.event.MessageType != "group" {
+		return nil, core.ErrNotSupported
+	}
+	uid, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		UserID   int64  `json:"user_id"`
+		Nickname string `json:"nickname"`
+		Card     string `json:"card"`
+		Role     string `json:"role"` // owner, admin, member
+		JoinTime int64  `json:"join_time"`
+	}
+	err = c.adapter.call("get_group_member_info", map[string]any{"group_id": c.event.GroupID, "user_id": uid}, &info)
+	if err != nil {
+		return nil, err
+	}
+	member := &core.Member{
+		User:     core.User{ID: userID, Username: info.Nickname},
+		Nickname: info.Card,
+		Roles:    []string{info.Role},
+	}
+	if member.Nickname == "" {
+		member.Nickname = info.Nickname
+	}
+	if info.JoinTime > 0 {
+		member.JoinedAt = time.Unix(info.JoinTime, 0)
+	}
+	return member, nil
+}
+
+func (c *OneBotContext) Platform() string {
+	return "OneBot"
+}
+
+type OneBotMessage struct {
+	id int64
+}
+
+func (m *OneBotMessage) ID() string {
+	return strconv.FormatInt(m.id, 10)
+}
@@ -2,11 +2,17 @@ package qq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/lhpqaq/ggbot/config"
 	"github.com/lhpqaq/ggbot/core"
@@ -37,8 +43,49 @@ type QQAdapter struct {
 	credentials *token.QQBotCredentials
 	tokenSource oauth2.TokenSource
 
-	commandHandlers map[string]core.Handler
-	textHandler     core.Handler
+	commandHandlers  map[string]core.Handler
+	callbackHandlers map[string]core.Handler
+	textHandler      core.Handler
+	documentHandler  core.Handler
+	photoHandler     core.Handler
+
+	// 未开通按钮能力时，按钮以编号列表发送，用户回复编号即视为点击
+	pendingMu      sync.Mutex
+	pendingButtons map[string]*pendingChoice
+
+	message config.QQMessageConfig // 消息格式
+	replies *replyTracker          // 按 msg_id 分配回复序号
+	loop    *core.Supervisor
+}
+
+// pendingChoice 等待用户回复编号的按钮组
+type pendingChoice struct {
+	buttons []core.Button
+	expires time.Time
+}
+
+// inUse botgo 的事件处理器是全局注册的，一个进程只能有一个 QQ 机器人
+var inUse bool
+
+func init() {
+	core.RegisterAdapterFactory("qq", func(ac *core.AdapterConfig, logger *slog.Logger) (core.Platform, error) {
+		cfg := ac.Config.Bot
+		if err := ac.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.QQAppID == "" {
+			return nil, nil
+		}
+		if inUse {
+			return nil, fmt.Errorf("QQ is already used by another tenant, only one QQ bot per process is supported")
+		}
+		a, err := New(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		inUse = true
+		return a, nil
+	})
 }
 
 func New(cfg config.BotConfig, logger *slog.Logger) (*QQAdapter, error) {
@@ -57,11 +104,16 @@ func New(cfg config.BotConfig, logger *slog.Logger) (*QQAdapter, error) {
 
 	logger.Info("QQ adapter initialized without proxy")
 	return &QQAdapter{
-		api:             api,
-		logger:          logger,
-		credentials:     creds,
-		tokenSource:     ts,
-		commandHandlers: make(map[string]core.Handler),
+		api:              api,
+		logger:           logger,
+		credentials:      creds,
+		tokenSource:      ts,
+		commandHandlers:  make(map[string]core.Handler),
+		callbackHandlers: make(map[string]core.Handler),
+		pendingButtons:   make(map[string]*pendingChoice),
+		message:          cfg.QQMessage,
+		replies:          newReplyTracker(),
+		loop:             &core.Supervisor{Platform: "QQ", Logger: logger},
 	}, nil
 }
 
@@ -73,7 +125,7 @@ func (a *QQAdapter) Start() error {
 	a.logger.Info("Starting QQ Bot...")
 
 	// Register Handlers for Guild, Group, and C2C
-	intent := event.RegisterHandlers(
+	handlers := []interface{}{
 		// Guild Handlers
 		a.GuildATMessageEventHandler(),
 		a.DirectMessageEventHandler(),
@@ -81,7 +133,12 @@ func (a *QQAdapter) Start() error {
 		a.GroupATMessageEventHandler(),
 		// C2C Handler
 		a.C2CMessageEventHandler(),
-	)
+	}
+	// 互动事件需要开通消息按钮权限，未启用按钮时不订阅
+	if a.message.Buttons {
+		handlers = append(handlers, a.InteractionEventHandler())
+	}
+	intent := event.RegisterHandlers(handlers...)
 
 	// Get WS Info
 	ws, err := a.api.WS(context.Background(), nil, "")
@@ -89,20 +146,36 @@ func (a *QQAdapter) Start() error {
 		return err
 	}
 
-	go func() {
-		mgr := botgo.NewSessionManager()
-		if err := mgr.Start(ws, a.tokenSource, &intent); err != nil {
-			a.logger.Error("QQ Bot stopped", "error", err)
+	// 会话管理器退出时重新获取接入点再启动，首次使用上面已获取的接入点
+	a.loop.Run(func(<-chan struct{}) error {
+		if ws == nil {
+			var err error
+			if ws, err = a.api.WS(context.Background(), nil, ""); err != nil {
+				return fmt.Errorf("get websocket info: %w", err)
+			}
 		}
-	}()
+		info := ws
+		ws = nil
+		if err := botgo.NewSessionManager().Start(info, a.tokenSource, &intent); err != nil {
+			return err
+		}
+		return errors.New("session manager exited")
+	})
 
 	return nil
 }
 
+// Stop 停止重启会话，botgo 的会话管理器不支持主动关闭，连接在进程退出时断开
 func (a *QQAdapter) Stop() error {
+	a.loop.Stop()
 	return nil
 }
 
+// OnLoopEvent 会话管理器退出重启、恢复时通知
+func (a *QQAdapter) OnLoopEvent(f func(core.LoopEvent)) {
+	a.loop.OnLoopEvent(f)
+}
+
 func (a *QQAdapter) RegisterCommand(cmd string, handler core.Handler) {
 	a.commandHandlers[cmd] = handler
 }
@@ -111,14 +184,24 @@ func (a *QQAdapter) RegisterText(handler core.Handler) {
 	a.textHandler = handler
 }
 
+func (a *QQAdapter) RegisterDocument(handler core.Handler) {
+	a.documentHandler = handler
+}
+
+func (a *QQAdapter) RegisterPhoto(handler core.Handler) {
+	a.photoHandler = handler
+}
+
+func (a *QQAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.callbackHandlers[name] = handler
+}
+
 func (a *QQAdapter) SendTo(recipient string, text string) error {
-	a.logger.Warn("QQ 群不支持主动推送消息，跳过", "target", recipient)
-	return fmt.Errorf("QQ 群不支持主动推送消息")
 	// Expected format: "Group:ID" or "User:ID" or just "ID" (defaults to ?)
 	// Let's require explicit prefix.
 	parts := strings.SplitN(recipient, ":", 2)
 	if len(parts) != 2 {
-		return fmt.Errorf("invalid qq recipient format, expected 'Group:ID' or 'User:ID', got: %s", recipient)
+		return core.Permanent(fmt.Errorf("invalid qq recipient format, expected 'Group:ID' or 'User:ID', got: %s", recipient))
 	}
 
 	targetType := strings.ToLower(parts[0])
@@ -127,31 +210,31 @@ func (a *QQAdapter) SendTo(recipient string, text string) error {
 	// QQ 群不允许主动推送消息，只能被动回复
 	if targetType == "group" {
 		a.logger.Warn("QQ 群不支持主动推送消息，跳过", "target", recipient)
-		return fmt.Errorf("QQ 群不支持主动推送消息")
+		return core.Permanent(fmt.Errorf("QQ 群不支持主动推送消息"))
 	}
 
-	// 过滤 URL（QQ 不允许发送 URL）
-	filteredText := removeURLs(text)
-
-	msgToPost := &dto.MessageToCreate{
-		Content: filteredText,
-		MsgType: 0,
-		MsgSeq:  1, // Start seq
+	if targetType != "user" && targetType != "c2c" {
+		return core.Permanent(fmt.Errorf("unknown qq target type: %s", targetType))
 	}
 
-	var err error
-	switch targetType {
-	case "group":
-		_, err = a.api.PostGroupMessage(context.Background(), targetID, msgToPost)
-	case "user", "c2c":
-		_, err = a.api.PostC2CMessage(context.Background(), targetID, msgToPost)
-	default:
-		return fmt.Errorf("unknown qq target type: %s", targetType)
+	post := func(msg *dto.MessageToCreate) (*dto.Message, error) {
+		msg.MsgSeq = 1 // Start seq
+		return a.api.PostC2CMessage(context.Background(), targetID, msg)
 	}
-
+	_, err := a.post(text, a.message.PushFormat, TypeC2C, post)
 	return err
 }
 
+// post 按格式发送消息，富文本发送失败时退回纯文本
+func (a *QQAdapter) post(text, format string, ctxType ContextType, post func(*dto.MessageToCreate) (*dto.Message, error)) (*dto.Message, error) {
+	msg, err := post(newMessage(text, format, ctxType, a.message))
+	if err != nil && format != "text" {
+		a.logger.Warn("QQ rich message failed, sending as text", "format", format, "error", err)
+		msg, err = post(newMessage(text, "text", ctxType, a.message))
+	}
+	return msg, err
+}
+
 // --- Handlers ---
 
 // Guild @Bot
@@ -162,10 +245,14 @@ func (a *QQAdapter) GuildATMessageEventHandler() event.ATMessageEventHandler {
 			api:       a.api,
 			content:   content,
 			ctxType:   TypeGuild,
+			guildID:   data.GuildID,
 			channelID: data.ChannelID,
 			author:    data.Author,
 			msgID:     data.ID,
-			msgSeq:    1, // Default seq
+			replies:   a.replies,
+			received:  time.Now(),
+			document:  firstDocument(data.Attachments),
+			photo:     firstImage(data.Attachments),
 		}
 		return a.dispatch(ctx, content)
 	}
@@ -183,7 +270,10 @@ func (a *QQAdapter) DirectMessageEventHandler() event.DirectMessageEventHandler
 			channelID: data.ChannelID,
 			author:    data.Author,
 			msgID:     data.ID,
-			msgSeq:    1,
+			replies:   a.replies,
+			received:  time.Now(),
+			document:  firstDocument(data.Attachments),
+			photo:     firstImage(data.Attachments),
 		}
 		return a.dispatch(ctx, content)
 	}
@@ -194,13 +284,16 @@ func (a *QQAdapter) GroupATMessageEventHandler() event.GroupATMessageEventHandle
 	return func(event *dto.WSPayload, data *dto.WSGroupATMessageData) error {
 		content := strings.TrimSpace(message.ETLInput(data.Content))
 		ctx := &QQContext{
-			api:     a.api,
-			content: content,
-			ctxType: TypeGroup,
-			groupID: data.GroupID,
-			author:  data.Author,
-			msgID:   data.ID,
-			msgSeq:  1, // Reset or manage internally
+			api:      a.api,
+			content:  content,
+			ctxType:  TypeGroup,
+			groupID:  data.GroupID,
+			author:   data.Author,
+			msgID:    data.ID,
+			replies:  a.replies,
+			received: time.Now(),
+			document: firstDocument(data.Attachments),
+			photo:    firstImage(data.Attachments),
 		}
 		return a.dispatch(ctx, content)
 	}
@@ -217,13 +310,42 @@ func (a *QQAdapter) C2CMessageEventHandler() event.C2CMessageEventHandler {
 			senderID: data.Author.ID, // OpenID
 			author:   data.Author,
 			msgID:    data.ID,
-			msgSeq:   1,
+			replies:  a.replies,
+			received: time.Now(),
+			document: firstDocument(data.Attachments),
+			photo:    firstImage(data.Attachments),
 		}
 		return a.dispatch(ctx, content)
 	}
 }
 
+// dispatch 把消息交给对应的处理器，处理器返回的错误带上请求 ID 记录日志
 func (a *QQAdapter) dispatch(ctx *QQContext, content string) error {
+	err := a.route(ctx, content)
+	if err != nil {
+		a.logger.Error("QQ handler error", "error", err, "request_id", core.ErrorRequestID(err))
+	}
+	return err
+}
+
+func (a *QQAdapter) route(ctx *QQContext, content string) error {
+	ctx.adapter = a
+
+	if button, ok := a.takeChoice(ctx, content); ok {
+		if handler, ok := a.callbackHandlers[button.Name]; ok {
+			ctx.callbackData = button.Data
+			return handler(ctx)
+		}
+	}
+
+	if ctx.document != nil && a.documentHandler != nil {
+		return a.documentHandler(ctx)
+	}
+
+	if ctx.photo != nil && a.photoHandler != nil {
+		return a.photoHandler(ctx)
+	}
+
 	if strings.HasPrefix(content, "/") {
 		parts := strings.Fields(content)
 		cmd := parts[0]
@@ -239,6 +361,86 @@ func (a *QQAdapter) dispatch(ctx *QQContext, content string) error {
 	return nil
 }
 
+// choiceKey identifies the pending choice of a user in a chat
+func choiceKey(ctx *QQContext) string {
+	return ctx.Chat().ID + ":" + ctx.Sender().ID
+}
+
+// takeChoice resolves a numeric reply to a pending button group
+func (a *QQAdapter) takeChoice(ctx *QQContext, content string) (core.Button, bool) {
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return core.Button{}, false
+	}
+
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	key := choiceKey(ctx)
+	choice, ok := a.pendingButtons[key]
+	if !ok || time.Now().After(choice.expires) || n < 1 || n > len(choice.buttons) {
+		return core.Button{}, false
+	}
+	delete(a.pendingButtons, key)
+	return choice.buttons[n-1], true
+}
+
+func (a *QQAdapter) setChoice(ctx *QQContext, buttons []core.Button) {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	now := time.Now()
+	for key, choice := range a.pendingButtons {
+		if now.After(choice.expires) {
+			delete(a.pendingButtons, key)
+		}
+	}
+	a.pendingButtons[choiceKey(ctx)] = &pendingChoice{
+		buttons: buttons,
+		expires: now.Add(10 * time.Minute),
+	}
+}
+
+// firstDocument returns the first non-media attachment as a document
+func firstDocument(attachments []*dto.MessageAttachment) *core.Document {
+	for _, att := range attachments {
+		if att == nil || att.URL == "" {
+			continue
+		}
+		// 图片、语音、视频不作为文件处理
+		if strings.HasPrefix(att.ContentType, "image/") ||
+			strings.HasPrefix(att.ContentType, "video/") ||
+			att.ContentType == "voice" {
+			continue
+		}
+		return attachmentDocument(att)
+	}
+	return nil
+}
+
+// firstImage returns the first image attachment
+func firstImage(attachments []*dto.MessageAttachment) *core.Document {
+	for _, att := range attachments {
+		if att != nil && att.URL != "" && strings.HasPrefix(att.ContentType, "image/") {
+			return attachmentDocument(att)
+		}
+	}
+	return nil
+}
+
+func attachmentDocument(att *dto.MessageAttachment) *core.Document {
+	url := att.URL
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "https://" + url
+	}
+	return &core.Document{
+		ID:       url,
+		Name:     att.FileName,
+		MIMEType: att.ContentType,
+		Size:     int64(att.Size),
+	}
+}
+
 // --- QQContext ---
 
 type ContextType int
@@ -252,9 +454,13 @@ const (
 
 type QQContext struct {
 	api     openapi.OpenAPI
+	adapter *QQAdapter
 	content string
 	ctxType ContextType
 
+	// 按钮回调数据
+	callbackData string
+
 	// Guild
 	guildID   string
 	channelID string
@@ -264,9 +470,16 @@ type QQContext struct {
 	senderID string // User OpenID for C2C
 
 	// Common
-	author *dto.User
-	msgID  string
-	msgSeq int
+	author   *dto.User
+	msgID    string
+	eventID  string        // 按钮点击等事件的 ID，没有 msgID 时用它被动回复
+	received time.Time     // 收到消息的时间，被动回复窗口从此开始
+	replies  *replyTracker // 回复序号由适配器按 msg_id 统一分配
+	document *core.Document
+	photo    *core.Document
+
+	// 上次发送输入状态的时间，避免频繁刷新占用消息序号
+	lastNotify time.Time
 }
 
 func (c *QQContext) Sender() *core.User {
@@ -280,65 +493,202 @@ func (c *QQContext) Sender() *core.User {
 	}
 }
 
+func (c *QQContext) Chat() *core.Chat {
+	switch c.ctxType {
+	case TypeGuild:
+		return &core.Chat{ID: c.channelID, Type: "channel"}
+	case TypeGuildDirect:
+		return &core.Chat{ID: c.guildID, Type: "private"}
+	case TypeGroup:
+		return &core.Chat{ID: c.groupID, Type: "group"}
+	default:
+		return &core.Chat{ID: c.senderID, Type: "private"}
+	}
+}
+
 func (c *QQContext) Text() string {
 	return c.content
 }
 
+func (c *QQContext) Data() string {
+	return c.callbackData
+}
+
+func (c *QQContext) Document() *core.Document {
+	return c.document
+}
+
+func (c *QQContext) Photo() *core.Document {
+	return c.photo
+}
+
+func (c *QQContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	resp, err := downloadClient.Get(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxDownloadSize), resp.Body}, nil
+}
+
 func (c *QQContext) Reply(text string) error {
 	_, err := c.Send(text)
 	return err
 }
 
 func (c *QQContext) Send(text string) (core.Message, error) {
-	// 过滤 URL（QQ 不允许发送 URL）
-	filteredText := removeURLs(text)
-
-	slog.Info("QQ Sending Message", "type", c.ctxType, "id", c.msgID, "seq", c.msgSeq+1)
-
 	var msg *dto.Message
 	var err error
+	if c.adapter != nil {
+		msg, err = c.adapter.post(text, c.adapter.message.Format, c.ctxType, c.reply)
+	} else {
+		msg, err = c.reply(newMessage(text, "text", c.ctxType, config.QQMessageConfig{}))
+	}
 
-	// Basic MessageToCreate
-	msgToPost := &dto.MessageToCreate{
-		Content: filteredText,
-		MsgID:   c.msgID,
-		MsgType: 0, // Text
-		MsgSeq:  uint32(c.msgSeq + 1),
+	if err != nil {
+		slog.Error("QQ Send Failed", "error", err)
+		return nil, err
+	}
+
+	// Return wrapper. If msg is nil (some APIs return nil on success?), handle it.
+	if msg == nil {
+		msg = &dto.Message{ID: "unknown"}
+	}
+
+	return &QQMessage{msg: msg, api: c.api}, nil
+}
+
+// reply 发送消息，被动回复窗口内引用收到的消息或事件
+func (c *QQContext) reply(msgToPost *dto.MessageToCreate) (*dto.Message, error) {
+	passive := c.replyTo(msgToPost)
+	slog.Info("QQ Sending Message", "type", c.ctxType, "id", c.replyID(), "passive", passive, "seq", msgToPost.MsgSeq)
+	msg, err := c.postMessage(msgToPost)
+	if err != nil && !passive && c.replyID() != "" {
+		err = c.activeError(err)
 	}
+	return msg, err
+}
 
+// postMessage 按会话类型发送消息
+func (c *QQContext) postMessage(msgToPost *dto.MessageToCreate) (*dto.Message, error) {
 	switch c.ctxType {
 	case TypeGuild:
-		msg, err = c.api.PostMessage(context.Background(), c.channelID, msgToPost)
+		return c.api.PostMessage(context.Background(), c.channelID, msgToPost)
 	case TypeGuildDirect:
 		dm := &dto.DirectMessage{
 			GuildID:   c.guildID,
 			ChannelID: c.channelID,
 		}
-		msg, err = c.api.PostDirectMessage(context.Background(), dm, msgToPost)
+		return c.api.PostDirectMessage(context.Background(), dm, msgToPost)
 	case TypeGroup:
 		// Group Reply
-		msg, err = c.api.PostGroupMessage(context.Background(), c.groupID, msgToPost)
+		return c.api.PostGroupMessage(context.Background(), c.groupID, msgToPost)
 	case TypeC2C:
 		// C2C Reply
-		msg, err = c.api.PostC2CMessage(context.Background(), c.senderID, msgToPost)
+		return c.api.PostC2CMessage(context.Background(), c.senderID, msgToPost)
 	}
+	return nil, nil
+}
+
+// SendButtons 开启 qq_message.buttons 时以消息按钮发送，点击触发对应回调；
+// 未开启或发送失败时以编号列表发送，用户回复编号即触发对应回调
+func (c *QQContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	if c.adapter != nil && c.adapter.message.Buttons {
+		msg, err := c.sendKeyboard(text, rows)
+		if err == nil {
+			if msg == nil {
+				msg = &dto.Message{ID: "unknown"}
+			}
+			return &QQMessage{msg: msg, api: c.api}, nil
+		}
+		c.logger().Warn("QQ keyboard message failed, sending as list", "error", err)
+	}
+
+	var buttons []core.Button
+	var b strings.Builder
+	b.WriteString(text)
+	b.WriteString("\n")
+	for _, row := range rows {
+		for _, button := range row {
+			buttons = append(buttons, button)
+			b.WriteString(fmt.Sprintf("\n%d. %s", len(buttons), button.Text))
+		}
+	}
+	b.WriteString("\n\n请回复编号进行选择")
 
+	msg, err := c.Send(b.String())
 	if err != nil {
-		slog.Error("QQ Send Failed", "error", err)
 		return nil, err
 	}
+	if c.adapter != nil {
+		c.adapter.setChoice(c, buttons)
+	}
+	return msg, nil
+}
+
+// React 表情表态，QQ 只支持对频道消息表态
+func (c *QQContext) React(emoji string) error {
+	if c.ctxType != TypeGuild {
+		return core.ErrNotSupported
+	}
+	r, _ := utf8.DecodeRuneInString(emoji)
+	if r == utf8.RuneError {
+		return fmt.Errorf("invalid emoji: %q", emoji)
+	}
+	// type 2 为 emoji 表情，id 为 Unicode 码点的十进制表示
+	return c.api.CreateMessageReaction(context.Background(), c.channelID, c.msgID, dto.Emoji{
+		ID:   strconv.Itoa(int(r)),
+		Type: 2,
+	})
+}
 
-	// Increment seq for next message in this context (e.g. edit/reply)
-	c.msgSeq++
+// inputNotifySeconds QQ 输入状态的持续时间
+const inputNotifySeconds = 60
 
-	// Return wrapper. If msg is nil (some APIs return nil on success?), handle it.
-	if msg == nil {
-		msg = &dto.Message{ID: "unknown"}
+// Notify 显示"对方正在输入..."，QQ 只支持单聊
+func (c *QQContext) Notify(action core.ChatAction) error {
+	if c.ctxType != TypeC2C || action != core.ActionTyping {
+		return core.ErrNotSupported
+	}
+	// 输入状态会持续 60 秒，期间无需重复发送
+	if time.Since(c.lastNotify) < (inputNotifySeconds-10)*time.Second {
+		return nil
 	}
 
-	return &QQMessage{msg: msg, api: c.api}, nil
+	// 输入状态也需要 msg_id，被动回复窗口关闭后不再发送；它占用序号但不计入回复次数
+	if c.msgID == "" {
+		return nil
+	}
+	seq, ok, _ := c.replies.next(c.msgID, c.ctxType, c.received, false)
+	if !ok {
+		return nil
+	}
+
+	msgToPost := &dto.MessageToCreate{
+		MsgType: dto.InputNotifyMsg,
+		MsgID:   c.msgID,
+		MsgSeq:  seq,
+		InputNotify: &dto.InputNotify{
+			InputType:   1,
+			InputSecond: inputNotifySeconds,
+		},
+	}
+	if _, err := c.api.PostC2CMessage(context.Background(), c.senderID, msgToPost); err != nil {
+		return err
+	}
+	c.lastNotify = time.Now()
+	return nil
 }
 
+// NoEdit QQ 不能编辑消息，Edit 发送新消息
+func (c *QQContext) NoEdit() {}
+
 func (c *QQContext) Edit(msg core.Message, text string) error {
 	// QQ does not support editing messages.
 	// As per requirement: "Edit sends a new message"
@@ -346,6 +696,29 @@ func (c *QQContext) Edit(msg core.Message, text string) error {
 	return err
 }
 
+// Delete 撤回机器人发送的消息，群聊和单聊只能撤回 2 分钟内的消息
+func (c *QQContext) Delete(msg core.Message) error {
+	qm, ok := msg.(*QQMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type for qq")
+	}
+	if qm.msg.ID == "" || qm.msg.ID == "unknown" {
+		return core.ErrNotSupported
+	}
+	ctx := context.Background()
+	switch c.ctxType {
+	case TypeGuild:
+		return c.api.RetractMessage(ctx, c.channelID, qm.msg.ID)
+	case TypeGuildDirect:
+		return c.api.RetractDMMessage(ctx, c.guildID, qm.msg.ID)
+	case TypeGroup:
+		return c.api.RetractGroupMessage(ctx, c.groupID, qm.msg.ID)
+	case TypeC2C:
+		return c.api.RetractC2CMessage(ctx, c.senderID, qm.msg.ID)
+	}
+	return core.ErrNotSupported
+}
+
 func (c *QQContext) Platform() string {
 	return "QQ"
 }
@@ -0,0 +1,110 @@
+package qq
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// arkListTemplate Ark 模板 23：描述、消息列表摘要和文本列表，列表项可以带链接
+const arkListTemplate = 23
+
+// maxPromptRunes 消息列表摘要的最大长度
+const maxPromptRunes = 30
+
+var mdLinkRegex = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^)\s]+)\)`)
+
+// newMessage 按格式构造消息：text 纯文本，markdown 原生 Markdown 或自定义模板，ark 文本加链接列表，
+// embed 只用于频道，其他场景按纯文本发送。除 ark 外都会过滤链接（QQ 不允许发送未报备的链接）
+func newMessage(text, format string, ctxType ContextType, cfg config.QQMessageConfig) *dto.MessageToCreate {
+	switch format {
+	case "markdown":
+		content := removeURLs(mdLinkRegex.ReplaceAllString(renderMentions(text, ctxType), "$1"))
+		md := &dto.Markdown{Content: content}
+		if cfg.MarkdownTemplate != "" {
+			md = &dto.Markdown{
+				CustomTemplateID: cfg.MarkdownTemplate,
+				Params:           []*dto.MarkdownParams{{Key: cfg.MarkdownParam, Values: []string{content}}},
+			}
+		}
+		return &dto.MessageToCreate{MsgType: dto.MarkdownMsg, Markdown: md}
+	case "ark":
+		// Ark 中无法 @，提及只保留名字
+		return &dto.MessageToCreate{MsgType: dto.ArkMsg, Ark: arkList(renderMentions(text, TypeC2C))}
+	case "embed":
+		if ctxType == TypeGuild || ctxType == TypeGuildDirect {
+			return &dto.MessageToCreate{MsgType: dto.EmbedMsg, Embed: embed(removeURLs(mdLinkRegex.ReplaceAllString(renderMentions(text, TypeC2C), "$1")))}
+		}
+	}
+	return &dto.MessageToCreate{MsgType: dto.TextMsg, Content: removeURLs(renderMentions(text, ctxType))}
+}
+
+// arkList 第一行作为描述和摘要，其余每行一个列表项，行中的链接（含 Markdown 链接）作为列表项的链接
+func arkList(text string) *dto.Ark {
+	lines := nonEmptyLines(text)
+	if len(lines) == 0 {
+		lines = []string{" "}
+	}
+	items := lines
+	if len(lines) > 1 {
+		items = lines[1:]
+	}
+	var list []*dto.ArkObj
+	for _, line := range items {
+		desc, link := line, ""
+		if m := mdLinkRegex.FindStringSubmatch(line); m != nil {
+			desc, link = strings.Replace(line, m[0], m[1], 1), m[2]
+		} else if url := urlRegex.FindString(line); url != "" {
+			desc, link = strings.TrimSpace(strings.Replace(line, url, "", 1)), url
+		}
+		if desc == "" {
+			desc = link
+		}
+		kv := []*dto.ArkObjKV{{Key: "desc", Value: desc}}
+		if link != "" {
+			kv = append(kv, &dto.ArkObjKV{Key: "link", Value: link})
+		}
+		list = append(list, &dto.ArkObj{ObjKV: kv})
+	}
+	return &dto.Ark{
+		TemplateID: arkListTemplate,
+		KV: []*dto.ArkKV{
+			{Key: "#DESC#", Value: lines[0]},
+			{Key: "#PROMPT#", Value: truncateRunes(lines[0], maxPromptRunes)},
+			{Key: "#LIST#", Obj: list},
+		},
+	}
+}
+
+// embed 第一行作为标题，其余每行一个字段
+func embed(text string) *dto.Embed {
+	lines := nonEmptyLines(text)
+	if len(lines) == 0 {
+		return &dto.Embed{}
+	}
+	e := &dto.Embed{Title: lines[0], Prompt: truncateRunes(lines[0], maxPromptRunes)}
+	for _, line := range lines[1:] {
+		e.Fields = append(e.Fields, &dto.EmbedField{Name: line})
+	}
+	return e
+}
+
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
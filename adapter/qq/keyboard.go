@@ -0,0 +1,115 @@
+package qq
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/dto/keyboard"
+	"github.com/tencent-connect/botgo/event"
+)
+
+// callbackSep 分隔按钮回调数据中的回调名和数据，与 Telegram 的 unique|data 一致
+const callbackSep = "|"
+
+// newKeyboard 将按钮转换为回调按钮，同一条消息的按钮在同一分组，点击一个后其余变灰
+func newKeyboard(rows [][]core.Button) *keyboard.MessageKeyboard {
+	kb := &keyboard.CustomKeyboard{}
+	n := 0
+	for _, row := range rows {
+		r := &keyboard.Row{}
+		for _, button := range row {
+			n++
+			r.Buttons = append(r.Buttons, &keyboard.Button{
+				ID:         strconv.Itoa(n),
+				RenderData: &keyboard.RenderData{Label: button.Text, VisitedLabel: button.Text, Style: 1},
+				Action: &keyboard.Action{
+					Type:       keyboard.ActionTypeCallback,
+					Permission: &keyboard.Permission{Type: keyboard.PermissionTypAll},
+					Data:       button.Name + callbackSep + button.Data,
+				},
+				GroupID: "1",
+			})
+		}
+		if len(r.Buttons) > 0 {
+			kb.Rows = append(kb.Rows, r)
+		}
+	}
+	return &keyboard.MessageKeyboard{Content: kb}
+}
+
+// sendKeyboard 以 Markdown 消息附带按钮发送（需要开通 Markdown 和消息按钮权限）
+func (c *QQContext) sendKeyboard(text string, rows [][]core.Button) (*dto.Message, error) {
+	content := removeURLs(mdLinkRegex.ReplaceAllString(renderMentions(text, c.ctxType), "$1"))
+	return c.reply(&dto.MessageToCreate{
+		MsgType:  dto.MarkdownMsg,
+		Markdown: &dto.Markdown{Content: content},
+		Keyboard: newKeyboard(rows),
+	})
+}
+
+// interactionResolved 按钮点击事件的 resolved 数据
+type interactionResolved struct {
+	ButtonData string `json:"button_data"`
+	ButtonID   string `json:"button_id"`
+	UserID     string `json:"user_id"`
+	MessageID  string `json:"message_id"`
+}
+
+// InteractionEventHandler 处理消息按钮点击（INTERACTION_CREATE），按回调名交给 RegisterCallback 注册的处理器
+func (a *QQAdapter) InteractionEventHandler() event.InteractionEventHandler {
+	return func(event *dto.WSPayload, data *dto.WSInteractionData) error {
+		// 需要尽快确认，否则客户端会提示操作失败
+		if err := a.api.PutInteraction(context.Background(), data.ID, `{"code":0}`); err != nil {
+			a.logger.Warn("QQ interaction ack failed", "id", data.ID, "error", err)
+		}
+		if data.Data == nil || data.Data.Type != dto.InteractionDataTypeInlineKeyboardClick {
+			return nil
+		}
+
+		var resolved interactionResolved
+		if err := json.Unmarshal(data.Data.Resolved, &resolved); err != nil {
+			a.logger.Warn("QQ interaction data invalid", "id", data.ID, "error", err)
+			return nil
+		}
+		name, payload, _ := strings.Cut(resolved.ButtonData, callbackSep)
+		handler, ok := a.callbackHandlers[name]
+		if !ok {
+			return nil
+		}
+
+		ctx := &QQContext{
+			api:          a.api,
+			eventID:      data.ID,
+			replies:      a.replies,
+			received:     time.Now(),
+			callbackData: payload,
+			adapter:      a,
+		}
+		switch data.ChatType {
+		case 1:
+			ctx.ctxType = TypeGroup
+			ctx.groupID = data.GroupOpenID
+			ctx.author = &dto.User{ID: data.GroupMemberOpenID}
+		case 2:
+			ctx.ctxType = TypeC2C
+			ctx.senderID = data.UserOpenID
+			ctx.author = &dto.User{ID: data.UserOpenID}
+		default:
+			ctx.ctxType = TypeGuild
+			ctx.guildID = data.GuildID
+			ctx.channelID = data.ChannelID
+			ctx.author = &dto.User{ID: resolved.UserID}
+		}
+
+		err := handler(ctx)
+		if err != nil {
+			a.logger.Error("QQ handler error", "error", err, "request_id", core.ErrorRequestID(err))
+		}
+		return err
+	}
+}
@@ -0,0 +1,168 @@
+package qq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/tencent-connect/botgo/constant"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// uploadClient 上传图片使用的 HTTP 客户端，文件较大时需要比 API 调用更长的超时
+var uploadClient = &http.Client{Timeout: 60 * time.Second}
+
+// downloadClient 下载用户发送的附件使用的 HTTP 客户端，超时包括读取响应体
+var downloadClient = &http.Client{Timeout: 60 * time.Second}
+
+// maxDownloadSize 附件下载的上限，超出部分被截断，由调用方按各自的限制判断文件是否过大
+const maxDownloadSize = 50 << 20
+
+// 富媒体文件类型
+const (
+	fileTypeImage = 1
+	fileTypeVideo = 2
+	fileTypeVoice = 3
+	fileTypeFile  = 4
+)
+
+// richMediaUpload 上传富媒体文件，SDK 自带的 RichMediaMessage 只支持 URL，这里补充 file_data
+type richMediaUpload struct {
+	FileType   uint64 `json:"file_type"`
+	FileData   []byte `json:"file_data,omitempty"` // JSON 编码后即为 base64
+	SrvSendMsg bool   `json:"srv_send_msg"`
+}
+
+func (m *richMediaUpload) GetEventID() string {
+	return ""
+}
+
+func (m *richMediaUpload) GetSendType() dto.SendType {
+	return dto.RichMedia
+}
+
+func richMediaFileType(file *core.File) uint64 {
+	switch {
+	case file.IsImage():
+		return fileTypeImage
+	case strings.HasPrefix(file.MIMEType, "video/"):
+		return fileTypeVideo
+	case strings.HasPrefix(file.MIMEType, "audio/silk"):
+		return fileTypeVoice
+	default:
+		return fileTypeFile
+	}
+}
+
+// SendFile 群聊、单聊先上传文件获取 file_info，再以富媒体消息（MsgType 7）回复；频道只能发送图片
+func (c *QQContext) SendFile(file *core.File) error {
+	if c.ctxType == TypeGuild || c.ctxType == TypeGuildDirect {
+		if !file.IsImage() {
+			return core.ErrNotSupported
+		}
+		return c.sendGuildImage(file)
+	}
+
+	upload := &richMediaUpload{
+		FileType: richMediaFileType(file),
+		FileData: file.Data,
+	}
+
+	var uploaded *dto.Message
+	var err error
+	if c.ctxType == TypeGroup {
+		uploaded, err = c.api.PostGroupMessage(context.Background(), c.groupID, upload)
+	} else {
+		uploaded, err = c.api.PostC2CMessage(context.Background(), c.senderID, upload)
+	}
+	if err != nil {
+		return fmt.Errorf("upload file failed: %w", err)
+	}
+	if uploaded == nil || len(uploaded.FileInfo) == 0 {
+		return fmt.Errorf("upload file failed: empty file_info")
+	}
+
+	msgToPost := &dto.MessageToCreate{
+		Content: removeURLs(file.Caption),
+		MsgType: dto.RichMediaMsg,
+		Media:   &dto.MediaInfo{FileInfo: uploaded.FileInfo},
+	}
+	passive := c.replyTo(msgToPost)
+	slog.Info("QQ Sending File", "type", c.ctxType, "name", file.Name, "size", len(file.Data), "seq", msgToPost.MsgSeq)
+	if c.ctxType == TypeGroup {
+		_, err = c.api.PostGroupMessage(context.Background(), c.groupID, msgToPost)
+	} else {
+		_, err = c.api.PostC2CMessage(context.Background(), c.senderID, msgToPost)
+	}
+	if err != nil && !passive {
+		return c.activeError(err)
+	}
+	return err
+}
+
+// sendGuildImage 频道和频道私信没有富媒体上传接口，以 multipart 表单的 file_image 字段发送图片
+func (c *QQContext) sendGuildImage(file *core.File) error {
+	if c.adapter == nil {
+		return core.ErrNotSupported
+	}
+	path := "/channels/" + c.channelID + "/messages"
+	if c.ctxType == TypeGuildDirect {
+		path = "/dms/" + c.guildID + "/messages"
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	replyID, _ := c.nextReply()
+	if replyID != "" && c.msgID != "" {
+		_ = w.WriteField("msg_id", replyID)
+	} else if replyID != "" {
+		_ = w.WriteField("event_id", replyID)
+	}
+	if caption := removeURLs(file.Caption); caption != "" {
+		_ = w.WriteField("content", caption)
+	}
+	part, err := w.CreateFormFile("file_image", file.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(file.Data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	tok, err := c.adapter.tokenSource.Token()
+	if err != nil {
+		return fmt.Errorf("get access token: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, constant.APIDomain+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	tok.SetAuthHeader(req)
+
+	slog.Info("QQ Sending Guild Image", "type", c.ctxType, "name", file.Name, "size", len(file.Data))
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("send image failed: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+		if replyID == "" && c.replyID() != "" {
+			return c.activeError(err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package qq
+
+import (
+	"context"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// renderMentions 将 core.Mention 转换为 QQ 的 @ 格式：群聊 <qqbot-at-user>，频道 <@用户ID>，私聊只保留名字
+func renderMentions(text string, ctxType ContextType) string {
+	return core.RenderMentions(text, func(userID, name string) string {
+		switch ctxType {
+		case TypeGroup:
+			return `<qqbot-at-user id="` + userID + `" />`
+		case TypeGuild:
+			return "<@" + userID + ">"
+		default:
+			return core.MentionName(userID, name)
+		}
+	})
+}
+
+// Member 查询频道成员；QQ 群和私聊没有成员查询接口
+func (c *QQContext) Member(userID string) (*core.Member, error) {
+	if c.ctxType != TypeGuild || c.guildID == "" {
+		return nil, core.ErrNotSupported
+	}
+	member, err := c.api.GuildMember(context.Background(), c.guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &core.Member{
+		User:     core.User{ID: userID},
+		Nickname: member.Nick,
+		Roles:    member.Roles,
+	}
+	if member.User != nil {
+		result.Username = member.User.Username
+		result.IsBot = member.User.Bot
+	}
+	if joined, err := member.JoinedAt.Time(); err == nil {
+		result.JoinedAt = joined
+	}
+	return result, nil
+}
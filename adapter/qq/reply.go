@@ -0,0 +1,137 @@
+package qq
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+const (
+	// passiveReplyWindow 被动回复（带 msg_id）的有效期，QQ 为收到消息后 5 分钟，留出余量
+	passiveReplyWindow = 4*time.Minute + 30*time.Second
+	// maxPassiveReplies 群聊、单聊中每条消息最多被动回复 5 次
+	maxPassiveReplies = 5
+	// replyStateTTL 回复状态保留的时间，超过被动回复窗口后不再需要
+	replyStateTTL = 10 * time.Minute
+)
+
+// replyState 一条收到的消息的回复状态
+type replyState struct {
+	received time.Time
+	seq      int // 已使用的最大序号
+	passive  int // 已被动回复的次数
+	warned   bool
+}
+
+// replyTracker 按 msg_id 分配回复序号、统计被动回复次数，同一 msg_id 的所有上下文共享，
+// 避免序号重复导致回复被 QQ 去重丢弃。记录保存在内存中，超过 replyStateTTL 后清理
+type replyTracker struct {
+	mu     sync.Mutex
+	states map[string]*replyState
+}
+
+func newReplyTracker() *replyTracker {
+	return &replyTracker{states: make(map[string]*replyState)}
+}
+
+// state 返回 msgID 的回复状态，不存在时以 received 为收到时间创建，调用方持有 t.mu
+func (t *replyTracker) state(msgID string, received time.Time) *replyState {
+	if st, ok := t.states[msgID]; ok {
+		return st
+	}
+	now := time.Now()
+	for id, old := range t.states {
+		if now.Sub(old.received) > replyStateTTL {
+			delete(t.states, id)
+		}
+	}
+	st := &replyState{received: received}
+	t.states[msgID] = st
+	return st
+}
+
+// passiveOpen 能否继续被动回复
+func (st *replyState) passiveOpen(ctxType ContextType) bool {
+	if time.Since(st.received) > passiveReplyWindow {
+		return false
+	}
+	if (ctxType == TypeGroup || ctxType == TypeC2C) && st.passive >= maxPassiveReplies {
+		return false
+	}
+	return true
+}
+
+// next 为 msgID 分配下一个序号，reply 为 true 时计入被动回复次数（输入状态不计入）。
+// 被动回复窗口已过或次数用完时 ok 为 false；closed 只在第一次关闭时为 true，用于只记录一次警告
+func (t *replyTracker) next(msgID string, ctxType ContextType, received time.Time, reply bool) (seq uint32, ok, closed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.state(msgID, received)
+	if !st.passiveOpen(ctxType) {
+		closed = !st.warned
+		st.warned = true
+		return 0, false, closed
+	}
+	st.seq++
+	if reply {
+		st.passive++
+	}
+	return uint32(st.seq), true, false
+}
+
+// replyID 被动回复引用的 ID：消息的 msg_id，按钮点击等事件为 event_id
+func (c *QQContext) replyID() string {
+	if c.msgID != "" {
+		return c.msgID
+	}
+	return c.eventID
+}
+
+// nextReply 返回下一条回复引用的 ID 和序号。被动回复窗口已过或次数用完时返回空 ID，
+// 消息作为主动消息发送（占用每月的主动消息额度）。工具调用较多的回答可能超过窗口
+func (c *QQContext) nextReply() (string, uint32) {
+	id := c.replyID()
+	if id == "" {
+		return "", 0
+	}
+	seq, ok, closed := c.replies.next(id, c.ctxType, c.received, true)
+	if !ok {
+		if closed {
+			c.logger().Warn("QQ passive reply window closed, falling back to active messages",
+				"type", c.ctxType, "reply_to", id, "age", time.Since(c.received).Round(time.Second))
+		}
+		return "", 0
+	}
+	return id, seq
+}
+
+// replyTo 为消息填写被动回复的 msg_id 或 event_id 和序号，返回是否为被动回复
+func (c *QQContext) replyTo(msg *dto.MessageToCreate) bool {
+	id, seq := c.nextReply()
+	if id == "" {
+		return false
+	}
+	if c.msgID != "" {
+		msg.MsgID = id
+	} else {
+		msg.EventID = id
+	}
+	msg.MsgSeq = seq
+	return true
+}
+
+// activeError 主动消息发送失败，通常是额度用完（群聊、单聊每月有限次数）
+func (c *QQContext) activeError(err error) error {
+	c.logger().Warn("QQ active message failed, quota may be exhausted", "type", c.ctxType, "error", err)
+	return fmt.Errorf("QQ 被动回复已超时或次数已用完，主动消息发送失败（可能已用完主动消息额度）: %w", err)
+}
+
+func (c *QQContext) logger() *slog.Logger {
+	if c.adapter != nil {
+		return c.adapter.logger
+	}
+	return slog.Default()
+}
@@ -1,21 +1,42 @@
 package telegram
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lhpqaq/ggbot/config"
 	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
 	tele "gopkg.in/telebot.v4"
 )
 
 type TelegramAdapter struct {
 	bot    *tele.Bot
 	logger *slog.Logger
+	lang   string // bot.language，未按客户端语言设置菜单时使用
+	html   bool   // bot.parse_mode 为 html 时把 Markdown 转换为 Telegram HTML 发送
+	loop   *core.Supervisor
+}
+
+func init() {
+	core.RegisterAdapterFactory("telegram", func(ac *core.AdapterConfig, logger *slog.Logger) (core.Platform, error) {
+		cfg := ac.Config.Bot
+		if err := ac.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Token == "" {
+			return nil, nil
+		}
+		return New(cfg, ac.Config.Proxy, logger)
+	})
 }
 
 func New(cfg config.BotConfig, proxyCfg config.ProxyConfig, logger *slog.Logger) (*TelegramAdapter, error) {
@@ -47,7 +68,7 @@ func New(cfg config.BotConfig, proxyCfg config.ProxyConfig, logger *slog.Logger)
 		Poller: &tele.LongPoller{Timeout: cfg.PollerTimeout},
 		Client: httpClient,
 		OnError: func(err error, c tele.Context) {
-			logger.Error("Telegram error", "error", err)
+			logger.Error("Telegram error", "error", err, "request_id", core.ErrorRequestID(err))
 		},
 	}
 
@@ -56,7 +77,7 @@ func New(cfg config.BotConfig, proxyCfg config.ProxyConfig, logger *slog.Logger)
 		return nil, err
 	}
 
-	return &TelegramAdapter{bot: b, logger: logger}, nil
+	return &TelegramAdapter{bot: b, logger: logger, lang: cfg.Language, html: cfg.ParseMode == "html", loop: &core.Supervisor{Platform: "Telegram", Logger: logger}}, nil
 }
 
 func (a *TelegramAdapter) Name() string {
@@ -65,42 +86,240 @@ func (a *TelegramAdapter) Name() string {
 
 func (a *TelegramAdapter) Start() error {
 	a.logger.Info("Starting Telegram Bot")
-	go a.bot.Start()
+	a.loop.Run(a.poll)
 	return nil
 }
 
 func (a *TelegramAdapter) Stop() error {
-	a.bot.Stop()
+	a.loop.Stop()
 	return nil
 }
 
+// OnLoopEvent 轮询退出重启、恢复时通知
+func (a *TelegramAdapter) OnLoopEvent(f func(core.LoopEvent)) {
+	a.loop.OnLoopEvent(f)
+}
+
+// poll 拉取并处理更新，代替 bot.Start：bot.Start 在 panic 后无法再次启动，轮询由 Supervisor 重启
+func (a *TelegramAdapter) poll(stop <-chan struct{}) error {
+	pollStop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("poller panic: %v", r)
+			}
+		}()
+		a.bot.Poller.Poll(a.bot, a.bot.Updates, pollStop)
+		done <- errors.New("poller exited")
+	}()
+	for {
+		select {
+		case upd := <-a.bot.Updates:
+			a.bot.ProcessUpdate(upd)
+		case err := <-done:
+			return err
+		case <-stop:
+			// 正在进行的长轮询请求在超时后结束
+			close(pollStop)
+			return nil
+		}
+	}
+}
+
 func (a *TelegramAdapter) RegisterCommand(cmd string, handler core.Handler) {
 	a.bot.Handle(cmd, func(c tele.Context) error {
-		return handler(&TeleContext{ctx: c, bot: a.bot})
+		return handler(a.context(c))
 	})
 }
 
+// SetCommands 通过 setMyCommands 设置客户端的指令菜单：默认菜单使用 bot.language，
+// 另外为每种支持的语言设置一份，客户端按自身语言显示。
+// Telegram 只接受由小写字母、数字和下划线组成的指令名，其他指令跳过
+func (a *TelegramAdapter) SetCommands(cmds []*core.Command) error {
+	if err := a.bot.SetCommands(commandMenu(cmds, a.lang)); err != nil {
+		return err
+	}
+	for _, lang := range i18n.Languages() {
+		if err := a.bot.SetCommands(commandMenu(cmds, lang), lang); err != nil {
+			return fmt.Errorf("%s: %w", lang, err)
+		}
+	}
+	return nil
+}
+
+func commandMenu(cmds []*core.Command, lang string) []tele.Command {
+	var menu []tele.Command
+	for _, cmd := range cmds {
+		name := strings.TrimPrefix(cmd.Name, "/")
+		desc := cmd.Describe(lang)
+		if desc == "" || !validCommandName(name) {
+			continue
+		}
+		menu = append(menu, tele.Command{Text: name, Description: desc})
+	}
+	if len(menu) > 100 { // 菜单最多 100 条
+		menu = menu[:100]
+	}
+	return menu
+}
+
+// validCommandName 指令名为 1-32 个小写字母、数字或下划线
+func validCommandName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
 func (a *TelegramAdapter) RegisterText(handler core.Handler) {
 	a.bot.Handle(tele.OnText, func(c tele.Context) error {
 		// Telebot OnText might catch commands too, filter if necessary or let handler decide
 		// Usually Telebot dispatches specific commands first.
-		return handler(&TeleContext{ctx: c, bot: a.bot})
+		return handler(a.context(c))
 	})
 }
 
+func (a *TelegramAdapter) RegisterDocument(handler core.Handler) {
+	a.bot.Handle(tele.OnDocument, func(c tele.Context) error {
+		return handler(a.context(c))
+	})
+}
+
+func (a *TelegramAdapter) RegisterPhoto(handler core.Handler) {
+	a.bot.Handle(tele.OnPhoto, func(c tele.Context) error {
+		return handler(a.context(c))
+	})
+}
+
+func (a *TelegramAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.bot.Handle("\f"+name, func(c tele.Context) error {
+		err := handler(a.context(c))
+		// Always answer the callback so the client stops showing a spinner
+		_ = c.Respond()
+		return err
+	})
+}
+
+// RegisterMemberEvent 处理群组中的成员加入、离开消息，机器人被拉进群时 Self 为 true
+func (a *TelegramAdapter) RegisterMemberEvent(handler core.MemberHandler) {
+	handle := func(joined bool) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			msg := c.Message()
+			user := msg.UserLeft
+			if joined {
+				user = msg.UserJoined
+			}
+			if user == nil {
+				return nil
+			}
+			return handler(a.context(c), core.MemberEvent{
+				Joined: joined,
+				Member: &core.Member{
+					User:     core.User{ID: strconv.FormatInt(user.ID, 10), Username: user.Username, IsBot: user.IsBot, Language: user.LanguageCode},
+					Nickname: strings.TrimSpace(user.FirstName + " " + user.LastName),
+				},
+				Self: user.ID == a.bot.Me.ID,
+			})
+		}
+	}
+	a.bot.Handle(tele.OnUserJoined, handle(true))
+	a.bot.Handle(tele.OnUserLeft, handle(false))
+	// 新建群组或机器人被拉进群（包括与其他成员一起被拉入）时不会触发 OnUserJoined
+	a.bot.Handle(tele.OnAddedToGroup, func(c tele.Context) error {
+		me := a.bot.Me
+		return handler(a.context(c), core.MemberEvent{
+			Joined: true,
+			Member: &core.Member{
+				User:     core.User{ID: strconv.FormatInt(me.ID, 10), Username: me.Username, IsBot: true},
+				Nickname: me.FirstName,
+			},
+			Self: true,
+		})
+	})
+}
+
+// RegisterPayment 处理付款：付款前的确认（pre_checkout_query）直接通过，付款成功的消息交给 handler
+func (a *TelegramAdapter) RegisterPayment(handler core.PaymentHandler) {
+	a.bot.Handle(tele.OnCheckout, func(c tele.Context) error {
+		return c.Accept()
+	})
+	a.bot.Handle(tele.OnPayment, func(c tele.Context) error {
+		p := c.Message().Payment
+		return handler(a.context(c), core.Payment{
+			Payload:  p.Payload,
+			Currency: p.Currency,
+			Amount:   p.Total,
+			ChargeID: p.TelegramChargeID,
+		})
+	})
+}
+
+// SendTo sends a message to "ChatID" or "ChatID:topic:ThreadID"
 func (a *TelegramAdapter) SendTo(recipient string, text string) error {
-	id, err := strconv.ParseInt(recipient, 10, 64)
+	chatPart, threadPart, hasTopic := strings.Cut(recipient, ":topic:")
+	id, err := strconv.ParseInt(chatPart, 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid telegram recipient id: %s", recipient)
+		return core.Permanent(fmt.Errorf("invalid telegram recipient id: %s", recipient))
 	}
-	_, err = a.bot.Send(&tele.User{ID: id}, text)
+	opts := &tele.SendOptions{}
+	if hasTopic {
+		threadID, err := strconv.Atoi(threadPart)
+		if err != nil {
+			return core.Permanent(fmt.Errorf("invalid telegram topic id: %s", recipient))
+		}
+		opts.ThreadID = threadID
+	}
+	_, err = sendText(a.bot, a.html, tele.ChatID(id), text, opts)
 	return err
 }
 
+func (a *TelegramAdapter) context(c tele.Context) *TeleContext {
+	return &TeleContext{ctx: c, bot: a.bot, html: a.html}
+}
+
+// sendText 发送文字。html 为 true 时把 Markdown 转换为 HTML 发送，Telegram 无法解析时退回纯文本
+func sendText(bot *tele.Bot, html bool, to tele.Recipient, text string, opts *tele.SendOptions) (*tele.Message, error) {
+	if html {
+		htmlOpts := *opts
+		htmlOpts.ParseMode = tele.ModeHTML
+		msg, err := bot.Send(to, renderHTML(text), &htmlOpts)
+		if err == nil || !isParseError(err) {
+			return msg, err
+		}
+	}
+	text, opts.Entities = renderMentions(text)
+	return bot.Send(to, text, opts)
+}
+
+// editText 编辑消息，规则同 sendText，opts 为其他编辑选项（如新的按钮）
+func editText(bot *tele.Bot, html bool, msg *tele.Message, text string, opts ...any) error {
+	if html {
+		_, err := bot.Edit(msg, renderHTML(text), append([]any{tele.ModeHTML}, opts...)...)
+		if err == nil || !isParseError(err) {
+			return err
+		}
+	}
+	text, entities := renderMentions(text)
+	_, err := bot.Edit(msg, text, append([]any{entities}, opts...)...)
+	return err
+}
+
+// isParseError 转换后的 HTML 不被 Telegram 接受（如标签嵌套不合法）
+func isParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
 // We need a concrete context implementation
 type TeleContext struct {
-	ctx tele.Context
-	bot *tele.Bot
+	ctx  tele.Context
+	bot  *tele.Bot
+	html bool
 }
 
 func (c *TeleContext) Sender() *core.User {
@@ -109,31 +328,193 @@ func (c *TeleContext) Sender() *core.User {
 		ID:       strconv.FormatInt(u.ID, 10),
 		Username: u.Username,
 		IsBot:    u.IsBot,
+		Language: u.LanguageCode,
+	}
+}
+
+func (c *TeleContext) Chat() *core.Chat {
+	chat := c.ctx.Chat()
+	if chat == nil {
+		return &core.Chat{ID: c.ctx.Recipient().Recipient(), Type: "private"}
+	}
+	chatType := "group"
+	switch chat.Type {
+	case tele.ChatPrivate:
+		chatType = "private"
+	case tele.ChatChannel, tele.ChatChannelPrivate:
+		chatType = "channel"
+	}
+	result := &core.Chat{
+		ID:   strconv.FormatInt(chat.ID, 10),
+		Type: chatType,
+	}
+	if threadID := c.threadID(); threadID != 0 {
+		result.ThreadID = strconv.Itoa(threadID)
 	}
+	return result
+}
+
+// threadID returns the forum topic of the incoming message, 0 outside topics
+func (c *TeleContext) threadID() int {
+	msg := c.ctx.Message()
+	if msg == nil || !msg.TopicMessage {
+		return 0
+	}
+	return msg.ThreadID
+}
+
+// sendOptions keeps outgoing messages in the originating forum topic
+func (c *TeleContext) sendOptions() *tele.SendOptions {
+	return &tele.SendOptions{ThreadID: c.threadID()}
 }
 
 func (c *TeleContext) Text() string {
 	return c.ctx.Text()
 }
 
+func (c *TeleContext) Data() string {
+	if cb := c.ctx.Callback(); cb != nil {
+		return cb.Data
+	}
+	return ""
+}
+
+func (c *TeleContext) Document() *core.Document {
+	msg := c.ctx.Message()
+	if msg == nil || msg.Document == nil {
+		return nil
+	}
+	d := msg.Document
+	return &core.Document{
+		ID:       d.FileID,
+		Name:     d.FileName,
+		MIMEType: d.MIME,
+		Size:     d.FileSize,
+	}
+}
+
+func (c *TeleContext) Photo() *core.Document {
+	msg := c.ctx.Message()
+	if msg == nil || msg.Photo == nil {
+		return nil
+	}
+	p := msg.Photo
+	return &core.Document{
+		ID:       p.FileID,
+		Name:     p.FileID + ".jpg",
+		MIMEType: "image/jpeg", // Telegram 会将照片统一压缩为 JPEG
+		Size:     p.FileSize,
+	}
+}
+
+func (c *TeleContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	return c.bot.File(&tele.File{FileID: doc.ID})
+}
+
 func (c *TeleContext) Reply(text string) error {
-	return c.ctx.Send(text)
+	_, err := c.Send(text)
+	return err
 }
 
 func (c *TeleContext) Send(text string) (core.Message, error) {
-	msg, err := c.ctx.Bot().Send(c.ctx.Recipient(), text)
+	msg, err := sendText(c.bot, c.html, c.ctx.Recipient(), text, c.sendOptions())
 	if err != nil {
 		return nil, err
 	}
 	return &TeleMessage{msg: msg, bot: c.bot}, nil
 }
 
+func (c *TeleContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	opts := c.sendOptions()
+	opts.ReplyMarkup = inlineKeyboard(rows)
+	msg, err := sendText(c.bot, c.html, c.ctx.Recipient(), text, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TeleMessage{msg: msg, bot: c.bot}, nil
+}
+
+// UpdateButtons 编辑被点击的按钮所在的消息，替换文字和按钮
+func (c *TeleContext) UpdateButtons(text string, rows [][]core.Button) error {
+	cb := c.ctx.Callback()
+	if cb == nil || cb.Message == nil {
+		return core.ErrNotSupported
+	}
+	return editText(c.bot, c.html, cb.Message, text, inlineKeyboard(rows))
+}
+
+func inlineKeyboard(rows [][]core.Button) *tele.ReplyMarkup {
+	markup := &tele.ReplyMarkup{}
+	for _, row := range rows {
+		var buttons []tele.InlineButton
+		for _, b := range row {
+			buttons = append(buttons, tele.InlineButton{Unique: b.Name, Text: b.Text, Data: b.Data})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+	}
+	return markup
+}
+
+// SendInvoice 发送付款请求，Telegram Stars（XTR）不需要支付服务商的 token
+func (c *TeleContext) SendInvoice(inv core.Invoice) error {
+	_, err := c.bot.Send(c.ctx.Recipient(), &tele.Invoice{
+		Title:       inv.Title,
+		Description: inv.Description,
+		Payload:     inv.Payload,
+		Currency:    inv.Currency,
+		Token:       inv.ProviderToken,
+		Prices:      []tele.Price{{Label: inv.Title, Amount: inv.Amount}},
+	}, c.sendOptions())
+	return err
+}
+
+func (c *TeleContext) React(emoji string) error {
+	msg := c.ctx.Message()
+	if msg == nil {
+		return fmt.Errorf("no message to react to")
+	}
+	return c.bot.React(c.ctx.Recipient(), msg, tele.Reactions{
+		Reactions: []tele.Reaction{{Type: tele.ReactionTypeEmoji, Emoji: emoji}},
+	})
+}
+
+// Notify sends a chat action, Telegram shows it for about 5 seconds
+func (c *TeleContext) Notify(action core.ChatAction) error {
+	return c.bot.Notify(c.ctx.Recipient(), tele.ChatAction(action), c.threadID())
+}
+
 func (c *TeleContext) Edit(msg core.Message, text string) error {
 	tm, ok := msg.(*TeleMessage)
 	if !ok {
 		return fmt.Errorf("invalid message type for telegram")
 	}
-	_, err := c.bot.Edit(tm.msg, text)
+	return editText(c.bot, c.html, tm.msg, text)
+}
+
+func (c *TeleContext) Delete(msg core.Message) error {
+	tm, ok := msg.(*TeleMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type for telegram")
+	}
+	return c.bot.Delete(tm.msg)
+}
+
+func (c *TeleContext) SendFile(file *core.File) error {
+	var what interface{}
+	if file.IsImage() {
+		what = &tele.Photo{
+			File:    tele.FromReader(bytes.NewReader(file.Data)),
+			Caption: file.Caption,
+		}
+	} else {
+		what = &tele.Document{
+			File:     tele.FromReader(bytes.NewReader(file.Data)),
+			FileName: file.Name,
+			MIME:     file.MIMEType,
+			Caption:  file.Caption,
+		}
+	}
+	_, err := c.bot.Send(c.ctx.Recipient(), what, c.sendOptions())
 	return err
 }
 
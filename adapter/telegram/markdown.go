@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+var (
+	headingRegex = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	bulletRegex  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	ruleRegex    = regexp.MustCompile(`^(?:-{3,}|\*{3,}|_{3,})$`)
+	linkRegex    = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^)\s]+|tg://[^)\s]+)\)`)
+	boldRegex    = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	// 下划线、单星号要求两侧不是字母数字，避免 snake_case、2*3*4 被当作斜体
+	underBoldRegex = regexp.MustCompile(`(^|[^\p{L}\p{N}_])__(\S(?:.*?\S)?)__($|[^\p{L}\p{N}_])`)
+	italicRegex    = regexp.MustCompile(`(^|[^\p{L}\p{N}*])\*(\S(?:[^*]*?\S)?)\*($|[^\p{L}\p{N}*])`)
+	underItalRegex = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_(\S(?:[^_]*?\S)?)_($|[^\p{L}\p{N}_])`)
+	strikeRegex    = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	spoilerRegex   = regexp.MustCompile(`\|\|(\S(?:.*?\S)?)\|\|`)
+	placeholderRe  = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// renderHTML 将模型输出的 Markdown 转换为 Telegram HTML：转义 <、>、&，代码块转为 <pre>，
+// 粗体、斜体、删除线、链接、标题、引用、列表转为对应的标签，提及转为 tg://user 链接。
+// 未闭合的标记保留为原文，流式输出中途的内容也能正常发送
+func renderHTML(text string) string {
+	// 提及先替换为占位符，转换完成后再还原，名字中的 Markdown 字符不受影响
+	var mentions []string
+	text = core.RenderMentions(text, func(userID, name string) string {
+		label := name
+		if label == "" {
+			label = core.MentionName(userID, name)
+		}
+		var tag string
+		if _, err := strconv.ParseInt(userID, 10, 64); err == nil {
+			tag = `<a href="tg://user?id=` + userID + `">` + html.EscapeString(label) + `</a>`
+		} else {
+			tag = html.EscapeString(core.MentionName(userID, name))
+		}
+		mentions = append(mentions, tag)
+		return "\x00" + strconv.Itoa(len(mentions)-1) + "\x00"
+	})
+
+	lines := strings.Split(text, "\n")
+	var out, quote []string
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			quote = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flushQuote()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			// 未闭合的代码块延续到末尾
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			body := html.EscapeString(strings.Join(code, "\n"))
+			if lang != "" && !strings.ContainsAny(lang, " \"'<>&") {
+				out = append(out, `<pre><code class="language-`+lang+`">`+body+"</code></pre>")
+			} else {
+				out = append(out, "<pre>"+body+"</pre>")
+			}
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(trimmed, ">"); ok {
+			quote = append(quote, renderInline(strings.TrimPrefix(rest, " ")))
+			continue
+		}
+		flushQuote()
+
+		switch {
+		case ruleRegex.MatchString(trimmed):
+			out = append(out, "──────")
+		case headingRegex.MatchString(trimmed):
+			out = append(out, "<b>"+renderInline(headingRegex.FindStringSubmatch(trimmed)[1])+"</b>")
+		case bulletRegex.MatchString(line):
+			m := bulletRegex.FindStringSubmatch(line)
+			out = append(out, m[1]+"• "+renderInline(m[2]))
+		default:
+			out = append(out, renderInline(line))
+		}
+	}
+	flushQuote()
+
+	return placeholderRe.ReplaceAllStringFunc(strings.Join(out, "\n"), func(m string) string {
+		i, _ := strconv.Atoi(m[1 : len(m)-1])
+		if i < len(mentions) {
+			return mentions[i]
+		}
+		return ""
+	})
+}
+
+// renderInline 转换一行中的行内标记，反引号中的内容只转义
+func renderInline(line string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(line[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		b.WriteString(renderEmphasis(line[:start]))
+		b.WriteString("<code>" + html.EscapeString(line[start+1:start+1+end]) + "</code>")
+		line = line[start+2+end:]
+	}
+	b.WriteString(renderEmphasis(line))
+	return b.String()
+}
+
+// renderEmphasis 转换链接和强调，链接先替换为占位符，避免 URL 中的 _、* 被当作强调
+func renderEmphasis(s string) string {
+	var links []string
+	s = linkRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := linkRegex.FindStringSubmatch(m)
+		links = append(links, `<a href="`+html.EscapeString(sub[2])+`">`+html.EscapeString(sub[1])+"</a>")
+		return "\x01" + strconv.Itoa(len(links)-1) + "\x01"
+	})
+
+	s = html.EscapeString(s)
+	s = boldRegex.ReplaceAllString(s, "<b>$1</b>")
+	s = underBoldRegex.ReplaceAllString(s, "$1<b>$2</b>$3")
+	// 相邻的强调共用中间的分隔字符，替换两遍
+	for range 2 {
+		s = italicRegex.ReplaceAllString(s, "$1<i>$2</i>$3")
+		s = underItalRegex.ReplaceAllString(s, "$1<i>$2</i>$3")
+	}
+	s = strikeRegex.ReplaceAllString(s, "<s>$1</s>")
+	s = spoilerRegex.ReplaceAllString(s, "<tg-spoiler>$1</tg-spoiler>")
+
+	for i, link := range links {
+		s = strings.Replace(s, "\x01"+strconv.Itoa(i)+"\x01", link, 1)
+	}
+	return s
+}
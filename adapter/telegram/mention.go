@@ -0,0 +1,88 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lhpqaq/ggbot/core"
+	tele "gopkg.in/telebot.v4"
+)
+
+// renderMentions 将 core.Mention 转换为 text_mention 实体，无需用户名也能 @ 到用户
+func renderMentions(text string) (string, tele.Entities) {
+	var entities tele.Entities
+	var b strings.Builder
+	rendered := core.RenderMentions(text, func(userID, name string) string {
+		// 占位，统一在下面计算 UTF-16 偏移
+		return "\x00" + userID + "\x01" + name + "\x00"
+	})
+	if rendered == text {
+		return text, nil
+	}
+
+	offset := 0
+	for i, part := range strings.Split(rendered, "\x00") {
+		if i%2 == 0 {
+			b.WriteString(part)
+			offset += len(utf16.Encode([]rune(part)))
+			continue
+		}
+		userID, name, _ := strings.Cut(part, "\x01")
+		id, err := strconv.ParseInt(userID, 10, 64)
+		label := name
+		if label == "" || err != nil {
+			label = core.MentionName(userID, name)
+		}
+		length := len(utf16.Encode([]rune(label)))
+		if err == nil {
+			entities = append(entities, tele.MessageEntity{
+				Type:   tele.EntityTMention,
+				Offset: offset,
+				Length: length,
+				User:   &tele.User{ID: id},
+			})
+		}
+		b.WriteString(label)
+		offset += length
+	}
+	return b.String(), entities
+}
+
+func (c *TeleContext) Member(userID string) (*core.Member, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	member, err := c.bot.ChatMemberOf(c.ctx.Chat(), &tele.User{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	u := member.User
+	nickname := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if member.Title != "" {
+		nickname = member.Title
+	}
+	return &core.Member{
+		User:     core.User{ID: userID, Username: u.Username, IsBot: u.IsBot},
+		Nickname: nickname,
+		Roles:    []string{string(member.Role)},
+	}, nil
+}
+
+// Addressed reports whether the message @-mentions or replies to the bot, see core.IsAddressed
+func (c *TeleContext) Addressed() bool {
+	msg := c.ctx.Message()
+	if msg == nil || msg.Private() {
+		return true
+	}
+	if msg.ReplyTo != nil && msg.ReplyTo.Sender != nil && msg.ReplyTo.Sender.ID == c.bot.Me.ID {
+		return true
+	}
+	for _, e := range append(msg.Entities, msg.CaptionEntities...) {
+		if e.Type == tele.EntityMention && strings.EqualFold(msg.EntityText(e), "@"+c.bot.Me.Username) {
+			return true
+		}
+	}
+	return false
+}
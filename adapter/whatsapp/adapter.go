@@ -0,0 +1,304 @@
+package whatsapp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// sendTimeout 发送消息、上传文件等操作的超时时间
+const sendTimeout = time.Minute
+
+// WhatsAppAdapter 基于 whatsmeow 以关联设备的方式登录 WhatsApp。
+// 首次启动时在终端打印二维码，用手机 WhatsApp「关联设备」扫码登录，设备密钥和加密会话保存在 storage 中。
+type WhatsAppAdapter struct {
+	cfg    config.WhatsAppConfig
+	logger *slog.Logger
+	store  *sessionStore
+	client *whatsmeow.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	commandHandlers  map[string]core.Handler
+	callbackHandlers map[string]core.Handler
+	textHandler      core.Handler
+	documentHandler  core.Handler
+	photoHandler     core.Handler
+
+	// 按钮以编号列表发送，用户回复编号即视为点击
+	choiceMu sync.Mutex
+	choices  map[string]*pendingChoice
+}
+
+// pendingChoice 等待用户回复编号的按钮组
+type pendingChoice struct {
+	buttons []core.Button
+	expires time.Time
+}
+
+func init() {
+	core.RegisterAdapterFactory("whatsapp", func(ac *core.AdapterConfig, logger *slog.Logger) (core.Platform, error) {
+		cfg := ac.Config.WhatsApp
+		if err := ac.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		// 在 platforms 中列出即视为启用
+		if !cfg.Enabled && !ac.Listed {
+			return nil, nil
+		}
+		return New(cfg, ac.Storage, logger)
+	})
+}
+
+func New(cfg config.WhatsAppConfig, db *storage.Storage, logger *slog.Logger) (*WhatsAppAdapter, error) {
+	waLogger := &slogLogger{logger: logger.With("module", "whatsmeow")}
+	sessions := newSessionStore(db, waLogger.Sub("Store"))
+	device, err := sessions.Device()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &WhatsAppAdapter{
+		cfg:              cfg,
+		logger:           logger,
+		store:            sessions,
+		client:           whatsmeow.NewClient(device, waLogger.Sub("Client")),
+		ctx:              ctx,
+		cancel:           cancel,
+		commandHandlers:  make(map[string]core.Handler),
+		callbackHandlers: make(map[string]core.Handler),
+		choices:          make(map[string]*pendingChoice),
+	}
+	a.client.AddEventHandler(a.handleEvent)
+	logger.Info("WhatsApp adapter initialized", "logged_in", device.ID != nil)
+	return a, nil
+}
+
+func (a *WhatsAppAdapter) Name() string {
+	return "WhatsApp"
+}
+
+// Start 已登录时直接连接，否则在终端打印二维码等待扫码
+func (a *WhatsAppAdapter) Start() error {
+	a.logger.Info("Starting WhatsApp")
+	if a.client.Store.ID != nil {
+		return a.client.Connect()
+	}
+
+	qrChan, err := a.client.GetQRChannel(a.ctx)
+	if err != nil {
+		return err
+	}
+	if err := a.client.Connect(); err != nil {
+		return err
+	}
+	go func() {
+		for item := range qrChan {
+			switch item.Event {
+			case whatsmeow.QRChannelEventCode:
+				a.logger.Info("Scan the QR code with WhatsApp > Linked devices", "expires_in", item.Timeout)
+				qrterminal.GenerateHalfBlock(item.Code, qrterminal.L, os.Stderr)
+			case whatsmeow.QRChannelEventError:
+				a.logger.Error("WhatsApp pairing failed", "error", item.Error)
+			default:
+				a.logger.Info("WhatsApp login", "event", item.Event)
+			}
+		}
+	}()
+	return nil
+}
+
+func (a *WhatsAppAdapter) Stop() error {
+	a.cancel()
+	a.client.Disconnect()
+	return nil
+}
+
+func (a *WhatsAppAdapter) handleEvent(evt any) {
+	switch evt := evt.(type) {
+	case *events.Message:
+		// 每条消息在独立的 goroutine 中处理，避免阻塞 whatsmeow 的事件循环
+		go func() {
+			if err := a.dispatch(evt); err != nil {
+				a.logger.Error("WhatsApp handler error", "error", err, "request_id", core.ErrorRequestID(err))
+			}
+		}()
+	case *events.Connected:
+		a.logger.Info("WhatsApp connected", "jid", a.client.Store.GetJID())
+	case *events.PairSuccess:
+		a.logger.Info("WhatsApp paired", "jid", evt.ID, "platform", evt.Platform)
+	case *events.LoggedOut:
+		a.logger.Error("WhatsApp logged out, restart to scan the QR code again", "reason", evt.Reason)
+	}
+}
+
+func (a *WhatsAppAdapter) dispatch(evt *events.Message) error {
+	ctx := a.newContext(evt)
+	if ctx == nil {
+		return nil
+	}
+
+	if button, ok := a.takeChoice(ctx, strings.TrimSpace(ctx.text)); ok {
+		if handler, ok := a.callbackHandlers[button.Name]; ok {
+			ctx.callbackData = button.Data
+			return handler(ctx)
+		}
+	}
+
+	if ctx.photo != nil && a.photoHandler != nil {
+		return a.photoHandler(ctx)
+	}
+	if ctx.document != nil && a.documentHandler != nil {
+		return a.documentHandler(ctx)
+	}
+
+	if strings.HasPrefix(ctx.text, "/") {
+		if handler, ok := a.commandHandlers[strings.Fields(ctx.text)[0]]; ok {
+			return handler(ctx)
+		}
+	}
+
+	if a.textHandler != nil && ctx.text != "" {
+		return a.textHandler(ctx)
+	}
+	return nil
+}
+
+// choiceKey identifies the pending choice of a user in a chat
+func choiceKey(ctx *WhatsAppContext) string {
+	return ctx.Chat().ID + ":" + ctx.Sender().ID
+}
+
+// takeChoice resolves a numeric reply to a pending button group
+func (a *WhatsAppAdapter) takeChoice(ctx *WhatsAppContext, content string) (core.Button, bool) {
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return core.Button{}, false
+	}
+
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	key := choiceKey(ctx)
+	choice, ok := a.choices[key]
+	if !ok || time.Now().After(choice.expires) || n < 1 || n > len(choice.buttons) {
+		return core.Button{}, false
+	}
+	delete(a.choices, key)
+	return choice.buttons[n-1], true
+}
+
+func (a *WhatsAppAdapter) setChoice(ctx *WhatsAppContext, buttons []core.Button) {
+	a.choiceMu.Lock()
+	defer a.choiceMu.Unlock()
+
+	now := time.Now()
+	for key, choice := range a.choices {
+		if now.After(choice.expires) {
+			delete(a.choices, key)
+		}
+	}
+	a.choices[choiceKey(ctx)] = &pendingChoice{buttons: buttons, expires: now.Add(10 * time.Minute)}
+}
+
+// send 发送文本，群聊中 core.Mention 转为 @手机号 并附带提及列表
+func (a *WhatsAppAdapter) send(chat types.JID, text string) (types.MessageID, error) {
+	ctx, cancel := context.WithTimeout(a.ctx, sendTimeout)
+	defer cancel()
+	resp, err := a.client.SendMessage(ctx, chat, textMessage(text, chat.Server == types.GroupServer))
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (a *WhatsAppAdapter) RegisterCommand(cmd string, handler core.Handler) {
+	a.commandHandlers[cmd] = handler
+}
+
+func (a *WhatsAppAdapter) RegisterText(handler core.Handler) {
+	a.textHandler = handler
+}
+
+func (a *WhatsAppAdapter) RegisterDocument(handler core.Handler) {
+	a.documentHandler = handler
+}
+
+func (a *WhatsAppAdapter) RegisterPhoto(handler core.Handler) {
+	a.photoHandler = handler
+}
+
+func (a *WhatsAppAdapter) RegisterCallback(name string, handler core.Handler) {
+	a.callbackHandlers[name] = handler
+}
+
+// SendTo sends a message to a JID ("xxx@g.us" for groups) or a phone number
+func (a *WhatsAppAdapter) SendTo(recipient string, text string) error {
+	jid, err := parseRecipient(recipient)
+	if err != nil {
+		return err
+	}
+	_, err = a.send(jid, text)
+	return err
+}
+
+func parseRecipient(recipient string) (types.JID, error) {
+	if !strings.Contains(recipient, "@") {
+		recipient = strings.TrimPrefix(recipient, "+") + "@" + types.DefaultUserServer
+	}
+	jid, err := types.ParseJID(recipient)
+	if err != nil || jid.User == "" {
+		return types.JID{}, core.Permanent(fmt.Errorf("invalid whatsapp recipient: %s", recipient))
+	}
+	return jid, nil
+}
+
+// slogLogger 将 whatsmeow 的日志输出到 slog，Info 以下的细节按 Debug 记录
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Errorf(msg string, args ...any) { l.logger.Error(fmt.Sprintf(msg, args...)) }
+func (l *slogLogger) Warnf(msg string, args ...any)  { l.logger.Warn(fmt.Sprintf(msg, args...)) }
+func (l *slogLogger) Infof(msg string, args ...any)  { l.logger.Debug(fmt.Sprintf(msg, args...)) }
+func (l *slogLogger) Debugf(msg string, args ...any) { l.logger.Debug(fmt.Sprintf(msg, args...)) }
+
+func (l *slogLogger) Sub(module string) waLog.Logger {
+	return &slogLogger{logger: l.logger.With("sub", module)}
+}
+
+// textMessage 构造文本消息，group 为 true 时 core.Mention 转为真正的 @提及
+func textMessage(text string, group bool) *waE2E.Message {
+	var mentioned []string
+	rendered := core.RenderMentions(text, func(userID, name string) string {
+		if !group {
+			return core.MentionName(userID, name)
+		}
+		mentioned = append(mentioned, userID+"@"+types.DefaultUserServer)
+		return "@" + userID
+	})
+	if len(mentioned) == 0 {
+		return &waE2E.Message{Conversation: &rendered}
+	}
+	return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text:        &rendered,
+		ContextInfo: &waE2E.ContextInfo{MentionedJID: mentioned},
+	}}
+}
@@ -0,0 +1,325 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// contextInfo 返回消息的引用和提及信息
+func contextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// userJID 发送者的手机号 JID，LID 寻址的消息在已知手机号时使用手机号
+func userJID(src types.MessageSource) types.JID {
+	sender := src.Sender.ToNonAD()
+	if sender.Server == types.HiddenUserServer && src.SenderAlt.Server == types.DefaultUserServer {
+		return src.SenderAlt.ToNonAD()
+	}
+	return sender
+}
+
+// newContext 解析消息，群聊中默认只处理 @机器人、回复机器人的消息和指令，其余返回 nil
+func (a *WhatsAppAdapter) newContext(evt *events.Message) *WhatsAppContext {
+	info := evt.Info
+	if info.IsFromMe || evt.IsEdit || info.Chat == types.StatusBroadcastJID || info.Chat.IsBroadcastList() ||
+		info.Chat.Server == types.NewsletterServer || evt.Message == nil {
+		return nil
+	}
+
+	ctx := &WhatsAppContext{adapter: a, info: info, sender: userJID(info.MessageSource)}
+	msg := evt.Message
+	switch {
+	case msg.GetImageMessage() != nil:
+		img := msg.GetImageMessage()
+		ctx.text = img.GetCaption()
+		ctx.media = img
+		ctx.photo = &core.Document{ID: info.ID, Name: "image" + extension(img.GetMimetype(), ".jpg"), MIMEType: img.GetMimetype(), Size: int64(img.GetFileLength())}
+	case msg.GetDocumentMessage() != nil:
+		doc := msg.GetDocumentMessage()
+		ctx.text = doc.GetCaption()
+		ctx.media = doc
+		ctx.document = &core.Document{ID: info.ID, Name: doc.GetFileName(), MIMEType: doc.GetMimetype(), Size: int64(doc.GetFileLength())}
+	case msg.GetExtendedTextMessage() != nil:
+		ctx.text = msg.GetExtendedTextMessage().GetText()
+	default:
+		ctx.text = msg.GetConversation()
+	}
+
+	// 去掉对机器人的 @，判断是否提及或回复了机器人
+	self := []types.JID{a.client.Store.GetJID().ToNonAD(), a.client.Store.GetLID().ToNonAD()}
+	mentioned, repliedToSelf := false, false
+	if ci := contextInfo(msg); ci != nil {
+		for _, m := range ci.GetMentionedJID() {
+			jid, err := types.ParseJID(m)
+			if err != nil || !slices.Contains(self, jid.ToNonAD()) {
+				continue
+			}
+			mentioned = true
+			ctx.text = strings.ReplaceAll(ctx.text, "@"+jid.User, "")
+		}
+		if p, err := types.ParseJID(ci.GetParticipant()); err == nil && ci.GetStanzaID() != "" {
+			repliedToSelf = slices.Contains(self, p.ToNonAD())
+		}
+	}
+	ctx.text = strings.TrimSpace(ctx.text)
+
+	ctx.addressed = !info.IsGroup || mentioned || repliedToSelf
+	if !a.cfg.GroupAll && !ctx.addressed && !strings.HasPrefix(ctx.text, "/") {
+		return nil
+	}
+	return ctx
+}
+
+func extension(mimeType, fallback string) string {
+	if _, sub, ok := strings.Cut(mimeType, "/"); ok && sub != "" {
+		return "." + strings.TrimPrefix(sub, "x-")
+	}
+	return fallback
+}
+
+// WhatsAppContext 一条私聊或群消息
+type WhatsAppContext struct {
+	adapter      *WhatsAppAdapter
+	info         types.MessageInfo
+	sender       types.JID
+	text         string
+	media        whatsmeow.DownloadableMessage
+	document     *core.Document
+	photo        *core.Document
+	callbackData string
+	addressed    bool // 私聊，或群消息 @ 了机器人、回复了机器人的消息
+}
+
+// Addressed reports whether the message @-mentions or replies to the bot, see core.IsAddressed
+func (c *WhatsAppContext) Addressed() bool {
+	return c.addressed
+}
+
+// Sender 用户 ID 为手机号（带国家码），未知手机号时为 LID
+func (c *WhatsAppContext) Sender() *core.User {
+	return &core.User{ID: c.sender.User, Username: c.info.PushName}
+}
+
+// Chat ID 为会话的 JID，与 SendTo 的格式一致
+func (c *WhatsAppContext) Chat() *core.Chat {
+	chatType := "private"
+	if c.info.IsGroup {
+		chatType = "group"
+	}
+	return &core.Chat{ID: c.info.Chat.ToNonAD().String(), Type: chatType}
+}
+
+func (c *WhatsAppContext) Text() string {
+	return c.text
+}
+
+func (c *WhatsAppContext) Data() string {
+	return c.callbackData
+}
+
+func (c *WhatsAppContext) Document() *core.Document {
+	return c.document
+}
+
+func (c *WhatsAppContext) Photo() *core.Document {
+	return c.photo
+}
+
+// Download 下载并解密消息中的图片或文件
+func (c *WhatsAppContext) Download(doc *core.Document) (io.ReadCloser, error) {
+	if c.media == nil || doc.ID != c.info.ID {
+		return nil, fmt.Errorf("attachment not found: %s", doc.Name)
+	}
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	data, err := c.adapter.client.Download(ctx, c.media)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *WhatsAppContext) Reply(text string) error {
+	_, err := c.Send(text)
+	return err
+}
+
+func (c *WhatsAppContext) Send(text string) (core.Message, error) {
+	id, err := c.adapter.send(c.info.Chat, text)
+	if err != nil {
+		return nil, err
+	}
+	return &WhatsAppMessage{id: id}, nil
+}
+
+// Edit 编辑已发送的消息，WhatsApp 只允许编辑 20 分钟内的消息
+func (c *WhatsAppContext) Edit(msg core.Message, text string) error {
+	m, ok := msg.(*WhatsAppMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type for whatsapp")
+	}
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	edit := c.adapter.client.BuildEdit(c.info.Chat, m.id, textMessage(text, c.info.IsGroup))
+	_, err := c.adapter.client.SendMessage(ctx, c.info.Chat, edit)
+	return err
+}
+
+// Delete 撤回机器人发送的消息
+func (c *WhatsAppContext) Delete(msg core.Message) error {
+	m, ok := msg.(*WhatsAppMessage)
+	if !ok {
+		return fmt.Errorf("invalid message type for whatsapp")
+	}
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	_, err := c.adapter.client.SendMessage(ctx, c.info.Chat, c.adapter.client.BuildRevoke(c.info.Chat, types.EmptyJID, m.id))
+	return err
+}
+
+// SendFile 上传后以图片或文件消息发送
+func (c *WhatsAppContext) SendFile(file *core.File) error {
+	client := c.adapter.client
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+
+	mediaType := whatsmeow.MediaDocument
+	if file.IsImage() {
+		mediaType = whatsmeow.MediaImage
+	}
+	up, err := client.Upload(ctx, file.Data, mediaType)
+	if err != nil {
+		return err
+	}
+	mimeType := file.MIMEType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	msg := &waE2E.Message{}
+	if file.IsImage() {
+		msg.ImageMessage = &waE2E.ImageMessage{
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+			Mimetype:      proto.String(mimeType),
+			Caption:       proto.String(file.Caption),
+		}
+	} else {
+		msg.DocumentMessage = &waE2E.DocumentMessage{
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+			Mimetype:      proto.String(mimeType),
+			FileName:      proto.String(file.Name),
+			Title:         proto.String(file.Name),
+			Caption:       proto.String(file.Caption),
+		}
+	}
+	_, err = client.SendMessage(ctx, c.info.Chat, msg)
+	return err
+}
+
+// SendButtons 以编号列表发送按钮，用户回复编号即触发对应回调
+func (c *WhatsAppContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	var buttons []core.Button
+	var b strings.Builder
+	b.WriteString(text)
+	for _, row := range rows {
+		for _, button := range row {
+			buttons = append(buttons, button)
+			fmt.Fprintf(&b, "\n%d. %s", len(buttons), button.Text)
+		}
+	}
+	b.WriteString("\n\n回复编号选择")
+	msg, err := c.Send(b.String())
+	if err != nil {
+		return nil, err
+	}
+	c.adapter.setChoice(c, buttons)
+	return msg, nil
+}
+
+func (c *WhatsAppContext) React(emoji string) error {
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	reaction := c.adapter.client.BuildReaction(c.info.Chat, c.info.Sender, c.info.ID, emoji)
+	_, err := c.adapter.client.SendMessage(ctx, c.info.Chat, reaction)
+	return err
+}
+
+// Notify 显示「正在输入」，WhatsApp 会一直显示到发送消息或超时
+func (c *WhatsAppContext) Notify(action core.ChatAction) error {
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	return c.adapter.client.SendChatPresence(ctx, c.info.Chat, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+}
+
+// Member 查询群成员，私聊返回 ErrNotSupported
+func (c *WhatsAppContext) Member(userID string) (*core.Member, error) {
+	if !c.info.IsGroup {
+		return nil, core.ErrNotSupported
+	}
+	ctx, cancel := context.WithTimeout(c.adapter.ctx, sendTimeout)
+	defer cancel()
+	group, err := c.adapter.client.GetGroupInfo(ctx, c.info.Chat)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range group.Participants {
+		if p.JID.User != userID && p.PhoneNumber.User != userID && p.LID.User != userID {
+			continue
+		}
+		role := "member"
+		if p.IsSuperAdmin {
+			role = "superadmin"
+		} else if p.IsAdmin {
+			role = "admin"
+		}
+		name := p.DisplayName
+		if contact, err := c.adapter.store.GetContact(ctx, p.JID); err == nil && contact.PushName != "" {
+			name = contact.PushName
+		}
+		return &core.Member{User: core.User{ID: userID, Username: name}, Nickname: name, Roles: []string{role}}, nil
+	}
+	return nil, fmt.Errorf("member not found: %s", userID)
+}
+
+func (c *WhatsAppContext) Platform() string {
+	return "WhatsApp"
+}
+
+type WhatsAppMessage struct {
+	id types.MessageID
+}
+
+func (m *WhatsAppMessage) ID() string {
+	return m.id
+}
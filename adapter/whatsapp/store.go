@@ -0,0 +1,574 @@
+package whatsapp
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow/proto/waAdv"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/util/keys"
+	waLog "go.mau.fi/whatsmeow/util/log"
+
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// sessionStore 将 whatsmeow 的设备密钥、加密会话和预共享密钥保存在 storage 中（只支持一个账号）。
+// 联系人、消息密钥等非必需的数据不保存，由嵌入的 NoopStore 忽略。
+type sessionStore struct {
+	store.NoopStore
+	db  *storage.Storage
+	log waLog.Logger
+
+	preKeyMu sync.Mutex
+	// 推送名只保存在内存中，用作发送者的显示名
+	namesMu sync.Mutex
+	names   map[types.JID]string
+}
+
+var (
+	_ store.AllStores       = (*sessionStore)(nil)
+	_ store.DeviceContainer = (*sessionStore)(nil)
+)
+
+// key prefixes in storage.WhatsApp
+const (
+	keyDevice      = "device"
+	prefixIdentity = "identity/"
+	prefixSession  = "session/"
+	prefixPreKey   = "prekey/"
+	prefixSender   = "senderkey/"
+	prefixSyncKey  = "appstatekey/"
+	prefixAppState = "appstate/"
+	prefixMAC      = "appstatemac/"
+	prefixLID      = "lid/" // LID → 手机号
+	prefixPN       = "pn/"  // 手机号 → LID
+)
+
+func newSessionStore(db *storage.Storage, log waLog.Logger) *sessionStore {
+	return &sessionStore{db: db, log: log, names: make(map[types.JID]string)}
+}
+
+// deviceRecord 登录后需要保存的设备信息
+type deviceRecord struct {
+	ID                    string `json:"id"`
+	LID                   string `json:"lid,omitempty"`
+	RegistrationID        uint32 `json:"registration_id"`
+	NoiseKey              []byte `json:"noise_key"`
+	IdentityKey           []byte `json:"identity_key"`
+	SignedPreKey          []byte `json:"signed_pre_key"`
+	SignedPreKeyID        uint32 `json:"signed_pre_key_id"`
+	SignedPreKeySig       []byte `json:"signed_pre_key_sig"`
+	AdvSecretKey          []byte `json:"adv_key"`
+	AdvDetails            []byte `json:"adv_details"`
+	AdvAccountSig         []byte `json:"adv_account_sig"`
+	AdvAccountSigKey      []byte `json:"adv_account_sig_key"`
+	AdvDeviceSig          []byte `json:"adv_device_sig"`
+	Platform              string `json:"platform,omitempty"`
+	BusinessName          string `json:"business_name,omitempty"`
+	PushName              string `json:"push_name,omitempty"`
+	FacebookUUID          string `json:"facebook_uuid,omitempty"`
+	LIDMigrationTimestamp int64  `json:"lid_migration_ts,omitempty"`
+}
+
+// Device 返回已保存的设备，未登录时生成新设备（扫码登录成功后自动保存）
+func (s *sessionStore) Device() (*store.Device, error) {
+	data := s.db.WhatsAppGet(keyDevice)
+	if data == nil {
+		device := &store.Device{
+			Log:            s.log,
+			Container:      s,
+			NoiseKey:       keys.NewKeyPair(),
+			IdentityKey:    keys.NewKeyPair(),
+			RegistrationID: rand.Uint32(),
+			AdvSecretKey:   randomBytes(32),
+		}
+		device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+		return device, nil
+	}
+
+	var r deviceRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid whatsapp device: %w", err)
+	}
+	if len(r.NoiseKey) != 32 || len(r.IdentityKey) != 32 || len(r.SignedPreKey) != 32 || len(r.SignedPreKeySig) != 64 {
+		return nil, errors.New("invalid whatsapp device: bad key length")
+	}
+	id, err := types.ParseJID(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	lid, _ := types.ParseJID(r.LID)
+	device := &store.Device{
+		Log:            s.log,
+		NoiseKey:       keys.NewKeyPairFromPrivateKey([32]byte(r.NoiseKey)),
+		IdentityKey:    keys.NewKeyPairFromPrivateKey([32]byte(r.IdentityKey)),
+		SignedPreKey:   &keys.PreKey{KeyPair: *keys.NewKeyPairFromPrivateKey([32]byte(r.SignedPreKey)), KeyID: r.SignedPreKeyID, Signature: (*[64]byte)(r.SignedPreKeySig)},
+		RegistrationID: r.RegistrationID,
+		AdvSecretKey:   r.AdvSecretKey,
+		ID:             &id,
+		LID:            lid,
+		Account: &waAdv.ADVSignedDeviceIdentity{
+			Details:             r.AdvDetails,
+			AccountSignature:    r.AdvAccountSig,
+			AccountSignatureKey: r.AdvAccountSigKey,
+			DeviceSignature:     r.AdvDeviceSig,
+		},
+		Platform:              r.Platform,
+		BusinessName:          r.BusinessName,
+		PushName:              r.PushName,
+		LIDMigrationTimestamp: r.LIDMigrationTimestamp,
+	}
+	device.FacebookUUID, _ = uuid.Parse(r.FacebookUUID)
+	s.initialize(device)
+	return device, nil
+}
+
+func (s *sessionStore) initialize(device *store.Device) {
+	device.SetAllStores(s)
+	device.LIDs = s
+	device.Container = s
+	device.Initialized = true
+}
+
+func (s *sessionStore) PutDevice(ctx context.Context, device *store.Device) error {
+	if device.ID == nil {
+		return errors.New("device JID must be known before saving")
+	}
+	r := deviceRecord{
+		ID:                    device.ID.String(),
+		RegistrationID:        device.RegistrationID,
+		NoiseKey:              device.NoiseKey.Priv[:],
+		IdentityKey:           device.IdentityKey.Priv[:],
+		SignedPreKey:          device.SignedPreKey.Priv[:],
+		SignedPreKeyID:        device.SignedPreKey.KeyID,
+		SignedPreKeySig:       device.SignedPreKey.Signature[:],
+		AdvSecretKey:          device.AdvSecretKey,
+		Platform:              device.Platform,
+		BusinessName:          device.BusinessName,
+		PushName:              device.PushName,
+		LIDMigrationTimestamp: device.LIDMigrationTimestamp,
+	}
+	if !device.LID.IsEmpty() {
+		r.LID = device.LID.String()
+	}
+	if device.Account != nil {
+		r.AdvDetails = device.Account.Details
+		r.AdvAccountSig = device.Account.AccountSignature
+		r.AdvAccountSigKey = device.Account.AccountSignatureKey
+		r.AdvDeviceSig = device.Account.DeviceSignature
+	}
+	if device.FacebookUUID != uuid.Nil {
+		r.FacebookUUID = device.FacebookUUID.String()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WhatsAppPut(map[string][]byte{keyDevice: data}); err != nil {
+		return err
+	}
+	if !device.Initialized {
+		s.initialize(device)
+	}
+	return nil
+}
+
+// DeleteDevice 退出登录时清除所有会话数据
+func (s *sessionStore) DeleteDevice(ctx context.Context, device *store.Device) error {
+	return s.db.WhatsAppDeletePrefix("")
+}
+
+// deletePrefix 删除 prefix 开头的所有键
+func (s *sessionStore) deletePrefix(prefix string) error {
+	entries := make(map[string][]byte)
+	for _, key := range s.db.WhatsAppKeys(prefix) {
+		entries[key] = nil
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) put(key string, value []byte) error {
+	return s.db.WhatsAppPut(map[string][]byte{key: value})
+}
+
+// IdentityStore
+
+func (s *sessionStore) PutIdentity(ctx context.Context, address string, key [32]byte) error {
+	return s.put(prefixIdentity+address, key[:])
+}
+
+func (s *sessionStore) DeleteAllIdentities(ctx context.Context, phone string) error {
+	return s.deletePrefix(prefixIdentity + phone + ":")
+}
+
+func (s *sessionStore) DeleteIdentity(ctx context.Context, address string) error {
+	return s.put(prefixIdentity+address, nil)
+}
+
+func (s *sessionStore) IsTrustedIdentity(ctx context.Context, address string, key [32]byte) (bool, error) {
+	existing := s.db.WhatsAppGet(prefixIdentity + address)
+	if existing == nil {
+		// 未知的身份密钥视为可信，之后会自动保存
+		return true, nil
+	}
+	return string(existing) == string(key[:]), nil
+}
+
+// SessionStore
+
+func (s *sessionStore) GetSession(ctx context.Context, address string) ([]byte, error) {
+	return s.db.WhatsAppGet(prefixSession + address), nil
+}
+
+func (s *sessionStore) HasSession(ctx context.Context, address string) (bool, error) {
+	return s.db.WhatsAppGet(prefixSession+address) != nil, nil
+}
+
+func (s *sessionStore) GetManySessions(ctx context.Context, addresses []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(addresses))
+	for _, addr := range addresses {
+		result[addr] = s.db.WhatsAppGet(prefixSession + addr)
+	}
+	return result, nil
+}
+
+func (s *sessionStore) PutSession(ctx context.Context, address string, session []byte) error {
+	return s.put(prefixSession+address, session)
+}
+
+func (s *sessionStore) PutManySessions(ctx context.Context, sessions map[string][]byte) error {
+	entries := make(map[string][]byte, len(sessions))
+	for addr, session := range sessions {
+		entries[prefixSession+addr] = session
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) DeleteAllSessions(ctx context.Context, phone string) error {
+	return s.deletePrefix(prefixSession + phone + ":")
+}
+
+func (s *sessionStore) DeleteSession(ctx context.Context, address string) error {
+	return s.put(prefixSession+address, nil)
+}
+
+// MigratePNToLID 把以手机号为地址的会话、身份密钥和群发送密钥迁移到 LID 地址
+func (s *sessionStore) MigratePNToLID(ctx context.Context, pn, lid types.JID) error {
+	pnSignal, lidSignal := pn.SignalAddressUser()+":", lid.SignalAddressUser()+":"
+	entries := make(map[string][]byte)
+	for _, prefix := range []string{prefixSession, prefixIdentity} {
+		for _, key := range s.db.WhatsAppKeys(prefix + pnSignal) {
+			entries[prefix+lidSignal+strings.TrimPrefix(key, prefix+pnSignal)] = s.db.WhatsAppGet(key)
+			entries[key] = nil
+		}
+	}
+	for _, key := range s.db.WhatsAppKeys(prefixSender) {
+		group, user, ok := strings.Cut(strings.TrimPrefix(key, prefixSender), "/")
+		if ok && strings.HasPrefix(user, pnSignal) {
+			entries[prefixSender+group+"/"+lidSignal+strings.TrimPrefix(user, pnSignal)] = s.db.WhatsAppGet(key)
+			entries[key] = nil
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	s.log.Infof("Migrated %d signal entries from %s to %s", len(entries)/2, pn, lid)
+	return s.db.WhatsAppPut(entries)
+}
+
+// PreKeyStore，键名中的 ID 补零以便按顺序排列，值的最后一个字节表示是否已上传
+
+func preKeyName(id uint32) string {
+	return fmt.Sprintf("%s%010d", prefixPreKey, id)
+}
+
+func (s *sessionStore) nextPreKeyID() uint32 {
+	ids := s.db.WhatsAppKeys(prefixPreKey)
+	if len(ids) == 0 {
+		return 1
+	}
+	last, _ := strconv.ParseUint(strings.TrimPrefix(ids[len(ids)-1], prefixPreKey), 10, 32)
+	return uint32(last) + 1
+}
+
+func (s *sessionStore) GenOnePreKey(ctx context.Context) (*keys.PreKey, error) {
+	s.preKeyMu.Lock()
+	defer s.preKeyMu.Unlock()
+	key := keys.NewPreKey(s.nextPreKeyID())
+	return key, s.put(preKeyName(key.KeyID), append(key.Priv[:], 1))
+}
+
+func (s *sessionStore) GetOrGenPreKeys(ctx context.Context, count uint32) ([]*keys.PreKey, error) {
+	s.preKeyMu.Lock()
+	defer s.preKeyMu.Unlock()
+
+	var result []*keys.PreKey
+	for _, name := range s.db.WhatsAppKeys(prefixPreKey) {
+		if uint32(len(result)) == count {
+			break
+		}
+		if data := s.db.WhatsAppGet(name); len(data) == 33 && data[32] == 0 {
+			id, _ := strconv.ParseUint(strings.TrimPrefix(name, prefixPreKey), 10, 32)
+			result = append(result, &keys.PreKey{KeyPair: *keys.NewKeyPairFromPrivateKey([32]byte(data[:32])), KeyID: uint32(id)})
+		}
+	}
+	entries := make(map[string][]byte)
+	next := s.nextPreKeyID()
+	for uint32(len(result)) < count {
+		key := keys.NewPreKey(next)
+		entries[preKeyName(next)] = append(key.Priv[:], 0)
+		result = append(result, key)
+		next++
+	}
+	if len(entries) > 0 {
+		if err := s.db.WhatsAppPut(entries); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *sessionStore) GetPreKey(ctx context.Context, id uint32) (*keys.PreKey, error) {
+	data := s.db.WhatsAppGet(preKeyName(id))
+	if len(data) != 33 {
+		return nil, nil
+	}
+	return &keys.PreKey{KeyPair: *keys.NewKeyPairFromPrivateKey([32]byte(data[:32])), KeyID: id}, nil
+}
+
+func (s *sessionStore) RemovePreKey(ctx context.Context, id uint32) error {
+	return s.put(preKeyName(id), nil)
+}
+
+func (s *sessionStore) MarkPreKeysAsUploaded(ctx context.Context, upToID uint32) error {
+	entries := make(map[string][]byte)
+	for _, name := range s.db.WhatsAppKeys(prefixPreKey) {
+		id, _ := strconv.ParseUint(strings.TrimPrefix(name, prefixPreKey), 10, 32)
+		if data := s.db.WhatsAppGet(name); uint32(id) <= upToID && len(data) == 33 && data[32] == 0 {
+			data[32] = 1
+			entries[name] = data
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) UploadedPreKeyCount(ctx context.Context) (int, error) {
+	count := 0
+	for _, name := range s.db.WhatsAppKeys(prefixPreKey) {
+		if data := s.db.WhatsAppGet(name); len(data) == 33 && data[32] == 1 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// SenderKeyStore
+
+func (s *sessionStore) PutSenderKey(ctx context.Context, group, user string, session []byte) error {
+	return s.put(prefixSender+group+"/"+user, session)
+}
+
+func (s *sessionStore) GetSenderKey(ctx context.Context, group, user string) ([]byte, error) {
+	return s.db.WhatsAppGet(prefixSender + group + "/" + user), nil
+}
+
+// AppStateSyncKeyStore
+
+func (s *sessionStore) PutAppStateSyncKey(ctx context.Context, id []byte, key store.AppStateSyncKey) error {
+	name := prefixSyncKey + hex.EncodeToString(id)
+	if existing, _ := s.GetAppStateSyncKey(ctx, id); existing != nil && existing.Timestamp >= key.Timestamp {
+		return nil
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.put(name, data)
+}
+
+func (s *sessionStore) GetAppStateSyncKey(ctx context.Context, id []byte) (*store.AppStateSyncKey, error) {
+	data := s.db.WhatsAppGet(prefixSyncKey + hex.EncodeToString(id))
+	if data == nil {
+		return nil, nil
+	}
+	var key store.AppStateSyncKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *sessionStore) GetLatestAppStateSyncKeyID(ctx context.Context) ([]byte, error) {
+	var latest []byte
+	var latestTS int64
+	for _, name := range s.db.WhatsAppKeys(prefixSyncKey) {
+		id, err := hex.DecodeString(strings.TrimPrefix(name, prefixSyncKey))
+		if err != nil {
+			continue
+		}
+		if key, _ := s.GetAppStateSyncKey(ctx, id); key != nil && (latest == nil || key.Timestamp > latestTS) {
+			latest, latestTS = id, key.Timestamp
+		}
+	}
+	return latest, nil
+}
+
+func (s *sessionStore) GetAllAppStateSyncKeys(ctx context.Context) ([]*store.AppStateSyncKey, error) {
+	var result []*store.AppStateSyncKey
+	for _, name := range s.db.WhatsAppKeys(prefixSyncKey) {
+		var key store.AppStateSyncKey
+		if json.Unmarshal(s.db.WhatsAppGet(name), &key) == nil {
+			result = append(result, &key)
+		}
+	}
+	return result, nil
+}
+
+// AppStateStore，版本号（8 字节）后接 128 字节的哈希
+
+func (s *sessionStore) PutAppStateVersion(ctx context.Context, name string, version uint64, hash [128]byte) error {
+	data := binary.BigEndian.AppendUint64(nil, version)
+	return s.put(prefixAppState+name, append(data, hash[:]...))
+}
+
+func (s *sessionStore) GetAppStateVersion(ctx context.Context, name string) (uint64, [128]byte, error) {
+	data := s.db.WhatsAppGet(prefixAppState + name)
+	if len(data) != 8+128 {
+		// 版本 0 和空哈希是初始状态
+		return 0, [128]byte{}, nil
+	}
+	return binary.BigEndian.Uint64(data), [128]byte(data[8:]), nil
+}
+
+func (s *sessionStore) DeleteAppStateVersion(ctx context.Context, name string) error {
+	return s.put(prefixAppState+name, nil)
+}
+
+func (s *sessionStore) PutAppStateMutationMACs(ctx context.Context, name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	entries := make(map[string][]byte, len(mutations))
+	for _, m := range mutations {
+		entries[prefixMAC+name+"/"+hex.EncodeToString(m.IndexMAC)] = m.ValueMAC
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) DeleteAppStateMutationMACs(ctx context.Context, name string, indexMACs [][]byte) error {
+	if len(indexMACs) == 0 {
+		return nil
+	}
+	entries := make(map[string][]byte, len(indexMACs))
+	for _, mac := range indexMACs {
+		entries[prefixMAC+name+"/"+hex.EncodeToString(mac)] = nil
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) GetAppStateMutationMAC(ctx context.Context, name string, indexMAC []byte) ([]byte, error) {
+	return s.db.WhatsAppGet(prefixMAC + name + "/" + hex.EncodeToString(indexMAC)), nil
+}
+
+// ContactStore，只记录推送名
+
+func (s *sessionStore) PutPushName(ctx context.Context, user types.JID, pushName string) (bool, string, error) {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	previous := s.names[user]
+	if previous == pushName {
+		return false, "", nil
+	}
+	s.names[user] = pushName
+	return true, previous, nil
+}
+
+func (s *sessionStore) GetContact(ctx context.Context, user types.JID) (types.ContactInfo, error) {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	name, ok := s.names[user]
+	return types.ContactInfo{Found: ok, PushName: name}, nil
+}
+
+// LIDStore
+
+func (s *sessionStore) PutLIDMapping(ctx context.Context, lid, pn types.JID) error {
+	return s.PutManyLIDMappings(ctx, []store.LIDMapping{{LID: lid, PN: pn}})
+}
+
+func (s *sessionStore) PutManyLIDMappings(ctx context.Context, mappings []store.LIDMapping) error {
+	entries := make(map[string][]byte)
+	for _, m := range mappings {
+		if m.LID.Server != types.HiddenUserServer || m.PN.Server != types.DefaultUserServer {
+			continue
+		}
+		if string(s.db.WhatsAppGet(prefixPN+m.PN.User)) == m.LID.User {
+			continue
+		}
+		// 手机号对应的旧 LID 不再有效
+		if old := s.db.WhatsAppGet(prefixPN + m.PN.User); old != nil {
+			entries[prefixLID+string(old)] = nil
+		}
+		entries[prefixPN+m.PN.User] = []byte(m.LID.User)
+		entries[prefixLID+m.LID.User] = []byte(m.PN.User)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.WhatsAppPut(entries)
+}
+
+func (s *sessionStore) GetLIDForPN(ctx context.Context, pn types.JID) (types.JID, error) {
+	if pn.Server != types.DefaultUserServer {
+		return types.JID{}, fmt.Errorf("invalid GetLIDForPN call with non-PN JID %s", pn)
+	}
+	lid := s.db.WhatsAppGet(prefixPN + pn.User)
+	if lid == nil {
+		return types.JID{}, nil
+	}
+	return types.JID{User: string(lid), Device: pn.Device, Server: types.HiddenUserServer}, nil
+}
+
+func (s *sessionStore) GetPNForLID(ctx context.Context, lid types.JID) (types.JID, error) {
+	if lid.Server != types.HiddenUserServer {
+		return types.JID{}, fmt.Errorf("invalid GetPNForLID call with non-LID JID %s", lid)
+	}
+	pn := s.db.WhatsAppGet(prefixLID + lid.User)
+	if pn == nil {
+		return types.JID{}, nil
+	}
+	return types.JID{User: string(pn), Device: lid.Device, Server: types.DefaultUserServer}, nil
+}
+
+func (s *sessionStore) GetManyLIDsForPNs(ctx context.Context, pns []types.JID) (map[types.JID]types.JID, error) {
+	result := make(map[types.JID]types.JID, len(pns))
+	for _, pn := range pns {
+		if lid, err := s.GetLIDForPN(ctx, pn); err == nil && !lid.IsEmpty() {
+			result[pn] = lid
+		}
+	}
+	return result, nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = cryptorand.Read(b)
+	return b
+}
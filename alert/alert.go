@@ -0,0 +1,357 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+type Severity int
+
+const (
+	Warning  Severity = iota // 只记录日志
+	Error                    // 私信主管理员
+	Critical                 // 通知所有管理员 + Webhook
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "critical"
+	}
+}
+
+// maxReminders critical 告警未确认时最多重复提醒的次数
+const maxReminders = 3
+
+// Alert is an open (unacknowledged) alert
+type Alert struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"` // Occurrences within the dedup window
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	severity   Severity
+	notifiedAt time.Time
+	reminders  int
+}
+
+// Manager routes alerts by severity, deduplicates repeats and escalates unacknowledged ones
+type Manager struct {
+	mu      sync.Mutex
+	cfg     config.AlertConfig
+	targets []string
+	sendTo  func(recipient, text string) error
+	logger  *slog.Logger
+	client  *http.Client
+	// cancel 停止 escalateLoop
+	cancel context.CancelFunc
+
+	seq    int
+	open   map[string]*Alert // by ID
+	byKey  map[string]*Alert
+	lastOK map[string]time.Time // Key -> time of last acknowledged/sent alert, for dedup after ack
+}
+
+// New creates an alert manager. admins is used as targets when cfg.Targets is empty.
+func New(cfg config.AlertConfig, admins []string, sendTo func(recipient, text string) error, logger *slog.Logger) *Manager {
+	targets := cfg.Targets
+	if len(targets) == 0 {
+		targets = adminTargets(admins)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		cancel:  cancel,
+		cfg:     cfg,
+		targets: targets,
+		sendTo:  sendTo,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		open:    make(map[string]*Alert),
+		byKey:   make(map[string]*Alert),
+		lastOK:  make(map[string]time.Time),
+	}
+	go m.escalateLoop(ctx)
+	return m
+}
+
+// Close 停止告警升级和重复提醒
+func (m *Manager) Close() {
+	if m != nil {
+		m.cancel()
+	}
+}
+
+// adminTargets converts admin IDs ("Platform:UserID") to private message targets
+func adminTargets(admins []string) []string {
+	var targets []string
+	for _, admin := range admins {
+		platform, id, ok := strings.Cut(admin, ":")
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(platform, "qq") {
+			targets = append(targets, platform+":User:"+id)
+		} else {
+			targets = append(targets, admin)
+		}
+	}
+	return targets
+}
+
+func (m *Manager) Warn(key, message string)     { m.Raise(Warning, key, message) }
+func (m *Manager) Error(key, message string)    { m.Raise(Error, key, message) }
+func (m *Manager) Critical(key, message string) { m.Raise(Critical, key, message) }
+
+// Raise records an alert. Alerts with the same key within the dedup window are merged.
+func (m *Manager) Raise(severity Severity, key, message string) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+
+	m.mu.Lock()
+	if a, ok := m.byKey[key]; ok {
+		a.Count++
+		a.LastSeen = now
+		a.Message = message
+		// 升级到更高的级别时立即重新通知
+		if severity <= a.severity {
+			m.mu.Unlock()
+			return
+		}
+		a.severity = severity
+		a.Severity = severity.String()
+		a.notifiedAt = now
+		snapshot := *a
+		m.mu.Unlock()
+		m.notify(snapshot, severity)
+		return
+	}
+	if last, ok := m.lastOK[key]; ok && now.Sub(last) < m.cfg.DedupWindow {
+		m.mu.Unlock()
+		m.logger.Debug("Alert suppressed by dedup window", "key", key)
+		return
+	}
+
+	m.seq++
+	a := &Alert{
+		ID:         fmt.Sprintf("a%d", m.seq),
+		Key:        key,
+		Severity:   severity.String(),
+		Message:    message,
+		Count:      1,
+		FirstSeen:  now,
+		LastSeen:   now,
+		severity:   severity,
+		notifiedAt: now,
+	}
+	// warning 只记录日志，不需要确认
+	if severity > Warning {
+		m.open[a.ID] = a
+		m.byKey[key] = a
+	} else {
+		m.lastOK[key] = now
+	}
+	snapshot := *a
+	m.mu.Unlock()
+
+	m.notify(snapshot, severity)
+}
+
+// notify delivers the alert according to the routing of severity.
+// a is a copy taken under m.mu, the caller has already updated notifiedAt
+func (m *Manager) notify(a Alert, severity Severity) {
+	m.logger.Log(context.Background(), logLevel(severity), "Alert", "id", a.ID, "key", a.Key, "severity", severity, "message", a.Message)
+
+	text := fmt.Sprintf("%s [%s] %s\n%s\n\n回复 /ack %s 确认", severityIcon(severity), a.ID, a.Key, a.Message, a.ID)
+	switch severity {
+	case Warning:
+		return
+	case Error:
+		if len(m.targets) > 0 {
+			m.send(m.targets[0], text)
+		}
+	case Critical:
+		for _, target := range m.targets {
+			m.send(target, text)
+		}
+		m.postWebhook(a)
+	}
+}
+
+func (m *Manager) send(target, text string) {
+	if m.sendTo == nil {
+		return
+	}
+	if err := m.sendTo(target, text); err != nil {
+		m.logger.Error("Failed to deliver alert", "target", target, "error", err)
+	}
+}
+
+func (m *Manager) postWebhook(a Alert) {
+	if m.cfg.Webhook == "" {
+		return
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	resp, err := m.client.Post(m.cfg.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		m.logger.Error("Failed to post alert webhook", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		m.logger.Error("Alert webhook returned error", "status", resp.StatusCode)
+	}
+}
+
+// Ack acknowledges an alert by ID, or all open alerts when id is empty. Returns the number acknowledged.
+func (m *Manager) Ack(id string) int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	acked := 0
+	for alertID, a := range m.open {
+		if id != "" && alertID != id {
+			continue
+		}
+		delete(m.open, alertID)
+		delete(m.byKey, a.Key)
+		m.lastOK[a.Key] = now
+		acked++
+	}
+	return acked
+}
+
+// Resolve closes the open alert with key and tells the same targets that the problem is gone.
+// If the alert was already acknowledged, the primary target is told.
+func (m *Manager) Resolve(key, message string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	severity := Error
+	id := ""
+	if a, ok := m.byKey[key]; ok {
+		severity, id = a.severity, a.ID
+		delete(m.open, a.ID)
+		delete(m.byKey, key)
+	}
+	m.mu.Unlock()
+
+	m.logger.Info("Alert resolved", "id", id, "key", key, "message", message)
+	text := fmt.Sprintf("✅ %s\n%s", key, message)
+	if id != "" {
+		text = fmt.Sprintf("✅ [%s] %s\n%s", id, key, message)
+	}
+	switch {
+	case severity == Critical:
+		for _, target := range m.targets {
+			m.send(target, text)
+		}
+	case len(m.targets) > 0:
+		m.send(m.targets[0], text)
+	}
+}
+
+// Open returns the unacknowledged alerts, oldest first
+func (m *Manager) Open() []Alert {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Alert, 0, len(m.open))
+	for _, a := range m.open {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FirstSeen.Before(list[j].FirstSeen)
+	})
+	return list
+}
+
+// escalateLoop escalates error alerts to critical and repeats critical ones while unacknowledged, until ctx is done
+func (m *Manager) escalateLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var due []Alert
+		now := time.Now()
+		m.mu.Lock()
+		for key, last := range m.lastOK {
+			if time.Since(last) > m.cfg.DedupWindow {
+				delete(m.lastOK, key)
+			}
+		}
+		for _, a := range m.open {
+			if time.Since(a.notifiedAt) < m.cfg.EscalateAfter {
+				continue
+			}
+			if a.severity == Critical && a.reminders >= maxReminders {
+				continue
+			}
+			if a.severity == Critical {
+				a.reminders++
+			}
+			a.severity = Critical
+			a.Severity = Critical.String()
+			a.notifiedAt = now
+			due = append(due, *a)
+		}
+		m.mu.Unlock()
+
+		for _, a := range due {
+			m.logger.Warn("Escalating unacknowledged alert", "id", a.ID, "key", a.Key)
+			m.notify(a, Critical)
+		}
+	}
+}
+
+func logLevel(s Severity) slog.Level {
+	if s == Warning {
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+func severityIcon(s Severity) string {
+	switch s {
+	case Warning:
+		return "⚠️"
+	case Error:
+		return "❗"
+	default:
+		return "🚨"
+	}
+}
@@ -0,0 +1,58 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// mentionRegex 匹配文本中的 @用户名
+var mentionRegex = regexp.MustCompile(`@[A-Za-z0-9_]{3,}`)
+
+// Anonymizer 将用户 ID 替换为稳定的哈希、去掉用户名，用于公开分享会话快照（含审计记录）和消息日志。
+// 相同的 salt 下同一个 ID 总是得到相同的哈希，便于在多份导出之间关联同一用户。
+type Anonymizer struct {
+	salt []byte
+}
+
+// New creates an anonymizer. An empty salt uses a random one, hashes are then only stable within the process.
+func New(salt string) *Anonymizer {
+	if salt != "" {
+		return &Anonymizer{salt: []byte(salt)}
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return &Anonymizer{salt: b}
+}
+
+// ID returns the pseudonym of a user or chat ID, e.g. "u_3f2a9c01d4e5"
+func (a *Anonymizer) ID(id string) string {
+	if id == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(id))
+	return "u_" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// Key anonymizes a storage key such as "Telegram:123" or "QQ:Group:456", keeping the platform and kind
+func (a *Anonymizer) Key(key string) string {
+	i := strings.LastIndex(key, ":")
+	if i < 0 {
+		return a.ID(key)
+	}
+	return key[:i+1] + a.ID(key[i+1:])
+}
+
+// Text replaces the given IDs in text with their pseudonyms and strips @mentions
+func (a *Anonymizer) Text(text string, ids ...string) string {
+	for _, id := range ids {
+		if id != "" {
+			text = strings.ReplaceAll(text, id, a.ID(id))
+		}
+	}
+	return mentionRegex.ReplaceAllString(text, "@[user]")
+}
@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// timeFormat 备份文件名中的时间戳，按字典序即按时间排序
+const timeFormat = "20060102-150405"
+
+// Backup 一份本地备份
+type Backup struct {
+	Name string
+	Size int64
+	Time time.Time
+}
+
+// Result 一次备份的结果
+type Result struct {
+	Backup
+	Uploaded string // 上传到对象存储的 key，未配置 S3 时为空
+	Removed  int    // 轮换删除的旧备份数
+}
+
+// Manager 将存储写成带时间戳的副本（如 backups/storage-20260102-030405.json），
+// 只保留最近 cfg.Keep 份，配置了 S3 时同时上传
+type Manager struct {
+	cfg    config.BackupConfig
+	store  *storage.Storage
+	logger *slog.Logger
+	client *http.Client
+	// prefix 备份文件名前缀，取自存储文件名，多租户的备份可以放在同一目录
+	prefix string
+}
+
+func New(cfg config.BackupConfig, store *storage.Storage, logger *slog.Logger) *Manager {
+	base := filepath.Base(store.Path())
+	return &Manager{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		client: &http.Client{Timeout: 2 * time.Minute},
+		prefix: strings.TrimSuffix(base, filepath.Ext(base)) + "-",
+	}
+}
+
+// Run writes a snapshot, removes the oldest local backups and uploads the snapshot if S3 is configured.
+// A failed upload is returned as an error, the local backup is kept
+func (m *Manager) Run(ctx context.Context) (Result, error) {
+	data, err := m.store.Snapshot()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := os.MkdirAll(m.cfg.Dir, 0o755); err != nil {
+		return Result{}, err
+	}
+	now := time.Now()
+	name := m.prefix + now.Format(timeFormat) + ".json"
+	// 先写临时文件再改名，避免留下不完整的备份
+	path := filepath.Join(m.cfg.Dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return Result{}, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return Result{}, err
+	}
+	result := Result{Backup: Backup{Name: name, Size: int64(len(data)), Time: now}}
+
+	if result.Removed, err = m.rotate(); err != nil {
+		m.logger.Warn("Failed to remove old backups", "error", err)
+	}
+	if m.cfg.S3.Endpoint != "" {
+		key := m.cfg.S3.Prefix + name
+		if err := putObject(ctx, m.client, m.cfg.S3, key, data); err != nil {
+			return result, fmt.Errorf("upload %s: %w", key, err)
+		}
+		result.Uploaded = key
+	}
+	m.logger.Info("Storage backed up", "file", path, "size", result.Size, "removed", result.Removed, "uploaded", result.Uploaded)
+	return result, nil
+}
+
+// List returns the local backups, newest first
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), m.prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(timeFormat, strings.TrimSuffix(stamp, ".json"), time.Local)
+		if err != nil || !strings.HasSuffix(stamp, ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Name: e.Name(), Size: info.Size(), Time: t})
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return strings.Compare(b.Name, a.Name) })
+	return backups, nil
+}
+
+// rotate removes the local backups beyond cfg.Keep, it returns the number removed
+func (m *Manager) rotate() (int, error) {
+	backups, err := m.List()
+	if err != nil || len(backups) <= m.cfg.Keep {
+		return 0, err
+	}
+	removed := 0
+	for _, b := range backups[m.cfg.Keep:] {
+		if err := os.Remove(filepath.Join(m.cfg.Dir, b.Name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -1,37 +1,550 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path"
 	"strings"
 	"time"
 
+	"github.com/lhpqaq/ggbot/i18n"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Bot BotConfig `yaml:"bot"`
-	AI  AIConfig  `yaml:"ai"`
+	// 启用的平台及启动顺序，为空时按是否填写了凭据决定启用哪些平台
+	Platforms []PlatformConfig `yaml:"platforms"`
+	// 第三方适配器的配置段，key 为适配器名，内置适配器使用各自的顶层配置段
+	Adapters map[string]yaml.Node `yaml:"adapters"`
+	// 个人 QQ 号（OneBot v11 协议端）
+	OneBot OneBotConfig `yaml:"onebot"`
+	// 邮件（IMAP 收信，SMTP 回复）
+	Email EmailConfig `yaml:"email"`
+	// WhatsApp（关联设备扫码登录）
+	WhatsApp WhatsAppConfig `yaml:"whatsapp"`
+	AI       AIConfig       `yaml:"ai"`
 	// Legacy: mixed list
 	AllowedUsers []string `yaml:"allowed_users"`
 
 	// Platform specific lists
 	AllowedTelegram []string `yaml:"allowed_telegram"`
 	AllowedQQ       []string `yaml:"allowed_qq"`
+	AllowedOneBot   []string `yaml:"allowed_onebot"`   // 个人 QQ 号可以加任意群，为空时只使用 allowed_users
+	AllowedEmail    []string `yaml:"allowed_email"`    // 发件地址，不区分大小写
+	AllowedWhatsApp []string `yaml:"allowed_whatsapp"` // 手机号，带国家码、不带 +，如 "8613800000000"
+
+	// 管理员列表，格式 "Platform:UserID"
+	Admins []string `yaml:"admins"`
 
 	// Proxy Configuration
 	Proxy ProxyConfig `yaml:"proxy"`
 
 	// MCP Configuration
 	MCPServers map[string]MCPConfig `yaml:"mcpServers"`
+	// MCPConnect 何时连接 MCP 服务："background"（默认，启动后在后台连接，不阻塞启动）、
+	// "lazy"（首次使用工具时连接）或 "startup"（启动时连接完成后再继续）
+	MCPConnect string `yaml:"mcp_connect"`
+
+	// 通过 HTTP 接口实现的自定义工具，key 为工具名
+	ToolWebhooks map[string]ToolWebhookConfig `yaml:"tool_webhooks"`
+
+	// 执行前需要用户确认的工具名通配符（对所有工具生效），如 "*delete*"
+	ConfirmTools []string `yaml:"confirm_tools"`
 
 	// Push Configuration
 	Push PushConfig `yaml:"push"`
 
+	// 推送的安静时段：定时推送和 Webhook 消息在安静时段内推迟到时段结束后发送，或直接丢弃
+	QuietHours []QuietHoursRule `yaml:"quiet_hours"`
+
+	// 推送发送失败后的重试
+	Outbox OutboxConfig `yaml:"outbox"`
+
+	// 推送提示词、Webhook 模板和 /broadcast 消息中的模板变量
+	Templates TemplatesConfig `yaml:"templates"`
+
 	// Platform specific prompts
 	PlatformPrompts map[string]string `yaml:"platform_prompts"`
 
 	// 女朋友定制配置
 	Girlfriend map[string]GirlfriendConfig `yaml:"girlfriend"`
+
+	// 可选人设，用户可在 /start 引导中选择
+	Personas map[string]PersonaConfig `yaml:"personas"`
+
+	// 大文件分块处理配置
+	Transcript TranscriptConfig `yaml:"transcript"`
+
+	// 告警配置
+	Alerts AlertConfig `yaml:"alerts"`
+
+	// 代码块/公式渲染为图片
+	Render RenderConfig `yaml:"render"`
+
+	// 知识库 (RAG)
+	Knowledge KnowledgeConfig `yaml:"knowledge"`
+
+	// 语义缓存
+	SemanticCache SemanticCacheConfig `yaml:"semantic_cache"`
+
+	// 相同模型请求的结果缓存
+	ResponseCache ResponseCacheConfig `yaml:"response_cache"`
+
+	// 过长的工具结果截断或总结后再交给模型
+	ToolOutput ToolOutputConfig `yaml:"tool_output"`
+
+	// 工具调用循环的限制
+	ToolLoop ToolLoopConfig `yaml:"tool_loop"`
+
+	// 群聊每日总结（需要 history_log）
+	Summary SummaryConfig `yaml:"summary"`
+
+	// /news 新闻摘要
+	News NewsConfig `yaml:"news"`
+
+	// 长期记忆（/remember、/memories）
+	Memory MemoryConfig `yaml:"memory"`
+
+	// RSS/Atom 订阅
+	Feeds FeedsConfig `yaml:"feeds"`
+
+	// 群组游戏（知识问答、成语接龙）
+	Game GameConfig `yaml:"game"`
+
+	// 新成员入群欢迎
+	Welcome WelcomeConfig `yaml:"welcome"`
+
+	// 演示模式
+	Demo DemoConfig `yaml:"demo"`
+
+	// 内置搜索工具，无需 MCP 服务
+	Search SearchConfig `yaml:"search"`
+
+	// 每日用量限制
+	Limits LimitsConfig `yaml:"limits"`
+
+	// 指令冷却：key 为指令名（如 "/news"），同一用户在同一会话中冷却时间内重复发送相同的指令时回复上次的结果，管理员不受限制
+	Cooldowns map[string]time.Duration `yaml:"cooldowns"`
+
+	// 付费购买 AI 额度（Telegram Stars）
+	Payments PaymentsConfig `yaml:"payments"`
+
+	// 消息路由表，按顺序匹配，决定消息由哪些插件处理
+	Routes []RouteConfig `yaml:"routes"`
+
+	// 意图路由：把自然语言消息交给对应的指令，而不是普通对话
+	Intents IntentsConfig `yaml:"intents"`
+
+	// 其他机器人消息的处理策略
+	Bots BotsConfig `yaml:"bots"`
+
+	// 以 MCP 服务的形式对外提供发消息等能力
+	MCPServer MCPServerConfig `yaml:"mcp_server"`
+
+	// 用户对 AI 回答的评价
+	Feedback FeedbackConfig `yaml:"feedback"`
+
+	// 通用 Webhook 转消息
+	Hooks HooksConfig `yaml:"hooks"`
+
+	// GitHub Webhook 通知
+	GitHub GitHubConfig `yaml:"github"`
+
+	// A/B 提示词实验
+	Experiment ExperimentConfig `yaml:"experiment"`
+
+	// /selftest 自检
+	SelfTest SelfTestConfig `yaml:"selftest"`
+
+	// 导出会话快照和消息日志时的匿名化配置
+	Anonymize AnonymizeConfig `yaml:"anonymize"`
+
+	// 消息日志（/history）
+	HistoryLog HistoryLogConfig `yaml:"history_log"`
+
+	// 存储文件定期备份
+	Backup BackupConfig `yaml:"backup"`
+
+	// OpenTelemetry 链路追踪
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// 多租户：一个进程为多个相互隔离的租户提供服务，key 为租户名。
+	// 配置后主配置文件只使用 bot.log_level，其余配置来自各租户的配置文件。
+	Tenants map[string]TenantConfig `yaml:"tenants"`
+
+	// 合并到本文件之上的其他配置文件，路径相对于本文件所在目录，后面的覆盖前面的
+	Include []string `yaml:"include"`
+
+	// 配置文件中无法识别的键，由 Validate 报告
+	unknownKeys []string
+}
+
+// TenantConfig 租户有独立的配置文件（平台凭据、白名单、AI Key、人设等）和存储文件
+type TenantConfig struct {
+	Config  string `yaml:"config"`  // 租户配置文件路径，格式与 config.yaml 相同
+	Storage string `yaml:"storage"` // 存储文件路径，默认 "storage-<租户名>.json"
+}
+
+// FeedbackConfig 收集用户对 AI 回答的 👍/👎 评价，管理员可在 /stats 中按模型和人设查看满意度
+type FeedbackConfig struct {
+	Buttons bool          `yaml:"buttons"` // 在回答后附带 👍/👎 按钮（支持按钮的平台，如 Telegram）
+	Emoji   bool          `yaml:"emoji"`   // 将单独发送的 👍/👎 视为对上一个回答的评价
+	Window  time.Duration `yaml:"window"`  // emoji 评价的有效时间，默认 10m
+}
+
+// HooksConfig 通用入站 Webhook：外部系统（Grafana、Alertmanager、cron 任务等）POST 到 /hook/<名称>，
+// 按模板格式化后发送到该 hook 配置的推送目标。配置了 endpoints 时启用。
+type HooksConfig struct {
+	Listen    string                `yaml:"listen"` // 监听地址，默认 "127.0.0.1:8767"
+	Endpoints map[string]HookConfig `yaml:"endpoints"`
+}
+
+// HookConfig 一个 /hook/<名称> 端点
+type HookConfig struct {
+	Token    string   `yaml:"token"`    // 调用方需携带 Authorization: Bearer <token> 或 ?token=，支持 ${ENV}；未设置 public 时必填
+	Public   bool     `yaml:"public"`   // 不校验 token，任何能访问到端点的人都可以发消息
+	Targets  []string `yaml:"targets"`  // 推送目标，如 "Telegram:123"
+	Template string   `yaml:"template"` // Go text/template，JSON 请求体解析后作为 .，纯文本请求体即为 .
+	Format   string   `yaml:"format"`   // 内置格式："alertmanager" 或 "grafana"，按严重程度格式化告警并区分触发/恢复；配置 template 时以模板为准
+}
+
+// GitHubConfig 接收 GitHub Webhook（push、issues、PR、release、workflow），格式化后按路由发送到各平台
+type GitHubConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Listen  string        `yaml:"listen"` // 监听地址，默认 "127.0.0.1:8766"
+	Path    string        `yaml:"path"`   // Webhook 路径，默认 "/github"
+	Secret  string        `yaml:"secret"` // Webhook secret，用于校验 X-Hub-Signature-256，支持 ${ENV}
+	Routes  []GitHubRoute `yaml:"routes"`
+}
+
+// GitHubRoute 将匹配的仓库和事件发送到推送目标
+type GitHubRoute struct {
+	Repo    string   `yaml:"repo"`    // 仓库全名，支持通配符，如 "lhpqaq/*"
+	Events  []string `yaml:"events"`  // 事件类型，如 "push"、"pull_request"，为空表示全部
+	Targets []string `yaml:"targets"` // 推送目标，如 "Telegram:-100123"
+}
+
+// ExperimentConfig A/B 实验：管理员通过 /experiment on 开启后，按比例抽样普通对话，
+// 用两个变体分别生成回答，随机发送其中一个并保存两者，通过 👍/👎 按钮和追问收集反馈
+type ExperimentConfig struct {
+	Name   string            `yaml:"name"`   // 实验名，修改后重新统计
+	Sample float64           `yaml:"sample"` // 抽样比例 (0, 1]，默认 0.1
+	A      ExperimentVariant `yaml:"a"`
+	B      ExperimentVariant `yaml:"b"`
+}
+
+// ExperimentVariant 实验变体，为空的字段沿用用户原本的提示词/模型
+type ExperimentVariant struct {
+	Prompt string `yaml:"prompt"`
+	Model  string `yaml:"model"`
+}
+
+// SelfTestConfig /selftest 调用的无副作用工具，默认使用内置的 current_time
+type SelfTestConfig struct {
+	Tool      string         `yaml:"tool"`      // 工具名，可以是 MCP 工具，如 "fetch"
+	Arguments map[string]any `yaml:"arguments"` // 调用参数
+}
+
+// AnonymizeConfig 匿名化导出（/snapshot ... anon、/history export ... anon）时用户 ID 的哈希盐，支持 ${ENV}，
+// 为空时每次启动随机生成，重启后同一用户的哈希会变化
+type AnonymizeConfig struct {
+	Salt string `yaml:"salt"`
+}
+
+// HistoryLogConfig 消息日志：按会话记录收到的消息和机器人的回复，用于 /history 查看和管理员导出（审计、整理微调数据）。
+// 默认关闭，开启前请确认符合群成员的隐私预期
+type HistoryLogConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxPerChat int  `yaml:"max_per_chat"` // 每个会话保留的最近消息数，默认 1000
+}
+
+// BackupConfig 定期将存储写成带时间戳的副本，保留最近 Keep 份，可选上传到 S3 兼容的对象存储。
+// 管理员也可以用 /backup now 立即备份
+type BackupConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // 备份间隔，默认 6h
+	Dir      string        `yaml:"dir"`      // 备份目录，默认 "backups"
+	Keep     int           `yaml:"keep"`     // 本地保留的份数，默认 7
+	S3       S3Config      `yaml:"s3"`
+}
+
+// S3Config S3 兼容的对象存储（AWS S3、Cloudflare R2、MinIO 等），Endpoint 为空时不上传
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"` // 如 "https://s3.us-east-1.amazonaws.com"，使用 path-style 地址
+	Region    string `yaml:"region"`   // 默认 "us-east-1"，R2 为 "auto"
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`     // 对象 key 前缀，如 "ggbot/"
+	AccessKey string `yaml:"access_key"` // 支持 ${ENV}
+	SecretKey string `yaml:"secret_key"` // 支持 ${ENV}
+}
+
+// TracingConfig 把消息处理的链路（收到消息 → 插件处理 → 模型请求 → 工具调用 → 发送回复）
+// 以 OTLP/HTTP (JSON) 导出到 Jaeger、Tempo、OpenTelemetry Collector 等，用于排查回复慢的原因
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Endpoint    string            `yaml:"endpoint"`     // 默认 "http://localhost:4318/v1/traces"
+	Headers     map[string]string `yaml:"headers"`      // 附加的请求头，如认证信息，支持 ${ENV}
+	ServiceName string            `yaml:"service_name"` // 默认 "ggbot"
+	SampleRatio float64           `yaml:"sample_ratio"` // 采样比例 0-1，默认 1（全部采样）
+}
+
+// MCPServerConfig 将 ggbot 作为 MCP 服务（Streamable HTTP），供外部 Agent 调用
+type MCPServerConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // 监听地址，默认 "127.0.0.1:8765"
+	Token   string `yaml:"token"`  // 客户端需携带 Authorization: Bearer <token>，支持 ${ENV}
+}
+
+// RouteConfig 一条消息路由规则，所有非空的匹配条件都满足时生效。
+// 可以让一个进程中的不同会话表现为不同的专用机器人（如翻译群只启用 AI 并使用翻译人设）。
+type RouteConfig struct {
+	// 匹配条件
+	Platform string `yaml:"platform"`  // "Telegram"、"QQ"
+	Chat     string `yaml:"chat"`      // 会话 ID，支持通配符
+	ChatType string `yaml:"chat_type"` // "private"、"group"、"channel"
+	Command  string `yaml:"command"`   // 指令，如 "/news"
+	Regex    string `yaml:"regex"`     // 消息文本正则
+
+	// 处理方式
+	Plugins []string `yaml:"plugins"` // 处理消息的插件（如 "AI"、"System"、"Feeds"），为空表示全部
+	Drop    bool     `yaml:"drop"`    // 忽略消息
+	Persona string   `yaml:"persona"` // AI 对话使用的人设（personas 中的 key）
+	Prompt  string   `yaml:"prompt"`  // AI 对话使用的系统提示词，优先于 persona
+}
+
+// IntentsConfig 意图路由：AI 回复普通消息前先判断意图（如"明天北京天气怎么样"），
+// 属于某个意图时以提取出的参数执行对应的指令，其余消息照常对话
+type IntentsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Model 分类使用的模型，建议使用便宜的小模型，默认 ai.model
+	Model   string       `yaml:"model"`
+	Intents []IntentRule `yaml:"intents"`
+}
+
+// IntentRule 一个意图及其对应的指令
+type IntentRule struct {
+	Name        string `yaml:"name"`        // 如 "weather"
+	Description string `yaml:"description"` // 告诉模型哪些消息属于该意图，如 "查询天气"
+	Command     string `yaml:"command"`     // 执行的指令，如 "/weather"
+	// Regex 匹配的消息直接归为该意图，不调用模型；第一个捕获组作为指令参数
+	Regex string `yaml:"regex"`
+}
+
+// BotsConfig 处理其他机器人（IsBot）发来的消息，防止机器人之间无限对话
+type BotsConfig struct {
+	Policy   string        `yaml:"policy"`    // "ignore"（默认）或 "allow"；ignore 时可用 /bots allow 按会话放行
+	MaxTurns int           `yaml:"max_turns"` // 窗口内最多回复机器人消息的次数，默认 5
+	Window   time.Duration `yaml:"window"`    // 计数窗口，默认 10m；有真人发言时重新计数
+}
+
+// LimitsConfig 每个用户每天的 AI 用量上限，0 表示不限制，管理员不受限制。
+// 计数保存在 storage 中，重启后不会清零。
+type LimitsConfig struct {
+	DailyRequests int `yaml:"daily_requests"` // 每天最多请求次数
+	DailyTokens   int `yaml:"daily_tokens"`   // 每天最多消耗的 token
+	RetainDays    int `yaml:"retain_days"`    // 用量记录保留天数，默认 7
+}
+
+// PaymentsConfig 用户通过 /buy 付款购买 token 额度（Telegram Stars，或配置支付服务商后使用其他货币），
+// 每日额度用完后从购买的余额中扣除，/usage 查看
+type PaymentsConfig struct {
+	Enabled       bool             `yaml:"enabled"`
+	Currency      string           `yaml:"currency"`       // 默认 "XTR"（Telegram Stars）
+	ProviderToken string           `yaml:"provider_token"` // 使用其他货币时 @BotFather 中支付服务商的 token，Stars 不需要
+	Packages      []PaymentPackage `yaml:"packages"`
+}
+
+// PaymentPackage 一档可购买的额度
+type PaymentPackage struct {
+	Tokens int `yaml:"tokens"`
+	Price  int `yaml:"price"` // 货币的最小单位：Stars 为数量，美元为美分
+}
+
+// SearchConfig 内置网页搜索配置
+type SearchConfig struct {
+	Provider   string `yaml:"provider"`    // "searxng", "bing", "brave"，为空时不启用
+	URL        string `yaml:"url"`         // SearxNG 实例地址；bing/brave 可选，覆盖默认 API 地址
+	APIKey     string `yaml:"api_key"`     // bing/brave 的 API Key
+	MaxResults int    `yaml:"max_results"` // 返回结果数，默认 5
+	UseProxy   bool   `yaml:"use_proxy"`   // 是否使用 proxy.url
+}
+
+// DemoConfig 只读演示模式：禁止用户保存 API Key，限制 token，禁用危险工具并为回复添加水印
+type DemoConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	MaxTokens     int      `yaml:"max_tokens"`     // 单次生成的最大 token 数，默认 1024
+	Watermark     string   `yaml:"watermark"`      // 附加在回复末尾的水印
+	DisabledTools []string `yaml:"disabled_tools"` // 禁用的工具名通配符，如 "*delete*"
+}
+
+// defaultDisabledTools 演示模式默认禁用的工具（可能修改数据或执行命令）
+var defaultDisabledTools = []string{"*delete*", "*remove*", "*write*", "*update*", "*create*", "*exec*", "*shell*", "*command*", "*send*"}
+
+// ToolAllowed reports whether the tool may be used in demo mode
+func (d DemoConfig) ToolAllowed(name string) bool {
+	if !d.Enabled {
+		return true
+	}
+	return !MatchTool(d.DisabledTools, name)
+}
+
+// MatchTool reports whether the tool name matches any of the wildcard patterns, case-insensitively
+func MatchTool(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolNeedsConfirm reports whether calling the tool requires the user to confirm first.
+// server is the MCP server providing the tool, empty for native tools.
+func (c *Config) ToolNeedsConfirm(server, name string) bool {
+	if MatchTool(c.ConfirmTools, name) {
+		return true
+	}
+	if server != "" {
+		return MatchTool(c.MCPServers[server].Confirm, name)
+	}
+	return c.ToolWebhooks[name].Confirm
+}
+
+// KnowledgeConfig 知识库配置：文档分块后通过 embedding 接口向量化，对话时检索相关片段注入提示词
+type KnowledgeConfig struct {
+	Enabled      bool    `yaml:"enabled"`
+	BaseURL      string  `yaml:"base_url"`      // embedding 接口地址，默认使用 ai.base_url
+	APIKey       string  `yaml:"api_key"`       // 默认使用 ai.api_key
+	Model        string  `yaml:"model"`         // embedding 模型，如 "text-embedding-v3"
+	Path         string  `yaml:"path"`          // 向量存储文件，默认 "knowledge.json"
+	ChunkSize    int     `yaml:"chunk_size"`    // 每块最大字符数，默认 800
+	ChunkOverlap int     `yaml:"chunk_overlap"` // 相邻块重叠字符数，默认 100
+	TopK         int     `yaml:"top_k"`         // 每次检索的片段数，默认 4
+	MinScore     float64 `yaml:"min_score"`     // 最低相似度，默认 0.3
+	MaxDocuments int     `yaml:"max_documents"` // 每个用户最多文档数，默认 50
+}
+
+// ResponseCacheConfig 完全相同的模型请求（模型、消息、工具、参数都相同）在 TTL 内复用上次的结果，
+// 用于推送和 /news 等反复生成相同内容的场景，普通对话不使用
+type ResponseCacheConfig struct {
+	TTL time.Duration `yaml:"ttl"` // 默认 10m，负数表示不缓存
+}
+
+// ToolOutputConfig 工具（尤其是 MCP 工具）可能返回几十 KB 的结果，超过 MaxLength 时截断，
+// 或用便宜的模型总结后再放入对话，避免超出上下文窗口
+type ToolOutputConfig struct {
+	MaxLength int    `yaml:"max_length"` // 最多字符数，默认 8000，负数表示不限制
+	Mode      string `yaml:"mode"`       // "truncate"（默认，保留开头）或 "summarize"
+	Model     string `yaml:"model"`      // 总结使用的模型，默认 ai.model
+}
+
+// ToolLoopConfig 工具调用循环的限制，达到限制时不再提供工具，让模型基于已有的结果回复
+type ToolLoopConfig struct {
+	MaxIterations int `yaml:"max_iterations"` // 一次对话最多的生成轮数，默认 10
+	// MaxRepeats 以相同参数调用同一工具的最多次数，超过时视为陷入循环，默认 2
+	MaxRepeats int `yaml:"max_repeats"`
+}
+
+// SemanticCacheConfig 语义缓存：同一会话中近期回答过非常相似的问题时直接给出缓存的回答，并提供“重新生成”按钮
+type SemanticCacheConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Threshold  float64       `yaml:"threshold"`   // 相似度阈值，默认 0.92
+	TTL        time.Duration `yaml:"ttl"`         // 缓存有效期，默认 24h
+	MaxEntries int           `yaml:"max_entries"` // 每个会话最多缓存条数，默认 100
+	Model      string        `yaml:"model"`       // embedding 模型，默认与 knowledge 相同
+	BaseURL    string        `yaml:"base_url"`    // 默认与 knowledge 相同
+	APIKey     string        `yaml:"api_key"`     // 默认与 knowledge 相同
+}
+
+// FeedsConfig RSS/Atom 订阅：定期检查会话订阅的源，把新条目推送到订阅所在的会话
+type FeedsConfig struct {
+	Interval      time.Duration `yaml:"interval"`       // 检查间隔，默认 15m
+	MaxItems      int           `yaml:"max_items"`      // 每个源每次最多推送的新条目数，默认 5
+	MaxFeeds      int           `yaml:"max_feeds"`      // 每个会话最多订阅数，默认 20
+	SummaryPrompt string        `yaml:"summary_prompt"` // 以 summary 方式订阅时，AI 摘要使用的系统提示词
+	UseProxy      bool          `yaml:"use_proxy"`      // 是否使用 proxy.url
+}
+
+// SummaryConfig 群聊每日总结：每天定时用 AI 总结群里最近 24 小时的消息（来自 history_log）并发到群里，
+// 群管理员用 /summary on 为本群开启
+type SummaryConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Time        string `yaml:"time"`         // 发送时间，默认 "22:00"
+	MinMessages int    `yaml:"min_messages"` // 少于这么多条消息的群当天不发送，默认 20
+	MaxMessages int    `yaml:"max_messages"` // 最多总结最近的多少条消息，默认 500
+	Prompt      string `yaml:"prompt"`       // 总结使用的系统提示词
+}
+
+// NewsConfig /news 的新闻来源、主题和输出格式，新闻仍通过搜索工具（search 或 MCP）获取
+type NewsConfig struct {
+	Sources  []string `yaml:"sources"`   // 优先引用的新闻来源（媒体名或网站），如 "新华网"、"bbc.com"
+	Keywords []string `yaml:"keywords"`  // 默认关注的主题，用户可用 /news set 设置自己的主题
+	Language string   `yaml:"language"`  // 摘要使用的语言（"zh"、"en"），为空时使用用户的语言
+	Format   string   `yaml:"format"`    // "digest"（默认，逐条列出标题和链接）或 "summary"（分段总结）
+	MaxItems int      `yaml:"max_items"` // digest 最多列出的新闻条数，默认 8
+}
+
+// MemoryConfig 长期记忆：/remember 记住的和自动提取的用户信息保存在用户数据中，对话时加入系统提示词
+type MemoryConfig struct {
+	Auto     bool   `yaml:"auto"`      // 每次对话后由模型提取用户的稳定信息（称呼、偏好、时区等），每次对话多一次模型请求
+	Model    string `yaml:"model"`     // 提取使用的模型，默认使用 ai.model
+	MaxFacts int    `yaml:"max_facts"` // 每个用户最多记住的条数，默认 50，超出时先删除最早自动提取的
+}
+
+// GameConfig 群组游戏：AI 出题的知识问答和成语接龙
+type GameConfig struct {
+	TurnTimeout  time.Duration `yaml:"turn_timeout"`  // 每回合限时，默认 60s
+	TriviaRounds int           `yaml:"trivia_rounds"` // 知识问答每局题数，默认 5
+	TriviaPrompt string        `yaml:"trivia_prompt"` // AI 出题使用的系统提示词，需要输出 {"question": ..., "answers": [...]}
+}
+
+// WelcomeConfig 新成员加入群组时发送欢迎消息和群规（支持成员事件的平台，如 Telegram），
+// 群管理员可以用 /welcome 为本群开关、修改
+type WelcomeConfig struct {
+	Enabled bool   `yaml:"enabled"` // 未单独设置的群是否发送欢迎消息
+	Message string `yaml:"message"` // 欢迎消息，{name} 替换为 @新成员；为空时使用内置的欢迎语
+	Rules   string `yaml:"rules"`   // 群规，附在欢迎消息之后，/rules 查看
+}
+
+// RenderConfig 将 AI 回复中的代码块和 LaTeX 公式渲染为图片，用于不支持 Markdown 的平台
+type RenderConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Platforms []string `yaml:"platforms"` // 生效的平台，如 ["QQ"]
+	Style     string   `yaml:"style"`     // 代码高亮主题，默认 "github"
+	FontSize  float64  `yaml:"font_size"` // 默认 28
+	FontFile  string   `yaml:"font_file"` // 可选 TTF/OTF 字体文件，需要显示中文注释时配置等宽中文字体；默认 Go Mono
+	LaTeXURL  string   `yaml:"latex_url"` // 公式渲染服务地址前缀，公式 URL 编码后拼接在末尾；为空时不渲染公式
+	MinLines  int      `yaml:"min_lines"` // 少于该行数的代码块保留为文本，默认 3
+}
+
+// RenderEnabled reports whether rendering applies to the platform
+func (r RenderConfig) RenderEnabled(platform string) bool {
+	if !r.Enabled {
+		return false
+	}
+	for _, p := range r.Platforms {
+		if strings.EqualFold(p, platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertConfig 告警路由配置：warning 只记日志，error 私信第一个目标，critical 通知所有目标并调用 Webhook
+type AlertConfig struct {
+	Targets       []string      `yaml:"targets"`        // 告警接收目标，如 "Telegram:123"，为空时使用 admins
+	Webhook       string        `yaml:"webhook"`        // critical 告警的 Webhook 地址 (POST JSON)
+	DedupWindow   time.Duration `yaml:"dedup_window"`   // 相同告警去重时间窗口，默认 10m
+	EscalateAfter time.Duration `yaml:"escalate_after"` // 未确认告警升级间隔，默认 15m
+}
+
+// TranscriptConfig 大文本/日志文件分块总结配置
+type TranscriptConfig struct {
+	ChunkSize   int   `yaml:"chunk_size"`    // 每块最大字节数，默认 6000
+	MaxFileSize int64 `yaml:"max_file_size"` // 最大文件字节数，默认 20MB
 }
 
 // GirlfriendConfig 女朋友定制配置
@@ -40,16 +553,24 @@ type GirlfriendConfig struct {
 	Prompt string `yaml:"prompt"` // 定制提示词
 }
 
+// PersonaConfig 人设配置
+type PersonaConfig struct {
+	Name   string `yaml:"name"`   // 显示名称
+	Prompt string `yaml:"prompt"` // 系统提示词
+	// 使用该人设时的生成参数，如创作类人设调高 temperature
+	GenerationParams `yaml:",inline"`
+}
+
 // ProxyConfig 代理配置
 type ProxyConfig struct {
-	URL              string `yaml:"url"`               // 代理地址，如 "http://127.0.0.1:7890"
+	URL              string `yaml:"url"`                // 代理地址，如 "http://127.0.0.1:7890"
 	TelegramUseProxy bool   `yaml:"telegram_use_proxy"` // Telegram 是否使用代理，默认 false
 	QQUseProxy       bool   `yaml:"qq_use_proxy"`       // QQ 是否使用代理，默认 false (强制不走代理)
 }
 
 type MCPConfig struct {
-	Type     string            `yaml:"type"`      // e.g. "streamable_http", "sse", "stdio"
-	URL      string            `yaml:"url"`       // For http/sse type
+	Type     string            `yaml:"type"`      // e.g. "streamable_http", "sse", "websocket", "stdio"
+	URL      string            `yaml:"url"`       // For http/sse/websocket type
 	Headers  map[string]string `yaml:"headers"`   // Custom headers for authentication
 	UseProxy bool              `yaml:"use_proxy"` // Whether to use proxy, default true
 
@@ -57,6 +578,39 @@ type MCPConfig struct {
 	Command string            `yaml:"command"` // Command to execute, e.g. "npx"
 	Args    []string          `yaml:"args"`    // Command arguments, e.g. ["bing-cn-mcp"]
 	Env     map[string]string `yaml:"env"`     // Environment variables for the command
+
+	// Prefix 提供给模型的工具名前缀，如 "gh" 时工具 search 显示为 gh__search，调用时自动还原。
+	// 未设置时使用原名，与其他服务的工具重名时自动以服务名作为前缀
+	Prefix string `yaml:"prefix"`
+
+	// 执行前需要用户确认的工具名通配符，"*" 表示该服务的所有工具
+	Confirm []string `yaml:"confirm"`
+
+	// OAuth 授权（仅 HTTP/SSE 类型），管理员通过 /mcp_auth 完成授权，token 缓存在存储中并自动刷新
+	Auth *MCPAuthConfig `yaml:"auth"`
+}
+
+// MCPAuthConfig 远程 MCP 服务的 OAuth 2.1 配置，授权服务器地址默认按 MCP 授权规范从服务端发现
+type MCPAuthConfig struct {
+	Flow         string   `yaml:"flow"`          // "device"（默认）或 "code"
+	ClientID     string   `yaml:"client_id"`     // 为空时通过动态客户端注册获取
+	ClientSecret string   `yaml:"client_secret"` // 支持 ${ENV}
+	Scopes       []string `yaml:"scopes"`
+	Issuer       string   `yaml:"issuer"`       // 可选，授权服务器地址，为空时自动发现
+	RedirectURL  string   `yaml:"redirect_url"` // code 模式的回调地址，授权后从浏览器地址栏复制 code
+}
+
+// ToolWebhookConfig 将一个 HTTP 接口声明为模型可调用的工具。
+// URL、Body 中的 {{参数名}} 会被替换为模型给出的参数值，Headers 中支持 ${ENV} 环境变量。
+type ToolWebhookConfig struct {
+	Description string                 `yaml:"description"`
+	Method      string                 `yaml:"method"` // 默认 GET
+	URL         string                 `yaml:"url"`    // 如 "https://api.example.com/orders/{{id}}"
+	Headers     map[string]string      `yaml:"headers"`
+	Body        string                 `yaml:"body"`       // 请求体模板；为空时 POST/PUT/PATCH 以 JSON 发送全部参数
+	Parameters  map[string]interface{} `yaml:"parameters"` // 参数的 JSON Schema
+	Timeout     time.Duration          `yaml:"timeout"`    // 默认 15s
+	Confirm     bool                   `yaml:"confirm"`    // 执行前需要用户确认
 }
 
 type PushConfig struct {
@@ -64,18 +618,134 @@ type PushConfig struct {
 	Time    string   `yaml:"time"`    // e.g. "08:00"
 	Targets []string `yaml:"targets"` // e.g. ["Telegram:123", "QQ:Group:456"]
 	Prompt  string   `yaml:"prompt"`  // Prompt to generate content, e.g. "Get hot news"
+
+	// 个性化推送：每个目标单独生成内容，有独立的时间、提示词和人设，不受 Enabled 影响。
+	// key 为任务名，在 /jobs 中显示为 push:<key>
+	Personal map[string]PersonalPushConfig `yaml:"personal"`
+
+	// 可订阅的推送频道，用户通过 /subscribe 订阅，发送时按订阅列表确定目标。
+	// 上面的每日推送即内置频道 "news"，发送给 Targets 和订阅者
+	Channels map[string]PushChannelConfig `yaml:"channels"`
+}
+
+// PushChannelConfig 可订阅的推送频道
+type PushChannelConfig struct {
+	Name   string `yaml:"name"` // 显示名称，默认为频道 key
+	Time   string `yaml:"time"` // 默认与 push.time 相同
+	Prompt string `yaml:"prompt"`
+	// 为每个订阅者单独生成内容（使用其人设、城市等偏好），否则生成一次发给所有订阅者
+	Personal bool `yaml:"personal"`
+}
+
+// QuietHoursRule 一组推送目标的安静时段，目标匹配多条规则时使用第一条
+type QuietHoursRule struct {
+	Targets  []string `yaml:"targets"`  // 推送目标，如 "Telegram:123"；为空时适用于所有目标
+	Start    string   `yaml:"start"`    // 开始时间，如 "23:00"
+	End      string   `yaml:"end"`      // 结束时间，如 "07:00"，早于开始时间表示跨过午夜
+	Action   string   `yaml:"action"`   // "defer"（默认，时段结束后发送）或 "drop"（丢弃）
+	Timezone string   `yaml:"timezone"` // IANA 时区，默认为服务器时区
+}
+
+// TemplatesConfig 消息模板（Go text/template）中 {{.Weather}} 等变量的来源
+type TemplatesConfig struct {
+	// 天气查询地址，{city} 替换为城市名，返回纯文本，默认 "https://wttr.in/{city}?format=3"，"off" 关闭
+	WeatherURL string `yaml:"weather_url"`
+	// 目标没有用 /city 设置城市（如群聊）时使用的城市
+	City string `yaml:"city"`
+}
+
+// OutboxConfig 推送发送失败（平台不可用、限流等）时保存到发件箱，按指数退避重试，
+// 重试次数用完后记为失败并告警，管理员可用 /outbox 查看和重新发送
+type OutboxConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // 最多尝试次数（包括第一次发送），默认 6
+	Backoff     time.Duration `yaml:"backoff"`      // 第一次重试的间隔，之后每次加倍，默认 1m
+	MaxBackoff  time.Duration `yaml:"max_backoff"`  // 重试间隔上限，默认 1h
+}
+
+// PersonalPushConfig 发给单个目标的个性化推送
+type PersonalPushConfig struct {
+	Target  string `yaml:"target"`  // e.g. "QQ:User:OpenID", "Telegram:123"
+	Time    string `yaml:"time"`    // 默认与 push.time 相同
+	Prompt  string `yaml:"prompt"`  // 默认与 push.prompt 相同
+	Persona string `yaml:"persona"` // personas 中的 key；为空时按目标用户的女朋友配置和人设偏好
 }
 
 type BotConfig struct {
 	Token         string        `yaml:"token"`
 	PollerTimeout time.Duration `yaml:"poller_timeout"`
-	LogLevel      string        `yaml:"log_level"` // debug, info, warn, error
+	LogLevel      string        `yaml:"log_level"`    // debug, info, warn, error
+	MaxTasks      int           `yaml:"max_tasks"`    // 后台任务最大并发数，默认 2
+	AckReaction   string        `yaml:"ack_reaction"` // 收到消息后用表态确认（如 "👀"），可与输入状态同时使用
+	// 默认回复语言（"zh"、"en"），用户可用 /lang 修改，默认 "zh"
+	Language string `yaml:"language"`
+	// Telegram 消息格式："html" 把模型输出的 Markdown 转换为 Telegram HTML（默认），"plain" 按纯文本发送
+	ParseMode string `yaml:"parse_mode"`
+	// 临时消息（如用量提示）在多久后自动删除，默认 1 分钟，负数表示不删除
+	EphemeralTTL time.Duration `yaml:"ephemeral_ttl"`
+	// 连续消息合并：同一用户在这段时间内连续发送的多条消息合并为一次提问，每条新消息重新计时，默认 0 不合并
+	MergeWindow time.Duration `yaml:"merge_window"`
 
 	// QQ Configuration
 	QQAppID  string `yaml:"qq_app_id"`
 	QQSecret string `yaml:"qq_secret"`
 	// Deprecated: use qq_secret
 	QQToken string `yaml:"qq_token"`
+	// QQ 消息格式：Markdown、Ark、Embed，需要在 QQ 开放平台开通对应权限
+	QQMessage QQMessageConfig `yaml:"qq_message"`
+}
+
+// QQMessageConfig QQ 机器人发送消息的格式，富文本发送失败时退回纯文本
+type QQMessageConfig struct {
+	// "text"（默认）、"markdown"、"ark"（模板 23：文本加链接列表）、"embed"（仅频道）
+	Format string `yaml:"format"`
+	// 推送（定时推送、订阅、告警等主动消息）使用的格式，默认与 format 相同
+	PushFormat       string `yaml:"push_format"`
+	MarkdownTemplate string `yaml:"markdown_template"` // 自定义 Markdown 模板 ID，为空时发送原生 Markdown
+	MarkdownParam    string `yaml:"markdown_param"`    // 模板中放正文的参数名，默认 "text"
+	// 以消息按钮发送确认、菜单等按钮（需开通 Markdown 和消息按钮权限），点击通过互动事件回调；
+	// 未开启或发送失败时以编号列表发送
+	Buttons bool `yaml:"buttons"`
+}
+
+// PlatformConfig platforms 列表中的一个平台
+type PlatformConfig struct {
+	Name    string `yaml:"name"`    // 适配器名："telegram"、"qq"、"onebot"、"whatsapp"、"email"
+	Enabled *bool  `yaml:"enabled"` // 默认 true，设为 false 可暂时停用而保留配置
+	// 该平台的配置，键与顶层同名配置段相同（telegram、qq 为 bot），覆盖顶层配置
+	Settings yaml.Node `yaml:"settings"`
+}
+
+// IsEnabled 未设置 enabled 时视为启用
+func (p PlatformConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// OneBotConfig 通过 OneBot v11 正向 WebSocket 连接 NapCat、Lagrange 等协议端，使用个人 QQ 号
+type OneBotConfig struct {
+	URL               string        `yaml:"url"`                // 如 "ws://127.0.0.1:3001"，为空时不启用
+	AccessToken       string        `yaml:"access_token"`       // 协议端配置的 access token，支持 ${ENV}
+	GroupAll          bool          `yaml:"group_all"`          // 处理群里的所有消息，默认只处理 @机器人、回复机器人的消息和指令
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"` // 断线重连间隔，默认 5s
+}
+
+// EmailConfig 轮询 IMAP 收件箱，每封新邮件作为一条消息，通过 SMTP 回复
+type EmailConfig struct {
+	IMAP     string        `yaml:"imap"`     // IMAP 服务器（TLS），如 "imap.example.com:993"，为空时不启用
+	SMTP     string        `yaml:"smtp"`     // SMTP 服务器，465 端口使用 TLS，其他端口使用 STARTTLS
+	Username string        `yaml:"username"` // IMAP 和 SMTP 共用的账号
+	Password string        `yaml:"password"` // 支持 ${ENV}，通常是邮箱的授权码
+	From     string        `yaml:"from"`     // 发件地址，默认为 username
+	Mailbox  string        `yaml:"mailbox"`  // 默认 "INBOX"
+	Interval time.Duration `yaml:"interval"` // 轮询间隔，默认 1m
+	// 收件服务器在 Authentication-Results 头中的标识（authserv-id），如 "mx.example.com"，必填。
+	// 发件地址可以伪造，只处理该服务器记录的 DKIM 或 DMARC 校验通过且与发件域对齐的邮件
+	AuthServID string `yaml:"authserv_id"`
+}
+
+// WhatsAppConfig 以关联设备的方式登录 WhatsApp，首次启动时在终端扫码，登录信息保存在 storage 中
+type WhatsAppConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	GroupAll bool `yaml:"group_all"` // 处理群里的所有消息，默认只处理 @机器人、回复机器人的消息和指令
 }
 
 type AIConfig struct {
@@ -84,37 +754,437 @@ type AIConfig struct {
 	APIKey        string `yaml:"api_key"`
 	Model         string `yaml:"model"`
 	DefaultPrompt string `yaml:"default_prompt"`
+	VisionModel   string `yaml:"vision_model"` // 处理图片时使用的模型，为空时使用 model（需支持视觉）
+	// 推理模型：用 max_completion_tokens 代替 max_tokens，不发送 temperature 等采样参数。
+	// OpenAI o 系列（o1、o3-mini 等）自动识别，无需设置
+	ReasoningModel bool `yaml:"reasoning_model"`
+	// 生成参数（temperature、max_tokens 等）
+	GenerationParams `yaml:",inline"`
+}
+
+// GenerationParams 模型的生成参数，零值表示使用服务端默认值。
+// 可在 ai、每个人设和用户的 /set_ai 中设置，人设的参数优先
+type GenerationParams struct {
+	MaxTokens        int      `yaml:"max_tokens"`        // 单次生成的最大 token 数
+	Temperature      *float64 `yaml:"temperature"`       // 采样温度，0-2
+	TopP             *float64 `yaml:"top_p"`             // 0-1
+	PresencePenalty  *float64 `yaml:"presence_penalty"`  // -2 到 2
+	FrequencyPenalty *float64 `yaml:"frequency_penalty"` // -2 到 2
+	Stop             []string `yaml:"stop"`              // 停止序列，最多 4 个
+}
+
+// Merge returns p with the fields set in over replacing its own
+func (p GenerationParams) Merge(over GenerationParams) GenerationParams {
+	if over.MaxTokens > 0 {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		p.TopP = over.TopP
+	}
+	if over.PresencePenalty != nil {
+		p.PresencePenalty = over.PresencePenalty
+	}
+	if over.FrequencyPenalty != nil {
+		p.FrequencyPenalty = over.FrequencyPenalty
+	}
+	if len(over.Stop) > 0 {
+		p.Stop = over.Stop
+	}
+	return p
+}
+
+// Validate reports parameters outside the ranges accepted by OpenAI compatible APIs
+func (p GenerationParams) Validate() error {
+	inRange := func(name string, v *float64, low, high float64) error {
+		if v != nil && (*v < low || *v > high) {
+			return fmt.Errorf("%s must be between %g and %g", name, low, high)
+		}
+		return nil
+	}
+	var errs []error
+	if p.MaxTokens < 0 {
+		errs = append(errs, errors.New("max_tokens must not be negative"))
+	}
+	errs = append(errs,
+		inRange("temperature", p.Temperature, 0, 2),
+		inRange("top_p", p.TopP, 0, 1),
+		inRange("presence_penalty", p.PresencePenalty, -2, 2),
+		inRange("frequency_penalty", p.FrequencyPenalty, -2, 2),
+	)
+	if len(p.Stop) > 4 {
+		errs = append(errs, errors.New("stop accepts at most 4 sequences"))
+	}
+	return errors.Join(errs...)
 }
 
+// Load 读取配置文件及其 include 的文件，存在 <name>.local.yaml 时合并到最上层，用于保存密钥和本机配置
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	var unknown []string
+	root, err := loadTree(path, make(map[string]bool), &unknown)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := os.Stat(localPath(path)); err == nil {
+		overlay, err := loadTree(localPath(path), make(map[string]bool), &unknown)
+		if err != nil {
+			return nil, err
+		}
+		mergeNode(root, overlay)
+	}
+
+	// 所有值中的 ${VAR} 和 ${VAR:-默认值} 在解析前替换为环境变量
+	expandNode(root)
 
 	var cfg Config
-	err = yaml.Unmarshal(data, &cfg)
-	if err != nil {
+	if err := root.Decode(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.unknownKeys = unknown
+
+	seen := make(map[string]bool)
+	for i, platform := range cfg.Platforms {
+		name := strings.ToLower(strings.TrimSpace(platform.Name))
+		if name == "" {
+			return nil, fmt.Errorf("platforms[%d]: name is required", i)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("platforms: %s is listed more than once", name)
+		}
+		seen[name] = true
+		cfg.Platforms[i].Name = name
+	}
+
+	for name, section := range cfg.Adapters {
+		if lower := strings.ToLower(name); lower != name {
+			delete(cfg.Adapters, name)
+			cfg.Adapters[lower] = section
+		}
+	}
 
 	// Fallback for QQSecret
 	if cfg.Bot.QQSecret == "" && cfg.Bot.QQToken != "" {
 		cfg.Bot.QQSecret = cfg.Bot.QQToken
 	}
 
+	if cfg.OneBot.ReconnectInterval <= 0 {
+		cfg.OneBot.ReconnectInterval = 5 * time.Second
+	}
+	if cfg.Email.From == "" {
+		cfg.Email.From = cfg.Email.Username
+	}
+	if cfg.Email.Mailbox == "" {
+		cfg.Email.Mailbox = "INBOX"
+	}
+	if cfg.Email.Interval <= 0 {
+		cfg.Email.Interval = time.Minute
+	}
+	if cfg.HistoryLog.MaxPerChat <= 0 {
+		cfg.HistoryLog.MaxPerChat = 1000
+	}
+	if cfg.ResponseCache.TTL == 0 {
+		cfg.ResponseCache.TTL = 10 * time.Minute
+	}
+	if cfg.ToolOutput.MaxLength == 0 {
+		cfg.ToolOutput.MaxLength = 8000
+	}
+	if cfg.MCPConnect == "" {
+		cfg.MCPConnect = "background"
+	}
+	if cfg.ToolLoop.MaxIterations <= 0 {
+		cfg.ToolLoop.MaxIterations = 10
+	}
+	if cfg.ToolLoop.MaxRepeats <= 0 {
+		cfg.ToolLoop.MaxRepeats = 2
+	}
+	if cfg.ToolOutput.Mode == "" {
+		cfg.ToolOutput.Mode = "truncate"
+	}
+	if cfg.Backup.Interval <= 0 {
+		cfg.Backup.Interval = 6 * time.Hour
+	}
+	if cfg.Backup.Dir == "" {
+		cfg.Backup.Dir = "backups"
+	}
+	if cfg.Backup.Keep <= 0 {
+		cfg.Backup.Keep = 7
+	}
+	if cfg.Backup.S3.Region == "" {
+		cfg.Backup.S3.Region = "us-east-1"
+	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "ggbot"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Bot.Language == "" {
+		cfg.Bot.Language = i18n.Default
+	}
+	if cfg.Bot.QQMessage.Format == "" {
+		cfg.Bot.QQMessage.Format = "text"
+	}
+	if cfg.Bot.QQMessage.PushFormat == "" {
+		cfg.Bot.QQMessage.PushFormat = cfg.Bot.QQMessage.Format
+	}
+	if cfg.Bot.QQMessage.MarkdownParam == "" {
+		cfg.Bot.QQMessage.MarkdownParam = "text"
+	}
+	if cfg.Bot.ParseMode == "" {
+		cfg.Bot.ParseMode = "html"
+	}
+	if cfg.Bot.EphemeralTTL == 0 {
+		cfg.Bot.EphemeralTTL = time.Minute
+	}
+	if cfg.Transcript.ChunkSize <= 0 {
+		cfg.Transcript.ChunkSize = 6000
+	}
+	if cfg.Transcript.MaxFileSize <= 0 {
+		cfg.Transcript.MaxFileSize = 20 << 20
+	}
+	if cfg.Alerts.DedupWindow <= 0 {
+		cfg.Alerts.DedupWindow = 10 * time.Minute
+	}
+	if cfg.Search.MaxResults <= 0 {
+		cfg.Search.MaxResults = 5
+	}
+	if cfg.Demo.MaxTokens <= 0 {
+		cfg.Demo.MaxTokens = 1024
+	}
+	if cfg.Demo.Watermark == "" {
+		cfg.Demo.Watermark = "🧪 演示模式 · 回复由 AI 生成，仅供体验"
+	}
+	if cfg.Demo.DisabledTools == nil {
+		cfg.Demo.DisabledTools = defaultDisabledTools
+	}
+	if cfg.Knowledge.BaseURL == "" {
+		cfg.Knowledge.BaseURL = cfg.AI.BaseURL
+	}
+	if cfg.Knowledge.APIKey == "" {
+		cfg.Knowledge.APIKey = cfg.AI.APIKey
+	}
+	if cfg.Knowledge.Path == "" {
+		cfg.Knowledge.Path = "knowledge.json"
+	}
+	if cfg.Knowledge.ChunkSize <= 0 {
+		cfg.Knowledge.ChunkSize = 800
+	}
+	if cfg.Knowledge.ChunkOverlap <= 0 {
+		cfg.Knowledge.ChunkOverlap = 100
+	}
+	if cfg.Knowledge.TopK <= 0 {
+		cfg.Knowledge.TopK = 4
+	}
+	if cfg.Knowledge.MinScore <= 0 {
+		cfg.Knowledge.MinScore = 0.3
+	}
+	if cfg.Knowledge.MaxDocuments <= 0 {
+		cfg.Knowledge.MaxDocuments = 50
+	}
+	if cfg.SemanticCache.Threshold <= 0 {
+		cfg.SemanticCache.Threshold = 0.92
+	}
+	if cfg.SemanticCache.TTL <= 0 {
+		cfg.SemanticCache.TTL = 24 * time.Hour
+	}
+	if cfg.SemanticCache.MaxEntries <= 0 {
+		cfg.SemanticCache.MaxEntries = 100
+	}
+	if cfg.SemanticCache.Model == "" {
+		cfg.SemanticCache.Model = cfg.Knowledge.Model
+	}
+	if cfg.SemanticCache.BaseURL == "" {
+		cfg.SemanticCache.BaseURL = cfg.Knowledge.BaseURL
+	}
+	if cfg.SemanticCache.APIKey == "" {
+		cfg.SemanticCache.APIKey = cfg.Knowledge.APIKey
+	}
+	if cfg.Feedback.Window <= 0 {
+		cfg.Feedback.Window = 10 * time.Minute
+	}
+	if cfg.Hooks.Listen == "" {
+		cfg.Hooks.Listen = "127.0.0.1:8767"
+	}
+	if cfg.GitHub.Listen == "" {
+		cfg.GitHub.Listen = "127.0.0.1:8766"
+	}
+	if cfg.GitHub.Path == "" {
+		cfg.GitHub.Path = "/github"
+	}
+	if cfg.Experiment.Sample <= 0 || cfg.Experiment.Sample > 1 {
+		cfg.Experiment.Sample = 0.1
+	}
+	if cfg.SelfTest.Tool == "" {
+		cfg.SelfTest.Tool = "current_time"
+	}
+	if cfg.Summary.Time == "" {
+		cfg.Summary.Time = "22:00"
+	}
+	if cfg.Summary.MinMessages <= 0 {
+		cfg.Summary.MinMessages = 20
+	}
+	if cfg.Summary.MaxMessages <= 0 {
+		cfg.Summary.MaxMessages = 500
+	}
+	if cfg.Summary.Prompt == "" {
+		cfg.Summary.Prompt = "你是群聊记录员。请根据群聊记录总结群里讨论的主要话题，每个话题列出要点、结论和待办事项，提到具体的人时使用记录中的昵称。只总结记录中的内容，不要编造。"
+	}
+	if cfg.News.Format == "" {
+		cfg.News.Format = "digest"
+	}
+	if cfg.News.MaxItems <= 0 {
+		cfg.News.MaxItems = 8
+	}
+	for i := range cfg.QuietHours {
+		if cfg.QuietHours[i].Action == "" {
+			cfg.QuietHours[i].Action = "defer"
+		}
+	}
+	if cfg.Templates.WeatherURL == "" {
+		cfg.Templates.WeatherURL = "https://wttr.in/{city}?format=3"
+	}
+	if cfg.Outbox.MaxAttempts <= 0 {
+		cfg.Outbox.MaxAttempts = 6
+	}
+	if cfg.Outbox.Backoff <= 0 {
+		cfg.Outbox.Backoff = time.Minute
+	}
+	if cfg.Outbox.MaxBackoff <= 0 {
+		cfg.Outbox.MaxBackoff = time.Hour
+	}
+	if cfg.Memory.MaxFacts <= 0 {
+		cfg.Memory.MaxFacts = 50
+	}
+	if cfg.Feeds.Interval <= 0 {
+		cfg.Feeds.Interval = 15 * time.Minute
+	}
+	if cfg.Feeds.MaxItems <= 0 {
+		cfg.Feeds.MaxItems = 5
+	}
+	if cfg.Feeds.MaxFeeds <= 0 {
+		cfg.Feeds.MaxFeeds = 20
+	}
+	if cfg.Feeds.SummaryPrompt == "" {
+		cfg.Feeds.SummaryPrompt = "用 2-3 句话概括这篇文章的要点，使用中文，不要添加标题或链接。"
+	}
+	if cfg.Payments.Currency == "" {
+		cfg.Payments.Currency = "XTR"
+	}
+	if cfg.Game.TurnTimeout <= 0 {
+		cfg.Game.TurnTimeout = time.Minute
+	}
+	if cfg.Game.TriviaRounds <= 0 {
+		cfg.Game.TriviaRounds = 5
+	}
+	if cfg.Game.TriviaPrompt == "" {
+		cfg.Game.TriviaPrompt = `你是知识问答游戏的出题人。出一道有唯一明确答案的中文知识题，答案尽量简短（一个词或数字）。
+只输出 JSON：{"question": "题目", "answers": ["标准答案", "其他可接受的写法"]}`
+	}
+	if cfg.Render.Style == "" {
+		cfg.Render.Style = "github"
+	}
+	if cfg.Render.FontSize <= 0 {
+		cfg.Render.FontSize = 28
+	}
+	if cfg.Render.MinLines <= 0 {
+		cfg.Render.MinLines = 3
+	}
+	if cfg.Alerts.EscalateAfter <= 0 {
+		cfg.Alerts.EscalateAfter = 15 * time.Minute
+	}
+	if cfg.Limits.RetainDays <= 0 {
+		cfg.Limits.RetainDays = 7
+	}
+	if cfg.Bots.Policy == "" {
+		cfg.Bots.Policy = "ignore"
+	}
+	if cfg.Bots.MaxTurns <= 0 {
+		cfg.Bots.MaxTurns = 5
+	}
+	if cfg.Bots.Window <= 0 {
+		cfg.Bots.Window = 10 * time.Minute
+	}
+	if cfg.MCPServer.Listen == "" {
+		cfg.MCPServer.Listen = "127.0.0.1:8765"
+	}
+	for name, push := range cfg.Push.Personal {
+		if push.Time == "" {
+			push.Time = cfg.Push.Time
+		}
+		if push.Prompt == "" {
+			push.Prompt = cfg.Push.Prompt
+		}
+		cfg.Push.Personal[name] = push
+	}
+	if _, ok := cfg.Push.Channels["news"]; ok && cfg.Push.Enabled {
+		return nil, fmt.Errorf("push.channels.news conflicts with the built-in daily push")
+	}
+	for name, channel := range cfg.Push.Channels {
+		if channel.Name == "" {
+			channel.Name = name
+		}
+		if channel.Time == "" {
+			channel.Time = cfg.Push.Time
+		}
+		cfg.Push.Channels[name] = channel
+	}
+	for name, mcpCfg := range cfg.MCPServers {
+		if mcpCfg.Auth == nil {
+			continue
+		}
+		if mcpCfg.Auth.Flow == "" {
+			mcpCfg.Auth.Flow = "device"
+		}
+		if mcpCfg.Auth.RedirectURL == "" {
+			mcpCfg.Auth.RedirectURL = "http://127.0.0.1:8976/callback"
+		}
+		cfg.MCPServers[name] = mcpCfg
+	}
+	for name, tenant := range cfg.Tenants {
+		if tenant.Storage == "" {
+			tenant.Storage = "storage-" + name + ".json"
+			cfg.Tenants[name] = tenant
+		}
+	}
+
 	return &cfg, nil
 }
 
 func (c *Config) IsAllowed(platform string, userID string) bool {
 	// Check specific lists first
 	switch strings.ToLower(platform) {
+	case "console":
+		// 本地控制台只有运行机器人的人可以输入
+		return true
 	case "telegram":
 		for _, id := range c.AllowedTelegram {
 			if id == userID {
 				return true
 			}
 		}
+	case "onebot":
+		for _, id := range c.AllowedOneBot {
+			if id == userID {
+				return true
+			}
+		}
+	case "whatsapp":
+		for _, id := range c.AllowedWhatsApp {
+			if id == userID {
+				return true
+			}
+		}
+	case "email":
+		for _, addr := range c.AllowedEmail {
+			if strings.EqualFold(addr, userID) {
+				return true
+			}
+		}
 	case "qq":
 		for _, id := range c.AllowedQQ {
 			if id == userID {
@@ -134,6 +1204,20 @@ func (c *Config) IsAllowed(platform string, userID string) bool {
 	return false
 }
 
+// IsAdmin 判断用户是否为机器人管理员，本地控制台用户始终是管理员
+func (c *Config) IsAdmin(platform string, userID string) bool {
+	if strings.EqualFold(platform, "console") {
+		return true
+	}
+	for _, admin := range c.Admins {
+		p, id, ok := strings.Cut(admin, ":")
+		if ok && strings.EqualFold(p, platform) && id == userID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetGirlfriendPrompt 获取女朋友的定制提示词
 // key 格式: "Platform:UserID" 如 "QQ:ABC123" 或 "Telegram:12345"
 func (c *Config) GetGirlfriendPrompt(storageKey string) (string, string, bool) {
@@ -146,6 +1230,14 @@ func (c *Config) GetGirlfriendPrompt(storageKey string) (string, string, bool) {
 	return "", "", false
 }
 
+// GetPersonaPrompt 获取人设提示词，未配置时返回 false
+func (c *Config) GetPersonaPrompt(key string) (string, bool) {
+	if persona, ok := c.Personas[key]; ok && key != "" {
+		return persona.Prompt, true
+	}
+	return "", false
+}
+
 // GetPlatformPrompt 获取平台专属的提示词（用于最终回复）
 // platform: "telegram", "qq" 等
 func (c *Config) GetPlatformPrompt(platform string) string {
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPattern 匹配 ${VAR} 和 ${VAR:-默认值}，不处理 $VAR，避免误改提示词等文本中的 $
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv 替换字符串中的环境变量，变量未设置或为空时使用默认值
+func expandEnv(s string) string {
+	return envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := envPattern.FindStringSubmatch(match)
+		if value := os.Getenv(m[1]); value != "" || m[2] == "" {
+			return value
+		}
+		return m[3]
+	})
+}
+
+// expandNode 替换 YAML 树中所有值（不包括键）里的环境变量
+func expandNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		expanded := expandEnv(n.Value)
+		if expanded == n.Value {
+			return
+		}
+		n.Value = expanded
+		// 未加引号的值按替换后的内容重新推断类型，如 enabled: ${PUSH_ENABLED:-false}
+		if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			n.Tag = ""
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			expandNode(n.Content[i])
+		}
+	default:
+		for _, child := range n.Content {
+			expandNode(child)
+		}
+	}
+}
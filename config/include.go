@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// localPath 返回配置文件的本机覆盖文件路径，如 config.yaml 对应 config.local.yaml
+func localPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".local" + ext
+}
+
+// loadTree 读取配置文件，并把 include 的文件按顺序合并到它之上，include 的路径相对于当前文件所在目录。
+// 每个文件中无法识别的键记录到 unknown
+func loadTree(path string, visiting map[string]bool, unknown *[]string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if visiting[abs] {
+		return nil, fmt.Errorf("include cycle at %s", path)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	tree := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		tree = doc.Content[0]
+	}
+	if tree.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+
+	// 严格模式解析一次原文，记录拼写错误等无法识别的键（未替换的环境变量可能产生类型错误，忽略）
+	strict := yaml.NewDecoder(bytes.NewReader(data))
+	strict.KnownFields(true)
+	var typeErr *yaml.TypeError
+	if err := strict.Decode(new(Config)); errors.As(err, &typeErr) {
+		for _, e := range typeErr.Errors {
+			if strings.Contains(e, " not found in type ") {
+				*unknown = append(*unknown, path+" "+e)
+			}
+		}
+	}
+
+	var includes []string
+	if node := mappingValue(tree, "include"); node != nil {
+		if err := node.Decode(&includes); err != nil {
+			return nil, fmt.Errorf("%s: include: %w", path, err)
+		}
+	}
+	for _, include := range includes {
+		include = expandEnv(include)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		sub, err := loadTree(include, visiting, unknown)
+		if err != nil {
+			return nil, err
+		}
+		mergeNode(tree, sub)
+	}
+	return tree, nil
+}
+
+// mappingValue 返回 mapping 中 key 对应的值，不存在时返回 nil
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeNode 将 src 合并到 dst：mapping 按键递归合并，其他值（包括列表）整体替换
+func mergeNode(dst, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if existing := mappingValue(dst, key.Value); existing != nil {
+			mergeNode(existing, value)
+		} else {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/i18n"
+)
+
+// Validate 检查启动前就能发现的配置问题（未知的键、时间格式、推送目标格式、缺少模型等），一次返回所有问题，
+// 每行一个
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for _, unknown := range c.unknownKeys {
+		add("%s", unknown)
+	}
+
+	// 多租户时主配置文件只使用 bot.log_level
+	if len(c.Tenants) > 0 {
+		for name, tenant := range c.Tenants {
+			if tenant.Config == "" {
+				add("tenants.%s.config is required", name)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	if c.AI.Model == "" && (c.AI.APIKey != "" || c.AI.BaseURL != "" || c.Push.Enabled || len(c.Push.Personal) > 0) {
+		add("ai.model is required")
+	}
+
+	if c.Push.Enabled {
+		if err := validateTime(c.Push.Time); err != nil {
+			add("push.time: %v", err)
+		}
+		for _, target := range c.Push.Targets {
+			if err := validateTarget(target); err != nil {
+				add("push.targets: %v", err)
+			}
+		}
+	}
+	for name, push := range c.Push.Personal {
+		if err := validateTime(push.Time); err != nil {
+			add("push.personal.%s.time: %v", name, err)
+		}
+		if err := validateTarget(push.Target); err != nil {
+			add("push.personal.%s.target: %v", name, err)
+		}
+		if _, ok := c.Personas[push.Persona]; push.Persona != "" && !ok {
+			add("push.personal.%s.persona: unknown persona %q", name, push.Persona)
+		}
+	}
+	for name, channel := range c.Push.Channels {
+		if err := validateTime(channel.Time); err != nil {
+			add("push.channels.%s.time: %v", name, err)
+		}
+	}
+
+	for _, admin := range c.Admins {
+		if err := validateTarget(admin); err != nil {
+			add("admins: %v", err)
+		}
+	}
+	for _, target := range c.Alerts.Targets {
+		if err := validateTarget(target); err != nil {
+			add("alerts.targets: %v", err)
+		}
+	}
+	if c.MCPServer.Enabled && c.MCPServer.Token == "" {
+		add("mcp_server.token: required when mcp_server is enabled")
+	}
+	for name, hook := range c.Hooks.Endpoints {
+		if hook.Token == "" && !hook.Public {
+			add("hooks.endpoints.%s.token: required unless public is true", name)
+		}
+		for _, target := range hook.Targets {
+			if err := validateTarget(target); err != nil {
+				add("hooks.endpoints.%s.targets: %v", name, err)
+			}
+		}
+	}
+	if c.GitHub.Enabled && c.GitHub.Secret == "" {
+		add("github.secret: required when github is enabled")
+	}
+	for i, route := range c.GitHub.Routes {
+		for _, target := range route.Targets {
+			if err := validateTarget(target); err != nil {
+				add("github.routes[%d].targets: %v", i, err)
+			}
+		}
+	}
+
+	for name, mcp := range c.MCPServers {
+		switch {
+		case mcp.Type == "stdio" || mcp.Command != "":
+			if mcp.Command == "" {
+				add("mcpServers.%s: command is required for stdio type", name)
+			}
+		case !slices.Contains([]string{"", "streamable_http", "sse", "websocket", "ws"}, mcp.Type):
+			add("mcpServers.%s: unknown type %q", name, mcp.Type)
+		case mcp.URL == "":
+			add("mcpServers.%s: url is required", name)
+		}
+	}
+
+	if !slices.Contains([]string{"background", "lazy", "startup"}, c.MCPConnect) {
+		add("mcp_connect: must be \"background\", \"lazy\" or \"startup\", got %q", c.MCPConnect)
+	}
+
+	validateParams := func(prefix string, params GenerationParams) {
+		if err := params.Validate(); err != nil {
+			for _, problem := range strings.Split(err.Error(), "\n") {
+				add("%s: %s", prefix, problem)
+			}
+		}
+	}
+	validateParams("ai", c.AI.GenerationParams)
+	for name, persona := range c.Personas {
+		validateParams("personas."+name, persona.GenerationParams)
+	}
+
+	if s3 := c.Backup.S3; s3.Endpoint != "" && (s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "") {
+		add("backup.s3: bucket, access_key and secret_key are required when endpoint is set")
+	}
+
+	if c.Tracing.Enabled {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing.endpoint: must be an http(s) URL, got %q", c.Tracing.Endpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio: must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	seen := make(map[string]bool)
+	for i, intent := range c.Intents.Intents {
+		switch {
+		case intent.Name == "" || intent.Name == "chat":
+			add("intents.intents[%d].name: required and must not be \"chat\"", i)
+		case seen[intent.Name]:
+			add("intents.intents[%d].name: duplicate intent %q", i, intent.Name)
+		}
+		seen[intent.Name] = true
+		if !strings.HasPrefix(intent.Command, "/") {
+			add("intents.intents[%d].command: must be a command such as \"/news\", got %q", i, intent.Command)
+		}
+		if intent.Description == "" && intent.Regex == "" {
+			add("intents.intents[%d]: description or regex is required", i)
+		}
+		if _, err := regexp.Compile(intent.Regex); err != nil {
+			add("intents.intents[%d].regex: %v", i, err)
+		}
+	}
+
+	if c.ToolOutput.Mode != "truncate" && c.ToolOutput.Mode != "summarize" {
+		add("tool_output.mode: must be \"truncate\" or \"summarize\", got %q", c.ToolOutput.Mode)
+	}
+
+	if c.Summary.Enabled {
+		if err := validateTime(c.Summary.Time); err != nil {
+			add("summary.time: %v", err)
+		}
+		if !c.HistoryLog.Enabled {
+			add("summary: requires history_log.enabled")
+		}
+	}
+	if c.News.Format != "digest" && c.News.Format != "summary" {
+		add("news.format: must be digest or summary, got %q", c.News.Format)
+	}
+	if c.News.Language != "" && !slices.Contains(i18n.Languages(), c.News.Language) {
+		add("news.language: unsupported language %q, available: %s", c.News.Language, strings.Join(i18n.Languages(), ", "))
+	}
+
+	for i, rule := range c.QuietHours {
+		for _, target := range rule.Targets {
+			if err := validateTarget(target); err != nil {
+				add("quiet_hours[%d].targets: %v", i, err)
+			}
+		}
+		if err := validateTime(rule.Start); err != nil {
+			add("quiet_hours[%d].start: %v", i, err)
+		}
+		if err := validateTime(rule.End); err != nil {
+			add("quiet_hours[%d].end: %v", i, err)
+		}
+		if rule.Start == rule.End {
+			add("quiet_hours[%d]: start and end must differ", i)
+		}
+		if rule.Action != "defer" && rule.Action != "drop" {
+			add("quiet_hours[%d].action: must be defer or drop, got %q", i, rule.Action)
+		}
+		if _, err := time.LoadLocation(rule.Timezone); err != nil {
+			add("quiet_hours[%d].timezone: %v", i, err)
+		}
+	}
+
+	if c.Outbox.MaxBackoff < c.Outbox.Backoff {
+		add("outbox.max_backoff: must not be shorter than outbox.backoff (%s), got %s", c.Outbox.Backoff, c.Outbox.MaxBackoff)
+	}
+	if url := c.Templates.WeatherURL; url != "off" && !strings.Contains(url, "{city}") {
+		add("templates.weather_url: must contain {city} or be \"off\", got %q", url)
+	}
+
+	for _, cmd := range slices.Sorted(maps.Keys(c.Cooldowns)) {
+		if !strings.HasPrefix(cmd, "/") {
+			add("cooldowns: key must be a command such as \"/news\", got %q", cmd)
+		}
+		if c.Cooldowns[cmd] <= 0 {
+			add("cooldowns.%s: must be positive, got %s", cmd, c.Cooldowns[cmd])
+		}
+	}
+
+	if c.Bot.MergeWindow < 0 || c.Bot.MergeWindow > time.Minute {
+		add("bot.merge_window: must be between 0 and 1m, got %s", c.Bot.MergeWindow)
+	}
+	if c.Bot.ParseMode != "html" && c.Bot.ParseMode != "plain" {
+		add("bot.parse_mode: must be html or plain, got %q", c.Bot.ParseMode)
+	}
+	qqFormats := []string{"text", "markdown", "ark", "embed"}
+	if !slices.Contains(qqFormats, c.Bot.QQMessage.Format) {
+		add("bot.qq_message.format: must be one of %s, got %q", strings.Join(qqFormats, ", "), c.Bot.QQMessage.Format)
+	}
+	if !slices.Contains(qqFormats, c.Bot.QQMessage.PushFormat) {
+		add("bot.qq_message.push_format: must be one of %s, got %q", strings.Join(qqFormats, ", "), c.Bot.QQMessage.PushFormat)
+	}
+	if !slices.Contains(i18n.Languages(), c.Bot.Language) {
+		add("bot.language: unsupported language %q, available: %s", c.Bot.Language, strings.Join(i18n.Languages(), ", "))
+	}
+
+	if c.Payments.Enabled {
+		if len(c.Payments.Packages) == 0 {
+			add("payments.packages: at least one package is required")
+		}
+		for i, pkg := range c.Payments.Packages {
+			if pkg.Tokens <= 0 || pkg.Price <= 0 {
+				add("payments.packages[%d]: tokens and price must be positive", i)
+			}
+		}
+		if c.Limits.DailyRequests <= 0 && c.Limits.DailyTokens <= 0 {
+			add("payments: limits.daily_requests or limits.daily_tokens is required, purchased tokens are spent after the daily limit")
+		}
+		if c.Payments.Currency != "XTR" && c.Payments.ProviderToken == "" {
+			add("payments.provider_token is required for currency %q (Telegram Stars use XTR)", c.Payments.Currency)
+		}
+	}
+
+	if c.Bots.Policy != "ignore" && c.Bots.Policy != "allow" {
+		add("bots.policy: must be \"ignore\" or \"allow\", got %q", c.Bots.Policy)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateTime 检查每日定时任务的时间，格式为 HH:MM
+func validateTime(hhmm string) error {
+	if hhmm == "" {
+		return fmt.Errorf("time is required")
+	}
+	if _, err := time.Parse("15:04", hhmm); err != nil {
+		return fmt.Errorf("invalid time %q, expected HH:MM", hhmm)
+	}
+	return nil
+}
+
+// validateTarget 检查推送目标的格式 "Platform:ID"，QQ 需要指明 Group 或 User
+func validateTarget(target string) error {
+	platform, id, ok := strings.Cut(target, ":")
+	if !ok || strings.TrimSpace(platform) == "" || strings.TrimSpace(id) == "" {
+		return fmt.Errorf("invalid target %q, expected \"Platform:ID\"", target)
+	}
+	if strings.EqualFold(platform, "qq") {
+		kind, openID, ok := strings.Cut(id, ":")
+		if !ok || openID == "" || !slices.Contains([]string{"group", "user", "c2c"}, strings.ToLower(kind)) {
+			return fmt.Errorf("invalid target %q, expected \"QQ:Group:ID\" or \"QQ:User:OpenID\"", target)
+		}
+	}
+	return nil
+}
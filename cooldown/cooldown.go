@@ -0,0 +1,209 @@
+package cooldown
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// Limiter 指令冷却：同一用户在同一会话中冷却时间内再次发送相同的指令（指令名和参数都相同）时不再执行，
+// 回复上次的结果。上次的结果保存在存储的缓存中，重启后冷却仍然有效；管理员不受限制
+type Limiter struct {
+	cfg      *config.Config
+	store    *storage.Storage
+	logger   *slog.Logger
+	commands *core.CommandSet
+
+	mu sync.Mutex // 串行化检查和记录，同时到达的重复指令只执行一次
+}
+
+// entry 缓存中的一次执行，Text 在指令回复后更新为最后发出的文字
+type entry struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text,omitempty"`
+	Done bool      `json:"done,omitempty"` // 处理器已返回（没有发出文字时用于区分是否还在处理）
+}
+
+// New 创建指令冷却，commands 用于把别名解析为指令名
+func New(cfg *config.Config, store *storage.Storage, logger *slog.Logger, commands *core.CommandSet) *Limiter {
+	return &Limiter{cfg: cfg, store: store, logger: logger, commands: commands}
+}
+
+// Wrap 为注册在 name（指令名或别名）下的处理器加上冷却；没有配置冷却时直接返回 h
+func (l *Limiter) Wrap(name string, h core.Handler) core.Handler {
+	if len(l.cfg.Cooldowns) == 0 {
+		return h
+	}
+	return func(c core.Context) error {
+		cmd := name
+		if declared, ok := l.commands.Lookup(name); ok {
+			cmd = declared.Name
+		}
+		cooldown := l.cfg.Cooldowns[cmd]
+		if cooldown <= 0 || l.cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+			return h(c)
+		}
+
+		// 按会话和用户计算冷却，结果可能包含用户的私人数据，不回复给同群的其他人；
+		// 参数不同的指令（如 /news 科技 和 /news 体育）分别计算冷却
+		key := "cooldown:" + c.Platform() + ":" + c.Chat().ID + ":" + core.UserKey(c) + ":" + cmd
+		if fields := strings.Fields(c.Text()); len(fields) > 1 {
+			key += ":" + strings.Join(fields[1:], " ")
+		}
+		now := time.Now()
+		l.mu.Lock()
+		if prev, ok := l.get(key); ok {
+			l.mu.Unlock()
+			return l.replyRecent(c, prev, cooldown)
+		}
+		l.set(key, entry{Time: now}, cooldown)
+		l.mu.Unlock()
+
+		rc := &recordedContext{Context: c, limiter: l, key: key, start: now, cooldown: cooldown}
+		err := h(rc)
+		if err != nil {
+			// 执行失败时不计入冷却
+			_ = l.store.Delete(key)
+			return err
+		}
+		rc.finish()
+		return nil
+	}
+}
+
+func (l *Limiter) get(key string) (entry, bool) {
+	value, ok := l.store.Get(key)
+	if !ok {
+		return entry{}, false
+	}
+	var e entry
+	if err := json.Unmarshal([]byte(value), &e); err != nil {
+		return entry{}, false
+	}
+	return e, true
+}
+
+func (l *Limiter) set(key string, e entry, ttl time.Duration) {
+	data, _ := json.Marshal(e)
+	if err := l.store.SetWithTTL(key, string(data), ttl); err != nil {
+		l.logger.Error("Failed to save command cooldown", "key", key, "error", err)
+	}
+}
+
+// replyRecent 回复“刚刚才发过”，附上上次的结果；上次的指令还在处理时只提示稍候
+func (l *Limiter) replyRecent(c core.Context, prev entry, cooldown time.Duration) error {
+	lang := core.UserLang(l.cfg, l.store, c)
+	ago := short(time.Since(prev.Time))
+	wait := short(cooldown - time.Since(prev.Time))
+	switch {
+	case prev.Text == "" && prev.Done:
+		return c.Reply(i18n.T(lang, "cooldown.wait", ago, wait))
+	case prev.Text == "":
+		return c.Reply(i18n.T(lang, "cooldown.running", ago, wait))
+	}
+	return c.Reply(i18n.T(lang, "cooldown.recent", ago, wait, prev.Text))
+}
+
+// short 按秒显示时长，去掉多余的零，如 "10m"、"1m30s"
+func short(d time.Duration) string {
+	d = max(d.Round(time.Second), time.Second)
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// recordedContext 记录指令最后发出的文字，作为冷却期间重复指令的回复
+type recordedContext struct {
+	core.Context
+	limiter  *Limiter
+	key      string
+	start    time.Time
+	cooldown time.Duration
+
+	mu       sync.Mutex // 后台任务可能在处理器返回后才发出结果
+	text     string
+	returned bool
+}
+
+func (c *recordedContext) Unwrap() core.Context {
+	return c.Context
+}
+
+// out 记录发出的文字。处理器返回前（包括流式输出的多次编辑）只保存在内存中，返回时写入缓存一次；
+// 返回后发出的文字（后台任务的结果）直接写入缓存
+func (c *recordedContext) out(text string) {
+	if text == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.text = text
+	if c.returned {
+		c.save()
+	}
+}
+
+// finish 处理器成功返回后保存结果，还没有发出文字时标记为已完成
+func (c *recordedContext) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.returned = true
+	c.save()
+}
+
+// save 写入缓存，保留原来的剩余冷却时间，调用方持有 c.mu
+func (c *recordedContext) save() {
+	if ttl := c.cooldown - time.Since(c.start); ttl > 0 {
+		c.limiter.set(c.key, entry{Time: c.start, Text: c.text, Done: true}, ttl)
+	}
+}
+
+func (c *recordedContext) Reply(text string) error {
+	err := c.Context.Reply(text)
+	if err == nil {
+		c.out(text)
+	}
+	return err
+}
+
+func (c *recordedContext) Send(text string) (core.Message, error) {
+	msg, err := c.Context.Send(text)
+	if err == nil {
+		c.out(text)
+	}
+	return msg, err
+}
+
+func (c *recordedContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	msg, err := c.Context.SendButtons(text, rows)
+	if err == nil {
+		c.out(text)
+	}
+	return msg, err
+}
+
+// Edit 流式输出和占位消息只保留最终的文字
+func (c *recordedContext) Edit(msg core.Message, text string) error {
+	err := c.Context.Edit(msg, text)
+	if err == nil {
+		c.out(text)
+	}
+	return err
+}
+
+// Addressed 包装后仍能判断消息是否 @ 了机器人
+func (c *recordedContext) Addressed() bool {
+	return core.IsAddressed(c.Context)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// AdapterFactory creates a platform adapter. Returning (nil, nil) means the adapter is not configured
+// (e.g. no token) and is skipped without an error.
+type AdapterFactory func(cfg *AdapterConfig, logger *slog.Logger) (Platform, error)
+
+// AdapterConfig is what an adapter factory gets to build its platform
+type AdapterConfig struct {
+	Name    string
+	Config  *config.Config // 完整配置，内置适配器从中读取顶层配置段（如 bot、onebot）
+	Storage *storage.Storage
+	// Listed 该平台在 platforms 中显式列出，而不是按凭据自动启用
+	Listed bool
+
+	sections []*yaml.Node
+}
+
+// Decode 依次将 adapters.<name> 配置段和 platforms 中该平台的 settings 解析到 v，后者覆盖前者。
+// v 可以预先填好默认值或顶层配置段，没有配置的字段保持不变
+func (c *AdapterConfig) Decode(v any) error {
+	for _, section := range c.sections {
+		if err := section.Decode(v); err != nil {
+			return fmt.Errorf("%s config: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Configured reports whether the adapter has its own config section or settings
+func (c *AdapterConfig) Configured() bool {
+	return len(c.sections) > 0
+}
+
+var (
+	adapterMu        sync.RWMutex
+	adapterFactories = make(map[string]AdapterFactory)
+)
+
+// RegisterAdapterFactory registers an adapter under name (case-insensitive), usually from the init
+// of the adapter package, so that importing the package is enough to make it available.
+// Registering the same name twice panics.
+func RegisterAdapterFactory(name string, factory AdapterFactory) {
+	adapterMu.Lock()
+	defer adapterMu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, ok := adapterFactories[name]; ok {
+		panic("core: adapter " + name + " registered twice")
+	}
+	adapterFactories[name] = factory
+}
+
+// AdapterNames returns the registered adapter names
+func AdapterNames() []string {
+	adapterMu.RLock()
+	defer adapterMu.RUnlock()
+	return slices.Sorted(maps.Keys(adapterFactories))
+}
+
+// BuildAdapters 按 cfg.Platforms 的顺序创建启用的适配器；未配置 platforms 时尝试所有已注册的适配器，
+// 跳过未配置的。单个适配器创建失败只记录日志，不影响其他平台，有失败时同时返回错误
+func BuildAdapters(cfg *config.Config, store *storage.Storage, logger *slog.Logger) ([]Platform, error) {
+	entries := cfg.Platforms
+	listed := len(entries) > 0
+	if !listed {
+		for _, name := range AdapterNames() {
+			entries = append(entries, config.PlatformConfig{Name: name})
+		}
+	}
+
+	var platforms []Platform
+	var failed []string
+	for _, entry := range entries {
+		if !entry.IsEnabled() {
+			logger.Info("Platform disabled", "platform", entry.Name)
+			continue
+		}
+		adapterMu.RLock()
+		factory, ok := adapterFactories[entry.Name]
+		adapterMu.RUnlock()
+		if !ok {
+			logger.Error("Unknown platform", "platform", entry.Name, "available", strings.Join(AdapterNames(), ", "))
+			failed = append(failed, entry.Name)
+			continue
+		}
+
+		adapterCfg := &AdapterConfig{Name: entry.Name, Config: cfg, Storage: store, Listed: listed}
+		if section, ok := cfg.Adapters[entry.Name]; ok {
+			adapterCfg.sections = append(adapterCfg.sections, &section)
+		}
+		if entry.Settings.Kind != 0 {
+			adapterCfg.sections = append(adapterCfg.sections, &entry.Settings)
+		}
+
+		p, err := factory(adapterCfg, logger)
+		if err != nil {
+			logger.Error("Failed to init platform", "platform", entry.Name, "error", err)
+			failed = append(failed, entry.Name)
+			continue
+		}
+		if p == nil {
+			if listed {
+				logger.Warn("Platform is not configured", "platform", entry.Name)
+			}
+			continue
+		}
+		platforms = append(platforms, p)
+	}
+	if len(failed) > 0 {
+		return platforms, fmt.Errorf("platforms failed to init: %s", strings.Join(failed, ", "))
+	}
+	return platforms, nil
+}
@@ -0,0 +1,22 @@
+package core
+
+// ButtonUpdater is implemented by contexts of pressed buttons whose message can be edited in place, e.g. Telegram callbacks
+type ButtonUpdater interface {
+	UpdateButtons(text string, rows [][]Button) error
+}
+
+// UpdateButtons 把按钮所在的消息改为 text 和新的按钮，用于投票等需要刷新计数的按钮；
+// 不是按钮回调或平台不支持时返回 ErrNotSupported
+func UpdateButtons(c Context, text string, rows [][]Button) error {
+	for c != nil {
+		switch t := c.(type) {
+		case ButtonUpdater:
+			return t.UpdateButtons(text, rows)
+		case Unwrapper:
+			c = t.Unwrap()
+		default:
+			return ErrNotSupported
+		}
+	}
+	return ErrNotSupported
+}
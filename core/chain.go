@@ -0,0 +1,19 @@
+package core
+
+import "errors"
+
+// ErrPass is returned by a handler that leaves the message to the next handler in a Chain
+var ErrPass = errors.New("pass to next handler")
+
+// Chain runs handlers in order until one handles the message (returns anything but ErrPass).
+// Platforms keep a single text handler, so plugins that all look at plain text share it through a chain.
+func Chain(handlers ...Handler) Handler {
+	return func(c Context) error {
+		for _, h := range handlers {
+			if err := h(c); !errors.Is(err, ErrPass) {
+				return err
+			}
+		}
+		return nil
+	}
+}
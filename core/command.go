@@ -0,0 +1,297 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/lhpqaq/ggbot/i18n"
+)
+
+// ErrUsage can be returned by a command handler to reply with the usage of the command
+var ErrUsage = errors.New("invalid command usage")
+
+// Command 声明一条指令的语法，参数在调用处理器前统一解析和校验，格式不正确时回复用法。
+// 有子命令时第一个参数为子命令名，如 /jobs pause <任务名>
+type Command struct {
+	Name        string   // 如 "/jobs"，子命令不带 /，如 "pause"
+	Aliases     []string // 其他名称，如 "/j"、"del"
+	Description string   // 一句话说明，用于 /help 和平台的指令菜单
+	// ArgsUsage 自定义参数格式，如 "[key=值]..."，替代根据 Args 生成的格式，用于处理器自行解析参数的指令
+	ArgsUsage string
+	// Admin 仅管理员可用，/help 和指令菜单中不向普通用户显示，权限仍由处理器检查
+	Admin       bool
+	Args        []Arg
+	Subcommands []*Command
+	// Handler 没有匹配的子命令时调用，为 nil 时必须指定子命令
+	Handler func(c Context, args Args) error
+}
+
+// Arg 指令的一个参数，按空格分隔
+type Arg struct {
+	Name     string   // 显示在用法中，如 "任务名"
+	Optional bool     // 可以省略，省略的参数之后不能再有必填参数
+	Rest     bool     // 收集剩余的全部文字（保留空格），只能是最后一个参数
+	Choices  []string // 只能取这些值
+}
+
+// Args 解析后的参数，key 为 Arg.Name，省略的参数不存在
+type Args map[string]string
+
+// Has reports whether the argument was given
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// Names returns the name and aliases
+func (cmd *Command) Names() []string {
+	return append([]string{cmd.Name}, cmd.Aliases...)
+}
+
+// Handle 解析 c.Text() 中的参数并调用处理器，可直接作为 RegisterCommand 的处理器，用法提示使用平台提供的语言
+func (cmd *Command) Handle(c Context) error {
+	return cmd.handle(c, i18n.Match(c.Sender().Language))
+}
+
+// handle 同 Handle，用法提示使用 lang
+func (cmd *Command) handle(c Context, lang string) error {
+	_, rest := nextToken(c.Text())
+	return cmd.dispatch(c, lang, cmd.Name, rest)
+}
+
+func (cmd *Command) dispatch(c Context, lang, path, text string) error {
+	if len(cmd.Subcommands) > 0 {
+		token, rest := nextToken(text)
+		for _, sub := range cmd.Subcommands {
+			if slices.ContainsFunc(sub.Names(), func(name string) bool { return strings.EqualFold(name, token) }) {
+				return sub.dispatch(c, lang, path+" "+sub.Name, rest)
+			}
+		}
+		if cmd.Handler == nil || (token != "" && len(cmd.Args) == 0) {
+			return c.Reply(cmd.usageMessage(lang, path, token))
+		}
+	}
+
+	args, err := cmd.parse(lang, text)
+	if err != nil {
+		return c.Reply(err.Error() + "\n" + cmd.usageMessage(lang, path, ""))
+	}
+	err = cmd.Handler(c, args)
+	if errors.Is(err, ErrUsage) {
+		return c.Reply(cmd.usageMessage(lang, path, ""))
+	}
+	return err
+}
+
+func (cmd *Command) parse(lang, text string) (Args, error) {
+	args := make(Args)
+	for _, arg := range cmd.Args {
+		var value string
+		if arg.Rest {
+			value = strings.TrimSpace(text)
+			text = ""
+		} else {
+			value, text = nextToken(text)
+		}
+		if value == "" {
+			if !arg.Optional {
+				return nil, errors.New(i18n.T(lang, "command.missing", arg.Name))
+			}
+			continue
+		}
+		if len(arg.Choices) > 0 && !slices.Contains(arg.Choices, value) {
+			return nil, errors.New(i18n.T(lang, "command.choices", arg.Name, strings.Join(arg.Choices, "|")))
+		}
+		args[arg.Name] = value
+	}
+	if extra, _ := nextToken(text); extra != "" {
+		return nil, errors.New(i18n.T(lang, "command.extra", strings.TrimSpace(text)))
+	}
+	return args, nil
+}
+
+// textContext 替换了消息文字的上下文，用于把自然语言消息作为指令执行
+type textContext struct {
+	Context
+	text string
+}
+
+// WithText 返回文字替换为 text 的上下文，如把连续发送的多条消息合并为一次提问
+func WithText(c Context, text string) Context {
+	return textContext{Context: c, text: text}
+}
+
+func (c textContext) Text() string {
+	return c.text
+}
+
+func (c textContext) Unwrap() Context {
+	return c.Context
+}
+
+// nextToken 返回第一个以空白分隔的词和剩余的文字
+func nextToken(text string) (string, string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return text, ""
+	}
+	return text[:end], text[end:]
+}
+
+// Usage 返回指令的每种用法，如 "/jobs pause <任务名>"
+func (cmd *Command) Usage() []string {
+	return cmd.usage(cmd.Name)
+}
+
+func (cmd *Command) usage(path string) []string {
+	var lines []string
+	if cmd.Handler != nil {
+		lines = append(lines, path+cmd.syntax())
+	}
+	for _, sub := range cmd.Subcommands {
+		lines = append(lines, sub.usage(path+" "+sub.Name)...)
+	}
+	return lines
+}
+
+func (cmd *Command) usageMessage(lang, path, unknown string) string {
+	var b strings.Builder
+	if unknown != "" {
+		b.WriteString(i18n.T(lang, "command.unknown", unknown) + "\n")
+	}
+	b.WriteString(i18n.T(lang, "command.usage_label"))
+	for _, line := range cmd.usage(path) {
+		b.WriteString("\n" + line)
+	}
+	return b.String()
+}
+
+// Describe 返回指令在 lang 中的说明，语言包中的 "command.<去掉 / 的名称>" 优先于 Description
+func (cmd *Command) Describe(lang string) string {
+	if text, ok := i18n.Lookup(lang, "command."+strings.TrimPrefix(cmd.Name, "/")); ok {
+		return text
+	}
+	return cmd.Description
+}
+
+// syntax 返回指令自身的参数格式，以空格开头，没有参数时为空
+func (cmd *Command) syntax() string {
+	if cmd.ArgsUsage != "" {
+		return " " + cmd.ArgsUsage
+	}
+	var b strings.Builder
+	for _, arg := range cmd.Args {
+		b.WriteString(" " + arg.syntax())
+	}
+	return b.String()
+}
+
+func (a Arg) syntax() string {
+	name := a.Name
+	if len(a.Choices) > 0 {
+		name = strings.Join(a.Choices, "|")
+	}
+	if a.Rest {
+		name += "..."
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// CommandSet 已声明的指令，用于生成 /help
+type CommandSet struct {
+	mu       sync.RWMutex
+	commands []*Command
+	// handlers 各指令名的处理器，已经过路由和冷却包装，不含 guard 和消息记录
+	handlers map[string]Handler
+}
+
+// Add 添加指令，同名指令以后添加的为准
+func (s *CommandSet) Add(cmd *Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = slices.DeleteFunc(s.commands, func(c *Command) bool { return c.Name == cmd.Name })
+	s.commands = append(s.commands, cmd)
+}
+
+// Lookup returns the command with the name or alias
+func (s *CommandSet) Lookup(name string) (*Command, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, cmd := range s.commands {
+		if slices.Contains(cmd.Names(), name) {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// Remove 删除指令和它的名称、别名注册的处理器，用于运行中增减的指令（如 MCP 提示词）
+func (s *CommandSet) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.commands, func(c *Command) bool { return c.Name == name })
+	if i < 0 {
+		return
+	}
+	for _, n := range s.commands[i].Names() {
+		delete(s.handlers, n)
+	}
+	s.commands = slices.Delete(s.commands, i, i+1)
+}
+
+// SetHandler 记录指令的处理器（不含 guard 和消息记录），RunCommand 和平台开始接收消息后注册的指令通过它执行
+func (s *CommandSet) SetHandler(name string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = map[string]Handler{}
+	}
+	s.handlers[name] = h
+}
+
+// Handler 返回指令名注册的处理器
+func (s *CommandSet) Handler(name string) (Handler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.handlers[name]
+	return h, ok
+}
+
+// List returns the commands in the order they were added
+func (s *CommandSet) List() []*Command {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.commands)
+}
+
+// Visible returns the commands shown to the caller, admin commands only when admin is true
+func (s *CommandSet) Visible(admin bool) []*Command {
+	return slices.DeleteFunc(s.List(), func(cmd *Command) bool { return cmd.Admin && !admin })
+}
+
+// Help 生成调用者可用的指令列表，每条指令一行；有子命令的指令只列出名称，参数格式见其用法
+func (s *CommandSet) Help(lang string, admin bool) string {
+	var b strings.Builder
+	for _, cmd := range s.Visible(admin) {
+		line := cmd.Name
+		if len(cmd.Subcommands) == 0 {
+			line += cmd.syntax()
+		}
+		fmt.Fprintf(&b, "%s - %s\n", line, cmd.Describe(lang))
+	}
+	return b.String()
+}
+
+// CommandMenu is implemented by platforms that show a command menu in the client, e.g. Telegram setMyCommands
+type CommandMenu interface {
+	// SetCommands replaces the menu with the commands, called once after all plugins are loaded
+	SetCommands(cmds []*Command) error
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// SendEphemeral sends a message that deletes itself after ttl, for prompts and warnings that shouldn't clutter the chat.
+// The message stays where the platform cannot delete messages; ttl <= 0 keeps it.
+func SendEphemeral(c Context, text string, ttl time.Duration) (Message, error) {
+	msg, err := c.Send(text)
+	if err != nil || ttl <= 0 {
+		return msg, err
+	}
+	time.AfterFunc(ttl, func() {
+		if err := c.Delete(msg); err != nil && !errors.Is(err, ErrNotSupported) {
+			slog.Warn("Failed to delete ephemeral message", "platform", c.Platform(), "error", err)
+		}
+	})
+	return msg, nil
+}
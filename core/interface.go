@@ -1,24 +1,56 @@
 package core
 
 import (
+	"errors"
+	"io"
 	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/lhpqaq/ggbot/alert"
+	"github.com/lhpqaq/ggbot/anonymize"
+	"github.com/lhpqaq/ggbot/backup"
 	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/scheduler"
+	"github.com/lhpqaq/ggbot/stats"
 	"github.com/lhpqaq/ggbot/storage"
+	"github.com/lhpqaq/ggbot/tasks"
 )
 
+// ErrNotSupported is returned by actions the platform cannot perform
+var ErrNotSupported = errors.New("not supported by this platform")
+
+// ErrPermanent 重试也不会成功的发送错误（目标格式错误、平台不支持主动推送等），发件箱不重试，直接返回给调用方
+var ErrPermanent = errors.New("permanent send failure")
+
+// Permanent 将 err 标记为 ErrPermanent，错误信息不变
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type permanentError struct{ error }
+
+func (e permanentError) Is(target error) bool { return target == ErrPermanent }
+
+func (e permanentError) Unwrap() error { return e.error }
+
 // Platform represents a bot platform (Telegram, QQ, etc.)
 type Platform interface {
 	Name() string
 	Start() error
 	Stop() error
-	
+
 	// Registration
 	RegisterCommand(cmd string, handler Handler)
 	RegisterText(handler Handler)
-    
-    // Actions
-    SendTo(recipient string, text string) error
+	RegisterDocument(handler Handler)
+	RegisterPhoto(handler Handler)
+	// RegisterCallback handles presses of buttons whose Name matches name
+	RegisterCallback(name string, handler Handler)
+
+	// Actions
+	SendTo(recipient string, text string) error
 }
 
 // Handler is a function that handles a generic context
@@ -28,17 +60,60 @@ type Handler func(Context) error
 type Context interface {
 	// Basic Info
 	Sender() *User
+	Chat() *Chat
 	Text() string
-	
+
+	// Data returns the payload of a pressed button, empty for normal messages
+	Data() string
+
+	// Document returns the file attached to the message, or nil
+	Document() *Document
+	// Photo returns the image attached to the message (largest size), or nil
+	Photo() *Document
+	// Download opens the content of an incoming document or photo
+	Download(doc *Document) (io.ReadCloser, error)
+
 	// Actions
 	Reply(text string) error
 	Send(text string) (Message, error)
 	Edit(msg Message, text string) error
-	
+	// Delete removes a message sent by the bot, ErrNotSupported where the platform cannot delete it
+	Delete(msg Message) error
+	SendFile(file *File) error
+	// SendButtons sends text with rows of inline buttons
+	SendButtons(text string, rows [][]Button) (Message, error)
+	// React adds an emoji reaction to the incoming message
+	React(emoji string) error
+	// Notify shows a chat action such as "typing" for a few seconds
+	Notify(action ChatAction) error
+	// Member looks up a member of the current chat, ErrNotSupported where the platform has no member API
+	Member(userID string) (*Member, error)
+
 	// Platform specifics (if needed for advanced usage)
 	Platform() string
 }
 
+// NoEdit is implemented by contexts of platforms that cannot edit messages, where Edit sends a new message (QQ, OneBot, email)
+type NoEdit interface {
+	NoEdit()
+}
+
+// CanEdit reports whether Edit changes the message in place, looking through wrapping contexts.
+// Progress updates should be skipped where it cannot, each of them would be a new message
+func CanEdit(c Context) bool {
+	for c != nil {
+		switch t := c.(type) {
+		case NoEdit:
+			return false
+		case Unwrapper:
+			c = t.Unwrap()
+		default:
+			return true
+		}
+	}
+	return true
+}
+
 // Message represents a sent message (for editing)
 type Message interface {
 	ID() string
@@ -48,6 +123,55 @@ type User struct {
 	ID       string
 	Username string
 	IsBot    bool
+	Language string // 客户端语言，如 "en"、"zh-hans"，平台不提供时为空
+}
+
+// UserKey 发送者在存储中的 key，格式 "Platform:UserID"，用户设置、用量、知识库等都按它保存
+func UserKey(c Context) string {
+	return c.Platform() + ":" + c.Sender().ID
+}
+
+// Chat identifies the conversation a message was received in
+type Chat struct {
+	ID       string
+	Type     string // "private", "group" or "channel"
+	ThreadID string // Forum topic (Telegram), empty outside topics
+}
+
+// ChatAction is a transient status shown to the user while the bot works
+type ChatAction string
+
+const (
+	ActionTyping      ChatAction = "typing"
+	ActionUploadPhoto ChatAction = "upload_photo"
+)
+
+// Button is an inline button; pressing it runs the callback registered under Name with Data
+type Button struct {
+	Text string
+	Name string
+	Data string
+}
+
+// Document describes a file received from a user
+type Document struct {
+	ID       string // Platform file reference (Telegram file_id, QQ attachment URL)
+	Name     string
+	MIMEType string
+	Size     int64
+}
+
+// File is an outgoing file, e.g. a report generated by a tool
+type File struct {
+	Name     string
+	MIMEType string
+	Data     []byte
+	Caption  string
+}
+
+// IsImage reports whether the file should be delivered as a photo
+func (f *File) IsImage() bool {
+	return strings.HasPrefix(f.MIMEType, "image/")
 }
 
 // PluginContext is passed to plugins to initialize
@@ -55,15 +179,109 @@ type PluginContext struct {
 	Config  *config.Config
 	Storage *storage.Storage
 	Logger  *slog.Logger
+	Tasks   *tasks.Manager
+	Alerts  *alert.Manager
+	// Scheduler runs periodic jobs such as pushes, managed with /jobs
+	Scheduler *scheduler.Scheduler
+	// Anonymizer hashes user IDs in exported diagnostics
+	Anonymizer *anonymize.Anonymizer
+	// Backups 存储备份，/backup now 立即备份
+	Backups *backup.Manager
+	// Stats 运行统计，/stats 查看
+	Stats *stats.Stats
 	// Platforms allows plugins to register handlers on all platforms
-	RegisterCommand func(cmd string, h Handler)
-	RegisterText    func(h Handler)
-    
-    // SendTo allows plugins to send messages to specific targets (e.g. "Telegram:123")
-    SendTo func(recipient string, text string) error
+	RegisterCommand  func(cmd string, h Handler)
+	RegisterText     func(h Handler)
+	RegisterDocument func(h Handler)
+	RegisterPhoto    func(h Handler)
+	RegisterCallback func(name string, h Handler)
+	// RegisterMemberEvent 处理成员加入、离开群组，只在支持的平台（core.MemberEvents）上生效
+	RegisterMemberEvent func(h MemberHandler)
+	// RegisterPayment 处理用户完成的付款，只在支持的平台（core.Payments）上生效
+	RegisterPayment func(h PaymentHandler)
+	// Commands holds the declared commands, used to generate /help
+	Commands *CommandSet
+	// UserData 插件在存储之外保存的用户数据，/export 导出、/forgetme 删除
+	UserData *UserDataSet
+
+	// SendTo allows plugins to send messages to specific targets (e.g. "Telegram:123")
+	SendTo func(recipient string, text string) error
+	// Push 发送定时推送和 Webhook 等主动消息，与 SendTo 相同但遵守 quiet_hours 的安静时段
+	Push func(recipient string, text string) error
+}
+
+// AddCommand declares a command and registers it under its name and aliases on all platforms
+func (ctx *PluginContext) AddCommand(cmd *Command) {
+	ctx.Commands.Add(cmd)
+	for _, name := range cmd.Names() {
+		ctx.RegisterCommand(name, func(c Context) error {
+			return cmd.handle(c, ctx.Lang(c))
+		})
+	}
+}
+
+// RunCommand 把 text（如 "/news 科技"）作为消息 c 的文字执行已注册的指令，指令不存在时返回 false。
+// 路由表和冷却同样生效；c 已经过 guard 和消息记录，执行指令时不再重复
+func (ctx *PluginContext) RunCommand(c Context, text string) (bool, error) {
+	name, _ := nextToken(text)
+	h, ok := ctx.Commands.Handler(name)
+	if !ok {
+		return false, nil
+	}
+	return true, h(textContext{Context: c, text: text})
+}
+
+// Lang 返回回复用户时使用的语言，见 UserLang
+func (ctx *PluginContext) Lang(c Context) string {
+	return UserLang(ctx.Config, ctx.Storage, c)
+}
+
+// UserLang 返回回复用户时使用的语言：/lang 设置的语言优先，其次是平台提供的客户端语言，最后是 bot.language
+func UserLang(cfg *config.Config, s *storage.Storage, c Context) string {
+	if lang := i18n.Match(s.GetUserProfile(UserKey(c)).Language); lang != "" {
+		return lang
+	}
+	if lang := i18n.Match(c.Sender().Language); lang != "" {
+		return lang
+	}
+	return cfg.Bot.Language
+}
+
+// Location 返回发送者的时区，见 UserLocation
+func (ctx *PluginContext) Location(c Context) *time.Location {
+	return UserLocation(ctx.Storage, UserKey(c))
+}
+
+// UserLocation 返回用户 /tz 设置的时区，未设置或无效时为服务器本地时区
+func UserLocation(s *storage.Storage, userKey string) *time.Location {
+	if name := s.GetUserProfile(userKey).Timezone; name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// CanManageChat 发送者能否修改当前会话的设置：私聊、机器人管理员，或平台上的群主/群管理员
+func (ctx *PluginContext) CanManageChat(c Context) bool {
+	if c.Chat().Type == "private" || ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return true
+	}
+	member, err := c.Member(c.Sender().ID)
+	return err == nil && member.IsChatAdmin()
+}
+
+// T 返回 key 在用户语言中的文字，见 i18n.T
+func (ctx *PluginContext) T(c Context, key string, args ...any) string {
+	return i18n.T(ctx.Lang(c), key, args...)
 }
 
 type Plugin interface {
 	Name() string
 	Init(ctx *PluginContext) error
-}
\ No newline at end of file
+}
+
+// Cleaner is implemented by plugins that hold connections or goroutines to release on shutdown
+type Cleaner interface {
+	Cleanup() error
+}
@@ -0,0 +1,16 @@
+package core
+
+// MemberEvent 成员加入或离开群组
+type MemberEvent struct {
+	Joined bool    // 加入为 true，离开或被移出为 false
+	Member *Member // 加入或离开的成员
+	Self   bool    // 是机器人自己被拉进或移出群组
+}
+
+// MemberHandler handles a member joining or leaving; c is the context of the group the event happened in
+type MemberHandler func(c Context, event MemberEvent) error
+
+// MemberEvents is implemented by platforms that report members joining and leaving group chats, e.g. Telegram
+type MemberEvents interface {
+	RegisterMemberEvent(h MemberHandler)
+}
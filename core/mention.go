@@ -0,0 +1,72 @@
+package core
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// mentionRegex matches mentions composed with Mention: <@userID|name>
+var mentionRegex = regexp.MustCompile(`<@([^|>\s]+)(?:\|([^>]*))?>`)
+
+// Member is a member of a group or channel
+type Member struct {
+	User
+	Nickname string   // Display name in the chat
+	Roles    []string // Platform roles, e.g. "administrator" (Telegram) or role IDs (QQ guild)
+	JoinedAt time.Time
+}
+
+// Mention composes an @-mention of a user for outgoing text.
+// Adapters render it as a real mention (QQ 群/频道 @，Telegram text_mention), or as the plain name where mentions are not possible.
+func Mention(userID, name string) string {
+	name = strings.NewReplacer("<", "", ">", "", "|", "").Replace(name)
+	return "<@" + userID + "|" + name + ">"
+}
+
+// RenderMentions replaces mentions in text with render(userID, name)
+func RenderMentions(text string, render func(userID, name string) string) string {
+	if !strings.Contains(text, "<@") {
+		return text
+	}
+	return mentionRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := mentionRegex.FindStringSubmatch(m)
+		return render(sub[1], sub[2])
+	})
+}
+
+// MentionName is the plain text of a mention, used where mentions cannot be rendered
+func MentionName(userID, name string) string {
+	if name == "" {
+		name = userID
+	}
+	return "@" + name
+}
+
+// adminRoles Member.Roles 中表示群主或管理员的角色（Telegram、OneBot、WhatsApp）
+var adminRoles = []string{"creator", "administrator", "owner", "admin", "superadmin"}
+
+// IsChatAdmin reports whether the member owns or administers the chat
+func (m *Member) IsChatAdmin() bool {
+	for _, role := range m.Roles {
+		if slices.Contains(adminRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Addressed is implemented by contexts that know whether a group message @-mentions or replies to the bot
+type Addressed interface {
+	Addressed() bool
+}
+
+// IsAddressed 消息是否是对机器人说的：私聊、指令、@机器人或回复机器人的消息；无法判断的平台视为是
+func IsAddressed(c Context) bool {
+	if c.Chat().Type == "private" || strings.HasPrefix(c.Text(), "/") {
+		return true
+	}
+	a, ok := c.(Addressed)
+	return !ok || a.Addressed()
+}
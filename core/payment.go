@@ -0,0 +1,48 @@
+package core
+
+// Invoice 发给用户的付款请求
+type Invoice struct {
+	Title       string
+	Description string
+	Payload     string // 付款成功后原样带回，用于识别购买的商品
+	Currency    string // "XTR" 为 Telegram Stars
+	Amount      int    // 货币的最小单位
+	// ProviderToken 支付服务商的 token，Telegram Stars 为空
+	ProviderToken string
+}
+
+// Payment 用户完成的付款
+type Payment struct {
+	Payload  string
+	Currency string
+	Amount   int
+	ChargeID string // 平台的付款 ID，用于去重和退款
+}
+
+// PaymentHandler handles a successful payment; c is the context of the payment message
+type PaymentHandler func(c Context, p Payment) error
+
+// Payments is implemented by platforms that accept payments, e.g. Telegram Stars
+type Payments interface {
+	RegisterPayment(h PaymentHandler)
+}
+
+// Invoicer is implemented by contexts that can send invoices
+type Invoicer interface {
+	SendInvoice(inv Invoice) error
+}
+
+// SendInvoice 向会话发送付款请求，平台不支持时返回 ErrNotSupported
+func SendInvoice(c Context, inv Invoice) error {
+	for c != nil {
+		switch t := c.(type) {
+		case Invoicer:
+			return t.SendInvoice(inv)
+		case Unwrapper:
+			c = t.Unwrap()
+		default:
+			return ErrNotSupported
+		}
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+)
+
+// requestIDKey 请求 ID 在消息的 context.Context 中的 key
+type requestIDKey struct{}
+
+// NewRequestID returns a random ID identifying one incoming message or AI request
+func NewRequestID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID 为每条收到的消息分配请求 ID，处理器通过 RequestID 取得，用 Logger 在日志中带上它，
+// 并发用户交错的日志可以按请求 ID 关联起来。处理器返回的错误带有请求 ID，适配器记录时用 ErrorRequestID 取出
+func WithRequestID(logger *slog.Logger, h Handler) Handler {
+	return func(c Context) error {
+		if RequestID(c) != "" {
+			return h(c)
+		}
+		id := NewRequestID()
+		logger.Debug("Message received", "request_id", id, "platform", c.Platform(), "chat", c.Chat().ID, "user", c.Sender().ID)
+		err := h(WithTrace(c, context.WithValue(TraceContext(c), requestIDKey{}, id), false))
+		if err != nil && !errors.Is(err, ErrPass) {
+			err = &requestError{id: id, err: err}
+		}
+		return err
+	}
+}
+
+// RequestID 返回消息的请求 ID，没有经过 WithRequestID 时为空
+func RequestID(c Context) string {
+	return ContextRequestID(TraceContext(c))
+}
+
+// ContextRequestID 返回 ctx 所属消息的请求 ID，用于只拿到 context.Context 的地方（如工具调用）
+func ContextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logger 返回带上消息请求 ID 的 logger
+func Logger(c Context, logger *slog.Logger) *slog.Logger {
+	return ContextLogger(TraceContext(c), logger)
+}
+
+// ContextLogger 返回带上 ctx 所属消息请求 ID 的 logger，没有请求 ID 时返回 logger
+func ContextLogger(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	if id := ContextRequestID(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// requestError 处理器返回的错误，附带请求 ID
+type requestError struct {
+	id  string
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// ErrorRequestID 返回处理器错误所属的请求 ID，没有时为空
+func ErrorRequestID(err error) string {
+	var re *requestError
+	if errors.As(err, &re) {
+		return re.id
+	}
+	return ""
+}
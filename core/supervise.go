@@ -0,0 +1,129 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	minRestartDelay = 500 * time.Millisecond
+	maxRestartDelay = time.Minute
+	// stableAfter 重启后持续运行这么久视为已恢复，退避时间重新计算
+	stableAfter = 30 * time.Second
+)
+
+// LoopEvent 平台接收循环退出或恢复
+type LoopEvent struct {
+	Platform string
+	Err      error         // 循环退出的原因，恢复时为 nil
+	Restarts int           // 连续重启的次数
+	Delay    time.Duration // 下次重启前的等待时间
+}
+
+// Supervised is implemented by platforms whose receive loop is restarted by a Supervisor, so main can alert admins
+type Supervised interface {
+	OnLoopEvent(func(LoopEvent))
+}
+
+// Supervisor 在后台运行平台的接收循环（Telegram 轮询、QQ 会话等），循环返回或 panic 时按指数退避重启，
+// 避免某个平台静默停止处理消息
+type Supervisor struct {
+	Platform string
+	Logger   *slog.Logger
+
+	mu     sync.Mutex
+	notify func(LoopEvent)
+	stop   chan struct{}
+}
+
+// OnLoopEvent 设置循环退出和恢复时的回调
+func (s *Supervisor) OnLoopEvent(f func(LoopEvent)) {
+	s.mu.Lock()
+	s.notify = f
+	s.mu.Unlock()
+}
+
+// Run 在后台运行 loop，直到 Stop。loop 应阻塞运行，stop 关闭时返回
+func (s *Supervisor) Run(loop func(stop <-chan struct{}) error) {
+	s.mu.Lock()
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.mu.Unlock()
+
+	go func() {
+		delay := minRestartDelay
+		restarts := 0
+		for {
+			done := make(chan error, 1)
+			go func() { done <- protect(loop, stop) }()
+
+			stable := time.NewTimer(stableAfter)
+			var err error
+		wait:
+			for {
+				select {
+				case err = <-done:
+					break wait
+				case <-stable.C:
+					if restarts > 0 {
+						s.Logger.Info("Platform loop recovered", "platform", s.Platform, "restarts", restarts)
+						s.emit(LoopEvent{Platform: s.Platform, Restarts: restarts})
+					}
+					delay, restarts = minRestartDelay, 0
+				}
+			}
+			stable.Stop()
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err == nil {
+				err = errors.New("receive loop exited")
+			}
+			restarts++
+			s.Logger.Error("Platform loop stopped, restarting", "platform", s.Platform, "error", err, "restarts", restarts, "delay", delay)
+			s.emit(LoopEvent{Platform: s.Platform, Err: err, Restarts: restarts, Delay: delay})
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRestartDelay)
+		}
+	}()
+}
+
+// Stop 停止重启循环，正在运行的 loop 通过 stop 通道得知退出
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Supervisor) emit(event LoopEvent) {
+	s.mu.Lock()
+	notify := s.notify
+	s.mu.Unlock()
+	if notify != nil {
+		notify(event)
+	}
+}
+
+// protect 运行 loop，panic 转为错误
+func protect(loop func(stop <-chan struct{}) error, stop <-chan struct{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return loop(stop)
+}
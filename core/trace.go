@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 未启用 tracing 时为 no-op
+var tracer = otel.Tracer("github.com/lhpqaq/ggbot/core")
+
+// Unwrapper is implemented by contexts that wrap another Context, so TraceContext can look through them
+type Unwrapper interface {
+	Unwrap() Context
+}
+
+// tracedContext 携带消息处理的 context.Context（trace、请求 ID）。sends 为 true 时，发送、编辑消息会记录为 span
+type tracedContext struct {
+	Context
+	ctx   context.Context
+	sends bool
+}
+
+// WithTrace 返回携带 ctx 的上下文，处理器通过 TraceContext 取出，模型请求、工具调用的 span 挂在它下面。
+// sends 为 true 时记录发送回复的 span，一条消息只应由一层上下文记录
+func WithTrace(c Context, ctx context.Context, sends bool) Context {
+	return &tracedContext{Context: c, ctx: ctx, sends: sends}
+}
+
+// TraceContext 返回消息处理的 context.Context（带当前 span 和请求 ID），没有时返回 context.Background()
+func TraceContext(c Context) context.Context {
+	for c != nil {
+		switch t := c.(type) {
+		case *tracedContext:
+			return t.ctx
+		case Unwrapper:
+			c = t.Unwrap()
+		default:
+			return context.Background()
+		}
+	}
+	return context.Background()
+}
+
+func (c *tracedContext) Unwrap() Context {
+	return c.Context
+}
+
+// span 开始一个发送消息的 span，返回结束它的函数
+func (c *tracedContext) span(name string) func(error) {
+	if !c.sends {
+		return func(error) {}
+	}
+	_, span := tracer.Start(c.ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("ggbot.platform", c.Platform())))
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (c *tracedContext) Reply(text string) error {
+	end := c.span("reply")
+	err := c.Context.Reply(text)
+	end(err)
+	return err
+}
+
+func (c *tracedContext) Send(text string) (Message, error) {
+	end := c.span("send")
+	msg, err := c.Context.Send(text)
+	end(err)
+	return msg, err
+}
+
+func (c *tracedContext) Edit(msg Message, text string) error {
+	end := c.span("edit")
+	err := c.Context.Edit(msg, text)
+	end(err)
+	return err
+}
+
+func (c *tracedContext) SendFile(file *File) error {
+	end := c.span("send_file")
+	err := c.Context.SendFile(file)
+	end(err)
+	return err
+}
+
+func (c *tracedContext) SendButtons(text string, rows [][]Button) (Message, error) {
+	end := c.span("send_buttons")
+	msg, err := c.Context.SendButtons(text, rows)
+	end(err)
+	return msg, err
+}
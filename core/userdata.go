@@ -0,0 +1,60 @@
+package core
+
+import (
+	"errors"
+	"sync"
+)
+
+// UserDataProvider 插件保存在存储之外的用户数据（如内存中的对话记忆、知识库），用于 /export 和 /forgetme
+type UserDataProvider struct {
+	Name string
+	// Export returns the data of userKey ("Platform:UserID"), nil if there is none
+	Export func(userKey string) any
+	// Forget deletes the data of userKey
+	Forget func(userKey string) error
+}
+
+// UserDataSet holds the registered providers, shared by all plugins
+type UserDataSet struct {
+	mu        sync.RWMutex
+	providers []UserDataProvider
+}
+
+// Add registers a provider
+func (s *UserDataSet) Add(p UserDataProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providers = append(s.providers, p)
+}
+
+// Export collects the data of userKey from every provider, provider name → data
+func (s *UserDataSet) Export(userKey string) map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data := map[string]any{}
+	for _, p := range s.providers {
+		if p.Export == nil {
+			continue
+		}
+		if d := p.Export(userKey); d != nil {
+			data[p.Name] = d
+		}
+	}
+	return data
+}
+
+// Forget deletes the data of userKey from every provider, it keeps going after a failure
+func (s *UserDataSet) Forget(userKey string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var errs []error
+	for _, p := range s.providers {
+		if p.Forget == nil {
+			continue
+		}
+		if err := p.Forget(userKey); err != nil {
+			errs = append(errs, errors.New(p.Name+": "+err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
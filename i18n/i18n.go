@@ -0,0 +1,86 @@
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default 没有设置语言、或语言包缺少某条文字时使用的语言
+const Default = "zh"
+
+//go:embed locales/*.yaml
+var localesFS embed.FS
+
+// packs 语言代码 → 消息 key → 文字，key 按模块分组，如 "system.ping"
+var packs = map[string]map[string]string{}
+
+func init() {
+	files, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := localesFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		pack := map[string]string{}
+		if err := yaml.Unmarshal(data, &pack); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", f.Name(), err))
+		}
+		packs[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = pack
+	}
+}
+
+// Languages returns the supported language codes, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(packs))
+	for lang := range packs {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// Name returns the display name of a language, e.g. "English"
+func Name(lang string) string {
+	return T(lang, "language.name")
+}
+
+// Match 将平台提供的语言代码（如 "en-US"、"zh-hans"）对应到支持的语言，不支持时返回空
+func Match(code string) string {
+	code = strings.ToLower(code)
+	if base, _, ok := strings.Cut(strings.ReplaceAll(code, "_", "-"), "-"); ok {
+		code = base
+	}
+	if _, ok := packs[code]; ok {
+		return code
+	}
+	return ""
+}
+
+// Lookup returns the text of key in lang, falling back to the default language
+func Lookup(lang, key string) (string, bool) {
+	if text, ok := packs[lang][key]; ok {
+		return text, true
+	}
+	text, ok := packs[Default][key]
+	return text, ok
+}
+
+// T 返回 key 在 lang 中的文字，有 args 时按 fmt.Sprintf 格式化；找不到时返回 key 本身，便于发现遗漏
+func T(lang, key string, args ...any) string {
+	text, ok := Lookup(lang, key)
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
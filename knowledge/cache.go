@@ -0,0 +1,111 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// CacheEntry 一条缓存的问答
+type CacheEntry struct {
+	ID       string
+	Chat     string
+	Question string
+	Answer   string
+	Vector   []float32
+	Time     time.Time
+}
+
+// Cache 语义缓存：按会话保存近期问题的向量和回答，非常相似的问题直接复用回答，只保存在内存中
+type Cache struct {
+	mu       sync.Mutex
+	cfg      config.SemanticCacheConfig
+	embedder *Embedder
+	seq      int
+	entries  map[string][]*CacheEntry // chat -> entries, oldest first
+}
+
+func NewCache(cfg config.SemanticCacheConfig) *Cache {
+	return &Cache{
+		cfg:      cfg,
+		embedder: NewEmbedder(cfg.BaseURL, cfg.APIKey, cfg.Model),
+		entries:  make(map[string][]*CacheEntry),
+	}
+}
+
+// Embed returns the vector of a question, used for both Lookup and Store
+func (c *Cache) Embed(ctx context.Context, question string) ([]float32, error) {
+	vectors, err := c.embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// Lookup returns the most similar unexpired entry of the chat with score >= Threshold
+func (c *Cache) Lookup(chat string, vector []float32) (*CacheEntry, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(chat)
+
+	var best *CacheEntry
+	var bestScore float64
+	for _, e := range c.entries[chat] {
+		if score := Cosine(vector, e.Vector); score >= c.cfg.Threshold && score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best, bestScore
+}
+
+// Store caches an answer, dropping the oldest entries beyond MaxEntries
+func (c *Cache) Store(chat, question, answer string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(chat)
+
+	c.seq++
+	c.entries[chat] = append(c.entries[chat], &CacheEntry{
+		ID:       fmt.Sprintf("q%d", c.seq),
+		Chat:     chat,
+		Question: question,
+		Answer:   answer,
+		Vector:   vector,
+		Time:     time.Now(),
+	})
+	if n := len(c.entries[chat]); n > c.cfg.MaxEntries {
+		c.entries[chat] = c.entries[chat][n-c.cfg.MaxEntries:]
+	}
+}
+
+// Take removes and returns an entry of the chat, nil if it expired or does not exist
+func (c *Cache) Take(chat, id string) *CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, e := range c.entries[chat] {
+		if e.ID == id {
+			c.entries[chat] = append(c.entries[chat][:i:i], c.entries[chat][i+1:]...)
+			return e
+		}
+	}
+	return nil
+}
+
+// expire drops entries older than TTL. Callers hold c.mu.
+func (c *Cache) expire(chat string) {
+	entries := c.entries[chat]
+	cutoff := time.Now().Add(-c.cfg.TTL)
+	i := 0
+	for i < len(entries) && entries[i].Time.Before(cutoff) {
+		i++
+	}
+	if i == len(entries) {
+		delete(c.entries, chat)
+		return
+	}
+	c.entries[chat] = entries[i:]
+}
@@ -0,0 +1,70 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxPageSize 导入网页的最大字节数
+const maxPageSize = 5 << 20
+
+var (
+	titleRegex      = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	invisibleRegex  = regexp.MustCompile(`(?is)<(script|style|noscript|head|svg)[^>]*>.*?</(script|style|noscript|head|svg)>`)
+	blockRegex      = regexp.MustCompile(`(?i)</?(p|div|br|li|h[1-6]|tr|section|article|pre)[^>]*>`)
+	tagRegex        = regexp.MustCompile(`(?s)<[^>]+>`)
+	blankLinesRegex = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// FetchURL 下载网页或纯文本并提取正文，返回标题（没有时为 URL）和文本
+func (b *Base) FetchURL(ctx context.Context, url string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetch failed with status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", "", err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "html") {
+		if !strings.HasPrefix(contentType, "text/") && !strings.Contains(contentType, "json") {
+			return "", "", fmt.Errorf("unsupported content type %q", contentType)
+		}
+		return url, string(data), nil
+	}
+
+	page := string(data)
+	title := url
+	if m := titleRegex.FindStringSubmatch(page); m != nil {
+		if t := strings.TrimSpace(html.UnescapeString(m[1])); t != "" {
+			title = t
+		}
+	}
+	return title, htmlText(page), nil
+}
+
+// htmlText 粗略地从 HTML 中提取可见文本
+func htmlText(page string) string {
+	page = invisibleRegex.ReplaceAllString(page, "")
+	page = blockRegex.ReplaceAllString(page, "\n")
+	page = tagRegex.ReplaceAllString(page, "")
+	page = html.UnescapeString(page)
+	page = blankLinesRegex.ReplaceAllString(page, "\n\n")
+	return strings.TrimSpace(page)
+}
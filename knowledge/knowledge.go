@@ -0,0 +1,282 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/safehttp"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// ErrTooManyDocuments is returned by Add when the owner reached MaxDocuments
+var ErrTooManyDocuments = errors.New("too many documents in knowledge base")
+
+// Chunk 文档片段及其向量
+type Chunk struct {
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// Document 知识库中的一篇文档
+type Document struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Source  string    `json:"source"` // 文件名或 URL
+	AddedAt time.Time `json:"added_at"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+// Result 一条检索结果
+type Result struct {
+	Document string
+	Text     string
+	Score    float64
+}
+
+// Base 按用户隔离的知识库，向量保存在本地 JSON 文件中，检索时在内存中计算余弦相似度
+type Base struct {
+	mu       sync.RWMutex
+	cfg      config.KnowledgeConfig
+	client   *http.Client
+	embedder *Embedder
+
+	Seq  int                    `json:"seq"`
+	Docs map[string][]*Document `json:"docs"` // owner -> documents
+}
+
+func New(cfg config.KnowledgeConfig) (*Base, error) {
+	b := &Base{
+		cfg:      cfg,
+		client:   safehttp.NewClient(60*time.Second, nil),
+		embedder: NewEmbedder(cfg.BaseURL, cfg.APIKey, cfg.Model),
+		Docs:     make(map[string][]*Document),
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Docs == nil {
+		b.Docs = make(map[string][]*Document)
+	}
+	return b, nil
+}
+
+func (b *Base) save() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(b.cfg.Path, data, 0644)
+}
+
+// Add 分块并向量化文本，保存为 owner 的一篇文档
+func (b *Base) Add(ctx context.Context, owner, name, source, text string) (*Document, error) {
+	b.mu.RLock()
+	count := len(b.Docs[owner])
+	b.mu.RUnlock()
+	if count >= b.cfg.MaxDocuments {
+		return nil, ErrTooManyDocuments
+	}
+
+	parts := Split(text, b.cfg.ChunkSize, b.cfg.ChunkOverlap)
+	if len(parts) == 0 {
+		return nil, errors.New("document is empty")
+	}
+	vectors, err := b.embedder.Embed(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		Name:    name,
+		Source:  source,
+		AddedAt: time.Now(),
+		Chunks:  make([]Chunk, len(parts)),
+	}
+	for i, part := range parts {
+		doc.Chunks[i] = Chunk{Text: part, Vector: vectors[i]}
+	}
+
+	b.mu.Lock()
+	b.Seq++
+	doc.ID = fmt.Sprintf("d%d", b.Seq)
+	b.Docs[owner] = append(b.Docs[owner], doc)
+	b.mu.Unlock()
+
+	return doc, b.save()
+}
+
+// Remove deletes a document, returns false if it does not exist
+func (b *Base) Remove(owner, id string) (bool, error) {
+	b.mu.Lock()
+	docs := b.Docs[owner]
+	for i, doc := range docs {
+		if doc.ID == id {
+			b.Docs[owner] = append(docs[:i], docs[i+1:]...)
+			b.mu.Unlock()
+			return true, b.save()
+		}
+	}
+	b.mu.Unlock()
+	return false, nil
+}
+
+func (b *Base) Clear(owner string) error {
+	b.mu.Lock()
+	delete(b.Docs, owner)
+	b.mu.Unlock()
+	return b.save()
+}
+
+// List returns the documents of owner without their chunks
+func (b *Base) List(owner string) []Document {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	list := make([]Document, 0, len(b.Docs[owner]))
+	for _, doc := range b.Docs[owner] {
+		d := *doc
+		d.Chunks = make([]Chunk, len(doc.Chunks)) // 只保留数量
+		list = append(list, d)
+	}
+	return list
+}
+
+// HasDocuments reports whether owner has any document, used to skip embedding the query
+func (b *Base) HasDocuments(owner string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.Docs[owner]) > 0
+}
+
+// Embed returns the vector of text with the knowledge base's embedding model, used to search notes
+func (b *Base) Embed(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := b.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// Search returns the chunks most similar to query, at most TopK with score >= MinScore
+func (b *Base) Search(ctx context.Context, owner, query string) ([]Result, error) {
+	if !b.HasDocuments(owner) {
+		return nil, nil
+	}
+	vectors, err := b.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	q := vectors[0]
+
+	b.mu.RLock()
+	var results []Result
+	for _, doc := range b.Docs[owner] {
+		for _, chunk := range doc.Chunks {
+			score := Cosine(q, chunk.Vector)
+			if score >= b.cfg.MinScore {
+				results = append(results, Result{Document: doc.Name, Text: chunk.Text, Score: score})
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > b.cfg.TopK {
+		results = results[:b.cfg.TopK]
+	}
+	return results, nil
+}
+
+// Prompt 将检索结果格式化为附加到系统提示词的内容，没有结果时返回空字符串
+func Prompt(results []Result) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n以下是从用户知识库中检索到的相关内容，回答时请优先依据这些内容，并注明参考的文档名；如果内容与问题无关请忽略：\n")
+	for i, r := range results {
+		sb.WriteString(fmt.Sprintf("\n[%d]《%s》\n%s\n", i+1, r.Document, r.Text))
+	}
+	return sb.String()
+}
+
+// Split 按段落将文本切分为不超过 size 个字符的块，相邻块重叠 overlap 个字符
+func Split(text string, size, overlap int) []string {
+	overlap = min(overlap, size/2)
+
+	var chunks []string
+	var current []rune
+	flush := func() {
+		if s := strings.TrimSpace(string(current)); s != "" {
+			chunks = append(chunks, s)
+		}
+		if len(current) > overlap {
+			current = append([]rune(nil), current[len(current)-overlap:]...)
+		}
+	}
+
+	for _, para := range strings.Split(text, "\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		runes := []rune(para + "\n")
+		// 段落能放进当前块时整段加入，否则先结束当前块
+		if len(current)+len(runes) > size && len(current) > overlap {
+			flush()
+		}
+		for len(current)+len(runes) > size {
+			n := size - len(current)
+			current = append(current, runes[:n]...)
+			runes = runes[n:]
+			flush()
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > overlap || len(chunks) == 0 {
+		if s := strings.TrimSpace(string(current)); s != "" {
+			chunks = append(chunks, s)
+		}
+	}
+	return chunks
+}
+
+// Cosine 两个向量的余弦相似度，长度不同或为零向量时返回 0
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -1,27 +1,87 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	// 内置时区数据库，没有安装 tzdata 的系统也能使用 /tz
+	_ "time/tzdata"
 
-	"github.com/lhpqaq/ggbot/adapter/qq"
-	"github.com/lhpqaq/ggbot/adapter/telegram"
+	"github.com/lhpqaq/ggbot/adapter/console"
+	// 内置平台适配器，导入即注册
+	_ "github.com/lhpqaq/ggbot/adapter/email"
+	_ "github.com/lhpqaq/ggbot/adapter/onebot"
+	_ "github.com/lhpqaq/ggbot/adapter/qq"
+	_ "github.com/lhpqaq/ggbot/adapter/telegram"
+	_ "github.com/lhpqaq/ggbot/adapter/whatsapp"
+	"github.com/lhpqaq/ggbot/alert"
+	"github.com/lhpqaq/ggbot/anonymize"
+	"github.com/lhpqaq/ggbot/backup"
 	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/cooldown"
 	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/msglog"
+	"github.com/lhpqaq/ggbot/outbox"
 	"github.com/lhpqaq/ggbot/plugins"
 	"github.com/lhpqaq/ggbot/plugins/ai"
+	"github.com/lhpqaq/ggbot/plugins/feeds"
+	"github.com/lhpqaq/ggbot/plugins/game"
+	"github.com/lhpqaq/ggbot/plugins/github"
+	"github.com/lhpqaq/ggbot/plugins/hooks"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/plugins/poll"
 	"github.com/lhpqaq/ggbot/plugins/system"
+	"github.com/lhpqaq/ggbot/quiet"
+	"github.com/lhpqaq/ggbot/scheduler"
+	"github.com/lhpqaq/ggbot/stats"
 	"github.com/lhpqaq/ggbot/storage"
+	"github.com/lhpqaq/ggbot/systemd"
+	"github.com/lhpqaq/ggbot/tasks"
+	"github.com/lhpqaq/ggbot/telemetry"
+	"github.com/lhpqaq/ggbot/version"
 )
 
 func main() {
+	// ggbot systemd install：生成 systemd 服务单元
+	if len(os.Args) > 2 && os.Args[1] == "systemd" && os.Args[2] == "install" {
+		if err := installSystemd(os.Args[3:]); err != nil {
+			fmt.Fprintln(os.Stderr, "ggbot systemd install:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	consoleMode := flag.Bool("console", false, "read messages from stdin and print replies instead of connecting to Telegram/QQ")
+	configPath := flag.String("config", envOr("GGBOT_CONFIG", "config.yaml"), "config file path (env GGBOT_CONFIG)")
+	storagePath := flag.String("storage", envOr("GGBOT_STORAGE", "storage.json"), "storage file path (env GGBOT_STORAGE)")
+	logLevel := flag.String("log-level", os.Getenv("GGBOT_LOG_LEVEL"), "debug, info, warn or error, overrides bot.log_level (env GGBOT_LOG_LEVEL)")
+	dryRun := flag.Bool("dry-run", false, "validate the config and connect to the platforms, then exit without handling messages")
+	flag.Parse()
+
 	// 1. Load Configuration
-	cfg, err := config.Load("config.yaml")
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		slog.Error("Failed to load config", "error", err)
+		slog.Error("Failed to load config", "path", *configPath, "error", err)
 		os.Exit(1)
 	}
+	if err := cfg.Validate(); err != nil {
+		logConfigProblems(slog.Default(), *configPath, err)
+		os.Exit(1)
+	}
+	if *logLevel != "" {
+		cfg.Bot.LogLevel = *logLevel
+	}
 
 	// 2. Setup Logger
 	var level slog.Level
@@ -36,67 +96,380 @@ func main() {
 		level = slog.LevelInfo
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// 控制台模式下标准输出用于对话，日志写到标准错误
+	logOut := os.Stdout
+	if *consoleMode {
+		logOut = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(logOut, &slog.HandlerOptions{
 		Level: level,
 	}))
 	slog.SetDefault(logger)
+	build := version.Get()
+	logger.Info("Starting ggbot", "version", build.Version, "commit", build.Commit, "modified", build.Modified, "date", build.Date, "go", build.GoVersion)
 
-	// 3. Initialize Storage
-	store, err := storage.New("storage.json")
-	if err != nil {
-		logger.Error("Failed to init storage", "error", err)
-		os.Exit(1)
+	if *dryRun {
+		if !checkConfig(cfg, *storagePath, logger) {
+			os.Exit(1)
+		}
+		logger.Info("Dry run passed")
+		return
 	}
 
-	// 4. Initialize Platforms
-	var platforms []core.Platform
+	// 多租户时所有实例共用一个 TracerProvider，使用主配置文件的 tracing
+	shutdownTracing := telemetry.Setup(cfg.Tracing, logger)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Failed to flush traces", "error", err)
+		}
+	}()
+
+	if *consoleMode {
+		con := console.New(os.Stdin, os.Stdout, logger)
+		inst, err := startInstance(cfg, *storagePath, logger, con)
+		if err != nil {
+			logger.Error("Failed to start", "error", err)
+			os.Exit(1)
+		}
+		<-con.Done()
+		inst.close()
+		return
+	}
+
+	// 3. Start the bot, or one isolated instance per tenant
+	var instances []*instance
+	if len(cfg.Tenants) == 0 {
+		inst, err := startInstance(cfg, *storagePath, logger, nil)
+		if err != nil {
+			logger.Error("Failed to start", "error", err)
+			os.Exit(1)
+		}
+		instances = append(instances, inst)
+	} else {
+		started := 0
+		for _, name := range slices.Sorted(maps.Keys(cfg.Tenants)) {
+			tenant := cfg.Tenants[name]
+			tenantLogger := logger.With("tenant", name)
+			tenantCfg, err := config.Load(tenant.Config)
+			if err != nil {
+				tenantLogger.Error("Failed to load tenant config", "path", tenant.Config, "error", err)
+				continue
+			}
+			if err := tenantCfg.Validate(); err != nil {
+				logConfigProblems(tenantLogger, tenant.Config, err)
+				continue
+			}
+			inst, err := startInstance(tenantCfg, tenant.Storage, tenantLogger, nil)
+			if err != nil {
+				tenantLogger.Error("Failed to start tenant", "error", err)
+				continue
+			}
+			instances = append(instances, inst)
+			started++
+		}
+		if started == 0 {
+			logger.Error("No tenant started")
+			os.Exit(1)
+		}
+		logger.Info("Tenants started", "count", started, "configured", len(cfg.Tenants))
+	}
+
+	// 由 systemd 以 Type=notify 启动时通知就绪，并按 WatchdogSec 发送心跳
+	if _, err := systemd.Ready(); err != nil {
+		logger.Warn("Failed to notify systemd", "error", err)
+	}
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	systemd.StartWatchdog(watchdogCtx, logger)
+
+	// 运行到收到退出信号，退出前关闭插件的连接并写入存储中尚未写入文件的修改
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	logger.Info("Shutting down", "signal", (<-sig).String())
+	_, _ = systemd.Stopping()
+	stopWatchdog()
+	for _, inst := range instances {
+		inst.close()
+	}
+}
+
+// instance 一个运行中的机器人实例，多租户时每个租户一个
+type instance struct {
+	store     *storage.Storage
+	platforms []core.Platform
+	scheduler *scheduler.Scheduler
+	plugins   []plugins.Plugin
+	alerts    *alert.Manager
+	logger    *slog.Logger
+}
 
-	// Telegram
-	if cfg.Bot.Token != "" {
-		teleAdapter, err := telegram.New(cfg.Bot, cfg.Proxy, logger)
+// close 先停止平台不再接收消息，再停止定时任务和告警升级，按加载的相反顺序清理插件（如关闭 MCP 连接），最后写入存储延迟保存的修改
+func (inst *instance) close() {
+	for _, p := range inst.platforms {
+		if err := p.Stop(); err != nil {
+			inst.logger.Warn("Failed to stop platform", "platform", p.Name(), "error", err)
+		}
+	}
+	inst.scheduler.Stop()
+	inst.alerts.Close()
+	for _, p := range slices.Backward(inst.plugins) {
+		if cleaner, ok := p.(core.Cleaner); ok {
+			if err := cleaner.Cleanup(); err != nil {
+				inst.logger.Warn("Failed to clean up plugin", "name", p.Name(), "error", err)
+			}
+		}
+	}
+	if err := inst.store.Close(); err != nil {
+		inst.logger.Error("Failed to flush storage", "path", inst.store.Path(), "error", err)
+	}
+}
+
+// installSystemd 生成 service 单元文件并写入 systemd 的单元目录，--print 时只输出到标准输出
+func installSystemd(args []string) error {
+	fs := flag.NewFlagSet("systemd install", flag.ContinueOnError)
+	name := fs.String("name", "ggbot", "service name")
+	configPath := fs.String("config", envOr("GGBOT_CONFIG", "config.yaml"), "config file path passed to the service")
+	storagePath := fs.String("storage", envOr("GGBOT_STORAGE", "storage.json"), "storage file path passed to the service")
+	user := fs.String("user", "", "run the service as this user (system units only)")
+	watchdog := fs.Int("watchdog", 60, "WatchdogSec in seconds, 0 disables the watchdog")
+	userUnit := fs.Bool("user-unit", false, "install a user unit (systemctl --user) instead of a system unit")
+	printOnly := fs.Bool("print", false, "print the unit instead of writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// 服务的工作目录为当前目录，相对路径按当前目录展开，避免依赖 systemd 的工作目录
+	var paths []string
+	for _, p := range []string{*configPath, *storagePath} {
+		abs, err := filepath.Abs(p)
 		if err != nil {
-			logger.Error("Failed to init Telegram", "error", err)
-		} else {
-			platforms = append(platforms, teleAdapter)
+			return err
 		}
+		paths = append(paths, abs)
+	}
+	unit := systemd.Unit(systemd.UnitOptions{
+		Description: "GGBot multi-platform AI bot",
+		Exec:        exe,
+		Args:        []string{"--config", paths[0], "--storage", paths[1]},
+		WorkDir:     workDir,
+		User:        *user,
+		Watchdog:    *watchdog,
+		UserUnit:    *userUnit,
+	})
+	if *printOnly {
+		fmt.Print(unit)
+		return nil
 	}
 
-	// QQ - 强制不使用代理
-	if cfg.Bot.QQAppID != "" {
-		qqAdapter, err := qq.New(cfg.Bot, logger)
+	dir := "/etc/systemd/system"
+	systemctl := "systemctl"
+	if *userUnit {
+		home, err := os.UserHomeDir()
 		if err != nil {
-			logger.Error("Failed to init QQ", "error", err)
-		} else {
-			platforms = append(platforms, qqAdapter)
+			return err
 		}
+		dir = filepath.Join(home, ".config", "systemd", "user")
+		systemctl = "systemctl --user"
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(dir, *name+".service")
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\nEnable and start it with:\n  %s daemon-reload && %s enable --now %s\n", path, systemctl, systemctl, *name)
+	return nil
+}
+
+// envOr 返回环境变量的值，未设置时返回 fallback
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// checkConfig 用于 --dry-run：读取存储并创建各平台适配器（Telegram、QQ 会校验凭据），多租户时检查每个租户。
+// 不注册处理器，也不启动平台
+func checkConfig(cfg *config.Config, storagePath string, logger *slog.Logger) bool {
+	if len(cfg.Tenants) == 0 {
+		return checkInstance(cfg, storagePath, logger)
+	}
+	ok := true
+	for _, name := range slices.Sorted(maps.Keys(cfg.Tenants)) {
+		tenant := cfg.Tenants[name]
+		tenantLogger := logger.With("tenant", name)
+		tenantCfg, err := config.Load(tenant.Config)
+		if err != nil {
+			tenantLogger.Error("Failed to load tenant config", "path", tenant.Config, "error", err)
+			ok = false
+			continue
+		}
+		if err := tenantCfg.Validate(); err != nil {
+			logConfigProblems(tenantLogger, tenant.Config, err)
+			ok = false
+			continue
+		}
+		ok = checkInstance(tenantCfg, tenant.Storage, tenantLogger) && ok
 	}
+	return ok
+}
 
+func checkInstance(cfg *config.Config, storagePath string, logger *slog.Logger) bool {
+	store, err := storage.New(storagePath)
+	if err != nil {
+		logger.Error("Failed to load storage", "path", storagePath, "error", err)
+		return false
+	}
+	platforms, err := core.BuildAdapters(cfg, store, logger)
+	for _, p := range platforms {
+		logger.Info("Platform OK", "platform", p.Name())
+	}
 	if len(platforms) == 0 {
 		logger.Error("No platforms configured or initialized successfully")
-		os.Exit(1)
+		return false
+	}
+	return err == nil
+}
+
+// startInstance 按一份配置启动一个完整的机器人实例（平台、插件、存储），多租户时每个租户一个实例。
+// con 不为 nil 时只使用本地控制台，不连接 Telegram/QQ。退出前需要调用实例的 close
+func startInstance(cfg *config.Config, storagePath string, logger *slog.Logger, con *console.ConsoleAdapter) (*instance, error) {
+	// 3. Initialize Storage
+	store, err := storage.New(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("init storage: %w", err)
+	}
+
+	// 4. Initialize Platforms
+	var platforms []core.Platform
+
+	if con != nil {
+		platforms = append(platforms, con)
+	} else {
+		// 平台由各适配器包注册，按 platforms 配置或已填写的凭据创建，创建失败的平台已记录日志，其余平台照常启动
+		platforms, _ = core.BuildAdapters(cfg, store, logger)
+	}
+
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platforms configured or initialized successfully")
 	}
 
 	// 5. Initialize Plugins
-	// We create a composite registration function that registers on ALL platforms
+	// We create a composite registration function that registers on ALL platforms.
+	// 所有消息处理都经过 guard，过滤其他机器人的消息
+	guard := policy.NewBotGuard(cfg.Bots, store, logger)
+	router, err := policy.NewRouter(cfg.Routes, logger)
+	if err != nil {
+		return nil, fmt.Errorf("routes: %w", err)
+	}
+	// 启用 history_log 时记录消息和回复，被 guard 过滤的消息不记录
+	msgLog := msglog.New(cfg.HistoryLog, store, logger)
+	commands := &core.CommandSet{}
+	// 配置了 cooldowns 的指令在冷却时间内重复发送时回复上次的结果
+	cooldowns := cooldown.New(cfg, store, logger, commands)
+	st := stats.New()
+	// receive 每条消息最先经过的处理：分配请求 ID、计入运行统计、开始 trace
+	receive := func(name string, h core.Handler) core.Handler {
+		return core.WithRequestID(logger, countMessages(st, telemetry.Handler(name, h)))
+	}
+	var textHandlers []core.Handler
+	// 平台开始接收消息后注册的指令（如 MCP 服务连接后的提示词）不再写入平台的指令表，
+	// 平台把它们当作文字消息收到，由 lateCommand 找到 commands 中记录的处理器执行
+	var registerMu sync.Mutex
+	started := false
 	pluginCtx := &plugins.Context{
-		Config:  cfg,
-		Storage: store,
-		Logger:  logger,
+		Config:   cfg,
+		Storage:  store,
+		Logger:   logger,
+		Tasks:    tasks.New(cfg.Bot.MaxTasks, logger),
+		Commands: commands,
+		UserData: &core.UserDataSet{},
+		Stats:    st,
+		// 单个处理器也经过 core.Chain，路由返回的 core.ErrPass 视为未处理。
+		// commands 中记录不含 guard 和消息记录的处理器：意图路由通过 RunCommand 执行指令时，
+		// 消息已经在文字处理链中经过了 guard 和消息记录
 		RegisterCommand: func(cmd string, h core.Handler) {
+			inner := cooldowns.Wrap(cmd, core.Chain(h))
+			commands.SetHandler(cmd, inner)
+			wrapped := guard.Wrap(msgLog.Wrap(inner))
+			registerMu.Lock()
+			defer registerMu.Unlock()
+			if started {
+				return
+			}
 			for _, p := range platforms {
-				p.RegisterCommand(cmd, h)
+				p.RegisterCommand(cmd, receive("command "+cmd, wrapped))
 			}
 		},
+		// 多个插件都可以处理文字消息，按注册顺序组成处理链，返回 core.ErrPass 的处理器把消息交给下一个
 		RegisterText: func(h core.Handler) {
+			if len(textHandlers) == 0 {
+				chain := guard.Wrap(msgLog.Wrap(func(c core.Context) error {
+					return core.Chain(textHandlers...)(c)
+				}))
+				for _, p := range platforms {
+					p.RegisterText(receive("text", func(c core.Context) error {
+						if h, ok := lateCommand(commands, c); ok {
+							return guard.Wrap(msgLog.Wrap(h))(c)
+						}
+						return chain(c)
+					}))
+				}
+			}
+			textHandlers = append(textHandlers, h)
+		},
+		RegisterDocument: func(h core.Handler) {
+			for _, p := range platforms {
+				p.RegisterDocument(receive("document", guard.Wrap(msgLog.Wrap(core.Chain(h)))))
+			}
+		},
+		RegisterPhoto: func(h core.Handler) {
+			for _, p := range platforms {
+				p.RegisterPhoto(receive("photo", guard.Wrap(msgLog.Wrap(core.Chain(h)))))
+			}
+		},
+		RegisterCallback: func(name string, h core.Handler) {
+			for _, p := range platforms {
+				p.RegisterCallback(name, receive("callback "+name, msgLog.Wrap(h)))
+			}
+		},
+		RegisterMemberEvent: func(h core.MemberHandler) {
 			for _, p := range platforms {
-				p.RegisterText(h)
+				if events, ok := p.(core.MemberEvents); ok {
+					events.RegisterMemberEvent(func(c core.Context, event core.MemberEvent) error {
+						return receive("member", func(c core.Context) error { return h(c, event) })(c)
+					})
+				}
+			}
+		},
+		RegisterPayment: func(h core.PaymentHandler) {
+			for _, p := range platforms {
+				if payments, ok := p.(core.Payments); ok {
+					payments.RegisterPayment(func(c core.Context, payment core.Payment) error {
+						return receive("payment", func(c core.Context) error { return h(c, payment) })(c)
+					})
+				}
 			}
 		},
 		SendTo: func(recipient string, text string) error {
 			// Recipient format: "Platform:Target"
 			parts := strings.SplitN(recipient, ":", 2)
 			if len(parts) != 2 {
-				return nil // Or error "invalid format"
+				return core.Permanent(fmt.Errorf("invalid target %q, expected Platform:ID", recipient))
 			}
 			platformName := strings.ToLower(parts[0])
 			target := parts[1]
@@ -106,30 +479,168 @@ func main() {
 					return p.SendTo(target, text)
 				}
 			}
-			return nil // Platform not found
+			return core.Permanent(fmt.Errorf("platform %s is not enabled", parts[0]))
 		},
 	}
 
+	pluginCtx.Alerts = alert.New(cfg.Alerts, cfg.Admins, pluginCtx.SendTo, logger)
+	// 推送先检查安静时段，发送失败时进入发件箱重试
+	pushes := outbox.New(cfg.Outbox, store, logger, pluginCtx.Alerts, pluginCtx.SendTo)
+	quietHours := quiet.New(cfg.QuietHours, store, logger, pushes.Send)
+	pluginCtx.Push = quietHours.Send
+	// 平台的接收循环退出后自动重启，通知管理员退出和恢复
+	for _, p := range platforms {
+		if sp, ok := p.(core.Supervised); ok {
+			sp.OnLoopEvent(func(e core.LoopEvent) {
+				key := "platform:" + e.Platform
+				if e.Err == nil {
+					pluginCtx.Alerts.Resolve(key, fmt.Sprintf("平台 %s 已恢复（重启 %d 次）", e.Platform, e.Restarts))
+					return
+				}
+				pluginCtx.Alerts.Error(key, fmt.Sprintf("平台 %s 停止接收消息: %v，%s 后第 %d 次重启", e.Platform, e.Err, e.Delay, e.Restarts))
+			})
+		}
+	}
+	pluginCtx.Scheduler = scheduler.New(store, logger)
+	pluginCtx.Anonymizer = anonymize.New(cfg.Anonymize.Salt)
+	if err := pluginCtx.Scheduler.Add("maintenance", scheduler.Every(time.Hour), func(context.Context) error {
+		return runMaintenance(cfg, store, logger)
+	}); err != nil {
+		logger.Error("Failed to schedule maintenance", "error", err)
+	}
+	if err := pluginCtx.Scheduler.Add("outbox", scheduler.Every(time.Minute), func(context.Context) error {
+		return pushes.Retry(quietHours.Quiet)
+	}); err != nil {
+		logger.Error("Failed to schedule push retries", "error", err)
+	}
+	if quietHours.Enabled() {
+		if err := pluginCtx.Scheduler.Add("quiet_hours", scheduler.Every(time.Minute), func(context.Context) error {
+			return quietHours.Flush()
+		}); err != nil {
+			logger.Error("Failed to schedule deferred pushes", "error", err)
+		}
+	}
+	pluginCtx.Backups = backup.New(cfg.Backup, store, logger)
+	if cfg.Backup.Enabled {
+		if err := pluginCtx.Scheduler.Add("backup", scheduler.Every(cfg.Backup.Interval), func(ctx context.Context) error {
+			_, err := pluginCtx.Backups.Run(ctx)
+			return err
+		}); err != nil {
+			logger.Error("Failed to schedule backups", "error", err)
+		}
+	}
+
+	aiPlugin := &ai.AIPlugin{Router: router}
 	allPlugins := []plugins.Plugin{
 		&system.SystemPlugin{},
-		&ai.AIPlugin{},
+		&policy.PolicyPlugin{},
+		// 游戏需要在 AI 之前检查作答
+		&game.GamePlugin{AI: aiPlugin},
+		aiPlugin,
+		&feeds.FeedsPlugin{AI: aiPlugin},
+		&poll.PollPlugin{},
+		&github.GitHubPlugin{},
+		&hooks.HooksPlugin{},
 	}
 
 	for _, p := range allPlugins {
 		logger.Info("Loading plugin", "name", p.Name())
-		if err := p.Init(pluginCtx); err != nil {
-			logger.Error("Failed to init plugin", "plugin", p.Name(), "error", err)
-			os.Exit(1)
+		if err := p.Init(routedContext(pluginCtx, router, p.Name())); err != nil {
+			return nil, fmt.Errorf("init plugin %s: %w", p.Name(), err)
+		}
+	}
+
+	// 支持指令菜单的平台（如 Telegram）按已声明的指令更新菜单
+	for _, p := range platforms {
+		if menu, ok := p.(core.CommandMenu); ok {
+			if err := menu.SetCommands(pluginCtx.Commands.Visible(false)); err != nil {
+				logger.Warn("Failed to set command menu", "platform", p.Name(), "error", err)
+			}
 		}
 	}
 
 	// 6. Start Platforms
+	registerMu.Lock()
+	started = true
+	registerMu.Unlock()
 	for _, p := range platforms {
 		if err := p.Start(); err != nil {
 			logger.Error("Failed to start platform", "platform", p.Name(), "error", err)
+			pluginCtx.Alerts.Critical("platform:"+p.Name(), "平台 "+p.Name()+" 启动失败: "+err.Error())
 		}
 	}
 
-	// Block forever
-	select {}
+	return &instance{
+		store:     store,
+		platforms: platforms,
+		scheduler: pluginCtx.Scheduler,
+		plugins:   allPlugins,
+		alerts:    pluginCtx.Alerts,
+		logger:    logger,
+	}, nil
+}
+
+// lateCommand 返回以指令开头的文字消息对应的处理器。平台指令表中的指令由平台直接处理，
+// 到达这里的是平台开始接收消息后才注册的指令
+func lateCommand(commands *core.CommandSet, c core.Context) (core.Handler, bool) {
+	fields := strings.Fields(c.Text())
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return nil, false
+	}
+	return commands.Handler(fields[0])
+}
+
+// countMessages 在运行统计中记录平台处理的消息数和出错数
+func countMessages(st *stats.Stats, h core.Handler) core.Handler {
+	return func(c core.Context) error {
+		err := h(c)
+		st.Record(c.Platform(), err != nil && !errors.Is(err, core.ErrPass))
+		return err
+	}
+}
+
+// logConfigProblems 逐行记录 Config.Validate 发现的问题
+func logConfigProblems(logger *slog.Logger, path string, err error) {
+	for _, problem := range strings.Split(err.Error(), "\n") {
+		logger.Error("Invalid config", "path", path, "problem", problem)
+	}
+}
+
+// routedContext 返回插件专用的上下文，插件注册的消息处理器先经过路由表判断是否由该插件处理，
+// 启用 tracing 时插件的处理记录为 span
+func routedContext(ctx *plugins.Context, router *policy.Router, plugin string) *plugins.Context {
+	routed := *ctx
+	routed.RegisterCommand = func(cmd string, h core.Handler) {
+		ctx.RegisterCommand(cmd, router.Wrap(plugin, telemetry.Plugin(plugin, h)))
+	}
+	routed.RegisterText = func(h core.Handler) {
+		ctx.RegisterText(router.Wrap(plugin, telemetry.Plugin(plugin, h)))
+	}
+	routed.RegisterDocument = func(h core.Handler) {
+		ctx.RegisterDocument(router.Wrap(plugin, telemetry.Plugin(plugin, h)))
+	}
+	routed.RegisterPhoto = func(h core.Handler) {
+		ctx.RegisterPhoto(router.Wrap(plugin, telemetry.Plugin(plugin, h)))
+	}
+	return &routed
+}
+
+// runMaintenance 存储维护任务：清理过期的每日用量记录和缓存
+func runMaintenance(cfg *config.Config, store *storage.Storage, logger *slog.Logger) error {
+	cutoff := storage.Day(time.Now().AddDate(0, 0, -cfg.Limits.RetainDays))
+	removed, err := store.PruneUsage(cutoff)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		logger.Info("Pruned usage records", "days", removed)
+	}
+	expired, err := store.PruneCache()
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		logger.Info("Pruned cache entries", "count", expired)
+	}
+	return nil
 }
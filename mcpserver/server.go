@@ -0,0 +1,168 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/storage"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Message is one message of a conversation returned by get_conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Backend provides the bot capabilities exposed as MCP tools
+type Backend struct {
+	// SendTo sends text to "Platform:Target", e.g. "Telegram:123" or "QQ:Group:456"
+	SendTo  func(recipient, text string) error
+	Storage *storage.Storage
+	// Conversation returns the recent conversation of a user ("Platform:UserID")
+	Conversation func(userKey string) []Message
+}
+
+// Server 将 ggbot 作为 MCP 服务，外部 Agent 可以通过它发送消息、查询用户和对话
+type Server struct {
+	cfg     config.MCPServerConfig
+	backend Backend
+	logger  *slog.Logger
+	server  *mcp.Server
+	http    *http.Server
+}
+
+type sendMessageInput struct {
+	Platform string `json:"platform" jsonschema:"platform name, Telegram or QQ"`
+	Target   string `json:"target" jsonschema:"user ID, or Group:ID for QQ groups"`
+	Text     string `json:"text" jsonschema:"message text"`
+}
+
+type listUsersInput struct{}
+
+type getConversationInput struct {
+	User string `json:"user" jsonschema:"user key in the form Platform:UserID, see list_users"`
+}
+
+func New(cfg config.MCPServerConfig, backend Backend, logger *slog.Logger) *Server {
+	s := &Server{
+		cfg:     cfg,
+		backend: backend,
+		logger:  logger,
+		server:  mcp.NewServer(&mcp.Implementation{Name: "ggbot", Version: "1.0"}, nil),
+	}
+
+	mcp.AddTool(s.server, &mcp.Tool{
+		Name:        "send_message",
+		Description: "Send a text message to a user or group through the bot.",
+	}, s.sendMessage)
+	mcp.AddTool(s.server, &mcp.Tool{
+		Name:        "list_users",
+		Description: "List the users known to the bot with their preferences.",
+	}, s.listUsers)
+	mcp.AddTool(s.server, &mcp.Tool{
+		Name:        "get_conversation",
+		Description: "Get the recent conversation between the bot and a user. Empty unless the user enabled conversation memory.",
+	}, s.getConversation)
+
+	return s
+}
+
+// Start listens on cfg.Listen and serves in the background. The server can send messages and read
+// conversations, so it refuses to start without a token
+func (s *Server) Start() error {
+	if s.cfg.Token == "" {
+		return errors.New("mcp_server: token is required")
+	}
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("mcp_server: %w", err)
+	}
+
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s.server }, nil)
+	s.http = &http.Server{Addr: s.cfg.Listen, Handler: authMiddleware(s.cfg.Token, handler)}
+
+	go func() {
+		s.logger.Info("MCP server listening", "addr", s.cfg.Listen)
+		if err := s.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("MCP server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if s.http == nil {
+		return nil
+	}
+	return s.http.Shutdown(ctx)
+}
+
+// authMiddleware 校验 Bearer token
+func authMiddleware(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) sendMessage(_ context.Context, _ *mcp.CallToolRequest, in sendMessageInput) (*mcp.CallToolResult, any, error) {
+	if in.Platform == "" || in.Target == "" || strings.TrimSpace(in.Text) == "" {
+		return nil, nil, fmt.Errorf("platform, target and text are required")
+	}
+	recipient := in.Platform + ":" + in.Target
+	if err := s.backend.SendTo(recipient, in.Text); err != nil {
+		return nil, nil, err
+	}
+	s.logger.Info("Message sent via MCP server", "recipient", recipient)
+	return textResult("sent to " + recipient), nil, nil
+}
+
+func (s *Server) listUsers(_ context.Context, _ *mcp.CallToolRequest, _ listUsersInput) (*mcp.CallToolResult, any, error) {
+	type user struct {
+		User     string `json:"user"`
+		Language string `json:"language,omitempty"`
+		Persona  string `json:"persona,omitempty"`
+		City     string `json:"city,omitempty"`
+	}
+	var users []user
+	for _, key := range s.backend.Storage.ListUsers() {
+		profile := s.backend.Storage.GetUserProfile(key)
+		users = append(users, user{User: key, Language: profile.Language, Persona: profile.Persona, City: profile.City})
+	}
+	return jsonResult(users)
+}
+
+func (s *Server) getConversation(_ context.Context, _ *mcp.CallToolRequest, in getConversationInput) (*mcp.CallToolResult, any, error) {
+	if in.User == "" {
+		return nil, nil, fmt.Errorf("user is required")
+	}
+	if s.backend.Conversation == nil {
+		return nil, nil, fmt.Errorf("conversation history is not available")
+	}
+	return jsonResult(s.backend.Conversation(in.User))
+}
+
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}
+}
+
+func jsonResult(v any) (*mcp.CallToolResult, any, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return textResult(string(data)), nil, nil
+}
@@ -0,0 +1,119 @@
+package msglog
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// Logger 启用 history_log 时按会话记录收到的消息和机器人通过同一上下文发出的回复
+type Logger struct {
+	cfg    config.HistoryLogConfig
+	store  *storage.Storage
+	logger *slog.Logger
+}
+
+func New(cfg config.HistoryLogConfig, store *storage.Storage, logger *slog.Logger) *Logger {
+	return &Logger{cfg: cfg, store: store, logger: logger}
+}
+
+// Wrap 记录收到的消息（按钮回调除外），处理器收到的上下文会记录其发送和编辑的消息；未启用时直接返回 h
+func (l *Logger) Wrap(h core.Handler) core.Handler {
+	if !l.cfg.Enabled {
+		return h
+	}
+	return func(c core.Context) error {
+		lc := &loggedContext{Context: c, log: l, chatKey: c.Platform() + ":" + c.Chat().ID}
+		if c.Data() == "" {
+			user := c.Sender()
+			lc.record(storage.LoggedMessage{Direction: storage.DirectionIn, UserID: user.ID, Username: user.Username, Text: inboundText(c)})
+		}
+		return h(lc)
+	}
+}
+
+// inboundText 消息的文字，附带图片或文件时加上标记
+func inboundText(c core.Context) string {
+	text := c.Text()
+	if c.Photo() != nil {
+		text = "[图片] " + text
+	} else if doc := c.Document(); doc != nil {
+		text = "[文件 " + doc.Name + "] " + text
+	}
+	return text
+}
+
+// loggedContext 记录机器人通过它发出的消息
+type loggedContext struct {
+	core.Context
+	log     *Logger
+	chatKey string
+}
+
+func (c *loggedContext) Unwrap() core.Context {
+	return c.Context
+}
+
+func (c *loggedContext) record(m storage.LoggedMessage) {
+	m.Time = time.Now()
+	if err := c.log.store.LogMessage(c.chatKey, m, c.log.cfg.MaxPerChat); err != nil {
+		c.log.logger.Error("Failed to log message", "chat", c.chatKey, "error", err)
+	}
+}
+
+func (c *loggedContext) out(msg core.Message, text string) {
+	m := storage.LoggedMessage{Direction: storage.DirectionOut, Text: text}
+	if msg != nil {
+		m.MessageID = msg.ID()
+	}
+	c.record(m)
+}
+
+func (c *loggedContext) Reply(text string) error {
+	err := c.Context.Reply(text)
+	if err == nil {
+		c.out(nil, text)
+	}
+	return err
+}
+
+func (c *loggedContext) Send(text string) (core.Message, error) {
+	msg, err := c.Context.Send(text)
+	if err == nil {
+		c.out(msg, text)
+	}
+	return msg, err
+}
+
+// Edit 更新原消息的记录，流式输出和占位消息只保留最终的文字
+func (c *loggedContext) Edit(msg core.Message, text string) error {
+	err := c.Context.Edit(msg, text)
+	if err == nil {
+		c.out(msg, text)
+	}
+	return err
+}
+
+func (c *loggedContext) SendButtons(text string, rows [][]core.Button) (core.Message, error) {
+	msg, err := c.Context.SendButtons(text, rows)
+	if err == nil {
+		c.out(msg, text)
+	}
+	return msg, err
+}
+
+func (c *loggedContext) SendFile(file *core.File) error {
+	err := c.Context.SendFile(file)
+	if err == nil {
+		c.out(nil, "[文件 "+file.Name+"] "+file.Caption)
+	}
+	return err
+}
+
+// Addressed 包装后仍能判断消息是否 @ 了机器人
+func (c *loggedContext) Addressed() bool {
+	return core.IsAddressed(c.Context)
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lhpqaq/ggbot/alert"
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// Outbox 推送发件箱：发送失败的消息保存在存储中，由 Retry 按指数退避重试，重启后继续重试。
+// 每次发送的结果记为发送记录，重试次数用完后记为失败并告警，管理员可用 /outbox 重新发送
+type Outbox struct {
+	cfg    config.OutboxConfig
+	store  *storage.Storage
+	logger *slog.Logger
+	alerts *alert.Manager
+	send   func(target, text string) error
+}
+
+// New 创建发件箱，send 为实际发送消息的函数
+func New(cfg config.OutboxConfig, store *storage.Storage, logger *slog.Logger, alerts *alert.Manager, send func(target, text string) error) *Outbox {
+	return &Outbox{cfg: cfg, store: store, logger: logger, alerts: alerts, send: send}
+}
+
+// Send 发送推送消息，失败时保存到发件箱等待重试并返回 nil。重试也不会成功的错误（core.ErrPermanent，
+// 如目标格式错误、QQ 群不支持主动推送）不进入发件箱，直接返回；保存失败时同样返回错误
+func (o *Outbox) Send(target, text string) error {
+	err := o.send(target, text)
+	o.receipt(target, 1, err)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, core.ErrPermanent) {
+		o.logger.Warn("Push failed permanently, not queued", "target", target, "error", err)
+		return err
+	}
+	failed := o.cfg.MaxAttempts <= 1
+	m, saveErr := o.store.AddOutboxMessage(target, text, err.Error(), time.Now().Add(o.backoff(1)), failed)
+	if saveErr != nil {
+		return errors.Join(err, saveErr)
+	}
+	if failed {
+		return o.fail(m, err)
+	}
+	o.logger.Warn("Push failed, queued for retry", "id", m.ID, "target", target, "next", m.NextAttempt, "error", err)
+	return nil
+}
+
+// Retry 重试到期的消息，hold 返回 true 的目标（如处于安静时段）本次跳过，不计入尝试次数
+func (o *Outbox) Retry(hold func(target string) bool) error {
+	var errs []error
+	for _, m := range o.store.DueOutboxMessages(time.Now()) {
+		if hold != nil && hold(m.Target) {
+			continue
+		}
+		attempt := m.Attempts + 1
+		err := o.send(m.Target, m.Text)
+		o.receipt(m.Target, attempt, err)
+
+		var failed bool
+		if _, saveErr := o.store.UpdateOutboxMessage(m.ID, func(stored *storage.OutboxMessage) bool {
+			if err == nil {
+				return true
+			}
+			stored.Attempts = attempt
+			stored.LastError = err.Error()
+			if attempt >= o.cfg.MaxAttempts || errors.Is(err, core.ErrPermanent) {
+				stored.Failed, failed = true, true
+			} else {
+				stored.NextAttempt = time.Now().Add(o.backoff(attempt))
+			}
+			return false
+		}); saveErr != nil {
+			errs = append(errs, saveErr)
+		}
+
+		switch {
+		case err == nil:
+			o.logger.Info("Queued push delivered", "id", m.ID, "target", m.Target, "attempts", attempt)
+		case failed:
+			m.Attempts = attempt
+			errs = append(errs, o.fail(m, err))
+		default:
+			o.logger.Warn("Push retry failed", "id", m.ID, "target", m.Target, "attempts", attempt, "error", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fail 重试次数用完，告警并返回发送的错误
+func (o *Outbox) fail(m storage.OutboxMessage, err error) error {
+	o.logger.Error("Push failed, giving up", "id", m.ID, "target", m.Target, "attempts", m.Attempts, "error", err)
+	o.alerts.Error("outbox:"+m.Target, fmt.Sprintf("推送到 %s 失败 %d 次，已停止重试: %v，发送 /outbox 查看或重新发送", m.Target, m.Attempts, err))
+	return fmt.Errorf("%s: %w", m.Target, err)
+}
+
+// backoff 第 attempt 次尝试失败后的重试间隔：backoff、2×backoff、4×backoff……不超过 max_backoff
+func (o *Outbox) backoff(attempt int) time.Duration {
+	d := o.cfg.Backoff
+	for i := 1; i < attempt && d < o.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, o.cfg.MaxBackoff)
+}
+
+func (o *Outbox) receipt(target string, attempt int, err error) {
+	r := storage.DeliveryReceipt{Target: target, Time: time.Now(), Attempts: attempt}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if saveErr := o.store.AddDeliveryReceipt(r); saveErr != nil {
+		o.logger.Error("Failed to save delivery receipt", "target", target, "error", saveErr)
+	}
+}
@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/msgtmpl"
+)
+
+// broadcastCommand /broadcast <频道|目标|all> <消息> 向推送频道的订阅者或指定目标群发消息（管理员），
+// 消息是 Go 模板，按每个目标渲染 {{.Date}}、{{.City}}、{{.Weather}} 等变量
+func broadcastCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{
+		Name:        "/broadcast",
+		Description: "向推送频道的订阅者群发消息，支持模板变量（管理员）",
+		Admin:       true,
+		Args:        []core.Arg{{Name: "频道"}, {Name: "消息", Rest: true}},
+		Handler: func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "broadcast.admin_only"))
+			}
+			to := args["频道"]
+			targets, ok := broadcastTargets(ctx, to)
+			if !ok {
+				return c.Reply(ctx.T(c, "broadcast.unknown", to))
+			}
+			if len(targets) == 0 {
+				return c.Reply(ctx.T(c, "broadcast.no_targets", to))
+			}
+			t, err := msgtmpl.Parse("broadcast", args["消息"])
+			if err != nil {
+				return c.Reply(ctx.T(c, "broadcast.invalid_template", err))
+			}
+
+			var failed []string
+			for _, target := range targets {
+				text, err := msgtmpl.Execute(ctx, t, target, nil)
+				if err == nil {
+					err = ctx.Push(target, text)
+				}
+				if err != nil {
+					ctx.Logger.Error("Failed to broadcast", "target", target, "error", err)
+					failed = append(failed, target)
+				}
+			}
+			ctx.Logger.Info("Broadcast sent", "to", to, "targets", len(targets), "failed", len(failed), "by", core.UserKey(c))
+			if len(failed) > 0 {
+				return c.Reply(ctx.T(c, "broadcast.partial", len(targets)-len(failed), len(targets), strings.Join(failed, ", ")))
+			}
+			return c.Reply(ctx.T(c, "broadcast.sent", len(targets)))
+		},
+	}
+}
+
+// broadcastTargets 解析群发对象：频道名、all（所有频道）或 "平台:ID" 形式的单个目标
+func broadcastTargets(ctx *plugins.Context, to string) ([]string, bool) {
+	channels := pushChannels(ctx.Config)
+	if _, ok := channels[to]; ok {
+		return channelTargets(ctx, to), true
+	}
+	switch {
+	case to == "all":
+		var targets []string
+		for _, name := range slices.Sorted(maps.Keys(channels)) {
+			for _, target := range channelTargets(ctx, name) {
+				if !slices.Contains(targets, target) {
+					targets = append(targets, target)
+				}
+			}
+		}
+		return targets, true
+	case strings.Contains(to, ":"):
+		return []string{to}, true
+	}
+	return nil, false
+}
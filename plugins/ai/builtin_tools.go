@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内置的原生工具，无需 MCP 服务
+func init() {
+	_ = RegisterTool(NativeTool{
+		Name:        "calculate",
+		Description: "Evaluate an arithmetic expression with + - * / % and parentheses, e.g. \"(3.5 + 2) * 4\". Use it instead of mental arithmetic.",
+		Schema:      json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"Arithmetic expression"}},"required":["expression"]}`),
+		Handler:     calculateTool,
+	})
+	_ = RegisterTool(NativeTool{
+		Name:        "current_time",
+		Description: "Get the current date and time, optionally in an IANA time zone such as \"Asia/Shanghai\".",
+		Schema:      json.RawMessage(`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA time zone, default Asia/Shanghai"}}}`),
+		Handler:     currentTimeTool,
+	})
+}
+
+func calculateTool(_ context.Context, args map[string]interface{}) (string, error) {
+	expr, _ := args["expression"].(string)
+	if strings.TrimSpace(expr) == "" {
+		return "", fmt.Errorf("expression is required")
+	}
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid expression: %w", err)
+	}
+	v, err := evalExpr(node)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', 15, 64), nil
+}
+
+// evalExpr 计算只包含数字和四则运算的表达式
+func evalExpr(node ast.Expr) (float64, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return 0, fmt.Errorf("unsupported literal %s", n.Value)
+		}
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.ParenExpr:
+		return evalExpr(n.X)
+	case *ast.UnaryExpr:
+		x, err := evalExpr(n.X)
+		if err != nil {
+			return 0, err
+		}
+		switch n.Op {
+		case token.SUB:
+			return -x, nil
+		case token.ADD:
+			return x, nil
+		}
+		return 0, fmt.Errorf("unsupported operator %s", n.Op)
+	case *ast.BinaryExpr:
+		x, err := evalExpr(n.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalExpr(n.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch n.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return math.Mod(x, y), nil
+		}
+		return 0, fmt.Errorf("unsupported operator %s", n.Op)
+	}
+	return 0, fmt.Errorf("unsupported expression")
+}
+
+func currentTimeTool(_ context.Context, args map[string]interface{}) (string, error) {
+	name, _ := args["timezone"].(string)
+	if name == "" {
+		name = "Asia/Shanghai"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown time zone %s", name)
+	}
+	now := time.Now().In(loc)
+	return now.Format("2006-01-02 15:04:05 Monday MST"), nil
+}
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+const (
+	// confirmCallback 工具确认按钮的回调名
+	confirmCallback = "tool_confirm"
+	// confirmTimeout 等待用户确认的时间，超时视为拒绝
+	confirmTimeout = 60 * time.Second
+)
+
+// confirmations 等待用户确认的工具调用
+type confirmations struct {
+	mu      sync.Mutex
+	seq     int
+	pending map[string]*pendingConfirm
+}
+
+type pendingConfirm struct {
+	owner string
+	ch    chan bool
+}
+
+func newConfirmations() *confirmations {
+	return &confirmations{pending: make(map[string]*pendingConfirm)}
+}
+
+func (cs *confirmations) add(owner string) (string, chan bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.seq++
+	id := fmt.Sprintf("c%d", cs.seq)
+	ch := make(chan bool, 1)
+	cs.pending[id] = &pendingConfirm{owner: owner, ch: ch}
+	return id, ch
+}
+
+func (cs *confirmations) remove(id string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.pending, id)
+}
+
+// resolve answers a pending confirmation of owner. An empty id picks the latest one of owner.
+func (cs *confirmations) resolve(owner, id string, ok bool) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if id == "" {
+		latest := 0
+		for pid, pc := range cs.pending {
+			var n int
+			if _, err := fmt.Sscanf(pid, "c%d", &n); err == nil && pc.owner == owner && n > latest {
+				latest, id = n, pid
+			}
+		}
+	}
+	pc, found := cs.pending[id]
+	if !found || pc.owner != owner {
+		return false
+	}
+	delete(cs.pending, id)
+	pc.ch <- ok
+	return true
+}
+
+// confirmFunc 通过按钮（或 /confirm 指令）向发起请求的用户确认工具调用，lang 为提示使用的语言
+func (p *AIPlugin) confirmFunc(c core.Context, lang string) ConfirmFunc {
+	owner := core.UserKey(c)
+	return func(ctx context.Context, tool, arguments string) bool {
+		id, ch := p.confirms.add(owner)
+		defer p.confirms.remove(id)
+
+		text := i18n.T(lang, "confirm.prompt", tool, truncateRunes(arguments, 500), int(confirmTimeout.Seconds()), id)
+		_, err := c.SendButtons(text, [][]core.Button{{
+			{Text: i18n.T(lang, "confirm.yes"), Name: confirmCallback, Data: id + ":yes"},
+			{Text: i18n.T(lang, "confirm.no"), Name: confirmCallback, Data: id + ":no"},
+		}})
+		if errors.Is(err, core.ErrNotSupported) {
+			err = c.Reply(text)
+		}
+		if err != nil {
+			return false
+		}
+
+		select {
+		case ok := <-ch:
+			return ok
+		case <-time.After(confirmTimeout):
+			_ = c.Reply(i18n.T(lang, "confirm.timeout", tool))
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// handleConfirm 处理确认按钮和 /confirm [ID] yes|no 指令
+func (p *AIPlugin) handleConfirm(ctx *plugins.Context, c core.Context) error {
+	owner := core.UserKey(c)
+
+	var id, answer string
+	if data := c.Data(); data != "" {
+		id, answer, _ = strings.Cut(data, ":")
+	} else {
+		parts := strings.Fields(c.Text())
+		switch len(parts) {
+		case 2:
+			answer = parts[1]
+		case 3:
+			id, answer = parts[1], parts[2]
+		default:
+			return c.Reply(ctx.T(c, "confirm.usage"))
+		}
+	}
+
+	var ok bool
+	switch strings.ToLower(answer) {
+	case "yes", "y", "是":
+		ok = true
+	case "no", "n", "否":
+	default:
+		return c.Reply(ctx.T(c, "confirm.invalid"))
+	}
+
+	if !p.confirms.resolve(owner, id, ok) {
+		return c.Reply(ctx.T(c, "confirm.none"))
+	}
+	ctx.Logger.Info("Tool call confirmation", "id", id, "user", owner, "approved", ok)
+	if ok {
+		return c.Reply(ctx.T(c, "confirm.approved"))
+	}
+	return c.Reply(ctx.T(c, "confirm.rejected"))
+}
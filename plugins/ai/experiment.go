@@ -0,0 +1,266 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// followUpWindow 回答后多久内继续提问算作追问
+const followUpWindow = 2 * time.Minute
+
+// experimentSampled 实验开启时按 experiment.sample 抽样普通文字对话
+func experimentSampled(cfg *config.Config, s *storage.Storage, images []string, opts Options) bool {
+	if !opts.experiment || opts.regenerate || len(images) > 0 || cfg.Experiment.Name == "" {
+		return false
+	}
+	return s.ExperimentEnabled() && rand.Float64() < cfg.Experiment.Sample
+}
+
+// experimentVariant returns the variant named "a" or "b"
+func experimentVariant(cfg *config.Config, name string) config.ExperimentVariant {
+	if name == "b" {
+		return cfg.Experiment.B
+	}
+	return cfg.Experiment.A
+}
+
+// variantConfig applies the model of the variant to aiCfg
+func variantConfig(aiCfg config.AIConfig, v config.ExperimentVariant) config.AIConfig {
+	if v.Model != "" {
+		aiCfg.Model = v.Model
+	}
+	return aiCfg
+}
+
+// runExperiment 用两个变体并行生成回答，随机选择一个发送给用户。
+// 未发送的变体不使用工具，避免提醒、Webhook 等有副作用的工具被执行两次。
+// extraPrompt 是附加在系统提示词后的知识库和禁聊说明，变体替换提示词时保留。
+func (p *AIPlugin) runExperiment(
+	executeCtx context.Context,
+	cfg *config.Config,
+	logger *slog.Logger,
+	aiCfg config.AIConfig,
+	messages []ChatMessage,
+	extraPrompt, platformPrompt string,
+	opts Options,
+	toolsDisabled bool,
+) (*ExecutionResult, *storage.Trial, error) {
+	delivered, shadow := "a", "b"
+	if rand.IntN(2) == 1 {
+		delivered, shadow = shadow, delivered
+	}
+
+	generate := func(name string, withTools bool) (*ExecutionResult, error) {
+		v := experimentVariant(cfg, name)
+		variantCfg := variantConfig(aiCfg, v)
+		msgs := slices.Clone(messages)
+		if v.Prompt != "" {
+			msgs[0].Content = v.Prompt + extraPrompt
+		}
+		if !withTools {
+			return p.toolExecutor.ExecuteWithoutToolsContext(executeCtx, variantCfg, msgs)
+		}
+		return p.toolExecutor.Execute(executeCtx, variantCfg, msgs, platformPrompt, opts)
+	}
+
+	var shadowResult *ExecutionResult
+	var shadowErr error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		shadowResult, shadowErr = generate(shadow, false)
+	})
+	result, err := generate(delivered, !toolsDisabled)
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trial := &storage.Trial{
+		Experiment: cfg.Experiment.Name,
+		Time:       time.Now(),
+		Answers:    map[string]string{delivered: result.Content},
+		Delivered:  delivered,
+	}
+	if shadowErr != nil {
+		logger.Warn("Experiment variant failed", "variant", shadow, "error", shadowErr)
+	} else {
+		logResult(logger, nil, cfg.Limits, "experiment", "", variantConfig(aiCfg, experimentVariant(cfg, shadow)).Model, shadowResult)
+		trial.Answers[shadow] = shadowResult.Content
+	}
+	return result, trial, nil
+}
+
+// saveTrial 保存两个变体都生成成功的样本，返回是否保存
+func saveTrial(ctx core.Context, s *storage.Storage, logger *slog.Logger, trial *storage.Trial, question, answer string) bool {
+	if len(trial.Answers) < 2 {
+		return false
+	}
+	trial.User = core.UserKey(ctx)
+	trial.Chat = policy.ChatKey(ctx)
+	trial.Question = question
+	// 禁聊策略可能替换了发送的回答
+	trial.Answers[trial.Delivered] = answer
+	if err := s.AddTrial(trial); err != nil {
+		logger.Error("Failed to save experiment trial", "error", err)
+		return false
+	}
+	logger.Info("Experiment trial", "experiment", trial.Experiment, "id", trial.ID, "delivered", trial.Delivered)
+	return true
+}
+
+// markFollowUp 用户在回答后很快继续提问时，将上一个实验样本标记为有追问
+func markFollowUp(c core.Context, s *storage.Storage, logger *slog.Logger) {
+	if !s.ExperimentEnabled() {
+		return
+	}
+	user := core.UserKey(c)
+	if _, err := s.MarkTrialFollowUp(user, policy.ChatKey(c), time.Now().Add(-followUpWindow)); err != nil {
+		logger.Error("Failed to save experiment follow-up", "error", err)
+	}
+}
+
+// experimentCommand /experiment [on|off|reset|show <样本编号>]（管理员），不带参数时查看实验结果
+func (p *AIPlugin) experimentCommand(ctx *plugins.Context) *core.Command {
+	cfg := ctx.Config
+	s := ctx.Storage
+	exp := cfg.Experiment
+	admin := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "experiment.admin_only"))
+			}
+			if exp.Name == "" {
+				return c.Reply(ctx.T(c, "experiment.not_configured"))
+			}
+			return handler(c, args)
+		}
+	}
+	toggle := func(on bool) func(c core.Context, args core.Args) error {
+		return admin(func(c core.Context, _ core.Args) error {
+			if err := s.SetExperimentEnabled(on); err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			ctx.Logger.Info("Experiment toggled", "experiment", exp.Name, "enabled", on)
+			if on {
+				return c.Reply(ctx.T(c, "experiment.on", exp.Name, exp.Sample*100))
+			}
+			return c.Reply(ctx.T(c, "experiment.off", exp.Name))
+		})
+	}
+
+	return &core.Command{
+		Name:        "/experiment",
+		Description: "A/B 提示词实验（管理员）",
+		Admin:       true,
+		Handler: admin(func(c core.Context, _ core.Args) error {
+			return c.Reply(experimentReport(ctx, c))
+		}),
+		Subcommands: []*core.Command{
+			{Name: "on", Handler: toggle(true)},
+			{Name: "off", Handler: toggle(false)},
+			{Name: "reset", Handler: admin(func(c core.Context, _ core.Args) error {
+				n, err := s.ClearTrials(exp.Name)
+				if err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				return c.Reply(ctx.T(c, "experiment.reset", exp.Name, n))
+			})},
+			{Name: "show", Args: []core.Arg{{Name: "样本编号"}}, Handler: admin(func(c core.Context, args core.Args) error {
+				id := args["样本编号"]
+				for _, t := range s.ExperimentTrials(exp.Name) {
+					if t.ID == id {
+						return c.Reply(formatTrial(ctx, c, t))
+					}
+				}
+				return c.Reply(ctx.T(c, "experiment.not_found", id))
+			})},
+		},
+	}
+}
+
+// experimentReport 按变体统计发送次数、👍/👎 和追问率，评价只统计仍保留样本的回答
+func experimentReport(ctx *plugins.Context, c core.Context) string {
+	cfg, s := ctx.Config, ctx.Storage
+	exp := cfg.Experiment
+	trials := s.ExperimentTrials(exp.Name)
+	sampled := make(map[string]bool, len(trials))
+	for _, t := range trials {
+		sampled[t.RequestID] = true
+	}
+	ratings := s.GetRatings()
+
+	status := ctx.T(c, "experiment.status_off")
+	if s.ExperimentEnabled() {
+		status = ctx.T(c, "experiment.status_on")
+	}
+	def := ctx.T(c, "settings.default")
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "experiment.report", exp.Name, status, exp.Sample*100, len(trials)))
+	for _, name := range []string{"a", "b"} {
+		v := experimentVariant(cfg, name)
+		var sent, up, down, followUps int
+		for _, t := range trials {
+			if t.Delivered != name {
+				continue
+			}
+			sent++
+			if t.FollowUp {
+				followUps++
+			}
+		}
+		for _, r := range ratings {
+			if r.Experiment != exp.Name || r.Variant != name || !sampled[r.RequestID] {
+				continue
+			}
+			if r.Score > 0 {
+				up++
+			} else {
+				down++
+			}
+		}
+		b.WriteString(ctx.T(c, "experiment.variant",
+			name, orDefault(v.Model, def), orDefault(truncateRunes(v.Prompt, 20), def), sent, up, down, followUps))
+		if sent > 0 {
+			fmt.Fprintf(&b, " (%.0f%%)", float64(followUps)/float64(sent)*100)
+		}
+		b.WriteString("\n")
+	}
+	if n := len(trials); n > 0 {
+		b.WriteString(ctx.T(c, "experiment.latest", trials[n-1].ID))
+	}
+	b.WriteString(ctx.T(c, "experiment.footer"))
+	return b.String()
+}
+
+func formatTrial(ctx *plugins.Context, c core.Context, t storage.Trial) string {
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "experiment.trial", t.ID, t.User, t.Time.In(ctx.Location(c)).Format("01-02 15:04"), t.Question))
+	for _, name := range []string{"a", "b"} {
+		mark := ""
+		if name == t.Delivered {
+			mark = ctx.T(c, "experiment.delivered")
+		}
+		b.WriteString(ctx.T(c, "experiment.answer", name, mark, truncateRunes(t.Answers[name], 1500)))
+	}
+	return b.String()
+}
+
+// orDefault 空值显示为 def
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,219 @@
+package ai
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// feedbackCallback 回答评价按钮的回调名
+const feedbackCallback = "feedback"
+
+// answerRetention 回答在内存中保留多久，超过后按钮评价提示已过期
+const answerRetention = 24 * time.Hour
+
+// answer 一次可以被评价的 AI 回答
+type answer struct {
+	requestID string
+	user      string // 提问者 Platform:UserID
+	chat      string
+	model     string
+	persona   string
+	time      time.Time
+
+	// experiment 和 variant 在回答来自 A/B 实验样本时设置
+	experiment string
+	variant    string
+}
+
+// answers 最近的 AI 回答，用于把按钮和 emoji 评价关联到请求
+type answers struct {
+	mu     sync.Mutex
+	byID   map[string]*answer
+	latest map[string]*answer // user|chat → 最近的回答
+}
+
+func newAnswers() *answers {
+	return &answers{byID: make(map[string]*answer), latest: make(map[string]*answer)}
+}
+
+func (as *answers) add(a *answer) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	cutoff := time.Now().Add(-answerRetention)
+	maps.DeleteFunc(as.byID, func(_ string, old *answer) bool { return old.time.Before(cutoff) })
+	maps.DeleteFunc(as.latest, func(_ string, old *answer) bool { return old.time.Before(cutoff) })
+	as.byID[a.requestID] = a
+	as.latest[a.user+"|"+a.chat] = a
+}
+
+func (as *answers) get(requestID string) *answer {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.byID[requestID]
+}
+
+// latestSince returns the user's latest answer in the chat if it was given after since
+func (as *answers) latestSince(user, chat string, since time.Time) *answer {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	a := as.latest[user+"|"+chat]
+	if a == nil || a.time.Before(since) {
+		return nil
+	}
+	return a
+}
+
+// offerFeedback 记录回答以便评价，开启按钮时在回答后附带 👍/👎。实验样本的回答总是附带按钮
+func (p *AIPlugin) offerFeedback(ctx core.Context, cfg *config.Config, s *storage.Storage, logger *slog.Logger, a *answer) {
+	buttons := cfg.Feedback.Buttons || a.variant != ""
+	if !buttons && !cfg.Feedback.Emoji {
+		return
+	}
+	p.answers.add(a)
+	if !buttons {
+		return
+	}
+	_, err := ctx.SendButtons(i18n.T(core.UserLang(cfg, s, ctx), "feedback.prompt"), [][]core.Button{{
+		{Text: "👍", Name: feedbackCallback, Data: a.requestID + ":up"},
+		{Text: "👎", Name: feedbackCallback, Data: a.requestID + ":down"},
+	}})
+	if err != nil && !errors.Is(err, core.ErrNotSupported) {
+		logger.Error("Failed to send feedback buttons", "error", err)
+	}
+}
+
+// emojiScore 将单独的 👍/👎（可带肤色）转换为评价分数
+func emojiScore(text string) (int, bool) {
+	text = strings.Map(func(r rune) rune {
+		if r == 0xFE0F || (r >= 0x1F3FB && r <= 0x1F3FF) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+	switch text {
+	case "👍":
+		return 1, true
+	case "👎":
+		return -1, true
+	}
+	return 0, false
+}
+
+// handleEmojiFeedback 把 👍/👎 消息记录为对该用户上一个回答的评价，不是评价时返回 false
+func (p *AIPlugin) handleEmojiFeedback(ctx *plugins.Context, c core.Context) (bool, error) {
+	if !ctx.Config.Feedback.Emoji {
+		return false, nil
+	}
+	score, ok := emojiScore(c.Text())
+	if !ok {
+		return false, nil
+	}
+	user := core.UserKey(c)
+	a := p.answers.latestSince(user, policy.ChatKey(c), time.Now().Add(-ctx.Config.Feedback.Window))
+	if a == nil {
+		return false, nil
+	}
+	return true, p.rate(ctx, c, a, score)
+}
+
+// handleFeedbackButton 处理回答后的 👍/👎 按钮
+func (p *AIPlugin) handleFeedbackButton(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+	id, vote, _ := strings.Cut(c.Data(), ":")
+	a := p.answers.get(id)
+	if a == nil {
+		return c.Reply(ctx.T(c, "feedback.expired"))
+	}
+	score := 1
+	if vote == "down" {
+		score = -1
+	}
+	return p.rate(ctx, c, a, score)
+}
+
+func (p *AIPlugin) rate(ctx *plugins.Context, c core.Context, a *answer, score int) error {
+	rater := core.UserKey(c)
+	err := ctx.Storage.AddRating(storage.Rating{
+		RequestID:  a.requestID,
+		User:       rater,
+		Chat:       a.chat,
+		Model:      a.model,
+		Persona:    a.persona,
+		Experiment: a.experiment,
+		Variant:    a.variant,
+		Score:      score,
+		Time:       time.Now(),
+	})
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	ctx.Logger.Info("Answer rated", "request_id", a.requestID, "user", rater, "score", score)
+	return c.Reply(ctx.T(c, "feedback.thanks"))
+}
+
+// satisfactionReport 按模型、人设和实验变体统计 👍/👎 和满意度
+func satisfactionReport(ctx *plugins.Context, c core.Context, ratings []storage.Rating) string {
+	if len(ratings) == 0 {
+		return ctx.T(c, "feedback.no_ratings")
+	}
+	def := ctx.T(c, "settings.default")
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "feedback.report", len(ratings)))
+	writeGroup := func(title string, key func(storage.Rating) string) {
+		type tally struct{ up, down int }
+		groups := make(map[string]*tally)
+		for _, r := range ratings {
+			k := key(r)
+			if k == "" {
+				continue
+			}
+			if groups[k] == nil {
+				groups[k] = &tally{}
+			}
+			if r.Score > 0 {
+				groups[k].up++
+			} else {
+				groups[k].down++
+			}
+		}
+		if len(groups) == 0 {
+			return
+		}
+		b.WriteString("\n" + title + "：\n")
+		for _, k := range slices.Sorted(maps.Keys(groups)) {
+			t := groups[k]
+			b.WriteString(ctx.T(c, "feedback.group", k, t.up, t.down, float64(t.up)/float64(t.up+t.down)*100))
+		}
+	}
+	writeGroup(ctx.T(c, "feedback.by_model"), func(r storage.Rating) string { return orDefault(r.Model, def) })
+	writeGroup(ctx.T(c, "feedback.by_persona"), func(r storage.Rating) string { return orDefault(r.Persona, def) })
+	writeGroup(ctx.T(c, "feedback.by_variant"), func(r storage.Rating) string {
+		if r.Variant == "" {
+			return ""
+		}
+		return r.Experiment + "/" + r.Variant
+	})
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// handleStats /stats 查看运行状态和回答满意度（管理员）
+func (p *AIPlugin) handleStats(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "stats.admin_only"))
+	}
+	return c.Reply(p.runtimeReport(ctx, c) + "\n\n" + satisfactionReport(ctx, c, ctx.Storage.GetRatings()))
+}
@@ -0,0 +1,30 @@
+package ai
+
+import (
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// groupSettings 返回群管理员通过 /settings 设置的群聊设置，私聊为零值；
+// ok 为 false 时这条消息不由 AI 回复：群里关闭了 AI，或只回复 @机器人 的消息而这条消息不是
+func groupSettings(s *storage.Storage, c core.Context) (storage.GroupSettings, bool) {
+	if c.Chat().Type == "private" {
+		return storage.GroupSettings{}, true
+	}
+	g := s.GetGroupSettings(policy.ChatKey(c))
+	if g.AIDisabled || (g.Trigger == storage.TriggerMention && !core.IsAddressed(c)) {
+		return g, false
+	}
+	return g, true
+}
+
+// groupPrompt 群人设的系统提示词，优先于成员自己的人设和女朋友定制
+func groupPrompt(cfg *config.Config, g storage.GroupSettings, profile storage.UserProfile) (string, string, bool) {
+	prompt, ok := cfg.GetPersonaPrompt(g.Persona)
+	if !ok {
+		return "", "", false
+	}
+	return prompt + profilePrompt(profile), "group:" + g.Persona, true
+}
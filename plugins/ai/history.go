@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// historyMaxMessages 每个用户保留的最近消息条数（用户 + 助手）
+	historyMaxMessages = 10
+	// historyTTL 超过该时间没有对话则清空记忆
+	historyTTL = 30 * time.Minute
+)
+
+// conversationHistory 保存开启了对话记忆的用户最近几轮对话（仅内存）
+type conversationHistory struct {
+	mu    sync.Mutex
+	convs map[string]*conversation
+}
+
+type conversation struct {
+	messages   []ChatMessage
+	lastActive time.Time
+}
+
+func newConversationHistory() *conversationHistory {
+	return &conversationHistory{convs: make(map[string]*conversation)}
+}
+
+// Get returns a copy of the recent messages of key
+func (h *conversationHistory) Get(key string) []ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conv, ok := h.convs[key]
+	if !ok {
+		return nil
+	}
+	if time.Since(conv.lastActive) > historyTTL {
+		delete(h.convs, key)
+		return nil
+	}
+	return append([]ChatMessage(nil), conv.messages...)
+}
+
+// Append records one exchange and trims the conversation to the newest messages
+func (h *conversationHistory) Append(key string, userMessage, reply string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conv, ok := h.convs[key]
+	if !ok || time.Since(conv.lastActive) > historyTTL {
+		conv = &conversation{}
+		h.convs[key] = conv
+	}
+	conv.messages = append(conv.messages,
+		ChatMessage{Role: "user", Content: userMessage},
+		ChatMessage{Role: "assistant", Content: reply},
+	)
+	if len(conv.messages) > historyMaxMessages {
+		conv.messages = conv.messages[len(conv.messages)-historyMaxMessages:]
+	}
+	conv.lastActive = time.Now()
+}
+
+// Clear forgets the conversation of key
+func (h *conversationHistory) Clear(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.convs, key)
+}
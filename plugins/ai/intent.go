@@ -0,0 +1,165 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// intentChat 不属于任何配置的意图，照常对话
+const intentChat = "chat"
+
+// intentRouter 按 intents 配置判断普通消息的意图，先匹配正则，都不匹配时由模型分类
+type intentRouter struct {
+	cfg   config.IntentsConfig
+	rules []intentRule
+	// useModel 有带说明的意图，正则都不匹配时需要模型分类
+	useModel bool
+}
+
+type intentRule struct {
+	config.IntentRule
+	regex *regexp.Regexp
+}
+
+// intentResult 模型的分类结果
+type intentResult struct {
+	Intent string `json:"intent" desc:"意图名称，不属于任何意图时为 chat"`
+	Args   string `json:"args" desc:"从消息中提取的指令参数，没有时为空字符串"`
+}
+
+// newIntentRouter 未启用或没有配置意图时返回 nil
+func newIntentRouter(cfg config.IntentsConfig) (*intentRouter, error) {
+	if !cfg.Enabled || len(cfg.Intents) == 0 {
+		return nil, nil
+	}
+	r := &intentRouter{cfg: cfg}
+	for i, rc := range cfg.Intents {
+		rule := intentRule{IntentRule: rc}
+		if rc.Regex != "" {
+			re, err := regexp.Compile(rc.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("intents[%d]: %w", i, err)
+			}
+			rule.regex = re
+		}
+		r.useModel = r.useModel || rc.Description != ""
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// match 返回匹配正则的意图和第一个捕获组
+func (r *intentRouter) match(text string) (*intentRule, string) {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.regex == nil {
+			continue
+		}
+		if m := rule.regex.FindStringSubmatch(text); m != nil {
+			var args string
+			if len(m) > 1 {
+				args = strings.TrimSpace(m[1])
+			}
+			return rule, args
+		}
+	}
+	return nil, ""
+}
+
+// prompt 分类用的系统提示词，列出各意图及指令的用法
+func (r *intentRouter) prompt(commands *core.CommandSet) string {
+	var b strings.Builder
+	b.WriteString("判断用户消息的意图。可选的意图：\n")
+	for _, rule := range r.rules {
+		if rule.Description == "" {
+			continue
+		}
+		// 指令可以带子命令，如 "/game trivia"
+		usage := rule.Command
+		if cmd, ok := commands.Lookup(strings.Fields(rule.Command)[0]); ok {
+			var lines []string
+			for _, line := range cmd.Usage() {
+				if strings.HasPrefix(line, rule.Command) {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) > 0 {
+				usage = strings.Join(lines, "；")
+			}
+		}
+		fmt.Fprintf(&b, "- %s：%s（指令用法：%s）\n", rule.Name, rule.Description, usage)
+	}
+	fmt.Fprintf(&b, "- %s：其他消息（闲聊、提问等）\n", intentChat)
+	b.WriteString("只有明确属于某个意图时才选择它，不确定时选择 chat。args 只填写指令名之后的参数。")
+	return b.String()
+}
+
+// classify 返回消息所属的意图和指令参数，属于 chat 或分类失败时返回 nil
+func (p *AIPlugin) classify(ctx *plugins.Context, c core.Context) (*intentRule, string) {
+	r := p.intents
+	logger := core.Logger(c, ctx.Logger)
+	text := strings.TrimSpace(c.Text())
+	if rule, args := r.match(text); rule != nil {
+		return rule, args
+	}
+	if !r.useModel {
+		return nil, ""
+	}
+
+	aiCfg := ctx.Config.AI
+	if r.cfg.Model != "" {
+		aiCfg.Model = r.cfg.Model
+	}
+	start := time.Now()
+	var result intentResult
+	completion, err := GenerateStructured(aiCfg, []ChatMessage{
+		{Role: "system", Content: r.prompt(ctx.Commands)},
+		{Role: "user", Content: text},
+	}, "intent", &result)
+	if completion != nil {
+		logResult(logger, ctx.Storage, ctx.Config.Limits, "intent", core.UserKey(c), aiCfg.Model, &ExecutionResult{
+			Content:  completion.Message.Content,
+			Usage:    completion.Usage,
+			Duration: time.Since(start),
+		})
+	}
+	if err != nil {
+		logger.Warn("Failed to classify intent", "error", err)
+		return nil, ""
+	}
+	for i := range r.rules {
+		if r.rules[i].Name == result.Intent && r.rules[i].Description != "" {
+			return &r.rules[i], strings.Join(strings.Fields(result.Args), " ")
+		}
+	}
+	return nil, ""
+}
+
+// routeIntent 消息属于某个意图时执行对应的指令，返回是否已处理
+func (p *AIPlugin) routeIntent(ctx *plugins.Context, c core.Context) bool {
+	if p.intents == nil {
+		return false
+	}
+	rule, args := p.classify(ctx, c)
+	if rule == nil {
+		return false
+	}
+	logger := core.Logger(c, ctx.Logger)
+	text := strings.TrimSpace(rule.Command + " " + args)
+	logger.Info("Message routed by intent", "intent", rule.Name, "command", text, "user", core.UserKey(c))
+	ok, err := ctx.RunCommand(c, text)
+	if !ok {
+		logger.Warn("Intent command not found", "intent", rule.Name, "command", rule.Command)
+		return false
+	}
+	if err != nil {
+		logger.Error("Intent command failed", "intent", rule.Name, "error", err)
+	}
+	return true
+}
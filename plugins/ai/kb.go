@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/knowledge"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// kbCommand 上传文件时附带该说明即导入知识库，而不是总结文件
+const kbCommand = "/kb"
+
+// handleKB /kb 指令
+func (p *AIPlugin) handleKB(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+	if p.kb == nil {
+		return c.Reply(ctx.T(c, "kb.disabled"))
+	}
+
+	owner := core.UserKey(c)
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c.Text()), kbCommand))
+	op, arg, _ := strings.Cut(rest, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch op {
+	case "":
+		docs := p.kb.List(owner)
+		if len(docs) == 0 {
+			return c.Reply(ctx.T(c, "kb.empty") + ctx.T(c, "kb.usage"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "kb.title"))
+		loc := ctx.Location(c)
+		for _, d := range docs {
+			b.WriteString(ctx.T(c, "kb.item", d.ID, d.Name, len(d.Chunks), d.AddedAt.In(loc).Format("01-02 15:04")))
+		}
+		return c.Reply(b.String())
+	case "add":
+		if c.Document() != nil {
+			return p.ingestDocument(ctx, c)
+		}
+		if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+			return c.Reply(ctx.T(c, "kb.add_usage"))
+		}
+		return p.ingest(ctx, c, ctx.T(c, "kb.task", arg), func(taskCtx context.Context) (string, string, error) {
+			return p.kb.FetchURL(taskCtx, arg)
+		}, arg)
+	case "del", "remove":
+		removed, err := p.kb.Remove(owner, arg)
+		if err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		if !removed {
+			return c.Reply(ctx.T(c, "kb.not_found", arg))
+		}
+		return c.Reply(ctx.T(c, "kb.removed", arg))
+	case "clear":
+		if err := p.kb.Clear(owner); err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		return c.Reply(ctx.T(c, "kb.cleared"))
+	case "search":
+		if arg == "" {
+			return c.Reply(ctx.T(c, "kb.search_usage"))
+		}
+		searchCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		results, err := p.kb.Search(searchCtx, owner, arg)
+		if err != nil {
+			return c.Reply(ctx.T(c, "kb.search_failed", err))
+		}
+		if len(results) == 0 {
+			return c.Reply(ctx.T(c, "kb.no_results"))
+		}
+		var b strings.Builder
+		for i, r := range results {
+			b.WriteString(ctx.T(c, "kb.result", i+1, r.Document, r.Score, truncateRunes(r.Text, 200)))
+		}
+		return c.Reply(b.String())
+	default:
+		return c.Reply(ctx.T(c, "kb.usage"))
+	}
+}
+
+// ingestDocument 将上传的文本文件导入知识库
+func (p *AIPlugin) ingestDocument(ctx *plugins.Context, c core.Context) error {
+	doc := c.Document()
+	if !isTextDocument(doc) {
+		return c.Reply(ctx.T(c, "kb.text_only"))
+	}
+	if doc.Size > ctx.Config.Transcript.MaxFileSize {
+		return c.Reply(ctx.T(c, "kb.too_large", doc.Size>>10, ctx.Config.Transcript.MaxFileSize>>10))
+	}
+	return p.ingest(ctx, c, ctx.T(c, "kb.task", doc.Name), func(context.Context) (string, string, error) {
+		r, err := c.Download(doc)
+		if err != nil {
+			return "", "", err
+		}
+		defer r.Close()
+		data, err := io.ReadAll(io.LimitReader(r, ctx.Config.Transcript.MaxFileSize))
+		if err != nil {
+			return "", "", err
+		}
+		return doc.Name, string(data), nil
+	}, doc.Name)
+}
+
+// ingest 在后台任务中读取内容、分块并向量化
+func (p *AIPlugin) ingest(ctx *plugins.Context, c core.Context, taskName string, read func(context.Context) (string, string, error), source string) error {
+	owner := core.UserKey(c)
+	sentMsg, err := c.Send(ctx.T(c, "kb.importing"))
+	if err != nil {
+		return err
+	}
+
+	ctx.Tasks.Submit(owner, taskName, func(taskCtx context.Context, report func(string)) error {
+		report(ctx.T(c, "kb.stage_read"))
+		name, text, err := read(taskCtx)
+		if err != nil {
+			_ = c.Edit(sentMsg, ctx.T(c, "kb.read_failed", err))
+			return err
+		}
+
+		report(ctx.T(c, "kb.stage_embed"))
+		doc, err := p.kb.Add(taskCtx, owner, name, source, text)
+		if errors.Is(err, knowledge.ErrTooManyDocuments) {
+			_ = c.Edit(sentMsg, ctx.T(c, "kb.too_many"))
+			return err
+		}
+		if err != nil {
+			_ = c.Edit(sentMsg, ctx.T(c, "kb.import_failed", err))
+			return err
+		}
+
+		ctx.Logger.Info("Knowledge document added", "owner", owner, "id", doc.ID, "name", doc.Name, "chunks", len(doc.Chunks))
+		_ = c.Edit(sentMsg, ctx.T(c, "kb.imported", doc.Name, doc.ID, len(doc.Chunks)))
+		return nil
+	})
+	return nil
+}
+
+// knowledgePrompt 检索与问题相关的知识库内容，失败时只记录日志
+func (p *AIPlugin) knowledgePrompt(ctx context.Context, c core.Context, logger *slog.Logger, question string) string {
+	if p.kb == nil {
+		return ""
+	}
+	owner := core.UserKey(c)
+	results, err := p.kb.Search(ctx, owner, question)
+	if err != nil {
+		logger.Warn("Knowledge search failed", "owner", owner, "error", err)
+		return ""
+	}
+	return knowledge.Prompt(results)
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
@@ -2,85 +2,258 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ChatMessage struct {
 	Role       string     `json:"role"`
 	Content    string     `json:"content"` // Can be null if tool_calls present
-    ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-    ToolCallID string     `json:"tool_call_id,omitempty"` // For tool response messages
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool response messages
+
+	// Images are image URLs (http(s) or data: URLs) sent along with Content as multimodal content parts
+	Images []string `json:"-"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"` // "text", "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON encodes Content as an array of content parts when the message carries images
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type plain ChatMessage
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	parts := []contentPart{{Type: "text", Text: m.Content}}
+	for _, url := range m.Images {
+		parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: url}})
+	}
+	return json.Marshal(struct {
+		plain
+		Content []contentPart `json:"content"`
+	}{plain(m), parts})
 }
 
 type ToolCall struct {
-    ID       string           `json:"id"`
-    Type     string           `json:"type"` // "function"
-    Function ToolCallFunction `json:"function"`
+	ID       string           `json:"id"`
+	Type     string           `json:"type"` // "function"
+	Function ToolCallFunction `json:"function"`
 }
 
 type ToolCallFunction struct {
-    Name      string `json:"name"`
-    Arguments string `json:"arguments"` // JSON string
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON string
 }
 
 type ToolDefinition struct {
-    Type     string   `json:"type"` // "function"
-    Function Function `json:"function"`
+	Type     string   `json:"type"` // "function"
+	Function Function `json:"function"`
 }
 
 type Function struct {
-    Name        string          `json:"name"`
-    Description string          `json:"description"`
-    Parameters  json.RawMessage `json:"parameters"` // JSON Schema
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // JSON Schema
 }
 
 type ChatRequest struct {
-	Model    string           `json:"model"`
-	Messages []ChatMessage    `json:"messages"`
-    Tools    []ToolDefinition `json:"tools,omitempty"`
+	Model            string           `json:"model"`
+	Messages         []ChatMessage    `json:"messages"`
+	Tools            []ToolDefinition `json:"tools,omitempty"`
+	MaxTokens        int              `json:"max_tokens,omitempty"`
+	Temperature      *float64         `json:"temperature,omitempty"`
+	TopP             *float64         `json:"top_p,omitempty"`
+	PresencePenalty  *float64         `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64         `json:"frequency_penalty,omitempty"`
+	Stop             []string         `json:"stop,omitempty"`
+	// 推理模型（OpenAI o 系列）用 max_completion_tokens 代替 max_tokens
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
+	// ResponseFormat 要求模型输出 JSON，见 GenerateStructured
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// newChatRequest builds the request body with the model and generation parameters of aiCfg
+func newChatRequest(aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) ChatRequest {
+	if isReasoningModel(aiCfg) {
+		// 推理模型不接受采样参数
+		return ChatRequest{
+			Model:               aiCfg.Model,
+			Messages:            messages,
+			Tools:               tools,
+			Stop:                aiCfg.Stop,
+			MaxCompletionTokens: aiCfg.MaxTokens,
+		}
+	}
+	return ChatRequest{
+		Model:            aiCfg.Model,
+		Messages:         messages,
+		Tools:            tools,
+		MaxTokens:        aiCfg.MaxTokens,
+		Temperature:      aiCfg.Temperature,
+		TopP:             aiCfg.TopP,
+		PresencePenalty:  aiCfg.PresencePenalty,
+		FrequencyPenalty: aiCfg.FrequencyPenalty,
+		Stop:             aiCfg.Stop,
+	}
+}
+
+// reasoningModelRegex OpenAI o 系列推理模型，如 "o1"、"o3-mini"、"openai/o4-mini"
+var reasoningModelRegex = regexp.MustCompile(`^(?:[\w-]+/)?o\d(?:$|-)`)
+
+// isReasoningModel reports whether the model needs the reasoning request format
+func isReasoningModel(aiCfg config.AIConfig) bool {
+	return aiCfg.ReasoningModel || reasoningModelRegex.MatchString(aiCfg.Model)
+}
+
+// thinkRegex 部分推理模型（DeepSeek-R1、QwQ 等）在回复内容中用 <think> 标签输出思考过程
+var thinkRegex = regexp.MustCompile(`(?s)^\s*<think>(.*?)</think>\s*`)
+
+// splitThinking 将回复内容中的思考过程分离出来。有的服务会省略开头的 <think>，只保留 </think>
+func splitThinking(content string) (answer, thinking string) {
+	if m := thinkRegex.FindStringSubmatchIndex(content); m != nil {
+		return content[m[1]:], strings.TrimSpace(content[m[2]:m[3]])
+	}
+	if before, after, ok := strings.Cut(content, "</think>"); ok && !strings.Contains(before, "<think>") {
+		return strings.TrimSpace(after), strings.TrimSpace(before)
+	}
+	return content, ""
 }
 
 type ChatResponse struct {
 	Choices []struct {
-		Message ChatMessage `json:"message"`
+		Message      responseMessage `json:"message"`
+		FinishReason string          `json:"finish_reason"`
 	} `json:"choices"`
+	Usage Usage `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-func Generate(baseURL, apiKey, model string, messages []ChatMessage, tools []ToolDefinition) (*ChatMessage, error) {
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimRight(baseURL, "/"))
-	
-    // Handle cases where baseURL already includes /chat/completions or /v1
-    if strings.Contains(baseURL, "/chat/completions") {
-        url = baseURL
-    }
+// responseMessage 响应中的消息，推理模型（如 deepseek-reasoner）在 reasoning_content 中单独返回思考过程。
+// 思考过程不能放回后续请求的消息中，所以不属于 ChatMessage
+type responseMessage struct {
+	ChatMessage
+	ReasoningContent string `json:"reasoning_content"`
+}
+
+// Usage is the token accounting reported by the API
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add accumulates the token counts of another response
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Completion is a single chat completion with its metadata
+type Completion struct {
+	Message      ChatMessage
+	FinishReason string // "stop", "length", "tool_calls", ...
+	Usage        Usage
+	Reasoning    string // 推理模型的思考过程，已从 Message.Content 中去除
+}
+
+// Generate returns only the message of a chat completion
+func Generate(aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) (*ChatMessage, error) {
+	return GenerateContext(context.Background(), aiCfg, messages, tools)
+}
+
+// GenerateContext is Generate with a context, cancelling ctx aborts the request
+func GenerateContext(ctx context.Context, aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) (*ChatMessage, error) {
+	completion, err := CompleteContext(ctx, aiCfg, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	return &completion.Message, nil
+}
+
+// APIError is returned when the API responds with a non-200 status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %s (status: %d)", e.Body, e.StatusCode)
+}
+
+// Complete sends a chat completion request and returns the first choice with usage
+func Complete(aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) (*Completion, error) {
+	return CompleteContext(context.Background(), aiCfg, messages, tools)
+}
+
+// CompleteContext is Complete with a context, the request is recorded as a span of the trace in ctx
+func CompleteContext(ctx context.Context, aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) (*Completion, error) {
+	return completeRequest(ctx, aiCfg, newChatRequest(aiCfg, messages, tools))
+}
 
-	reqBody := ChatRequest{
-		Model:    model,
-		Messages: messages,
-        Tools:    tools,
+// completeRequest sends a prepared request body to the chat completions endpoint of aiCfg
+func completeRequest(ctx context.Context, aiCfg config.AIConfig, chatReq ChatRequest) (completion *Completion, err error) {
+	ctx, span := tracer.Start(ctx, "chat "+chatReq.Model, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("gen_ai.operation.name", "chat"),
+		attribute.String("gen_ai.request.model", chatReq.Model),
+		attribute.Int("ggbot.messages", len(chatReq.Messages)),
+		attribute.Int("ggbot.tools", len(chatReq.Tools)),
+	))
+	defer func() {
+		if completion != nil {
+			span.SetAttributes(
+				attribute.Int("gen_ai.usage.input_tokens", completion.Usage.PromptTokens),
+				attribute.Int("gen_ai.usage.output_tokens", completion.Usage.CompletionTokens),
+				attribute.StringSlice("gen_ai.response.finish_reasons", []string{completion.FinishReason}),
+			)
+		}
+		endSpan(span, err)
+		recordAICall(err)
+	}()
+
+	url := fmt.Sprintf("%s/chat/completions", strings.TrimRight(aiCfg.BaseURL, "/"))
+
+	// Handle cases where baseURL already includes /chat/completions or /v1
+	if strings.Contains(aiCfg.BaseURL, "/chat/completions") {
+		url = aiCfg.BaseURL
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
+	jsonBody, err := json.Marshal(chatReq)
 	if err != nil {
 		return nil, err
 	}
-// ... (rest of the function needs update to return ChatMessage instead of string)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, err
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Authorization", "Bearer "+aiCfg.APIKey)
 
 	client := &http.Client{Timeout: 120 * time.Second} // Increase timeout for tools
 	resp, err := client.Do(req)
@@ -95,7 +268,7 @@ func Generate(baseURL, apiKey, model string, messages []ChatMessage, tools []Too
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s (status: %d)", string(body), resp.StatusCode)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var chatResp ChatResponse
@@ -112,5 +285,19 @@ func Generate(baseURL, apiKey, model string, messages []ChatMessage, tools []Too
 		return nil, fmt.Errorf("no response from AI")
 	}
 
-	return &chatResp.Choices[0].Message, nil
+	choice := chatResp.Choices[0]
+	message := choice.Message.ChatMessage
+	reasoning := strings.TrimSpace(choice.Message.ReasoningContent)
+	if content, thinking := splitThinking(message.Content); thinking != "" {
+		message.Content = content
+		if reasoning == "" {
+			reasoning = thinking
+		}
+	}
+	return &Completion{
+		Message:      message,
+		FinishReason: choice.FinishReason,
+		Usage:        chatResp.Usage,
+		Reasoning:    reasoning,
+	}, nil
 }
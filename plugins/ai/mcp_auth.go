@@ -0,0 +1,501 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+	"golang.org/x/oauth2"
+)
+
+// errMCPUnauthorized 服务配置了 auth 但还没有完成授权
+var errMCPUnauthorized = errors.New("MCP server is not authorized")
+
+// mcpOAuth 一个 MCP 服务的 OAuth 2.1 授权：发现授权服务器、设备码/授权码流程、token 缓存与刷新
+type mcpOAuth struct {
+	name      string
+	serverURL string
+	cfg       config.MCPAuthConfig
+	store     *storage.Storage
+	client    *http.Client // 与 MCP 服务相同的代理设置
+
+	mu       sync.Mutex
+	conf     *oauth2.Config // 发现授权服务器后设置
+	source   oauth2.TokenSource
+	saved    string // 最近保存的 access token，刷新后变化时重新保存
+	verifier string // 进行中的授权码流程的 PKCE verifier
+	state    string
+}
+
+// authServerMeta RFC 8414 授权服务器元数据中用到的字段
+type authServerMeta struct {
+	AuthorizationEndpoint       string   `json:"authorization_endpoint"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+	RegistrationEndpoint        string   `json:"registration_endpoint"`
+	ScopesSupported             []string `json:"scopes_supported"`
+}
+
+// protectedResourceMeta RFC 9728 受保护资源元数据中用到的字段
+type protectedResourceMeta struct {
+	AuthorizationServers []string `json:"authorization_servers"`
+	ScopesSupported      []string `json:"scopes_supported"`
+}
+
+func newMCPOAuth(name string, mcpCfg config.MCPConfig, store *storage.Storage, base http.RoundTripper) *mcpOAuth {
+	return &mcpOAuth{
+		name:      name,
+		serverURL: mcpCfg.URL,
+		cfg:       *mcpCfg.Auth,
+		store:     store,
+		client:    &http.Client{Timeout: 30 * time.Second, Transport: base},
+	}
+}
+
+// Authorized reports whether a token is cached for the server
+func (a *mcpOAuth) Authorized() bool {
+	cached := a.store.GetMCPToken(a.name)
+	return cached != nil && cached.AccessToken != ""
+}
+
+// Token implements oauth2.TokenSource. Expired tokens are refreshed and the new token is cached.
+func (a *mcpOAuth) Token() (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.source == nil {
+		cached := a.store.GetMCPToken(a.name)
+		if cached == nil || cached.AccessToken == "" {
+			return nil, errMCPUnauthorized
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		conf, err := a.config(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		a.source = conf.TokenSource(a.httpContext(context.Background()), &oauth2.Token{
+			AccessToken:  cached.AccessToken,
+			RefreshToken: cached.RefreshToken,
+			TokenType:    cached.TokenType,
+			Expiry:       cached.Expiry,
+		})
+		a.saved = cached.AccessToken
+	}
+
+	tok, err := a.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("refresh MCP token: %w", err)
+	}
+	if tok.AccessToken != a.saved {
+		if err := a.save(tok); err != nil {
+			return nil, err
+		}
+	}
+	return tok, nil
+}
+
+// StartDevice 开始设备码授权，返回需要展示给用户的验证地址和用户码
+func (a *mcpOAuth) StartDevice(ctx context.Context) (*oauth2.DeviceAuthResponse, error) {
+	a.mu.Lock()
+	conf, err := a.config(ctx)
+	a.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if conf.Endpoint.DeviceAuthURL == "" {
+		return nil, fmt.Errorf("authorization server does not support the device flow, set auth.flow: code")
+	}
+	return conf.DeviceAuth(a.httpContext(ctx), a.resourceParam())
+}
+
+// WaitDevice polls the token endpoint until the user approves the device code
+func (a *mcpOAuth) WaitDevice(ctx context.Context, da *oauth2.DeviceAuthResponse) error {
+	a.mu.Lock()
+	conf := a.conf
+	a.mu.Unlock()
+
+	tok, err := conf.DeviceAccessToken(a.httpContext(ctx), da, a.resourceParam())
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// 新授权的 token，下次使用时重建 token source
+	a.source = nil
+	return a.save(tok)
+}
+
+// AuthCodeURL 开始授权码 (PKCE) 流程，返回用户需要在浏览器中打开的地址
+func (a *mcpOAuth) AuthCodeURL(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	conf, err := a.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.verifier = oauth2.GenerateVerifier()
+	a.state = oauth2.GenerateVerifier()[:16]
+	return conf.AuthCodeURL(a.state, oauth2.S256ChallengeOption(a.verifier), a.resourceParam()), nil
+}
+
+// Exchange 用授权后得到的 code（或完整的回调地址）换取 token
+func (a *mcpOAuth) Exchange(ctx context.Context, code string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.verifier == "" || a.conf == nil {
+		return fmt.Errorf("no pending authorization, run /mcp_auth %s first", a.name)
+	}
+	// 允许直接粘贴回调地址
+	if u, err := url.Parse(code); err == nil && u.Query().Get("code") != "" {
+		if state := u.Query().Get("state"); state != "" && state != a.state {
+			return fmt.Errorf("state mismatch, request a new authorization link")
+		}
+		code = u.Query().Get("code")
+	}
+
+	tok, err := a.conf.Exchange(a.httpContext(ctx), code, oauth2.VerifierOption(a.verifier), a.resourceParam())
+	if err != nil {
+		return err
+	}
+	a.verifier, a.state, a.source = "", "", nil
+	return a.save(tok)
+}
+
+// Logout 删除缓存的 token 和动态注册的客户端
+func (a *mcpOAuth) Logout() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conf, a.source, a.saved = nil, nil, ""
+	return a.store.DeleteMCPToken(a.name)
+}
+
+// save caches tok, keeping the dynamically registered client. Callers hold a.mu.
+func (a *mcpOAuth) save(tok *oauth2.Token) error {
+	cached := a.store.GetMCPToken(a.name)
+	if cached == nil {
+		cached = &storage.MCPToken{}
+	}
+	cached.AccessToken = tok.AccessToken
+	cached.TokenType = tok.TokenType
+	cached.Expiry = tok.Expiry
+	// 刷新响应可能不返回新的 refresh token
+	if tok.RefreshToken != "" {
+		cached.RefreshToken = tok.RefreshToken
+	}
+	a.saved = tok.AccessToken
+	return a.store.SetMCPToken(a.name, *cached)
+}
+
+// config discovers the authorization server and registers a client if needed. Callers hold a.mu.
+func (a *mcpOAuth) config(ctx context.Context) (*oauth2.Config, error) {
+	if a.conf != nil {
+		return a.conf, nil
+	}
+
+	scopes := a.cfg.Scopes
+	issuer := a.cfg.Issuer
+	if issuer == "" {
+		prm := a.resourceMeta(ctx)
+		issuer = originOf(a.serverURL)
+		if prm != nil && len(prm.AuthorizationServers) > 0 {
+			issuer = prm.AuthorizationServers[0]
+		}
+		if len(scopes) == 0 && prm != nil {
+			scopes = prm.ScopesSupported
+		}
+	}
+	meta := a.serverMeta(ctx, issuer)
+
+	clientID, clientSecret := a.cfg.ClientID, a.cfg.ClientSecret
+	if clientID == "" {
+		cached := a.store.GetMCPToken(a.name)
+		if cached != nil && cached.ClientID != "" {
+			clientID, clientSecret = cached.ClientID, cached.ClientSecret
+		} else {
+			var err error
+			clientID, clientSecret, err = a.register(ctx, meta.RegistrationEndpoint, scopes)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	a.conf = &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       meta.AuthorizationEndpoint,
+			TokenURL:      meta.TokenEndpoint,
+			DeviceAuthURL: meta.DeviceAuthorizationEndpoint,
+		},
+		RedirectURL: a.cfg.RedirectURL,
+		Scopes:      scopes,
+	}
+	return a.conf, nil
+}
+
+// resourceMeta 读取 MCP 服务的受保护资源元数据，不存在时返回 nil
+func (a *mcpOAuth) resourceMeta(ctx context.Context) *protectedResourceMeta {
+	u, err := url.Parse(a.serverURL)
+	if err != nil {
+		return nil
+	}
+	origin := originOf(a.serverURL)
+	candidates := []string{origin + "/.well-known/oauth-protected-resource"}
+	if p := strings.TrimSuffix(u.Path, "/"); p != "" {
+		candidates = append([]string{origin + "/.well-known/oauth-protected-resource" + p}, candidates...)
+	}
+	for _, candidate := range candidates {
+		var prm protectedResourceMeta
+		if err := a.getJSON(ctx, candidate, &prm); err == nil {
+			return &prm
+		}
+	}
+	return nil
+}
+
+// serverMeta 读取授权服务器元数据，不存在时使用 MCP 规范中的默认地址
+func (a *mcpOAuth) serverMeta(ctx context.Context, issuer string) *authServerMeta {
+	origin := originOf(issuer)
+	p := ""
+	if u, err := url.Parse(issuer); err == nil {
+		p = strings.TrimSuffix(u.Path, "/")
+	}
+	for _, wellKnown := range []string{"/.well-known/oauth-authorization-server", "/.well-known/openid-configuration"} {
+		var meta authServerMeta
+		if err := a.getJSON(ctx, origin+wellKnown+p, &meta); err == nil && meta.TokenEndpoint != "" {
+			return &meta
+		}
+	}
+	return &authServerMeta{
+		AuthorizationEndpoint: origin + "/authorize",
+		TokenEndpoint:         origin + "/token",
+		RegistrationEndpoint:  origin + "/register",
+	}
+}
+
+// register 动态客户端注册 (RFC 7591)，注册结果缓存在存储中
+func (a *mcpOAuth) register(ctx context.Context, endpoint string, scopes []string) (string, string, error) {
+	grantTypes := []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"}
+	if a.cfg.Flow == "code" {
+		grantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	body, err := json.Marshal(map[string]any{
+		"client_name":                "ggbot",
+		"redirect_uris":              []string{a.cfg.RedirectURL},
+		"grant_types":                grantTypes,
+		"response_types":             []string{"code"},
+		"token_endpoint_auth_method": "none",
+		"scope":                      strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("client registration: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", "", fmt.Errorf("client registration failed (status %d): %s, configure the client in auth.client_id", resp.StatusCode, truncateRunes(string(data), 200))
+	}
+
+	var reg struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.Unmarshal(data, &reg); err != nil || reg.ClientID == "" {
+		return "", "", fmt.Errorf("invalid client registration response")
+	}
+	if err := a.store.SetMCPToken(a.name, storage.MCPToken{ClientID: reg.ClientID, ClientSecret: reg.ClientSecret}); err != nil {
+		return "", "", err
+	}
+	return reg.ClientID, reg.ClientSecret, nil
+}
+
+func (a *mcpOAuth) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// httpContext makes the oauth2 package use the same proxy settings as the server
+func (a *mcpOAuth) httpContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, a.client)
+}
+
+// resourceParam 按 RFC 8707 指明 token 的使用对象
+func (a *mcpOAuth) resourceParam() oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("resource", a.serverURL)
+}
+
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// oauthTransport 为请求附加 OAuth access token
+type oauthTransport struct {
+	auth *mcpOAuth
+	base http.RoundTripper
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.auth.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	tok.SetAuthHeader(req)
+	return t.base.RoundTrip(req)
+}
+
+// handleMCPAuth /mcp_auth [服务名] [code|logout] - 管理员为需要 OAuth 的 MCP 服务授权
+func (p *AIPlugin) handleMCPAuth(ctx *plugins.Context, c core.Context, args core.Args) error {
+	if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "mcp_auth.admin_only"))
+	}
+
+	name, ok := args["服务名"]
+	if !ok {
+		var b strings.Builder
+		for name, mcpCfg := range ctx.Config.MCPServers {
+			if mcpCfg.Auth == nil {
+				continue
+			}
+			status := ctx.T(c, "mcp_auth.unauthorized")
+			if token := ctx.Storage.GetMCPToken(name); token != nil && token.AccessToken != "" {
+				status = ctx.T(c, "mcp_auth.authorized")
+				if !token.Expiry.IsZero() {
+					status += ctx.T(c, "mcp_auth.expiry", token.Expiry.In(ctx.Location(c)).Format("2006-01-02 15:04"))
+				}
+			}
+			b.WriteString(ctx.T(c, "mcp_auth.item", name, mcpCfg.Auth.Flow, status))
+		}
+		if b.Len() == 0 {
+			return c.Reply(ctx.T(c, "mcp_auth.none"))
+		}
+		return c.Reply(ctx.T(c, "mcp_auth.status", b.String()))
+	}
+
+	mcpCfg, ok := ctx.Config.MCPServers[name]
+	if !ok || mcpCfg.Auth == nil {
+		return c.Reply(ctx.T(c, "mcp_auth.not_configured", name))
+	}
+	auth, ok := p.mcpManager.OAuth(name)
+	if !ok {
+		// 服务还未尝试连接（mcp_connect 为 lazy 或后台连接尚未完成），连接时才会创建授权
+		p.mcpManager.EnsureConnected()
+		auth, ok = p.mcpManager.OAuth(name)
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "mcp_auth.unsupported", name))
+	}
+
+	if code, ok := args["code"]; ok {
+		if code == "logout" {
+			if err := auth.Logout(); err != nil {
+				return c.Reply(ctx.T(c, "mcp_auth.logout_failed", err))
+			}
+			// 已建立的会话仍持有旧的 token，断开后工具、资源和提示词一并移除
+			p.mcpManager.Disconnect(name)
+			p.refreshMCP(ctx)
+			ctx.Logger.Info("MCP authorization removed", "server", name)
+			return c.Reply(ctx.T(c, "mcp_auth.logged_out", name))
+		}
+		exchangeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := auth.Exchange(exchangeCtx, code); err != nil {
+			return c.Reply(ctx.T(c, "mcp_auth.failed", name, err))
+		}
+		return p.mcpAuthorized(ctx, c, name)
+	}
+
+	startCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if mcpCfg.Auth.Flow == "code" {
+		authURL, err := auth.AuthCodeURL(startCtx)
+		if err != nil {
+			return c.Reply(ctx.T(c, "mcp_auth.start_failed", err))
+		}
+		return c.Reply(ctx.T(c, "mcp_auth.code_flow", authURL, name))
+	}
+
+	da, err := auth.StartDevice(startCtx)
+	if err != nil {
+		return c.Reply(ctx.T(c, "mcp_auth.start_failed", err))
+	}
+	verifyURL := da.VerificationURI
+	if da.VerificationURIComplete != "" {
+		verifyURL = da.VerificationURIComplete
+	}
+	if err := c.Reply(ctx.T(c, "mcp_auth.device_flow", verifyURL, da.UserCode)); err != nil {
+		return err
+	}
+
+	go func() {
+		deadline := da.Expiry
+		if deadline.IsZero() {
+			deadline = time.Now().Add(15 * time.Minute)
+		}
+		waitCtx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		if err := auth.WaitDevice(waitCtx, da); err != nil {
+			ctx.Logger.Warn("MCP device authorization failed", "server", name, "error", err)
+			_ = c.Reply(ctx.T(c, "mcp_auth.failed", name, err))
+			return
+		}
+		_ = p.mcpAuthorized(ctx, c, name)
+	}()
+	return nil
+}
+
+// mcpAuthorized 授权完成后连接服务并刷新资源工具
+func (p *AIPlugin) mcpAuthorized(ctx *plugins.Context, c core.Context, name string) error {
+	ctx.Logger.Info("MCP server authorized", "server", name)
+
+	connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.mcpManager.Connect(connectCtx, name, ctx.Config.MCPServers[name]); err != nil {
+		ctx.Logger.Error("Failed to connect to MCP server", "name", name, "error", err)
+		return c.Reply(ctx.T(c, "mcp_auth.connect_failed", name, err))
+	}
+	p.refreshMCP(ctx)
+	return c.Reply(ctx.T(c, "mcp_auth.connected", name))
+}
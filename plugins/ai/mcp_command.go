@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// mcpCommand /mcp [add|remove] - 管理员在运行时添加、移除 MCP 服务，添加的服务保存在存储中，重启后自动连接
+func (p *AIPlugin) mcpCommand(ctx *plugins.Context) *core.Command {
+	admin := func(h func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "mcp.admin_only"))
+			}
+			return h(c, args)
+		}
+	}
+	return &core.Command{
+		Name:        "/mcp",
+		Description: "查看、添加或移除 MCP 服务（管理员）",
+		Admin:       true,
+		Handler: admin(func(c core.Context, args core.Args) error {
+			return p.listMCPServers(ctx, c)
+		}),
+		Subcommands: []*core.Command{
+			{
+				Name: "add",
+				Args: []core.Arg{{Name: "名称"}, {Name: "URL|命令", Rest: true}},
+				Handler: admin(func(c core.Context, args core.Args) error {
+					return p.addMCPServer(ctx, c, args["名称"], args["URL|命令"])
+				}),
+			},
+			{
+				Name:    "remove",
+				Aliases: []string{"rm"},
+				Args:    []core.Arg{{Name: "名称"}},
+				Handler: admin(func(c core.Context, args core.Args) error {
+					return p.removeMCPServer(ctx, c, args["名称"])
+				}),
+			},
+		},
+	}
+}
+
+// mcpServers 配置文件中的服务和通过 /mcp add 添加的服务，重名时以配置文件为准
+func mcpServers(ctx *plugins.Context) map[string]config.MCPConfig {
+	servers := ctx.Storage.GetMCPServers()
+	if servers == nil {
+		servers = make(map[string]config.MCPConfig)
+	}
+	for name, mcpCfg := range ctx.Config.MCPServers {
+		servers[name] = mcpCfg
+	}
+	return servers
+}
+
+// parseMCPTarget 根据地址判断服务类型：http(s) 地址为 streamable_http（以 /sse 结尾时为 sse），
+// ws(s) 地址为 websocket，其余作为 stdio 命令及参数
+func parseMCPTarget(target string) config.MCPConfig {
+	fields := strings.Fields(target)
+	first := fields[0]
+	switch {
+	case strings.HasPrefix(first, "http://") || strings.HasPrefix(first, "https://"):
+		if strings.HasSuffix(strings.TrimRight(first, "/"), "/sse") {
+			return config.MCPConfig{Type: "sse", URL: first}
+		}
+		return config.MCPConfig{Type: "streamable_http", URL: first}
+	case strings.HasPrefix(first, "ws://") || strings.HasPrefix(first, "wss://"):
+		return config.MCPConfig{Type: "websocket", URL: first}
+	}
+	return config.MCPConfig{Type: "stdio", Command: first, Args: fields[1:]}
+}
+
+func (p *AIPlugin) listMCPServers(ctx *plugins.Context, c core.Context) error {
+	statuses := p.mcpManager.Status()
+	if len(statuses) == 0 {
+		return c.Reply(ctx.T(c, "mcp.empty"))
+	}
+	runtime := ctx.Storage.GetMCPServers()
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "mcp.list_header") + "\n")
+	for _, status := range statuses {
+		source := ctx.T(c, "mcp.source_config")
+		if _, ok := ctx.Config.MCPServers[status.Name]; !ok {
+			if _, ok := runtime[status.Name]; ok {
+				source = ctx.T(c, "mcp.source_runtime")
+			}
+		}
+		state := ctx.T(c, "mcp.state_pending")
+		switch {
+		case status.Connected:
+			state = ctx.T(c, "mcp.state_connected", len(status.Tools))
+		case status.Err != nil:
+			state = ctx.T(c, "mcp.state_failed", status.Err)
+		}
+		b.WriteString(ctx.T(c, "mcp.list_item", status.Name, source, state) + "\n")
+	}
+	b.WriteString("\n" + ctx.T(c, "mcp.usage"))
+	return c.Reply(b.String())
+}
+
+func (p *AIPlugin) addMCPServer(ctx *plugins.Context, c core.Context, name, target string) error {
+	if _, ok := ctx.Config.MCPServers[name]; ok {
+		return c.Reply(ctx.T(c, "mcp.in_config", name))
+	}
+	mcpCfg := parseMCPTarget(target)
+	if err := p.mcpManager.AddServer(name, mcpCfg); err != nil {
+		ctx.Logger.Warn("Failed to add MCP server", "name", name, "error", err)
+		p.mcpManager.RemoveServer(name)
+		return c.Reply(ctx.T(c, "mcp.add_failed", name, err))
+	}
+	if err := ctx.Storage.SetMCPServer(name, mcpCfg); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	ctx.Logger.Info("MCP server added", "name", name, "type", mcpCfg.Type, "by", core.UserKey(c))
+	var tools []string
+	for _, status := range p.mcpManager.Status() {
+		if status.Name == name {
+			tools = status.Tools
+		}
+	}
+	return c.Reply(ctx.T(c, "mcp.added", name, len(tools), strings.Join(tools, ", ")))
+}
+
+func (p *AIPlugin) removeMCPServer(ctx *plugins.Context, c core.Context, name string) error {
+	if _, ok := ctx.Config.MCPServers[name]; ok {
+		return c.Reply(ctx.T(c, "mcp.in_config", name))
+	}
+	ok, err := ctx.Storage.DeleteMCPServer(name)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "mcp.unknown", name))
+	}
+	p.mcpManager.RemoveServer(name)
+	p.refreshMCP(ctx)
+	ctx.Logger.Info("MCP server removed", "name", name, "by", core.UserKey(c))
+	return c.Reply(ctx.T(c, "mcp.removed", name))
+}
@@ -2,42 +2,71 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"mime"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"path"
+	"regexp"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"log/slog"
 )
 
 // MCPManager manages MCP client sessions with connection pooling and health checks
 type MCPManager struct {
-	sessions   map[string]*mcpSession
-	toolMap    map[string]*mcpSession
-	tools      []ToolDefinition
+	sessions map[string]*mcpSession
+	// 提供给模型的工具名 → 服务和服务端的工具名
+	toolMap map[string]mcpTool
+	tools   []ToolDefinition
+	// resources and prompts exposed by the servers, keyed by URI / name
+	resources   []*mcp.Resource
+	resourceMap map[string]*mcpSession
+	prompts     []*mcp.Prompt
+	promptMap   map[string]*mcpSession
+	// OAuth authorization of the servers configured with auth
+	auths map[string]*mcpOAuth
+	// configs 配置的服务，由 EnsureConnected 连接
+	configs  map[string]config.MCPConfig
+	onChange func()
+	failures map[string]mcpFailure
+	// connectMu 同一时间只有一个 EnsureConnected 在连接服务
+	connectMu  sync.Mutex
+	store      *storage.Storage
 	mu         sync.RWMutex
 	logger     *slog.Logger
 	httpClient *http.Client
 	proxyCfg   config.ProxyConfig
 }
 
+// mcpTool 一个 MCP 工具，name 为服务端的名称，提供给模型时可能带有前缀
+type mcpTool struct {
+	sess *mcpSession
+	name string
+}
+
 type mcpSession struct {
-	session     *mcp.ClientSession
-	name        string
-	config      config.MCPConfig
-	lastUsed    time.Time
-	failCount   int
-	mu          sync.Mutex
-	closed      bool
-	cmd         *exec.Cmd // For stdio-based connections
+	session   *mcp.ClientSession
+	name      string
+	config    config.MCPConfig
+	lastUsed  time.Time
+	failCount int
+	mu        sync.Mutex
+	closed    bool
+	cmd       *exec.Cmd // For stdio-based connections
 }
 
 // NewMCPManager creates a new MCP manager
-func NewMCPManager(proxyCfg config.ProxyConfig, logger *slog.Logger) *MCPManager {
+func NewMCPManager(proxyCfg config.ProxyConfig, store *storage.Storage, logger *slog.Logger) *MCPManager {
 	// 创建默认 HTTP 客户端（不使用代理）
 	// MCP 服务器通过 use_proxy 字段单独控制是否使用代理
 	defaultClient := &http.Client{
@@ -50,30 +79,261 @@ func NewMCPManager(proxyCfg config.ProxyConfig, logger *slog.Logger) *MCPManager
 	}
 
 	return &MCPManager{
-		sessions:   make(map[string]*mcpSession),
-		toolMap:    make(map[string]*mcpSession),
-		tools:      []ToolDefinition{},
-		logger:     logger,
-		httpClient: defaultClient,
-		proxyCfg:   proxyCfg,
+		sessions:    make(map[string]*mcpSession),
+		toolMap:     make(map[string]mcpTool),
+		tools:       []ToolDefinition{},
+		resourceMap: make(map[string]*mcpSession),
+		promptMap:   make(map[string]*mcpSession),
+		auths:       make(map[string]*mcpOAuth),
+		failures:    make(map[string]mcpFailure),
+		store:       store,
+		logger:      logger,
+		httpClient:  defaultClient,
+		proxyCfg:    proxyCfg,
 	}
 }
 
-// ConnectServers connects to all configured MCP servers
-func (m *MCPManager) ConnectServers(ctx context.Context, mcpConfigs map[string]config.MCPConfig) error {
+// mcpRetryInterval 连接失败的服务至少间隔多久再重试
+const mcpRetryInterval = 5 * time.Minute
+
+// mcpFailure 最近一次连接失败
+type mcpFailure struct {
+	err error
+	at  time.Time
+}
+
+// SetServers records the configured servers, connected by EnsureConnected.
+// onChange, if not nil, runs after servers are connected or a server's prompt list changed
+func (m *MCPManager) SetServers(configs map[string]config.MCPConfig, onChange func()) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.configs = configs
+	m.onChange = onChange
+}
+
+// EnsureConnected connects the configured servers that are not connected yet, skipping servers that
+// failed within mcpRetryInterval. Concurrent calls wait for the running one. Returns the newly connected servers
+func (m *MCPManager) EnsureConnected() []string {
+	m.connectMu.Lock()
+	defer m.connectMu.Unlock()
+	return m.connectPending()
+}
 
-	for name, mcpCfg := range mcpConfigs {
-		if err := m.connectServer(ctx, name, mcpCfg); err != nil {
+// connectPending connects the servers due for a connection attempt, the caller holds connectMu
+func (m *MCPManager) connectPending() []string {
+	m.mu.RLock()
+	configs, onChange := m.configs, m.onChange
+	m.mu.RUnlock()
+
+	var connected []string
+	// 按名称顺序连接，重名工具总是由排在前面的服务保留原名
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		m.mu.RLock()
+		_, ok := m.sessions[name]
+		failure, failed := m.failures[name]
+		m.mu.RUnlock()
+		if ok || failed && time.Since(failure.at) < mcpRetryInterval {
+			continue
+		}
+
+		connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := m.Connect(connectCtx, name, configs[name])
+		cancel()
+
+		m.mu.Lock()
+		if err != nil {
+			m.failures[name] = mcpFailure{err: err, at: time.Now()}
+		} else {
+			delete(m.failures, name)
+		}
+		m.mu.Unlock()
+
+		switch {
+		case errors.Is(err, errMCPUnauthorized):
+			m.logger.Warn("MCP server requires authorization", "name", name, "command", "/mcp_auth "+name)
+		case err != nil:
 			m.logger.Error("Failed to connect to MCP server", "name", name, "error", err)
+		default:
+			connected = append(connected, name)
+		}
+	}
+	if len(connected) > 0 && onChange != nil {
+		onChange()
+	}
+	return connected
+}
+
+// ConnectOnUse is called before tools are used: servers never tried are connected before returning,
+// failed servers due for a retry are reconnected in the background so the request does not wait for them
+func (m *MCPManager) ConnectOnUse() {
+	m.mu.RLock()
+	untried, retry := false, false
+	for name := range m.configs {
+		if _, ok := m.sessions[name]; ok {
 			continue
 		}
+		failure, failed := m.failures[name]
+		untried = untried || !failed
+		retry = retry || failed && time.Since(failure.at) >= mcpRetryInterval
+	}
+	m.mu.RUnlock()
+
+	switch {
+	case untried:
+		m.EnsureConnected()
+	case retry:
+		// 已有连接在进行时不再排队
+		go func() {
+			if m.connectMu.TryLock() {
+				defer m.connectMu.Unlock()
+				m.connectPending()
+			}
+		}()
+	}
+}
+
+// AddServer adds a server at runtime (or replaces one with the same name) and connects it
+func (m *MCPManager) AddServer(name string, mcpCfg config.MCPConfig) error {
+	m.connectMu.Lock()
+	defer m.connectMu.Unlock()
+
+	m.removeServer(name)
+	m.mu.Lock()
+	m.configs = maps.Clone(m.configs)
+	if m.configs == nil {
+		m.configs = make(map[string]config.MCPConfig)
 	}
+	m.configs[name] = mcpCfg
+	onChange := m.onChange
+	m.mu.Unlock()
 
+	connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := m.Connect(connectCtx, name, mcpCfg); err != nil {
+		m.mu.Lock()
+		m.failures[name] = mcpFailure{err: err, at: time.Now()}
+		m.mu.Unlock()
+		return err
+	}
+	if onChange != nil {
+		onChange()
+	}
 	return nil
 }
 
+// RemoveServer disconnects a server and forgets its configuration, tools, resources and prompts
+func (m *MCPManager) RemoveServer(name string) {
+	m.connectMu.Lock()
+	defer m.connectMu.Unlock()
+	m.removeServer(name)
+}
+
+func (m *MCPManager) removeServer(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.configs[name]; ok {
+		m.configs = maps.Clone(m.configs)
+		delete(m.configs, name)
+	}
+	delete(m.failures, name)
+	delete(m.auths, name)
+	if m.disconnect(name) {
+		m.logger.Info("Removed MCP server", "name", name)
+	}
+}
+
+// Disconnect closes the session of a server and drops its tools, resources and prompts,
+// keeping the configuration so that it can be connected again, e.g. after /mcp_auth logout
+func (m *MCPManager) Disconnect(name string) {
+	m.connectMu.Lock()
+	defer m.connectMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disconnect(name) {
+		m.logger.Info("Disconnected MCP server", "name", name)
+	}
+}
+
+// disconnect closes the session of name, false if it is not connected. Callers hold m.mu.
+func (m *MCPManager) disconnect(name string) bool {
+	sess, ok := m.sessions[name]
+	if !ok {
+		return false
+	}
+	delete(m.sessions, name)
+	sess.mu.Lock()
+	if !sess.closed {
+		if err := sess.session.Close(); err != nil {
+			m.logger.Warn("Failed to close MCP session", "name", name, "error", err)
+		}
+		sess.closed = true
+	}
+	sess.mu.Unlock()
+
+	m.tools = slices.DeleteFunc(m.tools, func(tool ToolDefinition) bool {
+		return m.toolMap[tool.Function.Name].sess == sess
+	})
+	maps.DeleteFunc(m.toolMap, func(_ string, tool mcpTool) bool { return tool.sess == sess })
+	m.resources = slices.DeleteFunc(m.resources, func(res *mcp.Resource) bool { return m.resourceMap[res.URI] == sess })
+	maps.DeleteFunc(m.resourceMap, func(_ string, s *mcpSession) bool { return s == sess })
+	m.prompts = slices.DeleteFunc(m.prompts, func(prompt *mcp.Prompt) bool { return m.promptMap[prompt.Name] == sess })
+	maps.DeleteFunc(m.promptMap, func(_ string, s *mcpSession) bool { return s == sess })
+	return true
+}
+
+// MCPServerStatus is the connection state of a configured MCP server
+type MCPServerStatus struct {
+	Name      string
+	Connected bool
+	Tools     []string // 提供给模型的工具名
+	Err       error    // 最近一次连接失败的原因，未连接且未尝试过时为 nil
+}
+
+// Status returns the state of every configured server, sorted by name
+func (m *MCPManager) Status() []MCPServerStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var statuses []MCPServerStatus
+	for _, name := range slices.Sorted(maps.Keys(m.configs)) {
+		status := MCPServerStatus{Name: name}
+		if sess, ok := m.sessions[name]; ok {
+			sess.mu.Lock()
+			status.Connected = !sess.closed
+			sess.mu.Unlock()
+		}
+		if failure, ok := m.failures[name]; ok && !status.Connected {
+			status.Err = failure.err
+		}
+		for _, tool := range m.tools {
+			if m.toolMap[tool.Function.Name].sess.name == name {
+				status.Tools = append(status.Tools, tool.Function.Name)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Connect connects a single server if it is not connected yet, e.g. after authorization
+func (m *MCPManager) Connect(ctx context.Context, name string, mcpCfg config.MCPConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[name]; ok {
+		return nil
+	}
+	return m.connectServer(ctx, name, mcpCfg)
+}
+
+// OAuth returns the OAuth authorization of a server configured with auth
+func (m *MCPManager) OAuth(name string) (*mcpOAuth, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	auth, ok := m.auths[name]
+	return auth, ok
+}
+
 // connectServer connects to a single MCP server with retry
 func (m *MCPManager) connectServer(ctx context.Context, name string, mcpCfg config.MCPConfig) error {
 	m.logger.Info("Connecting to MCP server", "name", name, "type", mcpCfg.Type, "url", mcpCfg.URL, "command", mcpCfg.Command)
@@ -90,7 +350,8 @@ func (m *MCPManager) connectServer(ctx context.Context, name string, mcpCfg conf
 
 		m.logger.Info("Starting MCP command", "name", name, "command", mcpCfg.Command, "args", mcpCfg.Args, "env_count", len(mcpCfg.Env), "use_proxy", mcpCfg.UseProxy)
 
-		cmd = exec.CommandContext(ctx, mcpCfg.Command, mcpCfg.Args...)
+		// 进程随会话关闭，不能绑定只用于连接的 ctx，否则连接完成、ctx 取消后进程会被杀死
+		cmd = exec.Command(mcpCfg.Command, mcpCfg.Args...)
 
 		// Start with parent process environment
 		cmd.Env = append([]string{}, cmd.Environ()...)
@@ -172,8 +433,31 @@ func (m *MCPManager) connectServer(ctx context.Context, name string, mcpCfg conf
 			}
 		}
 
+		// OAuth: token is attached (and refreshed) per request
+		if mcpCfg.Auth != nil {
+			if mcpCfg.Type == "websocket" || mcpCfg.Type == "ws" {
+				return fmt.Errorf("auth is not supported for websocket transport")
+			}
+			auth, ok := m.auths[name]
+			if !ok {
+				auth = newMCPOAuth(name, mcpCfg, m.store, baseTransport)
+				m.auths[name] = auth
+			}
+			if !auth.Authorized() {
+				return fmt.Errorf("%w, run /mcp_auth %s", errMCPUnauthorized, name)
+			}
+			httpClient.Transport = &oauthTransport{auth: auth, base: httpClient.Transport}
+		}
+
 		// Create transport based on type
 		switch mcpCfg.Type {
+		case "websocket", "ws":
+			wsTransport, err := newWSTransport(mcpCfg, m.proxyCfg)
+			if err != nil {
+				return err
+			}
+			transport = wsTransport
+			m.logger.Info("MCP server will use websocket transport", "name", name)
 		case "sse":
 			transport = &mcp.SSEClientTransport{
 				Endpoint:   mcpCfg.URL,
@@ -188,7 +472,12 @@ func (m *MCPManager) connectServer(ctx context.Context, name string, mcpCfg conf
 	}
 
 	// Create client
-	client := mcp.NewClient(&mcp.Implementation{Name: "ggbot", Version: "1.0"}, nil)
+	client := mcp.NewClient(&mcp.Implementation{Name: "ggbot", Version: "1.0"}, &mcp.ClientOptions{
+		// 通知可能在连接过程中（持有 m.mu 时）到达，在单独的 goroutine 中重新获取
+		PromptListChangedHandler: func(_ context.Context, req *mcp.PromptListChangedRequest) {
+			go m.refreshPrompts(req.Session)
+		},
+	})
 
 	// Connect with timeout
 	connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
@@ -217,7 +506,15 @@ func (m *MCPManager) connectServer(ctx context.Context, name string, mcpCfg conf
 		return err
 	}
 
-	m.logger.Info("Successfully connected to MCP server", "name", name, "tools", len(m.tools))
+	// Resources and prompts are optional, failures only disable them for this server
+	if err := m.registerResources(ctx, mcpSess); err != nil {
+		m.logger.Warn("Failed to list resources", "name", name, "error", err)
+	}
+	if err := m.registerPrompts(ctx, mcpSess); err != nil {
+		m.logger.Warn("Failed to list prompts", "name", name, "error", err)
+	}
+
+	m.logger.Info("Successfully connected to MCP server", "name", name, "tools", len(m.tools), "resources", len(m.resources), "prompts", len(m.prompts))
 	return nil
 }
 
@@ -242,35 +539,49 @@ func (m *MCPManager) registerTools(ctx context.Context, sess *mcpSession) error
 			continue
 		}
 
+		name := tool.Name
+		if sess.config.Prefix != "" {
+			name = toolPrefix(sess.config.Prefix) + "__" + tool.Name
+		}
+		if other, ok := m.toolMap[name]; ok && other.sess != sess {
+			// 同名工具不覆盖先注册的服务，以服务名作为前缀区分
+			prefixed := toolPrefix(sess.name) + "__" + tool.Name
+			m.logger.Warn("Duplicate MCP tool name, registering with server prefix", "tool", name, "server", sess.name, "other_server", other.sess.name, "name", prefixed)
+			name = prefixed
+		}
+
 		m.tools = append(m.tools, ToolDefinition{
 			Type: "function",
 			Function: Function{
-				Name:        tool.Name,
+				Name:        name,
 				Description: tool.Description,
 				Parameters:  schemaBytes,
 			},
 		})
-		m.toolMap[tool.Name] = sess
+		m.toolMap[name] = mcpTool{sess: sess, name: tool.Name}
 	}
 
 	return nil
 }
 
-// CallTool executes a tool with retry and timeout
-func (m *MCPManager) CallTool(ctx context.Context, toolName string, args map[string]interface{}) (string, error) {
+// CallTool executes a tool with retry and timeout.
+// Binary outputs (images, embedded blobs) are returned as files for delivery to the user.
+func (m *MCPManager) CallTool(ctx context.Context, toolName string, args map[string]interface{}) (string, []*core.File, error) {
+	logger := core.ContextLogger(ctx, m.logger)
 	m.mu.RLock()
-	sess, ok := m.toolMap[toolName]
+	tool, ok := m.toolMap[toolName]
 	m.mu.RUnlock()
 
 	if !ok {
-		return "", fmt.Errorf("tool not found: %s", toolName)
+		return "", nil, fmt.Errorf("tool not found: %s", toolName)
 	}
+	sess := tool.sess
 
 	// Check if session is closed
 	sess.mu.Lock()
 	if sess.closed {
 		sess.mu.Unlock()
-		return "", fmt.Errorf("session closed for tool: %s", toolName)
+		return "", nil, fmt.Errorf("session closed for tool: %s", toolName)
 	}
 	sess.mu.Unlock()
 
@@ -280,32 +591,32 @@ func (m *MCPManager) CallTool(ctx context.Context, toolName string, args map[str
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
-			m.logger.Debug("Retrying tool call", "tool", toolName, "attempt", attempt+1)
+			logger.Debug("Retrying tool call", "tool", toolName, "attempt", attempt+1)
 			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
 		}
 
-		result, err := m.executeToolCall(ctx, sess, toolName, args)
+		result, files, err := m.executeToolCall(ctx, sess, tool.name, args)
 		if err == nil {
 			sess.mu.Lock()
 			sess.lastUsed = time.Now()
 			sess.failCount = 0
 			sess.mu.Unlock()
-			return result, nil
+			return result, files, nil
 		}
 
 		lastErr = err
-		m.logger.Warn("Tool call failed", "tool", toolName, "attempt", attempt+1, "error", err)
+		logger.Warn("Tool call failed", "tool", toolName, "attempt", attempt+1, "error", err)
 
 		sess.mu.Lock()
 		sess.failCount++
 		sess.mu.Unlock()
 	}
 
-	return "", fmt.Errorf("tool call failed after %d attempts: %w", maxRetries, lastErr)
+	return "", nil, fmt.Errorf("tool call failed after %d attempts: %w", maxRetries, lastErr)
 }
 
 // executeToolCall executes a single tool call with timeout
-func (m *MCPManager) executeToolCall(ctx context.Context, sess *mcpSession, toolName string, args map[string]interface{}) (string, error) {
+func (m *MCPManager) executeToolCall(ctx context.Context, sess *mcpSession, toolName string, args map[string]interface{}) (string, []*core.File, error) {
 	callCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
@@ -315,17 +626,72 @@ func (m *MCPManager) executeToolCall(ctx context.Context, sess *mcpSession, tool
 	})
 
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	var contentStr string
+	var files []*core.File
 	for _, content := range res.Content {
-		if textContent, ok := content.(*mcp.TextContent); ok {
-			contentStr += textContent.Text
+		switch c := content.(type) {
+		case *mcp.TextContent:
+			contentStr += c.Text
+		case *mcp.ImageContent:
+			files = append(files, &core.File{
+				Name:     toolName + fileExtension(c.MIMEType),
+				MIMEType: c.MIMEType,
+				Data:     c.Data,
+			})
+			contentStr += "[已生成图片，将作为附件发送给用户]"
+		case *mcp.EmbeddedResource:
+			if c.Resource == nil {
+				continue
+			}
+			if len(c.Resource.Blob) == 0 {
+				contentStr += c.Resource.Text
+				continue
+			}
+			name := path.Base(c.Resource.URI)
+			if name == "" || name == "." || name == "/" {
+				name = toolName + fileExtension(c.Resource.MIMEType)
+			}
+			files = append(files, &core.File{
+				Name:     name,
+				MIMEType: c.Resource.MIMEType,
+				Data:     c.Resource.Blob,
+			})
+			contentStr += fmt.Sprintf("[已生成文件 %s，将作为附件发送给用户]", name)
 		}
 	}
 
-	return contentStr, nil
+	return contentStr, files, nil
+}
+
+// fileExtension returns a file extension for a MIME type, e.g. ".png"
+func fileExtension(mimeType string) string {
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// ToolServer returns the name of the MCP server providing the tool and the tool's name on that server,
+// which differs from toolName when the server's tools are prefixed
+func (m *MCPManager) ToolServer(toolName string) (server, name string, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tool, ok := m.toolMap[toolName]
+	if !ok {
+		return "", "", false
+	}
+	return tool.sess.name, tool.name, true
+}
+
+// invalidToolChars 模型接口只接受字母、数字、_ 和 - 组成的工具名
+var invalidToolChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// toolPrefix 将服务名或配置的前缀转换为合法的工具名前缀
+func toolPrefix(prefix string) string {
+	return invalidToolChars.ReplaceAllString(prefix, "_")
 }
 
 // GetTools returns all registered tools
@@ -368,8 +734,12 @@ func (m *MCPManager) Close() error {
 	}
 
 	m.sessions = make(map[string]*mcpSession)
-	m.toolMap = make(map[string]*mcpSession)
+	m.toolMap = make(map[string]mcpTool)
 	m.tools = nil
+	m.resources = nil
+	m.resourceMap = make(map[string]*mcpSession)
+	m.prompts = nil
+	m.promptMap = make(map[string]*mcpSession)
 
 	if len(errs) > 0 {
 		return fmt.Errorf("errors closing sessions: %v", errs)
@@ -392,3 +762,27 @@ func (m *MCPManager) HealthCheck(ctx context.Context) map[string]bool {
 
 	return health
 }
+
+// Ping sends an MCP ping to every connected server and returns the latency or error of each
+func (m *MCPManager) Ping(ctx context.Context) map[string]PingResult {
+	m.mu.RLock()
+	sessions := make([]*mcpSession, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	m.mu.RUnlock()
+
+	results := make(map[string]PingResult, len(sessions))
+	for _, sess := range sessions {
+		start := time.Now()
+		err := sess.session.Ping(ctx, nil)
+		results[sess.name] = PingResult{Latency: time.Since(start), Err: err}
+	}
+	return results
+}
+
+// PingResult is the outcome of pinging one MCP server
+type PingResult struct {
+	Latency time.Duration
+	Err     error
+}
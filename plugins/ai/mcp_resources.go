@@ -0,0 +1,447 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// readResourceToolName 让模型读取 MCP 资源的原生工具
+const readResourceToolName = "read_resource"
+
+// maxResourceText 资源内容返回给模型或用户的最大字符数
+const maxResourceText = 16000
+
+// registerResources lists the resources of a session if the server supports them
+func (m *MCPManager) registerResources(ctx context.Context, sess *mcpSession) error {
+	if caps := sess.session.InitializeResult().Capabilities; caps == nil || caps.Resources == nil {
+		return nil
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for res, err := range sess.session.Resources(listCtx, nil) {
+		if err != nil {
+			return fmt.Errorf("error listing resources: %w", err)
+		}
+		m.logger.Info("Resource discovered", "server", sess.name, "uri", res.URI)
+		m.resources = append(m.resources, res)
+		m.resourceMap[res.URI] = sess
+	}
+	return nil
+}
+
+// registerPrompts lists the prompts of a session if the server supports them
+func (m *MCPManager) registerPrompts(ctx context.Context, sess *mcpSession) error {
+	if caps := sess.session.InitializeResult().Capabilities; caps == nil || caps.Prompts == nil {
+		return nil
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	for prompt, err := range sess.session.Prompts(listCtx, nil) {
+		if err != nil {
+			return fmt.Errorf("error listing prompts: %w", err)
+		}
+		m.logger.Info("Prompt discovered", "server", sess.name, "prompt", prompt.Name)
+		m.prompts = append(m.prompts, prompt)
+		m.promptMap[prompt.Name] = sess
+	}
+	return nil
+}
+
+// refreshPrompts lists the prompts of the session again after the server notified a change
+func (m *MCPManager) refreshPrompts(cs *mcp.ClientSession) {
+	m.mu.Lock()
+	var sess *mcpSession
+	for _, s := range m.sessions {
+		if s.session == cs {
+			sess = s
+		}
+	}
+	if sess == nil {
+		m.mu.Unlock()
+		return
+	}
+	m.prompts = slices.DeleteFunc(m.prompts, func(prompt *mcp.Prompt) bool { return m.promptMap[prompt.Name] == sess })
+	maps.DeleteFunc(m.promptMap, func(_ string, s *mcpSession) bool { return s == sess })
+	err := m.registerPrompts(context.Background(), sess)
+	onChange := m.onChange
+	m.mu.Unlock()
+
+	if err != nil {
+		m.logger.Warn("Failed to list prompts", "name", sess.name, "error", err)
+	}
+	m.logger.Info("MCP prompts changed", "name", sess.name)
+	if onChange != nil {
+		onChange()
+	}
+}
+
+// GetResources returns all resources exposed by the connected servers
+func (m *MCPManager) GetResources() []*mcp.Resource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resources
+}
+
+// GetPrompts returns all prompts exposed by the connected servers, sorted by name
+func (m *MCPManager) GetPrompts() []*mcp.Prompt {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prompts := append([]*mcp.Prompt(nil), m.prompts...)
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts
+}
+
+// GetPrompt returns a prompt definition by name
+func (m *MCPManager) GetPrompt(name string) (*mcp.Prompt, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, prompt := range m.prompts {
+		if prompt.Name == name {
+			return prompt, true
+		}
+	}
+	return nil, false
+}
+
+// ReadResource reads a resource. Text contents are returned as a string, binary contents as files.
+func (m *MCPManager) ReadResource(ctx context.Context, uri string) (string, []*core.File, error) {
+	m.mu.RLock()
+	sess, ok := m.resourceMap[uri]
+	m.mu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("resource not found: %s", uri)
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := sess.session.ReadResource(readCtx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var text strings.Builder
+	var files []*core.File
+	for _, c := range res.Contents {
+		if len(c.Blob) == 0 {
+			text.WriteString(c.Text)
+			continue
+		}
+		files = append(files, &core.File{
+			Name:     resourceFileName(c),
+			MIMEType: c.MIMEType,
+			Data:     c.Blob,
+		})
+	}
+	return text.String(), files, nil
+}
+
+// RenderPrompt fetches a prompt with arguments and flattens its messages into text
+func (m *MCPManager) RenderPrompt(ctx context.Context, name string, args map[string]string) (string, error) {
+	m.mu.RLock()
+	sess, ok := m.promptMap[name]
+	m.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("prompt not found: %s", name)
+	}
+
+	getCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := sess.session.GetPrompt(getCtx, &mcp.GetPromptParams{Name: name, Arguments: args})
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, msg := range res.Messages {
+		var text string
+		switch c := msg.Content.(type) {
+		case *mcp.TextContent:
+			text = c.Text
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil {
+				text = c.Resource.Text
+			}
+		}
+		if text == "" {
+			continue
+		}
+		// 助手消息作为示例保留，并标明角色
+		if msg.Role == "assistant" {
+			text = "[assistant]\n" + text
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("prompt %s returned no text", name)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// resourceFileName 根据资源 URI 生成附件文件名
+func resourceFileName(c *mcp.ResourceContents) string {
+	name := c.URI
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		name = "resource" + fileExtension(c.MIMEType)
+	}
+	return name
+}
+
+// refreshMCP 连接、移除 MCP 服务或服务的提示词变化后，更新读取资源的工具和提示词指令
+func (p *AIPlugin) refreshMCP(ctx *plugins.Context) {
+	p.refreshResourceTool()
+	p.refreshPromptCommands(ctx)
+}
+
+// refreshResourceTool 连接或移除 MCP 服务后更新读取资源的工具，没有资源时不注册
+func (p *AIPlugin) refreshResourceTool() {
+	p.tools.Unregister(readResourceToolName)
+	if len(p.mcpManager.GetResources()) == 0 {
+		return
+	}
+	if err := p.tools.Register(p.resourceTool()); err != nil {
+		p.toolExecutor.logger.Error("Failed to register resource tool", "error", err)
+	}
+}
+
+// resourceTool 返回读取 MCP 资源的原生工具，资源列表写入描述中供模型选择
+func (p *AIPlugin) resourceTool() NativeTool {
+	var b strings.Builder
+	b.WriteString("Read a resource exposed by the connected MCP servers. Available resources:\n")
+	for _, res := range p.mcpManager.GetResources() {
+		b.WriteString("- " + res.URI)
+		if res.Description != "" {
+			b.WriteString(": " + res.Description)
+		}
+		b.WriteString("\n")
+	}
+	return NativeTool{
+		Name:        readResourceToolName,
+		Description: b.String(),
+		Schema:      json.RawMessage(`{"type":"object","properties":{"uri":{"type":"string","description":"Resource URI"}},"required":["uri"]}`),
+		Handler: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			uri, _ := args["uri"].(string)
+			if uri == "" {
+				return "", fmt.Errorf("uri is required")
+			}
+			text, files, err := p.mcpManager.ReadResource(ctx, uri)
+			if err != nil {
+				return "", err
+			}
+			for _, f := range files {
+				text += fmt.Sprintf("\n[binary content %s, %d bytes]", f.Name, len(f.Data))
+			}
+			return truncateRunes(text, maxResourceText), nil
+		},
+	}
+}
+
+// handleResources /resources 列出 MCP 资源，/resources URI 查看资源内容
+func (p *AIPlugin) handleResources(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+
+	uri := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c.Text()), "/resources"))
+	if uri == "" {
+		resources := p.mcpManager.GetResources()
+		if len(resources) == 0 {
+			return c.Reply(ctx.T(c, "resources.none"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "resources.title"))
+		for _, res := range resources {
+			b.WriteString("• " + res.URI)
+			if res.Name != "" && res.Name != res.URI {
+				b.WriteString(" (" + res.Name + ")")
+			}
+			if res.Description != "" {
+				b.WriteString("\n  " + res.Description)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(ctx.T(c, "resources.footer"))
+		return c.Reply(b.String())
+	}
+
+	text, files, err := p.mcpManager.ReadResource(context.Background(), uri)
+	if err != nil {
+		return c.Reply(ctx.T(c, "resources.read_failed", err))
+	}
+	if text != "" {
+		if err := c.Reply(truncateRunes(text, maxResourceText)); err != nil {
+			return err
+		}
+	}
+	sendFiles(c, ctx.Logger, ctx.Lang(c), files)
+	return nil
+}
+
+// handlePrompt /prompt 列出 MCP 提示词模板，/prompt 名称 参数=值 ... 用模板向 AI 提问
+func (p *AIPlugin) handlePrompt(ctx *plugins.Context, c core.Context) error {
+	cfg := ctx.Config
+	if !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(c.Text()), "/prompt"))
+	name, argText, _ := strings.Cut(rest, " ")
+	if name == "" {
+		prompts := p.mcpManager.GetPrompts()
+		if len(prompts) == 0 {
+			return c.Reply(ctx.T(c, "prompt.none"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "prompt.title"))
+		for _, prompt := range prompts {
+			b.WriteString("• " + prompt.Name)
+			for _, arg := range prompt.Arguments {
+				if arg.Required {
+					b.WriteString(" " + arg.Name + "=…")
+				} else {
+					b.WriteString(" [" + arg.Name + "=…]")
+				}
+			}
+			if prompt.Description != "" {
+				b.WriteString("\n  " + prompt.Description)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(ctx.T(c, "prompt.footer"))
+		return c.Reply(b.String())
+	}
+
+	return p.runPrompt(ctx, c, name, argText)
+}
+
+// runPrompt 用提示词模板 name 和 key=value 形式的参数向 AI 提问
+func (p *AIPlugin) runPrompt(ctx *plugins.Context, c core.Context, name, argText string) error {
+	cfg := ctx.Config
+	prompt, ok := p.mcpManager.GetPrompt(name)
+	if !ok {
+		return c.Reply(ctx.T(c, "prompt.not_found", name))
+	}
+	args := parsePromptArgs(prompt, strings.TrimSpace(argText))
+	for _, arg := range prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return c.Reply(ctx.T(c, "prompt.missing_arg", arg.Name))
+		}
+	}
+
+	storageKey := core.UserKey(c)
+	aiCfg := resolveAIConfig(cfg, ctx.Storage, storageKey)
+	systemPrompt, _ := chatSystemPrompt(cfg, aiCfg, ctx.Storage.GetUserProfile(storageKey), storageKey)
+
+	go func() {
+		text, err := p.mcpManager.RenderPrompt(context.Background(), name, args)
+		if err != nil {
+			ctx.Logger.Error("Failed to get MCP prompt", "prompt", name, "error", err)
+			_ = c.Reply(ctx.T(c, "prompt.failed", err))
+			return
+		}
+		p.handleRequest(c, cfg, ctx.Storage, ctx.Logger, systemPrompt, text, nil, Options{})
+	}()
+	return nil
+}
+
+// refreshPromptCommands 把每个 MCP 提示词模板注册为同名指令（如 /code_review），
+// 与已有指令重名的跳过；服务移除或不再提供的模板删除对应的指令
+func (p *AIPlugin) refreshPromptCommands(ctx *plugins.Context) {
+	p.promptMu.Lock()
+	defer p.promptMu.Unlock()
+
+	commands := make(map[string]bool)
+	for _, prompt := range p.mcpManager.GetPrompts() {
+		name := promptCommandName(prompt.Name)
+		if commands[name] {
+			continue
+		}
+		if _, exists := ctx.Commands.Lookup(name); exists && !p.promptCommands[name] {
+			ctx.Logger.Warn("MCP prompt conflicts with a command, use /prompt instead", "prompt", prompt.Name, "command", name)
+			continue
+		}
+		commands[name] = true
+		ctx.AddCommand(p.promptCommand(ctx, name, prompt))
+	}
+	for name := range p.promptCommands {
+		if !commands[name] {
+			ctx.Commands.Remove(name)
+		}
+	}
+	p.promptCommands = commands
+}
+
+// promptCommand 使用提示词模板的指令
+func (p *AIPlugin) promptCommand(ctx *plugins.Context, name string, prompt *mcp.Prompt) *core.Command {
+	description := prompt.Description
+	if description == "" {
+		description = "MCP 提示词模板 " + prompt.Name
+	}
+	var usage []string
+	for _, arg := range prompt.Arguments {
+		if arg.Required {
+			usage = append(usage, arg.Name+"=…")
+		} else {
+			usage = append(usage, "["+arg.Name+"=…]")
+		}
+	}
+	return &core.Command{
+		Name:        name,
+		Description: description,
+		ArgsUsage:   strings.Join(usage, " "),
+		Args:        rawArgs,
+		Handler: func(c core.Context, args core.Args) error {
+			return p.runPrompt(ctx, c, prompt.Name, args["参数"])
+		},
+	}
+}
+
+// promptCommandName 提示词模板对应的指令名，只保留小写字母、数字和下划线（Telegram 指令名的要求）
+func promptCommandName(name string) string {
+	return "/" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// parsePromptArgs 解析 key=value 形式的参数；模板只有一个参数时，整段文本即为该参数的值
+func parsePromptArgs(prompt *mcp.Prompt, text string) map[string]string {
+	args := make(map[string]string)
+	if text == "" {
+		return args
+	}
+	if len(prompt.Arguments) == 1 && !strings.HasPrefix(text, prompt.Arguments[0].Name+"=") {
+		args[prompt.Arguments[0].Name] = text
+		return args
+	}
+	for _, field := range strings.Fields(text) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			args[k] = v
+		}
+	}
+	return args
+}
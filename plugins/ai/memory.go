@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const (
+	// maxMemoryRunes 每条记忆最多的字数
+	maxMemoryRunes = 200
+	// maxExtractedFacts 每次对话最多自动记住的条数
+	maxExtractedFacts = 3
+)
+
+// memoryFacts 自动提取记忆时模型按它的 Schema 输出
+type memoryFacts struct {
+	Facts []string `json:"facts" desc:"新发现的关于用户本人的长期稳定信息，每条一句话，没有时为空数组"`
+}
+
+const memoryExtractPrompt = "你负责维护用户的长期记忆。从用户的消息中提取关于用户本人的、长期稳定的信息，" +
+	"如称呼、偏好、所在城市或时区、职业、家庭成员、饮食习惯等，每条用一句话以“用户”开头描述，如“用户喜欢简短的回答”。" +
+	"不要提取一次性的请求、提问的内容、临时状态和已知信息，不确定时不要提取。"
+
+// rememberCommand /remember 记住关于自己的一件事，对话时作为背景信息
+func rememberCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{
+		Name:        "/remember",
+		Description: "让 AI 长期记住一件关于你的事",
+		Args:        []core.Arg{{Name: "内容", Rest: true}},
+		Handler: func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			text := strings.TrimSpace(args["内容"])
+			if len([]rune(text)) > maxMemoryRunes {
+				return c.Reply(ctx.T(c, "memory.too_long", maxMemoryRunes))
+			}
+			m, ok, err := ctx.Storage.AddMemory(core.UserKey(c), text, false, ctx.Config.Memory.MaxFacts)
+			if err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			if !ok {
+				return c.Reply(ctx.T(c, "memory.too_many", ctx.Config.Memory.MaxFacts))
+			}
+			return c.Reply(ctx.T(c, "memory.saved", m.ID))
+		},
+	}
+}
+
+// memoriesCommand /memories 查看长期记忆，del 删除一条，clear 全部清空，auto 开关自动记忆
+func memoriesCommand(ctx *plugins.Context) *core.Command {
+	cfg := ctx.Config
+	allowed := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			return handler(c, args)
+		}
+	}
+	cmd := &core.Command{
+		Name:        "/memories",
+		Description: "查看和管理 AI 的长期记忆",
+		Handler: allowed(func(c core.Context, _ core.Args) error {
+			memories := ctx.Storage.GetMemories(core.UserKey(c))
+			if len(memories) == 0 {
+				return c.Reply(ctx.T(c, "memory.empty"))
+			}
+			var b strings.Builder
+			b.WriteString(ctx.T(c, "memory.list", len(memories)))
+			for _, m := range memories {
+				fmt.Fprintf(&b, "\n#%s %s", m.ID, m.Text)
+				if m.Auto {
+					b.WriteString(ctx.T(c, "memory.auto_tag"))
+				}
+			}
+			return c.Reply(b.String())
+		}),
+		Subcommands: []*core.Command{
+			{Name: "del", Args: []core.Arg{{Name: "编号"}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				removed, err := ctx.Storage.DeleteMemory(core.UserKey(c), args["编号"])
+				if err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				if !removed {
+					return c.Reply(ctx.T(c, "memory.not_found", args["编号"]))
+				}
+				return c.Reply(ctx.T(c, "memory.deleted", args["编号"]))
+			})},
+			{Name: "clear", Handler: allowed(func(c core.Context, _ core.Args) error {
+				if err := ctx.Storage.ClearMemories(core.UserKey(c)); err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				return c.Reply(ctx.T(c, "memory.cleared"))
+			})},
+		},
+	}
+	if cfg.Memory.Auto {
+		cmd.Subcommands = append(cmd.Subcommands, &core.Command{
+			Name: "auto",
+			Args: []core.Arg{{Name: "开关", Optional: true, Choices: []string{"on", "off"}}},
+			Handler: allowed(func(c core.Context, args core.Args) error {
+				storageKey := core.UserKey(c)
+				if !args.Has("开关") {
+					status := ctx.T(c, "common.on")
+					if ctx.Storage.GetUserProfile(storageKey).AutoMemoryOff {
+						status = ctx.T(c, "common.off")
+					}
+					return c.Reply(ctx.T(c, "memory.auto_status", status))
+				}
+				off := args["开关"] == "off"
+				if err := ctx.Storage.UpdateUserProfile(storageKey, func(p *storage.UserProfile) {
+					p.AutoMemoryOff = off
+				}); err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				if off {
+					return c.Reply(ctx.T(c, "memory.auto_off"))
+				}
+				return c.Reply(ctx.T(c, "memory.auto_on"))
+			}),
+		})
+	}
+	return cmd
+}
+
+// memoryPrompt 附加到系统提示词的长期记忆，没有时返回空字符串
+func memoryPrompt(s *storage.Storage, storageKey string) string {
+	memories := s.GetMemories(storageKey)
+	if len(memories) == 0 {
+		return ""
+	}
+	return "\n\n以下是关于用户的长期记忆，用于个性化回答，不需要主动提起；与用户当前的说法冲突时以当前的说法为准：\n" + memoryLines(memories)
+}
+
+// memoryLines 每条记忆一行，如 "- 用户叫小王"
+func memoryLines(memories []storage.Memory) string {
+	var b strings.Builder
+	for _, m := range memories {
+		b.WriteString("- " + m.Text + "\n")
+	}
+	return b.String()
+}
+
+// extractMemories 对话后从用户的消息中提取新的长期记忆，失败时只记录日志
+func extractMemories(cfg *config.Config, s *storage.Storage, logger *slog.Logger, storageKey, userMessage string) {
+	aiCfg := cfg.AI
+	if cfg.Memory.Model != "" {
+		aiCfg.Model = cfg.Memory.Model
+	}
+	system := memoryExtractPrompt
+	if known := s.GetMemories(storageKey); len(known) > 0 {
+		system += "\n\n已知信息：\n" + memoryLines(known)
+	}
+
+	start := time.Now()
+	var result memoryFacts
+	completion, err := GenerateStructured(aiCfg, []ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: userMessage},
+	}, "memory", &result)
+	if completion != nil {
+		logResult(logger, s, cfg.Limits, "memory", storageKey, aiCfg.Model, &ExecutionResult{
+			Content:  completion.Message.Content,
+			Usage:    completion.Usage,
+			Duration: time.Since(start),
+		})
+	}
+	if err != nil {
+		logger.Warn("Failed to extract memories", "error", err)
+		return
+	}
+
+	for i, fact := range result.Facts {
+		fact = strings.TrimSpace(fact)
+		if i >= maxExtractedFacts || fact == "" || len([]rune(fact)) > maxMemoryRunes {
+			continue
+		}
+		m, ok, err := s.AddMemory(storageKey, fact, true, cfg.Memory.MaxFacts)
+		if err != nil {
+			logger.Error("Failed to save memory", "error", err)
+			return
+		}
+		if ok {
+			logger.Info("Memory saved", "user", storageKey, "id", m.ID)
+		}
+	}
+}
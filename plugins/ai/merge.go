@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+)
+
+// maxMergedMessages 最多合并的消息条数，达到后立即提问
+const maxMergedMessages = 10
+
+// messageMerger 合并同一用户在同一会话中连续发送的消息：每条新消息重新计时，
+// window 内没有新消息时把合并后的文字作为一次提问交给 flush，回复最后一条消息
+type messageMerger struct {
+	window time.Duration
+	flush  func(c core.Context)
+
+	mu      sync.Mutex
+	pending map[string]*mergedMessages
+}
+
+type mergedMessages struct {
+	last  core.Context
+	texts []string
+	timer *time.Timer
+}
+
+func newMessageMerger(window time.Duration, flush func(c core.Context)) *messageMerger {
+	return &messageMerger{window: window, flush: flush, pending: make(map[string]*mergedMessages)}
+}
+
+// add 加入一条消息，窗口结束或达到 maxMergedMessages 条时提问
+func (m *messageMerger) add(c core.Context) {
+	key := policy.ChatKey(c) + "|" + core.UserKey(c)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msgs, ok := m.pending[key]
+	if !ok {
+		msgs = &mergedMessages{}
+		m.pending[key] = msgs
+	}
+	msgs.last = c
+	msgs.texts = append(msgs.texts, c.Text())
+	if msgs.timer != nil {
+		msgs.timer.Stop()
+	}
+	if len(msgs.texts) >= maxMergedMessages {
+		delete(m.pending, key)
+		go m.flush(merged(msgs))
+		return
+	}
+	msgs.timer = time.AfterFunc(m.window, func() {
+		m.mu.Lock()
+		if m.pending[key] != msgs {
+			m.mu.Unlock()
+			return
+		}
+		delete(m.pending, key)
+		m.mu.Unlock()
+		m.flush(merged(msgs))
+	})
+}
+
+// merged 最后一条消息的上下文，文字为按顺序换行拼接的全部消息
+func merged(msgs *mergedMessages) core.Context {
+	if len(msgs.texts) == 1 {
+		return msgs.last
+	}
+	return core.WithText(msgs.last, strings.Join(msgs.texts, "\n"))
+}
@@ -0,0 +1,244 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// maxNewsTopics /news set 最多保存的主题数
+const maxNewsTopics = 10
+
+// newsDigest digest 格式的新闻摘要，模型按它的 Schema 输出，由插件排版
+type newsDigest struct {
+	Items []newsItem `json:"items"`
+}
+
+type newsItem struct {
+	Title   string `json:"title" desc:"新闻标题"`
+	URL     string `json:"url" desc:"新闻原文链接，没有时为空字符串"`
+	Source  string `json:"source" desc:"来源媒体或网站，没有时为空字符串"`
+	Summary string `json:"summary" desc:"一句话摘要"`
+}
+
+// newsCommand /news [主题] 获取今日新闻摘要，/news set 设置自己关注的主题
+func (p *AIPlugin) newsCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{
+		Name:        "/news",
+		Description: "获取今日新闻摘要",
+		Args:        []core.Arg{{Name: "主题", Optional: true, Rest: true}},
+		Handler: func(c core.Context, args core.Args) error {
+			return p.handleNews(ctx, c, args["主题"])
+		},
+		Subcommands: []*core.Command{{
+			Name: "set",
+			Args: []core.Arg{{Name: "主题", Optional: true, Rest: true}},
+			Handler: func(c core.Context, args core.Args) error {
+				return setNewsTopics(ctx, c, args["主题"])
+			},
+		}},
+	}
+}
+
+func (p *AIPlugin) handleNews(ctx *plugins.Context, c core.Context, topic string) error {
+	cfg, s := ctx.Config, ctx.Storage
+	if !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+	group, ok := groupSettings(s, c)
+	if !ok {
+		return nil
+	}
+	if msg, exceeded := quotaExceeded(cfg, s, c); exceeded {
+		return replyQuotaExceeded(cfg, c, msg)
+	}
+
+	// Handle request asynchronously
+	go func() {
+		logger := core.Logger(c, ctx.Logger)
+		storageKey := core.UserKey(c)
+		aiCfg := resolveRequestConfig(cfg, s, storageKey, Options{Model: group.Model})
+
+		reply, err := acknowledge(c, cfg.Bot.AckReaction, ctx.T(c, "ai.news_pending"))
+		if err != nil {
+			logger.Error("Failed to send message", "error", err)
+			return
+		}
+
+		lang := cfg.News.Language
+		if lang == "" {
+			lang = ctx.Lang(c)
+		}
+		topics := newsTopics(cfg, s.GetUserProfile(storageKey), topic)
+		banned := s.GetBannedTopics(policy.ChatKey(c))
+		messages, err := newsMessages(cfg.News, lang, topics, policy.Prompt(banned))
+		if err != nil {
+			_ = reply.Done(ctx.T(c, "ai.news_failed", err))
+			return
+		}
+
+		executeCtx, cancel := context.WithTimeout(core.TraceContext(c), 120*time.Second)
+		defer cancel()
+
+		platformPrompt := cfg.GetPlatformPrompt(c.Platform())
+
+		result, err := p.toolExecutor.Execute(executeCtx, aiCfg, messages, platformPrompt, Options{Confirm: p.confirmFunc(c, ctx.Lang(c)), ResponseCache: true})
+		if err != nil {
+			logger.Error("News generation error", "error", err)
+			recordAudit(logger, s, storageKey, storage.AuditEntry{Time: time.Now(), RequestID: core.RequestID(c), Kind: "news", Model: aiCfg.Model, Error: err.Error()})
+			_ = reply.Done(ctx.T(c, "ai.news_failed", err))
+			return
+		}
+		result.RequestID = core.RequestID(c)
+		logResult(logger, s, cfg.Limits, "news", storageKey, aiCfg.Model, result)
+
+		content := result.Content
+		if cfg.News.Format == "digest" {
+			var digest newsDigest
+			// 模型没有按格式输出时直接显示原文
+			if err := decodeJSON(content, &digest); err == nil && len(digest.Items) > 0 {
+				title := i18n.T(lang, "news.title")
+				if len(topics) > 0 {
+					title = i18n.T(lang, "news.title_topics", strings.Join(topics, "、"))
+				}
+				content = formatDigest(title, digest, cfg.News.MaxItems)
+			} else {
+				logger.Warn("News digest is not valid JSON, sending it as text", "error", err)
+			}
+		}
+		finalContent := watermark(cfg, enforcePolicy(c, s, logger, ctx.Lang(c), banned, messages[len(messages)-1].Content, content))
+
+		text, rendered := p.renderReply(c, cfg, finalContent)
+		if err := reply.Done(text); err != nil {
+			logger.Error("Failed to send reply", "error", err)
+		}
+
+		sendRendered(c, logger, rendered)
+		sendFiles(c, logger, ctx.Lang(c), result.Files)
+	}()
+
+	return nil
+}
+
+// newsTopics 本次关注的主题：指令参数优先，其次是用户用 /news set 设置的主题，最后是 news.keywords
+func newsTopics(cfg *config.Config, profile storage.UserProfile, topic string) []string {
+	if topics := splitTopics(topic); len(topics) > 0 {
+		return topics
+	}
+	if len(profile.NewsTopics) > 0 {
+		return profile.NewsTopics
+	}
+	return cfg.News.Keywords
+}
+
+// splitTopics 按空格和逗号分隔主题，去掉重复的主题
+func splitTopics(text string) []string {
+	var topics []string
+	for _, topic := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '，' || r == '、' || r == ' ' || r == '\t' || r == '\n'
+	}) {
+		if !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// newsMessages 按配置的来源、主题、语言和格式构造提示词，digest 格式要求模型按 newsDigest 的 Schema 输出
+func newsMessages(news config.NewsConfig, lang string, topics []string, policyPrompt string) ([]ChatMessage, error) {
+	system := fmt.Sprintf("You are a professional news editor. Always use the search tools to find today's latest news before answering, "+
+		"never make up news or links. Reply in %s.", i18n.Name(lang)) + policyPrompt
+
+	var b strings.Builder
+	b.WriteString("Find today's latest news")
+	if len(topics) > 0 {
+		fmt.Fprintf(&b, " about: %s", strings.Join(topics, ", "))
+	}
+	b.WriteString(".")
+	if len(news.Sources) > 0 {
+		fmt.Fprintf(&b, " Prefer these sources: %s.", strings.Join(news.Sources, ", "))
+	}
+
+	if news.Format == "summary" {
+		b.WriteString(" Summarize the key points concisely and list the specific events.")
+		return []ChatMessage{{Role: "system", Content: system}, {Role: "user", Content: b.String()}}, nil
+	}
+
+	fmt.Fprintf(&b, " List at most %d distinct stories, each with its title, the link to the original article as returned by the search tools, the source and a one-sentence summary.", news.MaxItems)
+	schema, err := SchemaOf(newsDigest{})
+	if err != nil {
+		return nil, err
+	}
+	return withSchemaPrompt([]ChatMessage{{Role: "system", Content: system}, {Role: "user", Content: b.String()}}, schema), nil
+}
+
+// formatDigest 把新闻逐条排版为 Markdown：标题带原文链接（由各平台转换或过滤），下一行为来源和摘要
+func formatDigest(title string, digest newsDigest, maxItems int) string {
+	var b strings.Builder
+	b.WriteString(title)
+	n := 0
+	for _, item := range digest.Items {
+		if item.Title == "" {
+			continue
+		}
+		if n++; n > maxItems {
+			break
+		}
+		headline := item.Title
+		if strings.HasPrefix(item.URL, "http://") || strings.HasPrefix(item.URL, "https://") {
+			headline = "[" + item.Title + "](" + item.URL + ")"
+		}
+		fmt.Fprintf(&b, "\n\n%d. %s", n, headline)
+		var detail []string
+		if item.Source != "" {
+			detail = append(detail, item.Source)
+		}
+		if item.Summary != "" {
+			detail = append(detail, item.Summary)
+		}
+		if len(detail) > 0 {
+			b.WriteString("\n" + strings.Join(detail, " · "))
+		}
+	}
+	return b.String()
+}
+
+// setNewsTopics /news set 主题... 设置关注的主题，default 恢复为 news.keywords，不带参数时显示当前的主题
+func setNewsTopics(ctx *plugins.Context, c core.Context, text string) error {
+	storageKey := core.UserKey(c)
+	describe := func(topics []string) string {
+		if len(topics) == 0 {
+			return ctx.T(c, "common.unset")
+		}
+		return strings.Join(topics, "、")
+	}
+	if text == "" {
+		return c.Reply(ctx.T(c, "news.topics", describe(newsTopics(ctx.Config, ctx.Storage.GetUserProfile(storageKey), ""))))
+	}
+
+	var topics []string
+	if text != "default" {
+		topics = splitTopics(text)
+		if len(topics) > maxNewsTopics {
+			return c.Reply(ctx.T(c, "news.too_many_topics", maxNewsTopics))
+		}
+	}
+	if err := ctx.Storage.UpdateUserProfile(storageKey, func(p *storage.UserProfile) {
+		p.NewsTopics = topics
+	}); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if topics == nil {
+		return c.Reply(ctx.T(c, "news.topics_reset", describe(ctx.Config.News.Keywords)))
+	}
+	return c.Reply(ctx.T(c, "news.topics_set", describe(topics)))
+}
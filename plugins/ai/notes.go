@@ -0,0 +1,198 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/knowledge"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const (
+	// maxNoteRunes 每条笔记最多的字数
+	maxNoteRunes = 500
+	// maxNoteLine /note list 中每条笔记最多显示的字数，完整内容用 /note search 查看
+	maxNoteLine = 100
+	// maxRecentNotes 没有开启知识库时，对话中参考的最近笔记数
+	maxRecentNotes = 10
+)
+
+// noteMatch 一条笔记检索结果，Score 为 0 表示关键词匹配
+type noteMatch struct {
+	storage.Note
+	Score float64
+}
+
+// noteCommand /note 个人笔记：add 记录，list 查看，search 检索，del 删除。
+// 开启知识库时笔记会向量化，检索和对话时按语义匹配
+func (p *AIPlugin) noteCommand(ctx *plugins.Context) *core.Command {
+	allowed := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			return handler(c, args)
+		}
+	}
+	list := allowed(func(c core.Context, _ core.Args) error {
+		return listNotes(ctx, c)
+	})
+
+	return &core.Command{
+		Name:        "/note",
+		Description: "个人笔记",
+		Handler:     list,
+		Subcommands: []*core.Command{
+			{Name: "add", Args: []core.Arg{{Name: "内容", Rest: true}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				return p.addNote(ctx, c, args["内容"])
+			})},
+			{Name: "list", Handler: list},
+			{Name: "search", Args: []core.Arg{{Name: "关键词", Rest: true}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				return p.searchNotes(ctx, c, args["关键词"])
+			})},
+			{Name: "del", Args: []core.Arg{{Name: "编号"}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				removed, err := ctx.Storage.DeleteNote(core.UserKey(c), args["编号"])
+				if err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				if !removed {
+					return c.Reply(ctx.T(c, "note.not_found", args["编号"]))
+				}
+				return c.Reply(ctx.T(c, "note.deleted", args["编号"]))
+			})},
+		},
+	}
+}
+
+// addNote 保存笔记，开启知识库时同时保存向量，向量化失败时只保存文本
+func (p *AIPlugin) addNote(ctx *plugins.Context, c core.Context, text string) error {
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxNoteRunes {
+		return c.Reply(ctx.T(c, "note.too_long", maxNoteRunes))
+	}
+	owner := core.UserKey(c)
+	var vector []float32
+	if p.kb != nil {
+		embedCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		var err error
+		if vector, err = p.kb.Embed(embedCtx, text); err != nil {
+			core.Logger(c, ctx.Logger).Warn("Note embedding failed", "owner", owner, "error", err)
+		}
+	}
+	note, ok, err := ctx.Storage.AddNote(owner, text, vector)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "note.too_many", storage.MaxNotes))
+	}
+	return c.Reply(ctx.T(c, "note.added", note.ID))
+}
+
+func listNotes(ctx *plugins.Context, c core.Context) error {
+	notes := ctx.Storage.GetNotes(core.UserKey(c))
+	if len(notes) == 0 {
+		return c.Reply(ctx.T(c, "note.empty"))
+	}
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "note.list", len(notes)))
+	loc := ctx.Location(c)
+	for _, note := range notes {
+		note.Text = truncateRunes(note.Text, maxNoteLine)
+		b.WriteString("\n" + formatNote(note, loc))
+	}
+	return c.Reply(b.String())
+}
+
+func (p *AIPlugin) searchNotes(ctx *plugins.Context, c core.Context, query string) error {
+	searchCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	matches := p.matchNotes(searchCtx, ctx.Config, ctx.Storage, core.Logger(c, ctx.Logger), core.UserKey(c), query)
+	if len(matches) == 0 {
+		return c.Reply(ctx.T(c, "note.no_match"))
+	}
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "note.results", len(matches)))
+	loc := ctx.Location(c)
+	for _, m := range matches {
+		b.WriteString("\n" + formatNote(m.Note, loc))
+		if m.Score > 0 {
+			fmt.Fprintf(&b, "（%.2f）", m.Score)
+		}
+	}
+	return c.Reply(b.String())
+}
+
+// matchNotes 检索用户的笔记：先是包含关键词的笔记，开启知识库时再加上语义相似的笔记（最多 top_k 条，
+// 相似度不低于 min_score）。向量化失败时只记录日志，返回关键词匹配的结果
+func (p *AIPlugin) matchNotes(ctx context.Context, cfg *config.Config, s *storage.Storage, logger *slog.Logger, owner, query string) []noteMatch {
+	notes := s.GetNotes(owner)
+	if len(notes) == 0 {
+		return nil
+	}
+	var matches []noteMatch
+	lower := strings.ToLower(query)
+	for _, note := range notes {
+		if strings.Contains(strings.ToLower(note.Text), lower) {
+			matches = append(matches, noteMatch{Note: note})
+		}
+	}
+	if p.kb == nil {
+		return matches
+	}
+
+	vector, err := p.kb.Embed(ctx, query)
+	if err != nil {
+		logger.Warn("Note search failed", "owner", owner, "error", err)
+		return matches
+	}
+	var similar []noteMatch
+	for _, note := range notes {
+		found := slices.ContainsFunc(matches, func(m noteMatch) bool { return m.ID == note.ID })
+		if score := knowledge.Cosine(vector, note.Vector); !found && score >= cfg.Knowledge.MinScore {
+			similar = append(similar, noteMatch{Note: note, Score: score})
+		}
+	}
+	slices.SortStableFunc(similar, func(a, b noteMatch) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return append(matches, similar[:min(len(similar), cfg.Knowledge.TopK)]...)
+}
+
+// notesPrompt 对话时参考的笔记：开启知识库时为与问题相关的笔记，否则为最近的几条笔记，没有时返回空字符串
+func (p *AIPlugin) notesPrompt(ctx context.Context, cfg *config.Config, s *storage.Storage, c core.Context, logger *slog.Logger, question string) string {
+	owner := core.UserKey(c)
+	var notes []storage.Note
+	if p.kb != nil {
+		for _, m := range p.matchNotes(ctx, cfg, s, logger, owner, question) {
+			notes = append(notes, m.Note)
+		}
+	} else {
+		notes = s.GetNotes(owner)
+		notes = notes[max(0, len(notes)-maxRecentNotes):]
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	loc := core.UserLocation(s, owner)
+	var b strings.Builder
+	b.WriteString("\n\n以下是用户让你记住的笔记，与问题相关时请参考；如果无关请忽略：\n")
+	for _, note := range notes {
+		fmt.Fprintf(&b, "- %s（%s）\n", note.Text, note.Created.In(loc).Format("2006-01-02"))
+	}
+	return b.String()
+}
+
+// formatNote 如 "#3 05-01 14:00 周五下午开会"
+func formatNote(note storage.Note, loc *time.Location) string {
+	return fmt.Sprintf("#%s %s %s", note.ID, note.Created.In(loc).Format("01-02 15:04"), note.Text)
+}
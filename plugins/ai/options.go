@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"context"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// Options 插件调用共享 AI 流程时的单次覆盖参数，零值字段沿用用户/全局配置。
+// 例如翻译需要 temperature 0，人设闲聊可以用 0.8。
+type Options struct {
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+	// Persona 本次对话生效的人设，人设配置的生成参数覆盖用户/全局配置
+	Persona string
+	// Tools 只提供名称匹配的工具（支持 * 通配符），nil 表示不限制，空切片表示不使用工具
+	Tools []string
+	// Confirm 在执行需要确认的工具前询问用户，为 nil 时这些工具会被拒绝执行
+	Confirm ConfirmFunc
+	// Cache 启用语义缓存时，相似问题复用近期的回答（普通对话使用）
+	Cache bool
+	// ResponseCache 完全相同的请求在 response_cache.ttl 内复用模型的结果（推送、/news 等对多个目标生成相同内容）
+	ResponseCache bool
+
+	// regenerate 用户点击了“重新生成”，不查找缓存但保存新的回答
+	regenerate bool
+	// experiment 普通文字对话，可以被 A/B 实验抽样
+	experiment bool
+}
+
+// ConfirmFunc asks the user whether the tool may run with the given JSON arguments
+type ConfirmFunc func(ctx context.Context, tool, arguments string) bool
+
+// Temperature returns a pointer for Options.Temperature
+func Temperature(t float64) *float64 {
+	return &t
+}
+
+// apply returns aiCfg with the overrides of o
+func (o Options) apply(aiCfg config.AIConfig) config.AIConfig {
+	if o.Model != "" {
+		aiCfg.Model = o.Model
+	}
+	if o.Temperature != nil {
+		aiCfg.Temperature = o.Temperature
+	}
+	if o.MaxTokens > 0 {
+		aiCfg.MaxTokens = o.MaxTokens
+	}
+	return aiCfg
+}
+
+// allowTool reports whether the tool is in the requested subset
+func (o Options) allowTool(name string) bool {
+	return o.Tools == nil || config.MatchTool(o.Tools, name)
+}
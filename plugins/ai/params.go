@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// paramKeys /set_ai 中可以设置的生成参数
+var paramKeys = []string{"temperature", "top_p", "max_tokens", "presence_penalty", "frequency_penalty", "stop"}
+
+// setParam 按 /set_ai 的 key=value 设置生成参数，value 为 default 时恢复为服务端默认值。
+// stop 用逗号分隔多个停止序列，\n 表示换行
+func setParam(p *config.GenerationParams, key, value string) error {
+	reset := value == "default"
+	switch key {
+	case "stop":
+		p.Stop = nil
+		if !reset {
+			p.Stop = strings.Split(strings.ReplaceAll(value, `\n`, "\n"), ",")
+		}
+		return nil
+	case "max_tokens":
+		p.MaxTokens = 0
+		if reset {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		p.MaxTokens = n
+		return nil
+	}
+
+	target := map[string]**float64{
+		"temperature":       &p.Temperature,
+		"top_p":             &p.TopP,
+		"presence_penalty":  &p.PresencePenalty,
+		"frequency_penalty": &p.FrequencyPenalty,
+	}[key]
+	if target == nil {
+		return fmt.Errorf("unknown parameter %s", key)
+	}
+	*target = nil
+	if reset {
+		return nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+	*target = &v
+	return nil
+}
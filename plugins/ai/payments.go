@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// buyCallback 选择购买额度按钮的回调名，数据为 payments.packages 中的序号
+const buyCallback = "buy"
+
+// paymentPayloadPrefix 付款请求的 payload 格式 "tokens:<序号>:<token 数>"，付款成功后按其中的 token 数增加余额
+const paymentPayloadPrefix = "tokens:"
+
+// usageCommand /usage 查看今天的用量、每日限制和购买的余额
+func usageCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{Name: "/usage", Description: "查看今日用量和额度", Handler: func(c core.Context, _ core.Args) error {
+		cfg := ctx.Config
+		userKey := core.UserKey(c)
+		usage := ctx.Storage.GetDailyUsage(userKey, storage.Day(time.Now()))
+		limit := func(used, max int) string {
+			if max <= 0 || cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+				return ctx.T(c, "usage.unlimited", used)
+			}
+			return ctx.T(c, "usage.limited", used, max)
+		}
+
+		text := ctx.T(c, "usage.show", limit(usage.Requests, cfg.Limits.DailyRequests), limit(usage.Tokens, cfg.Limits.DailyTokens))
+		if credits := ctx.Storage.GetCredits(userKey); credits.Tokens > 0 || cfg.Payments.Enabled {
+			text += ctx.T(c, "usage.credits", credits.Tokens)
+		}
+		if cfg.Payments.Enabled {
+			text += ctx.T(c, "usage.buy_hint")
+		}
+		return c.Reply(text)
+	}}
+}
+
+// buyCommand /buy [档位] 购买 token 额度，不带参数时以按钮列出 payments.packages
+func buyCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{Name: "/buy", Description: "购买 AI 额度", Args: []core.Arg{{Name: "档位", Optional: true}}, Handler: func(c core.Context, args core.Args) error {
+		if args.Has("档位") {
+			return sendInvoice(ctx, c, args["档位"])
+		}
+		var rows [][]core.Button
+		for i, pkg := range ctx.Config.Payments.Packages {
+			rows = append(rows, []core.Button{{
+				Text: ctx.T(c, "buy.package", pkg.Tokens, formatPrice(ctx.Config.Payments.Currency, pkg.Price)),
+				Name: buyCallback,
+				Data: strconv.Itoa(i + 1),
+			}})
+		}
+		_, err := c.SendButtons(ctx.T(c, "buy.choose"), rows)
+		return err
+	}}
+}
+
+// sendInvoice 为第 index 档（从 1 开始）额度发送付款请求
+func sendInvoice(ctx *plugins.Context, c core.Context, index string) error {
+	cfg := ctx.Config.Payments
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 1 || i > len(cfg.Packages) {
+		return c.Reply(ctx.T(c, "buy.invalid"))
+	}
+	pkg := cfg.Packages[i-1]
+	err = core.SendInvoice(c, core.Invoice{
+		Title:         ctx.T(c, "buy.title", pkg.Tokens),
+		Description:   ctx.T(c, "buy.description", pkg.Tokens),
+		Payload:       fmt.Sprintf("%s%d:%d", paymentPayloadPrefix, i, pkg.Tokens),
+		Currency:      cfg.Currency,
+		Amount:        pkg.Price,
+		ProviderToken: cfg.ProviderToken,
+	})
+	if err == core.ErrNotSupported {
+		return c.Reply(ctx.T(c, "buy.not_supported"))
+	}
+	if err != nil {
+		return c.Reply(ctx.T(c, "buy.failed", err))
+	}
+	return nil
+}
+
+// handlePayment 付款成功后按 payload 中的 token 数增加余额，同一笔付款只计一次
+func handlePayment(ctx *plugins.Context) core.PaymentHandler {
+	return func(c core.Context, p core.Payment) error {
+		userKey := core.UserKey(c)
+		rest, ok := strings.CutPrefix(p.Payload, paymentPayloadPrefix)
+		_, count, _ := strings.Cut(rest, ":")
+		tokens, err := strconv.Atoi(count)
+		if !ok || err != nil || tokens <= 0 {
+			ctx.Logger.Error("Unknown payment payload", "user", userKey, "payload", p.Payload, "charge_id", p.ChargeID)
+			ctx.Alerts.Error("payment:"+p.ChargeID, fmt.Sprintf("无法识别的付款 %s（用户 %s，payload %q），需要手动处理", p.ChargeID, userKey, p.Payload))
+			return nil
+		}
+
+		added, err := ctx.Storage.AddPayment(userKey, storage.Payment{
+			Time:     time.Now(),
+			ChargeID: p.ChargeID,
+			Currency: p.Currency,
+			Amount:   p.Amount,
+			Tokens:   tokens,
+		})
+		if err != nil {
+			ctx.Logger.Error("Failed to save payment", "user", userKey, "charge_id", p.ChargeID, "error", err)
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		if !added {
+			return nil
+		}
+		ctx.Logger.Info("Payment received", "user", userKey, "tokens", tokens, "amount", p.Amount, "currency", p.Currency, "charge_id", p.ChargeID)
+		return c.Reply(ctx.T(c, "buy.paid", tokens, ctx.Storage.GetCredits(userKey).Tokens))
+	}
+}
+
+// formatPrice 显示价格：Stars 为数量，其他货币按两位小数显示
+func formatPrice(currency string, amount int) string {
+	if currency == "XTR" {
+		return fmt.Sprintf("%d ⭐", amount)
+	}
+	return fmt.Sprintf("%.2f %s", float64(amount)/100, currency)
+}
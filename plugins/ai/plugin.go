@@ -2,15 +2,25 @@ package ai
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lhpqaq/ggbot/config"
 	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/knowledge"
+	"github.com/lhpqaq/ggbot/mcpserver"
 	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/msgtmpl"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/render"
+	"github.com/lhpqaq/ggbot/scheduler"
 	"github.com/lhpqaq/ggbot/storage"
 )
 
@@ -22,22 +32,60 @@ type headerTransport struct {
 
 func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	for k, v := range t.headers {
-		// Expand environment variables in header values (e.g., ${DASHSCOPE_API_KEY})
-		expandedValue := os.ExpandEnv(v)
-		req.Header.Set(k, expandedValue)
+		req.Header.Set(k, v)
 	}
 	return t.base.RoundTrip(req)
 }
 
+// rawArgs 接收指令后的全部文字，用于自行解析 c.Text() 的指令，格式由 ArgsUsage 说明
+var rawArgs = []core.Arg{{Name: "参数", Optional: true, Rest: true}}
+
 type AIPlugin struct {
+	// Router 消息路由表，匹配的规则可以为会话指定人设或系统提示词
+	Router *policy.Router
+
 	mcpManager   *MCPManager
+	tools        *ToolRegistry
 	toolExecutor *ToolExecutor
+	history      *conversationHistory
+	renderer     *render.Renderer
+	kb           *knowledge.Base
+	cache        *knowledge.Cache
+	mcpServer    *mcpserver.Server
+	confirms     *confirmations
+	answers      *answers
+	intents      *intentRouter
+	merger       *messageMerger
+
+	// promptMu 保护 promptCommands：MCP 提示词注册的指令名
+	promptMu       sync.Mutex
+	promptCommands map[string]bool
 }
 
 func (p *AIPlugin) Name() string {
 	return "AI"
 }
 
+// Ask 供其他插件调用的共享对话流程（确认收到、知识库检索、工具调用、渲染回复），
+// opts 可以为本次调用覆盖模型、temperature、max_tokens 和可用工具。应在独立的 goroutine 中调用。
+func (p *AIPlugin) Ask(c core.Context, ctx *plugins.Context, systemPrompt, message string, opts Options) {
+	p.handleRequest(c, ctx.Config, ctx.Storage, ctx.Logger, systemPrompt, message, nil, opts)
+}
+
+// Generate 供其他插件在后台任务中使用的单次生成（全局模型配置，不使用工具），kind 记录在日志中
+func (p *AIPlugin) Generate(ctx *plugins.Context, kind, systemPrompt, prompt string) (string, error) {
+	aiCfg := ctx.Config.AI
+	result, err := p.toolExecutor.ExecuteWithoutTools(aiCfg, []ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		return "", err
+	}
+	logResult(ctx.Logger, ctx.Storage, ctx.Config.Limits, kind, "", aiCfg.Model, result)
+	return result.Content, nil
+}
+
 // handleRequest 在独立的 goroutine 中处理请求
 func (p *AIPlugin) handleRequest(
 	ctx core.Context,
@@ -46,47 +94,353 @@ func (p *AIPlugin) handleRequest(
 	logger *slog.Logger,
 	systemPrompt string,
 	userMessage string,
+	images []string,
+	opts Options,
 ) {
 	user := ctx.Sender()
-	storageKey := ctx.Platform() + ":" + user.ID
+	storageKey := core.UserKey(ctx)
+	lang := core.UserLang(cfg, s, ctx)
+	// 与收到消息时分配的请求 ID 相同，日志、审计记录和评价都按它关联
+	requestID := core.RequestID(ctx)
+	if requestID == "" {
+		requestID = core.NewRequestID()
+	}
+	logger = logger.With("request_id", requestID)
 
 	// Get AI config
-	aiCfg := cfg.AI
-	if userOverride := s.GetUserAIConfig(storageKey); userOverride != nil {
-		aiCfg = *userOverride
+	aiCfg := resolveRequestConfig(cfg, s, storageKey, opts)
+	if opts.Confirm == nil {
+		opts.Confirm = p.confirmFunc(ctx, lang)
+	}
+	if len(images) > 0 && aiCfg.VisionModel != "" && opts.Model == "" {
+		aiCfg.Model = aiCfg.VisionModel
 	}
 
-	// Send initial message
-	sentMsg, err := ctx.Send("AI 正在思考... ⏳")
+	if msg, exceeded := quotaExceeded(cfg, s, ctx); exceeded {
+		_ = replyQuotaExceeded(cfg, ctx, msg)
+		return
+	}
+
+	// 语义缓存：相似问题直接给出缓存的回答
+	var cacheVector []float32
+	if p.cacheable(s, storageKey, images, opts) {
+		var hit bool
+		if hit, cacheVector = p.cachedAnswer(ctx, cfg, s, logger, storageKey, userMessage, opts); hit {
+			return
+		}
+	}
+
+	// Acknowledge receipt
+	reply, err := acknowledge(ctx, cfg.Bot.AckReaction, i18n.T(lang, "ai.thinking"))
 	if err != nil {
 		logger.Error("Failed to send initial message", "error", err)
-		_ = ctx.Reply("发送消息失败: " + err.Error())
+		_ = ctx.Reply(i18n.T(lang, "ai.send_failed", err))
 		return
 	}
 
+	// 会话禁聊策略
+	topics := s.GetBannedTopics(policy.ChatKey(ctx))
+	profile := s.GetUserProfile(storageKey)
+
+	// Execute with tools, the spans of the generation belong to the trace of the message
+	executeCtx, cancel := context.WithTimeout(core.TraceContext(ctx), 120*time.Second)
+	defer cancel()
+
 	// Build messages
+	extraPrompt := memoryPrompt(s, storageKey) + p.knowledgePrompt(executeCtx, ctx, logger, userMessage) + p.notesPrompt(executeCtx, cfg, s, ctx, logger, userMessage) + policy.Prompt(topics)
 	messages := []ChatMessage{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: userMessage},
+		{Role: "system", Content: systemPrompt + extraPrompt},
 	}
-
-	// Execute with tools
-	executeCtx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
+	if profile.HistoryEnabled {
+		messages = append(messages, p.history.Get(storageKey)...)
+	}
+	messages = append(messages, ChatMessage{Role: "user", Content: userMessage, Images: images})
 
 	// Get platform-specific prompt
 	platformPrompt := cfg.GetPlatformPrompt(ctx.Platform())
 
-	finalContent, err := p.toolExecutor.ExecuteWithTools(executeCtx, aiCfg, messages, 10, platformPrompt)
+	var result *ExecutionResult
+	var trial *storage.Trial
+	switch {
+	case experimentSampled(cfg, s, images, opts):
+		result, trial, err = p.runExperiment(executeCtx, cfg, logger, aiCfg, messages, extraPrompt, platformPrompt, opts, profile.ToolsDisabled)
+		if trial != nil {
+			aiCfg = variantConfig(aiCfg, experimentVariant(cfg, trial.Delivered))
+		}
+	case profile.ToolsDisabled:
+		result, err = p.toolExecutor.ExecuteWithoutToolsContext(executeCtx, aiCfg, messages)
+	default:
+		result, err = p.toolExecutor.Execute(executeCtx, aiCfg, messages, platformPrompt, opts)
+	}
 	if err != nil {
 		logger.Error("AI generation error", "user_id", user.ID, "error", err)
-		_ = ctx.Edit(sentMsg, "生成回复时出错: "+err.Error())
+		recordAudit(logger, s, storageKey, storage.AuditEntry{Time: time.Now(), RequestID: requestID, Kind: "chat", Model: aiCfg.Model, Error: err.Error()})
+		_ = reply.Done(i18n.T(lang, "ai.generate_failed", err))
 		return
 	}
+	result.RequestID = requestID
+	logResult(logger, s, cfg.Limits, "chat", storageKey, aiCfg.Model, result)
 
-	if err := ctx.Edit(sentMsg, finalContent); err != nil {
-		logger.Error("Failed to edit message", "error", err)
-		_ = ctx.Reply(finalContent)
+	finalContent := enforcePolicy(ctx, s, logger, lang, topics, userMessage, result.Content)
+
+	if profile.HistoryEnabled {
+		p.history.Append(storageKey, userMessage, finalContent)
+	}
+	// 使用了工具的回答（新闻、天气等）通常有时效性，不缓存；实验变体的回答也不缓存
+	if cacheVector != nil && trial == nil && finalContent == result.Content && len(result.ToolCalls) == 0 && len(result.Files) == 0 {
+		p.cache.Store(cacheKey(ctx), userMessage, finalContent, cacheVector)
+	}
+
+	text, rendered := p.renderReply(ctx, cfg, watermark(cfg, finalContent))
+	if err := reply.Done(text); err != nil {
+		logger.Error("Failed to send reply", "error", err)
+	}
+
+	sendRendered(ctx, logger, rendered)
+	sendFiles(ctx, logger, lang, result.Files)
+
+	if profile.ShowThinking && result.Reasoning != "" {
+		if _, err := ctx.Send(i18n.T(lang, "ai.reasoning", truncateThinking(result.Reasoning))); err != nil {
+			logger.Error("Failed to send reasoning", "error", err)
+		}
+	}
+
+	rated := &answer{
+		requestID: requestID,
+		user:      storageKey,
+		chat:      policy.ChatKey(ctx),
+		model:     aiCfg.Model,
+		persona:   profile.Persona,
+		time:      time.Now(),
+	}
+	if trial != nil {
+		trial.RequestID = requestID
+		if saveTrial(ctx, s, logger, trial, userMessage, finalContent) {
+			rated.experiment, rated.variant = trial.Experiment, trial.Delivered
+		}
+	}
+	p.offerFeedback(ctx, cfg, s, logger, rated)
+
+	// 回复发送后再提取长期记忆，不影响回复的速度
+	if cfg.Memory.Auto && !profile.AutoMemoryOff {
+		extractMemories(cfg, s, logger, storageKey, userMessage)
+	}
+}
+
+// maxThinkingLength 显示的思考过程最多字数，超出部分省略开头
+const maxThinkingLength = 3000
+
+// truncateThinking 过长的思考过程只保留结尾，结尾通常是得出结论的部分
+func truncateThinking(reasoning string) string {
+	runes := []rune(reasoning)
+	if len(runes) <= maxThinkingLength {
+		return reasoning
+	}
+	return "…" + string(runes[len(runes)-maxThinkingLength:])
+}
+
+// logResult 记录一次 AI 请求的统计信息，并写入用户的审计记录
+func logResult(logger *slog.Logger, s *storage.Storage, limits config.LimitsConfig, kind, storageKey, model string, result *ExecutionResult) {
+	logger.Info("AI request completed",
+		"kind", kind,
+		"user", storageKey,
+		"model", model,
+		"tokens", result.Usage.TotalTokens,
+		"tool_calls", len(result.ToolCalls),
+		"files", len(result.Files),
+		"sources", len(result.Sources),
+		"truncated", result.Truncated,
+		"looped", result.Looped,
+		"duration", result.Duration,
+	)
+
+	entry := storage.AuditEntry{
+		Time:      time.Now(),
+		RequestID: result.RequestID,
+		Kind:      kind,
+		Model:     model,
+		Tokens:    result.Usage.TotalTokens,
+		Duration:  result.Duration,
+		Truncated: result.Truncated,
+	}
+	for _, call := range result.ToolCalls {
+		entry.ToolCalls = append(entry.ToolCalls, call.Name)
+	}
+	recordAudit(logger, s, storageKey, entry)
+	recordToolCalls(logger, s, storageKey, result)
+
+	if storageKey != "" {
+		if err := addUsage(limits, s, storageKey, 1, result.Usage.TotalTokens); err != nil {
+			logger.Error("Failed to save usage", "error", err)
+		}
+	}
+}
+
+// recordAudit 保存审计记录，storageKey 为空（如定时推送）时不记录
+func recordAudit(logger *slog.Logger, s *storage.Storage, storageKey string, entry storage.AuditEntry) {
+	if storageKey == "" {
+		return
+	}
+	if err := s.AddAuditEntry(storageKey, entry); err != nil {
+		logger.Error("Failed to save audit entry", "error", err)
+	}
+}
+
+// recordToolCalls 保存本次请求执行的工具调用，定时推送等没有用户的请求记为 system
+func recordToolCalls(logger *slog.Logger, s *storage.Storage, storageKey string, result *ExecutionResult) {
+	if storageKey == "" {
+		storageKey = "system"
+	}
+	var logs []storage.ToolCallLog
+	for _, call := range result.ToolCalls {
+		entry := storage.ToolCallLog{
+			Time:      time.Now(),
+			RequestID: result.RequestID,
+			User:      storageKey,
+			Tool:      call.Name,
+			Arguments: call.Arguments,
+			Duration:  call.Duration,
+			Result:    call.Result,
+		}
+		if call.Err != nil {
+			entry.Error = call.Err.Error()
+		}
+		logs = append(logs, entry)
+	}
+	if err := s.AddToolCallLogs(logs...); err != nil {
+		logger.Error("Failed to save tool calls", "error", err)
+	}
+}
+
+// profilePrompt 根据用户偏好（语言、默认城市）生成附加的系统提示词
+func profilePrompt(profile storage.UserProfile) string {
+	var b strings.Builder
+	if profile.Language != "" && profile.Language != i18n.Default {
+		b.WriteString("\n\nAlways reply in " + i18n.Name(profile.Language) + ".")
+	}
+	if profile.City != "" {
+		b.WriteString("\n\n用户的默认城市是" + profile.City + "，当用户询问天气等与地点相关的问题且未指明地点时，以此城市为准。")
+	}
+	if profile.Timezone != "" {
+		b.WriteString("\n\n用户所在的时区是 " + profile.Timezone + "，涉及当前时间、日期和提醒时间时以此时区为准（查询时间时把它作为 timezone 参数）。")
+	}
+	return b.String()
+}
+
+// resolveAIConfig 返回用户实际使用的 AI 配置：用户覆盖的配置优先，演示模式下强制使用内置地址和 Key 并限制 token
+func resolveAIConfig(cfg *config.Config, s *storage.Storage, storageKey string) config.AIConfig {
+	return resolveRequestConfig(cfg, s, storageKey, Options{})
+}
+
+// resolveRequestConfig 在用户配置之上应用单次请求的覆盖参数，演示模式的限制仍然生效
+func resolveRequestConfig(cfg *config.Config, s *storage.Storage, storageKey string, opts Options) config.AIConfig {
+	aiCfg := cfg.AI
+	if userOverride := s.GetUserAIConfig(storageKey); userOverride != nil {
+		aiCfg = *userOverride
+	}
+	if persona, ok := cfg.Personas[opts.Persona]; ok {
+		aiCfg.GenerationParams = aiCfg.GenerationParams.Merge(persona.GenerationParams)
+	}
+	aiCfg = opts.apply(aiCfg)
+	if cfg.Demo.Enabled {
+		aiCfg.Provider = cfg.AI.Provider
+		aiCfg.BaseURL = cfg.AI.BaseURL
+		aiCfg.APIKey = cfg.AI.APIKey
+		if aiCfg.MaxTokens <= 0 || aiCfg.MaxTokens > cfg.Demo.MaxTokens {
+			aiCfg.MaxTokens = cfg.Demo.MaxTokens
+		}
+	}
+	return aiCfg
+}
+
+// routePrompt 路由规则指定的系统提示词（prompt 优先于 persona）
+func routePrompt(cfg *config.Config, route *config.RouteConfig) (string, bool) {
+	if route == nil {
+		return "", false
+	}
+	if route.Prompt != "" {
+		return route.Prompt, true
+	}
+	return cfg.GetPersonaPrompt(route.Persona)
+}
+
+// requestPersona 本次对话生效的人设，与系统提示词的优先级一致：路由规则 → 群人设 → 用户人设
+func requestPersona(route *config.RouteConfig, g storage.GroupSettings, profile storage.UserProfile) string {
+	switch {
+	case route != nil && route.Prompt == "" && route.Persona != "":
+		return route.Persona
+	case g.Persona != "":
+		return g.Persona
+	}
+	return profile.Persona
+}
+
+// watermark 演示模式下在回复末尾添加水印
+func watermark(cfg *config.Config, text string) string {
+	if !cfg.Demo.Enabled {
+		return text
+	}
+	return text + "\n\n" + cfg.Demo.Watermark
+}
+
+// chatSystemPrompt 按 默认提示词 → 人设 → 女朋友定制 的优先级确定对话的系统提示词，
+// 并返回最终生效的来源（default / persona:key / girlfriend:name）
+func chatSystemPrompt(cfg *config.Config, aiCfg config.AIConfig, profile storage.UserProfile, storageKey string) (string, string) {
+	systemPrompt, source := aiCfg.DefaultPrompt, "default"
+	if personaPrompt, ok := cfg.GetPersonaPrompt(profile.Persona); ok {
+		systemPrompt, source = personaPrompt, "persona:"+profile.Persona
+	}
+	if name, gfPrompt, ok := cfg.GetGirlfriendPrompt(storageKey); ok {
+		systemPrompt, source = gfPrompt, "girlfriend:"+name
+	}
+	return systemPrompt + profilePrompt(profile), source
+}
+
+// enforcePolicy 输出过滤：回复触犯会话禁聊话题时记录违规并替换为 lang 的拒绝语
+func enforcePolicy(ctx core.Context, s *storage.Storage, logger *slog.Logger, lang string, topics []string, prompt, reply string) string {
+	topic, violated := policy.Check(topics, reply)
+	if !violated {
+		return reply
+	}
+
+	chatKey := policy.ChatKey(ctx)
+	logger.Warn("Reply blocked by chat policy", "chat", chatKey, "user_id", ctx.Sender().ID, "topic", topic)
+	if err := s.AddPolicyViolation(chatKey, storage.PolicyViolation{
+		Time:   time.Now(),
+		UserID: ctx.Sender().ID,
+		Topic:  topic,
+		Prompt: prompt,
+	}); err != nil {
+		logger.Error("Failed to save policy violation", "error", err)
+	}
+	return i18n.T(lang, "ai.policy_blocked")
+}
+
+// renderReply 在启用渲染的平台上将代码块和公式转换为图片，返回替换后的文本和图片
+func (p *AIPlugin) renderReply(ctx core.Context, cfg *config.Config, text string) (string, []render.Image) {
+	if p.renderer == nil || !cfg.Render.RenderEnabled(ctx.Platform()) {
+		return text, nil
+	}
+	return p.renderer.Render(text)
+}
+
+// sendRendered 发送 renderReply 生成的图片，发送失败时改为发送图片替换掉的原文
+func sendRendered(ctx core.Context, logger *slog.Logger, images []render.Image) {
+	for i, img := range images {
+		if err := ctx.SendFile(img.File); err != nil {
+			logger.Error("Failed to send rendered image, sending the source instead", "name", img.File.Name, "error", err)
+			_ = ctx.Reply(render.Placeholder(i+1) + "\n" + img.Source)
+		}
+	}
+}
+
+// sendFiles delivers files produced by tools to the user, failures are reported in lang
+func sendFiles(ctx core.Context, logger *slog.Logger, lang string, files []*core.File) {
+	for _, f := range files {
+		if err := ctx.SendFile(f); err != nil {
+			logger.Error("Failed to send file", "name", f.Name, "error", err)
+			_ = ctx.Reply(i18n.T(lang, "ai.file_failed", f.Name, err))
+		}
 	}
 }
 
@@ -96,44 +450,172 @@ func (p *AIPlugin) Init(ctx *plugins.Context) error {
 	logger := ctx.Logger
 
 	// Initialize MCP Manager and Tool Executor
-	p.mcpManager = NewMCPManager(cfg.Proxy, logger)
-	p.toolExecutor = NewToolExecutor(p.mcpManager, logger)
-
-	// Connect to all MCP servers
-	if len(cfg.MCPServers) > 0 {
-		connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		if err := p.mcpManager.ConnectServers(connectCtx, cfg.MCPServers); err != nil {
-			logger.Error("Failed to connect to some MCP servers", "error", err)
-			// Continue anyway - some servers may have connected successfully
-		}
-
-		// Log connection status
-		health := p.mcpManager.HealthCheck(context.Background())
-		for name, isHealthy := range health {
-			if isHealthy {
-				logger.Info("MCP server healthy", "name", name)
-			} else {
-				logger.Warn("MCP server unhealthy", "name", name)
+	p.mcpManager = NewMCPManager(cfg.Proxy, s, logger)
+	// 每个实例（多租户时每个租户）使用独立的工具注册表
+	p.tools = DefaultTools.Clone()
+	p.toolExecutor = NewToolExecutor(p.mcpManager, p.tools, logger)
+	p.toolExecutor.SetResponseCache(s, cfg.ResponseCache.TTL)
+	p.toolExecutor.SetToolOutputLimit(cfg.ToolOutput)
+	p.toolExecutor.SetToolLoopLimits(cfg.ToolLoop)
+	if cfg.Search.Provider != "" {
+		search, err := NewSearchProvider(cfg.Search, cfg.Proxy)
+		if err != nil {
+			return err
+		}
+		if err := p.tools.Register(search.Tool()); err != nil {
+			return err
+		}
+		logger.Info("Built-in search tool enabled", "provider", cfg.Search.Provider)
+	}
+	for name, hookCfg := range cfg.ToolWebhooks {
+		tool, err := webhookTool(name, hookCfg)
+		if err != nil {
+			return err
+		}
+		if err := p.tools.Register(tool); err != nil {
+			return err
+		}
+		logger.Info("Webhook tool registered", "name", name, "method", hookCfg.Method, "url", hookCfg.URL)
+	}
+	p.toolExecutor.SetConfirmPolicy(cfg.ToolNeedsConfirm)
+	p.confirms = newConfirmations()
+	p.answers = newAnswers()
+	intents, err := newIntentRouter(cfg.Intents)
+	if err != nil {
+		return err
+	}
+	p.intents = intents
+	if cfg.Demo.Enabled {
+		p.toolExecutor.SetToolFilter(cfg.Demo.ToolAllowed)
+		logger.Info("Demo mode enabled", "max_tokens", cfg.Demo.MaxTokens, "disabled_tools", cfg.Demo.DisabledTools)
+	}
+	p.history = newConversationHistory()
+	if cfg.Render.Enabled {
+		renderer, err := render.New(cfg.Render)
+		if err != nil {
+			return err
+		}
+		p.renderer = renderer
+	}
+	if cfg.Knowledge.Enabled {
+		kb, err := knowledge.New(cfg.Knowledge)
+		if err != nil {
+			return err
+		}
+		p.kb = kb
+	}
+	if cfg.SemanticCache.Enabled {
+		p.cache = knowledge.NewCache(cfg.SemanticCache)
+		logger.Info("Semantic cache enabled", "threshold", cfg.SemanticCache.Threshold, "ttl", cfg.SemanticCache.TTL)
+	}
+	ctx.UserData.Add(core.UserDataProvider{Name: "ai", Export: p.exportUser, Forget: p.forgetUser})
+
+	// 连接 MCP 服务：startup 在启动时连接，background 在后台连接，lazy 等到首次使用工具时连接
+	servers := mcpServers(ctx)
+	p.mcpManager.SetServers(servers, func() { p.refreshMCP(ctx) })
+	if len(servers) > 0 {
+		warmUp := func() {
+			p.mcpManager.EnsureConnected()
+			for _, status := range p.mcpManager.Status() {
+				if status.Err != nil && !errors.Is(status.Err, errMCPUnauthorized) {
+					ctx.Alerts.Warn("mcp:"+status.Name, "MCP 服务 "+status.Name+" 不可用: "+status.Err.Error())
+				}
 			}
 		}
+		switch cfg.MCPConnect {
+		case "startup":
+			warmUp()
+		case "background":
+			go warmUp()
+		}
+	}
+
+	// 作为 MCP 服务对外提供发消息、查询用户和对话的工具
+	if cfg.MCPServer.Enabled {
+		p.mcpServer = mcpserver.New(cfg.MCPServer, mcpserver.Backend{
+			SendTo:       ctx.SendTo,
+			Storage:      s,
+			Conversation: p.conversation,
+		}, logger)
+		if err := p.mcpServer.Start(); err != nil {
+			return err
+		}
 	}
 
 	// Schedule Push if enabled
 	if cfg.Push.Enabled {
-		go p.startScheduler(ctx)
+		schedule, err := scheduler.Daily(cfg.Push.Time)
+		if err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+		if _, err := msgtmpl.Parse("push", cfg.Push.Prompt); err != nil {
+			return fmt.Errorf("push: prompt: %w", err)
+		}
+		if err := ctx.Scheduler.Add("push", schedule, func(context.Context) error {
+			return p.executePush(ctx)
+		}); err != nil {
+			return err
+		}
+	}
+	for name, push := range cfg.Push.Personal {
+		// 私聊目标按该用户 /tz 设置的时区推送
+		var location func() *time.Location
+		if userKey, ok := policy.TargetUserKey(push.Target); ok {
+			location = func() *time.Location { return core.UserLocation(ctx.Storage, userKey) }
+		}
+		schedule, err := scheduler.DailyIn(push.Time, location)
+		if err != nil {
+			return fmt.Errorf("push %s: %w", name, err)
+		}
+		if _, err := msgtmpl.Parse(name, push.Prompt); err != nil {
+			return fmt.Errorf("push %s: prompt: %w", name, err)
+		}
+		if err := ctx.Scheduler.Add("push:"+name, schedule, func(context.Context) error {
+			return p.executePersonalPush(ctx, name, push)
+		}); err != nil {
+			return err
+		}
+	}
+	for name, channel := range cfg.Push.Channels {
+		schedule, err := scheduler.Daily(channel.Time)
+		if err != nil {
+			return fmt.Errorf("push channel %s: %w", name, err)
+		}
+		if _, err := msgtmpl.Parse(name, channel.Prompt); err != nil {
+			return fmt.Errorf("push channel %s: prompt: %w", name, err)
+		}
+		if err := ctx.Scheduler.Add("channel:"+name, schedule, func(context.Context) error {
+			return p.executeChannel(ctx, name, channel)
+		}); err != nil {
+			return err
+		}
+	}
+	// Daily summary: 每日群聊总结，/summary 开关
+	if cfg.Summary.Enabled {
+		schedule, err := scheduler.Daily(cfg.Summary.Time)
+		if err != nil {
+			return fmt.Errorf("summary: %w", err)
+		}
+		if err := ctx.Scheduler.Add("summary", schedule, func(context.Context) error {
+			return p.executeSummary(ctx)
+		}); err != nil {
+			return err
+		}
+		ctx.AddCommand(p.summaryCommand(ctx))
 	}
 
 	// Handler: /set_ai
-	ctx.RegisterCommand("/set_ai", func(c core.Context) error {
+	ctx.AddCommand(&core.Command{Name: "/set_ai", Description: "配置个人 AI 设置", ArgsUsage: "[key=KEY] [model=模型] [url=API地址]", Args: rawArgs, Handler: func(c core.Context, _ core.Args) error {
 		text := c.Text()
 		parts := strings.Fields(text)
 		if len(parts) <= 1 {
-			return c.Reply("使用方法: /set_ai key=你的KEY model=模型名称 url=API地址")
+			if cfg.Demo.Enabled {
+				return c.Reply(ctx.T(c, "ai.set_usage_demo"))
+			}
+			return c.Reply(ctx.T(c, "ai.set_usage"))
 		}
 		args := parts[1:]
-		storageKey := c.Platform() + ":" + c.Sender().ID
+		storageKey := core.UserKey(c)
 		currentCfg := s.GetUserAIConfig(storageKey)
 		var newCfg config.AIConfig
 		if currentCfg != nil {
@@ -148,6 +630,13 @@ func (p *AIPlugin) Init(ctx *plugins.Context) error {
 			}
 			key, val := kv[0], kv[1]
 			switch strings.ToLower(key) {
+			case "key", "api_key", "url", "base_url", "provider":
+				// 演示模式下不保存用户的密钥和地址，避免内置 Key 被发往其他地址
+				if cfg.Demo.Enabled {
+					return c.Reply(ctx.T(c, "ai.demo_no_key"))
+				}
+			}
+			switch strings.ToLower(key) {
 			case "key", "api_key":
 				newCfg.APIKey = val
 			case "model":
@@ -156,92 +645,176 @@ func (p *AIPlugin) Init(ctx *plugins.Context) error {
 				newCfg.BaseURL = val
 			case "provider":
 				newCfg.Provider = val
+			case "vision", "vision_model":
+				newCfg.VisionModel = val
 			}
+			if slices.Contains(paramKeys, strings.ToLower(key)) {
+				if err := setParam(&newCfg.GenerationParams, strings.ToLower(key), val); err != nil {
+					return c.Reply(ctx.T(c, "ai.invalid_param", key+": "+err.Error()))
+				}
+			}
+		}
+		if err := newCfg.GenerationParams.Validate(); err != nil {
+			return c.Reply(ctx.T(c, "ai.invalid_param", err))
 		}
 		if err := s.UpdateUserAIConfig(storageKey, newCfg); err != nil {
-			return c.Reply("保存设置失败: " + err.Error())
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		return c.Reply(ctx.T(c, "ai.updated"))
+	}})
+
+	// Handler: /clear - 清空对话记忆
+	ctx.AddCommand(&core.Command{Name: "/clear", Description: "清空对话记忆", Handler: func(c core.Context, _ core.Args) error {
+		p.history.Clear(core.UserKey(c))
+		return c.Reply(ctx.T(c, "ai.cleared"))
+	}})
+
+	// Handler: /think - 推理模型回答后是否显示思考过程
+	ctx.AddCommand(&core.Command{Name: "/think", Description: "开关推理模型思考过程的显示", Args: []core.Arg{{Name: "开关", Optional: true, Choices: []string{"on", "off"}}}, Handler: func(c core.Context, args core.Args) error {
+		storageKey := core.UserKey(c)
+		if !args.Has("开关") {
+			state := "common.off"
+			if s.GetUserProfile(storageKey).ShowThinking {
+				state = "common.on"
+			}
+			return c.Reply(ctx.T(c, "ai.think_status", ctx.T(c, state)))
 		}
-		return c.Reply("AI 设置已更新！")
+		on := args["开关"] == "on"
+		if err := s.UpdateUserProfile(storageKey, func(p *storage.UserProfile) { p.ShowThinking = on }); err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		if on {
+			return c.Reply(ctx.T(c, "ai.think_on"))
+		}
+		return c.Reply(ctx.T(c, "ai.think_off"))
+	}})
+
+	// Handler: /kb - 知识库
+	ctx.AddCommand(&core.Command{Name: kbCommand, Description: "管理个人知识库", ArgsUsage: "[add|del|clear|search] [参数]", Args: rawArgs, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleKB(ctx, c)
+	}})
+
+	// Handler: /note - 个人笔记
+	ctx.AddCommand(p.noteCommand(ctx))
+
+	// Handler: /remember、/memories - 长期记忆
+	ctx.AddCommand(rememberCommand(ctx))
+	ctx.AddCommand(memoriesCommand(ctx))
+
+	// Handler: /confirm - 确认或拒绝执行需要确认的工具
+	ctx.AddCommand(&core.Command{Name: "/confirm", Description: "确认/拒绝 AI 请求执行的工具", ArgsUsage: "[确认ID] yes|no", Args: rawArgs, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleConfirm(ctx, c)
+	}})
+	ctx.RegisterCallback(confirmCallback, func(c core.Context) error {
+		return p.handleConfirm(ctx, c)
 	})
 
-	// Handler: /reset_ai
-	ctx.RegisterCommand("/reset_ai", func(c core.Context) error {
-		storageKey := c.Platform() + ":" + c.Sender().ID
-		if err := s.ClearUserAIConfig(storageKey); err != nil {
-			return c.Reply("重置设置失败: " + err.Error())
-		}
-		return c.Reply("AI 设置已重置为全局默认值。")
+	// Handler: /resources - 浏览 MCP 资源
+	ctx.AddCommand(&core.Command{Name: "/resources", Description: "浏览 MCP 资源", Args: []core.Arg{{Name: "URI", Optional: true, Rest: true}}, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleResources(ctx, c)
+	}})
+
+	// Handler: /subscribe /unsubscribe - 订阅推送频道
+	ctx.AddCommand(&core.Command{Name: "/subscribe", Description: "订阅推送频道", Args: []core.Arg{{Name: "频道", Optional: true}}, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleSubscribe(ctx, c, true)
+	}})
+	ctx.AddCommand(&core.Command{Name: "/unsubscribe", Description: "取消订阅推送频道", Args: []core.Arg{{Name: "频道"}}, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleSubscribe(ctx, c, false)
+	}})
+	ctx.AddCommand(broadcastCommand(ctx))
+
+	// Handler: 语义缓存的“重新生成”按钮
+	ctx.RegisterCallback(cacheCallback, func(c core.Context) error {
+		return p.handleRegenerate(ctx, c)
 	})
 
-	// Handler: /news
-	ctx.RegisterCommand("/news", func(c core.Context) error {
-		user := c.Sender()
-		if !cfg.IsAllowed(c.Platform(), user.ID) {
-			return nil
-		}
+	// Handler: /tools - 可用的工具和 MCP 服务状态
+	ctx.AddCommand(p.toolsCommand(ctx))
+
+	// Handler: /mcp - 运行时添加、移除 MCP 服务（管理员）
+	ctx.AddCommand(p.mcpCommand(ctx))
+	ctx.AddCommand(p.toolCallsCommand(ctx))
+
+	// Handler: /mcp_auth - MCP 服务 OAuth 授权（管理员）
+	ctx.AddCommand(&core.Command{
+		Name:        "/mcp_auth",
+		Description: "MCP 服务 OAuth 授权（管理员）",
+		Admin:       true,
+		Args:        []core.Arg{{Name: "服务名", Optional: true}, {Name: "code", Optional: true}},
+		Handler: func(c core.Context, args core.Args) error {
+			return p.handleMCPAuth(ctx, c, args)
+		},
+	})
 
-		// Handle request asynchronously
-		go func() {
-			storageKey := c.Platform() + ":" + user.ID
-			aiCfg := cfg.AI
-			if userOverride := s.GetUserAIConfig(storageKey); userOverride != nil {
-				aiCfg = *userOverride
-			}
+	// Handler: /experiment - A/B 提示词实验（管理员）
+	ctx.AddCommand(p.experimentCommand(ctx))
 
-			sentMsg, err := c.Send("正在获取今日新闻... 📰")
-			if err != nil {
-				logger.Error("Failed to send message", "error", err)
-				return
-			}
+	// Handler: 回答评价按钮和 /stats（管理员）
+	ctx.RegisterCallback(feedbackCallback, func(c core.Context) error {
+		return p.handleFeedbackButton(ctx, c)
+	})
+	// Usage & payments: 今日用量，购买额度
+	ctx.AddCommand(usageCommand(ctx))
+	if cfg.Payments.Enabled {
+		ctx.AddCommand(buyCommand(ctx))
+		ctx.RegisterCallback(buyCallback, func(c core.Context) error {
+			return sendInvoice(ctx, c, c.Data())
+		})
+		ctx.RegisterPayment(handlePayment(ctx))
+	}
 
-			messages := []ChatMessage{
-				{Role: "system", Content: "你是一个专业的新闻播报员。请获取最新新闻并进行简洁清晰的总结，用中文回复。"},
-				{Role: "user", Content: "请搜索获取今日最新新闻并总结要点，列出具体的新闻事件"},
-			}
+	ctx.AddCommand(&core.Command{Name: "/stats", Description: "查看运行状态和统计（管理员）", Admin: true, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleStats(ctx, c)
+	}})
 
-			executeCtx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-			defer cancel()
+	// Handler: /selftest - 端到端自检（管理员）
+	ctx.AddCommand(&core.Command{Name: "/selftest", Description: "端到端自检（管理员）", Admin: true, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleSelfTest(ctx, c)
+	}})
 
-			platformPrompt := cfg.GetPlatformPrompt(c.Platform())
+	// Handler: /prompt - 使用 MCP 提示词模板
+	ctx.AddCommand(&core.Command{Name: "/prompt", Description: "使用 MCP 提示词模板", ArgsUsage: "[名称 参数=值...]", Args: rawArgs, Handler: func(c core.Context, _ core.Args) error {
+		return p.handlePrompt(ctx, c)
+	}})
 
-			finalContent, err := p.toolExecutor.ExecuteWithTools(executeCtx, aiCfg, messages, 10, platformPrompt)
-			if err != nil {
-				logger.Error("News generation error", "error", err)
-				_ = c.Edit(sentMsg, "获取新闻时出错: "+err.Error())
-				return
-			}
+	// Handler: /snapshot - 导出用户会话快照（管理员）
+	ctx.AddCommand(&core.Command{Name: "/snapshot", Description: "导出用户会话快照（管理员）", Admin: true, ArgsUsage: "<平台:用户ID> [审计条数] [anon]", Args: rawArgs, Handler: func(c core.Context, _ core.Args) error {
+		return p.handleSnapshot(ctx, c)
+	}})
 
-			if err := c.Edit(sentMsg, finalContent); err != nil {
-				logger.Error("Failed to edit message", "error", err)
-				_ = c.Reply(finalContent)
-			}
-		}()
+	// Handler: /reset_ai
+	ctx.AddCommand(&core.Command{Name: "/reset_ai", Description: "重置 AI 设置为全局默认值", Handler: func(c core.Context, _ core.Args) error {
+		storageKey := core.UserKey(c)
+		if err := s.ClearUserAIConfig(storageKey); err != nil {
+			return c.Reply(ctx.T(c, "ai.reset_failed", err))
+		}
+		return c.Reply(ctx.T(c, "ai.reset"))
+	}})
 
-		return nil
-	})
+	// Handler: /news [主题], /news set
+	ctx.AddCommand(p.newsCommand(ctx))
 
 	// Handler: /s - 搜索指令，使用 MCP 工具搜索
-	ctx.RegisterCommand("/s", func(c core.Context) error {
+	ctx.AddCommand(&core.Command{Name: "/s", Description: "联网搜索并总结", Args: []core.Arg{{Name: "搜索内容", Rest: true}}, Handler: func(c core.Context, args core.Args) error {
 		user := c.Sender()
 		if !cfg.IsAllowed(c.Platform(), user.ID) {
 			return nil
 		}
-
-		// 获取搜索关键词
-		text := c.Text()
-		parts := strings.SplitN(text, " ", 2)
-		if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
-			return c.Reply("使用方法: /s 搜索内容\n例如: /s 今天天气怎么样")
+		group, ok := groupSettings(s, c)
+		if !ok {
+			return nil
+		}
+		if msg, exceeded := quotaExceeded(cfg, s, c); exceeded {
+			return replyQuotaExceeded(cfg, c, msg)
 		}
-		query := strings.TrimSpace(parts[1])
+
+		query := args["搜索内容"]
 
 		// Handle request asynchronously
 		go func() {
-			storageKey := c.Platform() + ":" + user.ID
-			aiCfg := cfg.AI
-			if userOverride := s.GetUserAIConfig(storageKey); userOverride != nil {
-				aiCfg = *userOverride
-			}
+			logger := core.Logger(c, logger)
+			storageKey := core.UserKey(c)
+			aiCfg := resolveRequestConfig(cfg, s, storageKey, Options{Model: group.Model})
 
 			// 获取女朋友定制提示词
 			systemPrompt := `你是一个智能搜索助手。
@@ -255,40 +828,81 @@ func (p *AIPlugin) Init(ctx *plugins.Context) error {
 				logger.Debug("Using girlfriend prompt for search", "name", name)
 				systemPrompt = gfPrompt + "\n\n你需要使用搜索工具获取最新信息来回答问题，获取到结果后用温暖的语气总结回复。"
 			}
+			systemPrompt += profilePrompt(s.GetUserProfile(storageKey))
 
-			sentMsg, err := c.Send("🔍 正在搜索...")
+			reply, err := acknowledge(c, cfg.Bot.AckReaction, ctx.T(c, "ai.search_pending"))
 			if err != nil {
 				logger.Error("Failed to send message", "error", err)
 				return
 			}
 
+			topics := s.GetBannedTopics(policy.ChatKey(c))
 			messages := []ChatMessage{
-				{Role: "system", Content: systemPrompt},
+				{Role: "system", Content: systemPrompt + policy.Prompt(topics)},
 				{Role: "user", Content: query},
 			}
 
-			executeCtx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+			executeCtx, cancel := context.WithTimeout(core.TraceContext(c), 120*time.Second)
 			defer cancel()
 
 			platformPrompt := cfg.GetPlatformPrompt(c.Platform())
 
-			finalContent, err := p.toolExecutor.ExecuteWithTools(executeCtx, aiCfg, messages, 10, platformPrompt)
+			result, err := p.toolExecutor.Execute(executeCtx, aiCfg, messages, platformPrompt, Options{Confirm: p.confirmFunc(c, ctx.Lang(c))})
 			if err != nil {
 				logger.Error("Search error", "error", err)
-				_ = c.Edit(sentMsg, "搜索时出错: "+err.Error())
+				recordAudit(logger, s, storageKey, storage.AuditEntry{Time: time.Now(), RequestID: core.RequestID(c), Kind: "search", Model: aiCfg.Model, Error: err.Error()})
+				_ = reply.Done(ctx.T(c, "ai.search_failed", err))
 				return
 			}
+			result.RequestID = core.RequestID(c)
+			logResult(logger, s, cfg.Limits, "search", storageKey, aiCfg.Model, result)
 
-			if err := c.Edit(sentMsg, finalContent); err != nil {
-				logger.Error("Failed to edit message", "error", err)
-				_ = c.Reply(finalContent)
+			finalContent := watermark(cfg, enforcePolicy(c, s, logger, ctx.Lang(c), topics, query, result.Content))
+
+			text, rendered := p.renderReply(c, cfg, finalContent)
+			if err := reply.Done(text); err != nil {
+				logger.Error("Failed to send reply", "error", err)
 			}
+
+			sendRendered(c, logger, rendered)
+			sendFiles(c, logger, ctx.Lang(c), result.Files)
 		}()
 
 		return nil
-	})
+	}})
 
 	// Handler: Text (AI Chat)
+	// ask 对话：合并连续消息时在窗口结束后以合并的文字调用
+	ask := func(c core.Context) {
+		group, _ := groupSettings(s, c)
+		storageKey := core.UserKey(c)
+
+		// 获取女朋友定制提示词
+		aiCfg := resolveAIConfig(cfg, s, storageKey)
+
+		profile := s.GetUserProfile(storageKey)
+		systemPrompt, source := chatSystemPrompt(cfg, aiCfg, profile, storageKey)
+		if prompt, src, ok := groupPrompt(cfg, group, profile); ok {
+			systemPrompt, source = prompt, src
+		}
+		route := p.Router.Match(c)
+		if prompt, ok := routePrompt(cfg, route); ok {
+			systemPrompt, source = prompt, "route"
+		}
+		logger.Debug("Resolved system prompt", "source", source, "user_id", c.Sender().ID)
+
+		// Handle request asynchronously
+		go func() {
+			// 属于配置的意图时交给对应的指令，不再对话
+			if p.routeIntent(ctx, c) {
+				return
+			}
+			p.handleRequest(c, cfg, s, logger, systemPrompt, c.Text(), nil, Options{Cache: true, experiment: true, Model: group.Model, Persona: requestPersona(route, group, profile)})
+		}()
+	}
+	if cfg.Bot.MergeWindow > 0 {
+		p.merger = newMessageMerger(cfg.Bot.MergeWindow, ask)
+	}
 	ctx.RegisterText(func(c core.Context) error {
 		if strings.HasPrefix(c.Text(), "/") {
 			return nil
@@ -297,88 +911,52 @@ func (p *AIPlugin) Init(ctx *plugins.Context) error {
 		if !cfg.IsAllowed(c.Platform(), user.ID) {
 			return nil
 		}
-
-		storageKey := c.Platform() + ":" + user.ID
-
-		// 获取女朋友定制提示词
-		aiCfg := cfg.AI
-		if userOverride := s.GetUserAIConfig(storageKey); userOverride != nil {
-			aiCfg = *userOverride
+		if _, ok := groupSettings(s, c); !ok {
+			return nil
 		}
-
-		systemPrompt := aiCfg.DefaultPrompt
-		if name, gfPrompt, ok := cfg.GetGirlfriendPrompt(storageKey); ok {
-			logger.Debug("Using girlfriend prompt", "name", name, "user_id", user.ID)
-			systemPrompt = gfPrompt
+		// 单独的 👍/👎 是对上一个回答的评价
+		if rated, err := p.handleEmojiFeedback(ctx, c); rated {
+			return err
 		}
 
-		// Handle request asynchronously
-		go p.handleRequest(c, cfg, s, logger, systemPrompt, c.Text())
+		markFollowUp(c, s, logger)
 
+		// 连续发送的消息合并为一次提问
+		if p.merger != nil {
+			p.merger.add(c)
+			return nil
+		}
+		ask(c)
 		return nil
 	})
 
-	return nil
-}
-
-func (p *AIPlugin) startScheduler(ctx *plugins.Context) {
-	targetTime := ctx.Config.Push.Time
-	layout := "15:04"
-	for {
-		now := time.Now()
-		parsed, err := time.Parse(layout, targetTime)
-		if err != nil {
-			ctx.Logger.Error("Invalid push time format", "time", targetTime)
-			return
-		}
-		next := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), 0, 0, now.Location())
-		if next.Before(now) {
-			next = next.Add(24 * time.Hour)
-		}
-		duration := next.Sub(now)
-		ctx.Logger.Info("Push scheduled", "next_run", next, "duration", duration)
-		time.Sleep(duration)
-		p.executePush(ctx)
-		time.Sleep(60 * time.Second)
-	}
-}
-
-func (p *AIPlugin) executePush(ctx *plugins.Context) {
-	ctx.Logger.Info("Executing Scheduled Push")
-	aiCfg := ctx.Config.AI
-	messages := []ChatMessage{
-		{Role: "system", Content: "You are a news reporter."},
-		{Role: "user", Content: ctx.Config.Push.Prompt},
-	}
-
-	// Use tool executor with timeout
-	executeCtx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
+	// Handler: Document (大文件分块总结)
+	ctx.RegisterDocument(func(c core.Context) error {
+		return p.handleDocument(ctx, c)
+	})
 
-	// No platform prompt for scheduled push
-	content, err := p.toolExecutor.ExecuteWithTools(executeCtx, aiCfg, messages, 10, "")
-	if err != nil {
-		ctx.Logger.Error("Push generation error", "error", err)
-		return
-	}
+	// Handler: Photo (识图)
+	ctx.RegisterPhoto(func(c core.Context) error {
+		return p.handlePhoto(ctx, c)
+	})
 
-	if content == "" {
-		ctx.Logger.Error("Push content empty")
-		return
-	}
+	return nil
+}
 
-	for _, target := range ctx.Config.Push.Targets {
-		ctx.Logger.Info("Pushing to target", "target", target)
-		if ctx.SendTo != nil {
-			if err := ctx.SendTo(target, content); err != nil {
-				ctx.Logger.Error("Failed to push", "target", target, "error", err)
-			}
-		}
+// conversation 返回用户最近的对话，供 MCP 服务的 get_conversation 使用
+func (p *AIPlugin) conversation(userKey string) []mcpserver.Message {
+	var messages []mcpserver.Message
+	for _, m := range p.history.Get(userKey) {
+		messages = append(messages, mcpserver.Message{Role: m.Role, Content: m.Content})
 	}
+	return messages
 }
 
 // Cleanup closes MCP connections when plugin is unloaded
 func (p *AIPlugin) Cleanup() error {
+	if p.mcpServer != nil {
+		_ = p.mcpServer.Stop(context.Background())
+	}
 	if p.mcpManager != nil {
 		return p.mcpManager.Close()
 	}
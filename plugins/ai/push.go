@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/msgtmpl"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+)
+
+// newsChannel 内置每日推送对应的订阅频道
+const newsChannel = "news"
+
+// executePush 生成推送内容并发送到配置的目标和 news 频道的订阅者，由调度器的 push 任务执行
+func (p *AIPlugin) executePush(ctx *plugins.Context) error {
+	ctx.Logger.Info("Executing Scheduled Push")
+	content, err := p.generatePush(ctx, "push", "You are a news reporter.", ctx.Config.Push.Prompt, "")
+	if err != nil {
+		return err
+	}
+
+	return p.sendPush(ctx, channelTargets(ctx, newsChannel), content)
+}
+
+// channelTargets 频道的推送目标：订阅者，内置的 news 频道还包括 push.targets
+func channelTargets(ctx *plugins.Context, name string) []string {
+	var targets []string
+	if name == newsChannel {
+		targets = slices.Clone(ctx.Config.Push.Targets)
+	}
+	for _, target := range ctx.Storage.Subscribers(name) {
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// executePersonalPush 按目标用户的人设单独生成推送内容，由调度器的 push:<name> 任务执行
+func (p *AIPlugin) executePersonalPush(ctx *plugins.Context, name string, push config.PersonalPushConfig) error {
+	ctx.Logger.Info("Executing personal push", "name", name, "target", push.Target)
+	content, err := p.generatePush(ctx, "push:"+name, pushSystemPrompt(ctx, push.Target, push.Persona), push.Prompt, push.Target)
+	if err != nil {
+		return err
+	}
+	return p.sendPush(ctx, []string{push.Target}, content)
+}
+
+// executeChannel 发送推送频道的内容给当前的订阅者，由调度器的 channel:<name> 任务执行
+func (p *AIPlugin) executeChannel(ctx *plugins.Context, name string, channel config.PushChannelConfig) error {
+	targets := ctx.Storage.Subscribers(name)
+	ctx.Logger.Info("Executing push channel", "channel", name, "subscribers", len(targets))
+	if len(targets) == 0 {
+		return nil
+	}
+
+	job := "channel:" + name
+	if !channel.Personal {
+		content, err := p.generatePush(ctx, job, ctx.Config.AI.DefaultPrompt, channel.Prompt, "")
+		if err != nil {
+			return err
+		}
+		return p.sendPush(ctx, targets, content)
+	}
+
+	var errs []error
+	for _, target := range targets {
+		content, err := p.generatePush(ctx, job, pushSystemPrompt(ctx, target, ""), channel.Prompt, target)
+		if err == nil {
+			err = p.sendPush(ctx, []string{target}, content)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// generatePush 调用模型（可使用工具）生成推送内容，推送无法发送工具生成的文件。
+// 提示词先按 target 渲染模板变量，发给多个目标的内容 target 为空
+func (p *AIPlugin) generatePush(ctx *plugins.Context, job, systemPrompt, prompt, target string) (string, error) {
+	aiCfg := ctx.Config.AI
+	prompt, err := msgtmpl.Render(ctx, job, prompt, target)
+	if err != nil {
+		ctx.Alerts.Error(job, "推送 "+job+" 的提示词模板渲染失败: "+err.Error())
+		return "", fmt.Errorf("render prompt: %w", err)
+	}
+	messages := []ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: prompt},
+	}
+
+	executeCtx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	// No platform prompt for scheduled push. 相同的推送请求（如同一人设的多个订阅者）复用缓存的结果
+	result, err := p.toolExecutor.Execute(executeCtx, aiCfg, messages, "", Options{ResponseCache: true})
+	if err != nil {
+		ctx.Logger.Error("Push generation error", "job", job, "error", err)
+		ctx.Alerts.Error(job, "推送 "+job+" 生成失败: "+err.Error())
+		return "", err
+	}
+	logResult(ctx.Logger, ctx.Storage, ctx.Config.Limits, job, "", aiCfg.Model, result)
+	if result.Content == "" {
+		return "", fmt.Errorf("push content empty")
+	}
+	return result.Content, nil
+}
+
+func (p *AIPlugin) sendPush(ctx *plugins.Context, targets []string, content string) error {
+	var errs []error
+	for _, target := range targets {
+		ctx.Logger.Info("Pushing to target", "target", target)
+		if err := ctx.Push(target, content); err != nil {
+			ctx.Logger.Error("Failed to push", "target", target, "error", err)
+			ctx.Alerts.Error("push:"+target, "推送到 "+target+" 失败: "+err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushSystemPrompt 私聊目标使用该用户的女朋友配置、人设和偏好，persona 不为空时优先使用
+func pushSystemPrompt(ctx *plugins.Context, target, persona string) string {
+	cfg := ctx.Config
+	systemPrompt := cfg.AI.DefaultPrompt
+	if userKey, ok := policy.TargetUserKey(target); ok {
+		systemPrompt, _ = chatSystemPrompt(cfg, cfg.AI, ctx.Storage.GetUserProfile(userKey), userKey)
+	}
+	if prompt, ok := cfg.GetPersonaPrompt(persona); ok {
+		systemPrompt = prompt
+	}
+	return systemPrompt
+}
+
+// pushChannels 可订阅的频道，key → 显示名称
+func pushChannels(cfg *config.Config) map[string]string {
+	channels := make(map[string]string)
+	if cfg.Push.Enabled {
+		channels[newsChannel] = "每日推送"
+	}
+	for name, channel := range cfg.Push.Channels {
+		channels[name] = channel.Name
+	}
+	return channels
+}
+
+// handleSubscribe /subscribe [频道] 和 /unsubscribe <频道>，群聊中只有管理员可以修改订阅
+func (p *AIPlugin) handleSubscribe(ctx *plugins.Context, c core.Context, subscribe bool) error {
+	cfg := ctx.Config
+	if !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+
+	channels := pushChannels(cfg)
+	if len(channels) == 0 {
+		return c.Reply(ctx.T(c, "subscribe.no_channels"))
+	}
+	target, err := policy.PushTarget(c)
+	if err != nil {
+		return c.Reply(ctx.T(c, "push.no_target"))
+	}
+
+	parts := strings.Fields(c.Text())
+	if len(parts) < 2 {
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "subscribe.title"))
+		for _, name := range slices.Sorted(maps.Keys(channels)) {
+			mark := "○"
+			if ctx.Storage.Subscribed(name, target) {
+				mark = "●"
+			}
+			fmt.Fprintf(&b, "%s %s - %s\n", mark, name, channels[name])
+		}
+		b.WriteString(ctx.T(c, "subscribe.footer"))
+		return c.Reply(b.String())
+	}
+
+	name := parts[1]
+	if _, ok := channels[name]; !ok {
+		return c.Reply(ctx.T(c, "subscribe.unknown", name))
+	}
+	if c.Chat().Type != "private" && !cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "subscribe.admin_only"))
+	}
+
+	var changed bool
+	if subscribe {
+		changed, err = ctx.Storage.Subscribe(name, target)
+	} else {
+		changed, err = ctx.Storage.Unsubscribe(name, target)
+	}
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	ctx.Logger.Info("Subscription changed", "channel", name, "target", target, "subscribe", subscribe, "changed", changed)
+
+	switch {
+	case subscribe && changed:
+		return c.Reply(ctx.T(c, "subscribe.added", channels[name]))
+	case subscribe:
+		return c.Reply(ctx.T(c, "subscribe.exists", channels[name]))
+	case changed:
+		return c.Reply(ctx.T(c, "subscribe.removed", channels[name]))
+	default:
+		return c.Reply(ctx.T(c, "subscribe.not_subscribed", channels[name]))
+	}
+}
@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// quotaExceeded 检查用户今天的用量，超出限制时返回提示语，管理员不受限制。
+// 有购买的余额（/buy）时不受每日限制，超出部分从余额中扣除
+func quotaExceeded(cfg *config.Config, s *storage.Storage, c core.Context) (string, bool) {
+	limits := cfg.Limits
+	if limits.DailyRequests <= 0 && limits.DailyTokens <= 0 {
+		return "", false
+	}
+	if cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+		return "", false
+	}
+
+	userKey := core.UserKey(c)
+	usage := s.GetDailyUsage(userKey, storage.Day(time.Now()))
+	var msg string
+	switch {
+	case limits.DailyRequests > 0 && usage.Requests >= limits.DailyRequests:
+		msg = fmt.Sprintf("今日请求次数已用完（%d/%d），明天再来吧。", usage.Requests, limits.DailyRequests)
+	case limits.DailyTokens > 0 && usage.Tokens >= limits.DailyTokens:
+		msg = fmt.Sprintf("今日 token 额度已用完（%d/%d），明天再来吧。", usage.Tokens, limits.DailyTokens)
+	default:
+		return "", false
+	}
+	if s.GetCredits(userKey).Tokens > 0 {
+		return "", false
+	}
+	if cfg.Payments.Enabled {
+		msg += "也可以使用 /buy 购买额度。"
+	}
+	return msg, true
+}
+
+// addUsage 记录用户今天的用量，超出每日限制的 token 从购买的余额中扣除
+func addUsage(limits config.LimitsConfig, s *storage.Storage, userKey string, requests, tokens int) error {
+	day := storage.Day(time.Now())
+	before := s.GetDailyUsage(userKey, day)
+	if err := s.AddDailyUsage(userKey, day, requests, tokens); err != nil {
+		return err
+	}
+	return s.SpendCredits(userKey, paidTokens(limits, before, tokens))
+}
+
+// paidTokens 本次请求中超出每日限制、需要从余额中扣除的 token 数
+func paidTokens(limits config.LimitsConfig, before storage.DailyUsage, tokens int) int {
+	if limits.DailyRequests > 0 && before.Requests >= limits.DailyRequests {
+		return tokens
+	}
+	if limits.DailyTokens > 0 {
+		return min(tokens, max(before.Tokens+tokens-limits.DailyTokens, 0))
+	}
+	return 0
+}
+
+// replyQuotaExceeded 发送用量提示，提示为临时消息，一段时间后自动撤回
+func replyQuotaExceeded(cfg *config.Config, c core.Context, msg string) error {
+	_, err := core.SendEphemeral(c, msg, cfg.Bot.EphemeralTTL)
+	return err
+}
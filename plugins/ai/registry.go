@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ToolFunc implements a native tool. args are the JSON arguments decoded by the executor.
+type ToolFunc func(ctx context.Context, args map[string]interface{}) (string, error)
+
+// NativeTool is a tool implemented in Go, offered to the model alongside MCP tools
+type NativeTool struct {
+	Name        string
+	Description string
+	Schema      json.RawMessage // JSON Schema of the arguments, nil means no arguments
+	Handler     ToolFunc
+}
+
+// ToolRegistry holds native tools
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]NativeTool
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]NativeTool)}
+}
+
+// DefaultTools holds the tools shared by all AI plugin instances. Other packages add tools with RegisterTool
+// before the AI plugin is initialized; each instance copies it and adds its own configured tools.
+var DefaultTools = NewToolRegistry()
+
+// RegisterTool adds a tool to DefaultTools
+func RegisterTool(tool NativeTool) error {
+	return DefaultTools.Register(tool)
+}
+
+// Register adds a tool, it fails if a tool with the same name exists
+func (r *ToolRegistry) Register(tool NativeTool) error {
+	if tool.Name == "" || tool.Handler == nil {
+		return fmt.Errorf("tool name and handler are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("tool %s already registered", tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	return nil
+}
+
+// Unregister removes a tool
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+// Clone returns a new registry with the same tools
+func (r *ToolRegistry) Clone() *ToolRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := NewToolRegistry()
+	for name, tool := range r.tools {
+		clone.tools[name] = tool
+	}
+	return clone
+}
+
+func (r *ToolRegistry) Get(name string) (NativeTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Definitions returns the tool definitions sorted by name
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]ToolDefinition, 0, len(r.tools))
+	for _, tool := range r.tools {
+		schema := tool.Schema
+		if schema == nil {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		defs = append(defs, ToolDefinition{
+			Type: "function",
+			Function: Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  schema,
+			},
+		})
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Function.Name < defs[j].Function.Name
+	})
+	return defs
+}
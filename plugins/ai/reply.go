@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// typingInterval Telegram 的输入状态约 5 秒后消失，需要定期刷新
+const typingInterval = 4 * time.Second
+
+// pendingReply 表示一条正在生成的回复。
+// 优先显示"正在输入"状态（并可选地用表态确认收到消息），
+// 平台都不支持时才退回到发送占位消息，生成完成后再编辑占位消息或直接回复。
+type pendingReply struct {
+	ctx         core.Context
+	placeholder core.Message
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// acknowledge 确认收到消息。reaction 为空时不表态；输入状态和表态都不可用时发送 placeholder 文本
+func acknowledge(ctx core.Context, reaction, placeholder string) (*pendingReply, error) {
+	r := &pendingReply{ctx: ctx, stop: make(chan struct{})}
+
+	acked := false
+	if reaction != "" && ctx.React(reaction) == nil {
+		acked = true
+	}
+	if ctx.Notify(core.ActionTyping) == nil {
+		acked = true
+		r.keepTyping()
+	}
+	if acked {
+		return r, nil
+	}
+
+	msg, err := ctx.Send(placeholder)
+	if err != nil {
+		return nil, err
+	}
+	r.placeholder = msg
+	return r, nil
+}
+
+// keepTyping 定期刷新输入状态，直到回复完成
+func (r *pendingReply) keepTyping() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(typingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				_ = r.ctx.Notify(core.ActionTyping)
+			}
+		}
+	}()
+}
+
+// Done 发送最终内容：有占位消息时编辑它，编辑失败或没有占位消息时直接回复，并尽量删除占位消息
+func (r *pendingReply) Done(text string) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+
+	if r.placeholder != nil {
+		if err := r.ctx.Edit(r.placeholder, text); err == nil {
+			return nil
+		}
+	}
+	if err := r.ctx.Reply(text); err != nil {
+		return err
+	}
+	if r.placeholder != nil {
+		_ = r.ctx.Delete(r.placeholder)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// searchToolName 内置搜索工具的名称
+const searchToolName = "web_search"
+
+// searchResult 一条搜索结果
+type searchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// SearchProvider 内置网页搜索，不需要部署 MCP 服务即可让模型联网搜索
+type SearchProvider struct {
+	cfg    config.SearchConfig
+	client *http.Client
+}
+
+func NewSearchProvider(cfg config.SearchConfig, proxyCfg config.ProxyConfig) (*SearchProvider, error) {
+	switch cfg.Provider {
+	case "searxng":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("search: searxng requires url")
+		}
+	case "bing", "brave":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("search: %s requires api_key", cfg.Provider)
+		}
+	default:
+		return nil, fmt.Errorf("search: unknown provider %q", cfg.Provider)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.UseProxy && proxyCfg.URL != "" {
+		proxyURL, err := url.Parse(proxyCfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("search: invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &SearchProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 20 * time.Second, Transport: transport},
+	}, nil
+}
+
+// Tool returns the search provider as a native tool
+func (p *SearchProvider) Tool() NativeTool {
+	return NativeTool{
+		Name:        searchToolName,
+		Description: "Search the web and return the top results with title, URL and snippet. Use it for recent events or facts you are unsure about.",
+		Schema:      json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"Search keywords"}},"required":["query"]}`),
+		Handler:     p.Call,
+	}
+}
+
+// Call runs the search tool with the arguments from the model
+func (p *SearchProvider) Call(ctx context.Context, args map[string]interface{}) (string, error) {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	var results []searchResult
+	var err error
+	switch p.cfg.Provider {
+	case "searxng":
+		results, err = p.searxng(ctx, query)
+	case "bing":
+		results, err = p.bing(ctx, query)
+	case "brave":
+		results, err = p.brave(ctx, query)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No results found.", nil
+	}
+
+	if len(results) > p.cfg.MaxResults {
+		results = results[:p.cfg.MaxResults]
+	}
+	var b strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&b, "%d. %s\n%s\n%s\n\n", i+1, r.Title, r.URL, r.Snippet)
+	}
+	return b.String(), nil
+}
+
+func (p *SearchProvider) searxng(ctx context.Context, query string) ([]searchResult, error) {
+	u := strings.TrimRight(p.cfg.URL, "/") + "/search?format=json&q=" + url.QueryEscape(query)
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := p.getJSON(ctx, u, nil, &resp); err != nil {
+		return nil, err
+	}
+	results := make([]searchResult, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
+
+func (p *SearchProvider) bing(ctx context.Context, query string) ([]searchResult, error) {
+	endpoint := p.cfg.URL
+	if endpoint == "" {
+		endpoint = "https://api.bing.microsoft.com/v7.0/search"
+	}
+	u := fmt.Sprintf("%s?count=%d&q=%s", endpoint, p.cfg.MaxResults, url.QueryEscape(query))
+	var resp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := p.getJSON(ctx, u, map[string]string{"Ocp-Apim-Subscription-Key": p.cfg.APIKey}, &resp); err != nil {
+		return nil, err
+	}
+	results := make([]searchResult, 0, len(resp.WebPages.Value))
+	for _, r := range resp.WebPages.Value {
+		results = append(results, searchResult{Title: r.Name, URL: r.URL, Snippet: r.Snippet})
+	}
+	return results, nil
+}
+
+func (p *SearchProvider) brave(ctx context.Context, query string) ([]searchResult, error) {
+	endpoint := p.cfg.URL
+	if endpoint == "" {
+		endpoint = "https://api.search.brave.com/res/v1/web/search"
+	}
+	u := fmt.Sprintf("%s?count=%d&q=%s", endpoint, p.cfg.MaxResults, url.QueryEscape(query))
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := p.getJSON(ctx, u, map[string]string{"X-Subscription-Token": p.cfg.APIKey}, &resp); err != nil {
+		return nil, err
+	}
+	results := make([]searchResult, 0, len(resp.Web.Results))
+	for _, r := range resp.Web.Results {
+		results = append(results, searchResult{Title: r.Title, URL: r.URL, Snippet: r.Description})
+	}
+	return results, nil
+}
+
+func (p *SearchProvider) getJSON(ctx context.Context, u string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, val := range headers {
+		req.Header.Set(k, val)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search API error: %s (status: %d)", string(body), resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
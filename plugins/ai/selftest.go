@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// selfTestStage 自检中一个环节的结果
+type selfTestStage struct {
+	name    string // 环节名的 i18n key
+	detail  string
+	latency time.Duration
+	err     error
+}
+
+// handleSelfTest /selftest 依次检查模型、工具调用、MCP 服务和存储，报告每个环节的耗时和结果（管理员）
+func (p *AIPlugin) handleSelfTest(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "selftest.admin_only"))
+	}
+	if err := c.Reply(ctx.T(c, "selftest.running")); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	stages := p.runSelfTest(ctx)
+
+	passed := 0
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "selftest.title"))
+	for _, st := range stages {
+		icon := "✅"
+		if st.err != nil {
+			icon = "❌"
+		} else {
+			passed++
+		}
+		fmt.Fprintf(&b, "%s %s", icon, ctx.T(c, st.name))
+		if st.detail != "" {
+			b.WriteString(" (" + st.detail + ")")
+		}
+		fmt.Fprintf(&b, " %s", st.latency.Round(time.Millisecond))
+		if st.err != nil {
+			b.WriteString(": " + st.err.Error())
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(ctx.T(c, "selftest.total", time.Since(start).Round(time.Millisecond), passed, len(stages)))
+
+	ctx.Logger.Info("Self test completed", "passed", passed, "stages", len(stages), "duration", time.Since(start))
+	return c.Reply(b.String())
+}
+
+func (p *AIPlugin) runSelfTest(ctx *plugins.Context) []selfTestStage {
+	cfg := ctx.Config
+	var stages []selfTestStage
+
+	// 模型：固定提示词，不使用工具
+	aiCfg := cfg.AI
+	st := selfTestStage{name: "selftest.model", detail: aiCfg.Model}
+	begin := time.Now()
+	result, err := p.toolExecutor.ExecuteWithoutTools(aiCfg, []ChatMessage{
+		{Role: "system", Content: "You are a health check endpoint."},
+		{Role: "user", Content: "Reply with exactly: OK"},
+	})
+	st.latency = time.Since(begin)
+	switch {
+	case err != nil:
+		st.err = err
+	case strings.TrimSpace(result.Content) == "":
+		st.err = fmt.Errorf("empty reply")
+	default:
+		logResult(ctx.Logger, ctx.Storage, ctx.Config.Limits, "selftest", "", aiCfg.Model, result)
+		st.detail += fmt.Sprintf(", %d tokens", result.Usage.TotalTokens)
+	}
+	stages = append(stages, st)
+
+	// 工具：调用配置的无副作用工具（默认内置 current_time）
+	toolCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	st = selfTestStage{name: "selftest.tool", detail: cfg.SelfTest.Tool}
+	begin = time.Now()
+	content, _, err := p.toolExecutor.callTool(toolCtx, cfg.SelfTest.Tool, cfg.SelfTest.Arguments)
+	cancel()
+	st.latency = time.Since(begin)
+	if err == nil && content == "" {
+		err = fmt.Errorf("empty result")
+	}
+	st.err = err
+	stages = append(stages, st)
+
+	// MCP：对每个已连接的服务发送 ping
+	pingCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	pings := p.mcpManager.Ping(pingCtx)
+	cancel()
+	for _, name := range slices.Sorted(maps.Keys(pings)) {
+		stages = append(stages, selfTestStage{name: "selftest.mcp", detail: name, latency: pings[name].Latency, err: pings[name].Err})
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.MCPServers)) {
+		if _, ok := pings[name]; !ok {
+			stages = append(stages, selfTestStage{name: "selftest.mcp", detail: name, err: fmt.Errorf("not connected")})
+		}
+	}
+
+	// 存储：写入标记并从文件读回
+	st = selfTestStage{name: "selftest.storage"}
+	begin = time.Now()
+	st.err = ctx.Storage.SelfTest()
+	st.latency = time.Since(begin)
+	stages = append(stages, st)
+
+	return stages
+}
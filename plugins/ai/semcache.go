@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// cacheCallback 语义缓存“重新生成”按钮的回调名
+const cacheCallback = "cache_regen"
+
+// cacheKey 缓存按会话和用户区分：回答包含提问者的知识库、笔记、记忆和人设等私人信息，不能发给群里的其他人
+func cacheKey(c core.Context) string {
+	return policy.ChatKey(c) + "|" + core.UserKey(c)
+}
+
+// cacheable 只缓存没有上下文的纯文本提问：开启对话记忆且已有历史时回答依赖上下文
+func (p *AIPlugin) cacheable(s *storage.Storage, storageKey string, images []string, opts Options) bool {
+	if p.cache == nil || !opts.Cache || len(images) > 0 {
+		return false
+	}
+	return !s.GetUserProfile(storageKey).HistoryEnabled || len(p.history.Get(storageKey)) == 0
+}
+
+// cachedAnswer 命中缓存时回复缓存的回答并返回 true；否则返回问题的向量，用于保存新的回答
+func (p *AIPlugin) cachedAnswer(ctx core.Context, cfg *config.Config, s *storage.Storage, logger *slog.Logger, storageKey, question string, opts Options) (bool, []float32) {
+	embedCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	vector, err := p.cache.Embed(embedCtx, question)
+	if err != nil {
+		logger.Warn("Semantic cache embedding failed", "error", err)
+		return false, nil
+	}
+	if opts.regenerate {
+		return false, vector
+	}
+
+	key := cacheKey(ctx)
+	entry, score := p.cache.Lookup(key, vector)
+	if entry == nil {
+		return false, vector
+	}
+	logger.Info("Semantic cache hit", "key", key, "entry", entry.ID, "score", score)
+	recordAudit(logger, s, storageKey, storage.AuditEntry{Time: time.Now(), Kind: "cache"})
+
+	lang := core.UserLang(cfg, s, ctx)
+	text, rendered := p.renderReply(ctx, cfg, watermark(cfg, entry.Answer))
+	text += i18n.T(lang, "cache.note")
+	_, err = ctx.SendButtons(text, [][]core.Button{{
+		{Text: i18n.T(lang, "cache.regenerate"), Name: cacheCallback, Data: entry.ID},
+	}})
+	if errors.Is(err, core.ErrNotSupported) {
+		err = ctx.Reply(text)
+	}
+	if err != nil {
+		logger.Error("Failed to send cached answer", "error", err)
+	}
+	sendRendered(ctx, logger, rendered)
+	return true, nil
+}
+
+// handleRegenerate 丢弃缓存的回答，重新向模型提问
+func (p *AIPlugin) handleRegenerate(ctx *plugins.Context, c core.Context) error {
+	cfg := ctx.Config
+	if p.cache == nil || !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+		return nil
+	}
+	entry := p.cache.Take(cacheKey(c), c.Data())
+	if entry == nil {
+		return c.Reply(ctx.T(c, "cache.expired"))
+	}
+
+	storageKey := core.UserKey(c)
+	aiCfg := resolveAIConfig(cfg, ctx.Storage, storageKey)
+	systemPrompt, _ := chatSystemPrompt(cfg, aiCfg, ctx.Storage.GetUserProfile(storageKey), storageKey)
+	go p.handleRequest(c, cfg, ctx.Storage, ctx.Logger, systemPrompt, entry.Question, nil, Options{Cache: true, regenerate: true})
+	return nil
+}
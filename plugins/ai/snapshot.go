@@ -0,0 +1,176 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/anonymize"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// snapshotAuditEntries /snapshot 默认包含的审计记录条数
+const snapshotAuditEntries = 20
+
+// secretRegex 匹配消息中疑似密钥的内容，导出快照前替换掉
+var secretRegex = regexp.MustCompile(`(?i)(sk-[A-Za-z0-9_\-]{8,}|(?:api[_-]?key|token|secret|password)\s*[=:]\s*\S+)`)
+
+// sessionSnapshot 用户会话快照，附在问题反馈中用于排查
+type sessionSnapshot struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	User        string               `json:"user"`
+	Profile     storage.UserProfile  `json:"profile"`
+	Resolved    resolvedConfig       `json:"resolved_config"`
+	History     []ChatMessage        `json:"history"`
+	Audit       []storage.AuditEntry `json:"audit"`
+}
+
+// resolvedConfig 该用户请求实际生效的配置
+type resolvedConfig struct {
+	Provider       string   `json:"provider"`
+	BaseURL        string   `json:"base_url"`
+	Model          string   `json:"model"`
+	APIKey         string   `json:"api_key"`
+	AISource       string   `json:"ai_source"` // global / user_override
+	PromptSource   string   `json:"prompt_source"`
+	SystemPrompt   string   `json:"system_prompt"`
+	HistoryEnabled bool     `json:"history_enabled"`
+	ToolsEnabled   bool     `json:"tools_enabled"`
+	Tools          []string `json:"tools,omitempty"`
+}
+
+// buildSnapshot 汇总用户的会话状态、生效配置和最近 n 条审计记录，敏感信息已脱敏
+func (p *AIPlugin) buildSnapshot(ctx *plugins.Context, storageKey string, n int) *sessionSnapshot {
+	cfg := ctx.Config
+	s := ctx.Storage
+
+	aiCfg, aiSource := resolveAIConfig(cfg, s, storageKey), "global"
+	if s.GetUserAIConfig(storageKey) != nil {
+		aiSource = "user_override"
+	}
+	if cfg.Demo.Enabled {
+		aiSource += "+demo"
+	}
+	profile := s.GetUserProfile(storageKey)
+	systemPrompt, promptSource := chatSystemPrompt(cfg, aiCfg, profile, storageKey)
+
+	resolved := resolvedConfig{
+		Provider:       aiCfg.Provider,
+		BaseURL:        aiCfg.BaseURL,
+		Model:          aiCfg.Model,
+		APIKey:         maskSecret(aiCfg.APIKey),
+		AISource:       aiSource,
+		PromptSource:   promptSource,
+		SystemPrompt:   redact(systemPrompt),
+		HistoryEnabled: profile.HistoryEnabled,
+		ToolsEnabled:   !profile.ToolsDisabled,
+	}
+	if resolved.ToolsEnabled {
+		for _, tool := range p.toolExecutor.tools() {
+			resolved.Tools = append(resolved.Tools, tool.Function.Name)
+		}
+	}
+
+	history := p.history.Get(storageKey)
+	for i := range history {
+		history[i].Content = redact(history[i].Content)
+	}
+
+	return &sessionSnapshot{
+		GeneratedAt: time.Now(),
+		User:        storageKey,
+		Profile:     profile,
+		Resolved:    resolved,
+		History:     history,
+		Audit:       s.GetAuditEntries(storageKey, n),
+	}
+}
+
+// anonymize 替换快照中的用户 ID、@用户名和可识别身份的信息，用于公开分享
+func (snap *sessionSnapshot) anonymize(a *anonymize.Anonymizer) {
+	_, id, _ := strings.Cut(snap.User, ":")
+	snap.User = a.Key(snap.User)
+	snap.Profile.City = ""
+	snap.Profile.Timezone = ""
+	// 女朋友模式的提示词中包含称呼
+	if strings.HasPrefix(snap.Resolved.PromptSource, "girlfriend:") {
+		snap.Resolved.PromptSource = "girlfriend"
+		snap.Resolved.SystemPrompt = "[omitted]"
+	}
+	snap.Resolved.SystemPrompt = a.Text(snap.Resolved.SystemPrompt, id)
+	for i := range snap.History {
+		snap.History[i].Content = a.Text(snap.History[i].Content, id)
+	}
+	// 审计记录的错误信息可能包含发送目标等用户 ID
+	for i := range snap.Audit {
+		snap.Audit[i].Error = a.Text(snap.Audit[i].Error, id)
+	}
+}
+
+// handleSnapshot /snapshot [Platform:UserID] [N] [anon] - 管理员导出用户会话快照，anon 时匿名化
+func (p *AIPlugin) handleSnapshot(ctx *plugins.Context, c core.Context) error {
+	if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "snapshot.admin_only"))
+	}
+
+	parts := strings.Fields(c.Text())
+	storageKey := core.UserKey(c)
+	n := snapshotAuditEntries
+	anon := false
+	for _, arg := range parts[1:] {
+		if v, err := strconv.Atoi(arg); err == nil && v > 0 {
+			n = v
+		} else if arg == "anon" {
+			anon = true
+		} else {
+			storageKey = arg
+		}
+	}
+	if !strings.Contains(storageKey, ":") {
+		return c.Reply(ctx.T(c, "snapshot.usage"))
+	}
+
+	snap := p.buildSnapshot(ctx, storageKey, n)
+	if anon {
+		snap.anonymize(ctx.Anonymizer)
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return c.Reply(ctx.T(c, "snapshot.failed", err))
+	}
+	ctx.Logger.Info("Session snapshot exported", "user", storageKey, "anon", anon, "by", core.UserKey(c))
+
+	name := fmt.Sprintf("snapshot-%s-%s.json", strings.ReplaceAll(snap.User, ":", "-"), time.Now().Format("20060102-150405"))
+	err = c.SendFile(&core.File{
+		Name:     name,
+		MIMEType: "application/json",
+		Data:     data,
+		Caption:  ctx.T(c, "snapshot.caption", snap.User),
+	})
+	if errors.Is(err, core.ErrNotSupported) {
+		// 平台不支持发送文件时直接以文本发送
+		return c.Reply(string(data))
+	}
+	return err
+}
+
+// maskSecret 只保留密钥末尾 4 位
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+func redact(text string) string {
+	return secretRegex.ReplaceAllString(text, "[REDACTED]")
+}
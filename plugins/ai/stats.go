@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// aiCalls、aiErrors 进程启动以来的模型请求数和失败数
+var aiCalls, aiErrors atomic.Int64
+
+// recordAICall 在 /stats 的模型请求统计中记录一次请求
+func recordAICall(err error) {
+	aiCalls.Add(1)
+	if err != nil {
+		aiErrors.Add(1)
+	}
+}
+
+// runtimeReport 运行时间、goroutine、内存、各平台的消息数、模型请求数和 MCP 服务状态
+func (p *AIPlugin) runtimeReport(ctx *plugins.Context, c core.Context) string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "stats.header") + "\n")
+	b.WriteString(ctx.T(c, "stats.uptime", ctx.Stats.Uptime().Round(time.Second)) + "\n")
+	b.WriteString(ctx.T(c, "stats.runtime", runtime.NumGoroutine(), float64(mem.Alloc)/(1<<20), float64(mem.Sys)/(1<<20), mem.NumGC) + "\n")
+
+	platforms := ctx.Stats.Platforms()
+	if len(platforms) == 0 {
+		b.WriteString(ctx.T(c, "stats.no_messages") + "\n")
+	} else {
+		b.WriteString(ctx.T(c, "stats.messages") + "\n")
+		for _, name := range slices.Sorted(maps.Keys(platforms)) {
+			counter := platforms[name]
+			b.WriteString(ctx.T(c, "stats.platform", name, counter.Messages, counter.Errors) + "\n")
+		}
+	}
+	b.WriteString(ctx.T(c, "stats.ai", aiCalls.Load(), aiErrors.Load()) + "\n")
+
+	if statuses := p.mcpManager.Status(); len(statuses) > 0 {
+		connected := 0
+		var servers []string
+		for _, status := range statuses {
+			switch {
+			case status.Connected:
+				connected++
+				servers = append(servers, "✅ "+status.Name)
+			case status.Err != nil:
+				servers = append(servers, "❌ "+status.Name)
+			default:
+				servers = append(servers, "⏳ "+status.Name)
+			}
+		}
+		b.WriteString(ctx.T(c, "stats.mcp", connected, len(statuses), strings.Join(servers, ", ")) + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// ResponseFormat 请求的 response_format：json_schema 按 Schema 输出，json_object 只保证输出合法的 JSON
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema 结构化输出的 Schema
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"`
+}
+
+// SchemaOf 根据 v 的类型生成严格模式的 JSON Schema：字段名取 json 标签，desc 标签作为字段说明。
+// 严格模式下所有字段都是必填的，可选的字段应能接受空字符串、0 或空数组
+func SchemaOf(v any) (json.RawMessage, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, errors.New("schema of nil")
+	}
+	schema, err := schemaOf(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
+func schemaOf(t reflect.Type) (map[string]any, error) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := []string{}
+		if err := structFields(t, properties, &required); err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}, nil
+	}
+	// 严格模式不支持 map 这类任意键的对象
+	return nil, fmt.Errorf("unsupported type in schema: %s", t)
+}
+
+// structFields 收集结构体的字段，匿名嵌入的结构体展开到同一层
+func structFields(t reflect.Type, properties map[string]any, required *[]string) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			if err := structFields(f.Type, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema, err := schemaOf(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if desc := f.Tag.Get("desc"); desc != "" {
+			schema["description"] = desc
+		}
+		properties[name] = schema
+		*required = append(*required, name)
+	}
+	return nil
+}
+
+// GenerateStructured asks the model for a JSON reply matching the schema of v and decodes it into v.
+// name identifies the schema (letters, digits, _ and -). APIs that reject json_schema (status 400)
+// are retried with json_object, then without response_format, with the schema in the system prompt
+func GenerateStructured(aiCfg config.AIConfig, messages []ChatMessage, name string, v any) (*Completion, error) {
+	schema, err := SchemaOf(v)
+	if err != nil {
+		return nil, err
+	}
+
+	req := newChatRequest(aiCfg, messages, nil)
+	formats := []*ResponseFormat{
+		{Type: "json_schema", JSONSchema: &JSONSchema{Name: name, Schema: schema, Strict: true}},
+		{Type: "json_object"},
+		nil,
+	}
+	var completion *Completion
+	for i, format := range formats {
+		if i == 1 {
+			req.Messages = withSchemaPrompt(messages, schema)
+		}
+		req.ResponseFormat = format
+		completion, err = completeRequest(context.Background(), aiCfg, req)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeJSON(completion.Message.Content, v); err != nil {
+		return completion, fmt.Errorf("invalid structured reply: %w", err)
+	}
+	return completion, nil
+}
+
+// withSchemaPrompt 在系统提示词中附上 Schema，供不支持 json_schema 的模型参考
+func withSchemaPrompt(messages []ChatMessage, schema json.RawMessage) []ChatMessage {
+	instruction := "只输出符合以下 JSON Schema 的 JSON，不要输出其他内容：\n" + string(schema)
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages = append([]ChatMessage(nil), messages...)
+		messages[0].Content += "\n\n" + instruction
+		return messages
+	}
+	return append([]ChatMessage{{Role: "system", Content: instruction}}, messages...)
+}
+
+// decodeJSON 解析模型输出的 JSON，模型可能在 JSON 外包裹代码块或说明文字
+func decodeJSON(content string, v any) error {
+	content = strings.TrimSpace(content)
+	err := json.Unmarshal([]byte(content), v)
+	if err == nil {
+		return nil
+	}
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return err
+	}
+	return json.Unmarshal([]byte(content[start:end+1]), v)
+}
+
+// GenerateStructured 与 Generate 相同，但要求模型按 v（结构体指针）的结构输出 JSON 并解析到 v
+func (p *AIPlugin) GenerateStructured(ctx *plugins.Context, kind, systemPrompt, prompt string, v any) error {
+	aiCfg := ctx.Config.AI
+	start := time.Now()
+	completion, err := GenerateStructured(aiCfg, []ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: prompt},
+	}, kind, v)
+	if completion != nil {
+		logResult(ctx.Logger, ctx.Storage, ctx.Config.Limits, kind, "", aiCfg.Model, &ExecutionResult{
+			Content:   completion.Message.Content,
+			Usage:     completion.Usage,
+			Duration:  time.Since(start),
+			Truncated: completion.FinishReason == "length",
+			Reasoning: completion.Reasoning,
+		})
+	}
+	return err
+}
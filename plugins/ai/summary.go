@@ -0,0 +1,161 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const (
+	// summaryPeriod 每日总结覆盖的时间段
+	summaryPeriod = 24 * time.Hour
+	// maxSummaryLine 交给模型的每条消息最多保留的字数
+	maxSummaryLine = 300
+)
+
+// summarizeChat 总结会话最近 24 小时的消息（只包括成员发送的消息，不包括指令和机器人的回复），
+// 消息少于 minMessages 条时返回空字符串。userKey 为空时不计入用户的用量，消息时间按 loc 显示
+func (p *AIPlugin) summarizeChat(ctx *plugins.Context, chatKey, userKey, lang string, minMessages int, loc *time.Location) (string, error) {
+	cfg := ctx.Config
+	since := time.Now().Add(-summaryPeriod)
+	var lines []string
+	for _, m := range ctx.Storage.GetMessageLog(chatKey, 0) {
+		text := strings.TrimSpace(m.Text)
+		if m.Direction != storage.DirectionIn || m.Time.Before(since) || text == "" || strings.HasPrefix(text, "/") {
+			continue
+		}
+		name := m.Username
+		if name == "" {
+			name = m.UserID
+		}
+		lines = append(lines, m.Time.In(loc).Format("15:04")+" "+name+": "+truncateRunes(strings.ReplaceAll(text, "\n", " "), maxSummaryLine))
+	}
+	if len(lines) < max(minMessages, 1) {
+		return "", nil
+	}
+	lines = lines[max(0, len(lines)-cfg.Summary.MaxMessages):]
+
+	aiCfg := cfg.AI
+	result, err := p.toolExecutor.ExecuteWithoutTools(aiCfg, []ChatMessage{
+		{Role: "system", Content: cfg.Summary.Prompt + "\n\nReply in " + i18n.Name(lang) + "." + policy.Prompt(ctx.Storage.GetBannedTopics(chatKey))},
+		{Role: "user", Content: "群聊记录：\n" + strings.Join(lines, "\n")},
+	})
+	if err != nil {
+		return "", err
+	}
+	logResult(ctx.Logger, ctx.Storage, cfg.Limits, "summary", userKey, aiCfg.Model, result)
+	if result.Content == "" {
+		return "", errors.New("summary empty")
+	}
+	return i18n.T(lang, "summary.title", len(lines), result.Content), nil
+}
+
+// executeSummary 为开启了每日总结的群发送总结，由调度器的 summary 任务执行
+func (p *AIPlugin) executeSummary(ctx *plugins.Context) error {
+	var errs []error
+	for _, chatKey := range ctx.Storage.MessageLogChats() {
+		target := ctx.Storage.GetGroupSettings(chatKey).SummaryTarget
+		if target == "" {
+			continue
+		}
+		content, err := p.summarizeChat(ctx, chatKey, "", ctx.Config.Bot.Language, ctx.Config.Summary.MinMessages, time.Local)
+		if err != nil {
+			ctx.Logger.Error("Summary generation error", "chat", chatKey, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", chatKey, err))
+			continue
+		}
+		if content == "" {
+			ctx.Logger.Info("Too few messages for a daily summary", "chat", chatKey)
+			continue
+		}
+		errs = append(errs, p.sendPush(ctx, []string{target}, content))
+	}
+	return errors.Join(errs...)
+}
+
+// summaryCommand /summary 查看本群的每日总结设置，群管理员可以开关；/summary now 立即总结最近 24 小时的消息
+func (p *AIPlugin) summaryCommand(ctx *plugins.Context) *core.Command {
+	cfg := ctx.Config
+	groupOnly := func(h func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if c.Chat().Type == "private" {
+				return c.Reply(ctx.T(c, "settings.group_only"))
+			}
+			return h(c, args)
+		}
+	}
+	// update 群管理员开关，开启时记录本群的推送目标
+	update := func(name string, enable bool) *core.Command {
+		return &core.Command{Name: name, Handler: groupOnly(func(c core.Context, _ core.Args) error {
+			if !ctx.CanManageChat(c) {
+				return c.Reply(ctx.T(c, "settings.admin_only"))
+			}
+			target := ""
+			if enable {
+				var err error
+				if target, err = policy.PushTarget(c); err != nil {
+					return c.Reply(ctx.T(c, "push.no_target"))
+				}
+			}
+			chatKey := policy.ChatKey(c)
+			if err := ctx.Storage.UpdateGroupSettings(chatKey, func(g *storage.GroupSettings) {
+				g.SummaryTarget = target
+			}); err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			ctx.Logger.Info("Daily summary updated", "chat", chatKey, "enabled", enable, "by", core.UserKey(c))
+			if enable {
+				return c.Reply(ctx.T(c, "summary.enabled", cfg.Summary.Time))
+			}
+			return c.Reply(ctx.T(c, "summary.disabled"))
+		})}
+	}
+
+	return &core.Command{
+		Name:        "/summary",
+		Description: "每日群聊总结",
+		Handler: groupOnly(func(c core.Context, _ core.Args) error {
+			status := ctx.T(c, "common.off")
+			if ctx.Storage.GetGroupSettings(policy.ChatKey(c)).SummaryTarget != "" {
+				status = ctx.T(c, "common.on")
+			}
+			return c.Reply(ctx.T(c, "summary.show", status, cfg.Summary.Time))
+		}),
+		Subcommands: []*core.Command{
+			update("on", true),
+			update("off", false),
+			{Name: "now", Handler: groupOnly(func(c core.Context, _ core.Args) error {
+				if msg, exceeded := quotaExceeded(cfg, ctx.Storage, c); exceeded {
+					return replyQuotaExceeded(cfg, c, msg)
+				}
+				go func() {
+					logger := core.Logger(c, ctx.Logger)
+					reply, err := acknowledge(c, cfg.Bot.AckReaction, ctx.T(c, "summary.pending"))
+					if err != nil {
+						logger.Error("Failed to send message", "error", err)
+						return
+					}
+					content, err := p.summarizeChat(ctx, policy.ChatKey(c), core.UserKey(c), ctx.Lang(c), 1, ctx.Location(c))
+					switch {
+					case err != nil:
+						logger.Error("Summary generation error", "error", err)
+						content = ctx.T(c, "summary.failed", err)
+					case content == "":
+						content = ctx.T(c, "summary.empty")
+					}
+					if err := reply.Done(content); err != nil {
+						logger.Error("Failed to send reply", "error", err)
+					}
+				}()
+				return nil
+			})},
+		},
+	}
+}
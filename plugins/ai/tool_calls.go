@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// defaultToolCallLogs /toolcalls 默认显示的条数
+const defaultToolCallLogs = 10
+
+// toolCallsCommand /toolcalls [Platform:UserID|工具名] [N] - 管理员查看模型最近执行的工具调用
+func (p *AIPlugin) toolCallsCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{
+		Name:        "/toolcalls",
+		Description: "查看模型执行的工具调用记录（管理员）",
+		ArgsUsage:   "[平台:用户ID|工具名] [条数]",
+		Admin:       true,
+		Args:        rawArgs,
+		Handler: func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "toolcalls.admin_only"))
+			}
+			n := defaultToolCallLogs
+			var filter string
+			for _, arg := range strings.Fields(args["参数"]) {
+				if v, err := strconv.Atoi(arg); err == nil && v > 0 {
+					n = v
+				} else {
+					filter = arg
+				}
+			}
+			var match func(storage.ToolCallLog) bool
+			if filter != "" {
+				match = func(l storage.ToolCallLog) bool { return l.User == filter || l.Tool == filter }
+			}
+
+			logs := ctx.Storage.GetToolCallLogs(n, match)
+			if len(logs) == 0 {
+				return c.Reply(ctx.T(c, "toolcalls.empty"))
+			}
+			var b strings.Builder
+			b.WriteString(ctx.T(c, "toolcalls.header", len(logs)) + "\n")
+			loc := ctx.Location(c)
+			for _, l := range logs {
+				status := "✅"
+				if l.Error != "" {
+					status = "❌"
+				}
+				b.WriteString("\n" + ctx.T(c, "toolcalls.item", status, l.Time.In(loc).Format("01-02 15:04:05"), l.Tool, l.User, l.Duration.Round(time.Millisecond)) + "\n")
+				b.WriteString(ctx.T(c, "toolcalls.arguments", truncateRunes(redact(l.Arguments), 200)) + "\n")
+				if l.Error != "" {
+					b.WriteString(ctx.T(c, "toolcalls.error", truncateRunes(l.Error, 200)) + "\n")
+				} else if l.Result != "" {
+					b.WriteString(ctx.T(c, "toolcalls.result", truncateRunes(strings.Join(strings.Fields(redact(l.Result)), " "), 100)) + "\n")
+				}
+			}
+			return c.Reply(strings.TrimRight(b.String(), "\n"))
+		},
+	}
+}
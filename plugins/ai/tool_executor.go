@@ -1,94 +1,234 @@
 package ai
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-
 	"log/slog"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ToolExecutor handles AI tool calling loops
 type ToolExecutor struct {
-	manager *MCPManager
-	logger  *slog.Logger
+	manager  *MCPManager
+	registry *ToolRegistry
+	logger   *slog.Logger
+
+	// allowTool filters the tools offered to the model, nil allows all
+	allowTool func(name string) bool
+	// needsConfirm reports whether a tool (of the given MCP server, empty for native tools) must be confirmed
+	needsConfirm func(server, name string) bool
+	// responseCache 缓存 Options.ResponseCache 请求的模型结果，nil 表示不缓存
+	responseCache *storage.Storage
+	cacheTTL      time.Duration
+	// toolOutput 过长工具结果的处理方式，MaxLength 为 0 时不限制
+	toolOutput config.ToolOutputConfig
+	// toolLoop 工具调用循环的轮数和重复调用限制
+	toolLoop config.ToolLoopConfig
 }
 
-// NewToolExecutor creates a new tool executor
-func NewToolExecutor(manager *MCPManager, logger *slog.Logger) *ToolExecutor {
+// NewToolExecutor creates a new tool executor using MCP tools and the native tools of registry
+func NewToolExecutor(manager *MCPManager, registry *ToolRegistry, logger *slog.Logger) *ToolExecutor {
 	return &ToolExecutor{
-		manager: manager,
-		logger:  logger,
+		manager:  manager,
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+// SetToolFilter restricts the tools the model may see and call
+func (e *ToolExecutor) SetToolFilter(allow func(name string) bool) {
+	e.allowTool = allow
+}
+
+// SetResponseCache caches the completions of requests with Options.ResponseCache in store for ttl
+func (e *ToolExecutor) SetResponseCache(store *storage.Storage, ttl time.Duration) {
+	if ttl > 0 {
+		e.responseCache, e.cacheTTL = store, ttl
+	}
+}
+
+// SetConfirmPolicy sets which tools require the user's confirmation before running
+func (e *ToolExecutor) SetConfirmPolicy(needsConfirm func(server, name string) bool) {
+	e.needsConfirm = needsConfirm
+}
+
+// requiresConfirmation reports whether the tool must be confirmed before running
+func (e *ToolExecutor) requiresConfirmation(name string) bool {
+	if e.needsConfirm == nil {
+		return false
 	}
+	if _, ok := e.registry.Get(name); ok {
+		return e.needsConfirm("", name)
+	}
+	server, original, ok := e.manager.ToolServer(name)
+	if !ok {
+		return e.needsConfirm("", name)
+	}
+	// 带前缀的工具按提供给模型的名称和服务端的名称都检查一次
+	return e.needsConfirm(server, name) || e.needsConfirm(server, original)
 }
 
+// tools returns the native and MCP tools after filtering.
+// Native tools shadow MCP tools with the same name.
+func (e *ToolExecutor) tools() []ToolDefinition {
+	tools := e.registry.Definitions()
+	for _, tool := range e.manager.GetTools() {
+		if _, ok := e.registry.Get(tool.Function.Name); ok {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	if e.allowTool == nil {
+		return tools
+	}
+	allowed := make([]ToolDefinition, 0, len(tools))
+	for _, tool := range tools {
+		if e.allowTool(tool.Function.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
+
+// ExecutionResult is the outcome of an AI conversation with tools
+type ExecutionResult struct {
+	Content   string           // Final reply text
+	Files     []*core.File     // Files produced by tools
+	ToolCalls []ToolCallRecord // Tools called, in order
+	Usage     Usage            // Tokens used across all generations
+	Duration  time.Duration
+	Truncated bool     // The loop hit maxIterations or the reply was cut off by the token limit
+	Sources   []string // URLs found in tool results
+	RequestID string   // Set by the caller to link audit entries and feedback
+	Reasoning string   // 推理模型生成最终回复时的思考过程
+	Looped    bool     // 模型以相同的参数重复调用工具，提前结束了循环
+}
+
+// ToolCallRecord describes one executed tool call
+type ToolCallRecord struct {
+	Name      string
+	Arguments string
+	Duration  time.Duration
+	Result    string // 结果的开头，用于工具调用记录
+	Err       error
+}
+
+// maxToolCallResult 工具调用记录中保留的结果字符数
+const maxToolCallResult = 500
+
+// sourceRegex matches URLs in tool results
+var sourceRegex = regexp.MustCompile(`https?://[^\s"'<>\]\)]+`)
+
 // ExecuteWithTools executes an AI conversation with tool support
-// Returns the final response content or an error
 // platformPrompt is applied only to the final response (not during tool calls)
 func (e *ToolExecutor) ExecuteWithTools(
 	ctx context.Context,
 	aiCfg config.AIConfig,
 	initialMessages []ChatMessage,
-	maxIterations int,
 	platformPrompt string,
-) (string, error) {
+) (*ExecutionResult, error) {
+	return e.Execute(ctx, aiCfg, initialMessages, platformPrompt, Options{})
+}
+
+// Execute is ExecuteWithTools with per-call options. aiCfg should already have opts applied,
+// only the tool subset of opts is used here.
+// The loop ends after tool_loop.max_iterations generations, or early when the model repeats a tool call
+func (e *ToolExecutor) Execute(
+	ctx context.Context,
+	aiCfg config.AIConfig,
+	initialMessages []ChatMessage,
+	platformPrompt string,
+	opts Options,
+) (*ExecutionResult, error) {
+	logger := core.ContextLogger(ctx, e.logger)
+	maxIterations := e.toolLoop.MaxIterations
 	if maxIterations <= 0 {
-		maxIterations = 5
+		maxIterations = 10
 	}
 
+	ctx, span := tracer.Start(ctx, "execute", trace.WithAttributes(attribute.String("gen_ai.request.model", aiCfg.Model)))
+	start := time.Now()
+	result := &ExecutionResult{}
+	defer func() {
+		result.Duration = time.Since(start)
+		span.SetAttributes(
+			attribute.Int("ggbot.tool_calls", len(result.ToolCalls)),
+			attribute.Int("gen_ai.usage.total_tokens", result.Usage.TotalTokens),
+			attribute.Bool("ggbot.looped", result.Looped),
+		)
+		span.End()
+	}()
+
 	messages := make([]ChatMessage, len(initialMessages))
 	copy(messages, initialMessages)
 
-	tools := e.manager.GetTools()
+	// mcp_connect 为 lazy 时首次使用工具才连接 MCP 服务
+	if opts.Tools == nil || len(opts.Tools) > 0 {
+		e.manager.ConnectOnUse()
+	}
+
+	var tools []ToolDefinition
+	for _, tool := range e.tools() {
+		if opts.allowTool(tool.Function.Name) {
+			tools = append(tools, tool)
+		}
+	}
 
+	// 工具名和参数 → 调用次数
+	calls := make(map[string]int)
 	for i := 0; i < maxIterations; i++ {
-		e.logger.Debug("AI generation iteration", "iteration", i)
+		logger.Debug("AI generation iteration", "iteration", i)
 
 		// Generate response
-		respMsg, err := Generate(aiCfg.BaseURL, aiCfg.APIKey, aiCfg.Model, messages, tools)
+		completion, err := e.complete(ctx, aiCfg, messages, tools, opts)
 		if err != nil {
-			return "", fmt.Errorf("generation error at iteration %d: %w", i, err)
+			return nil, fmt.Errorf("generation error at iteration %d: %w", i, err)
 		}
+		result.Usage.Add(completion.Usage)
+		respMsg := &completion.Message
 
 		messages = append(messages, *respMsg)
 
 		// Check for tool calls
 		if len(respMsg.ToolCalls) == 0 {
-			// Final response - apply platform-specific prompt if provided
-			finalContent := respMsg.Content
-
-			if platformPrompt != "" && finalContent != "" {
-				e.logger.Debug("Applying platform prompt for final response")
-
-				// Create a new message with platform-specific instructions
-				finalMessages := []ChatMessage{
-					{Role: "user", Content: fmt.Sprintf("%s\n\n请按照以下要求重新组织你的回复：%s", finalContent, platformPrompt)},
-				}
-
-				// Generate final polished response
-				finalResp, err := Generate(aiCfg.BaseURL, aiCfg.APIKey, aiCfg.Model, finalMessages, nil)
-				if err != nil {
-					e.logger.Warn("Failed to apply platform prompt, using original response", "error", err)
-					return finalContent, nil
-				}
-
-				return finalResp.Content, nil
-			}
+			result.Truncated = completion.FinishReason == "length"
+			result.Reasoning = completion.Reasoning
+			result.Content = e.applyPlatformPrompt(ctx, aiCfg, respMsg.Content, platformPrompt, result)
+			return result, nil
+		}
 
-			return finalContent, nil
+		if call, looped := e.repeatedCall(respMsg.ToolCalls, calls); looped {
+			// 去掉重复的调用，基于已有的结果回复
+			logger.Warn("Tool call loop detected, generating final response", "tool", call.Function.Name, "arguments", call.Function.Arguments)
+			messages = messages[:len(messages)-1]
+			result.Looped = true
+			break
 		}
 
 		// Execute tool calls
-		if err := e.executeToolCalls(ctx, respMsg.ToolCalls, &messages); err != nil {
-			e.logger.Error("Tool execution failed", "error", err)
-			return "", err
+		if err := e.executeToolCalls(ctx, aiCfg, respMsg.ToolCalls, &messages, result, opts); err != nil {
+			logger.Error("Tool execution failed", "error", err)
+			return nil, err
 		}
 	}
 
-	// Exceeded max iterations - force final response based on current information
-	e.logger.Warn("Exceeded maximum iterations, generating final response based on current information", "max_iterations", maxIterations)
+	// Exceeded max iterations or looped - force final response based on current information
+	if !result.Looped {
+		logger.Warn("Exceeded maximum iterations, generating final response based on current information", "max_iterations", maxIterations)
+	}
+	result.Truncated = true
 
 	// Add a message asking AI to summarize based on what it has so far
 	messages = append(messages, ChatMessage{
@@ -97,43 +237,155 @@ func (e *ToolExecutor) ExecuteWithTools(
 	})
 
 	// Generate final response without tools
-	finalResp, err := Generate(aiCfg.BaseURL, aiCfg.APIKey, aiCfg.Model, messages, nil)
+	finalResp, err := e.complete(ctx, aiCfg, messages, nil, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate final response after max iterations: %w", err)
+		return nil, fmt.Errorf("failed to generate final response after tool calls: %w", err)
 	}
+	result.Usage.Add(finalResp.Usage)
+	result.Reasoning = finalResp.Reasoning
 
-	finalContent := finalResp.Content
+	result.Content = e.applyPlatformPrompt(ctx, aiCfg, finalResp.Message.Content, platformPrompt, result)
+	return result, nil
+}
 
-	// Apply platform-specific prompt if provided
-	if platformPrompt != "" && finalContent != "" {
-		e.logger.Debug("Applying platform prompt for final response")
+// ExecuteWithoutTools runs a single generation without exposing any tools
+func (e *ToolExecutor) ExecuteWithoutTools(aiCfg config.AIConfig, messages []ChatMessage) (*ExecutionResult, error) {
+	return e.ExecuteWithoutToolsContext(context.Background(), aiCfg, messages)
+}
 
-		finalMessages := []ChatMessage{
-			{Role: "user", Content: fmt.Sprintf("%s\n\n请按照以下要求重新组织你的回复：%s", finalContent, platformPrompt)},
+// ExecuteWithoutToolsContext is ExecuteWithoutTools with a context, cancelling ctx aborts the request
+func (e *ToolExecutor) ExecuteWithoutToolsContext(ctx context.Context, aiCfg config.AIConfig, messages []ChatMessage) (*ExecutionResult, error) {
+	start := time.Now()
+	completion, err := CompleteContext(ctx, aiCfg, messages, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecutionResult{
+		Content:   completion.Message.Content,
+		Usage:     completion.Usage,
+		Duration:  time.Since(start),
+		Truncated: completion.FinishReason == "length",
+		Reasoning: completion.Reasoning,
+	}, nil
+}
+
+// complete calls Complete. With opts.ResponseCache an identical request (model, messages, tools and
+// parameters) within the cache TTL returns the previous completion without calling the API
+func (e *ToolExecutor) complete(ctx context.Context, aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition, opts Options) (*Completion, error) {
+	logger := core.ContextLogger(ctx, e.logger)
+	if !opts.ResponseCache || e.responseCache == nil {
+		return CompleteContext(ctx, aiCfg, messages, tools)
+	}
+	key, err := responseCacheKey(aiCfg, messages, tools)
+	if err != nil {
+		return CompleteContext(ctx, aiCfg, messages, tools)
+	}
+	if cached, ok := e.responseCache.Get(key); ok {
+		var completion Completion
+		if err := json.Unmarshal([]byte(cached), &completion); err == nil {
+			logger.Debug("Response cache hit", "model", aiCfg.Model)
+			completion.Usage = Usage{} // 命中缓存不消耗 token
+			return &completion, nil
 		}
+	}
 
-		polishedResp, err := Generate(aiCfg.BaseURL, aiCfg.APIKey, aiCfg.Model, finalMessages, nil)
-		if err != nil {
-			e.logger.Warn("Failed to apply platform prompt, using original response", "error", err)
-			return finalContent, nil
+	completion, err := CompleteContext(ctx, aiCfg, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(completion); err == nil {
+		if err := e.responseCache.SetWithTTL(key, string(data), e.cacheTTL); err != nil {
+			logger.Warn("Failed to cache response", "error", err)
 		}
+	}
+	return completion, nil
+}
+
+// responseCacheKey 请求内容的哈希，API Key 不影响结果，不参与计算
+func responseCacheKey(aiCfg config.AIConfig, messages []ChatMessage, tools []ToolDefinition) (string, error) {
+	data, err := json.Marshal(newChatRequest(aiCfg, messages, tools))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(aiCfg.BaseURL+"\n"), data...))
+	return "llm:" + hex.EncodeToString(sum[:]), nil
+}
+
+// applyPlatformPrompt rewrites the final reply according to platform-specific instructions
+func (e *ToolExecutor) applyPlatformPrompt(ctx context.Context, aiCfg config.AIConfig, content, platformPrompt string, result *ExecutionResult) string {
+	logger := core.ContextLogger(ctx, e.logger)
+	if platformPrompt == "" || content == "" {
+		return content
+	}
 
-		return polishedResp.Content, nil
+	logger.Debug("Applying platform prompt for final response")
+
+	// Create a new message with platform-specific instructions
+	finalMessages := []ChatMessage{
+		{Role: "user", Content: fmt.Sprintf("%s\n\n请按照以下要求重新组织你的回复：%s", content, platformPrompt)},
+	}
+
+	// Generate final polished response
+	polished, err := CompleteContext(ctx, aiCfg, finalMessages, nil)
+	if err != nil {
+		logger.Warn("Failed to apply platform prompt, using original response", "error", err)
+		return content
+	}
+	result.Usage.Add(polished.Usage)
+
+	return polished.Message.Content
+}
+
+// SetToolLoopLimits sets the maximum number of generations and repeated tool calls of Execute
+func (e *ToolExecutor) SetToolLoopLimits(cfg config.ToolLoopConfig) {
+	e.toolLoop = cfg
+}
+
+// repeatedCall 记录本轮的工具调用，返回以相同参数调用次数超过 max_repeats 的调用
+func (e *ToolExecutor) repeatedCall(toolCalls []ToolCall, calls map[string]int) (ToolCall, bool) {
+	maxRepeats := e.toolLoop.MaxRepeats
+	if maxRepeats <= 0 {
+		maxRepeats = 2
+	}
+	for _, call := range toolCalls {
+		key := call.Function.Name + "\x00" + compactJSON(call.Function.Arguments)
+		calls[key]++
+		if calls[key] > maxRepeats {
+			return call, true
+		}
 	}
+	return ToolCall{}, false
+}
 
-	return finalContent, nil
+// compactJSON 去掉 JSON 中的空白，使格式不同的相同参数能够比较，无法解析时原样返回
+func compactJSON(s string) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(s)); err != nil {
+		return s
+	}
+	return b.String()
 }
 
 // executeToolCalls executes all tool calls and appends results to messages
+// Calls, files and sources are recorded in result
 func (e *ToolExecutor) executeToolCalls(
 	ctx context.Context,
+	aiCfg config.AIConfig,
 	toolCalls []ToolCall,
 	messages *[]ChatMessage,
+	result *ExecutionResult,
+	opts Options,
 ) error {
+	logger := core.ContextLogger(ctx, e.logger)
 	for _, call := range toolCalls {
 		// Parse arguments
 		var args map[string]interface{}
 		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Err:       err,
+			})
 			*messages = append(*messages, ChatMessage{
 				Role:       "tool",
 				ToolCallID: call.ID,
@@ -142,16 +394,60 @@ func (e *ToolExecutor) executeToolCalls(
 			continue
 		}
 
-		e.logger.Info("Executing tool", "tool", call.Function.Name, "id", call.ID)
+		if (e.allowTool != nil && !e.allowTool(call.Function.Name)) || !opts.allowTool(call.Function.Name) {
+			logger.Warn("Model called a disabled tool", "tool", call.Function.Name)
+			result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Err:       fmt.Errorf("tool %s is disabled", call.Function.Name),
+			})
+			*messages = append(*messages, ChatMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    "Error: this tool is disabled",
+			})
+			continue
+		}
+
+		if e.requiresConfirmation(call.Function.Name) {
+			if opts.Confirm == nil || !opts.Confirm(ctx, call.Function.Name, call.Function.Arguments) {
+				logger.Info("Tool call declined", "tool", call.Function.Name)
+				result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+					Err:       fmt.Errorf("tool %s was not confirmed", call.Function.Name),
+				})
+				*messages = append(*messages, ChatMessage{
+					Role:       "tool",
+					ToolCallID: call.ID,
+					Content:    "Error: the user did not confirm running this tool. Do not retry it; answer without it.",
+				})
+				continue
+			}
+		}
+
+		logger.Info("Executing tool", "tool", call.Function.Name, "id", call.ID)
 
 		// Execute tool
-		contentStr, err := e.manager.CallTool(ctx, call.Function.Name, args)
+		callStart := time.Now()
+		contentStr, toolFiles, err := e.traceTool(ctx, call.Function.Name, args)
+		result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+			Duration:  time.Since(callStart),
+			Err:       err,
+		})
+		result.Files = append(result.Files, toolFiles...)
 		if err != nil {
 			contentStr = fmt.Sprintf("Error executing tool: %v", err)
-			e.logger.Error("Tool execution error", "tool", call.Function.Name, "error", err)
+			logger.Error("Tool execution error", "tool", call.Function.Name, "error", err)
+		} else {
+			result.addSources(contentStr)
+			contentStr = e.limitToolOutput(ctx, aiCfg, call, contentStr, result)
+			result.ToolCalls[len(result.ToolCalls)-1].Result = truncateRunes(contentStr, maxToolCallResult)
 		}
 
-		e.logger.Debug("Tool execution result", "tool", call.Function.Name, "length", len(contentStr))
+		logger.Debug("Tool execution result", "tool", call.Function.Name, "length", len(contentStr))
 
 		// Append result
 		*messages = append(*messages, ChatMessage{
@@ -164,6 +460,39 @@ func (e *ToolExecutor) executeToolCalls(
 	return nil
 }
 
+// traceTool 调用工具并记录为 span，MCP 工具带上服务名
+func (e *ToolExecutor) traceTool(ctx context.Context, name string, args map[string]interface{}) (string, []*core.File, error) {
+	ctx, span := tracer.Start(ctx, "execute_tool "+name, trace.WithAttributes(
+		attribute.String("gen_ai.operation.name", "execute_tool"),
+		attribute.String("gen_ai.tool.name", name),
+	))
+	if server, _, ok := e.manager.ToolServer(name); ok {
+		span.SetAttributes(attribute.String("ggbot.mcp.server", server))
+	}
+	content, files, err := e.callTool(ctx, name, args)
+	span.SetAttributes(attribute.Int("ggbot.tool.result_length", len(content)))
+	endSpan(span, err)
+	return content, files, err
+}
+
+// callTool runs a native tool or forwards the call to the MCP server that provides it
+func (e *ToolExecutor) callTool(ctx context.Context, name string, args map[string]interface{}) (string, []*core.File, error) {
+	if tool, ok := e.registry.Get(name); ok {
+		content, err := tool.Handler(ctx, args)
+		return content, nil, err
+	}
+	return e.manager.CallTool(ctx, name, args)
+}
+
+// addSources records the distinct URLs mentioned in a tool result
+func (r *ExecutionResult) addSources(text string) {
+	for _, url := range sourceRegex.FindAllString(text, -1) {
+		if !slices.Contains(r.Sources, url) {
+			r.Sources = append(r.Sources, url)
+		}
+	}
+}
+
 // marshalSchema safely marshals a tool schema
 func marshalSchema(schema interface{}) (json.RawMessage, error) {
 	if schema == nil {
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// maxSummaryInput 交给总结模型的工具结果最多字符数，超出部分先截断
+const maxSummaryInput = 100000
+
+// SetToolOutputLimit sets how tool results longer than cfg.MaxLength are shortened
+func (e *ToolExecutor) SetToolOutputLimit(cfg config.ToolOutputConfig) {
+	e.toolOutput = cfg
+}
+
+// limitToolOutput 工具结果超过 max_length 时截断，或在 summarize 模式下用模型总结，总结失败时截断
+func (e *ToolExecutor) limitToolOutput(ctx context.Context, aiCfg config.AIConfig, call ToolCall, content string, result *ExecutionResult) string {
+	logger := core.ContextLogger(ctx, e.logger)
+	limit := e.toolOutput.MaxLength
+	length := len([]rune(content))
+	if limit <= 0 || length <= limit {
+		return content
+	}
+	if e.toolOutput.Mode == "summarize" {
+		summary, err := e.summarizeToolOutput(ctx, aiCfg, call, content, result)
+		if err == nil {
+			logger.Info("Summarized tool output", "tool", call.Function.Name, "length", length, "summary", len([]rune(summary)))
+			return summary
+		}
+		logger.Warn("Failed to summarize tool output, truncating", "tool", call.Function.Name, "error", err)
+	}
+	logger.Info("Truncated tool output", "tool", call.Function.Name, "length", length, "max_length", limit)
+	return truncateRunes(content, limit) + fmt.Sprintf("\n\n[结果过长，已省略后面的 %d 个字符]", length-limit)
+}
+
+// summarizeToolOutput 让模型按调用目的总结工具结果，使用的 token 计入 result
+func (e *ToolExecutor) summarizeToolOutput(ctx context.Context, aiCfg config.AIConfig, call ToolCall, content string, result *ExecutionResult) (string, error) {
+	if e.toolOutput.Model != "" {
+		aiCfg.Model = e.toolOutput.Model
+	}
+	aiCfg.GenerationParams = config.GenerationParams{}
+	prompt := fmt.Sprintf("以下是工具 %s 的返回结果，调用参数为 %s。请在 %d 字以内总结其中的有用信息，保留关键的数据、名称和链接，只输出总结。\n\n%s",
+		call.Function.Name, call.Function.Arguments, e.toolOutput.MaxLength, truncateRunes(content, maxSummaryInput))
+	completion, err := CompleteContext(ctx, aiCfg, []ChatMessage{{Role: "user", Content: prompt}}, nil)
+	if err != nil {
+		return "", err
+	}
+	result.Usage.Add(completion.Usage)
+	if completion.Message.Content == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return "[结果过长，以下为总结]\n" + truncateRunes(completion.Message.Content, e.toolOutput.MaxLength), nil
+}
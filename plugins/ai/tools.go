@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// toolsCommand /tools - 列出模型可用的内置工具和各 MCP 服务的连接状态
+func (p *AIPlugin) toolsCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{
+		Name:        "/tools",
+		Description: "查看可用的工具和 MCP 服务状态",
+		Handler: func(c core.Context, args core.Args) error {
+			// 演示模式等过滤后实际提供给模型的工具
+			var available, native []string
+			for _, tool := range p.toolExecutor.tools() {
+				name := tool.Function.Name
+				available = append(available, name)
+				if _, ok := p.tools.Get(name); ok {
+					native = append(native, name)
+				}
+			}
+
+			var lines []string
+			if len(native) > 0 {
+				lines = append(lines, ctx.T(c, "ai.tools_native", strings.Join(native, ", ")))
+			}
+			statuses := p.mcpManager.Status()
+			if len(statuses) > 0 {
+				lines = append(lines, "", ctx.T(c, "ai.tools_mcp"))
+			}
+			for _, status := range statuses {
+				switch {
+				case status.Connected:
+					tools := slices.DeleteFunc(status.Tools, func(name string) bool { return !slices.Contains(available, name) })
+					lines = append(lines, ctx.T(c, "ai.tools_connected", status.Name, len(tools), strings.Join(tools, ", ")))
+				case errors.Is(status.Err, errMCPUnauthorized):
+					lines = append(lines, ctx.T(c, "ai.tools_unauthorized", status.Name))
+				case status.Err != nil:
+					lines = append(lines, ctx.T(c, "ai.tools_failed", status.Name, status.Err))
+				default:
+					lines = append(lines, ctx.T(c, "ai.tools_pending", status.Name))
+				}
+			}
+			if len(lines) == 0 {
+				return c.Reply(ctx.T(c, "ai.tools_none"))
+			}
+			return c.Reply(strings.Join(lines, "\n"))
+		},
+	}
+}
@@ -0,0 +1,19 @@
+package ai
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 模型请求和工具调用的 span，属性名参照 OpenTelemetry 的 gen_ai 语义约定。未启用 tracing 时为 no-op
+var tracer = otel.Tracer("github.com/lhpqaq/ggbot/plugins/ai")
+
+// endSpan 记录错误并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
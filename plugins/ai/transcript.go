@@ -0,0 +1,236 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// progressInterval 文件处理进度最多多久更新一次消息
+const progressInterval = 5 * time.Second
+
+// textExtensions 可以按纯文本处理的文件后缀
+var textExtensions = map[string]bool{
+	".txt": true, ".log": true, ".md": true, ".csv": true,
+	".json": true, ".yaml": true, ".yml": true, ".srt": true, ".vtt": true,
+}
+
+func isTextDocument(doc *core.Document) bool {
+	if strings.HasPrefix(doc.MIMEType, "text/") || doc.MIMEType == "application/json" {
+		return true
+	}
+	return textExtensions[strings.ToLower(filepath.Ext(doc.Name))]
+}
+
+// handleDocument 接收大文本/日志文件，交给后台任务分块总结
+func (p *AIPlugin) handleDocument(ctx *plugins.Context, c core.Context) error {
+	cfg := ctx.Config
+	user := c.Sender()
+	if !cfg.IsAllowed(c.Platform(), user.ID) {
+		return nil
+	}
+
+	doc := c.Document()
+	if _, ok := groupSettings(ctx.Storage, c); doc == nil || !ok {
+		return nil
+	}
+	// 附带 /kb 说明的文件导入知识库
+	if strings.HasPrefix(strings.TrimSpace(c.Text()), kbCommand) {
+		return p.handleKB(ctx, c)
+	}
+	if !isTextDocument(doc) {
+		return c.Reply(ctx.T(c, "transcript.text_only"))
+	}
+	if doc.Size > cfg.Transcript.MaxFileSize {
+		return c.Reply(ctx.T(c, "transcript.too_large", doc.Size>>10, cfg.Transcript.MaxFileSize>>10))
+	}
+	if msg, exceeded := quotaExceeded(cfg, ctx.Storage, c); exceeded {
+		return replyQuotaExceeded(cfg, c, msg)
+	}
+
+	storageKey := core.UserKey(c)
+	aiCfg := resolveAIConfig(cfg, ctx.Storage, storageKey)
+
+	instruction := strings.TrimSpace(c.Text())
+	if instruction == "" {
+		instruction = "请总结这份文件的主要内容和关键信息。"
+	}
+
+	lang := ctx.Lang(c)
+	sentMsg, err := c.Send(i18n.T(lang, "transcript.received"))
+	if err != nil {
+		return err
+	}
+
+	taskID := ctx.Tasks.Submit(storageKey, i18n.T(lang, "transcript.task", doc.Name), func(taskCtx context.Context, report func(string)) error {
+		r, err := c.Download(doc)
+		if err != nil {
+			_ = c.Edit(sentMsg, i18n.T(lang, "transcript.download_failed", err))
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(r, cfg.Transcript.MaxFileSize))
+		r.Close()
+		if err != nil {
+			_ = c.Edit(sentMsg, i18n.T(lang, "transcript.read_failed", err))
+			return err
+		}
+
+		// 进度更新编辑消息，每 progressInterval 最多一次；不能编辑消息的平台（QQ 等）每次编辑都是一条新消息，
+		// 只记录在 /tasks 中
+		editable := core.CanEdit(c)
+		var lastEdit time.Time
+		progress := func(text string) {
+			report(text)
+			if editable && time.Since(lastEdit) >= progressInterval {
+				lastEdit = time.Now()
+				_ = c.Edit(sentMsg, "📄 "+text)
+			}
+		}
+
+		result, err := summarizeChunked(taskCtx, aiCfg, ctx.Logger, lang, doc.Name, string(data), instruction, cfg.Transcript.ChunkSize, progress)
+		if err != nil {
+			_ = c.Edit(sentMsg, i18n.T(lang, "transcript.failed", err))
+			return err
+		}
+		if err := addUsage(cfg.Limits, ctx.Storage, storageKey, 1, 0); err != nil {
+			ctx.Logger.Error("Failed to save usage", "error", err)
+		}
+		result = watermark(cfg, result)
+
+		if err := c.Edit(sentMsg, result); err != nil {
+			ctx.Logger.Error("Failed to edit message", "error", err)
+			_ = c.Reply(result)
+		}
+		return nil
+	})
+
+	ctx.Logger.Info("Document task submitted", "task", taskID, "file", doc.Name, "size", doc.Size)
+	return nil
+}
+
+// summarizeChunked 以 map-reduce 的方式总结长文本：
+// 先逐块提炼要点，再把要点合并（必要时多轮），最后按用户要求作答。进度文字使用 lang
+func summarizeChunked(
+	ctx context.Context,
+	aiCfg config.AIConfig,
+	logger *slog.Logger,
+	lang string,
+	name string,
+	text string,
+	instruction string,
+	chunkSize int,
+	progress func(string),
+) (string, error) {
+	chunks := splitChunks(text, chunkSize)
+	logger.Debug("Summarizing document", "file", name, "chunks", len(chunks))
+
+	// Map: 逐块提炼
+	notes := make([]string, 0, len(chunks))
+	step := max(1, len(chunks)/4)
+	for i, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if i%step == 0 {
+			progress(i18n.T(lang, "transcript.analyzing", i+1, len(chunks)))
+		}
+
+		messages := []ChatMessage{
+			{Role: "system", Content: "你是一个文档分析助手。请提炼给定片段中与用户要求相关的要点，保留关键事实、数字、时间和错误信息，不要编造。"},
+			{Role: "user", Content: fmt.Sprintf("用户要求：%s\n\n以下是文件《%s》的第 %d/%d 部分：\n\n%s", instruction, name, i+1, len(chunks), chunk)},
+		}
+		resp, err := GenerateContext(ctx, aiCfg, messages, nil)
+		if err != nil {
+			return "", fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+		notes = append(notes, resp.Content)
+	}
+
+	// Reduce: 要点过长时分组合并，直到能放进一个块
+	for round := 1; len(notes) > 1 && len(strings.Join(notes, "\n\n")) > chunkSize; round++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		progress(i18n.T(lang, "transcript.merging", round))
+
+		groups := splitChunks(strings.Join(notes, "\n\n"), chunkSize)
+		merged := make([]string, 0, len(groups))
+		for _, group := range groups {
+			messages := []ChatMessage{
+				{Role: "system", Content: "你是一个文档分析助手。请把下面的多段要点合并去重，保留关键信息。"},
+				{Role: "user", Content: group},
+			}
+			resp, err := GenerateContext(ctx, aiCfg, messages, nil)
+			if err != nil {
+				return "", fmt.Errorf("merge round %d: %w", round, err)
+			}
+			merged = append(merged, resp.Content)
+		}
+		// 合并后没有变短则停止，避免死循环
+		if len(merged) >= len(notes) {
+			notes = merged
+			break
+		}
+		notes = merged
+	}
+
+	progress(i18n.T(lang, "transcript.finishing"))
+	messages := []ChatMessage{
+		{Role: "system", Content: "你是一个文档分析助手。下面是从一份长文件中分块提炼出的要点，请据此回答用户的要求。"},
+		{Role: "user", Content: fmt.Sprintf("文件：%s\n\n要点：\n%s\n\n用户要求：%s", name, strings.Join(notes, "\n\n"), instruction)},
+	}
+	resp, err := GenerateContext(ctx, aiCfg, messages, nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// splitChunks 按行切分文本，每块不超过 size 个字符（单行过长时硬切）
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	var b strings.Builder
+
+	flush := func() {
+		if b.Len() > 0 {
+			chunks = append(chunks, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for len(line) > size {
+			flush()
+			cut := size
+			// 不要切断 UTF-8 字符
+			for cut > 0 && !isRuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = size
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		if b.Len()+len(line) > size {
+			flush()
+		}
+		b.WriteString(line)
+	}
+	flush()
+
+	return chunks
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,42 @@
+package ai
+
+import "time"
+
+// userData AI 插件在存储之外保存的用户数据
+type userData struct {
+	// 内存中的对话记忆
+	Conversation []ChatMessage `json:"conversation,omitempty"`
+	// 知识库文档（不含内容和向量）
+	Documents []userDocument `json:"documents,omitempty"`
+}
+
+type userDocument struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Source  string    `json:"source"`
+	AddedAt time.Time `json:"added_at"`
+	Chunks  int       `json:"chunks"`
+}
+
+// exportUser 导出用户的对话记忆和知识库文档列表，没有数据时返回 nil
+func (p *AIPlugin) exportUser(userKey string) any {
+	data := userData{Conversation: p.history.Get(userKey)}
+	if p.kb != nil {
+		for _, doc := range p.kb.List(userKey) {
+			data.Documents = append(data.Documents, userDocument{ID: doc.ID, Name: doc.Name, Source: doc.Source, AddedAt: doc.AddedAt, Chunks: len(doc.Chunks)})
+		}
+	}
+	if len(data.Conversation) == 0 && len(data.Documents) == 0 {
+		return nil
+	}
+	return data
+}
+
+// forgetUser 清空用户的对话记忆和知识库
+func (p *AIPlugin) forgetUser(userKey string) error {
+	p.history.Clear(userKey)
+	if p.kb != nil && p.kb.HasDocuments(userKey) {
+		return p.kb.Clear(userKey)
+	}
+	return nil
+}
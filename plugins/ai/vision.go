@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// maxImageSize 识图支持的最大图片大小
+const maxImageSize = 10 << 20
+
+// handlePhoto 将用户发送的图片（及说明文字）交给支持视觉的模型
+func (p *AIPlugin) handlePhoto(ctx *plugins.Context, c core.Context) error {
+	cfg := ctx.Config
+	s := ctx.Storage
+	user := c.Sender()
+	if !cfg.IsAllowed(c.Platform(), user.ID) {
+		return nil
+	}
+
+	group, ok := groupSettings(s, c)
+	photo := c.Photo()
+	if photo == nil || !ok {
+		return nil
+	}
+	if photo.Size > maxImageSize {
+		return c.Reply(ctx.T(c, "vision.too_large", photo.Size>>10, maxImageSize>>10))
+	}
+
+	storageKey := core.UserKey(c)
+	aiCfg := resolveAIConfig(cfg, s, storageKey)
+	profile := s.GetUserProfile(storageKey)
+	systemPrompt, _ := chatSystemPrompt(cfg, aiCfg, profile, storageKey)
+	if prompt, _, ok := groupPrompt(cfg, group, profile); ok {
+		systemPrompt = prompt
+	}
+	route := p.Router.Match(c)
+	if prompt, ok := routePrompt(cfg, route); ok {
+		systemPrompt = prompt
+	}
+
+	question := strings.TrimSpace(c.Text())
+	if question == "" {
+		question = "请描述这张图片。"
+	}
+
+	go func() {
+		image, err := imageDataURL(c, photo)
+		if err != nil {
+			ctx.Logger.Error("Failed to download photo", "error", err)
+			_ = c.Reply(ctx.T(c, "vision.download_failed", err))
+			return
+		}
+		p.handleRequest(c, cfg, s, ctx.Logger, systemPrompt, question, []string{image}, Options{Persona: requestPersona(route, group, profile)})
+	}()
+
+	return nil
+}
+
+// imageDataURL 下载图片并编码为 data URL，避免模型服务无法访问平台的图片地址
+func imageDataURL(c core.Context, photo *core.Document) (string, error) {
+	rc, err := c.Download(photo)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageSize {
+		return "", fmt.Errorf("image exceeds %d bytes", maxImageSize)
+	}
+
+	mimeType := photo.MIMEType
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// maxWebhookResponse 返回给模型的响应最大字节数
+const maxWebhookResponse = 16 << 10
+
+// placeholderRegex matches {{name}} in webhook templates
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// webhookTool builds a native tool that calls the HTTP endpoint described by cfg
+func webhookTool(name string, cfg config.ToolWebhookConfig) (NativeTool, error) {
+	if cfg.URL == "" {
+		return NativeTool{}, fmt.Errorf("tool webhook %s: url is required", name)
+	}
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+
+	var schema json.RawMessage
+	if cfg.Parameters != nil {
+		data, err := json.Marshal(cfg.Parameters)
+		if err != nil {
+			return NativeTool{}, fmt.Errorf("tool webhook %s: invalid parameters: %w", name, err)
+		}
+		schema = data
+	}
+
+	client := &http.Client{Timeout: timeout}
+	handler := func(ctx context.Context, args map[string]interface{}) (string, error) {
+		u := fillURL(cfg.URL, args)
+
+		var body io.Reader
+		switch {
+		case cfg.Body != "":
+			body = strings.NewReader(fillTemplate(cfg.Body, args, jsonString))
+		case method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch:
+			data, err := json.Marshal(args)
+			if err != nil {
+				return "", err
+			}
+			body = strings.NewReader(string(data))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, body)
+		if err != nil {
+			return "", err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range cfg.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(data))
+		}
+		return string(data), nil
+	}
+
+	return NativeTool{
+		Name:        name,
+		Description: cfg.Description,
+		Schema:      schema,
+		Handler:     handler,
+	}, nil
+}
+
+// fillTemplate replaces {{name}} with the encoded argument, missing arguments become empty
+func fillTemplate(tmpl string, args map[string]interface{}, encode func(string) string) string {
+	return placeholderRegex.ReplaceAllStringFunc(tmpl, func(m string) string {
+		key := placeholderRegex.FindStringSubmatch(m)[1]
+		v, ok := args[key]
+		if !ok || v == nil {
+			return encode("")
+		}
+		if s, ok := v.(string); ok {
+			return encode(s)
+		}
+		return encode(fmt.Sprint(v))
+	})
+}
+
+// fillURL fills the URL template, escaping placeholders in the path with PathEscape
+// and those in the query (after "?") with QueryEscape
+func fillURL(tmpl string, args map[string]interface{}) string {
+	path, query, ok := strings.Cut(tmpl, "?")
+	u := fillTemplate(path, args, url.PathEscape)
+	if ok {
+		u += "?" + fillTemplate(query, args, url.QueryEscape)
+	}
+	return u
+}
+
+// jsonString encodes s as the content of a JSON string (without quotes)
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// wsTransport connects to MCP servers that only expose a WebSocket endpoint.
+// Each JSON-RPC message is sent as one text frame.
+type wsTransport struct {
+	url     string
+	headers http.Header
+	dialer  *websocket.Dialer
+}
+
+// newWSTransport creates a WebSocket transport with the same header and proxy handling as the HTTP transports
+func newWSTransport(mcpCfg config.MCPConfig, proxyCfg config.ProxyConfig) (*wsTransport, error) {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: 15 * time.Second,
+		Subprotocols:     []string{"mcp"},
+	}
+	if mcpCfg.UseProxy && proxyCfg.URL != "" {
+		proxyURL, err := url.Parse(proxyCfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	headers := http.Header{}
+	for k, v := range mcpCfg.Headers {
+		headers.Set(k, v)
+	}
+	return &wsTransport{url: mcpCfg.URL, headers: headers, dialer: dialer}, nil
+}
+
+func (t *wsTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	conn, resp, err := t.dialer.DialContext(ctx, t.url, t.headers)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket handshake failed (status %d): %w", resp.StatusCode, err)
+		}
+		return nil, err
+	}
+	return &wsConn{conn: conn}, nil
+}
+
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// Read blocks until the next message arrives; Close unblocks it
+func (c *wsConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return jsonrpc.DecodeMessage(data)
+}
+
+func (c *wsConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *wsConn) Close() error {
+	c.writeMu.Lock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
+
+func (c *wsConn) SessionID() string {
+	return ""
+}
@@ -0,0 +1,185 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	tagRegex   = regexp.MustCompile(`(?s)<[^>]+>`)
+	spaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// Item 订阅源中的一个条目
+type Item struct {
+	GUID      string
+	Title     string
+	Link      string
+	Summary   string // 纯文本
+	Published time.Time
+}
+
+// Feed 解析后的订阅源，Items 按源中的顺序（通常从新到旧）
+type Feed struct {
+	Title string
+	Items []Item
+}
+
+type rssDoc struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+}
+
+type atomDoc struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+// Parse 解析 RSS 2.0 或 Atom 文档
+func Parse(data []byte) (*Feed, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &Feed{}
+	switch root {
+	case "rss":
+		var doc rssDoc
+		if err := decode(data, &doc); err != nil {
+			return nil, err
+		}
+		feed.Title = strings.TrimSpace(doc.Channel.Title)
+		for _, it := range doc.Channel.Items {
+			feed.Items = append(feed.Items, Item{
+				GUID:      firstNonEmpty(it.GUID, it.Link, it.Title),
+				Title:     strings.TrimSpace(it.Title),
+				Link:      strings.TrimSpace(it.Link),
+				Summary:   plainText(it.Description),
+				Published: parseTime(it.PubDate),
+			})
+		}
+	case "feed":
+		var doc atomDoc
+		if err := decode(data, &doc); err != nil {
+			return nil, err
+		}
+		feed.Title = strings.TrimSpace(doc.Title)
+		for _, e := range doc.Entries {
+			link := ""
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			feed.Items = append(feed.Items, Item{
+				GUID:      firstNonEmpty(e.ID, link, e.Title),
+				Title:     strings.TrimSpace(e.Title),
+				Link:      strings.TrimSpace(link),
+				Summary:   plainText(firstNonEmpty(e.Summary, e.Content)),
+				Published: parseTime(firstNonEmpty(e.Published, e.Updated)),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("不是 RSS 或 Atom 格式（根元素 <%s>）", root)
+	}
+
+	// 没有 GUID 的条目无法去重
+	items := feed.Items[:0]
+	for _, it := range feed.Items {
+		if it.GUID != "" {
+			items = append(items, it)
+		}
+	}
+	feed.Items = items
+	return feed, nil
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "utf8", "us-ascii", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("不支持的编码 %s", charset)
+	}
+	return d
+}
+
+func decode(data []byte, v any) error {
+	return newDecoder(data).Decode(v)
+}
+
+// rootElement returns the local name of the document element
+func rootElement(data []byte) (string, error) {
+	d := newDecoder(data)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("解析 XML 失败: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// plainText strips HTML tags and collapses whitespace
+func plainText(s string) string {
+	s = tagRegex.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(s, " "))
+}
+
+var timeLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
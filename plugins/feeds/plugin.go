@@ -0,0 +1,285 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/ai"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/safehttp"
+	"github.com/lhpqaq/ggbot/scheduler"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// maxFeedSize 订阅源文档的最大字节数
+const maxFeedSize = 5 << 20
+
+// FeedsPlugin 订阅 RSS/Atom 源，定期把新条目推送到订阅所在的会话
+type FeedsPlugin struct {
+	// AI 用于以 summary 方式订阅时生成条目摘要，为 nil 时不支持摘要
+	AI *ai.AIPlugin
+
+	client *http.Client
+}
+
+func (p *FeedsPlugin) Name() string {
+	return "Feeds"
+}
+
+func (p *FeedsPlugin) Init(ctx *plugins.Context) error {
+	cfg := ctx.Config
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Feeds.UseProxy && cfg.Proxy.URL != "" {
+		proxyURL, err := url.Parse(cfg.Proxy.URL)
+		if err != nil {
+			return fmt.Errorf("feeds: invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	// 订阅地址由用户提交，只允许访问公网地址
+	p.client = safehttp.NewClient(20*time.Second, transport)
+
+	// Handler: /rss
+	ctx.AddCommand(p.command(ctx))
+
+	return ctx.Scheduler.Add("feeds", scheduler.Every(cfg.Feeds.Interval), func(jobCtx context.Context) error {
+		return p.poll(ctx, jobCtx)
+	})
+}
+
+// command /rss [list] | /rss add <url> [summary] | /rss remove <编号>
+func (p *FeedsPlugin) command(ctx *plugins.Context) *core.Command {
+	cfg := ctx.Config
+	// allowed 只有允许的用户可以使用，修改群组的订阅需要管理员
+	allowed := func(modify bool, handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !cfg.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			if modify && c.Chat().Type != "private" && !cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "rss.admin_only"))
+			}
+			return handler(c, args)
+		}
+	}
+	list := allowed(false, func(c core.Context, _ core.Args) error {
+		feeds := ctx.Storage.ChatFeeds(policy.ChatKey(c))
+		if len(feeds) == 0 {
+			return c.Reply(ctx.T(c, "rss.empty"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "rss.title"))
+		for _, f := range feeds {
+			fmt.Fprintf(&b, "%s. %s\n   %s", f.ID, feedTitle(f), f.URL)
+			if f.Summarize {
+				b.WriteString(ctx.T(c, "rss.summary_tag"))
+			}
+			b.WriteString("\n")
+		}
+		return c.Reply(b.String())
+	})
+
+	return &core.Command{
+		Name:        "/rss",
+		Description: "管理 RSS 订阅",
+		Handler:     list,
+		Subcommands: []*core.Command{
+			{Name: "list", Handler: list},
+			{
+				Name: "add",
+				Args: []core.Arg{{Name: "链接"}, {Name: "summary", Optional: true, Choices: []string{"summary"}}},
+				Handler: allowed(true, func(c core.Context, args core.Args) error {
+					return p.handleAdd(ctx, c, args["链接"], args.Has("summary"))
+				}),
+			},
+			{
+				Name:    "remove",
+				Aliases: []string{"del"},
+				Args:    []core.Arg{{Name: "编号"}},
+				Handler: allowed(true, func(c core.Context, args core.Args) error {
+					chatKey := policy.ChatKey(c)
+					id := args["编号"]
+					removed, err := ctx.Storage.RemoveFeed(chatKey, id)
+					if err != nil {
+						return c.Reply(ctx.T(c, "common.save_failed", err))
+					}
+					if !removed {
+						return c.Reply(ctx.T(c, "rss.not_found", id))
+					}
+					ctx.Logger.Info("Feed removed", "chat", chatKey, "id", id)
+					return c.Reply(ctx.T(c, "rss.removed", id))
+				}),
+			},
+		},
+	}
+}
+
+func (p *FeedsPlugin) handleAdd(ctx *plugins.Context, c core.Context, link string, summarize bool) error {
+	cfg := ctx.Config
+	chatKey := policy.ChatKey(c)
+	if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return c.Reply(ctx.T(c, "rss.invalid_url"))
+	}
+	if summarize && p.AI == nil {
+		return c.Reply(ctx.T(c, "rss.no_ai"))
+	}
+	if len(ctx.Storage.ChatFeeds(chatKey)) >= cfg.Feeds.MaxFeeds {
+		return c.Reply(ctx.T(c, "rss.too_many", cfg.Feeds.MaxFeeds))
+	}
+	target, err := policy.PushTarget(c)
+	if err != nil {
+		return c.Reply(ctx.T(c, "push.no_target"))
+	}
+
+	fetchCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	parsed, err := p.fetch(fetchCtx, link)
+	if err != nil {
+		return c.Reply(ctx.T(c, "rss.fetch_failed", err))
+	}
+
+	// 订阅时已有的条目视为已读，只推送之后出现的新条目
+	feed := &storage.Feed{
+		URL:       link,
+		Title:     parsed.Title,
+		Target:    target,
+		ChatKey:   chatKey,
+		Summarize: summarize,
+		AddedBy:   core.UserKey(c),
+		Added:     time.Now(),
+		Checked:   time.Now(),
+	}
+	for _, item := range slices.Backward(parsed.Items) {
+		feed.Seen = append(feed.Seen, item.GUID)
+	}
+	if err := ctx.Storage.AddFeed(feed); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	ctx.Logger.Info("Feed added", "chat", chatKey, "id", feed.ID, "url", link, "items", len(parsed.Items))
+	return c.Reply(ctx.T(c, "rss.added", feedTitle(*feed), feed.ID, cfg.Feeds.Interval))
+}
+
+// poll 检查所有订阅源并推送新条目，由调度器的 feeds 任务执行
+func (p *FeedsPlugin) poll(ctx *plugins.Context, jobCtx context.Context) error {
+	var errs []error
+	for _, feed := range ctx.Storage.AllFeeds() {
+		if err := p.check(ctx, jobCtx, feed); err != nil {
+			ctx.Logger.Warn("Feed check failed", "id", feed.ID, "url", feed.URL, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", feed.URL, err))
+		}
+		if jobCtx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check 推送一个订阅源中未推送过的条目（从旧到新），单次最多 feeds.max_items 条
+func (p *FeedsPlugin) check(ctx *plugins.Context, jobCtx context.Context, feed storage.Feed) error {
+	fetchCtx, cancel := context.WithTimeout(jobCtx, 30*time.Second)
+	defer cancel()
+	parsed, err := p.fetch(fetchCtx, feed.URL)
+	if err != nil {
+		return err
+	}
+
+	var fresh []Item
+	for _, item := range slices.Backward(parsed.Items) {
+		if !slices.Contains(feed.Seen, item.GUID) {
+			fresh = append(fresh, item)
+		}
+	}
+	// 条目过多时只推送最新的几条，其余直接标记为已读
+	var skipped []string
+	if limit := ctx.Config.Feeds.MaxItems; len(fresh) > limit {
+		for _, item := range fresh[:len(fresh)-limit] {
+			skipped = append(skipped, item.GUID)
+		}
+		fresh = fresh[len(fresh)-limit:]
+	}
+
+	feed.Title = firstNonEmpty(parsed.Title, feed.Title)
+	var sent []string
+	var sendErr error
+	for _, item := range fresh {
+		if err := ctx.Push(feed.Target, p.format(ctx, feed, item)); err != nil {
+			ctx.Alerts.Warn("feed:"+feed.Target, "RSS 推送到 "+feed.Target+" 失败: "+err.Error())
+			sendErr = err
+			break
+		}
+		sent = append(sent, item.GUID)
+	}
+	if len(sent) > 0 {
+		ctx.Logger.Info("Feed items pushed", "id", feed.ID, "target", feed.Target, "items", len(sent))
+	}
+	if err := ctx.Storage.MarkFeedSeen(feed.ID, parsed.Title, append(skipped, sent...)); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// format 生成条目的推送内容，summary 订阅时由 AI 生成摘要，失败时使用条目自带的摘要
+func (p *FeedsPlugin) format(ctx *plugins.Context, feed storage.Feed, item Item) string {
+	summary := item.Summary
+	if feed.Summarize && p.AI != nil && summary != "" {
+		prompt := "标题：" + item.Title + "\n\n" + truncate(item.Summary, 4000)
+		if s, err := p.AI.Generate(ctx, "feed", ctx.Config.Feeds.SummaryPrompt, prompt); err != nil {
+			ctx.Logger.Warn("Feed summary failed", "id", feed.ID, "error", err)
+		} else if s != "" {
+			summary = s
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📰 %s\n%s\n", feedTitle(feed), firstNonEmpty(item.Title, "(无标题)"))
+	if summary != "" {
+		b.WriteString("\n" + truncate(summary, 300) + "\n")
+	}
+	if item.Link != "" {
+		b.WriteString("\n" + item.Link)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (p *FeedsPlugin) fetch(ctx context.Context, link string) (*Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ggbot-feeds/1.0")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func feedTitle(feed storage.Feed) string {
+	return firstNonEmpty(feed.Title, feed.URL)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
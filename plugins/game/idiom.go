@@ -0,0 +1,109 @@
+package game
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const kindIdiom = "idiom"
+
+// startIdioms 未指定起始成语时随机选择
+var startIdioms = []string{
+	"一心一意", "画龙点睛", "守株待兔", "井底之蛙", "亡羊补牢",
+	"胸有成竹", "刻舟求剑", "对牛弹琴", "叶公好龙", "杯弓蛇影",
+	"望梅止渴", "指鹿为马", "卧薪尝胆", "破釜沉舟", "四面楚歌",
+}
+
+// isIdiom 是否为四个汉字（不校验是否为真实成语）
+func isIdiom(s string) bool {
+	if utf8.RuneCountInString(s) != 4 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.Is(unicode.Han, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func lastRune(s string) string {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return string(r)
+}
+
+func firstRune(s string) string {
+	r, _ := utf8.DecodeRuneInString(s)
+	return string(r)
+}
+
+func (p *GamePlugin) startIdiom(ctx *plugins.Context, c core.Context, start string) error {
+	if start == "" {
+		start = startIdioms[rand.IntN(len(startIdioms))]
+	}
+	if !isIdiom(start) {
+		return c.Reply(ctx.T(c, "game.idiom_invalid"))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, err := p.newGame(ctx, c, kindIdiom)
+	if g == nil {
+		return err
+	}
+	g.Used = []string{start}
+	if err := ctx.Storage.SetGame(policy.ChatKey(c), g); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	reschedule(ctx)
+	ctx.Logger.Info("Game started", "chat", policy.ChatKey(c), "kind", kindIdiom, "start", start)
+	return c.Reply(ctx.T(c, "game.idiom_started", start, lastRune(start), ctx.Config.Game.TurnTimeout))
+}
+
+// answerIdiom 检查接龙，不是接龙的消息交给后面的插件
+func (p *GamePlugin) answerIdiom(ctx *plugins.Context, c core.Context, g *storage.Game) error {
+	text := trimAnswer(c.Text())
+	if !isIdiom(text) {
+		return core.ErrPass
+	}
+	if slices.Contains(g.Used, text) {
+		return c.Reply(i18n.T(g.Lang, "game.idiom_used", text))
+	}
+	want := lastRune(g.Used[len(g.Used)-1])
+	if firstRune(text) != want {
+		return c.Reply(i18n.T(g.Lang, "game.idiom_mismatch", text, want))
+	}
+
+	chatKey := policy.ChatKey(c)
+	mention, err := score(ctx, c, chatKey, g)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	g.Used = append(g.Used, text)
+	g.Round++
+	g.Deadline = time.Now().Add(ctx.Config.Game.TurnTimeout)
+	if err := ctx.Storage.SetGame(chatKey, g); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	reschedule(ctx)
+	return c.Reply(i18n.T(g.Lang, "game.idiom_next", mention, text, lastRune(text)))
+}
+
+// idiomTimeout 没人接上时结束游戏
+func (p *GamePlugin) idiomTimeout(ctx *plugins.Context, chatKey string, g *storage.Game, send func(string) error) error {
+	if _, err := ctx.Storage.DeleteGame(chatKey); err != nil {
+		return err
+	}
+	ctx.Logger.Info("Game finished", "chat", chatKey, "kind", kindIdiom, "rounds", g.Round)
+	last := g.Used[len(g.Used)-1]
+	return send(i18n.T(g.Lang, "game.idiom_timeout", lastRune(last), g.Round, results(g)))
+}
@@ -0,0 +1,290 @@
+package game
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/ai"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// jobName 处理回合超时的定时任务
+const jobName = "game"
+
+// GamePlugin 群组游戏：AI 出题的知识问答和成语接龙。
+// 游戏状态和积分保存在 storage 中，回合超时由定时任务处理。
+type GamePlugin struct {
+	// AI 用于知识问答出题，为 nil 时只能玩成语接龙
+	AI *ai.AIPlugin
+
+	// mu 串行化对游戏状态的修改，避免多人同时作答时重复计分
+	mu sync.Mutex
+}
+
+func (p *GamePlugin) Name() string {
+	return "Game"
+}
+
+func (p *GamePlugin) Init(ctx *plugins.Context) error {
+	// Handler: /game
+	ctx.AddCommand(p.command(ctx))
+
+	// 游戏进行中时检查作答，其他消息交给后面的插件
+	ctx.RegisterText(func(c core.Context) error {
+		return p.handleText(ctx, c)
+	})
+
+	return ctx.Scheduler.Add(jobName, turnSchedule{store: ctx.Storage}, func(context.Context) error {
+		p.expire(ctx)
+		return nil
+	})
+}
+
+// turnSchedule 在最早的回合截止时间运行，没有需要处理的游戏时每分钟检查一次
+type turnSchedule struct {
+	store *storage.Storage
+}
+
+func (s turnSchedule) Next(now time.Time) time.Time {
+	next := now.Add(time.Minute)
+	for _, g := range s.store.AllGames() {
+		// 没有推送目标的游戏在下一条消息时处理超时
+		if g.Target != "" && g.Deadline.Before(next) {
+			next = g.Deadline
+		}
+	}
+	return later(next, now.Add(time.Second))
+}
+
+func (s turnSchedule) String() string { return "按回合截止时间" }
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// reschedule 游戏开始或进入新回合后让定时任务按新的截止时间计时
+func reschedule(ctx *plugins.Context) {
+	_, _ = ctx.Scheduler.Run(jobName)
+}
+
+// command /game [trivia [主题] | idiom [成语] | stop | top]
+func (p *GamePlugin) command(ctx *plugins.Context) *core.Command {
+	allowed := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			return handler(c, args)
+		}
+	}
+
+	return &core.Command{
+		Name:        "/game",
+		Description: "群组游戏（知识问答、成语接龙）",
+		Handler: allowed(func(c core.Context, _ core.Args) error {
+			lang := ctx.Lang(c)
+			status := i18n.T(lang, "game.none")
+			if g := ctx.Storage.GetGame(policy.ChatKey(c)); g != nil {
+				status = i18n.T(lang, "game.running", kindName(lang, g.Kind))
+			}
+			return c.Reply(status + i18n.T(lang, "game.usage"))
+		}),
+		Subcommands: []*core.Command{
+			{Name: "trivia", Args: []core.Arg{{Name: "主题", Optional: true, Rest: true}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				if p.AI == nil {
+					return c.Reply(ctx.T(c, "game.no_ai"))
+				}
+				return p.startTrivia(ctx, c, args["主题"])
+			})},
+			{Name: "idiom", Args: []core.Arg{{Name: "成语", Optional: true, Rest: true}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				return p.startIdiom(ctx, c, args["成语"])
+			})},
+			{Name: "stop", Handler: allowed(func(c core.Context, _ core.Args) error {
+				return p.handleStop(ctx, c)
+			})},
+			{Name: "top", Handler: allowed(func(c core.Context, _ core.Args) error {
+				return c.Reply(leaderboard(ctx.Lang(c), ctx.Storage.GameLeaderboard(policy.ChatKey(c))))
+			})},
+		},
+	}
+}
+
+func (p *GamePlugin) handleStop(ctx *plugins.Context, c core.Context) error {
+	chatKey := policy.ChatKey(c)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	g := ctx.Storage.GetGame(chatKey)
+	if g == nil {
+		return c.Reply(ctx.T(c, "game.none"))
+	}
+	user := core.UserKey(c)
+	if g.Starter != user && !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+		return c.Reply(ctx.T(c, "game.stop_denied"))
+	}
+	if _, err := ctx.Storage.DeleteGame(chatKey); err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	ctx.Logger.Info("Game stopped", "chat", chatKey, "kind", g.Kind, "user", user)
+	return c.Reply(i18n.T(g.Lang, "game.stopped", results(g)))
+}
+
+// newGame 创建游戏，会话中已有游戏时返回 nil 并提示
+func (p *GamePlugin) newGame(ctx *plugins.Context, c core.Context, kind string) (*storage.Game, error) {
+	if g := ctx.Storage.GetGame(policy.ChatKey(c)); g != nil {
+		return nil, c.Reply(ctx.T(c, "game.busy", kindName(ctx.Lang(c), g.Kind)))
+	}
+	// QQ 群无法主动推送，超时提示只能在下一条消息时发送
+	target, _ := policy.PushTarget(c)
+	now := time.Now()
+	return &storage.Game{
+		Kind:     kind,
+		Target:   target,
+		Starter:  core.UserKey(c),
+		Deadline: now.Add(ctx.Config.Game.TurnTimeout),
+		Started:  now,
+		Scores:   make(map[string]int),
+		Lang:     ctx.Lang(c),
+	}, nil
+}
+
+func (p *GamePlugin) handleText(ctx *plugins.Context, c core.Context) error {
+	chatKey := policy.ChatKey(c)
+	if ctx.Storage.GetGame(chatKey) == nil || !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+		return core.ErrPass
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g := ctx.Storage.GetGame(chatKey)
+	if g == nil {
+		return core.ErrPass
+	}
+	if time.Now().After(g.Deadline) {
+		// 没有推送目标的会话（QQ 群）在这里补发超时提示
+		p.timeout(ctx, chatKey, g, c.Reply)
+		return core.ErrPass
+	}
+
+	switch g.Kind {
+	case kindTrivia:
+		return p.answerTrivia(ctx, c, g)
+	case kindIdiom:
+		return p.answerIdiom(ctx, c, g)
+	}
+	return core.ErrPass
+}
+
+// expire 处理所有已超时的回合
+func (p *GamePlugin) expire(ctx *plugins.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for chatKey, g := range ctx.Storage.AllGames() {
+		if g.Target == "" || now.Before(g.Deadline) {
+			continue
+		}
+		game := ctx.Storage.GetGame(chatKey)
+		p.timeout(ctx, chatKey, game, func(text string) error {
+			return ctx.SendTo(game.Target, text)
+		})
+	}
+}
+
+// timeout 回合超时：问答公布答案并出下一题，成语接龙结束游戏
+func (p *GamePlugin) timeout(ctx *plugins.Context, chatKey string, g *storage.Game, send func(string) error) {
+	var err error
+	switch g.Kind {
+	case kindTrivia:
+		err = p.triviaTimeout(ctx, chatKey, g, send)
+	case kindIdiom:
+		err = p.idiomTimeout(ctx, chatKey, g, send)
+	default:
+		_, err = ctx.Storage.DeleteGame(chatKey)
+	}
+	if err != nil {
+		ctx.Logger.Error("Failed to handle game timeout", "chat", chatKey, "kind", g.Kind, "error", err)
+	}
+}
+
+// score 给作答正确的用户记分，返回用于公布的提及
+func score(ctx *plugins.Context, c core.Context, chatKey string, g *storage.Game) (string, error) {
+	sender := c.Sender()
+	name := cmp.Or(sender.Username, sender.ID)
+	if g.Scores == nil {
+		g.Scores = make(map[string]int)
+	}
+	g.Scores[name]++
+	if err := ctx.Storage.AddGameScore(chatKey, core.UserKey(c), name, 1); err != nil {
+		return "", err
+	}
+	return core.Mention(sender.ID, name), nil
+}
+
+// results 本局得分
+func results(g *storage.Game) string {
+	if len(g.Scores) == 0 {
+		return i18n.T(g.Lang, "game.no_scores")
+	}
+	names := slices.SortedFunc(maps.Keys(g.Scores), func(a, b string) int {
+		return cmp.Or(cmp.Compare(g.Scores[b], g.Scores[a]), strings.Compare(a, b))
+	})
+	var b strings.Builder
+	b.WriteString(i18n.T(g.Lang, "game.scores"))
+	for i, name := range names {
+		b.WriteString(i18n.T(g.Lang, "game.score", medal(i), name, g.Scores[name]))
+	}
+	return b.String()
+}
+
+// leaderboard 会话的累计积分排行
+func leaderboard(lang string, scores []storage.GameScore) string {
+	if len(scores) == 0 {
+		return i18n.T(lang, "game.leaderboard_empty")
+	}
+	var b strings.Builder
+	b.WriteString(i18n.T(lang, "game.leaderboard"))
+	for i, s := range scores {
+		if i == 10 {
+			break
+		}
+		b.WriteString(i18n.T(lang, "game.score", medal(i), cmp.Or(s.Name, s.User), s.Points))
+	}
+	return b.String()
+}
+
+func medal(i int) string {
+	switch i {
+	case 0:
+		return "🥇"
+	case 1:
+		return "🥈"
+	case 2:
+		return "🥉"
+	}
+	return fmt.Sprintf("%d.", i+1)
+}
+
+func kindName(lang, kind string) string {
+	switch kind {
+	case kindTrivia:
+		return i18n.T(lang, "game.trivia")
+	case kindIdiom:
+		return i18n.T(lang, "game.idiom")
+	}
+	return kind
+}
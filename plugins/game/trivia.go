@@ -0,0 +1,184 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const kindTrivia = "trivia"
+
+// generatingTimeout 出题期间的截止时间，出题完成后重新计时
+const generatingTimeout = 10 * time.Minute
+
+// question AI 生成的题目
+type question struct {
+	Question string   `json:"question" desc:"题目"`
+	Answers  []string `json:"answers" desc:"可接受的答案，包括常见的别称和写法"`
+}
+
+// trimAnswer 去掉首尾空白和标点
+func trimAnswer(s string) string {
+	return strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+}
+
+// normalize 比较答案时忽略大小写、空白和标点
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+func (p *GamePlugin) startTrivia(ctx *plugins.Context, c core.Context, topic string) error {
+	chatKey := policy.ChatKey(c)
+	p.mu.Lock()
+	g, err := p.newGame(ctx, c, kindTrivia)
+	if g == nil {
+		p.mu.Unlock()
+		return err
+	}
+	g.Topic = topic
+	g.Rounds = ctx.Config.Game.TriviaRounds
+	g.Deadline = time.Now().Add(generatingTimeout)
+	err = ctx.Storage.SetGame(chatKey, g)
+	p.mu.Unlock()
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+
+	ctx.Logger.Info("Game started", "chat", chatKey, "kind", kindTrivia, "topic", topic)
+	if err := c.Reply(ctx.T(c, "game.trivia_started", g.Rounds, ctx.Config.Game.TurnTimeout)); err != nil {
+		return err
+	}
+	go p.nextQuestion(ctx, chatKey, g.Started, c.Reply)
+	return nil
+}
+
+// nextQuestion 出下一题，出题失败时结束游戏。出题期间不持有 p.mu，started 用于确认游戏没有被结束或重新开始
+func (p *GamePlugin) nextQuestion(ctx *plugins.Context, chatKey string, started time.Time, send func(string) error) {
+	g := ctx.Storage.GetGame(chatKey)
+	if g == nil || !g.Started.Equal(started) {
+		return
+	}
+	q, err := p.generate(ctx, g.Topic, g.Used)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g = ctx.Storage.GetGame(chatKey)
+	if g == nil || !g.Started.Equal(started) {
+		return
+	}
+	if err != nil {
+		ctx.Logger.Error("Failed to generate question", "chat", chatKey, "error", err)
+		if _, err := ctx.Storage.DeleteGame(chatKey); err != nil {
+			ctx.Logger.Error("Failed to end game", "chat", chatKey, "error", err)
+		}
+		_ = send(i18n.T(g.Lang, "game.question_failed", results(g)))
+		return
+	}
+
+	g.Round++
+	g.Question = q.Question
+	g.Answers = q.Answers
+	g.Deadline = time.Now().Add(ctx.Config.Game.TurnTimeout)
+	if err := ctx.Storage.SetGame(chatKey, g); err != nil {
+		ctx.Logger.Error("Failed to save game", "chat", chatKey, "error", err)
+		return
+	}
+	reschedule(ctx)
+	if err := send(i18n.T(g.Lang, "game.question", g.Round, g.Rounds, q.Question)); err != nil {
+		ctx.Logger.Warn("Failed to send question", "chat", chatKey, "error", err)
+	}
+}
+
+// generate 让 AI 出一道题，避免与本局已出过的题目重复
+func (p *GamePlugin) generate(ctx *plugins.Context, topic string, asked []string) (*question, error) {
+	prompt := "出一道新题。"
+	if topic != "" {
+		prompt = "主题：" + topic + "。" + prompt
+	}
+	if len(asked) > 0 {
+		prompt += "\n不要与以下题目重复：\n" + strings.Join(asked, "\n")
+	}
+	var q question
+	if err := p.AI.GenerateStructured(ctx, "game", ctx.Config.Game.TriviaPrompt, prompt, &q); err != nil {
+		return nil, err
+	}
+	if q.Question == "" || len(q.Answers) == 0 {
+		return nil, fmt.Errorf("question without answer: %+v", q)
+	}
+	return &q, nil
+}
+
+// answerTrivia 检查作答，答错的消息交给后面的插件
+func (p *GamePlugin) answerTrivia(ctx *plugins.Context, c core.Context, g *storage.Game) error {
+	if g.Question == "" {
+		return core.ErrPass
+	}
+	answer := normalize(c.Text())
+	correct := false
+	for _, a := range g.Answers {
+		if a = normalize(a); a != "" && a == answer {
+			correct = true
+			break
+		}
+	}
+	if !correct {
+		return core.ErrPass
+	}
+
+	chatKey := policy.ChatKey(c)
+	mention, err := score(ctx, c, chatKey, g)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if err := c.Reply(i18n.T(g.Lang, "game.correct", mention, g.Answers[0])); err != nil {
+		return err
+	}
+	return p.advance(ctx, chatKey, g, c.Reply)
+}
+
+// triviaTimeout 无人答对时公布答案
+func (p *GamePlugin) triviaTimeout(ctx *plugins.Context, chatKey string, g *storage.Game, send func(string) error) error {
+	if g.Question == "" {
+		// 出题一直没有完成（如重启时正在出题），结束游戏
+		_, err := ctx.Storage.DeleteGame(chatKey)
+		return err
+	}
+	if err := send(i18n.T(g.Lang, "game.trivia_timeout", g.Answers[0])); err != nil {
+		ctx.Logger.Warn("Failed to send trivia timeout", "chat", chatKey, "error", err)
+	}
+	return p.advance(ctx, chatKey, g, send)
+}
+
+// advance 保存本题结果，出下一题或结束游戏。调用时需持有 p.mu
+func (p *GamePlugin) advance(ctx *plugins.Context, chatKey string, g *storage.Game, send func(string) error) error {
+	if g.Round >= g.Rounds {
+		if _, err := ctx.Storage.DeleteGame(chatKey); err != nil {
+			return err
+		}
+		ctx.Logger.Info("Game finished", "chat", chatKey, "kind", kindTrivia, "rounds", g.Round)
+		return send(i18n.T(g.Lang, "game.trivia_finished", results(g)))
+	}
+	g.Used = append(g.Used, g.Question)
+	g.Question = ""
+	g.Answers = nil
+	g.Deadline = time.Now().Add(generatingTimeout)
+	if err := ctx.Storage.SetGame(chatKey, g); err != nil {
+		return err
+	}
+	go p.nextQuestion(ctx, chatKey, g.Started, send)
+	return nil
+}
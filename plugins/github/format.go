@@ -0,0 +1,177 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxCommits push 通知中最多列出的提交数
+const maxCommits = 5
+
+type repository struct {
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type account struct {
+	Login string `json:"login"`
+}
+
+type payload struct {
+	Action     string     `json:"action"`
+	Repository repository `json:"repository"`
+	Sender     account    `json:"sender"`
+
+	// push
+	Ref     string `json:"ref"`
+	Created bool   `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Compare string `json:"compare"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+
+	Issue *struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	} `json:"issue"`
+
+	PullRequest *struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		Base    struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+
+	Release *struct {
+		TagName    string `json:"tag_name"`
+		Name       string `json:"name"`
+		HTMLURL    string `json:"html_url"`
+		Prerelease bool   `json:"prerelease"`
+	} `json:"release"`
+
+	WorkflowRun *struct {
+		Name       string `json:"name"`
+		HeadBranch string `json:"head_branch"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"workflow_run"`
+}
+
+// format 解析 Webhook 并生成通知文本，返回仓库全名；不需要通知的事件/动作返回空文本
+func format(event string, body []byte) (string, string, error) {
+	var pl payload
+	if err := json.Unmarshal(body, &pl); err != nil {
+		return "", "", err
+	}
+	repo := pl.Repository.FullName
+	prefix := "[" + repo + "] " + pl.Sender.Login
+
+	switch event {
+	case "push":
+		return repo, formatPush(pl, prefix), nil
+
+	case "issues":
+		if pl.Issue == nil {
+			return repo, "", nil
+		}
+		verb, ok := map[string]string{"opened": "创建了", "closed": "关闭了", "reopened": "重新打开了"}[pl.Action]
+		if !ok {
+			return repo, "", nil
+		}
+		return repo, fmt.Sprintf("🐛 %s %s issue #%d: %s\n%s", prefix, verb, pl.Issue.Number, pl.Issue.Title, pl.Issue.HTMLURL), nil
+
+	case "pull_request":
+		pr := pl.PullRequest
+		if pr == nil {
+			return repo, "", nil
+		}
+		verb, ok := map[string]string{"opened": "创建了", "closed": "关闭了", "reopened": "重新打开了", "ready_for_review": "请求审阅"}[pl.Action]
+		if !ok {
+			return repo, "", nil
+		}
+		if pl.Action == "closed" && pr.Merged {
+			verb = "合并了"
+		}
+		return repo, fmt.Sprintf("🔀 %s %s PR #%d → %s: %s\n%s", prefix, verb, pr.Number, pr.Base.Ref, pr.Title, pr.HTMLURL), nil
+
+	case "release":
+		rel := pl.Release
+		if rel == nil || pl.Action != "published" {
+			return repo, "", nil
+		}
+		kind := "版本"
+		if rel.Prerelease {
+			kind = "预发布版本"
+		}
+		title := rel.TagName
+		if rel.Name != "" && rel.Name != rel.TagName {
+			title += " " + rel.Name
+		}
+		return repo, fmt.Sprintf("🚀 %s 发布了%s %s\n%s", prefix, kind, title, rel.HTMLURL), nil
+
+	case "workflow_run":
+		run := pl.WorkflowRun
+		if run == nil || pl.Action != "completed" {
+			return repo, "", nil
+		}
+		icon := "❌"
+		switch run.Conclusion {
+		case "success":
+			icon = "✅"
+		case "cancelled", "skipped", "neutral":
+			icon = "⚪"
+		}
+		return repo, fmt.Sprintf("%s [%s] 工作流 %s 在 %s 上 %s\n%s", icon, repo, run.Name, run.HeadBranch, run.Conclusion, run.HTMLURL), nil
+	}
+	return repo, "", nil
+}
+
+func formatPush(pl payload, prefix string) string {
+	name, isTag := strings.CutPrefix(pl.Ref, "refs/tags/")
+	if !isTag {
+		name = strings.TrimPrefix(pl.Ref, "refs/heads/")
+	}
+	kind := "分支"
+	if isTag {
+		kind = "标签"
+	}
+
+	switch {
+	case pl.Deleted:
+		return fmt.Sprintf("🗑 %s 删除了%s %s", prefix, kind, name)
+	case isTag:
+		return fmt.Sprintf("🏷 %s 推送了标签 %s\n%s", prefix, name, pl.Repository.HTMLURL+"/releases/tag/"+name)
+	case len(pl.Commits) == 0:
+		if pl.Created {
+			return fmt.Sprintf("🌱 %s 创建了分支 %s", prefix, name)
+		}
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📦 %s 推送了 %d 个提交到 %s\n", prefix, len(pl.Commits), name)
+	for i, c := range pl.Commits {
+		if i == maxCommits {
+			fmt.Fprintf(&b, "... 还有 %d 个提交\n", len(pl.Commits)-maxCommits)
+			break
+		}
+		msg, _, _ := strings.Cut(c.Message, "\n")
+		id := c.ID
+		if len(id) > 7 {
+			id = id[:7]
+		}
+		fmt.Fprintf(&b, "- %s %s (%s)\n", id, msg, c.Author.Name)
+	}
+	b.WriteString(pl.Compare)
+	return b.String()
+}
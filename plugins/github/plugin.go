@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// maxPayloadSize GitHub Webhook 请求体上限（GitHub 限制为 25MB）
+const maxPayloadSize = 25 << 20
+
+// shutdownTimeout 退出时等待进行中的 Webhook 请求处理完的时间
+const shutdownTimeout = 5 * time.Second
+
+// GitHubPlugin 接收 GitHub Webhook，把仓库动态推送到配置的目标，让 ggbot 兼做 CI/仓库通知机器人
+type GitHubPlugin struct {
+	ctx    *plugins.Context
+	secret string
+	server *http.Server
+}
+
+func (p *GitHubPlugin) Name() string {
+	return "GitHub"
+}
+
+func (p *GitHubPlugin) Init(ctx *plugins.Context) error {
+	cfg := ctx.Config.GitHub
+	if !cfg.Enabled {
+		return nil
+	}
+	p.ctx = ctx
+	p.secret = cfg.Secret
+	if p.secret == "" {
+		return errors.New("github.secret is required")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+cfg.Path, p.handleWebhook)
+	p.server = &http.Server{Addr: cfg.Listen, Handler: mux}
+
+	go func() {
+		ctx.Logger.Info("GitHub webhook listening", "addr", cfg.Listen, "path", cfg.Path)
+		if err := p.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctx.Logger.Error("GitHub webhook server stopped", "error", err)
+			ctx.Alerts.Error("github", "GitHub Webhook 服务停止: "+err.Error())
+		}
+	}()
+	return nil
+}
+
+// Cleanup 退出时关闭 Webhook 服务
+func (p *GitHubPlugin) Cleanup() error {
+	if p.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return p.server.Shutdown(ctx)
+}
+
+func (p *GitHubPlugin) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := p.ctx.Logger
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+	if !validSignature(p.secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		logger.Warn("GitHub webhook signature mismatch", "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	repo, text, err := format(event, body)
+	if err != nil {
+		logger.Warn("Invalid GitHub webhook payload", "event", event, "delivery", delivery, "error", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if text == "" {
+		logger.Debug("GitHub event ignored", "event", event, "repo", repo, "delivery", delivery)
+		return
+	}
+
+	targets := routeTargets(p.ctx.Config.GitHub.Routes, repo, event)
+	logger.Info("GitHub event", "event", event, "repo", repo, "delivery", delivery, "targets", len(targets))
+	for _, target := range targets {
+		if err := p.ctx.Push(target, text); err != nil {
+			logger.Error("Failed to send GitHub notification", "target", target, "error", err)
+			p.ctx.Alerts.Warn("github:"+target, "GitHub 通知发送到 "+target+" 失败: "+err.Error())
+		}
+	}
+}
+
+// validSignature 校验 X-Hub-Signature-256（sha256=<hex HMAC>），secret 为空时一律拒绝
+func validSignature(secret, header string, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// routeTargets 返回匹配仓库和事件的路由的推送目标（去重）
+func routeTargets(routes []config.GitHubRoute, repo, event string) []string {
+	var targets []string
+	for _, route := range routes {
+		if ok, _ := path.Match(strings.ToLower(route.Repo), strings.ToLower(repo)); !ok {
+			continue
+		}
+		if len(route.Events) > 0 && !slices.Contains(route.Events, event) {
+			continue
+		}
+		for _, target := range route.Targets {
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
@@ -0,0 +1,205 @@
+package hooks
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxAlerts 一条消息中最多列出的告警数
+const maxAlerts = 10
+
+// alertmanagerPayload Prometheus Alertmanager 的 Webhook 格式，Grafana 统一告警使用相同结构并增加了几个字段
+type alertmanagerPayload struct {
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []amAlert         `json:"alerts"`
+
+	// Grafana
+	Title string `json:"title"`
+}
+
+type amAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+
+	// Grafana
+	ValueString  string `json:"valueString"`
+	DashboardURL string `json:"dashboardURL"`
+	PanelURL     string `json:"panelURL"`
+	SilenceURL   string `json:"silenceURL"`
+}
+
+// grafanaLegacyPayload 旧版 Grafana 告警（非统一告警）的 Webhook 格式
+type grafanaLegacyPayload struct {
+	Title       string `json:"title"`
+	RuleName    string `json:"ruleName"`
+	RuleURL     string `json:"ruleUrl"`
+	State       string `json:"state"`
+	Message     string `json:"message"`
+	EvalMatches []struct {
+		Metric string            `json:"metric"`
+		Value  float64           `json:"value"`
+		Tags   map[string]string `json:"tags"`
+	} `json:"evalMatches"`
+}
+
+// formatAlertmanager 按状态分组（先触发后恢复）格式化 Alertmanager 告警
+func formatAlertmanager(body []byte) (string, error) {
+	var pl alertmanagerPayload
+	if err := json.Unmarshal(body, &pl); err != nil {
+		return "", fmt.Errorf("invalid alertmanager payload: %w", err)
+	}
+	if len(pl.Alerts) == 0 {
+		return "", fmt.Errorf("invalid alertmanager payload: no alerts")
+	}
+
+	name := pl.CommonLabels["alertname"]
+	if name == "" {
+		name = pl.GroupLabels["alertname"]
+	}
+	if name == "" {
+		name = pl.Title
+	}
+
+	var b strings.Builder
+	for _, status := range []string{"firing", "resolved"} {
+		var alerts []amAlert
+		for _, a := range pl.Alerts {
+			if a.Status == status {
+				alerts = append(alerts, a)
+			}
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+
+		icon := "✅"
+		if status == "firing" {
+			icon = severityIcon(pl.CommonLabels["severity"])
+		}
+		fmt.Fprintf(&b, "%s [%s:%d] %s", icon, strings.ToUpper(status), len(alerts), name)
+		if severity := pl.CommonLabels["severity"]; severity != "" {
+			b.WriteString(" (" + severity + ")")
+		}
+		if summary := pl.CommonAnnotations["summary"]; summary != "" {
+			b.WriteString("\n" + summary)
+		}
+
+		for i, a := range alerts {
+			if i == maxAlerts {
+				fmt.Fprintf(&b, "\n... 还有 %d 条", len(alerts)-maxAlerts)
+				break
+			}
+			b.WriteString("\n\n" + alertLine(a, pl.CommonLabels, pl.CommonAnnotations))
+		}
+	}
+	return b.String(), nil
+}
+
+// alertLine 单条告警：与公共标签不同的标签、摘要/描述、时间和链接
+func alertLine(a amAlert, commonLabels, commonAnnotations map[string]string) string {
+	var labels []string
+	for _, k := range slices.Sorted(maps.Keys(a.Labels)) {
+		if k != "alertname" && commonLabels[k] != a.Labels[k] {
+			labels = append(labels, k+"="+a.Labels[k])
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("• ")
+	if len(labels) > 0 {
+		b.WriteString(strings.Join(labels, " "))
+	} else {
+		b.WriteString(a.Labels["alertname"])
+	}
+	for _, key := range []string{"summary", "description"} {
+		if v := a.Annotations[key]; v != "" && v != commonAnnotations[key] {
+			b.WriteString("\n  " + v)
+		}
+	}
+	if a.ValueString != "" {
+		b.WriteString("\n  值: " + a.ValueString)
+	}
+	if a.Status == "resolved" && !a.EndsAt.IsZero() {
+		fmt.Fprintf(&b, "\n  已恢复，持续 %s", a.EndsAt.Sub(a.StartsAt).Round(time.Second))
+	} else if !a.StartsAt.IsZero() {
+		b.WriteString("\n  开始于 " + a.StartsAt.Local().Format("01-02 15:04:05"))
+	}
+	for _, link := range []string{a.PanelURL, a.DashboardURL, a.GeneratorURL} {
+		if link != "" {
+			b.WriteString("\n  " + link)
+			break
+		}
+	}
+	return b.String()
+}
+
+// formatGrafana 格式化 Grafana 告警：统一告警与 Alertmanager 格式相同，旧版告警单独解析
+func formatGrafana(body []byte) (string, error) {
+	var probe struct {
+		Alerts json.RawMessage `json:"alerts"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return "", fmt.Errorf("invalid grafana payload: %w", err)
+	}
+	if len(probe.Alerts) > 0 {
+		return formatAlertmanager(body)
+	}
+
+	var pl grafanaLegacyPayload
+	if err := json.Unmarshal(body, &pl); err != nil {
+		return "", fmt.Errorf("invalid grafana payload: %w", err)
+	}
+	var b strings.Builder
+	switch pl.State {
+	case "ok":
+		b.WriteString("✅ [RESOLVED] ")
+	case "alerting":
+		b.WriteString("🔥 [FIRING] ")
+	default:
+		b.WriteString("⚠️ [" + strings.ToUpper(pl.State) + "] ")
+	}
+	b.WriteString(cmp.Or(pl.RuleName, pl.Title))
+	if pl.Message != "" {
+		b.WriteString("\n" + pl.Message)
+	}
+	for i, m := range pl.EvalMatches {
+		if i == maxAlerts {
+			fmt.Fprintf(&b, "\n... 还有 %d 条", len(pl.EvalMatches)-maxAlerts)
+			break
+		}
+		fmt.Fprintf(&b, "\n• %s = %g", m.Metric, m.Value)
+	}
+	if pl.RuleURL != "" {
+		b.WriteString("\n" + pl.RuleURL)
+	}
+	return b.String(), nil
+}
+
+func severityIcon(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "page", "error":
+		return "🔴"
+	case "warning", "warn":
+		return "🟠"
+	case "info", "none":
+		return "🔵"
+	}
+	return "🔥"
+}
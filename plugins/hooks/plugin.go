@@ -0,0 +1,243 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/msgtmpl"
+)
+
+// maxBodySize Webhook 请求体上限
+const maxBodySize = 1 << 20
+
+// maxMessageLength 未配置模板时 JSON 请求体转为消息的最大长度
+const maxMessageLength = 3000
+
+// shutdownTimeout 退出时等待进行中的 Webhook 请求处理完的时间
+const shutdownTimeout = 5 * time.Second
+
+// HooksPlugin 通用入站 Webhook，把外部系统的请求转为消息发送给用户
+type HooksPlugin struct {
+	ctx    *plugins.Context
+	hooks  map[string]*hook
+	server *http.Server
+}
+
+type hook struct {
+	name     string
+	token    string
+	public   bool
+	targets  []string
+	template *template.Template
+	format   func(body []byte) (string, error)
+}
+
+func (p *HooksPlugin) Name() string {
+	return "Hooks"
+}
+
+func (p *HooksPlugin) Init(ctx *plugins.Context) error {
+	cfg := ctx.Config.Hooks
+	if len(cfg.Endpoints) == 0 {
+		return nil
+	}
+	p.ctx = ctx
+	p.hooks = make(map[string]*hook, len(cfg.Endpoints))
+	for name, hookCfg := range cfg.Endpoints {
+		h, err := newHook(name, hookCfg)
+		if err != nil {
+			return err
+		}
+		if h.token == "" {
+			ctx.Logger.Warn("Webhook is public, anyone who can reach it can send messages", "hook", name)
+		}
+		p.hooks[name] = h
+	}
+
+	p.server = &http.Server{Addr: cfg.Listen, Handler: newMux(p)}
+
+	go func() {
+		ctx.Logger.Info("Webhooks listening", "addr", cfg.Listen, "hooks", slices.Sorted(maps.Keys(p.hooks)))
+		if err := p.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ctx.Logger.Error("Webhook server stopped", "error", err)
+			ctx.Alerts.Error("hooks", "Webhook 服务停止: "+err.Error())
+		}
+	}()
+	return nil
+}
+
+// Cleanup 退出时关闭 Webhook 服务
+func (p *HooksPlugin) Cleanup() error {
+	if p.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return p.server.Shutdown(ctx)
+}
+
+func newMux(p *HooksPlugin) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hook/{name}", p.handleHook)
+	return mux
+}
+
+func newHook(name string, cfg config.HookConfig) (*hook, error) {
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("hook %s: no targets", name)
+	}
+	if cfg.Token == "" && !cfg.Public {
+		return nil, fmt.Errorf("hook %s: token is required unless public is true", name)
+	}
+	h := &hook{name: name, token: cfg.Token, public: cfg.Public, targets: cfg.Targets}
+	switch cfg.Format {
+	case "":
+	case "alertmanager":
+		h.format = formatAlertmanager
+	case "grafana":
+		h.format = formatGrafana
+	default:
+		return nil, fmt.Errorf("hook %s: unknown format %q", name, cfg.Format)
+	}
+	if cfg.Template != "" {
+		tmpl, err := msgtmpl.Parse(name, cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s: %w", name, err)
+		}
+		h.template = tmpl
+	}
+	return h, nil
+}
+
+func (p *HooksPlugin) handleHook(w http.ResponseWriter, r *http.Request) {
+	logger := p.ctx.Logger
+	name := r.PathValue("name")
+	h, ok := p.hooks[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.authorized(r) {
+		logger.Warn("Webhook unauthorized", "hook", name, "remote", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+	data, err := parseBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		logger.Warn("Webhook render failed", "hook", name, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 模板按目标渲染，{{.Date}}、{{.Weather}} 等变量取决于目标
+	texts := make(map[string]string, len(h.targets))
+	for _, target := range h.targets {
+		text, err := h.render(p.ctx, data, body, target)
+		if err != nil {
+			logger.Warn("Webhook render failed", "hook", name, "target", target, "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// 模板可以通过输出空内容忽略某些请求
+		if strings.TrimSpace(text) != "" {
+			texts[target] = text
+		}
+	}
+	if len(texts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var errs []error
+	for _, target := range h.targets {
+		text, ok := texts[target]
+		if !ok {
+			continue
+		}
+		if err := p.ctx.Push(target, text); err != nil {
+			logger.Error("Failed to send webhook message", "hook", name, "target", target, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	logger.Info("Webhook delivered", "hook", name, "targets", len(texts), "failed", len(errs))
+	if len(errs) == len(texts) {
+		http.Error(w, errors.Join(errs...).Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorized 校验 Authorization: Bearer <token> 或 ?token=，没有 token 的端点只在 public 时放行
+func (h *hook) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return h.public
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		got = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h.token)) == 1
+}
+
+// parseBody 解析请求体作为模板数据：JSON 解析后的值，其他请求体为字符串
+func parseBody(contentType string, body []byte) (any, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var data any = string(body)
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// render 生成发给 target 的消息。有模板时请求体作为模板数据，JSON 对象中还可以使用 {{.Date}}、{{.Target}} 等变量
+// （请求体中的同名字段优先）。没有模板时使用内置格式；都没有时纯文本直接发送，JSON 使用其中的 text/message 字段，否则发送格式化的 JSON。
+func (h *hook) render(ctx *plugins.Context, data any, body []byte, target string) (string, error) {
+	if h.template != nil {
+		if fields, ok := data.(map[string]any); ok {
+			return msgtmpl.Execute(ctx, h.template, target, fields)
+		}
+		var b bytes.Buffer
+		if err := h.template.Execute(&b, data); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+
+	if h.format != nil {
+		return h.format(body)
+	}
+
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case map[string]any:
+		for _, key := range []string{"text", "message"} {
+			if s, ok := v[key].(string); ok && s != "" {
+				return s, nil
+			}
+		}
+	}
+	out, _ := json.MarshalIndent(data, "", "  ")
+	return msgtmpl.Truncate(string(out), maxMessageLength), nil
+}
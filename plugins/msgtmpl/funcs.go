@@ -0,0 +1,62 @@
+package msgtmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Funcs 模板中可用的函数，参数顺序与 sprig 相同，被处理的值放在最后以便用于管道，如 {{.Text | truncate 100}}
+var Funcs = template.FuncMap{
+	"json": func(v any) string {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		return string(b)
+	},
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"truncate":  func(n int, s string) string { return Truncate(s, n) },
+	"replace":   func(old, repl, s string) string { return strings.ReplaceAll(s, old, repl) },
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"repeat":    func(n int, s string) string { return strings.Repeat(s, max(n, 0)) },
+	"quote":     strconv.Quote,
+	"add":       func(a, b int) int { return a + b },
+	"sub":       func(a, b int) int { return a - b },
+	// now 为服务器时区的当前时间，按目标时区请使用 .Now
+	"now":  time.Now,
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	"default": func(def, v any) any {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"join": func(sep string, v any) string {
+		switch items := v.(type) {
+		case []string:
+			return strings.Join(items, sep)
+		case []any:
+			parts := make([]string, len(items))
+			for i, item := range items {
+				parts[i] = fmt.Sprint(item)
+			}
+			return strings.Join(parts, sep)
+		}
+		return fmt.Sprint(v)
+	},
+}
+
+// Truncate 截断到 n 个字符，截断时加上省略号
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,127 @@
+// Package msgtmpl 渲染推送提示词、Webhook 模板和 /broadcast 消息中的 Go text/template 模板，
+// 变量按发送目标解析：{{.Date}}、{{.Time}}、{{.Weekday}}、{{.Now}} 按目标用户的时区，
+// {{.Target}}、{{.User}}、{{.City}}，以及用到时才查询的 {{.Weather}}
+package msgtmpl
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+)
+
+// weatherTTL 天气查询结果的缓存时间，同一城市的多个目标只查询一次
+const weatherTTL = 30 * time.Minute
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Parse 解析模板，可以使用 Funcs 中的函数
+func Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(Funcs).Parse(text)
+}
+
+// Render 按目标渲染模板，不包含 {{ 的文本原样返回
+func Render(ctx *plugins.Context, name, text, target string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := Parse(name, text)
+	if err != nil {
+		return "", err
+	}
+	return Execute(ctx, t, target, nil)
+}
+
+// Execute 使用目标的变量执行模板，data 中的同名字段优先
+func Execute(ctx *plugins.Context, t *template.Template, target string, data map[string]any) (string, error) {
+	vars := Vars(ctx, target)
+	maps.Copy(vars, data)
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Vars 目标的模板变量。私聊目标使用该用户 /tz 设置的时区和 /city 设置的城市，
+// 群聊或没有目标时使用服务器时区和 templates.city
+func Vars(ctx *plugins.Context, target string) map[string]any {
+	location := time.Local
+	city := ctx.Config.Templates.City
+	userKey, ok := policy.TargetUserKey(target)
+	if ok {
+		location = core.UserLocation(ctx.Storage, userKey)
+		if c := ctx.Storage.GetUserProfile(userKey).City; c != "" {
+			city = c
+		}
+	}
+	now := time.Now().In(location)
+	return map[string]any{
+		"Now":     now,
+		"Date":    now.Format("2006-01-02"),
+		"Time":    now.Format("15:04"),
+		"Weekday": now.Weekday().String(),
+		"Target":  target,
+		"User":    userKey,
+		"City":    city,
+		"Weather": &weather{ctx: ctx, city: city},
+	}
+}
+
+// weather 城市的天气，模板输出时才查询，查询失败时为空
+type weather struct {
+	ctx  *plugins.Context
+	city string
+	once sync.Once
+	text string
+}
+
+func (w *weather) String() string {
+	w.once.Do(func() {
+		text, err := fetchWeather(w.ctx, w.city)
+		if err != nil {
+			w.ctx.Logger.Warn("Failed to fetch weather for template", "city", w.city, "error", err)
+		}
+		w.text = text
+	})
+	return w.text
+}
+
+// fetchWeather 从 templates.weather_url 查询天气，结果缓存 weatherTTL
+func fetchWeather(ctx *plugins.Context, city string) (string, error) {
+	weatherURL := ctx.Config.Templates.WeatherURL
+	if city == "" || weatherURL == "off" {
+		return "", nil
+	}
+	key := "weather:" + city
+	if text, ok := ctx.Storage.Get(key); ok {
+		return text, nil
+	}
+
+	resp, err := client.Get(strings.ReplaceAll(weatherURL, "{city}", url.PathEscape(city)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, Truncate(strings.TrimSpace(string(body)), 200))
+	}
+	text := strings.TrimSpace(string(body))
+	if err := ctx.Storage.SetWithTTL(key, text, weatherTTL); err != nil {
+		ctx.Logger.Warn("Failed to cache weather", "city", city, "error", err)
+	}
+	return text, nil
+}
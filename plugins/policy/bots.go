@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"log/slog"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// BotGuard 过滤其他机器人发来的消息：默认忽略，可按会话放行；
+// 与机器人连续对话超过 MaxTurns 轮时停止回复，直到有真人发言或窗口过期。
+// 计数保存在存储的缓存中，窗口过期后自动清理
+type BotGuard struct {
+	cfg    config.BotsConfig
+	store  *storage.Storage
+	logger *slog.Logger
+}
+
+func NewBotGuard(cfg config.BotsConfig, store *storage.Storage, logger *slog.Logger) *BotGuard {
+	return &BotGuard{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Wrap returns a handler that only runs h for messages the guard allows
+func (g *BotGuard) Wrap(h core.Handler) core.Handler {
+	return func(c core.Context) error {
+		if !g.Allow(c) {
+			return nil
+		}
+		return h(c)
+	}
+}
+
+// Allow reports whether the bot should handle the message
+func (g *BotGuard) Allow(c core.Context) bool {
+	chatKey := ChatKey(c)
+	// 自上次真人发言以来回复机器人的次数
+	key := "bots:" + chatKey
+	if !c.Sender().IsBot {
+		_ = g.store.Delete(key)
+		return true
+	}
+
+	if g.cfg.Policy != "allow" && !g.store.BotsAllowed(chatKey) {
+		return false
+	}
+
+	turns, err := g.store.Incr(key, g.cfg.Window)
+	if err != nil {
+		g.logger.Warn("Failed to save bot turns", "chat", chatKey, "error", err)
+	}
+	if turns <= g.cfg.MaxTurns {
+		return true
+	}
+	if turns == g.cfg.MaxTurns+1 {
+		g.logger.Warn("Bot conversation loop detected, ignoring bot messages", "chat", chatKey, "bot", c.Sender().ID, "turns", g.cfg.MaxTurns)
+	}
+	return false
+}
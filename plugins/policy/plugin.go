@@ -0,0 +1,230 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// regexPrefix marks a banned topic as a regular expression, e.g. "re:股票|基金"
+const regexPrefix = "re:"
+
+// PolicyPlugin 管理每个会话的禁聊话题
+type PolicyPlugin struct{}
+
+func (p *PolicyPlugin) Name() string {
+	return "Policy"
+}
+
+// ChatKey returns the storage key for the chat of c
+func ChatKey(c core.Context) string {
+	return c.Platform() + ":" + c.Chat().ID
+}
+
+// ErrNoPushTarget 当前会话不能作为主动推送目标（QQ 群和频道）
+var ErrNoPushTarget = errors.New("chat cannot receive pushes")
+
+// PushTarget 当前会话作为主动推送目标（SendTo）的地址，不能主动推送时返回 ErrNoPushTarget
+func PushTarget(c core.Context) (string, error) {
+	chat := c.Chat()
+	switch c.Platform() {
+	case "QQ":
+		// QQ 只能主动推送到单聊
+		if chat.Type != "private" || chat.ID != c.Sender().ID {
+			return "", ErrNoPushTarget
+		}
+		return "QQ:User:" + chat.ID, nil
+	case "Telegram":
+		if chat.ThreadID != "" {
+			return "Telegram:" + chat.ID + ":topic:" + chat.ThreadID, nil
+		}
+	}
+	return c.Platform() + ":" + chat.ID, nil
+}
+
+// TargetUserKey 将私聊推送目标转换为用户存储 key，如 "QQ:User:ABC" → "QQ:ABC"；群聊目标返回 false
+func TargetUserKey(target string) (string, bool) {
+	platform, rest, ok := strings.Cut(target, ":")
+	if !ok {
+		return "", false
+	}
+	if strings.EqualFold(platform, "QQ") {
+		id, ok := strings.CutPrefix(rest, "User:")
+		return platform + ":" + id, ok
+	}
+	// Telegram 群组 ID 为负数
+	if strings.HasPrefix(rest, "-") {
+		return "", false
+	}
+	return platform + ":" + rest, true
+}
+
+// Prompt 生成注入到系统提示词中的禁聊说明，没有禁聊话题时返回空字符串
+func Prompt(topics []string) string {
+	if len(topics) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(topics))
+	for _, t := range topics {
+		names = append(names, strings.TrimPrefix(t, regexPrefix))
+	}
+	return "\n\n本会话禁止讨论以下话题：" + strings.Join(names, "、") +
+		"。如果用户的问题涉及这些话题，请礼貌地拒绝回答，不要输出任何相关内容。"
+}
+
+// patterns 编译过的正则话题，话题由管理员添加，数量有限，编译一次后一直复用；无效的正则记为 nil
+var patterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: map[string]*regexp.Regexp{}}
+
+// compile 返回编译好的正则，无效时返回 nil
+func compile(pattern string) *regexp.Regexp {
+	patterns.Lock()
+	defer patterns.Unlock()
+	re, ok := patterns.compiled[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		patterns.compiled[pattern] = re
+	}
+	return re
+}
+
+// Check 检查文本是否触犯禁聊话题，返回命中的话题
+func Check(topics []string, text string) (string, bool) {
+	lower := strings.ToLower(text)
+	for _, t := range topics {
+		if pattern, ok := strings.CutPrefix(t, regexPrefix); ok {
+			if re := compile(pattern); re != nil && re.MatchString(text) {
+				return t, true
+			}
+			continue
+		}
+		if strings.Contains(lower, strings.ToLower(t)) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func (p *PolicyPlugin) Init(ctx *plugins.Context) error {
+	s := ctx.Storage
+	cfg := ctx.Config
+
+	// Handler: /policy
+	ctx.AddCommand(policyCommand(ctx))
+
+	// Handler: /bots - 本会话是否回复其他机器人的消息
+	ctx.AddCommand(&core.Command{
+		Name:        "/bots",
+		Description: "查看/设置是否回复其他机器人",
+		Args:        []core.Arg{{Name: "操作", Optional: true, Choices: []string{"allow", "deny"}}},
+		Handler: func(c core.Context, args core.Args) error {
+			chatKey := ChatKey(c)
+			op, ok := args["操作"]
+			if !ok {
+				status := ctx.T(c, "bots.ignore")
+				if cfg.Bots.Policy == "allow" || s.BotsAllowed(chatKey) {
+					status = ctx.T(c, "bots.reply", cfg.Bots.MaxTurns)
+				}
+				return c.Reply(ctx.T(c, "bots.status", status))
+			}
+
+			if !cfg.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "bots.admin_only"))
+			}
+			if err := s.SetBotsAllowed(chatKey, op == "allow"); err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			if op == "allow" {
+				return c.Reply(ctx.T(c, "bots.allowed"))
+			}
+			if cfg.Bots.Policy == "allow" {
+				return c.Reply(ctx.T(c, "bots.global_allow"))
+			}
+			return c.Reply(ctx.T(c, "bots.denied"))
+		},
+	})
+
+	return nil
+}
+
+// policyCommand /policy 查看本会话的禁聊话题，机器人管理员和群管理员可以 add|del|clear|log
+func policyCommand(ctx *plugins.Context) *core.Command {
+	s := ctx.Storage
+	admin := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.CanManageChat(c) {
+				return c.Reply(ctx.T(c, "policy.admin_only"))
+			}
+			return handler(c, args)
+		}
+	}
+
+	return &core.Command{
+		Name:        "/policy",
+		Description: "查看/管理本会话禁聊话题",
+		Handler: func(c core.Context, _ core.Args) error {
+			topics := s.GetBannedTopics(ChatKey(c))
+			if len(topics) == 0 {
+				return c.Reply(ctx.T(c, "policy.empty"))
+			}
+			return c.Reply(ctx.T(c, "policy.list", strings.Join(topics, "\n- ")))
+		},
+		Subcommands: []*core.Command{
+			{Name: "add", Args: []core.Arg{{Name: "话题", Rest: true}}, Handler: admin(func(c core.Context, args core.Args) error {
+				chatKey := ChatKey(c)
+				topic := args["话题"]
+				if pattern, ok := strings.CutPrefix(topic, regexPrefix); ok {
+					if _, err := regexp.Compile(pattern); err != nil {
+						return c.Reply(ctx.T(c, "policy.invalid_regex", err))
+					}
+				}
+				added, err := s.AddBannedTopic(chatKey, topic)
+				if err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				if !added {
+					return c.Reply(ctx.T(c, "policy.exists"))
+				}
+				ctx.Logger.Info("Banned topic added", "chat", chatKey, "topic", topic, "by", c.Sender().ID)
+				return c.Reply(ctx.T(c, "policy.added", topic))
+			})},
+			{Name: "del", Aliases: []string{"remove"}, Args: []core.Arg{{Name: "话题", Rest: true}}, Handler: admin(func(c core.Context, args core.Args) error {
+				topic := args["话题"]
+				removed, err := s.RemoveBannedTopic(ChatKey(c), topic)
+				if err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				if !removed {
+					return c.Reply(ctx.T(c, "policy.not_found", topic))
+				}
+				return c.Reply(ctx.T(c, "policy.removed", topic))
+			})},
+			{Name: "clear", Handler: admin(func(c core.Context, _ core.Args) error {
+				if err := s.ClearBannedTopics(ChatKey(c)); err != nil {
+					return c.Reply(ctx.T(c, "common.save_failed", err))
+				}
+				return c.Reply(ctx.T(c, "policy.cleared"))
+			})},
+			{Name: "log", Handler: admin(func(c core.Context, _ core.Args) error {
+				violations := s.GetPolicyViolations(ChatKey(c))
+				if len(violations) == 0 {
+					return c.Reply(ctx.T(c, "policy.log_empty"))
+				}
+				var b strings.Builder
+				b.WriteString(ctx.T(c, "policy.log_title"))
+				start := max(0, len(violations)-10)
+				loc := ctx.Location(c)
+				for _, v := range violations[start:] {
+					b.WriteString(ctx.T(c, "policy.log_item", v.Time.In(loc).Format("01-02 15:04"), v.UserID, v.Topic, v.Prompt))
+				}
+				return c.Reply(b.String())
+			})},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+)
+
+// Router 按配置的路由表决定消息由哪些插件处理，按顺序匹配，第一条匹配的规则生效；
+// 没有规则匹配时所有插件照常处理（指令交给对应的指令处理器，其余交给文字处理器）
+type Router struct {
+	routes []route
+	logger *slog.Logger
+}
+
+type route struct {
+	config.RouteConfig
+	regex *regexp.Regexp
+}
+
+func NewRouter(routes []config.RouteConfig, logger *slog.Logger) (*Router, error) {
+	r := &Router{logger: logger}
+	for i, rc := range routes {
+		rt := route{RouteConfig: rc}
+		if rc.Regex != "" {
+			re, err := regexp.Compile(rc.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("routes[%d]: %w", i, err)
+			}
+			rt.regex = re
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r, nil
+}
+
+// Match returns the first route matching the message, nil if none matches
+func (r *Router) Match(c core.Context) *config.RouteConfig {
+	if r == nil {
+		return nil
+	}
+	for i := range r.routes {
+		if r.routes[i].matches(c) {
+			return &r.routes[i].RouteConfig
+		}
+	}
+	return nil
+}
+
+// Wrap returns a handler of the plugin that only runs when the matching route allows the plugin
+func (r *Router) Wrap(plugin string, h core.Handler) core.Handler {
+	if r == nil || len(r.routes) == 0 {
+		return h
+	}
+	return func(c core.Context) error {
+		rt := r.Match(c)
+		if rt == nil {
+			return h(c)
+		}
+		if rt.Drop {
+			r.logger.Debug("Message dropped by route", "plugin", plugin, "chat", ChatKey(c))
+			return nil
+		}
+		if len(rt.Plugins) > 0 && !slices.ContainsFunc(rt.Plugins, func(p string) bool { return strings.EqualFold(p, plugin) }) {
+			// 交给处理链中的下一个插件
+			r.logger.Debug("Message routed away", "plugin", plugin, "chat", ChatKey(c))
+			return core.ErrPass
+		}
+		return h(c)
+	}
+}
+
+func (rt *route) matches(c core.Context) bool {
+	if rt.Platform != "" && !strings.EqualFold(rt.Platform, c.Platform()) {
+		return false
+	}
+	if rt.Chat != "" {
+		if ok, _ := path.Match(rt.Chat, c.Chat().ID); !ok {
+			return false
+		}
+	}
+	if rt.ChatType != "" && rt.ChatType != c.Chat().Type {
+		return false
+	}
+	text := strings.TrimSpace(c.Text())
+	if rt.Command != "" {
+		var cmd string
+		if fields := strings.Fields(text); len(fields) > 0 {
+			cmd, _, _ = strings.Cut(fields[0], "@")
+		}
+		if !strings.EqualFold(cmd, rt.Command) {
+			return false
+		}
+	}
+	if rt.regex != nil && !rt.regex.MatchString(text) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package poll
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// voteCallback 投票按钮的回调名，数据为 "<投票编号>:<选项序号>"
+const voteCallback = "poll"
+
+const (
+	minOptions     = 2
+	maxOptions     = 10
+	maxQuestion    = 200
+	maxOptionRunes = 50
+)
+
+// PollPlugin 投票：/poll "问题" 选项1 选项2 ... 发起投票，成员点击按钮投票（不支持按钮的平台发送
+// /poll vote 编号 选项），/poll close 结束投票并公布结果。投票保存在 storage 中，每人一票，可以改投
+type PollPlugin struct{}
+
+func (p *PollPlugin) Name() string {
+	return "Poll"
+}
+
+func (p *PollPlugin) Init(ctx *plugins.Context) error {
+	// Handler: /poll
+	ctx.AddCommand(p.command(ctx))
+
+	// Handler: 投票按钮
+	ctx.RegisterCallback(voteCallback, func(c core.Context) error {
+		if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+			return nil
+		}
+		id, option, _ := strings.Cut(c.Data(), ":")
+		n, err := strconv.Atoi(option)
+		if err != nil {
+			return nil
+		}
+		return p.vote(ctx, c, id, n, true)
+	})
+	return nil
+}
+
+// command /poll ["问题" 选项...] | list | vote <编号> <选项> | close [编号]
+func (p *PollPlugin) command(ctx *plugins.Context) *core.Command {
+	allowed := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAllowed(c.Platform(), c.Sender().ID) {
+				return nil
+			}
+			return handler(c, args)
+		}
+	}
+	list := allowed(func(c core.Context, _ core.Args) error {
+		return p.list(ctx, c)
+	})
+
+	return &core.Command{
+		Name:        "/poll",
+		Description: "发起投票",
+		ArgsUsage:   `["问题" 选项1 选项2 ...]`,
+		Args:        []core.Arg{{Name: "投票", Optional: true, Rest: true}},
+		Handler: allowed(func(c core.Context, args core.Args) error {
+			if !args.Has("投票") {
+				return p.list(ctx, c)
+			}
+			return p.create(ctx, c, args["投票"])
+		}),
+		Subcommands: []*core.Command{
+			{Name: "list", Handler: list},
+			{Name: "vote", Args: []core.Arg{{Name: "编号"}, {Name: "选项"}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				n, err := strconv.Atoi(args["选项"])
+				if err != nil {
+					return core.ErrUsage
+				}
+				return p.vote(ctx, c, args["编号"], n-1, false)
+			})},
+			{Name: "close", Args: []core.Arg{{Name: "编号", Optional: true}}, Handler: allowed(func(c core.Context, args core.Args) error {
+				return p.close(ctx, c, args["编号"])
+			})},
+		},
+	}
+}
+
+func (p *PollPlugin) create(ctx *plugins.Context, c core.Context, text string) error {
+	fields := splitQuoted(text)
+	if len(fields) < 1+minOptions {
+		return c.Reply(ctx.T(c, "poll.usage"))
+	}
+	question, options := fields[0], fields[1:]
+	if len(options) > maxOptions {
+		return c.Reply(ctx.T(c, "poll.too_many_options", maxOptions))
+	}
+	if len([]rune(question)) > maxQuestion || slices.ContainsFunc(options, func(o string) bool { return len([]rune(o)) > maxOptionRunes }) {
+		return c.Reply(ctx.T(c, "poll.too_long", maxQuestion, maxOptionRunes))
+	}
+	for i, option := range options {
+		if slices.Contains(options[:i], option) {
+			return c.Reply(ctx.T(c, "poll.duplicate_option", option))
+		}
+	}
+
+	chatKey := policy.ChatKey(c)
+	poll, ok, err := ctx.Storage.CreatePoll(chatKey, question, options, core.UserKey(c))
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "poll.too_many_polls", storage.MaxOpenPolls))
+	}
+	ctx.Logger.Info("Poll created", "chat", chatKey, "poll", poll.ID, "by", core.UserKey(c))
+	text, rows := render(ctx, c, poll)
+	_, err = c.SendButtons(text, rows)
+	return err
+}
+
+// vote 记录投票。按钮投票时尽量原地刷新投票消息中的计数，平台不支持时回复投票结果
+func (p *PollPlugin) vote(ctx *plugins.Context, c core.Context, id string, option int, button bool) error {
+	poll, ok, changed, err := ctx.Storage.Vote(policy.ChatKey(c), id, core.UserKey(c), option)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "poll.not_found", id))
+	}
+	if button {
+		if !changed {
+			return nil
+		}
+		text, rows := render(ctx, c, poll)
+		if err := core.UpdateButtons(c, text, rows); err == nil || !errors.Is(err, core.ErrNotSupported) {
+			return err
+		}
+	}
+	return c.Reply(ctx.T(c, "poll.voted", poll.Options[option], poll.Tally()[option]))
+}
+
+// list 列出本会话进行中的投票，重新发送投票按钮
+func (p *PollPlugin) list(ctx *plugins.Context, c core.Context) error {
+	polls := ctx.Storage.GetPolls(policy.ChatKey(c))
+	if len(polls) == 0 {
+		return c.Reply(ctx.T(c, "poll.none"))
+	}
+	for _, poll := range polls {
+		text, rows := render(ctx, c, poll)
+		if _, err := c.SendButtons(text, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close 结束投票并公布结果，编号为空时结束最近发起的投票。只有发起人和群管理员可以结束
+func (p *PollPlugin) close(ctx *plugins.Context, c core.Context, id string) error {
+	chatKey := policy.ChatKey(c)
+	polls := ctx.Storage.GetPolls(chatKey)
+	i := len(polls) - 1
+	if id != "" {
+		i = slices.IndexFunc(polls, func(poll storage.Poll) bool { return poll.ID == id })
+	}
+	if i < 0 {
+		return c.Reply(ctx.T(c, "poll.not_found", id))
+	}
+	if polls[i].Creator != core.UserKey(c) && !ctx.CanManageChat(c) {
+		return c.Reply(ctx.T(c, "poll.close_denied"))
+	}
+
+	poll, ok, err := ctx.Storage.ClosePoll(chatKey, polls[i].ID)
+	if err != nil {
+		return c.Reply(ctx.T(c, "common.save_failed", err))
+	}
+	if !ok {
+		return c.Reply(ctx.T(c, "poll.not_found", polls[i].ID))
+	}
+	ctx.Logger.Info("Poll closed", "chat", chatKey, "poll", poll.ID, "votes", len(poll.Votes), "by", core.UserKey(c))
+	return c.Reply(results(ctx, c, poll))
+}
+
+// render 进行中的投票：问题、每个选项的票数和比例，每个选项一个按钮
+func render(ctx *plugins.Context, c core.Context, poll storage.Poll) (string, [][]core.Button) {
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "poll.title", poll.ID, poll.Question))
+	tally := poll.Tally()
+	var rows [][]core.Button
+	for i, option := range poll.Options {
+		b.WriteString("\n" + line(ctx, c, i, option, tally[i], len(poll.Votes)))
+		rows = append(rows, []core.Button{{
+			Text: fmt.Sprintf("%s (%d)", option, tally[i]),
+			Name: voteCallback,
+			Data: poll.ID + ":" + strconv.Itoa(i),
+		}})
+	}
+	b.WriteString("\n\n" + ctx.T(c, "poll.footer", len(poll.Votes), poll.ID))
+	return b.String(), rows
+}
+
+// results 结束的投票：票数、比例和得票最多的选项
+func results(ctx *plugins.Context, c core.Context, poll storage.Poll) string {
+	var b strings.Builder
+	b.WriteString(ctx.T(c, "poll.closed", poll.ID, poll.Question))
+	tally := poll.Tally()
+	for i, option := range poll.Options {
+		b.WriteString("\n" + line(ctx, c, i, option, tally[i], len(poll.Votes)))
+	}
+	b.WriteString("\n\n")
+	best := slices.Max(tally)
+	if best == 0 {
+		b.WriteString(ctx.T(c, "poll.no_votes"))
+		return b.String()
+	}
+	var winners []string
+	for i, n := range tally {
+		if n == best {
+			winners = append(winners, poll.Options[i])
+		}
+	}
+	b.WriteString(ctx.T(c, "poll.winner", strings.Join(winners, "、"), len(poll.Votes)))
+	return b.String()
+}
+
+// line 一个选项的票数和比例，如 "1. 火锅 ▓▓▓░░░░░░░ 3（30%）"
+func line(ctx *plugins.Context, c core.Context, i int, option string, votes, total int) string {
+	percent := 0
+	if total > 0 {
+		percent = votes * 100 / total
+	}
+	bar := strings.Repeat("▓", percent/10) + strings.Repeat("░", 10-percent/10)
+	return fmt.Sprintf("%d. %s %s ", i+1, option, bar) + ctx.T(c, "poll.votes", votes, percent)
+}
+
+// splitQuoted 按空白分隔参数，引号（英文引号或中文双引号）中的空白不分隔，如 `"午饭吃什么" 火锅 "麻辣 烫"`
+func splitQuoted(text string) []string {
+	var fields []string
+	var b strings.Builder
+	var closing rune
+	inField := false
+	for _, r := range text {
+		switch {
+		case closing != 0:
+			if r == closing {
+				closing = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '"' || r == '“' || r == '\'':
+			closing = map[rune]rune{'"': '"', '“': '”', '\'': '\''}[r]
+			inField = true
+		case unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, strings.TrimSpace(b.String()))
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, strings.TrimSpace(b.String()))
+	}
+	return slices.DeleteFunc(fields, func(f string) bool { return f == "" })
+}
@@ -0,0 +1,86 @@
+package system
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+// maxBackupList /backup 最多列出的备份数
+const maxBackupList = 10
+
+// backupCommand /backup 查看本地备份，/backup now 立即备份（管理员）
+func backupCommand(ctx *plugins.Context) *core.Command {
+	admin := func(handler func(c core.Context) error) func(c core.Context, _ core.Args) error {
+		return func(c core.Context, _ core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "backup.admin_only"))
+			}
+			return handler(c)
+		}
+	}
+	list := admin(func(c core.Context) error {
+		backups, err := ctx.Backups.List()
+		if err != nil {
+			return c.Reply(ctx.T(c, "backup.failed", err))
+		}
+		var b strings.Builder
+		if ctx.Config.Backup.Enabled {
+			b.WriteString(ctx.T(c, "backup.schedule", ctx.Config.Backup.Interval, ctx.Config.Backup.Keep))
+		} else {
+			b.WriteString(ctx.T(c, "backup.schedule_off"))
+		}
+		if len(backups) == 0 {
+			b.WriteString(ctx.T(c, "backup.empty"))
+		}
+		loc := ctx.Location(c)
+		for i, backup := range backups {
+			if i == maxBackupList {
+				break
+			}
+			b.WriteString("• " + backup.Name + "  " + backup.Time.In(loc).Format("01-02 15:04") + "  " + formatSize(backup.Size) + "\n")
+		}
+		b.WriteString(ctx.T(c, "backup.footer"))
+		return c.Reply(b.String())
+	})
+	now := admin(func(c core.Context) error {
+		runCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		result, err := ctx.Backups.Run(runCtx)
+		if err != nil && result.Name == "" {
+			return c.Reply(ctx.T(c, "backup.failed", err))
+		}
+		reply := ctx.T(c, "backup.done", result.Name, formatSize(result.Size))
+		switch {
+		case err != nil:
+			reply += "\n" + ctx.T(c, "backup.upload_failed", err)
+		case result.Uploaded != "":
+			reply += "\n" + ctx.T(c, "backup.uploaded", result.Uploaded)
+		}
+		ctx.Logger.Info("Manual backup", "file", result.Name, "by", core.UserKey(c))
+		return c.Reply(reply)
+	})
+
+	return &core.Command{
+		Name:        "/backup",
+		Description: "查看存储备份，now 立即备份（管理员）",
+		Admin:       true,
+		Handler:     list,
+		Subcommands: []*core.Command{{Name: "now", Handler: now}},
+	}
+}
+
+// formatSize 文件大小，如 "12.3 KB"
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	}
+	return strconv.FormatInt(n, 10) + " B"
+}
@@ -0,0 +1,167 @@
+package system
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+const (
+	defaultHistoryCount = 20
+	maxHistoryCount     = 100
+	// maxHistoryLine /history 中每条消息最多显示的字数
+	maxHistoryLine = 200
+)
+
+// historyRecord 导出的一条消息
+type historyRecord struct {
+	Chat string `json:"chat"`
+	storage.LoggedMessage
+}
+
+// historyCommand /history [N] 查看本会话最近的消息（私聊或群管理员），
+// /history export [jsonl|csv] [会话|all] [anon] 管理员导出消息日志
+func historyCommand(ctx *plugins.Context) *core.Command {
+	enabled := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.HistoryLog.Enabled {
+				return c.Reply(ctx.T(c, "history.disabled"))
+			}
+			return handler(c, args)
+		}
+	}
+
+	show := enabled(func(c core.Context, args core.Args) error {
+		if !ctx.CanManageChat(c) {
+			return c.Reply(ctx.T(c, "history.admin_only"))
+		}
+		n := defaultHistoryCount
+		if args.Has("条数") {
+			var err error
+			if n, err = strconv.Atoi(args["条数"]); err != nil || n <= 0 {
+				return core.ErrUsage
+			}
+			n = min(n, maxHistoryCount)
+		}
+		messages := ctx.Storage.GetMessageLog(policy.ChatKey(c), n)
+		if len(messages) == 0 {
+			return c.Reply(ctx.T(c, "history.empty"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "history.title", len(messages)))
+		loc := ctx.Location(c)
+		for _, m := range messages {
+			who := "🤖"
+			if m.Direction == storage.DirectionIn {
+				who = m.Username
+				if who == "" {
+					who = m.UserID
+				}
+			}
+			text := []rune(m.Text)
+			if len(text) > maxHistoryLine {
+				text = append(text[:maxHistoryLine], '…')
+			}
+			b.WriteString(m.Time.In(loc).Format("01-02 15:04") + " " + who + ": " + string(text) + "\n")
+		}
+		return c.Reply(b.String())
+	})
+
+	export := enabled(func(c core.Context, args core.Args) error {
+		if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+			return c.Reply(ctx.T(c, "history.export_admin_only"))
+		}
+		chats := []string{policy.ChatKey(c)}
+		switch target := args["会话"]; target {
+		case "":
+		case "all":
+			chats = ctx.Storage.MessageLogChats()
+		default:
+			chats = []string{target}
+		}
+		var records []historyRecord
+		for _, chat := range chats {
+			name := chat
+			if args.Has("anon") {
+				name = ctx.Anonymizer.Key(chat)
+			}
+			for _, m := range ctx.Storage.GetMessageLog(chat, 0) {
+				if args.Has("anon") {
+					m.Text = ctx.Anonymizer.Text(m.Text, m.UserID)
+					m.UserID = ctx.Anonymizer.ID(m.UserID)
+					m.Username = ""
+				}
+				records = append(records, historyRecord{Chat: name, LoggedMessage: m})
+			}
+		}
+		if len(records) == 0 {
+			return c.Reply(ctx.T(c, "history.empty"))
+		}
+
+		format := args["格式"]
+		if format == "" {
+			format = "jsonl"
+		}
+		data, err := encodeHistory(records, format)
+		if err != nil {
+			return c.Reply(ctx.T(c, "history.export_failed", err))
+		}
+		mimeType := "application/x-ndjson"
+		if format == "csv" {
+			mimeType = "text/csv"
+		}
+		ctx.Logger.Info("Message log exported", "chats", len(chats), "messages", len(records), "anon", args.Has("anon"), "by", core.UserKey(c))
+		return c.SendFile(&core.File{
+			Name:     "history-" + time.Now().Format("20060102-150405") + "." + format,
+			MIMEType: mimeType,
+			Data:     data,
+			Caption:  ctx.T(c, "history.exported", len(records)),
+		})
+	})
+
+	return &core.Command{
+		Name:        "/history",
+		Description: "查看本会话最近的消息",
+		Args:        []core.Arg{{Name: "条数", Optional: true}},
+		Handler:     show,
+		Subcommands: []*core.Command{{
+			Name: "export",
+			Args: []core.Arg{
+				{Name: "格式", Optional: true, Choices: []string{"jsonl", "csv"}},
+				{Name: "会话", Optional: true},
+				{Name: "anon", Optional: true, Choices: []string{"anon"}},
+			},
+			Handler: export,
+		}},
+	}
+}
+
+// encodeHistory 按 jsonl（每行一条 JSON）或 csv 编码导出的消息
+func encodeHistory(records []historyRecord, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	if format == "jsonl" {
+		enc := json.NewEncoder(&buf)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"chat", "time", "direction", "user_id", "username", "text"})
+	for _, r := range records {
+		_ = w.Write([]string{r.Chat, r.Time.Format(time.RFC3339), r.Direction, r.UserID, r.Username, r.Text})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,149 @@
+package system
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// onboardCallback 引导向导按钮的回调名，数据格式 "步骤:取值"
+const onboardCallback = "onboard"
+
+// 常用城市，其他城市可通过 /city 设置
+var commonCities = []string{"北京", "上海", "广州", "深圳", "杭州"}
+
+// onboarding 首次 /start 时的设置向导：语言 → 人设 → 历史记录 → 工具 → 默认城市
+type onboarding struct {
+	ctx *plugins.Context
+}
+
+func (o *onboarding) start(c core.Context) error {
+	return o.askLanguage(c)
+}
+
+func (o *onboarding) askLanguage(c core.Context) error {
+	var row []core.Button
+	for _, lang := range i18n.Languages() {
+		row = append(row, core.Button{Text: i18n.Name(lang), Name: onboardCallback, Data: "lang:" + lang})
+	}
+	_, err := c.SendButtons(o.ctx.T(c, "onboard.welcome"), [][]core.Button{row})
+	return err
+}
+
+func (o *onboarding) askPersona(c core.Context) error {
+	personas := o.ctx.Config.Personas
+	if len(personas) == 0 {
+		return o.askHistory(c)
+	}
+
+	keys := make([]string, 0, len(personas))
+	for key := range personas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := [][]core.Button{{{Text: o.ctx.T(c, "onboard.default_persona"), Name: onboardCallback, Data: "persona:"}}}
+	for _, key := range keys {
+		name := personas[key].Name
+		if name == "" {
+			name = key
+		}
+		rows = append(rows, []core.Button{{Text: name, Name: onboardCallback, Data: "persona:" + key}})
+	}
+	_, err := c.SendButtons(o.ctx.T(c, "onboard.persona"), rows)
+	return err
+}
+
+func (o *onboarding) askHistory(c core.Context) error {
+	_, err := c.SendButtons(o.ctx.T(c, "onboard.history"), [][]core.Button{{
+		{Text: o.ctx.T(c, "common.on"), Name: onboardCallback, Data: "history:on"},
+		{Text: o.ctx.T(c, "common.off"), Name: onboardCallback, Data: "history:off"},
+	}})
+	return err
+}
+
+func (o *onboarding) askTools(c core.Context) error {
+	_, err := c.SendButtons(o.ctx.T(c, "onboard.tools"), [][]core.Button{{
+		{Text: o.ctx.T(c, "onboard.allow"), Name: onboardCallback, Data: "tools:on"},
+		{Text: o.ctx.T(c, "onboard.deny"), Name: onboardCallback, Data: "tools:off"},
+	}})
+	return err
+}
+
+func (o *onboarding) askCity(c core.Context) error {
+	var row []core.Button
+	for _, city := range commonCities {
+		row = append(row, core.Button{Text: city, Name: onboardCallback, Data: "city:" + city})
+	}
+	_, err := c.SendButtons(o.ctx.T(c, "onboard.city"), [][]core.Button{
+		row,
+		{{Text: o.ctx.T(c, "onboard.skip"), Name: onboardCallback, Data: "city:"}},
+	})
+	return err
+}
+
+func (o *onboarding) finish(c core.Context, profile storage.UserProfile) error {
+	lang := o.ctx.Lang(c)
+	persona := i18n.T(lang, "onboard.default_persona")
+	if p, ok := o.ctx.Config.Personas[profile.Persona]; ok && p.Name != "" {
+		persona = p.Name
+	}
+	city := profile.City
+	if city == "" {
+		city = i18n.T(lang, "common.unset")
+	}
+	return c.Reply(i18n.T(lang, "onboard.done",
+		i18n.Name(lang), persona, onOff(lang, profile.HistoryEnabled), onOff(lang, !profile.ToolsDisabled), city))
+}
+
+// handleCallback 处理向导按钮，保存选择并进入下一步
+func (o *onboarding) handleCallback(c core.Context) error {
+	step, value, _ := strings.Cut(c.Data(), ":")
+	storageKey := core.UserKey(c)
+
+	var next func(core.Context) error
+	update := func(p *storage.UserProfile) {}
+	switch step {
+	case "lang":
+		if i18n.Match(value) != value {
+			return nil
+		}
+		update = func(p *storage.UserProfile) { p.Language = value }
+		next = o.askPersona
+	case "persona":
+		update = func(p *storage.UserProfile) { p.Persona = value }
+		next = o.askHistory
+	case "history":
+		update = func(p *storage.UserProfile) { p.HistoryEnabled = value == "on" }
+		next = o.askTools
+	case "tools":
+		update = func(p *storage.UserProfile) { p.ToolsDisabled = value == "off" }
+		next = o.askCity
+	case "city":
+		update = func(p *storage.UserProfile) {
+			p.City = value
+			p.Onboarded = true
+		}
+	default:
+		return nil
+	}
+
+	if err := o.ctx.Storage.UpdateUserProfile(storageKey, update); err != nil {
+		return c.Reply(o.ctx.T(c, "common.save_failed", err))
+	}
+	if next != nil {
+		return next(c)
+	}
+	return o.finish(c, o.ctx.Storage.GetUserProfile(storageKey))
+}
+
+func onOff(lang string, b bool) string {
+	if b {
+		return i18n.T(lang, "common.on")
+	}
+	return i18n.T(lang, "common.off")
+}
@@ -0,0 +1,125 @@
+package system
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+)
+
+const (
+	// maxOutboxList /outbox 最多列出的消息数
+	maxOutboxList = 20
+	// maxOutboxLine /outbox 中每条消息最多显示的字数
+	maxOutboxLine = 80
+)
+
+// outboxCommand /outbox 查看待重试和发送失败的推送及最近 24 小时的发送记录，
+// /outbox retry [ID|all] 重新发送失败的消息，/outbox clear 删除失败的消息（管理员）
+func outboxCommand(ctx *plugins.Context) *core.Command {
+	admin := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "outbox.admin_only"))
+			}
+			return handler(c, args)
+		}
+	}
+	list := admin(func(c core.Context, _ core.Args) error {
+		messages := ctx.Storage.GetOutbox()
+		failed := 0
+		for _, m := range messages {
+			if m.Failed {
+				failed++
+			}
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "outbox.title", len(messages)-failed, failed))
+		loc := ctx.Location(c)
+		// 最新的在前
+		for i, m := range slices.Backward(messages) {
+			if len(messages)-i > maxOutboxList {
+				b.WriteString(ctx.T(c, "outbox.more", i+1))
+				break
+			}
+			text := []rune(strings.ReplaceAll(m.Text, "\n", " "))
+			if len(text) > maxOutboxLine {
+				text = append(text[:maxOutboxLine], '…')
+			}
+			status := ctx.T(c, "outbox.next", m.NextAttempt.In(loc).Format("01-02 15:04"))
+			if m.Failed {
+				status = ctx.T(c, "outbox.failed")
+			}
+			b.WriteString(ctx.T(c, "outbox.message", m.ID, m.Target, m.Created.In(loc).Format("01-02 15:04"), m.Attempts, status, string(text), m.LastError))
+		}
+
+		// 最近 24 小时每个目标的发送记录
+		type stat struct{ delivered, failed int }
+		stats := map[string]*stat{}
+		var targets []string
+		for _, r := range ctx.Storage.GetDeliveryReceipts(time.Now().Add(-24 * time.Hour)) {
+			s, ok := stats[r.Target]
+			if !ok {
+				s = &stat{}
+				stats[r.Target] = s
+				targets = append(targets, r.Target)
+			}
+			if r.Error == "" {
+				s.delivered++
+			} else {
+				s.failed++
+			}
+		}
+		if len(targets) == 0 {
+			b.WriteString(ctx.T(c, "outbox.receipts_empty"))
+		} else {
+			b.WriteString(ctx.T(c, "outbox.receipts_title"))
+			slices.Sort(targets)
+			for _, t := range targets {
+				b.WriteString(ctx.T(c, "outbox.receipt", t, stats[t].delivered, stats[t].failed))
+			}
+		}
+		b.WriteString(ctx.T(c, "outbox.footer"))
+		return c.Reply(b.String())
+	})
+	retry := admin(func(c core.Context, args core.Args) error {
+		id := args["ID"]
+		if id == "all" {
+			id = ""
+		}
+		n, err := ctx.Storage.RetryOutboxMessages(id)
+		if err != nil {
+			return c.Reply(ctx.T(c, "outbox.op_failed", err))
+		}
+		if n == 0 {
+			return c.Reply(ctx.T(c, "outbox.not_found"))
+		}
+		ctx.Logger.Info("Failed pushes requeued", "id", args["ID"], "count", n, "by", core.UserKey(c))
+		// 立即重试，任务正在运行时下一轮会处理
+		if _, err := ctx.Scheduler.Run("outbox"); err != nil {
+			ctx.Logger.Warn("Failed to start push retries", "error", err)
+		}
+		return c.Reply(ctx.T(c, "outbox.retried", n))
+	})
+	clearFailed := admin(func(c core.Context, _ core.Args) error {
+		n, err := ctx.Storage.ClearOutboxMessages()
+		if err != nil {
+			return c.Reply(ctx.T(c, "outbox.op_failed", err))
+		}
+		ctx.Logger.Info("Failed pushes cleared", "count", n, "by", core.UserKey(c))
+		return c.Reply(ctx.T(c, "outbox.cleared", n))
+	})
+
+	return &core.Command{
+		Name:        "/outbox",
+		Description: "查看推送发件箱和发送记录，retry 重新发送失败的推送（管理员）",
+		Admin:       true,
+		Handler:     list,
+		Subcommands: []*core.Command{
+			{Name: "retry", Args: []core.Arg{{Name: "ID", Optional: true}}, Handler: retry},
+			{Name: "clear", Handler: clearFailed},
+		},
+	}
+}
@@ -1,10 +1,18 @@
 package system
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/i18n"
 	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/scheduler"
+	"github.com/lhpqaq/ggbot/storage"
+	"github.com/lhpqaq/ggbot/tasks"
+	"github.com/lhpqaq/ggbot/version"
 )
 
 type SystemPlugin struct{}
@@ -14,46 +22,291 @@ func (p *SystemPlugin) Name() string {
 }
 
 func (p *SystemPlugin) Init(ctx *plugins.Context) error {
-	// Start
-	ctx.RegisterCommand("/start", func(c core.Context) error {
-		return c.Reply("你好！我是你的 AI 助手。直接向我发送消息即可开始对话。\n")
-	})
+	wizard := &onboarding{ctx: ctx}
+	ctx.RegisterCallback(onboardCallback, wizard.handleCallback)
+
+	// Start: 新用户进入设置向导
+	ctx.AddCommand(&core.Command{Name: "/start", Description: "启动机器人", Handler: func(c core.Context, _ core.Args) error {
+		storageKey := core.UserKey(c)
+		if !ctx.Storage.GetUserProfile(storageKey).Onboarded {
+			return wizard.start(c)
+		}
+		return c.Reply(ctx.T(c, "system.start"))
+	}})
+
+	// Setup: 重新运行设置向导
+	ctx.AddCommand(&core.Command{Name: "/setup", Description: "重新设置语言、人设等偏好", Handler: func(c core.Context, _ core.Args) error {
+		return wizard.start(c)
+	}})
+
+	// Lang: 查看或切换回复语言
+	ctx.AddCommand(&core.Command{Name: "/lang", Description: "查看或切换语言", Args: []core.Arg{{Name: "语言", Optional: true, Choices: i18n.Languages()}}, Handler: func(c core.Context, args core.Args) error {
+		if !args.Has("语言") {
+			var names []string
+			for _, lang := range i18n.Languages() {
+				names = append(names, lang+" "+i18n.Name(lang))
+			}
+			return c.Reply(ctx.T(c, "lang.current", i18n.Name(ctx.Lang(c)), strings.Join(names, ", ")))
+		}
+		lang := args["语言"]
+		storageKey := core.UserKey(c)
+		if err := ctx.Storage.UpdateUserProfile(storageKey, func(p *storage.UserProfile) {
+			p.Language = lang
+		}); err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		return c.Reply(i18n.T(lang, "lang.set", i18n.Name(lang)))
+	}})
+
+	// City
+	ctx.AddCommand(&core.Command{Name: "/city", Description: "设置默认城市", Args: []core.Arg{{Name: "城市名", Rest: true}}, Handler: func(c core.Context, args core.Args) error {
+		city := args["城市名"]
+		storageKey := core.UserKey(c)
+		if err := ctx.Storage.UpdateUserProfile(storageKey, func(p *storage.UserProfile) {
+			p.City = city
+		}); err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		return c.Reply(ctx.T(c, "system.city_set", city))
+	}})
+
+	// Timezone: 查看或设置时区，default 恢复为服务器时区
+	ctx.AddCommand(&core.Command{Name: "/tz", Description: "查看或设置时区", ArgsUsage: "[时区|default]", Args: []core.Arg{{Name: "时区", Optional: true}}, Handler: func(c core.Context, args core.Args) error {
+		storageKey := core.UserKey(c)
+		if !args.Has("时区") {
+			loc := ctx.Location(c)
+			return c.Reply(ctx.T(c, "tz.current", loc, time.Now().In(loc).Format("2006-01-02 15:04")))
+		}
+		name := args["时区"]
+		if name == "default" {
+			name = ""
+		} else {
+			loc, err := time.LoadLocation(name)
+			if err != nil || name == "Local" {
+				return c.Reply(ctx.T(c, "tz.invalid", name))
+			}
+			name = loc.String()
+		}
+		if err := ctx.Storage.UpdateUserProfile(storageKey, func(p *storage.UserProfile) {
+			p.Timezone = name
+		}); err != nil {
+			return c.Reply(ctx.T(c, "common.save_failed", err))
+		}
+		loc := ctx.Location(c)
+		return c.Reply(ctx.T(c, "tz.set", loc, time.Now().In(loc).Format("2006-01-02 15:04")))
+	}})
 
 	// Ping
-	ctx.RegisterCommand("/ping", func(c core.Context) error {
-		return c.Reply("在呢！\n")
-	})
-    
+	ctx.AddCommand(&core.Command{Name: "/ping", Description: "检查运行状态", Handler: func(c core.Context, _ core.Args) error {
+		return c.Reply(ctx.T(c, "system.ping"))
+	}})
+
+	// Version
+	ctx.AddCommand(&core.Command{Name: "/version", Description: "查看版本和构建信息", Handler: func(c core.Context, _ core.Args) error {
+		info := version.Get()
+		commit := info.Commit
+		if commit == "" {
+			commit = "-"
+		}
+		if info.Modified {
+			commit += " (dirty)"
+		}
+		date := info.Date
+		if date == "" {
+			date = "-"
+		}
+		return c.Reply(ctx.T(c, "system.version", info.Version, commit, date, info.GoVersion, info.Platform))
+	}})
+
 	// Help
-	ctx.RegisterCommand("/help", func(c core.Context) error {
-		help := "可用指令：\n" +
-			"/start - 启动机器人\n" +
-			"/ping - 检查运行状态\n" +
-			"/info - 查看你的账号信息\n" +
-			"/set_ai - 配置个人 AI 设置\n" +
-			"/reset_ai - 重置 AI 设置为全局默认值\n"
-		return c.Reply(help)
-	})
+	ctx.AddCommand(&core.Command{Name: "/help", Description: "查看可用指令", Handler: func(c core.Context, _ core.Args) error {
+		// 由各插件声明的指令生成，管理员指令只对管理员列出
+		lang := ctx.Lang(c)
+		admin := ctx.Config.IsAdmin(c.Platform(), c.Sender().ID)
+		return c.Reply(i18n.T(lang, "system.help") + ctx.Commands.Help(lang, admin))
+	}})
 
 	// Info
-	ctx.RegisterCommand("/info", func(c core.Context) error {
+	ctx.AddCommand(&core.Command{Name: "/info", Description: "查看你的账号信息", Handler: func(c core.Context, _ core.Args) error {
 		u := c.Sender()
-		// Convert ID to int if possible for legacy display, or just display as string
-		id := u.ID
-		
-		info := fmt.Sprintf("📂 *个人信息*\n\n" +
-			"🆔 *ID:* `%s`\n" +
-			"👤 *名字:* %s\n" +
-			"🤖 *是否机器人:* %v\n",
-			id, u.Username, u.IsBot,
-		)
-		
+		info := ctx.T(c, "system.info", u.ID, u.Username, u.IsBot)
+
 		// Markdown mode is platform specific?
 		// Core interface abstracts Reply. TelegramAdapter handles defaults.
 		// If we need Markdown, maybe we need options in Reply.
 		// For now simple reply.
 		return c.Reply(info)
-	})
+	}})
+
+	// Tasks
+	ctx.AddCommand(&core.Command{Name: "/tasks", Description: "查看后台任务", Handler: func(c core.Context, _ core.Args) error {
+		owner := core.UserKey(c)
+		list := ctx.Tasks.List(owner)
+		if len(list) == 0 {
+			return c.Reply(ctx.T(c, "system.tasks_empty"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "system.tasks_title"))
+		for _, t := range list {
+			line := fmt.Sprintf("[%s] %s - %s", t.ID, t.Name, t.Status)
+			if t.Status == tasks.StatusRunning {
+				line += ctx.T(c, "system.task_running", t.Progress, time.Since(t.StartedAt).Round(time.Second))
+			} else if t.Err != nil {
+				line += "：" + t.Err.Error()
+			}
+			b.WriteString(line + "\n")
+		}
+		return c.Reply(b.String())
+	}})
+
+	// Cancel
+	ctx.AddCommand(&core.Command{Name: "/cancel", Description: "取消后台任务", Args: []core.Arg{{Name: "任务ID"}}, Handler: func(c core.Context, args core.Args) error {
+		id := args["任务ID"]
+		owner := core.UserKey(c)
+		if !ctx.Tasks.Cancel(owner, id) {
+			return c.Reply(ctx.T(c, "system.cancel_not_found", id))
+		}
+		return c.Reply(ctx.T(c, "system.cancelled", id))
+	}})
+
+	// Alerts
+	ctx.AddCommand(&core.Command{Name: "/alerts", Description: "查看未确认告警（管理员）", Admin: true, Handler: func(c core.Context, _ core.Args) error {
+		if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+			return c.Reply(ctx.T(c, "system.alerts_admin_only"))
+		}
+		open := ctx.Alerts.Open()
+		if len(open) == 0 {
+			return c.Reply(ctx.T(c, "system.alerts_empty"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "system.alerts_title"))
+		loc := ctx.Location(c)
+		for _, a := range open {
+			b.WriteString(ctx.T(c, "system.alert", a.ID, a.Severity, a.Key, a.Count, a.LastSeen.In(loc).Format("01-02 15:04"), a.Message))
+		}
+		b.WriteString(ctx.T(c, "system.alerts_footer"))
+		return c.Reply(b.String())
+	}})
+
+	// Ack
+	ctx.AddCommand(&core.Command{Name: "/ack", Description: "确认告警（管理员），all 确认全部", Admin: true, Args: []core.Arg{{Name: "告警ID"}}, Handler: func(c core.Context, args core.Args) error {
+		if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+			return c.Reply(ctx.T(c, "system.ack_admin_only"))
+		}
+		id := args["告警ID"]
+		if id == "all" {
+			id = ""
+		}
+		n := ctx.Alerts.Ack(id)
+		if n == 0 {
+			return c.Reply(ctx.T(c, "system.ack_not_found", args["告警ID"]))
+		}
+		ctx.Logger.Info("Alerts acknowledged", "id", args["告警ID"], "count", n, "by", core.UserKey(c))
+		return c.Reply(ctx.T(c, "system.acked", n))
+	}})
+
+	// Settings: 群设置
+	ctx.AddCommand(settingsCommand(ctx))
+
+	// Welcome: 入群欢迎和群规
+	greeter := &welcome{ctx: ctx}
+	ctx.RegisterMemberEvent(greeter.handleMember)
+	ctx.AddCommand(greeter.command())
+	ctx.AddCommand(greeter.rulesCommand())
+
+	// History: 消息日志
+	ctx.AddCommand(historyCommand(ctx))
+
+	// User data: 导出/删除个人数据
+	ctx.AddCommand(exportCommand(ctx))
+	ctx.AddCommand(forgetCommand(ctx))
+
+	// Jobs
+	ctx.AddCommand(jobsCommand(ctx))
+
+	// Backup: 存储备份
+	ctx.AddCommand(backupCommand(ctx))
+
+	// Outbox: 推送发件箱
+	ctx.AddCommand(outboxCommand(ctx))
 
 	return nil
-}
\ No newline at end of file
+}
+
+// jobsCommand /jobs [list] | /jobs pause|resume|run <任务名>（管理员）
+func jobsCommand(ctx *plugins.Context) *core.Command {
+	admin := func(handler func(c core.Context, args core.Args) error) func(c core.Context, args core.Args) error {
+		return func(c core.Context, args core.Args) error {
+			if !ctx.Config.IsAdmin(c.Platform(), c.Sender().ID) {
+				return c.Reply(ctx.T(c, "system.jobs_admin_only"))
+			}
+			return handler(c, args)
+		}
+	}
+	list := admin(func(c core.Context, _ core.Args) error {
+		jobs := ctx.Scheduler.Jobs()
+		if len(jobs) == 0 {
+			return c.Reply(ctx.T(c, "system.jobs_empty"))
+		}
+		var b strings.Builder
+		b.WriteString(ctx.T(c, "system.jobs_title"))
+		loc := ctx.Location(c)
+		for _, j := range jobs {
+			status := "system.job_active"
+			switch {
+			case j.Running:
+				status = "system.job_running"
+			case j.Paused:
+				status = "system.job_paused"
+			}
+			b.WriteString(ctx.T(c, "system.job", j.Name, j.Schedule, ctx.T(c, status), j.Next.In(loc).Format("01-02 15:04")))
+			if !j.LastRun.IsZero() {
+				b.WriteString(ctx.T(c, "system.job_last_run", j.LastRun.In(loc).Format("01-02 15:04")))
+				if j.LastErr != nil {
+					b.WriteString(ctx.T(c, "system.job_failed", j.LastErr))
+				}
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(ctx.T(c, "system.jobs_footer"))
+		return c.Reply(b.String())
+	})
+	// update 执行操作，apply 返回成功时回复的消息 key
+	update := func(op string, apply func(name string) (string, error)) *core.Command {
+		return &core.Command{Name: op, Args: []core.Arg{{Name: "任务名"}}, Handler: admin(func(c core.Context, args core.Args) error {
+			name := args["任务名"]
+			reply, err := apply(name)
+			if errors.Is(err, scheduler.ErrNotFound) {
+				return c.Reply(ctx.T(c, "system.job_not_found", name))
+			}
+			if err != nil {
+				return c.Reply(ctx.T(c, "system.job_op_failed", err))
+			}
+			ctx.Logger.Info("Job updated", "op", op, "name", name, "by", core.UserKey(c))
+			return c.Reply(ctx.T(c, reply, name))
+		})}
+	}
+
+	return &core.Command{
+		Name:        "/jobs",
+		Description: "管理定时任务（管理员）",
+		Admin:       true,
+		Handler:     list,
+		Subcommands: []*core.Command{
+			{Name: "list", Handler: list},
+			update("pause", func(name string) (string, error) {
+				return "system.job_paused_done", ctx.Scheduler.Pause(name)
+			}),
+			update("resume", func(name string) (string, error) {
+				return "system.job_resumed", ctx.Scheduler.Resume(name)
+			}),
+			update("run", func(name string) (string, error) {
+				started, err := ctx.Scheduler.Run(name)
+				if err == nil && !started {
+					return "system.job_busy", nil
+				}
+				return "system.job_started", err
+			}),
+		},
+	}
+}
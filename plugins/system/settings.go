@@ -0,0 +1,97 @@
+package system
+
+import (
+	"sort"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// settingsCommand /settings 查看群设置，群管理员可以开关 AI、设置群人设、触发方式和模型，
+// 设置按 "Platform:ChatID" 保存在存储中
+func settingsCommand(ctx *plugins.Context) *core.Command {
+	show := func(c core.Context, _ core.Args) error {
+		if c.Chat().Type == "private" {
+			return c.Reply(ctx.T(c, "settings.group_only"))
+		}
+		g := ctx.Storage.GetGroupSettings(policy.ChatKey(c))
+		persona, model := ctx.T(c, "settings.default"), ctx.T(c, "settings.default")
+		if g.Persona != "" {
+			persona = g.Persona
+			if p, ok := ctx.Config.Personas[g.Persona]; ok && p.Name != "" {
+				persona = p.Name
+			}
+		}
+		if g.Model != "" {
+			model = g.Model
+		}
+		trigger := "settings.trigger_all"
+		if g.Trigger == storage.TriggerMention {
+			trigger = "settings.trigger_mention"
+		}
+		return c.Reply(ctx.T(c, "settings.show", onOff(ctx.Lang(c), !g.AIDisabled), persona, ctx.T(c, trigger), model))
+	}
+	// update 群管理员修改设置
+	update := func(name string, args []core.Arg, apply func(g *storage.GroupSettings, args core.Args)) *core.Command {
+		return &core.Command{Name: name, Args: args, Handler: func(c core.Context, args core.Args) error {
+			if c.Chat().Type == "private" {
+				return c.Reply(ctx.T(c, "settings.group_only"))
+			}
+			if !ctx.CanManageChat(c) {
+				return c.Reply(ctx.T(c, "settings.admin_only"))
+			}
+			chatKey := policy.ChatKey(c)
+			if err := ctx.Storage.UpdateGroupSettings(chatKey, func(g *storage.GroupSettings) {
+				apply(g, args)
+			}); err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			ctx.Logger.Info("Group settings updated", "chat", chatKey, "setting", name, "by", core.UserKey(c))
+			return c.Reply(ctx.T(c, "settings.saved"))
+		}}
+	}
+
+	return &core.Command{
+		Name:        "/settings",
+		Description: "查看/修改群设置（AI 开关、人设、触发方式、模型）",
+		Handler:     show,
+		Subcommands: []*core.Command{
+			update("ai", []core.Arg{{Name: "开关", Choices: []string{"on", "off"}}}, func(g *storage.GroupSettings, args core.Args) {
+				g.AIDisabled = args["开关"] == "off"
+			}),
+			// default 恢复为成员各自的人设/模型
+			update("persona", []core.Arg{{Name: "人设", Choices: personaChoices(ctx)}}, func(g *storage.GroupSettings, args core.Args) {
+				g.Persona = orDefault(args["人设"])
+			}),
+			update("trigger", []core.Arg{{Name: "方式", Choices: []string{storage.TriggerAll, storage.TriggerMention}}}, func(g *storage.GroupSettings, args core.Args) {
+				g.Trigger = args["方式"]
+			}),
+			update("model", []core.Arg{{Name: "模型"}}, func(g *storage.GroupSettings, args core.Args) {
+				g.Model = orDefault(args["模型"])
+			}),
+			update("reset", nil, func(g *storage.GroupSettings, _ core.Args) {
+				*g = storage.GroupSettings{}
+			}),
+		},
+	}
+}
+
+// personaChoices 配置中的人设（按名称排序）和 default
+func personaChoices(ctx *plugins.Context) []string {
+	keys := make([]string, 0, len(ctx.Config.Personas))
+	for key := range ctx.Config.Personas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return append(keys, "default")
+}
+
+// orDefault 参数为 default 时返回空，即不覆盖
+func orDefault(value string) string {
+	if value == "default" {
+		return ""
+	}
+	return value
+}
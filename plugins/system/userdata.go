@@ -0,0 +1,85 @@
+package system
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// userArchive /export 导出的用户数据：存储中的数据和各插件在存储之外保存的数据
+type userArchive struct {
+	storage.UserExport
+	Plugins map[string]any `json:"plugins,omitempty"`
+}
+
+// userTargets 用户私聊的推送目标，用于找到用户的订阅
+func userTargets(c core.Context) []string {
+	target, err := policy.PushTarget(c)
+	if err != nil {
+		return nil
+	}
+	return []string{target}
+}
+
+// exportCommand /export 私聊中导出用户的全部数据（JSON 文件）
+func exportCommand(ctx *plugins.Context) *core.Command {
+	return &core.Command{Name: "/export", Description: "导出你的全部数据", Handler: func(c core.Context, _ core.Args) error {
+		if c.Chat().Type != "private" {
+			return c.Reply(ctx.T(c, "userdata.private_only"))
+		}
+		userKey := core.UserKey(c)
+		archive := userArchive{
+			UserExport: ctx.Storage.ExportUser(userKey, userTargets(c)...),
+			Plugins:    ctx.UserData.Export(userKey),
+		}
+		// 不把 API Key 明文写进文件
+		if s := archive.Settings; s != nil && s.OverrideAI != nil && s.OverrideAI.APIKey != "" {
+			s.OverrideAI.APIKey = "***"
+		}
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			return c.Reply(ctx.T(c, "userdata.export_failed", err))
+		}
+		ctx.Logger.Info("User data exported", "user", userKey)
+		return c.SendFile(&core.File{
+			Name:     "ggbot-export-" + time.Now().Format("20060102") + ".json",
+			MIMEType: "application/json",
+			Data:     data,
+			Caption:  ctx.T(c, "userdata.exported"),
+		})
+	}}
+}
+
+// forgetCommand /forgetme 私聊中删除用户的全部数据，需要 /forgetme confirm 确认
+func forgetCommand(ctx *plugins.Context) *core.Command {
+	private := func(handler func(c core.Context) error) func(c core.Context, _ core.Args) error {
+		return func(c core.Context, _ core.Args) error {
+			if c.Chat().Type != "private" {
+				return c.Reply(ctx.T(c, "userdata.private_only"))
+			}
+			return handler(c)
+		}
+	}
+	return &core.Command{
+		Name:        "/forgetme",
+		Description: "删除你的全部数据",
+		Handler: private(func(c core.Context) error {
+			return c.Reply(ctx.T(c, "userdata.forget_confirm"))
+		}),
+		Subcommands: []*core.Command{{Name: "confirm", Handler: private(func(c core.Context) error {
+			userKey := core.UserKey(c)
+			if err := ctx.Storage.ForgetUser(userKey, userTargets(c)...); err != nil {
+				return c.Reply(ctx.T(c, "userdata.forget_failed", err))
+			}
+			if err := ctx.UserData.Forget(userKey); err != nil {
+				return c.Reply(ctx.T(c, "userdata.forget_failed", err))
+			}
+			ctx.Logger.Info("User data deleted", "user", userKey)
+			return c.Reply(ctx.T(c, "userdata.forgotten"))
+		})}},
+	}
+}
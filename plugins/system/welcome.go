@@ -0,0 +1,143 @@
+package system
+
+import (
+	"strings"
+
+	"github.com/lhpqaq/ggbot/core"
+	"github.com/lhpqaq/ggbot/plugins"
+	"github.com/lhpqaq/ggbot/plugins/policy"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// welcome 新成员入群时发送欢迎消息和群规，机器人被拉进群时发送自我介绍。
+// 群设置优先于 welcome 配置，按 "Platform:ChatID" 保存在存储中
+type welcome struct {
+	ctx *plugins.Context
+}
+
+func (w *welcome) enabled(g storage.GroupSettings) bool {
+	if g.Welcome != "" {
+		return g.Welcome == "on"
+	}
+	return w.ctx.Config.Welcome.Enabled
+}
+
+// message 群设置、配置中的欢迎消息，都为空时使用内置的欢迎语
+func (w *welcome) message(c core.Context, g storage.GroupSettings) string {
+	switch {
+	case g.WelcomeMessage != "":
+		return g.WelcomeMessage
+	case w.ctx.Config.Welcome.Message != "":
+		return w.ctx.Config.Welcome.Message
+	}
+	return w.ctx.T(c, "welcome.default")
+}
+
+func (w *welcome) rules(g storage.GroupSettings) string {
+	if g.Rules != "" {
+		return g.Rules
+	}
+	return w.ctx.Config.Welcome.Rules
+}
+
+// handleMember 处理成员加入：机器人自己入群时发送自我介绍，其他成员按群设置发送欢迎消息和群规
+func (w *welcome) handleMember(c core.Context, event core.MemberEvent) error {
+	if c.Chat().Type == "private" {
+		return nil
+	}
+	chatKey := policy.ChatKey(c)
+	if !event.Joined {
+		if event.Self {
+			w.ctx.Logger.Info("Removed from group", "chat", chatKey)
+		}
+		return nil
+	}
+	if event.Self {
+		w.ctx.Logger.Info("Added to group", "chat", chatKey)
+		_, err := c.Send(w.ctx.T(c, "welcome.intro"))
+		return err
+	}
+	if event.Member.IsBot {
+		return nil
+	}
+
+	g := w.ctx.Storage.GetGroupSettings(chatKey)
+	if !w.enabled(g) {
+		return nil
+	}
+	text := strings.ReplaceAll(w.message(c, g), "{name}", core.Mention(event.Member.ID, event.Member.Nickname))
+	if rules := w.rules(g); rules != "" {
+		text += "\n\n" + w.ctx.T(c, "welcome.rules", rules)
+	}
+	_, err := c.Send(text)
+	return err
+}
+
+// command /welcome 查看本群的入群欢迎设置，群管理员可以开关、修改欢迎消息和群规
+func (w *welcome) command() *core.Command {
+	ctx := w.ctx
+	show := func(c core.Context, _ core.Args) error {
+		if c.Chat().Type == "private" {
+			return c.Reply(ctx.T(c, "settings.group_only"))
+		}
+		g := ctx.Storage.GetGroupSettings(policy.ChatKey(c))
+		rules := w.rules(g)
+		if rules == "" {
+			rules = ctx.T(c, "common.unset")
+		}
+		return c.Reply(ctx.T(c, "welcome.show", onOff(ctx.Lang(c), w.enabled(g)), w.message(c, g), rules))
+	}
+	// update 群管理员修改设置
+	update := func(name string, args []core.Arg, apply func(g *storage.GroupSettings, args core.Args)) *core.Command {
+		return &core.Command{Name: name, Args: args, Handler: func(c core.Context, args core.Args) error {
+			if c.Chat().Type == "private" {
+				return c.Reply(ctx.T(c, "settings.group_only"))
+			}
+			if !ctx.CanManageChat(c) {
+				return c.Reply(ctx.T(c, "settings.admin_only"))
+			}
+			chatKey := policy.ChatKey(c)
+			if err := ctx.Storage.UpdateGroupSettings(chatKey, func(g *storage.GroupSettings) {
+				apply(g, args)
+			}); err != nil {
+				return c.Reply(ctx.T(c, "common.save_failed", err))
+			}
+			ctx.Logger.Info("Welcome settings updated", "chat", chatKey, "setting", name, "by", core.UserKey(c))
+			return c.Reply(ctx.T(c, "welcome.saved"))
+		}}
+	}
+
+	return &core.Command{
+		Name:        "/welcome",
+		Description: "查看/修改本群的入群欢迎消息和群规",
+		Handler:     show,
+		Subcommands: []*core.Command{
+			update("on", nil, func(g *storage.GroupSettings, _ core.Args) { g.Welcome = "on" }),
+			update("off", nil, func(g *storage.GroupSettings, _ core.Args) { g.Welcome = "off" }),
+			// default 恢复为 welcome 配置中的内容
+			update("message", []core.Arg{{Name: "欢迎消息", Rest: true}}, func(g *storage.GroupSettings, args core.Args) {
+				g.WelcomeMessage = orDefault(args["欢迎消息"])
+			}),
+			update("rules", []core.Arg{{Name: "群规", Rest: true}}, func(g *storage.GroupSettings, args core.Args) {
+				g.Rules = orDefault(args["群规"])
+			}),
+			update("reset", nil, func(g *storage.GroupSettings, _ core.Args) {
+				g.Welcome, g.WelcomeMessage, g.Rules = "", "", ""
+			}),
+		},
+	}
+}
+
+// rulesCommand /rules 查看本群的群规
+func (w *welcome) rulesCommand() *core.Command {
+	return &core.Command{Name: "/rules", Description: "查看本群的群规", Handler: func(c core.Context, _ core.Args) error {
+		if c.Chat().Type == "private" {
+			return c.Reply(w.ctx.T(c, "settings.group_only"))
+		}
+		rules := w.rules(w.ctx.Storage.GetGroupSettings(policy.ChatKey(c)))
+		if rules == "" {
+			return c.Reply(w.ctx.T(c, "welcome.no_rules"))
+		}
+		return c.Reply(w.ctx.T(c, "welcome.rules", rules))
+	}}
+}
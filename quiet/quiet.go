@@ -0,0 +1,116 @@
+package quiet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// Hours 推送的安静时段：目标处于安静时段时，消息保存在存储中等时段结束后由 Flush 发送（defer），
+// 或直接丢弃（drop）。推迟的消息重启后仍会发送
+type Hours struct {
+	rules  []rule
+	store  *storage.Storage
+	logger *slog.Logger
+	send   func(target, text string) error
+}
+
+type rule struct {
+	config.QuietHoursRule
+	start, end int // 从 0 点开始的分钟数
+	location   *time.Location
+}
+
+// New 创建安静时段，send 为实际发送消息的函数；规则应已通过配置校验
+func New(rules []config.QuietHoursRule, store *storage.Storage, logger *slog.Logger, send func(target, text string) error) *Hours {
+	h := &Hours{store: store, logger: logger, send: send}
+	for _, r := range rules {
+		location := time.Local
+		if r.Timezone != "" {
+			if loc, err := time.LoadLocation(r.Timezone); err == nil {
+				location = loc
+			}
+		}
+		h.rules = append(h.rules, rule{QuietHoursRule: r, start: minutes(r.Start), end: minutes(r.End), location: location})
+	}
+	return h
+}
+
+// Enabled 是否配置了安静时段
+func (h *Hours) Enabled() bool {
+	return len(h.rules) > 0
+}
+
+// Quiet 目标当前是否处于安静时段
+func (h *Hours) Quiet(target string) bool {
+	_, quiet := h.quiet(target, time.Now())
+	return quiet
+}
+
+// Send 发送推送消息，目标处于安静时段时按规则推迟或丢弃，此时返回 nil
+func (h *Hours) Send(target, text string) error {
+	r, quiet := h.quiet(target, time.Now())
+	if !quiet {
+		return h.send(target, text)
+	}
+	if r.Action == "drop" {
+		h.logger.Info("Push dropped during quiet hours", "target", target)
+		return nil
+	}
+	h.logger.Info("Push deferred until the end of quiet hours", "target", target, "end", r.End)
+	return h.store.QueueMessage(target, text)
+}
+
+// Flush 发送安静时段已经结束的目标的推迟消息，失败的重试由 send 负责
+func (h *Hours) Flush() error {
+	now := time.Now()
+	messages, err := h.store.TakeQueuedMessages(func(target string) bool {
+		_, quiet := h.quiet(target, now)
+		return !quiet
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, m := range messages {
+		if err := h.send(m.Target, m.Text); err != nil {
+			h.logger.Error("Failed to send deferred push", "target", m.Target, "queued", m.Queued, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", m.Target, err))
+		}
+	}
+	if len(messages) > 0 {
+		h.logger.Info("Deferred pushes delivered", "count", len(messages), "failed", len(errs))
+	}
+	return errors.Join(errs...)
+}
+
+// quiet 返回适用于目标的规则，以及 now 是否在该规则的安静时段内
+func (h *Hours) quiet(target string, now time.Time) (rule, bool) {
+	for _, r := range h.rules {
+		if len(r.Targets) > 0 && !slices.Contains(r.Targets, target) {
+			continue
+		}
+		local := now.In(r.location)
+		m := local.Hour()*60 + local.Minute()
+		if r.start < r.end {
+			return r, m >= r.start && m < r.end
+		}
+		// 跨过午夜，如 23:00-07:00
+		return r, m >= r.start || m < r.end
+	}
+	return rule{}, false
+}
+
+// minutes 将 "HH:MM" 转换为从 0 点开始的分钟数
+func minutes(hhmm string) int {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
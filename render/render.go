@@ -0,0 +1,277 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+)
+
+const (
+	// 超出部分截断，避免生成过大的图片
+	maxLines   = 120
+	maxColumns = 120
+	tabWidth   = 4
+)
+
+var (
+	codeBlockRegex = regexp.MustCompile("(?s)```([^\\n`]*)\\n(.*?)\\n?```")
+	mathBlockRegex = regexp.MustCompile(`(?s)\$\$(.+?)\$\$|\\\[(.+?)\\\]`)
+
+	errUnsupportedGlyph = errors.New("font does not cover all characters")
+)
+
+// Renderer 将 AI 回复中的代码块和 LaTeX 公式渲染为 PNG 图片
+type Renderer struct {
+	cfg    config.RenderConfig
+	style  *chroma.Style
+	client *http.Client
+
+	mu   sync.Mutex // font.Face 不能并发使用
+	face font.Face
+}
+
+func New(cfg config.RenderConfig) (*Renderer, error) {
+	data := gomono.TTF
+	if cfg.FontFile != "" {
+		var err error
+		if data, err = os.ReadFile(cfg.FontFile); err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    cfg.FontSize,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Renderer{
+		cfg:    cfg,
+		style:  styles.Get(cfg.Style),
+		client: &http.Client{Timeout: 15 * time.Second},
+		face:   face,
+	}, nil
+}
+
+// Image 渲染出的图片和它替换的原文，图片发送失败时改为发送原文
+type Image struct {
+	File   *core.File
+	Source string
+}
+
+// Render 将 text 中的代码块和公式替换为 "[图 N]" 并返回对应的图片。
+// 渲染失败的块保留原文。
+func (r *Renderer) Render(text string) (string, []Image) {
+	var images []Image
+	add := func(name, block string, data []byte) string {
+		images = append(images, Image{
+			File: &core.File{
+				Name:     fmt.Sprintf("%s-%d.png", name, len(images)+1),
+				MIMEType: "image/png",
+				Data:     data,
+			},
+			Source: block,
+		})
+		return Placeholder(len(images))
+	}
+
+	text = codeBlockRegex.ReplaceAllStringFunc(text, func(block string) string {
+		m := codeBlockRegex.FindStringSubmatch(block)
+		lang, code := strings.TrimSpace(m[1]), m[2]
+		if strings.Count(code, "\n")+1 < r.cfg.MinLines {
+			return block
+		}
+		data, err := r.Code(lang, code)
+		if err != nil {
+			return block
+		}
+		return add("code", block, data)
+	})
+
+	if r.cfg.LaTeXURL != "" {
+		text = mathBlockRegex.ReplaceAllStringFunc(text, func(block string) string {
+			m := mathBlockRegex.FindStringSubmatch(block)
+			formula := strings.TrimSpace(m[1] + m[2])
+			data, err := r.Math(formula)
+			if err != nil {
+				return block
+			}
+			return add("formula", block, data)
+		})
+	}
+
+	return text, images
+}
+
+// Placeholder 第 n 张图片在文字中的占位符
+func Placeholder(n int) string {
+	return fmt.Sprintf("[图 %d]", n)
+}
+
+type token struct {
+	text  string
+	color color.Color
+}
+
+// Code 将代码高亮渲染为 PNG，lang 为空时自动识别语言
+func (r *Renderer) Code(lang, code string) ([]byte, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	code = strings.ReplaceAll(code, "\t", strings.Repeat(" ", tabWidth))
+	it, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按行拆分 token
+	lines := [][]token{nil}
+	for tok := it(); tok != chroma.EOF; tok = it() {
+		c := toColor(r.style.Get(tok.Type).Colour)
+		for i, part := range strings.Split(tok.Value, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], token{text: part, color: c})
+			}
+		}
+	}
+	for len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines], []token{{text: "...", color: color.Gray{Y: 128}}})
+	}
+	for i, line := range lines {
+		lines[i] = truncateLine(line, maxColumns)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range lines {
+		for _, tok := range line {
+			for _, ch := range tok.text {
+				if ch == ' ' {
+					continue
+				}
+				if _, ok := r.face.GlyphAdvance(ch); !ok {
+					return nil, errUnsupportedGlyph
+				}
+			}
+		}
+	}
+
+	metrics := r.face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	ascent := metrics.Ascent.Ceil()
+	pad := lineHeight
+
+	width := 0
+	for _, line := range lines {
+		w := 0
+		for _, tok := range line {
+			w += font.MeasureString(r.face, tok.text).Ceil()
+		}
+		width = max(width, w)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width+2*pad, len(lines)*lineHeight+2*pad))
+	bg := toColor(r.style.Get(chroma.Background).Background)
+	if bg == nil {
+		bg = color.White
+	}
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img, Face: r.face}
+	for i, line := range lines {
+		d.Dot = fixed.P(pad, pad+i*lineHeight+ascent)
+		for _, tok := range line {
+			c := tok.color
+			if c == nil {
+				c = color.Black
+			}
+			d.Src = image.NewUniform(c)
+			d.DrawString(tok.text)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Math 通过配置的公式渲染服务将 LaTeX 公式渲染为图片
+func (r *Renderer) Math(formula string) ([]byte, error) {
+	resp, err := r.client.Get(r.cfg.LaTeXURL + url.PathEscape(formula))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("latex renderer returned status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return nil, fmt.Errorf("latex renderer returned %q", ct)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 5<<20))
+}
+
+func truncateLine(line []token, columns int) []token {
+	n := 0
+	for i, tok := range line {
+		runes := []rune(tok.text)
+		if n+len(runes) > columns {
+			line[i].text = string(runes[:columns-n]) + "…"
+			return line[:i+1]
+		}
+		n += len(runes)
+	}
+	return line
+}
+
+func toColor(c chroma.Colour) color.Color {
+	if !c.IsSet() {
+		return nil
+	}
+	return color.RGBA{R: c.Red(), G: c.Green(), B: c.Blue(), A: 0xff}
+}
@@ -0,0 +1,97 @@
+// Package safehttp 下载用户提交的 URL（知识库导入、RSS 订阅等）时使用的 HTTP 客户端，
+// 只连接公网地址，防止通过机器人访问回环、内网和云服务元数据地址（SSRF）
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked 目标地址不是公网地址
+var ErrBlocked = errors.New("address not allowed")
+
+// maxRedirects 最多跟随的重定向次数
+const maxRedirects = 5
+
+// cgnat 运营商级 NAT 地址段 100.64.0.0/10
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewClient 返回只连接公网地址的客户端。base 为 nil 时使用 http.DefaultTransport 的副本，
+// base 设置的代理照常使用：经代理的请求在发送前检查目标主机解析出的地址
+func NewClient(timeout time.Duration, base *http.Transport) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	direct := base.Clone()
+	direct.Proxy = nil
+	// 每次建立连接时检查实际连接的 IP，重定向和 DNS 重新绑定同样受限
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: control}
+	direct.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &transport{direct: direct, proxied: base.Clone()},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+type transport struct {
+	direct, proxied *http.Transport
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.proxied.Proxy != nil {
+		if proxy, err := t.proxied.Proxy(req); err == nil && proxy != nil {
+			if err := checkHost(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			return t.proxied.RoundTrip(req)
+		}
+	}
+	return t.direct.RoundTrip(req)
+}
+
+// checkHost 检查主机名解析出的所有地址
+func checkHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !Allowed(addr) {
+			return fmt.Errorf("%s (%s): %w", host, addr, ErrBlocked)
+		}
+	}
+	return nil
+}
+
+func control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !Allowed(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", addrPort.Addr(), ErrBlocked)
+	}
+	return nil
+}
+
+// Allowed 是否为可以访问的公网地址：排除回环、私有、链路本地（含 169.254.169.254）、组播、未指定和 CGNAT 地址
+func Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
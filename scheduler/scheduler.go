@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lhpqaq/ggbot/storage"
+)
+
+// ErrNotFound is returned when no job has the given name
+var ErrNotFound = errors.New("job not found")
+
+// Schedule computes the next run time of a job
+type Schedule interface {
+	Next(now time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every runs a job at a fixed interval
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(now time.Time) time.Time { return now.Add(time.Duration(e)) }
+func (e every) String() string               { return "每 " + time.Duration(e).String() }
+
+type daily struct {
+	hour, minute int
+	location     func() *time.Location // nil 表示服务器本地时间
+}
+
+// Daily runs a job every day at hhmm, e.g. "08:00" (local time)
+func Daily(hhmm string) (Schedule, error) {
+	return DailyIn(hhmm, nil)
+}
+
+// DailyIn runs a job every day at hhmm in the time zone returned by location, which is called
+// before each run so a changed time zone applies from the next run on. nil means local time
+func DailyIn(hhmm string, location func() *time.Location) (Schedule, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected HH:MM", hhmm)
+	}
+	return daily{hour: t.Hour(), minute: t.Minute(), location: location}, nil
+}
+
+func (d daily) Next(now time.Time) time.Time {
+	if d.location != nil {
+		now = now.In(d.location())
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), d.hour, d.minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (d daily) String() string { return fmt.Sprintf("每天 %02d:%02d", d.hour, d.minute) }
+
+// Func is the body of a job
+type Func func(ctx context.Context) error
+
+// Job is a snapshot of a scheduled job
+type Job struct {
+	Name     string
+	Schedule string
+	Paused   bool
+	Running  bool
+	Next     time.Time
+	LastRun  time.Time
+	LastErr  error
+}
+
+type job struct {
+	info     Job
+	schedule Schedule
+	fn       Func
+	trigger  chan struct{}
+}
+
+// Scheduler 运行推送、维护等定时任务，支持暂停、恢复和立即执行。
+// 暂停状态保存在 storage 中，重启后保持。
+type Scheduler struct {
+	mu     sync.Mutex
+	store  *storage.Storage
+	logger *slog.Logger
+	jobs   map[string]*job
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New(store *storage.Storage, logger *slog.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		store:  store,
+		logger: logger,
+		jobs:   make(map[string]*job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Add registers a job and starts scheduling it
+func (s *Scheduler) Add(name string, schedule Schedule, fn Func) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s already exists", name)
+	}
+	j := &job{
+		info: Job{
+			Name:     name,
+			Schedule: schedule.String(),
+			Paused:   s.store.JobPaused(name),
+		},
+		schedule: schedule,
+		fn:       fn,
+		trigger:  make(chan struct{}, 1),
+	}
+	s.jobs[name] = j
+	go s.loop(j)
+
+	s.logger.Info("Job scheduled", "name", name, "schedule", j.info.Schedule, "paused", j.info.Paused)
+	return nil
+}
+
+func (s *Scheduler) loop(j *job) {
+	for {
+		next := j.schedule.Next(time.Now())
+		s.mu.Lock()
+		j.info.Next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-j.trigger:
+			timer.Stop()
+			s.run(j)
+		case <-timer.C:
+			s.mu.Lock()
+			paused := j.info.Paused
+			s.mu.Unlock()
+			if !paused {
+				s.run(j)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) run(j *job) {
+	s.mu.Lock()
+	j.info.Running = true
+	j.info.LastRun = time.Now()
+	s.mu.Unlock()
+
+	s.logger.Info("Job started", "name", j.info.Name)
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		err = j.fn(s.ctx)
+	}()
+
+	s.mu.Lock()
+	j.info.Running = false
+	j.info.LastErr = err
+	s.mu.Unlock()
+	if err != nil {
+		s.logger.Error("Job failed", "name", j.info.Name, "error", err)
+	}
+}
+
+// Jobs returns all jobs sorted by name
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Pause stops the job from running on schedule, it can still be run manually
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if ok {
+		j.info.Paused = paused
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return s.store.SetJobPaused(name, paused)
+}
+
+// Run triggers the job now. It returns false if the job is already running or triggered.
+func (s *Scheduler) Run(name string) (bool, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	running := ok && j.info.Running
+	s.mu.Unlock()
+	if !ok {
+		return false, ErrNotFound
+	}
+	if running {
+		return false, nil
+	}
+	select {
+	case j.trigger <- struct{}{}:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Stop stops all jobs
+func (s *Scheduler) Stop() {
+	s.cancel()
+}
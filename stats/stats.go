@@ -0,0 +1,55 @@
+// Package stats 运行统计：启动时间和各平台处理的消息数、出错数，管理员通过 /stats 查看
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// Counter 一个平台的消息统计
+type Counter struct {
+	Messages int64 // 处理的消息数（含按钮回调）
+	Errors   int64 // 处理器返回错误的消息数
+}
+
+// Stats 一个机器人实例的运行统计，并发安全
+type Stats struct {
+	start     time.Time
+	mu        sync.Mutex
+	platforms map[string]*Counter
+}
+
+func New() *Stats {
+	return &Stats{start: time.Now(), platforms: make(map[string]*Counter)}
+}
+
+// Record 记录平台处理了一条消息，failed 表示处理器返回了错误
+func (s *Stats) Record(platform string, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.platforms[platform]
+	if !ok {
+		c = &Counter{}
+		s.platforms[platform] = c
+	}
+	c.Messages++
+	if failed {
+		c.Errors++
+	}
+}
+
+// Uptime 实例启动以来的时间
+func (s *Stats) Uptime() time.Duration {
+	return time.Since(s.start)
+}
+
+// Platforms returns a copy of the counters by platform name
+func (s *Stats) Platforms() map[string]Counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counters := make(map[string]Counter, len(s.platforms))
+	for name, c := range s.platforms {
+		counters[name] = *c
+	}
+	return counters
+}
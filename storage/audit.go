@@ -0,0 +1,47 @@
+package storage
+
+import "time"
+
+// maxAuditEntries 每个用户保留的审计记录条数
+const maxAuditEntries = 50
+
+// AuditEntry 记录一次 AI 请求的执行情况，用于排查用户反馈的问题
+type AuditEntry struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id,omitempty"`
+	Kind      string        `json:"kind"` // chat, news, search ...
+	Model     string        `json:"model"`
+	Tokens    int           `json:"tokens,omitempty"`
+	ToolCalls []string      `json:"tool_calls,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func (s *Storage) AddAuditEntry(userID string, e AuditEntry) error {
+	s.mu.Lock()
+	user, ok := s.UserData[userID]
+	if !ok {
+		user = &UserSettings{}
+		s.UserData[userID] = user
+	}
+	user.Audit = append(user.Audit, e)
+	if len(user.Audit) > maxAuditEntries {
+		user.Audit = user.Audit[len(user.Audit)-maxAuditEntries:]
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetAuditEntries returns the last n audit entries of the user, oldest first
+func (s *Storage) GetAuditEntries(userID string, n int) []AuditEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.UserData[userID]
+	if !ok {
+		return nil
+	}
+	start := max(0, len(user.Audit)-n)
+	return append([]AuditEntry(nil), user.Audit[start:]...)
+}
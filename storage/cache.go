@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// maxCacheEntries 缓存最多保存的条目数，超出时先淘汰最早过期的
+const maxCacheEntries = 10000
+
+// CacheEntry 一条会过期的缓存
+type CacheEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetWithTTL caches value under key until ttl has passed. Keys are namespaced by the caller, e.g. "llm:<hash>"
+func (s *Storage) SetWithTTL(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	s.setCache(key, value, time.Now().Add(ttl))
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// Get returns the cached value of key, false if it is missing or expired
+func (s *Storage) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.Cache[key]
+	if !ok || !time.Now().Before(e.Expires) {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// Delete removes key from the cache
+func (s *Storage) Delete(key string) error {
+	s.mu.Lock()
+	_, ok := s.Cache[key]
+	delete(s.Cache, key)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.Save()
+}
+
+// Incr increments the counter under key and returns the new count. A new counter expires after window,
+// later increments keep its expiry, so the count covers a fixed window (e.g. rate limits)
+func (s *Storage) Incr(key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	now := time.Now()
+	count, expires := 0, now.Add(window)
+	if e, ok := s.Cache[key]; ok && now.Before(e.Expires) {
+		count, _ = strconv.Atoi(e.Value)
+		expires = e.Expires
+	}
+	count++
+	s.setCache(key, strconv.Itoa(count), expires)
+	s.mu.Unlock()
+	return count, s.Save()
+}
+
+// PruneCache removes the expired entries, it returns the number removed
+func (s *Storage) PruneCache() (int, error) {
+	s.mu.Lock()
+	now := time.Now()
+	removed := 0
+	for key, e := range s.Cache {
+		if !now.Before(e.Expires) {
+			delete(s.Cache, key)
+			removed++
+		}
+	}
+	s.mu.Unlock()
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save()
+}
+
+// setCache stores the entry, evicting the entry that expires first when the cache is full. Caller must hold s.mu.
+func (s *Storage) setCache(key, value string, expires time.Time) {
+	if s.Cache == nil {
+		s.Cache = make(map[string]*CacheEntry)
+	}
+	if _, ok := s.Cache[key]; !ok && len(s.Cache) >= maxCacheEntries {
+		oldest := ""
+		for k, e := range s.Cache {
+			if oldest == "" || e.Expires.Before(s.Cache[oldest].Expires) {
+				oldest = k
+			}
+		}
+		delete(s.Cache, oldest)
+	}
+	s.Cache[key] = &CacheEntry{Value: value, Expires: expires}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import "time"
+
+// maxPolicyViolations 每个会话保留的违规记录条数
+const maxPolicyViolations = 50
+
+// ChatSettings 按会话（群/私聊）保存的设置，key 格式 "Platform:ChatID"
+type ChatSettings struct {
+	BannedTopics     []string          `json:"banned_topics,omitempty"`
+	PolicyViolations []PolicyViolation `json:"policy_violations,omitempty"`
+	AllowBots        bool              `json:"allow_bots,omitempty"`
+	Group            *GroupSettings    `json:"group,omitempty"`
+	// 消息日志（history_log），最早的在前
+	Messages []LoggedMessage `json:"messages,omitempty"`
+	// 进行中的投票，PollSeq 为最近分配的投票编号
+	Polls   []*Poll `json:"polls,omitempty"`
+	PollSeq int     `json:"poll_seq,omitempty"`
+}
+
+// Trigger values of GroupSettings.Trigger
+const (
+	TriggerAll     = "all"     // 回复平台送达的所有消息（默认）
+	TriggerMention = "mention" // 只回复 @机器人 或回复机器人的消息
+)
+
+// GroupSettings 群管理员通过 /settings 修改的群聊设置，零值表示使用全局配置
+type GroupSettings struct {
+	AIDisabled bool   `json:"ai_disabled,omitempty"`
+	Persona    string `json:"persona,omitempty"` // config.Personas 中的 key，优先于成员自己的人设
+	Trigger    string `json:"trigger,omitempty"` // TriggerAll 或 TriggerMention，空为 TriggerAll
+	Model      string `json:"model,omitempty"`   // 群内对话使用的模型，空为成员各自的设置
+	// 新成员欢迎，空为使用 welcome 配置
+	Welcome        string `json:"welcome,omitempty"`         // "on" 或 "off"
+	WelcomeMessage string `json:"welcome_message,omitempty"` // 欢迎消息，{name} 替换为 @新成员
+	Rules          string `json:"rules,omitempty"`           // 群规
+	// 每日群聊总结的推送目标（/summary on 时记录），为空表示未开启
+	SummaryTarget string `json:"summary_target,omitempty"`
+}
+
+// PolicyViolation 记录一次被策略拦截的回复
+type PolicyViolation struct {
+	Time   time.Time `json:"time"`
+	UserID string    `json:"user_id"`
+	Topic  string    `json:"topic"`
+	Prompt string    `json:"prompt"`
+}
+
+// chat returns the settings for chatKey, creating them if needed. Caller must hold s.mu.
+func (s *Storage) chat(chatKey string) *ChatSettings {
+	chat, ok := s.ChatData[chatKey]
+	if !ok {
+		chat = &ChatSettings{}
+		s.ChatData[chatKey] = chat
+	}
+	return chat
+}
+
+func (s *Storage) GetBannedTopics(chatKey string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if chat, ok := s.ChatData[chatKey]; ok {
+		return append([]string(nil), chat.BannedTopics...)
+	}
+	return nil
+}
+
+// AddBannedTopic returns false if the topic already exists
+func (s *Storage) AddBannedTopic(chatKey string, topic string) (bool, error) {
+	s.mu.Lock()
+	chat := s.chat(chatKey)
+	for _, t := range chat.BannedTopics {
+		if t == topic {
+			s.mu.Unlock()
+			return false, nil
+		}
+	}
+	chat.BannedTopics = append(chat.BannedTopics, topic)
+	s.mu.Unlock()
+
+	return true, s.Save()
+}
+
+// RemoveBannedTopic returns false if the topic does not exist
+func (s *Storage) RemoveBannedTopic(chatKey string, topic string) (bool, error) {
+	s.mu.Lock()
+	chat, ok := s.ChatData[chatKey]
+	if !ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	for i, t := range chat.BannedTopics {
+		if t == topic {
+			chat.BannedTopics = append(chat.BannedTopics[:i], chat.BannedTopics[i+1:]...)
+			s.mu.Unlock()
+			return true, s.Save()
+		}
+	}
+	s.mu.Unlock()
+	return false, nil
+}
+
+func (s *Storage) ClearBannedTopics(chatKey string) error {
+	s.mu.Lock()
+	if chat, ok := s.ChatData[chatKey]; ok {
+		chat.BannedTopics = nil
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+func (s *Storage) AddPolicyViolation(chatKey string, v PolicyViolation) error {
+	s.mu.Lock()
+	chat := s.chat(chatKey)
+	chat.PolicyViolations = append(chat.PolicyViolations, v)
+	if len(chat.PolicyViolations) > maxPolicyViolations {
+		chat.PolicyViolations = chat.PolicyViolations[len(chat.PolicyViolations)-maxPolicyViolations:]
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+func (s *Storage) GetPolicyViolations(chatKey string) []PolicyViolation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if chat, ok := s.ChatData[chatKey]; ok {
+		return append([]PolicyViolation(nil), chat.PolicyViolations...)
+	}
+	return nil
+}
+
+// BotsAllowed reports whether the chat replies to messages from other bots
+func (s *Storage) BotsAllowed(chatKey string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if chat, ok := s.ChatData[chatKey]; ok {
+		return chat.AllowBots
+	}
+	return false
+}
+
+func (s *Storage) SetBotsAllowed(chatKey string, allowed bool) error {
+	s.mu.Lock()
+	s.chat(chatKey).AllowBots = allowed
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetGroupSettings returns a copy of the chat's group settings, zero value if unset
+func (s *Storage) GetGroupSettings(chatKey string) GroupSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if chat, ok := s.ChatData[chatKey]; ok && chat.Group != nil {
+		return *chat.Group
+	}
+	return GroupSettings{}
+}
+
+// UpdateGroupSettings applies fn to the chat's group settings and saves them
+func (s *Storage) UpdateGroupSettings(chatKey string, fn func(g *GroupSettings)) error {
+	s.mu.Lock()
+	chat := s.chat(chatKey)
+	if chat.Group == nil {
+		chat.Group = &GroupSettings{}
+	}
+	fn(chat.Group)
+	s.mu.Unlock()
+
+	return s.Save()
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// maxPayments 每个用户保留的付款记录条数
+const maxPayments = 50
+
+// Credits 用户购买的 token 余额，每日额度用完后从余额中扣除
+type Credits struct {
+	Tokens   int       `json:"tokens"`
+	Payments []Payment `json:"payments,omitempty"`
+}
+
+// Payment 一次成功的付款
+type Payment struct {
+	Time     time.Time `json:"time"`
+	ChargeID string    `json:"charge_id"` // 平台的付款 ID，如 telegram_payment_charge_id
+	Currency string    `json:"currency"`  // "XTR" 为 Telegram Stars
+	Amount   int       `json:"amount"`    // 货币的最小单位
+	Tokens   int       `json:"tokens"`    // 购买的 token 数
+}
+
+// GetCredits returns a copy of the user's purchased balance, zero value if none
+func (s *Storage) GetCredits(userID string) Credits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if user, ok := s.UserData[userID]; ok && user.Credits != nil {
+		c := *user.Credits
+		c.Payments = slices.Clone(c.Payments)
+		return c
+	}
+	return Credits{}
+}
+
+// AddPayment 记录付款并增加余额。同一 ChargeID 只记录一次（平台重复推送时），返回 false
+func (s *Storage) AddPayment(userID string, p Payment) (bool, error) {
+	s.mu.Lock()
+	user, ok := s.UserData[userID]
+	if !ok {
+		user = &UserSettings{}
+		s.UserData[userID] = user
+	}
+	if user.Credits == nil {
+		user.Credits = &Credits{}
+	}
+	if p.ChargeID != "" && slices.ContainsFunc(user.Credits.Payments, func(old Payment) bool { return old.ChargeID == p.ChargeID }) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	user.Credits.Tokens += p.Tokens
+	user.Credits.Payments = append(user.Credits.Payments, p)
+	if len(user.Credits.Payments) > maxPayments {
+		user.Credits.Payments = user.Credits.Payments[len(user.Credits.Payments)-maxPayments:]
+	}
+	s.mu.Unlock()
+	// 付款已扣款，需要确认余额已写入
+	return true, s.saveNow()
+}
+
+// SpendCredits 从余额中扣除 tokens，余额不足时扣到 0
+func (s *Storage) SpendCredits(userID string, tokens int) error {
+	s.mu.Lock()
+	user, ok := s.UserData[userID]
+	if !ok || user.Credits == nil || tokens <= 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	user.Credits.Tokens = max(user.Credits.Tokens-tokens, 0)
+	s.mu.Unlock()
+	return s.Save()
+}
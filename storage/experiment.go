@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxTrials 最多保留的实验样本数，超出时丢弃最早的
+const maxTrials = 1000
+
+// Trial A/B 实验的一个样本：同一个问题两个变体的回答。对发送出的回答的评价是带有变体的 Rating
+type Trial struct {
+	ID         string            `json:"id"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Experiment string            `json:"experiment"`
+	Time       time.Time         `json:"time"`
+	User       string            `json:"user"` // Platform:UserID
+	Chat       string            `json:"chat"`
+	Question   string            `json:"question"`
+	Answers    map[string]string `json:"answers"`             // 变体 → 回答
+	Delivered  string            `json:"delivered"`           // 发送给用户的变体
+	FollowUp   bool              `json:"follow_up,omitempty"` // 用户很快继续追问
+}
+
+// SetExperimentEnabled turns the A/B experiment on or off
+func (s *Storage) SetExperimentEnabled(enabled bool) error {
+	s.mu.Lock()
+	s.ExperimentOn = enabled
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// ExperimentEnabled reports whether the A/B experiment is running
+func (s *Storage) ExperimentEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ExperimentOn
+}
+
+// AddTrial saves a trial and assigns its ID
+func (s *Storage) AddTrial(t *Trial) error {
+	s.mu.Lock()
+	s.TrialSeq++
+	t.ID = strconv.Itoa(s.TrialSeq)
+	s.Trials = append(s.Trials, t)
+	if len(s.Trials) > maxTrials {
+		s.Trials = slices.Clone(s.Trials[len(s.Trials)-maxTrials:])
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// MarkTrialFollowUp marks the user's latest trial in the chat as followed up if it was created after since
+func (s *Storage) MarkTrialFollowUp(user, chat string, since time.Time) (bool, error) {
+	s.mu.Lock()
+	for i := len(s.Trials) - 1; i >= 0; i-- {
+		t := s.Trials[i]
+		if t.User != user || t.Chat != chat {
+			continue
+		}
+		if t.FollowUp || t.Time.Before(since) {
+			break
+		}
+		t.FollowUp = true
+		s.mu.Unlock()
+		return true, s.Save()
+	}
+	s.mu.Unlock()
+	return false, nil
+}
+
+// ExperimentTrials returns copies of the trials of the experiment, oldest first
+func (s *Storage) ExperimentTrials(experiment string) []Trial {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var trials []Trial
+	for _, t := range s.Trials {
+		if t.Experiment == experiment {
+			trials = append(trials, *t)
+		}
+	}
+	return trials
+}
+
+// ClearTrials deletes the trials of the experiment and returns how many were removed
+func (s *Storage) ClearTrials(experiment string) (int, error) {
+	s.mu.Lock()
+	n := len(s.Trials)
+	s.Trials = slices.DeleteFunc(s.Trials, func(t *Trial) bool { return t.Experiment == experiment })
+	n -= len(s.Trials)
+	s.mu.Unlock()
+	return n, s.Save()
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxSeenItems 每个订阅源最多记住的条目 GUID 数，超出时丢弃最早的
+const maxSeenItems = 500
+
+// Feed 一个会话订阅的 RSS/Atom 源
+type Feed struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Target    string    `json:"target"`   // 推送目标，如 "Telegram:123"
+	ChatKey   string    `json:"chat_key"` // 订阅所在的会话
+	Summarize bool      `json:"summarize,omitempty"`
+	AddedBy   string    `json:"added_by,omitempty"`
+	Added     time.Time `json:"added"`
+	Checked   time.Time `json:"checked,omitempty"`
+	Seen      []string  `json:"seen,omitempty"` // 已推送（或订阅时已存在）条目的 GUID
+}
+
+// AddFeed saves a new feed subscription and assigns its ID
+func (s *Storage) AddFeed(feed *Feed) error {
+	s.mu.Lock()
+	for _, f := range s.Feeds {
+		if f.ChatKey == feed.ChatKey && f.URL == feed.URL {
+			s.mu.Unlock()
+			return fmt.Errorf("已经订阅过 %s", feed.URL)
+		}
+	}
+	s.FeedSeq++
+	feed.ID = strconv.Itoa(s.FeedSeq)
+	feed.Seen = lastSeen(feed.Seen)
+	s.Feeds = append(s.Feeds, feed)
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// RemoveFeed deletes the feed with the ID from the chat, false if not found
+func (s *Storage) RemoveFeed(chatKey, id string) (bool, error) {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.Feeds, func(f *Feed) bool { return f.ChatKey == chatKey && f.ID == id })
+	if i < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.Feeds = slices.Delete(s.Feeds, i, i+1)
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// ChatFeeds returns copies of the feeds subscribed in the chat
+func (s *Storage) ChatFeeds(chatKey string) []Feed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var feeds []Feed
+	for _, f := range s.Feeds {
+		if f.ChatKey == chatKey {
+			feeds = append(feeds, *f)
+		}
+	}
+	return feeds
+}
+
+// AllFeeds returns copies of all feed subscriptions
+func (s *Storage) AllFeeds() []Feed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	feeds := make([]Feed, 0, len(s.Feeds))
+	for _, f := range s.Feeds {
+		feeds = append(feeds, *f)
+	}
+	return feeds
+}
+
+// MarkFeedSeen records the GUIDs as pushed and updates the feed title and check time
+func (s *Storage) MarkFeedSeen(id, title string, guids []string) error {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.Feeds, func(f *Feed) bool { return f.ID == id })
+	if i < 0 {
+		// 轮询期间订阅已被删除
+		s.mu.Unlock()
+		return nil
+	}
+	f := s.Feeds[i]
+	if title != "" {
+		f.Title = title
+	}
+	f.Checked = time.Now()
+	for _, guid := range guids {
+		if !slices.Contains(f.Seen, guid) {
+			f.Seen = append(f.Seen, guid)
+		}
+	}
+	f.Seen = lastSeen(f.Seen)
+	s.mu.Unlock()
+	return s.Save()
+}
+
+func lastSeen(seen []string) []string {
+	if len(seen) > maxSeenItems {
+		return slices.Clone(seen[len(seen)-maxSeenItems:])
+	}
+	return seen
+}
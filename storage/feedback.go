@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// maxRatings 最多保留的评价条数，超出时丢弃最早的
+const maxRatings = 5000
+
+// Rating 用户对一次 AI 回答的评价
+type Rating struct {
+	RequestID  string    `json:"request_id"`
+	User       string    `json:"user"` // Platform:UserID
+	Chat       string    `json:"chat"`
+	Model      string    `json:"model"`
+	Persona    string    `json:"persona,omitempty"`
+	Experiment string    `json:"experiment,omitempty"` // 回答来自 A/B 实验时的实验名和发送的变体
+	Variant    string    `json:"variant,omitempty"`
+	Score      int       `json:"score"` // 1 👍，-1 👎
+	Time       time.Time `json:"time"`
+}
+
+// AddRating saves the rating, replacing an earlier rating of the same user for the same request
+func (s *Storage) AddRating(r Rating) error {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.Ratings, func(old *Rating) bool { return old.RequestID == r.RequestID && old.User == r.User })
+	if i >= 0 {
+		s.Ratings[i] = &r
+	} else {
+		s.Ratings = append(s.Ratings, &r)
+		if len(s.Ratings) > maxRatings {
+			s.Ratings = slices.Clone(s.Ratings[len(s.Ratings)-maxRatings:])
+		}
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetRatings returns copies of all ratings, oldest first
+func (s *Storage) GetRatings() []Rating {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ratings := make([]Rating, 0, len(s.Ratings))
+	for _, r := range s.Ratings {
+		ratings = append(ratings, *r)
+	}
+	return ratings
+}
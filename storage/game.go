@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Game 一个会话中进行中的游戏
+type Game struct {
+	Kind     string         `json:"kind"`             // "trivia" 或 "idiom"
+	Target   string         `json:"target,omitempty"` // 超时提示的推送目标，为空时（如 QQ 群）只能在下一条消息时提示
+	Starter  string         `json:"starter"`
+	Round    int            `json:"round"`
+	Rounds   int            `json:"rounds,omitempty"`   // 问答总轮数
+	Topic    string         `json:"topic,omitempty"`    // 问答主题
+	Question string         `json:"question,omitempty"` // 当前题目，出题期间为空
+	Answers  []string       `json:"answers,omitempty"`  // 问答可接受的答案
+	Used     []string       `json:"used,omitempty"`     // 已出现的成语 / 已出过的题目
+	Scores   map[string]int `json:"scores,omitempty"`   // 本局得分，显示名 → 积分
+	Deadline time.Time      `json:"deadline"`
+	Started  time.Time      `json:"started"`
+	Lang     string         `json:"lang,omitempty"` // 发起者的语言，超时等不回复具体消息的提示使用
+}
+
+// GameScore 用户在一个会话中的游戏积分
+type GameScore struct {
+	User   string    `json:"user"` // Platform:UserID
+	Name   string    `json:"name,omitempty"`
+	Points int       `json:"points"`
+	Wins   int       `json:"wins,omitempty"` // 答对/接上的次数
+	Last   time.Time `json:"last"`
+}
+
+// SetGame saves the game in progress in the chat
+func (s *Storage) SetGame(chatKey string, game *Game) error {
+	s.mu.Lock()
+	if s.Games == nil {
+		s.Games = make(map[string]*Game)
+	}
+	s.Games[chatKey] = game
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetGame returns a copy of the game in progress in the chat, nil if none
+func (s *Storage) GetGame(chatKey string) *Game {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.Games[chatKey]
+	if !ok {
+		return nil
+	}
+	game := *g
+	game.Answers = slices.Clone(g.Answers)
+	game.Used = slices.Clone(g.Used)
+	game.Scores = maps.Clone(g.Scores)
+	return &game
+}
+
+// AllGames returns copies of all games in progress by chat
+func (s *Storage) AllGames() map[string]Game {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	games := make(map[string]Game, len(s.Games))
+	for chatKey, g := range s.Games {
+		games[chatKey] = *g
+	}
+	return games
+}
+
+// DeleteGame ends the game in the chat, false if none was in progress
+func (s *Storage) DeleteGame(chatKey string) (bool, error) {
+	s.mu.Lock()
+	if _, ok := s.Games[chatKey]; !ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	delete(s.Games, chatKey)
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// AddGameScore adds points to the user's score in the chat
+func (s *Storage) AddGameScore(chatKey, user, name string, points int) error {
+	s.mu.Lock()
+	if s.GameScores == nil {
+		s.GameScores = make(map[string]map[string]*GameScore)
+	}
+	if s.GameScores[chatKey] == nil {
+		s.GameScores[chatKey] = make(map[string]*GameScore)
+	}
+	score := s.GameScores[chatKey][user]
+	if score == nil {
+		score = &GameScore{User: user}
+		s.GameScores[chatKey][user] = score
+	}
+	if name != "" {
+		score.Name = name
+	}
+	score.Points += points
+	score.Wins++
+	score.Last = time.Now()
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GameLeaderboard returns the scores in the chat, highest first
+func (s *Storage) GameLeaderboard(chatKey string) []GameScore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var scores []GameScore
+	for _, user := range slices.Sorted(maps.Keys(s.GameScores[chatKey])) {
+		scores = append(scores, *s.GameScores[chatKey][user])
+	}
+	slices.SortStableFunc(scores, func(a, b GameScore) int {
+		return cmp.Compare(b.Points, a.Points)
+	})
+	return scores
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"maps"
+
+	"github.com/lhpqaq/ggbot/config"
+)
+
+// GetMCPServers returns a copy of the MCP servers added with /mcp add
+func (s *Storage) GetMCPServers() map[string]config.MCPConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.MCPServers)
+}
+
+// SetMCPServer adds or replaces a runtime MCP server
+func (s *Storage) SetMCPServer(name string, cfg config.MCPConfig) error {
+	s.mu.Lock()
+	if s.MCPServers == nil {
+		s.MCPServers = make(map[string]config.MCPConfig)
+	}
+	s.MCPServers[name] = cfg
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// DeleteMCPServer removes a runtime MCP server, reporting whether it existed
+func (s *Storage) DeleteMCPServer(name string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.MCPServers[name]
+	delete(s.MCPServers, name)
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, s.Save()
+}
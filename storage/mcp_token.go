@@ -0,0 +1,43 @@
+package storage
+
+import "time"
+
+// MCPToken MCP 服务的 OAuth 授权结果，key 为 mcpServers 中的服务名
+type MCPToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+	// 动态注册得到的客户端（配置中未指定 client_id 时）
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// GetMCPToken returns a copy of the cached token of the server, nil if none
+func (s *Storage) GetMCPToken(server string) *MCPToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t, ok := s.MCPTokens[server]; ok {
+		token := *t
+		return &token
+	}
+	return nil
+}
+
+func (s *Storage) SetMCPToken(server string, token MCPToken) error {
+	s.mu.Lock()
+	if s.MCPTokens == nil {
+		s.MCPTokens = make(map[string]*MCPToken)
+	}
+	s.MCPTokens[server] = &token
+	s.mu.Unlock()
+	return s.Save()
+}
+
+func (s *Storage) DeleteMCPToken(server string) error {
+	s.mu.Lock()
+	delete(s.MCPTokens, server)
+	s.mu.Unlock()
+	return s.Save()
+}
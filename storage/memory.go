@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Memory 关于用户的一条长期记忆，对话时加入系统提示词
+type Memory struct {
+	ID      string    `json:"id"` // 用户内递增的编号
+	Text    string    `json:"text"`
+	Auto    bool      `json:"auto,omitempty"` // 由模型从对话中提取，否则为用户 /remember 记录
+	Created time.Time `json:"created"`
+}
+
+// AddMemory saves a memory of the user. A memory with the same text is returned as is.
+// When the user has limit memories the oldest automatic one is removed first, if there is none
+// the memory is not saved and false is returned
+func (s *Storage) AddMemory(userKey, text string, auto bool, limit int) (Memory, bool, error) {
+	s.mu.Lock()
+	user, ok := s.UserData[userKey]
+	if !ok {
+		user = &UserSettings{}
+		s.UserData[userKey] = user
+	}
+	if i := slices.IndexFunc(user.Memories, func(m Memory) bool { return strings.EqualFold(m.Text, text) }); i >= 0 {
+		m := user.Memories[i]
+		s.mu.Unlock()
+		return m, true, nil
+	}
+	if len(user.Memories) >= limit {
+		i := slices.IndexFunc(user.Memories, func(m Memory) bool { return m.Auto })
+		if i < 0 {
+			s.mu.Unlock()
+			return Memory{}, false, nil
+		}
+		user.Memories = slices.Delete(user.Memories, i, i+1)
+	}
+	user.MemorySeq++
+	m := Memory{ID: strconv.Itoa(user.MemorySeq), Text: text, Auto: auto, Created: time.Now()}
+	user.Memories = append(user.Memories, m)
+	s.mu.Unlock()
+	return m, true, s.Save()
+}
+
+// GetMemories returns a copy of the user's memories, oldest first
+func (s *Storage) GetMemories(userKey string) []Memory {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if user, ok := s.UserData[userKey]; ok {
+		return slices.Clone(user.Memories)
+	}
+	return nil
+}
+
+// DeleteMemory removes a memory of the user, false if it does not exist
+func (s *Storage) DeleteMemory(userKey, id string) (bool, error) {
+	s.mu.Lock()
+	user, ok := s.UserData[userKey]
+	if !ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	i := slices.IndexFunc(user.Memories, func(m Memory) bool { return m.ID == id })
+	if i < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	user.Memories = slices.Delete(user.Memories, i, i+1)
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// ClearMemories removes all memories of the user
+func (s *Storage) ClearMemories(userKey string) error {
+	s.mu.Lock()
+	if user, ok := s.UserData[userKey]; ok {
+		user.Memories = nil
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// Directions of LoggedMessage
+const (
+	DirectionIn  = "in"  // 收到的消息
+	DirectionOut = "out" // 机器人发送的消息
+)
+
+// LoggedMessage 消息日志中的一条消息
+type LoggedMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	UserID    string    `json:"user_id,omitempty"` // 发送者，机器人发送的消息为空
+	Username  string    `json:"username,omitempty"`
+	MessageID string    `json:"message_id,omitempty"` // 机器人发送的消息 ID，编辑后更新同一条记录
+	Text      string    `json:"text"`
+}
+
+// LogMessage 追加一条消息，每个会话只保留最近 limit 条。
+// 带 MessageID 的发出消息已存在时（如占位消息被编辑为最终回答）更新原记录的文字
+func (s *Storage) LogMessage(chatKey string, m LoggedMessage, limit int) error {
+	s.mu.Lock()
+	chat := s.chat(chatKey)
+	updated := false
+	if m.MessageID != "" {
+		for i := len(chat.Messages) - 1; i >= 0; i-- {
+			if chat.Messages[i].MessageID == m.MessageID && chat.Messages[i].Direction == m.Direction {
+				chat.Messages[i].Text = m.Text
+				updated = true
+				break
+			}
+		}
+	}
+	if !updated {
+		chat.Messages = append(chat.Messages, m)
+		if len(chat.Messages) > limit {
+			chat.Messages = chat.Messages[len(chat.Messages)-limit:]
+		}
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetMessageLog returns the last n logged messages of the chat, oldest first, all of them when n <= 0
+func (s *Storage) GetMessageLog(chatKey string, n int) []LoggedMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chat, ok := s.ChatData[chatKey]
+	if !ok {
+		return nil
+	}
+	start := 0
+	if n > 0 {
+		start = max(0, len(chat.Messages)-n)
+	}
+	return append([]LoggedMessage(nil), chat.Messages[start:]...)
+}
+
+// MessageLogChats returns the keys of the chats that have logged messages, sorted
+func (s *Storage) MessageLogChats() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for key, chat := range s.ChatData {
+		if len(chat.Messages) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MaxNotes 每个用户最多保存的笔记数
+const MaxNotes = 200
+
+// Note 用户让机器人记住的一条笔记（/note add）
+type Note struct {
+	ID      string    `json:"id"` // 用户内递增的编号
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+	// 开启知识库时笔记的向量，用于语义检索
+	Vector []float32 `json:"vector,omitempty"`
+}
+
+// AddNote saves a note for the user, false if the user already has MaxNotes notes
+func (s *Storage) AddNote(userKey, text string, vector []float32) (Note, bool, error) {
+	s.mu.Lock()
+	user, ok := s.UserData[userKey]
+	if !ok {
+		user = &UserSettings{}
+		s.UserData[userKey] = user
+	}
+	if len(user.Notes) >= MaxNotes {
+		s.mu.Unlock()
+		return Note{}, false, nil
+	}
+	user.NoteSeq++
+	note := Note{ID: strconv.Itoa(user.NoteSeq), Text: text, Created: time.Now(), Vector: vector}
+	user.Notes = append(user.Notes, note)
+	s.mu.Unlock()
+	return note, true, s.Save()
+}
+
+// GetNotes returns a copy of the user's notes, oldest first
+func (s *Storage) GetNotes(userKey string) []Note {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if user, ok := s.UserData[userKey]; ok {
+		return slices.Clone(user.Notes)
+	}
+	return nil
+}
+
+// DeleteNote removes a note of the user, false if it does not exist
+func (s *Storage) DeleteNote(userKey, id string) (bool, error) {
+	s.mu.Lock()
+	user, ok := s.UserData[userKey]
+	if !ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	i := slices.IndexFunc(user.Notes, func(n Note) bool { return n.ID == id })
+	if i < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	user.Notes = slices.Delete(user.Notes, i, i+1)
+	s.mu.Unlock()
+	return true, s.Save()
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxOutboxMessages 发件箱最多保存的消息数（包括失败的），超出时丢弃最早失败的，没有失败的消息时丢弃最早的
+	MaxOutboxMessages = 500
+	// maxReceipts 保留的最近发送记录条数
+	maxReceipts = 200
+)
+
+// OutboxMessage 发送失败等待重试的推送消息，重试次数用完后 Failed 为 true，等待管理员处理
+type OutboxMessage struct {
+	ID          string    `json:"id"`
+	Target      string    `json:"target"` // 推送目标，如 "Telegram:123"
+	Text        string    `json:"text"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failed      bool      `json:"failed,omitempty"`
+}
+
+// DeliveryReceipt 一次推送的发送结果，Error 为空表示已送达
+type DeliveryReceipt struct {
+	Target   string    `json:"target"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts"` // 第几次尝试
+	Error    string    `json:"error,omitempty"`
+}
+
+// AddOutboxMessage saves a message whose first attempt failed, to be retried at next.
+// failed saves it as failed right away, for outboxes that do not retry
+func (s *Storage) AddOutboxMessage(target, text, lastError string, next time.Time, failed bool) (OutboxMessage, error) {
+	s.mu.Lock()
+	if len(s.Outbox) >= MaxOutboxMessages {
+		i := max(0, slices.IndexFunc(s.Outbox, func(m *OutboxMessage) bool { return m.Failed }))
+		s.Outbox = slices.Delete(s.Outbox, i, i+1)
+	}
+	s.OutboxSeq++
+	m := &OutboxMessage{
+		ID:          strconv.Itoa(s.OutboxSeq),
+		Target:      target,
+		Text:        text,
+		Created:     time.Now(),
+		Attempts:    1,
+		NextAttempt: next,
+		LastError:   lastError,
+		Failed:      failed,
+	}
+	s.Outbox = append(s.Outbox, m)
+	added := *m
+	s.mu.Unlock()
+	return added, s.Save()
+}
+
+// GetOutbox returns copies of the messages in the outbox, oldest first
+func (s *Storage) GetOutbox() []OutboxMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	messages := make([]OutboxMessage, 0, len(s.Outbox))
+	for _, m := range s.Outbox {
+		messages = append(messages, *m)
+	}
+	return messages
+}
+
+// DueOutboxMessages returns copies of the pending messages to retry at now
+func (s *Storage) DueOutboxMessages(now time.Time) []OutboxMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var due []OutboxMessage
+	for _, m := range s.Outbox {
+		if !m.Failed && !m.NextAttempt.After(now) {
+			due = append(due, *m)
+		}
+	}
+	return due
+}
+
+// UpdateOutboxMessage applies fn to the message, false if it no longer exists.
+// fn returning true removes the message from the outbox (delivered)
+func (s *Storage) UpdateOutboxMessage(id string, fn func(m *OutboxMessage) (remove bool)) (bool, error) {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.Outbox, func(m *OutboxMessage) bool { return m.ID == id })
+	if i < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	if fn(s.Outbox[i]) {
+		s.Outbox = slices.Delete(s.Outbox, i, i+1)
+	}
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// RetryOutboxMessages requeues the failed message id, or all failed messages when id is empty, and returns how many
+func (s *Storage) RetryOutboxMessages(id string) (int, error) {
+	s.mu.Lock()
+	var n int
+	for _, m := range s.Outbox {
+		if m.Failed && (id == "" || m.ID == id) {
+			m.Failed = false
+			m.Attempts = 0
+			m.NextAttempt = time.Now()
+			n++
+		}
+	}
+	s.mu.Unlock()
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.Save()
+}
+
+// ClearOutboxMessages removes the failed messages from the outbox and returns how many
+func (s *Storage) ClearOutboxMessages() (int, error) {
+	s.mu.Lock()
+	n := len(s.Outbox)
+	s.Outbox = slices.DeleteFunc(s.Outbox, func(m *OutboxMessage) bool { return m.Failed })
+	n -= len(s.Outbox)
+	s.mu.Unlock()
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.Save()
+}
+
+// AddDeliveryReceipt records the result of a delivery attempt, keeping the last maxReceipts
+func (s *Storage) AddDeliveryReceipt(r DeliveryReceipt) error {
+	s.mu.Lock()
+	s.Receipts = append(s.Receipts, r)
+	if len(s.Receipts) > maxReceipts {
+		s.Receipts = s.Receipts[len(s.Receipts)-maxReceipts:]
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetDeliveryReceipts returns the receipts since the given time, oldest first
+func (s *Storage) GetDeliveryReceipts(since time.Time) []DeliveryReceipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var receipts []DeliveryReceipt
+	for _, r := range s.Receipts {
+		if !r.Time.Before(since) {
+			receipts = append(receipts, r)
+		}
+	}
+	return receipts
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MaxOpenPolls 每个会话同时进行中的投票数上限
+const MaxOpenPolls = 10
+
+// Poll 会话中进行中的投票，/poll close 结束后删除
+type Poll struct {
+	ID       string         `json:"id"` // 会话内递增的编号
+	Question string         `json:"question"`
+	Options  []string       `json:"options"`
+	Votes    map[string]int `json:"votes,omitempty"` // 投票者 Platform:UserID → 选项序号（从 0 开始）
+	Creator  string         `json:"creator"`         // Platform:UserID
+	Created  time.Time      `json:"created"`
+}
+
+// Tally 每个选项的票数
+func (p Poll) Tally() []int {
+	counts := make([]int, len(p.Options))
+	for _, option := range p.Votes {
+		if option >= 0 && option < len(counts) {
+			counts[option]++
+		}
+	}
+	return counts
+}
+
+func (p *Poll) clone() Poll {
+	poll := *p
+	poll.Options = slices.Clone(p.Options)
+	poll.Votes = maps.Clone(p.Votes)
+	return poll
+}
+
+// CreatePoll starts a poll in the chat, false if the chat already has MaxOpenPolls polls
+func (s *Storage) CreatePoll(chatKey, question string, options []string, creator string) (Poll, bool, error) {
+	s.mu.Lock()
+	chat := s.chat(chatKey)
+	if len(chat.Polls) >= MaxOpenPolls {
+		s.mu.Unlock()
+		return Poll{}, false, nil
+	}
+	chat.PollSeq++
+	poll := &Poll{
+		ID:       strconv.Itoa(chat.PollSeq),
+		Question: question,
+		Options:  slices.Clone(options),
+		Creator:  creator,
+		Created:  time.Now(),
+	}
+	chat.Polls = append(chat.Polls, poll)
+	created := poll.clone()
+	s.mu.Unlock()
+	return created, true, s.Save()
+}
+
+// GetPolls returns copies of the chat's open polls, oldest first
+func (s *Storage) GetPolls(chatKey string) []Poll {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	chat, ok := s.ChatData[chatKey]
+	if !ok {
+		return nil
+	}
+	polls := make([]Poll, 0, len(chat.Polls))
+	for _, p := range chat.Polls {
+		polls = append(polls, p.clone())
+	}
+	return polls
+}
+
+// Vote records the voter's choice in the poll, replacing an earlier vote. It returns the updated poll,
+// false if the poll or option does not exist, and whether the vote changed anything
+func (s *Storage) Vote(chatKey, id, voter string, option int) (poll Poll, ok, changed bool, err error) {
+	s.mu.Lock()
+	p := s.findPoll(chatKey, id)
+	if p == nil || option < 0 || option >= len(p.Options) {
+		s.mu.Unlock()
+		return Poll{}, false, false, nil
+	}
+	if prev, voted := p.Votes[voter]; voted && prev == option {
+		poll = p.clone()
+		s.mu.Unlock()
+		return poll, true, false, nil
+	}
+	if p.Votes == nil {
+		p.Votes = make(map[string]int)
+	}
+	p.Votes[voter] = option
+	poll = p.clone()
+	s.mu.Unlock()
+	return poll, true, true, s.Save()
+}
+
+// ClosePoll removes the poll from the chat and returns its final state, false if it does not exist
+func (s *Storage) ClosePoll(chatKey, id string) (Poll, bool, error) {
+	s.mu.Lock()
+	p := s.findPoll(chatKey, id)
+	if p == nil {
+		s.mu.Unlock()
+		return Poll{}, false, nil
+	}
+	poll := p.clone()
+	chat := s.ChatData[chatKey]
+	chat.Polls = slices.DeleteFunc(chat.Polls, func(p *Poll) bool { return p.ID == id })
+	s.mu.Unlock()
+	return poll, true, s.Save()
+}
+
+// findPoll 调用方持有 s.mu
+func (s *Storage) findPoll(chatKey, id string) *Poll {
+	chat, ok := s.ChatData[chatKey]
+	if !ok {
+		return nil
+	}
+	for _, p := range chat.Polls {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
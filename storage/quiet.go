@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// MaxQueuedMessages 每个推送目标在安静时段内最多推迟的消息数，超出时丢弃最早的
+const MaxQueuedMessages = 50
+
+// QueuedMessage 安静时段内推迟发送的推送消息
+type QueuedMessage struct {
+	Target string    `json:"target"` // 推送目标，如 "Telegram:123"
+	Text   string    `json:"text"`
+	Queued time.Time `json:"queued"`
+}
+
+// QueueMessage defers a message to target, dropping the target's oldest message when it has MaxQueuedMessages
+func (s *Storage) QueueMessage(target, text string) error {
+	s.mu.Lock()
+	var count int
+	for _, m := range s.QuietQueue {
+		if m.Target == target {
+			count++
+		}
+	}
+	if count >= MaxQueuedMessages {
+		i := slices.IndexFunc(s.QuietQueue, func(m QueuedMessage) bool { return m.Target == target })
+		s.QuietQueue = slices.Delete(s.QuietQueue, i, i+1)
+	}
+	s.QuietQueue = append(s.QuietQueue, QueuedMessage{Target: target, Text: text, Queued: time.Now()})
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// TakeQueuedMessages removes and returns the queued messages whose target passes ready, oldest first
+func (s *Storage) TakeQueuedMessages(ready func(target string) bool) ([]QueuedMessage, error) {
+	s.mu.Lock()
+	var taken []QueuedMessage
+	s.QuietQueue = slices.DeleteFunc(s.QuietQueue, func(m QueuedMessage) bool {
+		if ready(m.Target) {
+			taken = append(taken, m)
+			return true
+		}
+		return false
+	})
+	s.mu.Unlock()
+	if len(taken) == 0 {
+		return nil, nil
+	}
+	return taken, s.Save()
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SelfTest writes a marker to the storage file and reads it back, used by /selftest
+func (s *Storage) SelfTest() error {
+	marker := time.Now().UTC().Truncate(time.Millisecond)
+	s.mu.Lock()
+	s.SelfTestAt = marker
+	s.mu.Unlock()
+	_ = s.Save()
+	if err := s.Flush(); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	var saved struct {
+		SelfTestAt time.Time `json:"self_test_at"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	if !saved.SelfTestAt.Equal(marker) {
+		return fmt.Errorf("read back %s, want %s", saved.SelfTestAt, marker)
+	}
+	return nil
+}
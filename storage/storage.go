@@ -3,25 +3,102 @@ package storage
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/lhpqaq/ggbot/config"
 )
 
 type UserSettings struct {
 	OverrideAI *config.AIConfig `json:"override_ai,omitempty"`
+	Profile    *UserProfile     `json:"profile,omitempty"`
+	Audit      []AuditEntry     `json:"audit,omitempty"`
+	Credits    *Credits         `json:"credits,omitempty"` // 购买的 token 余额
+	Notes      []Note           `json:"notes,omitempty"`
+	NoteSeq    int              `json:"note_seq,omitempty"`
+	// 长期记忆（/remember、/memories）
+	Memories  []Memory `json:"memories,omitempty"`
+	MemorySeq int      `json:"memory_seq,omitempty"`
 }
 
+// UserProfile 用户偏好，由 /start 引导向导设置
+type UserProfile struct {
+	Onboarded      bool   `json:"onboarded,omitempty"`
+	Language       string `json:"language,omitempty"` // "zh", "en"
+	Persona        string `json:"persona,omitempty"`  // config.Personas 中的 key
+	HistoryEnabled bool   `json:"history_enabled,omitempty"`
+	ToolsDisabled  bool   `json:"tools_disabled,omitempty"`
+	City           string `json:"city,omitempty"`
+	Timezone       string `json:"timezone,omitempty"`      // IANA 时区，如 "Asia/Shanghai"（/tz），为空时使用服务器时区
+	ShowThinking   bool   `json:"show_thinking,omitempty"` // 推理模型回答后显示思考过程（/think）
+	// NewsTopics /news set 设置的新闻主题，为空时使用 news.keywords
+	NewsTopics []string `json:"news_topics,omitempty"`
+	// AutoMemoryOff 不从该用户的对话中自动提取长期记忆（/memories auto off）
+	AutoMemoryOff bool `json:"auto_memory_off,omitempty"`
+}
+
+// flushDelay Save 后最多延迟多久写入文件，期间的修改合并为一次写入
+const flushDelay = time.Second
+
 type Storage struct {
-	mu       sync.RWMutex
-	path     string
+	mu   sync.RWMutex
+	path string
+	// 延迟写入：dirty 表示有未写入文件的修改，timer 到期时写入
+	writeMu  sync.Mutex // 串行化文件写入
+	flushMu  sync.Mutex
+	dirty    bool
+	closed   bool
+	timer    *time.Timer
+	flushErr error
+
 	UserData map[string]*UserSettings `json:"user_data"`
+	ChatData map[string]*ChatSettings `json:"chat_data"`
+	// 每日用量，日期 (2006-01-02) → 用户 → 用量
+	Usage map[string]map[string]*DailyUsage `json:"usage,omitempty"`
+	// 通过 /jobs pause 暂停的定时任务
+	PausedJobs []string `json:"paused_jobs,omitempty"`
+	// 推送频道的订阅，频道名 → 推送目标
+	Subscriptions map[string][]string `json:"subscriptions,omitempty"`
+	// MCP 服务的 OAuth token 缓存
+	MCPTokens map[string]*MCPToken `json:"mcp_tokens,omitempty"`
+	// 管理员通过 /mcp add 添加的 MCP 服务，与配置文件中的 mcpServers 一起连接
+	MCPServers map[string]config.MCPConfig `json:"mcp_servers,omitempty"`
+	// 模型执行的工具调用记录（/toolcalls）
+	ToolCalls []ToolCallLog `json:"tool_calls,omitempty"`
+	// 通过 /rss 订阅的 RSS/Atom 源
+	Feeds   []*Feed `json:"feeds,omitempty"`
+	FeedSeq int     `json:"feed_seq,omitempty"`
+	// A/B 实验开关（/experiment on|off）和样本
+	ExperimentOn bool     `json:"experiment_on,omitempty"`
+	Trials       []*Trial `json:"trials,omitempty"`
+	TrialSeq     int      `json:"trial_seq,omitempty"`
+	// 用户对 AI 回答的 👍/👎 评价
+	Ratings []*Rating `json:"ratings,omitempty"`
+	// 进行中的群组游戏（会话 → 游戏）和各会话的游戏积分（会话 → 用户 → 积分）
+	Games      map[string]*Game                 `json:"games,omitempty"`
+	GameScores map[string]map[string]*GameScore `json:"game_scores,omitempty"`
+	// WhatsApp 登录后的设备密钥和加密会话，扫码登录一次后重启无需再扫码
+	WhatsApp map[string][]byte `json:"whatsapp,omitempty"`
+	// 会过期的缓存（LLM 回复、计数器等），由维护任务定期清理
+	Cache map[string]*CacheEntry `json:"cache,omitempty"`
+	// 最近一次 /selftest 写入的标记
+	SelfTestAt time.Time `json:"self_test_at,omitempty"`
+	// 安静时段内推迟发送的推送消息（quiet_hours）
+	QuietQueue []QueuedMessage `json:"quiet_queue,omitempty"`
+	// 发送失败等待重试的推送消息（/outbox）和最近的发送记录
+	Outbox    []*OutboxMessage  `json:"outbox,omitempty"`
+	OutboxSeq int               `json:"outbox_seq,omitempty"`
+	Receipts  []DeliveryReceipt `json:"receipts,omitempty"`
 }
 
 func New(path string) (*Storage, error) {
 	s := &Storage{
 		path:     path,
 		UserData: make(map[string]*UserSettings),
+		ChatData: make(map[string]*ChatSettings),
+		Usage:    make(map[string]map[string]*DailyUsage),
 	}
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -42,19 +119,127 @@ func New(path string) (*Storage, error) {
 		return nil, err
 	}
 
+	// Older storage files may lack newer sections
+	if s.UserData == nil {
+		s.UserData = make(map[string]*UserSettings)
+	}
+	if s.ChatData == nil {
+		s.ChatData = make(map[string]*ChatSettings)
+	}
+	if s.Usage == nil {
+		s.Usage = make(map[string]map[string]*DailyUsage)
+	}
+
 	return s, nil
 }
 
+// Save marks the storage as changed. Changes are written to the file within flushDelay,
+// so a burst of updates costs one write.
+//
+// The returned error is that of the previous flush, not of this change: a nil error does not
+// mean the change is on disk. Callers that must report whether a change was written
+// (payments, deleting user data) use saveNow instead.
 func (s *Storage) Save() error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.flushMu.Lock()
+	s.dirty = true
+	if s.closed {
+		// 关闭后（如退出过程中仍在处理的消息）直接写入
+		s.flushMu.Unlock()
+		return s.Flush()
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(flushDelay, func() { _ = s.Flush() })
+	}
+	err := s.flushErr
+	s.flushMu.Unlock()
+	return err
+}
 
-	data, err := json.MarshalIndent(s, "", "  ")
+// saveNow marks the storage as changed and writes it immediately, returning the error of this write
+func (s *Storage) saveNow() error {
+	s.flushMu.Lock()
+	s.dirty = true
+	s.flushMu.Unlock()
+	return s.Flush()
+}
+
+// Flush writes pending changes to the file now
+func (s *Storage) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.flushMu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.dirty {
+		s.flushMu.Unlock()
+		return nil
+	}
+	s.dirty = false
+	s.flushMu.Unlock()
+
+	data, err := s.Snapshot()
+	if err == nil {
+		err = WriteFileAtomic(s.path, data, 0644)
+	}
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.flushErr = err
+	if err != nil {
+		// 写入失败时保留修改，稍后重试
+		s.dirty = true
+		if !s.closed && s.timer == nil {
+			s.timer = time.AfterFunc(flushDelay, func() { _ = s.Flush() })
+		}
+	}
+	return err
+}
+
+// Close writes pending changes, later calls to Save write immediately
+func (s *Storage) Close() error {
+	s.flushMu.Lock()
+	s.closed = true
+	s.flushMu.Unlock()
+	return s.Flush()
+}
+
+// WriteFileAtomic 先写入同目录下的临时文件再改名，进程崩溃时不会留下写了一半的文件
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name()) // 改名成功后为空操作
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Snapshot returns a consistent copy of the storage in the file format, used for backups
+func (s *Storage) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.MarshalIndent(s, "", "  ")
+}
 
-	return os.WriteFile(s.path, data, 0644)
+// Path returns the storage file path
+func (s *Storage) Path() string {
+	return s.path
 }
 
 func (s *Storage) GetUserAIConfig(userID string) *config.AIConfig {
@@ -68,22 +253,83 @@ func (s *Storage) GetUserAIConfig(userID string) *config.AIConfig {
 }
 
 func (s *Storage) UpdateUserAIConfig(userID string, cfg config.AIConfig) error {
-    s.mu.Lock()
-    if _, ok := s.UserData[userID]; !ok {
-        s.UserData[userID] = &UserSettings{}
-    }
-    cfgCopy := cfg
-    s.UserData[userID].OverrideAI = &cfgCopy
-    s.mu.Unlock()
-    
-    return s.Save()
+	s.mu.Lock()
+	if _, ok := s.UserData[userID]; !ok {
+		s.UserData[userID] = &UserSettings{}
+	}
+	cfgCopy := cfg
+	s.UserData[userID].OverrideAI = &cfgCopy
+	s.mu.Unlock()
+
+	return s.Save()
 }
 
 func (s *Storage) ClearUserAIConfig(userID string) error {
-    s.mu.Lock()
-    if user, ok := s.UserData[userID]; ok {
-        user.OverrideAI = nil
-    }
-    s.mu.Unlock()
-    return s.Save()
-}
\ No newline at end of file
+	s.mu.Lock()
+	if user, ok := s.UserData[userID]; ok {
+		user.OverrideAI = nil
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetUserProfile returns a copy of the user's profile, zero value if unset
+func (s *Storage) GetUserProfile(userID string) UserProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if user, ok := s.UserData[userID]; ok && user.Profile != nil {
+		return *user.Profile
+	}
+	return UserProfile{}
+}
+
+// UpdateUserProfile applies fn to the user's profile and saves it
+func (s *Storage) UpdateUserProfile(userID string, fn func(p *UserProfile)) error {
+	s.mu.Lock()
+	user, ok := s.UserData[userID]
+	if !ok {
+		user = &UserSettings{}
+		s.UserData[userID] = user
+	}
+	if user.Profile == nil {
+		user.Profile = &UserProfile{}
+	}
+	fn(user.Profile)
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// JobPaused reports whether the scheduled job was paused with /jobs pause
+func (s *Storage) JobPaused(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.PausedJobs, name)
+}
+
+func (s *Storage) SetJobPaused(name string, paused bool) error {
+	s.mu.Lock()
+	i := slices.Index(s.PausedJobs, name)
+	switch {
+	case paused && i < 0:
+		s.PausedJobs = append(s.PausedJobs, name)
+	case !paused && i >= 0:
+		s.PausedJobs = slices.Delete(s.PausedJobs, i, i+1)
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// ListUsers returns the storage keys of all known users, sorted
+func (s *Storage) ListUsers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]string, 0, len(s.UserData))
+	for key := range s.UserData {
+		users = append(users, key)
+	}
+	slices.Sort(users)
+	return users
+}
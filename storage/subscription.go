@@ -0,0 +1,48 @@
+package storage
+
+import "slices"
+
+// Subscribe adds target ("Telegram:123", "QQ:User:OpenID") to the push channel, false if already subscribed
+func (s *Storage) Subscribe(channel, target string) (bool, error) {
+	s.mu.Lock()
+	if slices.Contains(s.Subscriptions[channel], target) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	if s.Subscriptions == nil {
+		s.Subscriptions = make(map[string][]string)
+	}
+	s.Subscriptions[channel] = append(s.Subscriptions[channel], target)
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// Unsubscribe removes target from the push channel, false if it was not subscribed
+func (s *Storage) Unsubscribe(channel, target string) (bool, error) {
+	s.mu.Lock()
+	i := slices.Index(s.Subscriptions[channel], target)
+	if i < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.Subscriptions[channel] = slices.Delete(s.Subscriptions[channel], i, i+1)
+	if len(s.Subscriptions[channel]) == 0 {
+		delete(s.Subscriptions, channel)
+	}
+	s.mu.Unlock()
+	return true, s.Save()
+}
+
+// Subscribers returns the targets subscribed to the push channel
+func (s *Storage) Subscribers(channel string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.Subscriptions[channel])
+}
+
+// Subscribed reports whether target is subscribed to the push channel
+func (s *Storage) Subscribed(channel, target string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.Subscriptions[channel], target)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// maxToolCallLogs 最多保留的工具调用记录条数，超出时丢弃最早的
+const maxToolCallLogs = 2000
+
+// ToolCallLog 记录模型执行的一次工具调用，用于排查问题和安全审查（/toolcalls）
+type ToolCallLog struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id,omitempty"`
+	User      string        `json:"user"` // Platform:UserID
+	Tool      string        `json:"tool"`
+	Arguments string        `json:"arguments,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Result    string        `json:"result,omitempty"` // 截断后的结果
+	Error     string        `json:"error,omitempty"`
+}
+
+// AddToolCallLogs appends tool call records, keeping the last maxToolCallLogs
+func (s *Storage) AddToolCallLogs(logs ...ToolCallLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	s.ToolCalls = append(s.ToolCalls, logs...)
+	if len(s.ToolCalls) > maxToolCallLogs {
+		s.ToolCalls = slices.Clone(s.ToolCalls[len(s.ToolCalls)-maxToolCallLogs:])
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// GetToolCallLogs returns the last n tool call records accepted by match (all when nil), oldest first
+func (s *Storage) GetToolCallLogs(n int, match func(ToolCallLog) bool) []ToolCallLog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var logs []ToolCallLog
+	for i := len(s.ToolCalls) - 1; i >= 0 && len(logs) < n; i-- {
+		if match == nil || match(s.ToolCalls[i]) {
+			logs = append(logs, s.ToolCalls[i])
+		}
+	}
+	slices.Reverse(logs)
+	return logs
+}
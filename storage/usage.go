@@ -0,0 +1,65 @@
+package storage
+
+import "time"
+
+// dayFormat 用量按天统计的日期格式
+const dayFormat = "2006-01-02"
+
+// DailyUsage 用户一天内的 AI 用量
+type DailyUsage struct {
+	Requests int `json:"requests"`
+	Tokens   int `json:"tokens"`
+}
+
+// Day returns the usage bucket for t
+func Day(t time.Time) string {
+	return t.Format(dayFormat)
+}
+
+// GetDailyUsage returns the usage of the user on day, zero value if none
+func (s *Storage) GetDailyUsage(userID, day string) DailyUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if u, ok := s.Usage[day][userID]; ok {
+		return *u
+	}
+	return DailyUsage{}
+}
+
+// AddDailyUsage adds requests and tokens to the user's usage on day
+func (s *Storage) AddDailyUsage(userID, day string, requests, tokens int) error {
+	s.mu.Lock()
+	users, ok := s.Usage[day]
+	if !ok {
+		users = make(map[string]*DailyUsage)
+		s.Usage[day] = users
+	}
+	u, ok := users[userID]
+	if !ok {
+		u = &DailyUsage{}
+		users[userID] = u
+	}
+	u.Requests += requests
+	u.Tokens += tokens
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// PruneUsage removes usage records of days before the given day, it returns the number of days removed
+func (s *Storage) PruneUsage(before string) (int, error) {
+	s.mu.Lock()
+	removed := 0
+	for day := range s.Usage {
+		if day < before {
+			delete(s.Usage, day)
+			removed++
+		}
+	}
+	s.mu.Unlock()
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save()
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UserExport 一个用户保存在存储中的全部数据（/export）
+type UserExport struct {
+	User       string        `json:"user"` // Platform:UserID
+	ExportedAt time.Time     `json:"exported_at"`
+	Settings   *UserSettings `json:"settings,omitempty"`
+	// 日期 → 用量
+	Usage map[string]DailyUsage `json:"usage,omitempty"`
+	// 订阅的推送频道
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	Ratings       []Rating `json:"ratings,omitempty"`
+	Trials        []Trial  `json:"trials,omitempty"`
+	// 会话 → 游戏积分
+	GameScores map[string]GameScore `json:"game_scores,omitempty"`
+	// 会话 → 消息日志：私聊的全部消息，群聊中用户发送的消息
+	Messages map[string][]LoggedMessage `json:"messages,omitempty"`
+	// 会话 → 被策略拦截的记录
+	PolicyViolations map[string][]PolicyViolation `json:"policy_violations,omitempty"`
+	// 用户的请求中模型执行的工具调用
+	ToolCalls []ToolCallLog `json:"tool_calls,omitempty"`
+	// 进行中的投票中用户投的票
+	Votes []PollVote `json:"votes,omitempty"`
+	// 安静时段内推迟发送给用户的推送消息
+	QueuedMessages []QueuedMessage `json:"queued_messages,omitempty"`
+	// 发件箱中发给用户的消息和发送记录
+	Outbox   []OutboxMessage   `json:"outbox,omitempty"`
+	Receipts []DeliveryReceipt `json:"receipts,omitempty"`
+}
+
+// PollVote 用户在一个投票中的选择
+type PollVote struct {
+	Chat     string `json:"chat"`
+	Poll     string `json:"poll"`
+	Question string `json:"question"`
+	Option   string `json:"option"`
+}
+
+// splitUserKey 将 "Platform:UserID" 拆成平台和用户 ID
+func splitUserKey(userKey string) (platform, id string) {
+	platform, id, _ = strings.Cut(userKey, ":")
+	return platform, id
+}
+
+// ownsMessage 消息是否属于用户：用户私聊中的消息，或用户在同一平台其他会话中发送的消息
+func ownsMessage(userKey, chatKey string, m LoggedMessage) bool {
+	if chatKey == userKey {
+		return true
+	}
+	platform, id := splitUserKey(userKey)
+	return strings.HasPrefix(chatKey, platform+":") && m.Direction == DirectionIn && m.UserID == id
+}
+
+// ownsViolation 拦截记录是否由用户触发
+func ownsViolation(userKey, chatKey string, v PolicyViolation) bool {
+	platform, id := splitUserKey(userKey)
+	return chatKey == userKey || strings.HasPrefix(chatKey, platform+":") && v.UserID == id
+}
+
+// ExportUser returns a copy of everything stored about userKey ("Platform:UserID").
+// targets are the user's push targets (e.g. "QQ:User:OpenID"), used to find their subscriptions
+func (s *Storage) ExportUser(userKey string, targets ...string) UserExport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := UserExport{User: userKey, ExportedAt: time.Now()}
+	if user, ok := s.UserData[userKey]; ok {
+		settings := *user
+		if user.OverrideAI != nil {
+			ai := *user.OverrideAI
+			settings.OverrideAI = &ai
+		}
+		if user.Profile != nil {
+			profile := *user.Profile
+			settings.Profile = &profile
+		}
+		settings.Audit = slices.Clone(user.Audit)
+		if user.Credits != nil {
+			credits := *user.Credits
+			credits.Payments = slices.Clone(credits.Payments)
+			settings.Credits = &credits
+		}
+		settings.Memories = slices.Clone(user.Memories)
+		// 向量由笔记内容生成，不导出
+		settings.Notes = nil
+		for _, note := range user.Notes {
+			note.Vector = nil
+			settings.Notes = append(settings.Notes, note)
+		}
+		e.Settings = &settings
+	}
+	for day, users := range s.Usage {
+		if u, ok := users[userKey]; ok {
+			if e.Usage == nil {
+				e.Usage = make(map[string]DailyUsage)
+			}
+			e.Usage[day] = *u
+		}
+	}
+	targets = append(targets, userKey)
+	for _, channel := range slices.Sorted(maps.Keys(s.Subscriptions)) {
+		if slices.ContainsFunc(s.Subscriptions[channel], func(t string) bool { return slices.Contains(targets, t) }) {
+			e.Subscriptions = append(e.Subscriptions, channel)
+		}
+	}
+	for _, r := range s.Ratings {
+		if r.User == userKey {
+			e.Ratings = append(e.Ratings, *r)
+		}
+	}
+	for _, t := range s.Trials {
+		if t.User == userKey {
+			e.Trials = append(e.Trials, *t)
+		}
+	}
+	for _, t := range s.ToolCalls {
+		if t.User == userKey {
+			e.ToolCalls = append(e.ToolCalls, t)
+		}
+	}
+	for chatKey, scores := range s.GameScores {
+		if score, ok := scores[userKey]; ok {
+			if e.GameScores == nil {
+				e.GameScores = make(map[string]GameScore)
+			}
+			e.GameScores[chatKey] = *score
+		}
+	}
+	for chatKey, chat := range s.ChatData {
+		for _, m := range chat.Messages {
+			if ownsMessage(userKey, chatKey, m) {
+				if e.Messages == nil {
+					e.Messages = make(map[string][]LoggedMessage)
+				}
+				e.Messages[chatKey] = append(e.Messages[chatKey], m)
+			}
+		}
+		for _, v := range chat.PolicyViolations {
+			if ownsViolation(userKey, chatKey, v) {
+				if e.PolicyViolations == nil {
+					e.PolicyViolations = make(map[string][]PolicyViolation)
+				}
+				e.PolicyViolations[chatKey] = append(e.PolicyViolations[chatKey], v)
+			}
+		}
+		for _, p := range chat.Polls {
+			if option, ok := p.Votes[userKey]; ok && option < len(p.Options) {
+				e.Votes = append(e.Votes, PollVote{Chat: chatKey, Poll: p.ID, Question: p.Question, Option: p.Options[option]})
+			}
+		}
+	}
+	for _, m := range s.QuietQueue {
+		if slices.Contains(targets, m.Target) {
+			e.QueuedMessages = append(e.QueuedMessages, m)
+		}
+	}
+	for _, m := range s.Outbox {
+		if slices.Contains(targets, m.Target) {
+			e.Outbox = append(e.Outbox, *m)
+		}
+	}
+	for _, r := range s.Receipts {
+		if slices.Contains(targets, r.Target) {
+			e.Receipts = append(e.Receipts, r)
+		}
+	}
+	slices.SortFunc(e.Votes, func(a, b PollVote) int {
+		return cmp.Or(cmp.Compare(a.Chat, b.Chat), cmp.Compare(a.Poll, b.Poll))
+	})
+	return e
+}
+
+// ForgetUser deletes everything stored about userKey, the same data ExportUser returns.
+// The user's private chat settings are removed, in other chats only their messages and violations
+func (s *Storage) ForgetUser(userKey string, targets ...string) error {
+	s.mu.Lock()
+	delete(s.UserData, userKey)
+	for day, users := range s.Usage {
+		delete(users, userKey)
+		if len(users) == 0 {
+			delete(s.Usage, day)
+		}
+	}
+	targets = append(targets, userKey)
+	for channel, subscribed := range s.Subscriptions {
+		subscribed = slices.DeleteFunc(subscribed, func(t string) bool { return slices.Contains(targets, t) })
+		if len(subscribed) == 0 {
+			delete(s.Subscriptions, channel)
+		} else {
+			s.Subscriptions[channel] = subscribed
+		}
+	}
+	s.Ratings = slices.DeleteFunc(s.Ratings, func(r *Rating) bool { return r.User == userKey })
+	s.Trials = slices.DeleteFunc(s.Trials, func(t *Trial) bool { return t.User == userKey })
+	s.ToolCalls = slices.DeleteFunc(s.ToolCalls, func(t ToolCallLog) bool { return t.User == userKey })
+	s.QuietQueue = slices.DeleteFunc(s.QuietQueue, func(m QueuedMessage) bool { return slices.Contains(targets, m.Target) })
+	s.Outbox = slices.DeleteFunc(s.Outbox, func(m *OutboxMessage) bool { return slices.Contains(targets, m.Target) })
+	s.Receipts = slices.DeleteFunc(s.Receipts, func(r DeliveryReceipt) bool { return slices.Contains(targets, r.Target) })
+	for chatKey, scores := range s.GameScores {
+		delete(scores, userKey)
+		if len(scores) == 0 {
+			delete(s.GameScores, chatKey)
+		}
+	}
+	delete(s.ChatData, userKey)
+	for chatKey, chat := range s.ChatData {
+		chat.Messages = slices.DeleteFunc(chat.Messages, func(m LoggedMessage) bool { return ownsMessage(userKey, chatKey, m) })
+		chat.PolicyViolations = slices.DeleteFunc(chat.PolicyViolations, func(v PolicyViolation) bool { return ownsViolation(userKey, chatKey, v) })
+		for _, p := range chat.Polls {
+			delete(p.Votes, userKey)
+		}
+	}
+	s.mu.Unlock()
+	// /forgetme 需要确认数据已从文件中删除
+	return s.saveNow()
+}
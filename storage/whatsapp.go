@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+)
+
+// WhatsAppGet returns the value saved under key in the WhatsApp session, nil if missing
+func (s *Storage) WhatsAppGet(key string) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.WhatsApp[key])
+}
+
+// WhatsAppPut saves the entries in the WhatsApp session in one write, nil values are deleted
+func (s *Storage) WhatsAppPut(entries map[string][]byte) error {
+	s.mu.Lock()
+	if s.WhatsApp == nil {
+		s.WhatsApp = make(map[string][]byte)
+	}
+	for key, value := range entries {
+		if value == nil {
+			delete(s.WhatsApp, key)
+		} else {
+			s.WhatsApp[key] = slices.Clone(value)
+		}
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// WhatsAppKeys returns the sorted keys with the prefix
+func (s *Storage) WhatsAppKeys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key := range s.WhatsApp {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// WhatsAppDeletePrefix removes all keys with the prefix, used to log out
+func (s *Storage) WhatsAppDeletePrefix(prefix string) error {
+	s.mu.Lock()
+	for key := range s.WhatsApp {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.WhatsApp, key)
+		}
+	}
+	s.mu.Unlock()
+	return s.Save()
+}
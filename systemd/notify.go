@@ -0,0 +1,78 @@
+// Package systemd 与 systemd 集成：sd_notify 通知就绪、停止和看门狗心跳，生成 service 单元文件
+package systemd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify 向 systemd 发送状态（如 "READY=1"），不是由 systemd 以 Type=notify 启动（没有 NOTIFY_SOCKET）时返回 false
+func Notify(state string) (bool, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+	// 以 @ 开头的是 Linux 抽象命名空间的 socket
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Ready 通知 systemd 启动完成
+func Ready() (bool, error) {
+	return Notify("READY=1")
+}
+
+// Stopping 通知 systemd 正在退出
+func Stopping() (bool, error) {
+	return Notify("STOPPING=1")
+}
+
+// WatchdogInterval 返回单元配置的 WatchdogSec，未启用看门狗或看门狗不是针对本进程时返回 0
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// StartWatchdog 启用看门狗时按 WatchdogSec 的一半发送心跳，直到 ctx 取消。
+// 进程卡死、心跳中断时 systemd 会按 Restart= 重启服务
+func StartWatchdog(ctx context.Context, logger *slog.Logger) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logger.Info("systemd watchdog enabled", "interval", interval)
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := Notify("WATCHDOG=1"); err != nil {
+					logger.Warn("Failed to notify systemd watchdog", "error", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package systemd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnitOptions 生成 service 单元文件的参数
+type UnitOptions struct {
+	Description string
+	Exec        string   // 可执行文件的绝对路径
+	Args        []string // 启动参数，如 --config
+	WorkDir     string
+	User        string // 为空时以 root 运行（用户级服务忽略）
+	Watchdog    int    // WatchdogSec，秒，0 不启用看门狗
+	UserUnit    bool   // 用户级服务（systemctl --user）
+}
+
+// Unit 生成 Type=notify 的 service 单元：启动完成后才视为已启动，异常退出或看门狗超时后自动重启
+func Unit(opts UnitOptions) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", opts.Description)
+	b.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n")
+
+	b.WriteString("[Service]\nType=notify\nNotifyAccess=main\n")
+	exec := []string{quote(opts.Exec)}
+	for _, arg := range opts.Args {
+		exec = append(exec, quote(arg))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(exec, " "))
+	if opts.WorkDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", quote(opts.WorkDir))
+	}
+	if opts.User != "" && !opts.UserUnit {
+		fmt.Fprintf(&b, "User=%s\n", opts.User)
+	}
+	b.WriteString("Restart=on-failure\nRestartSec=5\n")
+	if opts.Watchdog > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", opts.Watchdog)
+	}
+	b.WriteString("TimeoutStopSec=30\n\n")
+
+	b.WriteString("[Install]\n")
+	if opts.UserUnit {
+		b.WriteString("WantedBy=default.target\n")
+	} else {
+		b.WriteString("WantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// quote 按 systemd 的规则为含空白、引号或反斜杠的参数加引号，% 转义为 %%
+func quote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
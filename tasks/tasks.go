@@ -0,0 +1,181 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// Func is the body of a background task. report can be called at any time to
+// publish a human readable progress line.
+type Func func(ctx context.Context, report func(progress string)) error
+
+// Task is a snapshot of a background task
+type Task struct {
+	ID        string
+	Owner     string // Storage key of the user who started the task, e.g. "Telegram:123"
+	Name      string
+	Status    Status
+	Progress  string
+	Err       error
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+type entry struct {
+	task   Task
+	cancel context.CancelFunc
+}
+
+// Manager runs long jobs outside of message handlers so adapters are never blocked
+type Manager struct {
+	mu      sync.Mutex
+	logger  *slog.Logger
+	seq     int
+	entries map[string]*entry
+	slots   chan struct{}
+}
+
+// New creates a task manager that runs at most maxConcurrent tasks at once
+func New(maxConcurrent int, logger *slog.Logger) *Manager {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 2
+	}
+	return &Manager{
+		logger:  logger,
+		entries: make(map[string]*entry),
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// Submit starts fn in the background and returns the task ID immediately
+func (m *Manager) Submit(owner, name string, fn Func) string {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.mu.Lock()
+	m.seq++
+	id := fmt.Sprintf("t%d", m.seq)
+	e := &entry{
+		task: Task{
+			ID:        id,
+			Owner:     owner,
+			Name:      name,
+			Status:    StatusRunning,
+			Progress:  "排队中",
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	m.entries[id] = e
+	m.mu.Unlock()
+
+	go m.run(ctx, e, fn)
+	return id
+}
+
+func (m *Manager) run(ctx context.Context, e *entry, fn Func) {
+	defer e.cancel()
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		m.finish(e, ctx.Err())
+		return
+	}
+
+	m.logger.Info("Task started", "id", e.task.ID, "name", e.task.Name, "owner", e.task.Owner)
+
+	report := func(progress string) {
+		m.mu.Lock()
+		e.task.Progress = progress
+		m.mu.Unlock()
+	}
+
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("task panicked: %v", r)
+			}
+		}()
+		err = fn(ctx, report)
+	}()
+
+	m.finish(e, err)
+}
+
+func (m *Manager) finish(e *entry, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.task.EndedAt = time.Now()
+	switch {
+	case err == nil:
+		e.task.Status = StatusDone
+	case ctxCanceled(err):
+		e.task.Status = StatusCanceled
+	default:
+		e.task.Status = StatusFailed
+		e.task.Err = err
+	}
+	m.logger.Info("Task finished", "id", e.task.ID, "status", e.task.Status, "duration", e.task.EndedAt.Sub(e.task.StartedAt), "error", err)
+	m.prune()
+}
+
+// prune drops finished tasks older than an hour. Caller must hold m.mu.
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-time.Hour)
+	for id, e := range m.entries {
+		if e.task.Status != StatusRunning && e.task.EndedAt.Before(cutoff) {
+			delete(m.entries, id)
+		}
+	}
+}
+
+// Cancel stops a running task. Only the owner may cancel it.
+func (m *Manager) Cancel(owner, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[id]
+	if !ok || e.task.Owner != owner || e.task.Status != StatusRunning {
+		return false
+	}
+	e.cancel()
+	return true
+}
+
+// List returns the tasks started by owner, newest first. An empty owner lists all tasks.
+func (m *Manager) List(owner string) []Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []Task
+	for _, e := range m.entries {
+		if owner == "" || e.task.Owner == owner {
+			list = append(list, e.task)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+	return list
+}
+
+func ctxCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
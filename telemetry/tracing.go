@@ -0,0 +1,92 @@
+// Package telemetry 通过 OpenTelemetry 记录消息处理的链路：收到消息 → 插件处理 → 模型请求 → 工具调用 → 发送回复
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/lhpqaq/ggbot/config"
+	"github.com/lhpqaq/ggbot/core"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/lhpqaq/ggbot/telemetry")
+
+// enabled Setup 启用了 tracing，未启用时 Handler、Plugin 直接返回处理器
+var enabled bool
+
+// Setup 按 cfg 设置全局的 TracerProvider，之后创建的 span 以 OTLP/HTTP 导出。
+// 返回的函数在退出前调用，导出尚未发送的 span；未启用时什么都不做
+func Setup(cfg config.TracingConfig, logger *slog.Logger) func(context.Context) error {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(newExporter(cfg)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	// 模型请求等出站 HTTP 请求带上 traceparent，网关可以把自己的 span 关联到同一个 trace
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Tracing error", "error", err)
+	}))
+	enabled = true
+	logger.Info("Tracing enabled", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return provider.Shutdown
+}
+
+// Handler 为每条收到的消息开始一个 trace，name 如 "command /news"、"text"。
+// 处理器通过 core.TraceContext 取得 trace，发送的回复记录为子 span
+func Handler(name string, h core.Handler) core.Handler {
+	if !enabled {
+		return h
+	}
+	return func(c core.Context) error {
+		ctx, span := tracer.Start(core.TraceContext(c), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("ggbot.platform", c.Platform()),
+				attribute.String("ggbot.chat.type", c.Chat().Type),
+				attribute.String("ggbot.request_id", core.RequestID(c)),
+			))
+		defer span.End()
+		err := h(core.WithTrace(c, ctx, true))
+		end(span, err)
+		return err
+	}
+}
+
+// Plugin 记录插件处理消息的 span，插件把消息交给下一个处理器（core.ErrPass）时标记为 passed
+func Plugin(plugin string, h core.Handler) core.Handler {
+	if !enabled {
+		return h
+	}
+	return func(c core.Context) error {
+		ctx, span := tracer.Start(core.TraceContext(c), "plugin "+plugin,
+			trace.WithAttributes(attribute.String("ggbot.plugin", plugin)))
+		defer span.End()
+		err := h(core.WithTrace(c, ctx, false))
+		end(span, err)
+		return err
+	}
+}
+
+// end 在 span 上记录处理结果
+func end(span trace.Span, err error) {
+	switch {
+	case errors.Is(err, core.ErrPass):
+		span.SetAttributes(attribute.Bool("ggbot.passed", true))
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,79 @@
+// Package version 构建信息：版本号、提交和构建时间，编译时用 -ldflags 注入，未注入时取 Go 记录的 VCS 信息
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// 编译时注入，如：
+//
+//	go build -ldflags "-X github.com/lhpqaq/ggbot/version.Version=v1.2.0 -X github.com/lhpqaq/ggbot/version.Commit=$(git rev-parse --short HEAD) -X github.com/lhpqaq/ggbot/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// Info 运行中的程序的构建信息
+type Info struct {
+	Version   string
+	Commit    string
+	Date      string
+	Modified  bool // 构建时工作区有未提交的修改
+	GoVersion string
+	Platform  string // GOOS/GOARCH
+}
+
+// Get 返回构建信息，-ldflags 未注入的字段取 debug.BuildInfo（go build 在 git 仓库中会记录提交和时间）
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if len(info.Commit) > 12 {
+		info.Commit = info.Commit[:12]
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// String 如 "v1.2.0 (a1b2c3d4e5f6, 2026-01-02T03:04:05Z)"
+func (i Info) String() string {
+	commit := i.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if i.Modified {
+		commit += "-dirty"
+	}
+	if i.Date == "" {
+		return fmt.Sprintf("%s (%s)", i.Version, commit)
+	}
+	return fmt.Sprintf("%s (%s, %s)", i.Version, commit, i.Date)
+}